@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigAccesos define si se escribe el log de acceso HTTP, en qué
+// formato y a dónde.
+type ConfigAccesos struct {
+	Formato string
+	Archivo string
+}
+
+// cargarConfigAccesos lee ACCESS_LOG (combinado o json; vacío lo
+// desactiva) y ACCESS_LOG_ARCHIVO (por defecto la salida estándar).
+func cargarConfigAccesos() ConfigAccesos {
+	return ConfigAccesos{
+		Formato: strings.ToLower(opcion("ACCESS_LOG")),
+		Archivo: opcion("ACCESS_LOG_ARCHIVO"),
+	}
+}
+
+// RegistroAcceso es una línea del log de acceso en formato JSON.
+type RegistroAcceso struct {
+	Fecha      time.Time `json:"fecha"`
+	IP         string    `json:"ip"`
+	Metodo     string    `json:"metodo"`
+	Ruta       string    `json:"ruta"`
+	Protocolo  string    `json:"protocolo"`
+	Status     int       `json:"status"`
+	Bytes      int       `json:"bytes"`
+	LatenciaMS float64   `json:"latencia_ms"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+}
+
+// accesosMiddleware escribe una línea por petición atendida en el formato
+// configurado: "combinado" (Apache combined seguido de la latencia en
+// microsegundos, como %D) o "json". Si el log de acceso no está activo
+// devuelve el handler sin cambios.
+func accesosMiddleware(cfg ConfigAccesos) (func(http.Handler) http.Handler, error) {
+	if cfg.Formato == "" {
+		return func(next http.Handler) http.Handler { return next }, nil
+	}
+	if cfg.Formato != "combinado" && cfg.Formato != "json" {
+		return nil, fmt.Errorf("formato de ACCESS_LOG desconocido: %q", cfg.Formato)
+	}
+	var salida io.Writer = os.Stdout
+	if cfg.Archivo != "" {
+		f, err := os.OpenFile(cfg.Archivo, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+		if err != nil {
+			return nil, err
+		}
+		salida = f
+	}
+	var mu sync.Mutex
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inicio := time.Now()
+			rw := &respuestaRegistrada{ResponseWriter: w}
+			next.ServeHTTP(rw, r)
+			latencia := time.Since(inicio)
+
+			status := rw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			acceso := RegistroAcceso{
+				Fecha:      inicio,
+				IP:         ipCliente(r),
+				Metodo:     r.Method,
+				Ruta:       redactarQuery(r.URL.RequestURI()),
+				Protocolo:  r.Proto,
+				Status:     status,
+				Bytes:      rw.bytes,
+				LatenciaMS: float64(latencia.Microseconds()) / 1000,
+				Referer:    redactarQuery(r.Referer()),
+				UserAgent:  r.UserAgent(),
+				RequestID:  requestID(r),
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if cfg.Formato == "json" {
+				json.NewEncoder(salida).Encode(acceso)
+				return
+			}
+			fmt.Fprintf(salida, "%s - - [%s] %q %d %s %q %q %d\n",
+				acceso.IP,
+				acceso.Fecha.Format("02/Jan/2006:15:04:05 -0700"),
+				acceso.Metodo+" "+acceso.Ruta+" "+acceso.Protocolo,
+				acceso.Status,
+				bytesCombinado(acceso.Bytes),
+				guionSiVacio(acceso.Referer),
+				guionSiVacio(acceso.UserAgent),
+				latencia.Microseconds())
+		})
+	}, nil
+}
+
+// bytesCombinado devuelve el tamaño de la respuesta como en %b de Apache:
+// "-" si no hubo cuerpo.
+func bytesCombinado(n int) string {
+	if n == 0 {
+		return "-"
+	}
+	return fmt.Sprint(n)
+}
+
+// guionSiVacio devuelve "-" para los campos vacíos del formato combinado.
+func guionSiVacio(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"cmp"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"pruebasgo/validacion"
+)
+
+// esCorreoAdmin indica si el correo está configurado como administrador
+// en ADMIN_CORREOS.
+func esCorreoAdmin(correo string) bool {
+	correo = validacion.NormalizarCorreo(correo)
+	return correo != "" && slices.Contains(config.AdminCorreos, correo)
+}
+
+// UsuarioAdminResponse define la vista de un usuario para administradores.
+type UsuarioAdminResponse struct {
+	PerfilResponse
+	Admin               bool         `json:"admin"`
+	Estado              EstadoCuenta `json:"estado"`
+	FechaRegistro       time.Time    `json:"fecha_registro"`
+	DebeCambiarPassword bool         `json:"debe_cambiar_password"`
+}
+
+// CrearUsuarioRequest define el cuerpo esperado para
+// POST /admin/usuarios.
+type CrearUsuarioRequest struct {
+	Correo   string `json:"correo"`
+	Telefono string `json:"telefono"`
+	Password string `json:"password"`
+	Admin    bool   `json:"admin,omitempty"`
+}
+
+// ListadoUsuariosResponse define la respuesta paginada de
+// GET /admin/usuarios.
+type ListadoUsuariosResponse struct {
+	Usuarios []UsuarioAdminResponse `json:"usuarios"`
+	Total    int                    `json:"total"`
+	// Page falta al paginar con cursor.
+	Page  int `json:"page,omitempty"`
+	Limit int `json:"limit"`
+}
+
+// administrador protege un handler exigiendo un usuario autenticado con
+// rol de administrador.
+func administrador(next http.HandlerFunc) http.HandlerFunc {
+	return autenticado(func(w http.ResponseWriter, r *http.Request) {
+		usuario := usuarioAutenticado(r)
+		if usuario == nil {
+			// La cuenta se eliminó después de validar el token.
+			escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "No autenticado", Codigo: "NO_AUTENTICADO"})
+			return
+		}
+		if !usuario.Admin {
+			escribirJSON(w, http.StatusForbidden, ErrorResponse{Error: "Se requiere rol de administrador", Codigo: "ADMIN_REQUERIDO"})
+			return
+		}
+		next(w, r)
+	})
+}
+
+// listarUsuariosHandler devuelve los usuarios registrados con paginación,
+// filtros y orden:
+// - cursor o page, y limit: paginación (ver leerPaginacion)
+// - correo: subcadena del correo, sin distinguir mayúsculas
+// - verificado: true/false según el correo esté verificado
+// - estado: activa, suspendida o eliminada
+// - orden: correo, fecha_registro; con prefijo "-" para orden descendente
+func listarUsuariosHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p, ok := leerPaginacion(w, q)
+	if !ok {
+		return
+	}
+
+	var verificado *bool
+	if v := q.Get("verificado"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parámetro verificado inválido", Codigo: "PARAMETRO_INVALIDO"})
+			return
+		}
+		verificado = &b
+	}
+	filtroCorreo := strings.ToLower(q.Get("correo"))
+	filtroEstado := EstadoCuenta(q.Get("estado"))
+
+	orden := q.Get("orden")
+	campo, descendente := strings.TrimPrefix(orden, "-"), strings.HasPrefix(orden, "-")
+	if campo == "" {
+		campo = "fecha_registro"
+	}
+	if campo != "correo" && campo != "fecha_registro" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parámetro orden inválido", Codigo: "PARAMETRO_INVALIDO"})
+		return
+	}
+
+	// Cada usuario se filtra y se copia a la respuesta con su lock
+	// tomado; el orden y la paginación se aplican sobre las copias.
+	filtrados := []UsuarioAdminResponse{}
+	for _, u := range usuariosAlmacenados() {
+		desbloquear := u.bloquear()
+		if (filtroCorreo == "" || strings.Contains(strings.ToLower(u.Correo), filtroCorreo)) &&
+			(verificado == nil || u.CorreoVerificado == *verificado) &&
+			(filtroEstado == "" || u.Estado == filtroEstado) {
+			filtrados = append(filtrados, nuevoUsuarioAdminResponse(u))
+		}
+		desbloquear()
+	}
+
+	// El ID desempata, para que el orden, y con él los cursores, sea
+	// total.
+	comparar := func(a, b UsuarioAdminResponse) int {
+		c := a.FechaRegistro.Compare(b.FechaRegistro)
+		if campo == "correo" {
+			c = strings.Compare(a.Correo, b.Correo)
+		}
+		if c == 0 {
+			c = strings.Compare(a.ID, b.ID)
+		}
+		if descendente {
+			return -c
+		}
+		return c
+	}
+	slices.SortFunc(filtrados, comparar)
+
+	orden = cmp.Or(orden, campo)
+	var despues func(UsuarioAdminResponse) bool
+	if p.cursor != nil {
+		ultimo := UsuarioAdminResponse{PerfilResponse: PerfilResponse{ID: p.cursor.ID, Correo: p.cursor.Clave}}
+		fecha, err := time.Parse(time.RFC3339Nano, p.cursor.Clave)
+		if p.cursor.Orden != orden || (campo == "fecha_registro" && err != nil) {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parámetro cursor inválido", Codigo: "PARAMETRO_INVALIDO"})
+			return
+		}
+		ultimo.FechaRegistro = fecha
+		despues = func(u UsuarioAdminResponse) bool { return comparar(u, ultimo) > 0 }
+	}
+	pagina, cursor := paginar(filtrados, p, despues, func(u UsuarioAdminResponse) cursorListado {
+		clave := u.FechaRegistro.Format(time.RFC3339Nano)
+		if campo == "correo" {
+			clave = u.Correo
+		}
+		return cursorListado{Orden: orden, Clave: clave, ID: u.ID}
+	})
+
+	siguienteCursor(w, cursor)
+	escribirJSON(w, http.StatusOK, ListadoUsuariosResponse{
+		Usuarios: pagina,
+		Total:    len(filtrados),
+		Page:     p.page,
+		Limit:    p.limit,
+	})
+}
+
+// obtenerUsuarioHandler devuelve el detalle del usuario {id}.
+func obtenerUsuarioHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := buscarUsuarioPorID(r.PathValue("id"))
+	if usuario == nil {
+		escribirJSON(w, http.StatusNotFound, ErrorResponse{Error: "Usuario no encontrado", Codigo: "USUARIO_NO_ENCONTRADO"})
+		return
+	}
+	defer usuario.bloquear()()
+	escribirJSON(w, http.StatusOK, nuevoUsuarioAdminResponse(usuario))
+}
+
+// nuevoUsuarioAdminResponse arma la vista administrativa de un usuario.
+func nuevoUsuarioAdminResponse(u *Usuario) UsuarioAdminResponse {
+	return UsuarioAdminResponse{
+		PerfilResponse:      nuevoPerfilResponse(u),
+		Admin:               u.Admin,
+		Estado:              u.Estado,
+		FechaRegistro:       u.FechaRegistro,
+		DebeCambiarPassword: u.DebeCambiarPassword,
+	}
+}
+
+// crearUsuarioHandler da de alta una cuenta, opcionalmente con rol de
+// administrador, con las mismas validaciones que el registro pero sin
+// depender de la flag registro_abierto.
+func crearUsuarioHandler(w http.ResponseWriter, r *http.Request) {
+	var req CrearUsuarioRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+
+	usuario, errServicio := altaCuenta(r, RegistroRequest{
+		Correo:   req.Correo,
+		Telefono: req.Telefono,
+		Password: req.Password,
+	}, req.Admin)
+	if errServicio != nil {
+		responderErrorServicio(w, errServicio)
+		return
+	}
+	defer usuario.bloquear()()
+	detalle := ""
+	if usuario.Admin {
+		detalle = "admin"
+	}
+	auditar(r, "usuario_creado", correoAutenticado(r), usuario.Correo, detalle)
+	escribirJSON(w, http.StatusCreated, nuevoUsuarioAdminResponse(usuario))
+}
+
+// revocarTokensHandler invalida todos los tokens emitidos al usuario {id},
+// que tendrá que volver a iniciar sesión.
+func revocarTokensHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := buscarUsuarioPorID(r.PathValue("id"))
+	if usuario == nil {
+		escribirJSON(w, http.StatusNotFound, ErrorResponse{Error: "Usuario no encontrado", Codigo: "USUARIO_NO_ENCONTRADO"})
+		return
+	}
+	defer usuario.bloquear()()
+
+	revocarTokens(r, usuario, "revocados_por_admin")
+	slog.InfoContext(r.Context(), "Tokens revocados por un administrador", "correo", usuario.Correo)
+	escribirJSON(w, http.StatusOK, MensajeResponse{Mensaje: "Tokens revocados"})
+}
+
+// forzarCambioPasswordHandler obliga al usuario {id} a cambiar su
+// contraseña: revoca sus tokens y, hasta que la cambie, los nuevos sólo
+// sirven para POST /password/cambiar.
+func forzarCambioPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := buscarUsuarioPorID(r.PathValue("id"))
+	if usuario == nil {
+		escribirJSON(w, http.StatusNotFound, ErrorResponse{Error: "Usuario no encontrado", Codigo: "USUARIO_NO_ENCONTRADO"})
+		return
+	}
+	defer usuario.bloquear()()
+	if usuario.Password == "" {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "La cuenta no tiene contraseña", Codigo: "CUENTA_SIN_PASSWORD"})
+		return
+	}
+
+	usuario.DebeCambiarPassword = true
+	registrarEvento(usuario, "cambio_password_forzado")
+	revocarTokens(r, usuario, "cambio_password_forzado")
+	slog.InfoContext(r.Context(), "Cambio de contraseña forzado", "correo", usuario.Correo)
+	escribirJSON(w, http.StatusOK, nuevoUsuarioAdminResponse(usuario))
+}
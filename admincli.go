@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// accionesAdmin lista las acciones del subcomando admin.
+var accionesAdmin = []struct {
+	nombre, uso, descripcion string
+	ejecutar                 func(c *clienteAdmin, args []string) error
+}{
+	{"usuarios", "[--correo texto] [--estado estado] [--page n] [--limit n]", "Lista los usuarios", adminUsuarios},
+	{"crear-admin", "--correo correo --telefono telefono --password password", "Crea una cuenta de administrador", adminCrearAdmin},
+	{"revocar-tokens", "<id|correo>", "Revoca todos los tokens del usuario", adminRevocarTokens},
+	{"forzar-reset", "<id|correo>", "Obliga al usuario a cambiar su contraseña", adminForzarReset},
+}
+
+// comandoAdmin ejecuta una acción de administración contra la API del
+// servidor en marcha, que es quien tiene el almacenamiento de usuarios.
+// Se autentica con un token de administrador (--token o ADMIN_TOKEN) o
+// iniciando sesión con --correo y la contraseña de ADMIN_PASSWORD.
+func comandoAdmin(args []string) {
+	fs := flag.NewFlagSet("admin", flag.ExitOnError)
+	base := fs.String("url", config.URLPublica, "URL base del servidor")
+	token := fs.String("token", os.Getenv("ADMIN_TOKEN"), "token de acceso de un administrador (ADMIN_TOKEN)")
+	correo := fs.String("correo", "", "correo del administrador con que iniciar sesión si no hay token")
+	codigo := fs.String("codigo", "", "código de segundo factor para iniciar sesión")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Uso: %s admin [flags] <acción> [argumentos]\n\nAcciones:\n", os.Args[0])
+		for _, a := range accionesAdmin {
+			fmt.Fprintf(os.Stderr, "  %-15s %s\n  %-15s   %s\n", a.nombre, a.descripcion, "", a.uso)
+		}
+		fmt.Fprintf(os.Stderr, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	c := &clienteAdmin{base: strings.TrimSuffix(*base, "/") + "/api/v1", token: *token, http: &http.Client{Timeout: 15 * time.Second}}
+	if c.token == "" {
+		if *correo == "" {
+			fmt.Fprintln(os.Stderr, "Falta el token de autenticación: usa --token, ADMIN_TOKEN o --correo con ADMIN_PASSWORD")
+			os.Exit(2)
+		}
+		if err := c.iniciarSesion(*correo, os.Getenv("ADMIN_PASSWORD"), *codigo); err != nil {
+			fmt.Fprintln(os.Stderr, "Error iniciando sesión:", err)
+			os.Exit(1)
+		}
+	}
+
+	for _, a := range accionesAdmin {
+		if a.nombre == fs.Arg(0) {
+			if err := a.ejecutar(c, fs.Args()[1:]); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Acción desconocida: %s\n\n", fs.Arg(0))
+	fs.Usage()
+	os.Exit(2)
+}
+
+// clienteAdmin hace peticiones autenticadas a la API.
+type clienteAdmin struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// peticion envía cuerpo, si no es nil, como JSON y decodifica el data del
+// sobre de la respuesta en destino. Las respuestas de error se devuelven
+// como error con el mensaje del error del sobre.
+func (c *clienteAdmin) peticion(metodo, ruta string, cuerpo, destino any) error {
+	var body io.Reader
+	if cuerpo != nil {
+		datos, err := json.Marshal(cuerpo)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(datos)
+	}
+	req, err := http.NewRequest(metodo, c.base+ruta, body)
+	if err != nil {
+		return err
+	}
+	if cuerpo != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var sobre struct {
+		Data  json.RawMessage `json:"data"`
+		Error *ErrorSobre     `json:"error"`
+	}
+	if resp.StatusCode >= 400 {
+		if json.NewDecoder(resp.Body).Decode(&sobre) != nil || sobre.Error == nil || sobre.Error.Mensaje == "" {
+			return fmt.Errorf("%s %s: %s", metodo, ruta, resp.Status)
+		}
+		mensaje := sobre.Error.Mensaje
+		for _, e := range sobre.Error.Errores {
+			if e.Mensaje != mensaje {
+				mensaje += "; " + e.Mensaje
+			}
+			for _, regla := range e.Reglas {
+				mensaje += "; " + regla
+			}
+		}
+		return errors.New(mensaje)
+	}
+	if destino == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sobre); err != nil {
+		return err
+	}
+	return json.Unmarshal(sobre.Data, destino)
+}
+
+// iniciarSesion obtiene el token con las credenciales del administrador.
+func (c *clienteAdmin) iniciarSesion(correo, password, codigo string) error {
+	if password == "" {
+		return errors.New("falta la contraseña en ADMIN_PASSWORD")
+	}
+	var resp LoginResponse
+	if err := c.peticion(http.MethodPost, "/login", LoginRequest{Correo: correo, Password: password, Codigo: codigo}, &resp); err != nil {
+		return err
+	}
+	if resp.DebeCambiarPassword {
+		return errors.New("el administrador debe cambiar su contraseña antes de continuar")
+	}
+	c.token = resp.Token
+	return nil
+}
+
+// idUsuario devuelve el ID del usuario indicado por su ID o su correo.
+func (c *clienteAdmin) idUsuario(usuario string) (string, error) {
+	if !strings.Contains(usuario, "@") {
+		return usuario, nil
+	}
+	var listado ListadoUsuariosResponse
+	q := url.Values{"correo": {usuario}, "limit": {strconv.Itoa(limiteMaximo)}}
+	if err := c.peticion(http.MethodGet, "/admin/usuarios?"+q.Encode(), nil, &listado); err != nil {
+		return "", err
+	}
+	for _, u := range listado.Usuarios {
+		if strings.EqualFold(u.Correo, usuario) {
+			return u.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no hay un usuario con el correo %s", usuario)
+}
+
+// usuarioArgumento lee el único argumento <id|correo> de una acción.
+func (c *clienteAdmin) usuarioArgumento(accion string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("uso: admin %s <id|correo>", accion)
+	}
+	return c.idUsuario(args[0])
+}
+
+// adminUsuarios escribe una tabla con los usuarios que cumplen los
+// filtros.
+func adminUsuarios(c *clienteAdmin, args []string) error {
+	fs := flag.NewFlagSet("usuarios", flag.ExitOnError)
+	correo := fs.String("correo", "", "subcadena del correo")
+	estado := fs.String("estado", "", "activa, suspendida o eliminada")
+	page := fs.Int("page", 1, "página")
+	limit := fs.Int("limit", limitePorDefecto, "usuarios por página")
+	fs.Parse(args)
+
+	q := url.Values{"page": {strconv.Itoa(*page)}, "limit": {strconv.Itoa(*limit)}, "orden": {"correo"}}
+	if *correo != "" {
+		q.Set("correo", *correo)
+	}
+	if *estado != "" {
+		q.Set("estado", *estado)
+	}
+	var listado ListadoUsuariosResponse
+	if err := c.peticion(http.MethodGet, "/admin/usuarios?"+q.Encode(), nil, &listado); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCORREO\tTELÉFONO\tESTADO\tADMIN\tVERIFICADO\tCAMBIO CONTRASEÑA")
+	for _, u := range listado.Usuarios {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", u.ID, u.Correo, u.Telefono, u.Estado,
+			siNo(u.Admin), siNo(u.CorreoVerificado), siNo(u.DebeCambiarPassword))
+	}
+	tw.Flush()
+	fmt.Printf("\nPágina %d: %d de %d usuarios\n", listado.Page, len(listado.Usuarios), listado.Total)
+	return nil
+}
+
+// siNo escribe un booleano para la tabla de usuarios.
+func siNo(v bool) string {
+	if v {
+		return "sí"
+	}
+	return "no"
+}
+
+// adminCrearAdmin crea una cuenta con rol de administrador.
+func adminCrearAdmin(c *clienteAdmin, args []string) error {
+	fs := flag.NewFlagSet("crear-admin", flag.ExitOnError)
+	req := CrearUsuarioRequest{Admin: true}
+	fs.StringVar(&req.Correo, "correo", "", "correo de la cuenta")
+	fs.StringVar(&req.Telefono, "telefono", "", "teléfono de la cuenta")
+	fs.StringVar(&req.Password, "password", "", "contraseña de la cuenta")
+	fs.Parse(args)
+
+	var usuario UsuarioAdminResponse
+	if err := c.peticion(http.MethodPost, "/admin/usuarios", req, &usuario); err != nil {
+		return err
+	}
+	fmt.Printf("Administrador creado: %s (%s)\n", usuario.Correo, usuario.ID)
+	return nil
+}
+
+// adminRevocarTokens revoca los tokens del usuario.
+func adminRevocarTokens(c *clienteAdmin, args []string) error {
+	id, err := c.usuarioArgumento("revocar-tokens", args)
+	if err != nil {
+		return err
+	}
+	if err := c.peticion(http.MethodPost, "/admin/usuarios/"+url.PathEscape(id)+"/revocar-tokens", nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("Tokens revocados: %s\n", args[0])
+	return nil
+}
+
+// adminForzarReset obliga al usuario a cambiar su contraseña.
+func adminForzarReset(c *clienteAdmin, args []string) error {
+	id, err := c.usuarioArgumento("forzar-reset", args)
+	if err != nil {
+		return err
+	}
+	var usuario UsuarioAdminResponse
+	if err := c.peticion(http.MethodPost, "/admin/usuarios/"+url.PathEscape(id)+"/forzar-cambio-password", nil, &usuario); err != nil {
+		return err
+	}
+	fmt.Printf("Cambio de contraseña forzado: %s; sus sesiones fueron cerradas\n", usuario.Correo)
+	return nil
+}
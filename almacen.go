@@ -0,0 +1,332 @@
+package main
+
+import (
+	"hash/maphash"
+	"slices"
+	"sync"
+
+	"pruebasgo/validacion"
+)
+
+// repositorioUsuarios es la capa de datos de las cuentas: los handlers y
+// servicios la usan a través de las funciones de este archivo
+// (buscarUsuario, insertarUsuario, ...). La implementación del servicio
+// es repositorioMemoria, la única opción de ALMACENAMIENTO; las pruebas la
+// reemplazan por un repositorio falso para probar handlers y servicios
+// aislados del store.
+type repositorioUsuarios interface {
+	// porID y porCorreo devuelven el usuario o nil si no existe. El
+	// correo llega normalizado.
+	porID(id string) *Usuario
+	porCorreo(correo string) *Usuario
+	// todos devuelve una copia de la lista de usuarios, en orden de alta.
+	todos() []*Usuario
+	contar() int
+	// buscar devuelve los correos de hasta limite usuarios cuyo correo o
+	// teléfono empieza con texto o, si subcadena, lo contiene.
+	buscar(texto string, limite int, subcadena bool) []string
+	// insertar, cambiarContacto y eliminar se comportan como
+	// insertarUsuario, cambiarContactoUsuario y eliminarUsuario.
+	insertar(u *Usuario) []string
+	cambiarContacto(u *Usuario, correo, telefono string) []string
+	eliminar(correo string)
+}
+
+// repositorio es la capa de datos que usa el servicio.
+var repositorio repositorioUsuarios = nuevoRepositorioMemoria()
+
+// repositorioMemoria es una base de datos simulada en memoria.
+//
+// usuarios guarda punteros, en orden de alta, para que los de los
+// índices sigan siendo válidos cuando el slice crece o se elimina un
+// usuario. mu protege a usuarios y al índice de búsqueda. Los índices
+// exactos por ID, correo y teléfono están en shards, con un lock cada
+// uno, para que los logins simultáneos no compitan por un solo lock.
+//
+// Los métodos toman los locks por el tiempo mínimo: el chequeo de
+// duplicados y el alta o el cambio de correo o teléfono ocurren con los
+// shards involucrados tomados, de modo que dos peticiones simultáneas no
+// pueden registrar el mismo correo. Para no bloquearse entre sí, las
+// escrituras toman primero los shards, en orden de índice, y después mu.
+// Los demás campos de cada Usuario los protege su propio lock, que los
+// handlers toman antes que los del repositorio; el repositorio nunca lo
+// toma, salvo bloquearUsuarioDonde, que lo hace sin tener los suyos.
+type repositorioMemoria struct {
+	mu       sync.RWMutex
+	usuarios []*Usuario
+	indice   *indiceBusqueda
+	shards   *[numShardsUsuarios]shardUsuarios
+}
+
+// nuevoRepositorioMemoria crea un repositorio vacío.
+func nuevoRepositorioMemoria() *repositorioMemoria {
+	return &repositorioMemoria{
+		usuarios: []*Usuario{},
+		indice:   nuevoIndiceBusqueda(),
+		shards:   nuevosShardsUsuarios(),
+	}
+}
+
+// numShardsUsuarios es en cuántos shards se reparten los índices exactos.
+const numShardsUsuarios = 32
+
+// shardUsuarios es una parte de los índices exactos. Cada índice se
+// reparte por el hash de su propia clave: el de correos por el correo, el
+// de IDs por el ID y el de teléfonos por el teléfono, así que cada
+// búsqueda consulta un solo shard.
+type shardUsuarios struct {
+	mu          sync.RWMutex
+	porID       map[string]*Usuario
+	porCorreo   map[string]*Usuario
+	porTelefono map[string]*Usuario
+}
+
+// semillaShards es la semilla del hash que elige el shard de cada clave.
+var semillaShards = maphash.MakeSeed()
+
+// nuevosShardsUsuarios crea los shards con sus índices vacíos.
+func nuevosShardsUsuarios() *[numShardsUsuarios]shardUsuarios {
+	shards := new([numShardsUsuarios]shardUsuarios)
+	for i := range shards {
+		shards[i].porID = map[string]*Usuario{}
+		shards[i].porCorreo = map[string]*Usuario{}
+		shards[i].porTelefono = map[string]*Usuario{}
+	}
+	return shards
+}
+
+// indiceShard devuelve el shard que corresponde a la clave.
+func indiceShard(clave string) int {
+	return int(maphash.String(semillaShards, clave) % numShardsUsuarios)
+}
+
+// shardDe devuelve el shard que indexa la clave.
+func (m *repositorioMemoria) shardDe(clave string) *shardUsuarios {
+	return &m.shards[indiceShard(clave)]
+}
+
+// bloquearShards toma los locks de escritura de los shards de las claves
+// y devuelve la función que los libera. Sin claves los toma todos.
+func (m *repositorioMemoria) bloquearShards(claves ...string) (desbloquear func()) {
+	var indices []int
+	for _, c := range claves {
+		indices = append(indices, indiceShard(c))
+	}
+	if len(claves) == 0 {
+		for i := range numShardsUsuarios {
+			indices = append(indices, i)
+		}
+	}
+	slices.Sort(indices)
+	indices = slices.Compact(indices)
+	for _, i := range indices {
+		m.shards[i].mu.Lock()
+	}
+	return func() {
+		for _, i := range slices.Backward(indices) {
+			m.shards[i].mu.Unlock()
+		}
+	}
+}
+
+// agregarAShards registra el correo y el teléfono de u en los índices
+// exactos. Requiere tomados sus shards.
+func (m *repositorioMemoria) agregarAShards(u *Usuario) {
+	m.shardDe(u.Correo).porCorreo[u.Correo] = u
+	if u.Telefono != "" {
+		m.shardDe(u.Telefono).porTelefono[u.Telefono] = u
+	}
+}
+
+// quitarDeShards quita el correo y el teléfono de u de los índices
+// exactos. Requiere tomados sus shards.
+func (m *repositorioMemoria) quitarDeShards(u *Usuario) {
+	if s := m.shardDe(u.Correo); s.porCorreo[u.Correo] == u {
+		delete(s.porCorreo, u.Correo)
+	}
+	if u.Telefono == "" {
+		return
+	}
+	if s := m.shardDe(u.Telefono); s.porTelefono[u.Telefono] == u {
+		delete(s.porTelefono, u.Telefono)
+	}
+}
+
+// Nombres de los campos únicos que devuelven insertarUsuario y
+// cambiarContactoUsuario.
+const (
+	campoCorreo   = "correo"
+	campoTelefono = "telefono"
+)
+
+// mensajesDuplicado es el mensaje de error de cada campo único repetido.
+var mensajesDuplicado = map[string]string{
+	campoCorreo:   "El correo ya se encuentra registrado",
+	campoTelefono: "El teléfono ya se encuentra registrado",
+}
+
+// codigosDuplicado es el código del error de cada campo único repetido.
+var codigosDuplicado = map[string]string{
+	campoCorreo:   "CORREO_DUPLICADO",
+	campoTelefono: "TELEFONO_DUPLICADO",
+}
+
+// buscarUsuarioPorID devuelve un puntero al usuario con el ID indicado,
+// o nil si no existe.
+func buscarUsuarioPorID(id string) *Usuario {
+	return repositorio.porID(id)
+}
+
+// buscarUsuario devuelve un puntero al usuario con el correo indicado, o
+// nil si no existe. El correo se normaliza antes de comparar.
+func buscarUsuario(correo string) *Usuario {
+	return repositorio.porCorreo(validacion.NormalizarCorreo(correo))
+}
+
+// usuariosAlmacenados devuelve una copia de la lista de usuarios, que se
+// puede recorrer sin bloquear las altas.
+func usuariosAlmacenados() []*Usuario {
+	return repositorio.todos()
+}
+
+// bloquearUsuarioDonde devuelve el primer usuario que cumple cond, que se
+// evalúa con el lock de cada usuario tomado, y la función que libera su
+// lock, que sigue tomado para que la condición no deje de cumplirse. Si
+// ninguno la cumple devuelve nil.
+func bloquearUsuarioDonde(cond func(u *Usuario) bool) (*Usuario, func()) {
+	for _, u := range repositorio.todos() {
+		desbloquear := u.bloquear()
+		if cond(u) {
+			return u, desbloquear
+		}
+		desbloquear()
+	}
+	return nil, func() {}
+}
+
+// contarUsuarios devuelve cuántos usuarios hay en la base.
+func contarUsuarios() int {
+	return repositorio.contar()
+}
+
+// insertarUsuario agrega u a la base si su correo y su teléfono no los
+// tiene otro usuario. Si los tiene, no lo agrega y devuelve los campos
+// repetidos.
+func insertarUsuario(u *Usuario) []string {
+	return repositorio.insertar(u)
+}
+
+// cambiarContactoUsuario reemplaza el correo y el teléfono de u si no los
+// tiene otro usuario. Si los tiene, no cambia nada y devuelve los campos
+// repetidos.
+func cambiarContactoUsuario(u *Usuario, correo, telefono string) []string {
+	return repositorio.cambiarContacto(u, correo, telefono)
+}
+
+// eliminarUsuario quita de la base al usuario con el correo indicado
+// junto con todos sus datos.
+func eliminarUsuario(correo string) {
+	repositorio.eliminar(correo)
+}
+
+func (m *repositorioMemoria) porID(id string) *Usuario {
+	s := m.shardDe(id)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.porID[id]
+}
+
+func (m *repositorioMemoria) porCorreo(correo string) *Usuario {
+	s := m.shardDe(correo)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.porCorreo[correo]
+}
+
+func (m *repositorioMemoria) todos() []*Usuario {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.usuarios)
+}
+
+func (m *repositorioMemoria) contar() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.usuarios)
+}
+
+func (m *repositorioMemoria) buscar(texto string, limite int, subcadena bool) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if subcadena {
+		return m.indice.buscarSubcadena(texto, limite)
+	}
+	return m.indice.buscarPrefijo(texto, limite)
+}
+
+// duplicados devuelve los campos únicos que correo y telefono repiten de
+// un usuario distinto de u. Requiere tomados los shards de correo y
+// telefono.
+func (m *repositorioMemoria) duplicados(u *Usuario, correo, telefono string) []string {
+	var campos []string
+	if otro := m.shardDe(correo).porCorreo[correo]; otro != nil && otro != u {
+		campos = append(campos, campoCorreo)
+	}
+	if otro := m.shardDe(telefono).porTelefono[telefono]; telefono != "" && otro != nil && otro != u {
+		campos = append(campos, campoTelefono)
+	}
+	return campos
+}
+
+// insertar toma sólo los shards del ID, el correo y el teléfono de u.
+func (m *repositorioMemoria) insertar(u *Usuario) []string {
+	defer m.bloquearShards(u.ID, u.Correo, u.Telefono)()
+	if campos := m.duplicados(u, u.Correo, u.Telefono); len(campos) > 0 {
+		return campos
+	}
+	m.shardDe(u.ID).porID[u.ID] = u
+	m.agregarAShards(u)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usuarios = append(m.usuarios, u)
+	m.indice.indexar(u)
+	return nil
+}
+
+// cambiarContacto toma todos los shards, porque el correo y el teléfono
+// de u pueden estar cambiando en otra petición y los cambios son poco
+// frecuentes.
+func (m *repositorioMemoria) cambiarContacto(u *Usuario, correo, telefono string) []string {
+	defer m.bloquearShards()()
+	if campos := m.duplicados(u, correo, telefono); len(campos) > 0 {
+		return campos
+	}
+	m.quitarDeShards(u)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.indice.desindexar(u)
+	u.Correo, u.Telefono = correo, telefono
+	m.indice.indexar(u)
+	m.agregarAShards(u)
+	return nil
+}
+
+// eliminar toma todos los shards, como cambiarContacto.
+func (m *repositorioMemoria) eliminar(correo string) {
+	defer m.bloquearShards()()
+	u := m.shardDe(correo).porCorreo[correo]
+	if u == nil {
+		return
+	}
+	m.quitarDeShards(u)
+	delete(m.shardDe(u.ID).porID, u.ID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.indice.desindexar(u)
+	if i := slices.Index(m.usuarios, u); i >= 0 {
+		m.usuarios = slices.Delete(m.usuarios, i, i+1)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// repositorioFalso es un repositorioUsuarios para probar handlers y
+// servicios aislados del store: guarda los usuarios en un slice, sin
+// índices ni locks, y permite forzar los campos duplicados que devuelven
+// las escrituras. No es seguro para uso concurrente.
+type repositorioFalso struct {
+	usuarios []*Usuario
+	// duplicados, si no es nil, es lo que devuelven insertar y
+	// cambiarContacto, sin cambiar nada, como si otra petición hubiera
+	// registrado esos campos un instante antes.
+	duplicados []string
+}
+
+// usarRepositorio reemplaza la capa de datos por repo durante la prueba.
+func usarRepositorio(t *testing.T, repo repositorioUsuarios) {
+	t.Helper()
+	antes := repositorio
+	repositorio = repo
+	t.Cleanup(func() { repositorio = antes })
+}
+
+func (f *repositorioFalso) porID(id string) *Usuario {
+	i := slices.IndexFunc(f.usuarios, func(u *Usuario) bool { return u.ID == id })
+	if i < 0 {
+		return nil
+	}
+	return f.usuarios[i]
+}
+
+func (f *repositorioFalso) porCorreo(correo string) *Usuario {
+	i := slices.IndexFunc(f.usuarios, func(u *Usuario) bool { return u.Correo == correo })
+	if i < 0 {
+		return nil
+	}
+	return f.usuarios[i]
+}
+
+func (f *repositorioFalso) todos() []*Usuario { return slices.Clone(f.usuarios) }
+
+func (f *repositorioFalso) contar() int { return len(f.usuarios) }
+
+func (f *repositorioFalso) buscar(texto string, limite int, subcadena bool) []string {
+	var correos []string
+	for _, u := range f.usuarios {
+		coincide := strings.HasPrefix
+		if subcadena {
+			coincide = strings.Contains
+		}
+		if len(correos) < limite && (coincide(u.Correo, texto) || coincide(u.Telefono, texto)) {
+			correos = append(correos, u.Correo)
+		}
+	}
+	return correos
+}
+
+func (f *repositorioFalso) insertar(u *Usuario) []string {
+	if f.duplicados != nil {
+		return f.duplicados
+	}
+	f.usuarios = append(f.usuarios, u)
+	return nil
+}
+
+func (f *repositorioFalso) cambiarContacto(u *Usuario, correo, telefono string) []string {
+	if f.duplicados != nil {
+		return f.duplicados
+	}
+	u.Correo, u.Telefono = correo, telefono
+	return nil
+}
+
+func (f *repositorioFalso) eliminar(correo string) {
+	f.usuarios = slices.DeleteFunc(f.usuarios, func(u *Usuario) bool { return u.Correo == correo })
+}
+
+// usuarioFalso crea un usuario activo con correo verificado.
+func usuarioFalso(correo, password string) *Usuario {
+	return &Usuario{
+		ID:               nuevoID(),
+		Correo:           correo,
+		Telefono:         "+525511111111",
+		Password:         password,
+		Estado:           estadoActiva,
+		FechaRegistro:    time.Now(),
+		CorreoVerificado: true,
+	}
+}
+
+func TestRegistroGuardaEnElRepositorio(t *testing.T) {
+	prepararHandlers(t)
+	repo := &repositorioFalso{}
+	usarRepositorio(t, repo)
+	enviados := mensajesEnviados(t)
+
+	w := atender(registroHandler, "/registro", `{"correo":" Ana@Ejemplo.com ","telefono":"55 1234 5678","password":"Secreta@123"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d, se esperaba %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	if len(repo.usuarios) != 1 {
+		t.Fatalf("se guardaron %d usuarios, se esperaba 1", len(repo.usuarios))
+	}
+	u := repo.usuarios[0]
+	if u.ID == "" || u.Correo != "ana@ejemplo.com" || u.Telefono != "+525512345678" || u.Admin || u.Estado != estadoActiva {
+		t.Errorf("usuario guardado %+v", u)
+	}
+	if !slices.Equal(*enviados, []string{"ana@ejemplo.com", "+525512345678", "ana@ejemplo.com"}) {
+		t.Errorf("mensajes enviados a %v", *enviados)
+	}
+}
+
+func TestRegistroDuplicadoAlInsertar(t *testing.T) {
+	prepararHandlers(t)
+	// El chequeo de duplicados ocurre al insertar: aunque el repositorio
+	// esté vacío, otra petición pudo registrar el teléfono antes.
+	usarRepositorio(t, &repositorioFalso{duplicados: []string{campoTelefono}})
+	enviados := mensajesEnviados(t)
+
+	w := atender(registroHandler, "/registro", `{"correo":"ana@ejemplo.com","telefono":"5512345678","password":"Secreta@123"}`)
+	comprobarError(t, w, http.StatusConflict, ErrorResponse{
+		Error:   "El teléfono ya se encuentra registrado",
+		Codigo:  "TELEFONO_DUPLICADO",
+		Errores: []ErrorCampo{{Campo: "telefono", Codigo: codigoDuplicado, Mensaje: "El teléfono ya se encuentra registrado"}},
+	})
+	if len(*enviados) > 0 {
+		t.Errorf("se enviaron mensajes a %v por un registro rechazado", *enviados)
+	}
+}
+
+func TestLoginSegunEstadoDelUsuario(t *testing.T) {
+	prepararHandlers(t)
+	suspendida := usuarioFalso("suspendida@ejemplo.com", "Secreta@123")
+	suspendida.Estado = estadoSuspendida
+	eliminada := usuarioFalso("eliminada@ejemplo.com", "Secreta@123")
+	eliminada.Estado = estadoEliminada
+	conDosFA := usuarioFalso("dosfa@ejemplo.com", "Secreta@123")
+	conDosFA.DosFAActivo = true
+	usarRepositorio(t, &repositorioFalso{usuarios: []*Usuario{suspendida, eliminada, conDosFA}})
+
+	casos := []struct {
+		nombre string
+		cuerpo string
+		status int
+		error  ErrorResponse
+	}{
+		{"cuenta suspendida", `{"correo":"suspendida@ejemplo.com","password":"Secreta@123"}`, http.StatusForbidden,
+			ErrorResponse{Error: "La cuenta está suspendida", Codigo: "CUENTA_SUSPENDIDA"}},
+		{"cuenta eliminada", `{"correo":"eliminada@ejemplo.com","password":"Secreta@123"}`, http.StatusForbidden,
+			ErrorResponse{Error: "La cuenta fue eliminada", Codigo: "CUENTA_ELIMINADA"}},
+		{"suspendida con contraseña incorrecta", `{"correo":"suspendida@ejemplo.com","password":"Otra@1234"}`, http.StatusUnauthorized,
+			ErrorResponse{Error: "Correo o contraseña incorrectos", Codigo: "CREDENCIALES_INVALIDAS"}},
+		{"segundo factor sin código", `{"correo":"dosfa@ejemplo.com","password":"Secreta@123"}`, http.StatusUnauthorized,
+			ErrorResponse{Error: "Se requiere el código de verificación", Codigo: "CODIGO_REQUERIDO"}},
+		{"segundo factor con código inválido", `{"correo":"dosfa@ejemplo.com","password":"Secreta@123","codigo":"000000"}`, http.StatusUnauthorized,
+			ErrorResponse{Error: "Código de verificación inválido", Codigo: "CODIGO_INVALIDO"}},
+		{"cuenta de ejemplo ausente del repositorio", `{"correo":"usuario@example.com","password":"Usuario1@"}`, http.StatusUnauthorized,
+			ErrorResponse{Error: "Correo o contraseña incorrectos", Codigo: "CREDENCIALES_INVALIDAS"}},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			comprobarError(t, atender(loginHandler, "/login", c.cuerpo), c.status, c.error)
+		})
+	}
+}
+
+func TestPerfilConRepositorioFalso(t *testing.T) {
+	prepararHandlers(t)
+	u := usuarioFalso("ana@ejemplo.com", "Secreta@123")
+	repo := &repositorioFalso{usuarios: []*Usuario{u}}
+	usarRepositorio(t, repo)
+	token, err := generarToken(u, []string{"pwd"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	perfil := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/perfil", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		autenticado(obtenerPerfilHandler)(w, r)
+		return w
+	}
+
+	w := perfil()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, se esperaba %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var resp PerfilResponse
+	decodificarRespuesta(t, w, &resp)
+	if esperado := (PerfilResponse{ID: u.ID, Correo: u.Correo, Telefono: u.Telefono, CorreoVerificado: true, Idioma: idiomaPorDefecto}); resp != esperado {
+		t.Errorf("perfil %+v, se esperaba %+v", resp, esperado)
+	}
+
+	repo.eliminar(u.Correo)
+	if w := perfil(); w.Code != http.StatusUnauthorized {
+		t.Errorf("con el usuario eliminado del repositorio: status %d, se esperaba %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAuditoriaPorDefecto es el número de eventos de auditoría que se
+// conservan en memoria si no se define AUDITORIA_MAX.
+const maxAuditoriaPorDefecto = 10000
+
+// EventoAuditoria registra una acción relevante para la seguridad: quién
+// la hizo (actor), sobre qué cuenta (objetivo, si es otra), desde dónde y
+// cuándo.
+type EventoAuditoria struct {
+	ID        string    `json:"id"`
+	Fecha     time.Time `json:"fecha"`
+	Tipo      string    `json:"tipo"`
+	Actor     string    `json:"actor"`
+	Objetivo  string    `json:"objetivo,omitempty"`
+	Detalle   string    `json:"detalle,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	RequestID string    `json:"request_id,omitempty"`
+	// secuencia numera los eventos en el orden en que se agregaron; es la
+	// posición de los cursores del listado.
+	secuencia uint64
+}
+
+// ListadoAuditoriaResponse define la respuesta paginada de
+// GET /admin/auditoria.
+type ListadoAuditoriaResponse struct {
+	Eventos []EventoAuditoria `json:"eventos"`
+	Total   int               `json:"total"`
+	// Page falta al paginar con cursor.
+	Page  int `json:"page,omitempty"`
+	Limit int `json:"limit"`
+}
+
+// registroAuditoria guarda los eventos más recientes en memoria y, si se
+// configuró, los agrega como líneas JSON a un archivo dedicado.
+type registroAuditoria struct {
+	mu      sync.Mutex
+	eventos []EventoAuditoria
+	max     int
+	// agregados cuenta los eventos agregados, para numerarlos.
+	agregados uint64
+	archivo   *os.File
+}
+
+// auditoria es el registro de auditoría del servicio; main lo reemplaza
+// al arrancar por el de nuevoRegistroAuditoria.
+var auditoria = &registroAuditoria{max: maxAuditoriaPorDefecto}
+
+// nuevoRegistroAuditoria crea el registro configurado con AUDITORIA_MAX
+// (eventos en memoria) y AUDITORIA_ARCHIVO (ruta del archivo JSON Lines
+// donde se conservan todos los eventos).
+func nuevoRegistroAuditoria() *registroAuditoria {
+	reg := &registroAuditoria{max: maxAuditoriaPorDefecto}
+	if n, err := strconv.Atoi(opcion("AUDITORIA_MAX")); err == nil && n > 0 {
+		reg.max = n
+	}
+	if ruta := opcion("AUDITORIA_ARCHIVO"); ruta != "" {
+		f, err := os.OpenFile(ruta, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			fatal("Error abriendo el archivo de auditoría", err)
+		}
+		reg.archivo = f
+	}
+	return reg
+}
+
+// agregar guarda el evento, descartando el más antiguo en memoria si se
+// alcanzó el máximo.
+func (a *registroAuditoria) agregar(e EventoAuditoria) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.agregados++
+	e.secuencia = a.agregados
+	a.eventos = append(a.eventos, e)
+	if len(a.eventos) > a.max {
+		a.eventos = a.eventos[len(a.eventos)-a.max:]
+	}
+	if a.archivo != nil {
+		if err := json.NewEncoder(a.archivo).Encode(e); err != nil {
+			slog.Error("Error escribiendo el archivo de auditoría", "error", err)
+		}
+	}
+}
+
+// consultar devuelve los eventos que cumplen el filtro, del más reciente
+// al más antiguo.
+func (a *registroAuditoria) consultar(filtro func(EventoAuditoria) bool) []EventoAuditoria {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	resultado := []EventoAuditoria{}
+	for i := len(a.eventos) - 1; i >= 0; i-- {
+		if filtro(a.eventos[i]) {
+			resultado = append(resultado, a.eventos[i])
+		}
+	}
+	return resultado
+}
+
+// auditar registra un evento de auditoría con los datos de origen de la
+// petición. objetivo se omite cuando coincide con el actor.
+func auditar(r *http.Request, tipo, actor, objetivo, detalle string) {
+	if objetivo == actor {
+		objetivo = ""
+	}
+	auditoria.agregar(EventoAuditoria{
+		ID:        nuevoID(),
+		Fecha:     time.Now().UTC(),
+		Tipo:      tipo,
+		Actor:     actor,
+		Objetivo:  objetivo,
+		Detalle:   detalle,
+		IP:        ipCliente(r),
+		UserAgent: r.UserAgent(),
+		RequestID: requestID(r),
+	})
+}
+
+// listarAuditoriaHandler devuelve los eventos de auditoría, del más
+// reciente al más antiguo, con paginación y filtros:
+// - cursor o page, y limit: paginación (ver leerPaginacion)
+// - tipo: tipo exacto de evento (login_fallido, password_cambiada, ...)
+// - correo: eventos cuyo actor u objetivo es el correo, sin distinguir
+// mayúsculas
+// - desde, hasta: rango de fechas en formato RFC 3339
+func listarAuditoriaHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p, ok := leerPaginacion(w, q)
+	if !ok {
+		return
+	}
+	var despues func(EventoAuditoria) bool
+	if p.cursor != nil {
+		ultimo, err := strconv.ParseUint(p.cursor.Clave, 10, 64)
+		if err != nil {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parámetro cursor inválido", Codigo: "PARAMETRO_INVALIDO"})
+			return
+		}
+		despues = func(e EventoAuditoria) bool { return e.secuencia < ultimo }
+	}
+
+	var desde, hasta time.Time
+	for _, p := range []struct {
+		nombre  string
+		destino *time.Time
+	}{{"desde", &desde}, {"hasta", &hasta}} {
+		if v := q.Get(p.nombre); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parámetro " + p.nombre + " inválido", Codigo: "PARAMETRO_INVALIDO"})
+				return
+			}
+			*p.destino = t
+		}
+	}
+	tipo := q.Get("tipo")
+	correo := q.Get("correo")
+
+	eventos := auditoria.consultar(func(e EventoAuditoria) bool {
+		if tipo != "" && e.Tipo != tipo {
+			return false
+		}
+		if correo != "" && !strings.EqualFold(e.Actor, correo) && !strings.EqualFold(e.Objetivo, correo) {
+			return false
+		}
+		if !desde.IsZero() && e.Fecha.Before(desde) {
+			return false
+		}
+		if !hasta.IsZero() && e.Fecha.After(hasta) {
+			return false
+		}
+		return true
+	})
+
+	pagina, cursor := paginar(eventos, p, despues, func(e EventoAuditoria) cursorListado {
+		return cursorListado{Clave: strconv.FormatUint(e.secuencia, 10), ID: e.ID}
+	})
+	siguienteCursor(w, cursor)
+	escribirJSON(w, http.StatusOK, ListadoAuditoriaResponse{
+		Eventos: pagina,
+		Total:   len(eventos),
+		Page:    p.page,
+		Limit:   p.limit,
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// claveContexto evita colisiones con otras llaves guardadas en el contexto.
+type claveContexto string
+
+// Llaves del contexto: el ID y el correo del usuario autenticado y los
+// claims completos de su token.
+const (
+	claveUsuario claveContexto = "usuario"
+	claveCorreo  claveContexto = "correo"
+	claveClaims  claveContexto = "claims"
+)
+
+// edadMaximaStepUp es el tiempo máximo desde la última autenticación
+// con el que se permite ejecutar una operación sensible.
+const edadMaximaStepUp = 5 * time.Minute
+
+// reloj da la hora actual. Las pruebas lo reemplazan para controlar el
+// paso del tiempo.
+type reloj interface {
+	ahora() time.Time
+}
+
+// relojSistema es el reloj del sistema.
+type relojSistema struct{}
+
+func (relojSistema) ahora() time.Time { return time.Now() }
+
+// relojTokens es el reloj con el que se emiten y validan los tokens: su
+// exp y su auth_time, y la antigüedad que exige sensible.
+var relojTokens reloj = relojSistema{}
+
+// validarToken verifica la firma y expiración de un token de acceso
+// emitido por el servicio y devuelve sus claims. Rechaza los tokens
+// pendientes del segundo factor de un login federado.
+func validarToken(tokenString string) (jwt.MapClaims, error) {
+	claims, err := parsearToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if _, pendiente := claims["pendiente"]; pendiente {
+		return nil, errors.New("el token está pendiente del segundo factor")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("el token no contiene el claim sub")
+	}
+	if correo, _ := claims["correo"].(string); correo == "" {
+		return nil, errors.New("el token no contiene el claim correo")
+	}
+	return claims, nil
+}
+
+// parsearToken verifica la firma y expiración de un JWT firmado por el
+// servicio y devuelve sus claims.
+func parsearToken(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return claves.verificacion(), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired(), jwt.WithTimeFunc(relojTokens.ahora))
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// requisitosCuenta son las condiciones de la cuenta que se exigen, además
+// de un token válido, para usar un endpoint.
+type requisitosCuenta uint8
+
+const (
+	// requiereDosFA rechaza a los usuarios sin segundo factor si la flag
+	// dosfa_obligatorio está activa.
+	requiereDosFA requisitosCuenta = 1 << iota
+	// requierePasswordVigente rechaza a los usuarios a los que un
+	// administrador les forzó el cambio de contraseña.
+	requierePasswordVigente
+
+	requisitosCompletos = requiereDosFA | requierePasswordVigente
+)
+
+// autenticado protege un handler exigiendo un header
+// "Authorization: Bearer <token>" válido de un usuario existente. Además
+// responde 403 a los usuarios que tienen pendiente un cambio de
+// contraseña forzado y, con la flag dosfa_obligatorio activa, a los que
+// no tienen el segundo factor activo.
+func autenticado(next http.HandlerFunc) http.HandlerFunc {
+	return autenticar(next, requisitosCompletos)
+}
+
+// autenticadoSinDosFA es autenticado sin exigir el segundo factor; lo usan
+// los endpoints con los que el usuario lo activa.
+func autenticadoSinDosFA(next http.HandlerFunc) http.HandlerFunc {
+	return autenticar(next, requierePasswordVigente)
+}
+
+// autenticadoCambioPassword es autenticado sin rechazar el cambio de
+// contraseña pendiente; lo usa el endpoint con el que se cumple.
+func autenticadoCambioPassword(next http.HandlerFunc) http.HandlerFunc {
+	return autenticar(next, requiereDosFA)
+}
+
+// autenticar valida el token de la petición y los requisitos de la
+// cuenta.
+func autenticar(next http.HandlerFunc, requisitos requisitosCuenta) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		ctx, errServicio := autenticarToken(r.Context(), tokenString, requisitos)
+		if errServicio != nil {
+			responderErrorServicio(w, errServicio)
+			return
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// usuarioAutenticado devuelve el usuario del request autenticado, o nil
+// si el handler no está protegido con autenticado.
+func usuarioAutenticado(r *http.Request) *Usuario {
+	id, _ := r.Context().Value(claveUsuario).(string)
+	if id == "" {
+		return nil
+	}
+	return buscarUsuarioPorID(id)
+}
+
+// correoAutenticado devuelve el correo con el que se autenticó el request.
+// A diferencia de usuarioAutenticado(r).Correo no lee el usuario, por lo
+// que se puede usar sin tomar su lock.
+func correoAutenticado(r *http.Request) string {
+	correo, _ := r.Context().Value(claveCorreo).(string)
+	return correo
+}
+
+// sensible protege operaciones de alta sensibilidad (cambio de correo,
+// borrado de cuenta, etc.): además de un token válido exige que el
+// usuario se haya autenticado hace menos de edadMaximaStepUp y, si tiene
+// el segundo factor activo, que el token lo acredite en su claim amr.
+// En caso contrario responde 401 con el reto de step-up de RFC 9470.
+func sensible(next http.HandlerFunc) http.HandlerFunc {
+	return autenticado(func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(claveClaims).(jwt.MapClaims)
+		usuario := usuarioAutenticado(r)
+		if usuario == nil {
+			// La cuenta se eliminó después de validar el token.
+			escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "No autenticado", Codigo: "NO_AUTENTICADO"})
+			return
+		}
+
+		desbloquear := usuario.bloquear()
+		dosFAActivo := usuario.DosFAActivo
+		desbloquear()
+
+		authTime, _ := claims["auth_time"].(float64)
+		reciente := relojTokens.ahora().Sub(time.Unix(int64(authTime), 0)) <= edadMaximaStepUp
+		if !reciente || (dosFAActivo && !tieneMetodo(claims, "otp")) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer error="insufficient_user_authentication", max_age=%d`,
+				int(edadMaximaStepUp.Seconds())))
+			escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Se requiere volver a autenticarse", Codigo: "REAUTENTICACION_REQUERIDA"})
+			return
+		}
+		next(w, r)
+	})
+}
+
+// tieneMetodo indica si el claim amr del token incluye el método dado.
+func tieneMetodo(claims jwt.MapClaims, metodo string) bool {
+	amr, _ := claims["amr"].([]interface{})
+	return slices.Contains(amr, interface{}(metodo))
+}
+
+// versionVigente indica si el token fue emitido con la versión de token
+// actual del usuario, es decir, si no ha sido revocado.
+func versionVigente(claims jwt.MapClaims, usuario *Usuario) bool {
+	ver, ok := claims["ver"].(float64)
+	return ok && int(ver) == usuario.VersionToken
+}
+
+// revocarTokens invalida todos los tokens emitidos hasta ahora al usuario,
+// lo deja en la auditoría con el motivo y cierra sus conexiones en /ws.
+// El actor es el usuario autenticado de la petición o, si no lo hay, el
+// propio usuario. Se llama con el lock del usuario tomado.
+func revocarTokens(r *http.Request, usuario *Usuario, motivo string) {
+	usuario.VersionToken++
+	eventosSesion.publicar(usuario.ID, EventoSesion{Tipo: eventoSesionRevocada, Fecha: time.Now(), Motivo: motivo})
+	actor := correoAutenticado(r)
+	if actor == "" {
+		actor = usuario.Correo
+	}
+	auditar(r, "tokens_revocados", actor, usuario.Correo, motivo)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"pruebasgo/testutil"
+)
+
+// relojFalso es un reloj que sólo avanza cuando la prueba lo indica.
+type relojFalso struct {
+	hora time.Time
+}
+
+func (r *relojFalso) ahora() time.Time { return r.hora }
+
+func (r *relojFalso) avanzar(d time.Duration) { r.hora = r.hora.Add(d) }
+
+// usarReloj reemplaza el reloj de los tokens durante la prueba por uno
+// detenido en hora.
+func usarReloj(t *testing.T, hora time.Time) *relojFalso {
+	t.Helper()
+	antes := relojTokens
+	r := &relojFalso{hora: hora}
+	relojTokens = r
+	t.Cleanup(func() { relojTokens = antes })
+	return r
+}
+
+// firmar firma claims con la clave dada y el método HS256.
+func firmar(t *testing.T, claims jwt.MapClaims, clave []byte) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(clave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// claimsVigentes son los claims de un token recién emitido para u.
+func claimsVigentes(u *Usuario) jwt.MapClaims {
+	ahora := relojTokens.ahora()
+	return jwt.MapClaims{
+		"sub":       u.ID,
+		"correo":    u.Correo,
+		"ver":       u.VersionToken,
+		"exp":       ahora.Add(time.Hour).Unix(),
+		"auth_time": ahora.Unix(),
+		"amr":       []string{"pwd"},
+	}
+}
+
+func TestTokenExpira(t *testing.T) {
+	prepararHandlers(t)
+	r := usarReloj(t, time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	token, err := generarToken(usuarioFalso("ana@ejemplo.com", "Secreta@123"), []string{"pwd"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := validarToken(token)
+	if err != nil {
+		t.Fatalf("token recién emitido: %v", err)
+	}
+	if exp, _ := claims.GetExpirationTime(); !exp.Equal(r.hora.Add(config.TokenTTL)) {
+		t.Errorf("exp %v, se esperaba %v", exp, r.hora.Add(config.TokenTTL))
+	}
+	if authTime, _ := claims["auth_time"].(float64); int64(authTime) != r.hora.Unix() {
+		t.Errorf("auth_time %v, se esperaba %d", claims["auth_time"], r.hora.Unix())
+	}
+
+	r.avanzar(config.TokenTTL - time.Second)
+	if _, err := validarToken(token); err != nil {
+		t.Errorf("un segundo antes de expirar: %v", err)
+	}
+	r.avanzar(2 * time.Second)
+	if _, err := validarToken(token); !errors.Is(err, jwt.ErrTokenExpired) {
+		t.Errorf("un segundo después de expirar: error %v, se esperaba %v", err, jwt.ErrTokenExpired)
+	}
+}
+
+func TestTokenFirmaInvalida(t *testing.T) {
+	prepararHandlers(t)
+	u := usuarioFalso("ana@ejemplo.com", "Secreta@123")
+	valido := firmar(t, claimsVigentes(u), claves.firma())
+
+	otroAlgoritmo, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claimsVigentes(u)).SignedString(claves.firma())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sinFirma, err := jwt.NewWithClaims(jwt.SigningMethodNone, claimsVigentes(u)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cambia el payload conservando la firma del original.
+	alterado := firmar(t, jwt.MapClaims{"correo": "admin@example.com", "ver": 0, "exp": relojTokens.ahora().Add(time.Hour).Unix()}, claves.firma())
+	alterado = alterado[:len(alterado)-len(firmaDe(valido))] + firmaDe(valido)
+
+	casos := []struct {
+		nombre, token string
+		error         error
+	}{
+		{"otra clave", firmar(t, claimsVigentes(u), claveEfimera()), jwt.ErrTokenSignatureInvalid},
+		{"payload alterado", alterado, jwt.ErrTokenSignatureInvalid},
+		{"algoritmo HS512", otroAlgoritmo, jwt.ErrTokenSignatureInvalid},
+		{"algoritmo none", sinFirma, jwt.ErrTokenSignatureInvalid},
+		{"mal formado", "no.es.un-jwt", jwt.ErrTokenMalformed},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			if _, err := validarToken(c.token); !errors.Is(err, c.error) {
+				t.Errorf("error %v, se esperaba %v", err, c.error)
+			}
+		})
+	}
+}
+
+// firmaDe devuelve el tercer segmento de un JWT.
+func firmaDe(token string) string {
+	return token[strings.LastIndex(token, ".")+1:]
+}
+
+func TestTokenClaimsFaltantes(t *testing.T) {
+	prepararHandlers(t)
+	u := usuarioFalso("ana@ejemplo.com", "Secreta@123")
+	usarRepositorio(t, &repositorioFalso{usuarios: []*Usuario{u}})
+	sin := func(nombre string) jwt.MapClaims {
+		claims := claimsVigentes(u)
+		delete(claims, nombre)
+		return claims
+	}
+	correoNumerico := claimsVigentes(u)
+	correoNumerico["correo"] = 42
+
+	casos := []struct {
+		nombre string
+		claims jwt.MapClaims
+	}{
+		{"sin exp", sin("exp")},
+		{"sin sub", sin("sub")},
+		{"sin correo", sin("correo")},
+		{"correo que no es texto", correoNumerico},
+		{"sin ver", sin("ver")},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			_, errServicio := autenticarToken(context.Background(), firmar(t, c.claims, claves.firma()), 0)
+			if errServicio == nil || errServicio.status != http.StatusUnauthorized {
+				t.Errorf("error %+v, se esperaba un 401", errServicio)
+			}
+		})
+	}
+	if _, errServicio := autenticarToken(context.Background(), firmar(t, claimsVigentes(u), claves.firma()), 0); errServicio != nil {
+		t.Errorf("con todos los claims: %+v", errServicio)
+	}
+}
+
+func TestTokenRevocado(t *testing.T) {
+	prepararHandlers(t)
+	u := usuarioFalso("ana@ejemplo.com", "Secreta@123")
+	usarRepositorio(t, &repositorioFalso{usuarios: []*Usuario{u}})
+	anterior, err := generarToken(u, []string{"pwd"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revocarTokens(httptest.NewRequest(http.MethodPost, "/password/cambiar", nil), u, "prueba")
+	if _, errServicio := autenticarToken(context.Background(), anterior, 0); errServicio == nil || errServicio.status != http.StatusUnauthorized {
+		t.Errorf("token revocado: error %+v, se esperaba un 401", errServicio)
+	}
+	// La firma y la expiración siguen siendo válidas: lo que lo invalida
+	// es la versión.
+	if _, err := validarToken(anterior); err != nil {
+		t.Errorf("validarToken del token revocado: %v", err)
+	}
+
+	nuevo, err := generarToken(u, []string{"pwd"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, errServicio := autenticarToken(context.Background(), nuevo, 0); errServicio != nil {
+		t.Errorf("token emitido después de revocar: %+v", errServicio)
+	}
+}
+
+func TestOperacionSensibleSegunAntiguedad(t *testing.T) {
+	prepararHandlers(t)
+	// auth_time tiene resolución de segundos.
+	r := usarReloj(t, time.Now().Truncate(time.Second))
+	u := usuarioFalso("ana@ejemplo.com", "Secreta@123")
+	usarRepositorio(t, &repositorioFalso{usuarios: []*Usuario{u}})
+	token, err := generarToken(u, []string{"pwd"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	operacion := sensible(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	atenderSensible := func() int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/cuenta", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		operacion(w, req)
+		return w.Code
+	}
+
+	r.avanzar(edadMaximaStepUp)
+	if status := atenderSensible(); status != http.StatusNoContent {
+		t.Errorf("autenticado hace %v: status %d, se esperaba %d", edadMaximaStepUp, status, http.StatusNoContent)
+	}
+	r.avanzar(time.Second)
+	if status := atenderSensible(); status != http.StatusUnauthorized {
+		t.Errorf("autenticado hace más de %v: status %d, se esperaba %d", edadMaximaStepUp, status, http.StatusUnauthorized)
+	}
+}
+
+// repositorioEliminaAlAutenticar simula que la cuenta se elimina justo
+// después de validar el token: sólo la primera búsqueda por ID la
+// encuentra.
+type repositorioEliminaAlAutenticar struct {
+	*repositorioFalso
+	busquedas int
+}
+
+func (f *repositorioEliminaAlAutenticar) porID(id string) *Usuario {
+	f.busquedas++
+	if f.busquedas > 1 {
+		return nil
+	}
+	return f.repositorioFalso.porID(id)
+}
+
+func TestCuentaEliminadaTrasAutenticar(t *testing.T) {
+	prepararHandlers(t)
+	u := usuarioFalso("ana@ejemplo.com", "Secreta@123")
+	u.Admin = true
+	token, err := generarToken(u, []string{"pwd"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	siguiente := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+
+	for nombre, handler := range map[string]http.HandlerFunc{
+		"sensible":      sensible(siguiente),
+		"administrador": administrador(siguiente),
+	} {
+		usarRepositorio(t, &repositorioEliminaAlAutenticar{repositorioFalso: &repositorioFalso{usuarios: []*Usuario{u}}})
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/cuenta", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		handler(w, r)
+		t.Run(nombre, func(t *testing.T) {
+			comprobarError(t, w, http.StatusUnauthorized, ErrorResponse{Error: "No autenticado", Codigo: "NO_AUTENTICADO"})
+		})
+	}
+}
+
+func TestTokenDeCuentaEliminadaNoSirveConLaNueva(t *testing.T) {
+	handler := routerConcurrente(t)
+	usarRepositorio(t, nuevoRepositorioMemoria())
+	api := testutil.Handler(handler)
+	u, anterior := api.UsuarioConToken(t)
+
+	cuerpo := fmt.Sprintf(`{"password":%q}`, u.Password)
+	if w := enviar(handler, http.MethodDelete, "/cuenta", anterior, cuerpo); w.Code != http.StatusNoContent {
+		t.Fatalf("eliminar la cuenta: status %d: %s", w.Code, w.Body)
+	}
+	// La cuenta nueva con el mismo correo empieza otra vez en la versión
+	// 0, igual que la que tenía el token.
+	api.Registrar(t, u)
+
+	if w := enviar(handler, http.MethodGet, "/perfil", anterior, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("token de la cuenta eliminada: status %d, se esperaba %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := enviar(handler, http.MethodGet, "/perfil", api.Token(t, u), ""); w.Code != http.StatusOK {
+		t.Errorf("token de la cuenta nueva: status %d, se esperaba %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestTokenConCorreoAnteriorNoSirveConLaNuevaCuenta(t *testing.T) {
+	handler := routerConcurrente(t)
+	usarRepositorio(t, nuevoRepositorioMemoria())
+	api := testutil.Handler(handler)
+	u, anterior := api.UsuarioConToken(t)
+
+	correoNuevo, _ := cuentaNueva()
+	cuerpo := fmt.Sprintf(`{"correo_nuevo":%q}`, correoNuevo)
+	if w := enviar(handler, http.MethodPost, "/correo/cambiar", anterior, cuerpo); w.Code != http.StatusAccepted {
+		t.Fatalf("solicitar el cambio de correo: status %d: %s", w.Code, w.Body)
+	}
+	// El enlace sólo llega por correo: se fija uno conocido.
+	usuario := buscarUsuario(u.Correo)
+	desbloquear := usuario.bloquear()
+	usuario.TokenCambioCorreo = hashToken("confirmacion")
+	desbloquear()
+	if w := enviar(handler, http.MethodGet, "/correo/confirmar?token=confirmacion", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("confirmar el cambio de correo: status %d: %s", w.Code, w.Body)
+	}
+
+	otro := testutil.NuevoUsuario()
+	otro.Correo = u.Correo
+	api.Registrar(t, otro)
+
+	w := enviar(handler, http.MethodGet, "/perfil", anterior, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("token con el correo anterior: status %d, se esperaba %d: %s", w.Code, http.StatusUnauthorized, w.Body)
+	}
+}
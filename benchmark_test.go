@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Los benchmarks llaman a los handlers directamente, sin red ni
+// middlewares, para medir la validación, el store y la respuesta:
+//
+//	go test -run '^$' -bench . -benchmem
+//
+// La latencia de punta a punta se mide con la prueba de carga de
+// carga/k6.js.
+
+var prepararBenchmarks sync.Once
+
+// prepararHandlers deja el servicio como lo deja comandoServe con la
+// configuración por defecto: sin logs, con una clave JWT efímera y con
+// las cuentas de ejemplo.
+func prepararHandlers(tb testing.TB) {
+	tb.Helper()
+	prepararBenchmarks.Do(func() {
+		slog.SetDefault(slog.New(slog.DiscardHandler))
+		claves.rotar(claveEfimera())
+		cargarDatosSeed()
+	})
+}
+
+// registrosBenchmark numera las cuentas de BenchmarkRegistro, que se
+// ejecuta varias veces con distinto b.N.
+var registrosBenchmark atomic.Int64
+
+// ejecutarHandler atiende una petición con cuerpo JSON y verifica el
+// status.
+func ejecutarHandler(b *testing.B, handler http.HandlerFunc, ruta, cuerpo string, status int) {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, ruta, strings.NewReader(cuerpo)))
+	if w.Code != status {
+		b.Fatalf("POST %s: status %d, se esperaba %d: %s", ruta, w.Code, status, w.Body)
+	}
+}
+
+func BenchmarkRegistro(b *testing.B) {
+	prepararHandlers(b)
+	b.Run("exitoso", func(b *testing.B) {
+		for b.Loop() {
+			n := registrosBenchmark.Add(1)
+			cuerpo := fmt.Sprintf(`{"correo":"carga%d@ejemplo.com","telefono":"56%08d","password":"Secreta@123"}`, n, n)
+			ejecutarHandler(b, registroHandler, "/registro", cuerpo, http.StatusCreated)
+		}
+	})
+	b.Run("duplicado", func(b *testing.B) {
+		cuerpo := `{"correo":"usuario@example.com","telefono":"+525500000002","password":"Secreta@123"}`
+		for b.Loop() {
+			ejecutarHandler(b, registroHandler, "/registro", cuerpo, http.StatusConflict)
+		}
+	})
+	b.Run("inválido", func(b *testing.B) {
+		cuerpo := `{"correo":"no-es-correo","telefono":"123","password":"simple"}`
+		for b.Loop() {
+			ejecutarHandler(b, registroHandler, "/registro", cuerpo, http.StatusBadRequest)
+		}
+	})
+}
+
+func BenchmarkLogin(b *testing.B) {
+	prepararHandlers(b)
+	b.Run("exitoso", func(b *testing.B) {
+		cuerpo := `{"correo":"usuario@example.com","password":"Usuario1@"}`
+		for b.Loop() {
+			ejecutarHandler(b, loginHandler, "/login", cuerpo, http.StatusOK)
+		}
+	})
+	b.Run("credenciales incorrectas", func(b *testing.B) {
+		cuerpo := `{"correo":"nadie@ejemplo.com","password":"Secreta@123"}`
+		for b.Loop() {
+			ejecutarHandler(b, loginHandler, "/login", cuerpo, http.StatusUnauthorized)
+		}
+	})
+}
+
+// BenchmarkBuscarUsuario mide las búsquedas por correo y por ID que hacen
+// el login y la autenticación de cada petición, desde varias goroutines a
+// la vez, para ver la contención de los locks del store.
+func BenchmarkBuscarUsuario(b *testing.B) {
+	prepararHandlers(b)
+	correos := []string{"admin@example.com", "usuario@example.com"}
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			u := buscarUsuario(correos[i%len(correos)])
+			if buscarUsuarioPorID(u.ID) != u {
+				b.Fatal("el índice por ID no coincide con el de correos")
+			}
+		}
+	})
+}
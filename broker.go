@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+// eventoPasswordCambiada es el evento de dominio del cambio de
+// contraseña; los de registro y login son los mismos de los webhooks.
+const eventoPasswordCambiada = "usuario.password_cambiada"
+
+// ConfigBroker define el broker al que se publican los eventos de
+// dominio.
+type ConfigBroker struct {
+	Tipo    string
+	URLs    []string
+	Tema    string
+	Formato string
+}
+
+// cargarConfigBroker lee BROKER (kafka, nats o vacío para no publicar),
+// BROKER_URLS (brokers de Kafka host:puerto o servidores de NATS,
+// separados por coma), BROKER_TEMA (topic de Kafka o prefijo del subject
+// de NATS, por defecto "usuarios.eventos") y BROKER_FORMATO (json o avro,
+// por defecto json).
+func cargarConfigBroker() (ConfigBroker, error) {
+	cfg := ConfigBroker{
+		Tipo:    strings.ToLower(strings.TrimSpace(opcion("BROKER"))),
+		Tema:    "usuarios.eventos",
+		Formato: "json",
+	}
+	for _, u := range strings.Split(opcion("BROKER_URLS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			cfg.URLs = append(cfg.URLs, u)
+		}
+	}
+	if v := strings.TrimSpace(opcion("BROKER_TEMA")); v != "" {
+		cfg.Tema = v
+	}
+	if v := strings.ToLower(strings.TrimSpace(opcion("BROKER_FORMATO"))); v != "" {
+		cfg.Formato = v
+	}
+
+	switch cfg.Tipo {
+	case "":
+		return cfg, nil
+	case "kafka", "nats":
+	default:
+		return cfg, fmt.Errorf("BROKER=%q: debe ser kafka o nats", cfg.Tipo)
+	}
+	if len(cfg.URLs) == 0 {
+		return cfg, fmt.Errorf("BROKER=%s requiere BROKER_URLS", cfg.Tipo)
+	}
+	if cfg.Formato != "json" && cfg.Formato != "avro" {
+		return cfg, fmt.Errorf("BROKER_FORMATO=%q: debe ser json o avro", cfg.Formato)
+	}
+	return cfg, nil
+}
+
+// EventoDominio es el mensaje que se publica en el broker. La clave del
+// mensaje es el correo, de modo que los eventos de un mismo usuario
+// llegan en orden a un mismo consumidor.
+type EventoDominio struct {
+	ID        string    `json:"id" avro:"id"`
+	Tipo      string    `json:"tipo" avro:"tipo"`
+	Fecha     time.Time `json:"fecha" avro:"fecha"`
+	UsuarioID string    `json:"usuario_id" avro:"usuario_id"`
+	Correo    string    `json:"correo" avro:"correo"`
+	RequestID string    `json:"request_id,omitempty" avro:"request_id"`
+}
+
+// esquemaAvroEvento es el esquema Avro de EventoDominio.
+const esquemaAvroEvento = `{
+  "type": "record",
+  "name": "EventoDominio",
+  "namespace": "stratplus.usuarios",
+  "fields": [
+    {"name": "id", "type": "string"},
+    {"name": "tipo", "type": "string"},
+    {"name": "fecha", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "usuario_id", "type": "string"},
+    {"name": "correo", "type": "string"},
+    {"name": "request_id", "type": "string", "default": ""}
+  ]
+}`
+
+// mensajeBroker es un evento ya serializado, listo para publicarse.
+type mensajeBroker struct {
+	evento        EventoDominio
+	clave         string
+	tipoContenido string
+	datos         []byte
+}
+
+// publicadorBroker envía un mensaje al broker sin esperar la
+// confirmación; los errores de entrega se registran en el log.
+type publicadorBroker interface {
+	publicar(ctx context.Context, m mensajeBroker) error
+	cerrar() error
+}
+
+// brokerEventos serializa los eventos de dominio y los entrega al
+// publicador configurado.
+type brokerEventos struct {
+	cfg        ConfigBroker
+	esquema    avro.Schema
+	publicador publicadorBroker
+}
+
+// eventosDominio es el broker del servicio; main lo reemplaza al arrancar
+// por uno con la configuración de cargarConfigBroker. Sin broker no se
+// publica nada.
+var eventosDominio = &brokerEventos{}
+
+// nuevoBrokerEventos crea el publicador del broker configurado. La
+// conexión se establece en segundo plano, así que un broker caído no
+// impide arrancar.
+func nuevoBrokerEventos(cfg ConfigBroker) (*brokerEventos, error) {
+	b := &brokerEventos{cfg: cfg}
+	if cfg.Formato == "avro" {
+		esquema, err := avro.Parse(esquemaAvroEvento)
+		if err != nil {
+			return nil, fmt.Errorf("esquema Avro: %w", err)
+		}
+		b.esquema = esquema
+	}
+	switch cfg.Tipo {
+	case "kafka":
+		b.publicador = nuevoPublicadorKafka(cfg)
+	case "nats":
+		p, err := nuevoPublicadorNATS(cfg)
+		if err != nil {
+			return nil, err
+		}
+		b.publicador = p
+	}
+	return b, nil
+}
+
+// publicar emite el evento del usuario si hay un broker configurado.
+func (b *brokerEventos) publicar(r *http.Request, tipo string, usuario *Usuario) {
+	if b.publicador == nil {
+		return
+	}
+	e := EventoDominio{
+		ID:        nuevoID(),
+		Tipo:      tipo,
+		Fecha:     time.Now().UTC(),
+		UsuarioID: usuario.ID,
+		Correo:    usuario.Correo,
+		RequestID: requestID(r),
+	}
+	m := mensajeBroker{evento: e, clave: usuario.Correo, tipoContenido: "application/json"}
+	var err error
+	if b.esquema != nil {
+		m.tipoContenido = "avro/binary"
+		m.datos, err = avro.Marshal(b.esquema, e)
+	} else {
+		m.datos, err = json.Marshal(e)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error serializando el evento de dominio", "tipo", tipo, "error", err)
+		metricaBroker.WithLabelValues(tipo, "fallido").Inc()
+		return
+	}
+	if err := b.publicador.publicar(r.Context(), m); err != nil {
+		slog.ErrorContext(r.Context(), "Error publicando el evento de dominio", "tipo", tipo, "broker", b.cfg.Tipo, "error", err)
+		metricaBroker.WithLabelValues(tipo, "fallido").Inc()
+	}
+}
+
+// cerrar envía los mensajes pendientes y cierra la conexión.
+func (b *brokerEventos) cerrar() {
+	if b.publicador == nil {
+		return
+	}
+	if err := b.publicador.cerrar(); err != nil {
+		slog.Error("Error cerrando la conexión con el broker", "broker", b.cfg.Tipo, "error", err)
+	}
+}
+
+// publicadorKafka publica en un topic de Kafka. Los mensajes se
+// particionan por su clave y se envían en lotes asíncronos.
+type publicadorKafka struct {
+	writer *kafka.Writer
+}
+
+func nuevoPublicadorKafka(cfg ConfigBroker) *publicadorKafka {
+	return &publicadorKafka{writer: &kafka.Writer{
+		Addr:                   kafka.TCP(cfg.URLs...),
+		Topic:                  cfg.Tema,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		Async:                  true,
+		BatchTimeout:           100 * time.Millisecond,
+		AllowAutoTopicCreation: true,
+		Completion: func(mensajes []kafka.Message, err error) {
+			resultado := "publicado"
+			if err != nil {
+				resultado = "fallido"
+				slog.Error("Error entregando eventos a Kafka", "eventos", len(mensajes), "error", err)
+			}
+			for _, m := range mensajes {
+				for _, h := range m.Headers {
+					if h.Key == "tipo" {
+						metricaBroker.WithLabelValues(string(h.Value), resultado).Inc()
+					}
+				}
+			}
+		},
+	}}
+}
+
+func (p *publicadorKafka) publicar(ctx context.Context, m mensajeBroker) error {
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(m.clave),
+		Value: m.datos,
+		Headers: []kafka.Header{
+			{Key: "tipo", Value: []byte(m.evento.Tipo)},
+			{Key: "id", Value: []byte(m.evento.ID)},
+			{Key: "content-type", Value: []byte(m.tipoContenido)},
+		},
+	})
+}
+
+func (p *publicadorKafka) cerrar() error {
+	return p.writer.Close()
+}
+
+// publicadorNATS publica en el subject "<BROKER_TEMA>.<tipo>"; como NATS
+// no tiene clave de mensaje, va en el header Clave.
+type publicadorNATS struct {
+	conn *nats.Conn
+	tema string
+}
+
+func nuevoPublicadorNATS(cfg ConfigBroker) (*publicadorNATS, error) {
+	conn, err := nats.Connect(strings.Join(cfg.URLs, ","),
+		nats.Name("stratplus"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				slog.Warn("Conexión con NATS perdida", "error", err)
+			}
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			slog.Info("Conexión con NATS restablecida", "servidor", c.ConnectedUrl())
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("conectando con NATS: %w", err)
+	}
+	return &publicadorNATS{conn: conn, tema: cfg.Tema}, nil
+}
+
+func (p *publicadorNATS) publicar(_ context.Context, m mensajeBroker) error {
+	msg := nats.NewMsg(p.tema + "." + m.evento.Tipo)
+	msg.Data = m.datos
+	msg.Header.Set(nats.MsgIdHdr, m.evento.ID)
+	msg.Header.Set("Clave", m.clave)
+	msg.Header.Set("Content-Type", m.tipoContenido)
+	if err := p.conn.PublishMsg(msg); err != nil {
+		return err
+	}
+	metricaBroker.WithLabelValues(m.evento.Tipo, "publicado").Inc()
+	return nil
+}
+
+// cerrar espera, como mucho 5 segundos, a que el servidor reciba los
+// mensajes pendientes.
+func (p *publicadorNATS) cerrar() error {
+	defer p.conn.Close()
+	return p.conn.FlushTimeout(5 * time.Second)
+}
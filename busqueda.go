@@ -0,0 +1,208 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// entradaIndice relaciona una clave buscable (correo o teléfono en
+// minúsculas) con el correo del usuario al que pertenece.
+type entradaIndice struct {
+	clave  string
+	correo string
+}
+
+// indiceBusqueda permite buscar usuarios por correo o teléfono parcial
+// sin recorrer toda la base: las claves se mantienen ordenadas para
+// búsquedas por prefijo con búsqueda binaria, y un índice de trigramas
+// reduce los candidatos en búsquedas por subcadena.
+type indiceBusqueda struct {
+	entradas  []entradaIndice
+	trigramas map[string]map[entradaIndice]struct{}
+}
+
+// nuevoIndiceBusqueda crea un índice vacío.
+func nuevoIndiceBusqueda() *indiceBusqueda {
+	return &indiceBusqueda{trigramas: map[string]map[entradaIndice]struct{}{}}
+}
+
+// indexar agrega el correo y teléfono del usuario al índice. Se llama al
+// crearlo y después de cambiar su correo o teléfono.
+func (ix *indiceBusqueda) indexar(u *Usuario) {
+	ix.agregar(u.Correo, u.Correo)
+	if u.Telefono != "" {
+		ix.agregar(u.Telefono, u.Correo)
+	}
+}
+
+// desindexar quita el correo y teléfono del usuario del índice. Se llama
+// antes de cambiar su correo o teléfono y al eliminarlo.
+func (ix *indiceBusqueda) desindexar(u *Usuario) {
+	ix.quitar(u.Correo, u.Correo)
+	if u.Telefono != "" {
+		ix.quitar(u.Telefono, u.Correo)
+	}
+}
+
+// posicion devuelve dónde está (o debería insertarse) la entrada.
+func (ix *indiceBusqueda) posicion(e entradaIndice) int {
+	return sort.Search(len(ix.entradas), func(i int) bool {
+		a := ix.entradas[i]
+		return a.clave > e.clave || (a.clave == e.clave && a.correo >= e.correo)
+	})
+}
+
+// agregar inserta la clave manteniendo el orden de las entradas.
+func (ix *indiceBusqueda) agregar(clave, correo string) {
+	e := entradaIndice{clave: strings.ToLower(clave), correo: correo}
+	i := ix.posicion(e)
+	if i < len(ix.entradas) && ix.entradas[i] == e {
+		return
+	}
+	ix.entradas = append(ix.entradas, entradaIndice{})
+	copy(ix.entradas[i+1:], ix.entradas[i:])
+	ix.entradas[i] = e
+
+	for _, t := range trigramasDe(e.clave) {
+		if ix.trigramas[t] == nil {
+			ix.trigramas[t] = map[entradaIndice]struct{}{}
+		}
+		ix.trigramas[t][e] = struct{}{}
+	}
+}
+
+// quitar elimina la clave del índice.
+func (ix *indiceBusqueda) quitar(clave, correo string) {
+	e := entradaIndice{clave: strings.ToLower(clave), correo: correo}
+	i := ix.posicion(e)
+	if i == len(ix.entradas) || ix.entradas[i] != e {
+		return
+	}
+	ix.entradas = append(ix.entradas[:i], ix.entradas[i+1:]...)
+
+	for _, t := range trigramasDe(e.clave) {
+		delete(ix.trigramas[t], e)
+		if len(ix.trigramas[t]) == 0 {
+			delete(ix.trigramas, t)
+		}
+	}
+}
+
+// buscarPrefijo devuelve los correos cuyas claves empiezan con q.
+func (ix *indiceBusqueda) buscarPrefijo(q string, limite int) []string {
+	q = strings.ToLower(q)
+	i := ix.posicion(entradaIndice{clave: q})
+	var encontradas []entradaIndice
+	for ; i < len(ix.entradas) && strings.HasPrefix(ix.entradas[i].clave, q); i++ {
+		encontradas = append(encontradas, ix.entradas[i])
+	}
+	return correosUnicos(encontradas, limite)
+}
+
+// buscarSubcadena devuelve los correos con alguna clave que contiene q.
+// Con tres o más caracteres intersecta los trigramas de q; con menos
+// recorre las claves.
+func (ix *indiceBusqueda) buscarSubcadena(q string, limite int) []string {
+	q = strings.ToLower(q)
+	ts := trigramasDe(q)
+	if len(ts) == 0 {
+		var encontradas []entradaIndice
+		for _, e := range ix.entradas {
+			if strings.Contains(e.clave, q) {
+				encontradas = append(encontradas, e)
+			}
+		}
+		return correosUnicos(encontradas, limite)
+	}
+
+	// Se parte del trigrama menos frecuente para acotar los candidatos.
+	menor := ts[0]
+	for _, t := range ts[1:] {
+		if len(ix.trigramas[t]) < len(ix.trigramas[menor]) {
+			menor = t
+		}
+	}
+	var encontradas []entradaIndice
+	for e := range ix.trigramas[menor] {
+		if strings.Contains(e.clave, q) {
+			encontradas = append(encontradas, e)
+		}
+	}
+	sort.Slice(encontradas, func(i, j int) bool {
+		a, b := encontradas[i], encontradas[j]
+		return a.clave < b.clave || (a.clave == b.clave && a.correo < b.correo)
+	})
+	return correosUnicos(encontradas, limite)
+}
+
+// correosUnicos devuelve hasta limite correos distintos de las entradas,
+// respetando su orden.
+func correosUnicos(entradas []entradaIndice, limite int) []string {
+	vistos := map[string]bool{}
+	resultado := []string{}
+	for _, e := range entradas {
+		if len(resultado) >= limite {
+			break
+		}
+		if !vistos[e.correo] {
+			vistos[e.correo] = true
+			resultado = append(resultado, e.correo)
+		}
+	}
+	return resultado
+}
+
+// trigramasDe devuelve los trigramas (por bytes) de s.
+func trigramasDe(s string) []string {
+	var ts []string
+	for i := 0; i+3 <= len(s); i++ {
+		ts = append(ts, s[i:i+3])
+	}
+	return ts
+}
+
+// buscarUsuariosHandler busca usuarios por correo o teléfono parcial:
+// - q: texto a buscar (requerido)
+// - modo: prefijo (por defecto) o contiene
+// - limit: máximo de resultados (por defecto 20, máximo 100)
+func buscarUsuariosHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	texto := strings.TrimSpace(q.Get("q"))
+	if texto == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el parámetro q", Codigo: "PARAMETRO_REQUERIDO"})
+		return
+	}
+
+	limit := limitePorDefecto
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > limiteMaximo {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parámetro limit inválido", Codigo: "PARAMETRO_INVALIDO"})
+			return
+		}
+		limit = n
+	}
+
+	var subcadena bool
+	switch q.Get("modo") {
+	case "", "prefijo":
+	case "contiene":
+		subcadena = true
+	default:
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parámetro modo inválido", Codigo: "PARAMETRO_INVALIDO"})
+		return
+	}
+	correos := repositorio.buscar(texto, limit, subcadena)
+
+	resultado := []UsuarioAdminResponse{}
+	for _, c := range correos {
+		if u := buscarUsuario(c); u != nil {
+			desbloquear := u.bloquear()
+			resultado = append(resultado, nuevoUsuarioAdminResponse(u))
+			desbloquear()
+		}
+	}
+	escribirJSON(w, http.StatusOK, resultado)
+}
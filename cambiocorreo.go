@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"pruebasgo/validacion"
+)
+
+// vigenciaCambioCorreo es el tiempo durante el cual es válido el enlace
+// de confirmación enviado a la nueva dirección.
+const vigenciaCambioCorreo = 24 * time.Hour
+
+// CambiarCorreoRequest define la estructura esperada para la petición
+// del endpoint /correo/cambiar.
+type CambiarCorreoRequest struct {
+	CorreoNuevo string `json:"correo_nuevo"`
+}
+
+// solicitarCambioCorreoHandler inicia el cambio de correo del usuario
+// autenticado enviando un enlace de confirmación a la nueva dirección.
+// El correo no cambia hasta que se confirma el enlace.
+func solicitarCambioCorreoHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	var req CambiarCorreoRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+	req.CorreoNuevo = validacion.NormalizarCorreo(req.CorreoNuevo)
+	if req.CorreoNuevo == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo correo_nuevo", Codigo: "CAMPO_REQUERIDO"})
+		return
+	}
+	if validacion.Correo(req.CorreoNuevo, reglasCorreoVigentes().OpcionesCorreo) != nil {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Correo inválido", Codigo: "CORREO_INVALIDO"})
+		return
+	}
+	if funcionalidades.activa(r.Context(), flagBloquearDesechables) && correoDesechable(req.CorreoNuevo) {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "No se admiten correos desechables", Codigo: "CORREO_DESECHABLE"})
+		return
+	}
+	if req.CorreoNuevo == usuario.Correo {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "El correo nuevo debe ser distinto al actual", Codigo: "CORREO_SIN_CAMBIO"})
+		return
+	}
+	if buscarUsuario(req.CorreoNuevo) != nil {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "El correo ya se encuentra registrado", Codigo: "CORREO_DUPLICADO"})
+		return
+	}
+
+	token, err := valorAleatorio()
+	if err != nil {
+		escribirJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error generando confirmación", Codigo: "ERROR_INTERNO"})
+		return
+	}
+	usuario.CorreoPendiente = req.CorreoNuevo
+	usuario.TokenCambioCorreo = hashToken(token)
+	usuario.VenceCambioCorreo = time.Now().Add(vigenciaCambioCorreo)
+
+	enlace := config.URLPublica + prefijoAPI + "/correo/confirmar?" + url.Values{"token": {token}}.Encode()
+	err = encolarCorreo(r.Context(), req.CorreoNuevo, usuario.idioma(), plantillaCorreoConfirmarCambio, datosEnlaceCorreo{
+		Enlace: enlace, Horas: int(vigenciaCambioCorreo.Hours()),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error enviando confirmación de cambio de correo", "error", err)
+		escribirJSON(w, http.StatusBadGateway, ErrorResponse{Error: "No se pudo enviar la confirmación", Codigo: "ENVIO_FALLIDO"})
+		return
+	}
+
+	escribirJSON(w, http.StatusAccepted, MensajeResponse{Mensaje: "Enviamos un enlace de confirmación al nuevo correo"})
+}
+
+// confirmarCambioCorreoHandler aplica el cambio de correo pendiente
+// asociado al token. Vuelve a comprobar que el correo siga libre, ya que
+// pudo registrarse entre la solicitud y la confirmación, y revoca los
+// tokens existentes porque llevan el correo anterior.
+func confirmarCambioCorreoHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el token de confirmación", Codigo: "TOKEN_REQUERIDO"})
+		return
+	}
+
+	hash := hashToken(token)
+	usuario, desbloquear := bloquearUsuarioDonde(func(u *Usuario) bool {
+		return u.TokenCambioCorreo != "" && u.TokenCambioCorreo == hash
+	})
+	defer desbloquear()
+	if usuario == nil || time.Now().After(usuario.VenceCambioCorreo) {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Token de confirmación inválido o expirado", Codigo: "TOKEN_INVALIDO"})
+		return
+	}
+	anterior := usuario.Correo
+	if cambiarContactoUsuario(usuario, usuario.CorreoPendiente, usuario.Telefono) != nil {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: mensajesDuplicado[campoCorreo], Codigo: codigosDuplicado[campoCorreo]})
+		return
+	}
+	usuario.CorreoVerificado = true
+	usuario.CorreoPendiente = ""
+	usuario.TokenCambioCorreo = ""
+	registrarEvento(usuario, "correo_cambiado")
+	auditar(r, "correo_cambiado", usuario.Correo, "", "anterior: "+anterior)
+	revocarTokens(r, usuario, "correo_cambiado")
+	slog.InfoContext(r.Context(), "Correo actualizado correctamente", "correo", usuario.Correo)
+
+	if err := encolarCorreo(r.Context(), anterior, usuario.idioma(), plantillaCorreoCambiado, datosCorreoCambiado{CorreoNuevo: usuario.Correo}); err != nil {
+		slog.ErrorContext(r.Context(), "Error notificando el cambio de correo", "error", err)
+	}
+
+	escribirJSON(w, http.StatusOK, MensajeResponse{Mensaje: "Correo actualizado, vuelve a iniciar sesión"})
+}
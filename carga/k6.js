@@ -0,0 +1,75 @@
+// Prueba de carga de registro, login y perfil para medir regresiones de
+// latencia antes de cada release:
+//
+//   k6 run carga/k6.js
+//   k6 run -e URL=https://staging.ejemplo.com -e DURACION=5m -e TASA=100 carga/k6.js
+//
+// Requiere las cuentas de ejemplo (DATOS_SEED=true, activo en el perfil
+// dev) y límites de peticiones acordes a la tasa, p. ej.
+// LIMITE_REGISTRO_IP=100000/1m LIMITE_LOGIN_IP=100000/1m
+// LIMITE_LOGIN_CUENTA=100000/1m. Termina con error si no se cumplen los
+// umbrales.
+import http from "k6/http";
+import { check } from "k6";
+import exec from "k6/execution";
+
+const URL = (__ENV.URL || "http://localhost:8080") + "/api/v1";
+const DURACION = __ENV.DURACION || "1m";
+const TASA = Number(__ENV.TASA || 50);
+
+const json = { headers: { "Content-Type": "application/json" } };
+
+export const options = {
+  scenarios: {
+    registro: {
+      executor: "constant-arrival-rate", exec: "registro",
+      rate: Math.max(1, Math.floor(TASA / 5)), timeUnit: "1s", duration: DURACION,
+      preAllocatedVUs: 20, maxVUs: 200,
+    },
+    login: {
+      executor: "constant-arrival-rate", exec: "login",
+      rate: TASA, timeUnit: "1s", duration: DURACION,
+      preAllocatedVUs: 50, maxVUs: 500,
+    },
+  },
+  thresholds: {
+    http_req_failed: ["rate<0.01"],
+    "http_req_duration{endpoint:registro}": ["p(95)<200"],
+    "http_req_duration{endpoint:login}": ["p(95)<150"],
+    "http_req_duration{endpoint:perfil}": ["p(95)<50"],
+  },
+};
+
+// setup elige la base de los teléfonos de la corrida, para no repetir
+// los de corridas anteriores contra el mismo servidor.
+export function setup() {
+  return { base: (Math.floor(Date.now() / 1000) % 100) * 1e6 };
+}
+
+// registro da de alta una cuenta nueva en cada iteración (hasta un
+// millón por corrida).
+export function registro({ base }) {
+  const n = base + exec.scenario.iterationInTest;
+  const res = http.post(`${URL}/registro`, JSON.stringify({
+    correo: `carga-${n}@ejemplo.com`,
+    telefono: `56${String(n).padStart(8, "0")}`,
+    password: "Secreta@123",
+  }), { ...json, tags: { endpoint: "registro" } });
+  check(res, { "registro 201": (r) => r.status === 201 });
+}
+
+// login inicia sesión con una cuenta de ejemplo y consulta el perfil.
+export function login() {
+  const res = http.post(`${URL}/login`, JSON.stringify({
+    correo: "usuario@example.com",
+    password: "Usuario1@",
+  }), { ...json, tags: { endpoint: "login" } });
+  if (!check(res, { "login 200": (r) => r.status === 200 })) {
+    return;
+  }
+  const perfil = http.get(`${URL}/perfil`, {
+    headers: { Authorization: `Bearer ${res.json("data.token")}` },
+    tags: { endpoint: "perfil" },
+  });
+  check(perfil, { "perfil 200": (r) => r.status === 200 });
+}
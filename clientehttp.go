@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// nuevoClienteHTTP devuelve un cliente para llamar a servicios externos
+// (proveedores de identidad, webhooks, APIs de correo o SMS) que propaga
+// la correlación de la petición en curso: cada llamada lleva el
+// X-Request-ID y el traceparent del contexto y queda registrada como un
+// span de cliente. Las peticiones deben crearse con
+// http.NewRequestWithContext para que el contexto llegue al transporte.
+// timeout 0 significa sin límite.
+func nuevoClienteHTTP(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transporteInstrumentado{base: http.DefaultTransport},
+	}
+}
+
+// transporteInstrumentado agrega los headers de correlación y el span de
+// cliente a cada petición saliente.
+type transporteInstrumentado struct {
+	base http.RoundTripper
+}
+
+func (t transporteInstrumentado) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracer.Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			semconv.URLPath(req.URL.Path),
+		))
+	defer span.End()
+
+	// RoundTrip no debe modificar la petición recibida.
+	req = req.Clone(ctx)
+	for clave, valor := range metadatosCorrelacion(ctx) {
+		if req.Header.Get(clave) == "" {
+			req.Header.Set(clave, valor)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// metadatosCorrelacion devuelve los headers que identifican la petición
+// en curso ante otros servicios: X-Request-ID y, si hay una traza activa,
+// traceparent y tracestate. Sirve también como metadata para los
+// mensajes que no viajan por HTTP, como los correos.
+func metadatosCorrelacion(ctx context.Context) map[string]string {
+	metadatos := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, metadatos)
+	if id := requestIDDeContexto(ctx); id != "" {
+		metadatos[headerRequestID] = id
+	}
+	return metadatos
+}
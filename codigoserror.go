@@ -0,0 +1,35 @@
+package main
+
+import "net/http"
+
+// Cada error de la API lleva un código estable, para que los clientes
+// distingan los errores sin depender del texto, que cambia con el idioma
+// y puede reescribirse. El código se indica donde se arma el error, en
+// ErrorResponse.Codigo o con nuevoErrorServicio; los errores por campo
+// llevan además su propio codigo en errores[].
+
+// codigosStatus es el código genérico de los errores que no indican uno
+// propio, según su status.
+var codigosStatus = map[int]string{
+	http.StatusBadRequest:            "PETICION_INVALIDA",
+	http.StatusUnauthorized:          "NO_AUTENTICADO",
+	http.StatusForbidden:             "ACCESO_DENEGADO",
+	http.StatusNotFound:              "NO_ENCONTRADO",
+	http.StatusConflict:              "CONFLICTO",
+	http.StatusRequestEntityTooLarge: "CUERPO_DEMASIADO_GRANDE",
+	http.StatusUnsupportedMediaType:  "FORMATO_NO_SOPORTADO",
+	http.StatusTooManyRequests:       "DEMASIADAS_PETICIONES",
+	http.StatusServiceUnavailable:    "SERVICIO_NO_DISPONIBLE",
+}
+
+// codigoStatus devuelve el código genérico de un error con el status
+// dado.
+func codigoStatus(status int) string {
+	if codigo, ok := codigosStatus[status]; ok {
+		return codigo
+	}
+	if status >= http.StatusInternalServerError {
+		return "ERROR_INTERNO"
+	}
+	return "PETICION_INVALIDA"
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/language"
+	"pruebasgo/validacion"
+)
+
+// TestErroresConCodigo falla si un error se arma sin código: cada
+// ErrorResponse lo indica en Codigo y cada ErrorCampo, en
+// codigoRespuesta, el de la respuesta si es el primero (ver
+// erroresCampo).
+func TestErroresConCodigo(t *testing.T) {
+	requeridos := map[string]string{"ErrorResponse": "Codigo", "ErrorCampo": "codigoRespuesta"}
+	archivos, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, nombre := range archivos {
+		if strings.HasSuffix(nombre, "_test.go") {
+			continue
+		}
+		archivo, err := parser.ParseFile(fset, nombre, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(archivo, func(n ast.Node) bool {
+			lit, ok := n.(*ast.CompositeLit)
+			if !ok {
+				return true
+			}
+			// Los elementos de []ErrorCampo{{...}} no repiten el tipo.
+			literales := []*ast.CompositeLit{lit}
+			tipo := lit.Type
+			if lista, ok := tipo.(*ast.ArrayType); ok {
+				tipo, literales = lista.Elt, nil
+				for _, e := range lit.Elts {
+					if elemento, ok := e.(*ast.CompositeLit); ok {
+						literales = append(literales, elemento)
+					}
+				}
+			}
+			id, ok := tipo.(*ast.Ident)
+			if !ok || requeridos[id.Name] == "" {
+				return true
+			}
+			for _, l := range literales {
+				if len(l.Elts) > 0 && !slices.ContainsFunc(l.Elts, func(e ast.Expr) bool {
+					kv, ok := e.(*ast.KeyValueExpr)
+					clave, _ := kv.Key.(*ast.Ident)
+					return ok && clave != nil && clave.Name == requeridos[id.Name]
+				}) {
+					t.Errorf("%s: %s sin %s", fset.Position(l.Pos()), id.Name, requeridos[id.Name])
+				}
+			}
+			return true
+		})
+	}
+}
+
+func TestCodigosErrorEnRespuestas(t *testing.T) {
+	handler := routerConcurrente(t)
+	usarRepositorio(t, nuevoRepositorioMemoria())
+	correo, telefono := cuentaNueva()
+	registro := fmt.Sprintf(`{"correo":%q,"telefono":%q,"password":"Secreta@123"}`, correo, telefono)
+	if w := enviar(handler, http.MethodPost, "/registro", "", registro); w.Code != http.StatusCreated {
+		t.Fatalf("registro: status %d: %s", w.Code, w.Body)
+	}
+
+	casos := []struct {
+		nombre, metodo, ruta, cuerpo string
+		status                       int
+		codigo                       string
+	}{
+		{"correo inválido", http.MethodPost, "/registro", `{"correo":"no-es-correo","telefono":"5512345678","password":"Secreta@123"}`, http.StatusBadRequest, "CORREO_INVALIDO"},
+		{"correo duplicado", http.MethodPost, "/registro", registro, http.StatusConflict, "CORREO_DUPLICADO"},
+		{"credenciales", http.MethodPost, "/login", fmt.Sprintf(`{"correo":%q,"password":"Otra@1234"}`, correo), http.StatusUnauthorized, "CREDENCIALES_INVALIDAS"},
+		{"campo desconocido", http.MethodPost, "/login", `{"rol":"admin"}`, http.StatusBadRequest, "CAMPO_DESCONOCIDO"},
+		{"sin token", http.MethodGet, "/perfil", "", http.StatusUnauthorized, "TOKEN_REQUERIDO"},
+		{"ruta inexistente", http.MethodGet, "/no-existe", "", http.StatusNotFound, "RUTA_NO_ENCONTRADA"},
+		{"método no soportado", http.MethodDelete, "/registro", "", http.StatusMethodNotAllowed, "METODO_NO_PERMITIDO"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			w := enviar(handler, c.metodo, c.ruta, "", c.cuerpo)
+			var sobre Sobre
+			if err := json.Unmarshal(w.Body.Bytes(), &sobre); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != c.status || sobre.Error == nil || sobre.Error.Codigo != c.codigo {
+				t.Errorf("status %d, respuesta %s; se esperaba %d con código %s", w.Code, w.Body, c.status, c.codigo)
+			}
+		})
+	}
+}
+
+func TestMetodoNoPermitidoConAllow(t *testing.T) {
+	w := enviar(routerConcurrente(t), http.MethodDelete, "/registro", "", "")
+	if w.Header().Get("Allow") != "POST" || w.Header().Get("Content-Type") != tipoJSON {
+		t.Errorf("headers %v, se esperaba Allow: POST y Content-Type %s", w.Header(), tipoJSON)
+	}
+}
+
+func TestCodigoErrorPorStatus(t *testing.T) {
+	casos := map[int]string{
+		http.StatusNotFound:            "NO_ENCONTRADO",
+		http.StatusTeapot:              "PETICION_INVALIDA",
+		http.StatusInternalServerError: "ERROR_INTERNO",
+		http.StatusBadGateway:          "ERROR_INTERNO",
+	}
+	for status, esperado := range casos {
+		if codigo := codigoStatus(status); codigo != esperado {
+			t.Errorf("status %d: código %s, se esperaba %s", status, codigo, esperado)
+		}
+	}
+}
+
+// TestCodigosConTraduccion falla si un código de error no tiene su
+// traducción en mensajesIngles, o si un mensaje en español con una parte
+// variable no sigue la plantilla de su código: se respondería con el
+// mensaje general.
+func TestCodigosConTraduccion(t *testing.T) {
+	comprobar := func(posicion string, codigo, mensaje ast.Expr) {
+		lit, ok := codigo.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return
+		}
+		c, _ := strconv.Unquote(lit.Value)
+		traduccion, ok := mensajesIngles[c]
+		if !ok {
+			t.Errorf("%s: el código %s no tiene traducción", posicion, c)
+			return
+		}
+		if texto, variable := mensajeConMarca(mensaje); variable {
+			if _, ok := valorDePlantilla(texto, traduccion.plantilla); !ok {
+				t.Errorf("%s: el mensaje %q no sigue la plantilla %q de %s", posicion, texto, traduccion.plantilla, c)
+			}
+		}
+	}
+	campos := map[string][2]string{
+		"ErrorResponse": {"Codigo", "Error"},
+		"ErrorSobre":    {"Codigo", "Mensaje"},
+		"ErrorCampo":    {"codigoRespuesta", "Mensaje"},
+	}
+
+	archivos, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, nombre := range archivos {
+		if strings.HasSuffix(nombre, "_test.go") {
+			continue
+		}
+		archivo, err := parser.ParseFile(fset, nombre, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(archivo, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				if id, ok := n.Fun.(*ast.Ident); ok && id.Name == "nuevoErrorServicio" && len(n.Args) == 3 {
+					comprobar(fset.Position(n.Pos()).String(), n.Args[1], n.Args[2])
+				}
+			case *ast.CompositeLit:
+				id, ok := n.Type.(*ast.Ident)
+				if !ok {
+					return true
+				}
+				if id.Name == "errorCuerpo" && len(n.Elts) == 3 {
+					comprobar(fset.Position(n.Pos()).String(), n.Elts[1], n.Elts[2])
+				}
+				nombres, ok := campos[id.Name]
+				if !ok {
+					return true
+				}
+				var codigo, mensaje ast.Expr
+				for _, e := range n.Elts {
+					if kv, ok := e.(*ast.KeyValueExpr); ok {
+						switch clave, _ := kv.Key.(*ast.Ident); {
+						case clave == nil:
+						case clave.Name == nombres[0]:
+							codigo = kv.Value
+						case clave.Name == nombres[1]:
+							mensaje = kv.Value
+						}
+					}
+				}
+				if codigo != nil {
+					comprobar(fset.Position(n.Pos()).String(), codigo, mensaje)
+				}
+			}
+			return true
+		})
+	}
+
+	for status, codigo := range codigosStatus {
+		if _, ok := mensajesIngles[codigo]; !ok {
+			t.Errorf("status %d: el código %s no tiene traducción", status, codigo)
+		}
+	}
+	if _, ok := mensajesIngles[codigoStatus(http.StatusInternalServerError)]; !ok {
+		t.Error("el código de los errores 5xx no tiene traducción")
+	}
+}
+
+// mensajeConMarca devuelve el texto de un mensaje armado con literales,
+// concatenaciones o fmt.Sprintf, con cada parte variable marcada con %s,
+// e indica si tiene alguna.
+func mensajeConMarca(mensaje ast.Expr) (string, bool) {
+	switch m := mensaje.(type) {
+	case *ast.BasicLit:
+		texto, _ := strconv.Unquote(m.Value)
+		return texto, false
+	case *ast.BinaryExpr:
+		izquierda, v1 := mensajeConMarca(m.X)
+		derecha, v2 := mensajeConMarca(m.Y)
+		return izquierda + derecha, v1 || v2
+	case *ast.CallExpr:
+		if sel, ok := m.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Sprintf" && len(m.Args) > 0 {
+			if formato, ok := m.Args[0].(*ast.BasicLit); ok {
+				texto, _ := strconv.Unquote(formato.Value)
+				return verbosFormato.ReplaceAllString(texto, "%s"), true
+			}
+		}
+	}
+	return "%s", mensaje != nil
+}
+
+var verbosFormato = regexp.MustCompile(`%[a-z]`)
+
+// TestReglasConTraduccion falla si una regla de contraseña incumplida no
+// tiene su traducción en reglasIngles.
+func TestReglasConTraduccion(t *testing.T) {
+	for _, unicode := range []bool{false, true} {
+		politica := validacion.PoliticaPassword{LongitudMinima: 8, LongitudMaxima: 0, Especiales: "@#$", EspecialesUnicode: unicode}
+		var errPassword *validacion.ErrorPassword
+		if !errors.As(validacion.Password("  ", politica), &errPassword) {
+			t.Fatal("se esperaba un *validacion.ErrorPassword")
+		}
+		for _, regla := range errPassword.Reglas {
+			if traducida := traducirRegla(regla.Mensaje, language.English); traducida == regla.Mensaje || strings.Contains(traducida, "%s") {
+				t.Errorf("regla %s: %q se tradujo como %q", regla.Codigo, regla.Mensaje, traducida)
+			}
+		}
+	}
+}
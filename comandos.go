@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// comando es un subcomando del binario, p. ej. "serve".
+type comando struct {
+	nombre      string
+	descripcion string
+	ejecutar    func(args []string)
+}
+
+// comandos lista los subcomandos disponibles.
+var comandos = []comando{
+	{"serve", "Inicia el servidor HTTP", comandoServe},
+	{"openapi", "Escribe la especificación OpenAPI de la API", comandoOpenAPI},
+	{"admin", "Administra usuarios contra el servidor en marcha", comandoAdmin},
+}
+
+// ejecutarComando despacha los argumentos al subcomando indicado. Sin
+// subcomando, o si el primer argumento es un flag, se ejecuta serve para
+// mantener la forma de arranque anterior.
+func ejecutarComando(args []string) {
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && !esAyuda(args[0])) {
+		comandoServe(args)
+		return
+	}
+	for _, c := range comandos {
+		if c.nombre == args[0] {
+			c.ejecutar(args[1:])
+			return
+		}
+	}
+	if esAyuda(args[0]) {
+		ayudaComandos()
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Subcomando desconocido: %s\n\n", args[0])
+	ayudaComandos()
+	os.Exit(2)
+}
+
+// esAyuda indica si el argumento pide la ayuda general.
+func esAyuda(arg string) bool {
+	return arg == "help" || arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// ayudaComandos escribe la lista de subcomandos en la salida de errores.
+func ayudaComandos() {
+	fmt.Fprintf(os.Stderr, "Uso: %s <subcomando> [flags]\n\nSubcomandos:\n", os.Args[0])
+	for _, c := range comandos {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.nombre, c.descripcion)
+	}
+	fmt.Fprintf(os.Stderr, "\nUsa \"%s <subcomando> -h\" para ver sus flags.\n", os.Args[0])
+}
+
+// opcionesFlag relaciona los flags de configuración con la variable de
+// entorno a la que reemplazan.
+var opcionesFlag = []struct {
+	flag, variable, descripcion string
+}{
+	{"profile", "PERFIL", "perfil de ejecución: dev o prod"},
+	{"port", "PORT", "puerto HTTP"},
+	{"listen", "DIRECCIONES", "direcciones host:puerto separadas por coma; reemplaza a --port"},
+	{"log-level", "LOG_NIVEL", "nivel mínimo de log: debug, info, warn o error"},
+	{"storage", "ALMACENAMIENTO", "almacenamiento de usuarios: memoria"},
+	{"seed", "DATOS_SEED_ARCHIVO", "archivo JSON con usuarios de prueba que se cargan al arrancar"},
+}
+
+// flagsConfig registra en fs el flag --config y los de opcionesFlag.
+// Después de fs.Parse, la función devuelta carga el archivo de
+// configuración y deja los flags usados en fuentes.flags, por encima del
+// entorno y del archivo.
+func flagsConfig(fs *flag.FlagSet) func() error {
+	archivo := fs.String("config", "", "archivo de configuración YAML o TOML")
+	for _, o := range opcionesFlag {
+		fs.String(o.flag, "", o.descripcion+" ("+o.variable+")")
+	}
+
+	return func() error {
+		flags := map[string]string{}
+		fs.Visit(func(f *flag.Flag) {
+			for _, o := range opcionesFlag {
+				if o.flag == f.Name {
+					flags[o.variable] = f.Value.String()
+				}
+			}
+		})
+		fuentes.mu.Lock()
+		fuentes.flags = flags
+		fuentes.mu.Unlock()
+		if *archivo == "" {
+			return nil
+		}
+		return fuentes.cargarArchivo(*archivo)
+	}
+}
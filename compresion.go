@@ -0,0 +1,279 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ConfigCompresion define qué respuestas se comprimen.
+type ConfigCompresion struct {
+	Habilitada bool
+	// Minimo es el tamaño desde el que se comprime un cuerpo; los más
+	// chicos no compensan el costo.
+	Minimo int
+	Nivel  int
+}
+
+// cargarConfigCompresion lee COMPRESION (true, por defecto, o false),
+// COMPRESION_MINIMO (bytes, por defecto 1024) y COMPRESION_NIVEL (1 a 9,
+// por defecto 6).
+func cargarConfigCompresion() (ConfigCompresion, error) {
+	cfg := ConfigCompresion{Habilitada: true, Minimo: 1024, Nivel: 6}
+	if v := strings.TrimSpace(opcion("COMPRESION")); v != "" {
+		habilitada, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("COMPRESION=%q: debe ser true o false", v)
+		}
+		cfg.Habilitada = habilitada
+	}
+	if v := strings.TrimSpace(opcion("COMPRESION_MINIMO")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("COMPRESION_MINIMO=%q: debe ser un entero no negativo", v)
+		}
+		cfg.Minimo = n
+	}
+	if v := strings.TrimSpace(opcion("COMPRESION_NIVEL")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < gzip.BestSpeed || n > gzip.BestCompression {
+			return cfg, fmt.Errorf("COMPRESION_NIVEL=%q: debe ser un entero de 1 a 9", v)
+		}
+		cfg.Nivel = n
+	}
+	return cfg, nil
+}
+
+// Codificaciones de contenido soportadas. deflate es el formato zlib
+// (RFC 1950), como lo define HTTP.
+const (
+	codificacionGzip    = "gzip"
+	codificacionDeflate = "deflate"
+)
+
+// compresor es la interfaz común de gzip.Writer y zlib.Writer.
+type compresor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// codificacionAceptada elige, según el header Accept-Encoding, gzip o
+// deflate, la de mayor q (gzip ante un empate), o "" si el cliente no
+// acepta ninguna.
+func codificacionAceptada(acceptEncoding string) string {
+	calidades := map[string]float64{}
+	comodin := -1.0
+	for _, parte := range strings.Split(acceptEncoding, ",") {
+		nombre, params, _ := strings.Cut(parte, ";")
+		nombre = strings.ToLower(strings.TrimSpace(nombre))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch nombre {
+		case "x-gzip":
+			nombre = codificacionGzip
+		case "*":
+			comodin = q
+			continue
+		}
+		calidades[nombre] = q
+	}
+	mejor, mejorQ := "", 0.0
+	for _, c := range []string{codificacionGzip, codificacionDeflate} {
+		q, ok := calidades[c]
+		if !ok && comodin >= 0 {
+			q = comodin
+		}
+		if q > mejorQ {
+			mejor, mejorQ = c, q
+		}
+	}
+	return mejor
+}
+
+// tipoCompresible indica si vale la pena comprimir el Content-Type: JSON,
+// MessagePack, Protobuf, XML, YAML y texto. text/event-stream no se
+// comprime para que cada evento llegue en cuanto se envía.
+func tipoCompresible(tipoContenido string) bool {
+	tipo, _, err := mime.ParseMediaType(tipoContenido)
+	if err != nil {
+		return false
+	}
+	switch {
+	case tipo == "text/event-stream":
+		return false
+	case strings.HasPrefix(tipo, "text/"), strings.HasSuffix(tipo, "+json"), strings.HasSuffix(tipo, "+xml"):
+		return true
+	}
+	switch tipo {
+	case "application/json", tipoMsgpack, tipoProtobuf, "application/xml", "application/yaml", "application/javascript":
+		return true
+	}
+	return false
+}
+
+// compresionMiddleware comprime con gzip o deflate, según Accept-Encoding,
+// las respuestas de un tipo compresible desde cfg.Minimo bytes, como los
+// listados de usuarios y las exportaciones. Debe ir por fuera de los
+// middlewares que reescriben el cuerpo (idiomaMiddleware). No se
+// comprimen las respuestas que ya traen Content-Encoding, como /metrics,
+// ni las conexiones WebSocket.
+func compresionMiddleware(cfg ConfigCompresion) func(http.Handler) http.Handler {
+	if !cfg.Habilitada {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	compresores := map[string]*sync.Pool{
+		codificacionGzip: {New: func() any {
+			c, _ := gzip.NewWriterLevel(io.Discard, cfg.Nivel)
+			return c
+		}},
+		codificacionDeflate: {New: func() any {
+			c, _ := zlib.NewWriterLevel(io.Discard, cfg.Nivel)
+			return c
+		}},
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			codificacion := codificacionAceptada(r.Header.Get("Accept-Encoding"))
+			if codificacion == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rc := &respuestaComprimida{ResponseWriter: w, minimo: cfg.Minimo, codificacion: codificacion, pool: compresores[codificacion]}
+			defer rc.terminar()
+			next.ServeHTTP(rc, r)
+		})
+	}
+}
+
+// respuestaComprimida retiene el status y los primeros bytes del cuerpo
+// hasta saber si la respuesta se comprime: al alcanzar el mínimo, al
+// terminar el handler o cuando este pide Flush.
+type respuestaComprimida struct {
+	http.ResponseWriter
+	minimo       int
+	codificacion string
+	pool         *sync.Pool
+
+	status    int
+	decidida  bool
+	pendiente []byte
+	compresor compresor
+}
+
+func (w *respuestaComprimida) WriteHeader(status int) {
+	switch {
+	case status < http.StatusOK:
+		// Las respuestas informativas (1xx) no llevan cuerpo.
+		w.ResponseWriter.WriteHeader(status)
+		return
+	case w.status != 0:
+		// Llamada repetida: net/http también la ignora.
+		return
+	}
+	w.status = status
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.decidir(false)
+	}
+}
+
+func (w *respuestaComprimida) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.decidida {
+		if w.compresor != nil {
+			return w.compresor.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.pendiente = append(w.pendiente, b...)
+	if len(w.pendiente) >= w.minimo {
+		if err := w.decidir(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Unwrap permite a http.ResponseController llegar al writer original.
+func (w *respuestaComprimida) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush envía lo escrito hasta ahora, comprimido si el tipo lo permite
+// aunque no se haya alcanzado el mínimo.
+func (w *respuestaComprimida) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decidida {
+		w.decidir(true)
+	}
+	if w.compresor != nil {
+		w.compresor.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// decidir envía los headers y el cuerpo retenido, comprimido si
+// comprimir es true y la respuesta no trae ya Content-Encoding y es de un
+// tipo compresible. Sin Content-Type lo detecta, como lo haría net/http.
+func (w *respuestaComprimida) decidir(comprimir bool) error {
+	w.decidida = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.pendiente) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.pendiente))
+	}
+	if comprimir && h.Get("Content-Encoding") == "" && tipoCompresible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", w.codificacion)
+		h.Del("Content-Length")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			// La representación comprimida no es idéntica byte a byte.
+			h.Set("ETag", "W/"+etag)
+		}
+		w.compresor = w.pool.Get().(compresor)
+		w.compresor.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	pendiente := w.pendiente
+	w.pendiente = nil
+	if len(pendiente) == 0 {
+		return nil
+	}
+	if w.compresor != nil {
+		_, err := w.compresor.Write(pendiente)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(pendiente)
+	return err
+}
+
+// terminar envía lo que quedó retenido y cierra el compresor.
+func (w *respuestaComprimida) terminar() {
+	if w.status == 0 {
+		// El handler no escribió nada; net/http responderá 200 vacío.
+		return
+	}
+	if !w.decidida {
+		w.decidir(false)
+	}
+	if w.compresor != nil {
+		w.compresor.Close()
+		w.compresor.Reset(io.Discard)
+		w.pool.Put(w.compresor)
+		w.compresor = nil
+	}
+}
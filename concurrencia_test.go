@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"pruebasgo/testutil"
+)
+
+// Las pruebas de concurrencia lanzan muchas peticiones a la vez contra el
+// router para que el detector de carreras encuentre accesos sin
+// sincronizar al estado compartido:
+//
+//	go test -race -run Concurrente .
+
+// concurrentes es la cantidad de goroutines de cada prueba.
+const concurrentes = 32
+
+// enParalelo ejecuta f(i) en concurrentes goroutines y espera a que
+// terminen todas.
+func enParalelo(f func(i int)) {
+	var wg sync.WaitGroup
+	for i := range concurrentes {
+		wg.Go(func() { f(i) })
+	}
+	wg.Wait()
+}
+
+// routerConcurrente es el router con el límite de peticiones holgado,
+// porque todas las peticiones llegan desde la misma IP.
+func routerConcurrente(t *testing.T) http.Handler {
+	t.Helper()
+	prepararHandlers(t)
+	mensajesEnviados(t)
+	t.Setenv("LIMITE_REGISTRO_IP", "100000/1h")
+	t.Setenv("LIMITE_LOGIN_IP", "100000/1m")
+	t.Setenv("LIMITE_LOGIN_CUENTA", "100000/1m")
+	return requestIDMiddleware(recuperacionMiddleware(metricasMiddleware(nuevoRouter())))
+}
+
+// enviar atiende una petición a la API con handler y devuelve la
+// respuesta.
+func enviar(handler http.Handler, metodo, ruta, token, cuerpo string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(metodo, prefijoAPI+ruta, strings.NewReader(cuerpo))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRegistroConcurrente(t *testing.T) {
+	handler := routerConcurrente(t)
+	usarRepositorio(t, nuevoRepositorioMemoria())
+
+	// Cada goroutine registra cuentas propias y, además, todas intentan
+	// registrar la misma: sólo una debe conseguirlo.
+	const porGoroutine = 20
+	cuerpo := func(correo, telefono string) string {
+		return fmt.Sprintf(`{"correo":%q,"telefono":%q,"password":"Secreta@123"}`, correo, telefono)
+	}
+	disputada := cuerpo("disputada@ejemplo.com", "5529999999")
+	var mu sync.Mutex
+	status := map[int]int{}
+	enParalelo(func(int) {
+		for range porGoroutine {
+			correo, telefono := cuentaNueva()
+			if w := enviar(handler, http.MethodPost, "/registro", "", cuerpo(correo, telefono)); w.Code != http.StatusCreated {
+				t.Errorf("registro de %s: status %d: %s", correo, w.Code, w.Body)
+			}
+		}
+		w := enviar(handler, http.MethodPost, "/registro", "", disputada)
+		mu.Lock()
+		status[w.Code]++
+		mu.Unlock()
+	})
+
+	if status[http.StatusCreated] != 1 || status[http.StatusConflict] != concurrentes-1 {
+		t.Errorf("registros de la misma cuenta: %v, se esperaban 1 creado y %d conflictos", status, concurrentes-1)
+	}
+	if n, esperado := contarUsuarios(), concurrentes*porGoroutine+1; n != esperado {
+		t.Errorf("hay %d usuarios, se esperaban %d", n, esperado)
+	}
+}
+
+func TestSesionesConcurrentes(t *testing.T) {
+	handler := routerConcurrente(t)
+	usarRepositorio(t, nuevoRepositorioMemoria())
+	u := testutil.NuevoUsuario()
+	testutil.Handler(handler).Registrar(t, u)
+
+	// Muchas sesiones de la misma cuenta leen y escriben el mismo usuario
+	// a la vez.
+	login := fmt.Sprintf(`{"correo":%q,"password":%q}`, u.Correo, u.Password)
+	enParalelo(func(i int) {
+		w := enviar(handler, http.MethodPost, "/login", "", login)
+		if w.Code != http.StatusOK {
+			t.Errorf("login: status %d: %s", w.Code, w.Body)
+			return
+		}
+		var sesion struct {
+			Data LoginResponse `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &sesion); err != nil || sesion.Data.Token == "" {
+			t.Errorf("login sin token: %v: %s", err, w.Body)
+			return
+		}
+		for _, peticion := range []struct{ metodo, ruta, cuerpo string }{
+			{http.MethodGet, "/perfil", ""},
+			{http.MethodPut, "/perfil", fmt.Sprintf(`{"telefono":"55299%05d"}`, i)},
+			{http.MethodGet, "/perfil/exportar", ""},
+			{http.MethodPost, "/password/cambiar", `{"password_actual":"Otra@1234","password_nueva":"Nueva@1234"}`},
+		} {
+			enviar(handler, peticion.metodo, peticion.ruta, sesion.Data.Token, peticion.cuerpo)
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nyaruka/phonenumbers"
+	"pruebasgo/validacion"
+)
+
+// Config reúne la configuración general del servicio. Cada
+// funcionalidad opcional (HTTPS, OIDC, límites, ...) sigue leyendo sus
+// propias variables.
+type Config struct {
+	Perfil                   string
+	Puerto                   int
+	Direcciones              []string
+	PaisTelefono             string
+	JWTSecret                []byte
+	TokenTTL                 time.Duration
+	DBURL                    string
+	Almacenamiento           string
+	URLPublica               string
+	AdminCorreos             []string
+	RequiereCorreoVerificado bool
+	TLSEnProxy               bool
+	DatosSeed                bool
+	ArchivoSeed              string
+	Docs                     bool
+}
+
+// config es la configuración vigente; main la reemplaza al arrancar con
+// la leída de sus fuentes.
+var config = configPorDefecto()
+
+// fuentesConfig guarda los valores de configuración que no vienen del
+// entorno, indexados por el nombre de la variable de entorno equivalente.
+// El archivo y el .env pueden volver a leerse en caliente con
+// recargarArchivo.
+type fuentesConfig struct {
+	mu          sync.RWMutex
+	flags       map[string]string
+	dotenv      map[string]string
+	archivo     map[string]string
+	perfil      map[string]string
+	rutaArchivo string
+	rutaDotenv  string
+}
+
+// fuentes son los valores cargados de la línea de comandos y del archivo
+// de configuración.
+var fuentes fuentesConfig
+
+// cargarArchivo lee el archivo de configuración y recuerda su ruta para
+// recargarlo.
+func (f *fuentesConfig) cargarArchivo(ruta string) error {
+	valores, err := cargarArchivoConfig(ruta)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.archivo, f.rutaArchivo = valores, ruta
+	return nil
+}
+
+// recargarArchivo vuelve a leer el archivo de configuración y el .env,
+// si se cargaron. Si no se pueden leer se conservan los valores
+// anteriores.
+func (f *fuentesConfig) recargarArchivo() error {
+	f.mu.RLock()
+	ruta, rutaDotenv := f.rutaArchivo, f.rutaDotenv
+	f.mu.RUnlock()
+	if rutaDotenv != "" {
+		if err := f.cargarDotenv(rutaDotenv); err != nil {
+			return err
+		}
+	}
+	if ruta == "" {
+		return nil
+	}
+	return f.cargarArchivo(ruta)
+}
+
+// buscarOpcion devuelve el valor de una opción de configuración con la
+// precedencia flags > entorno > .env > archivo > perfil. ok es false si
+// no está definida en ninguna fuente y debe usarse el valor por defecto.
+func buscarOpcion(nombre string) (valor string, ok bool) {
+	fuentes.mu.RLock()
+	defer fuentes.mu.RUnlock()
+	if v, ok := fuentes.flags[nombre]; ok {
+		return v, true
+	}
+	if v, ok := os.LookupEnv(nombre); ok {
+		return v, true
+	}
+	if v, ok := fuentes.dotenv[nombre]; ok {
+		return v, true
+	}
+	if v, ok := fuentes.archivo[nombre]; ok {
+		return v, true
+	}
+	v, ok := fuentes.perfil[nombre]
+	return v, ok
+}
+
+// opcion devuelve el valor de una opción de configuración, o "" si no
+// está definida.
+func opcion(nombre string) string {
+	v, _ := buscarOpcion(nombre)
+	return v
+}
+
+// configPorDefecto devuelve los valores que se usan cuando una variable
+// no está definida.
+func configPorDefecto() Config {
+	return Config{
+		Puerto:         8080,
+		TokenTTL:       24 * time.Hour,
+		Almacenamiento: "memoria",
+		URLPublica:     "http://localhost:8080",
+		PaisTelefono:   "MX",
+		Docs:           true,
+	}
+}
+
+// cargarConfig lee, sobre los valores por defecto:
+// - PERFIL: dev, prod o vacío (ver cargarPerfil)
+// - PORT: puerto HTTP (1-65535), en todas las interfaces
+// - DIRECCIONES: direcciones host:puerto en las que se escucha, separadas
+// por coma; reemplaza a PORT
+// - JWT_SECRET: clave para firmar los tokens, si no se usa un gestor de
+// secretos
+// - TOKEN_TTL: vigencia de los tokens, en formato de duración de Go
+// - DB_URL: URL de la base de datos
+// - ALMACENAMIENTO: dónde se guardan los usuarios; por ahora sólo
+// "memoria"
+// - URL_PUBLICA: URL con la que los usuarios alcanzan el servicio, para
+// los enlaces enviados por correo
+// - ADMIN_CORREOS: correos que obtienen el rol de administrador,
+// separados por coma
+// - REQUIERE_CORREO_VERIFICADO: rechazar el login de cuentas sin
+// verificar
+// - PAIS_TELEFONO: país (ISO 3166-1 alfa-2) de los teléfonos escritos
+// sin prefijo internacional
+// - TLS_EN_PROXY: TLS lo termina un proxy delante del servicio
+// - DATOS_SEED: cargar usuarios de ejemplo al arrancar
+// - DATOS_SEED_ARCHIVO: archivo JSON con usuarios de prueba que se
+// cargan al arrancar
+// - DOCS: servir la especificación OpenAPI y Swagger UI
+// Cada opción se toma de un flag, de la variable de entorno o del archivo
+// de configuración, en ese orden. Devuelve juntos todos los valores
+// inválidos para corregirlos de una vez.
+func cargarConfig() (Config, error) {
+	cfg := configPorDefecto()
+	var errs []error
+	invalida := func(nombre, valor, motivo string) {
+		errs = append(errs, fmt.Errorf("%s=%q: %s", nombre, valor, motivo))
+	}
+
+	if v, ok := buscarOpcion("PORT"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 65535 {
+			invalida("PORT", v, "debe ser un puerto entre 1 y 65535")
+		} else {
+			cfg.Puerto = n
+		}
+	}
+	cfg.Direcciones = []string{fmt.Sprintf(":%d", cfg.Puerto)}
+	if v := opcion("DIRECCIONES"); v != "" {
+		var direcciones []string
+		for _, d := range strings.Split(v, ",") {
+			if d = strings.TrimSpace(d); d == "" {
+				continue
+			}
+			if err := validarDireccion(d); err != nil {
+				invalida("DIRECCIONES", d, err.Error())
+				continue
+			}
+			if slices.Contains(direcciones, d) {
+				invalida("DIRECCIONES", d, "está repetida")
+				continue
+			}
+			direcciones = append(direcciones, d)
+		}
+		if len(direcciones) > 0 {
+			cfg.Direcciones = direcciones
+		}
+	}
+	if v, ok := buscarOpcion("JWT_SECRET"); ok {
+		if v == "" {
+			invalida("JWT_SECRET", v, "no puede estar vacío")
+		} else {
+			cfg.JWTSecret = []byte(v)
+		}
+	}
+	if v, ok := buscarOpcion("TOKEN_TTL"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			invalida("TOKEN_TTL", v, "debe ser una duración positiva, p. ej. 24h")
+		} else {
+			cfg.TokenTTL = d
+		}
+	}
+	if v := opcion("DB_URL"); v != "" {
+		u, err := url.Parse(v)
+		if err != nil || u.Scheme == "" {
+			invalida("DB_URL", valorFiltrado, "debe ser una URL con esquema, p. ej. postgres://...")
+		} else {
+			cfg.DBURL = v
+		}
+	}
+	if v := opcion("ALMACENAMIENTO"); v != "" {
+		if v != "memoria" {
+			invalida("ALMACENAMIENTO", v, "el único almacenamiento disponible es memoria")
+		} else {
+			cfg.Almacenamiento = v
+		}
+	}
+	if v := opcion("URL_PUBLICA"); v != "" {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalida("URL_PUBLICA", v, "debe ser una URL http o https absoluta")
+		} else {
+			cfg.URLPublica = strings.TrimSuffix(v, "/")
+		}
+	}
+	for _, correo := range strings.Split(opcion("ADMIN_CORREOS"), ",") {
+		if correo = validacion.NormalizarCorreo(correo); correo != "" {
+			cfg.AdminCorreos = append(cfg.AdminCorreos, correo)
+		}
+	}
+	if v := opcion("PAIS_TELEFONO"); v != "" {
+		if pais := strings.ToUpper(v); phonenumbers.GetCountryCodeForRegion(pais) == 0 {
+			invalida("PAIS_TELEFONO", v, "debe ser un código de país ISO 3166-1 alfa-2, p. ej. MX")
+		} else {
+			cfg.PaisTelefono = pais
+		}
+	}
+	cfg.Perfil = strings.ToLower(opcion("PERFIL"))
+	cfg.ArchivoSeed = opcion("DATOS_SEED_ARCHIVO")
+	for _, o := range []struct {
+		nombre  string
+		destino *bool
+	}{
+		{"REQUIERE_CORREO_VERIFICADO", &cfg.RequiereCorreoVerificado},
+		{"TLS_EN_PROXY", &cfg.TLSEnProxy},
+		{"DATOS_SEED", &cfg.DatosSeed},
+		{"DOCS", &cfg.Docs},
+	} {
+		if v, ok := buscarOpcion(o.nombre); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				invalida(o.nombre, v, "debe ser true o false")
+			} else {
+				*o.destino = b
+			}
+		}
+	}
+
+	return cfg, errors.Join(errs...)
+}
+
+// validarDireccion comprueba que d tenga la forma host:puerto, con el host
+// opcional (":8080" escucha en todas las interfaces).
+func validarDireccion(d string) error {
+	_, puerto, err := net.SplitHostPort(d)
+	if err != nil {
+		return errors.New("debe tener la forma host:puerto, p. ej. 127.0.0.1:9000 o :8080")
+	}
+	if n, err := strconv.Atoi(puerto); err != nil || n < 1 || n > 65535 {
+		return errors.New("el puerto debe estar entre 1 y 65535")
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// cargarArchivoConfig lee un archivo de configuración YAML (.yaml, .yml)
+// o TOML (.toml) y devuelve sus valores indexados por el nombre de la
+// variable de entorno equivalente: las claves se pasan a mayúsculas y las
+// secciones anidadas se unen con "_", de modo que
+//
+//	oidc:
+//	  issuer: https://idp.ejemplo.com
+//
+// equivale a OIDC_ISSUER. Las listas se unen con comas.
+func cargarArchivoConfig(ruta string) (map[string]string, error) {
+	contenido, err := os.ReadFile(ruta)
+	if err != nil {
+		return nil, err
+	}
+
+	datos := map[string]any{}
+	switch strings.ToLower(filepath.Ext(ruta)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(contenido, &datos)
+	case ".toml":
+		err = toml.Unmarshal(contenido, &datos)
+	default:
+		return nil, fmt.Errorf("%s: formato no soportado, usa .yaml, .yml o .toml", ruta)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ruta, err)
+	}
+
+	valores := map[string]string{}
+	if err := aplanarConfig("", datos, valores); err != nil {
+		return nil, fmt.Errorf("%s: %w", ruta, err)
+	}
+	return valores, nil
+}
+
+// aplanarConfig agrega a destino los valores escalares de valor con su
+// nombre de variable de entorno.
+func aplanarConfig(nombre string, valor any, destino map[string]string) error {
+	switch v := valor.(type) {
+	case map[string]any:
+		for clave, hijo := range v {
+			clave = strings.ToUpper(strings.ReplaceAll(clave, "-", "_"))
+			if nombre != "" {
+				clave = nombre + "_" + clave
+			}
+			if err := aplanarConfig(clave, hijo, destino); err != nil {
+				return err
+			}
+		}
+	case []any:
+		elementos := make([]string, 0, len(v))
+		for _, e := range v {
+			s, ok := escalarConfig(e)
+			if !ok {
+				return fmt.Errorf("%s: las listas sólo pueden contener valores simples", nombre)
+			}
+			elementos = append(elementos, s)
+		}
+		destino[nombre] = strings.Join(elementos, ",")
+	default:
+		s, ok := escalarConfig(v)
+		if !ok {
+			return fmt.Errorf("%s: valor no soportado", nombre)
+		}
+		destino[nombre] = s
+	}
+	return nil
+}
+
+// escalarConfig convierte un valor simple al texto que tendría en una
+// variable de entorno.
+func escalarConfig(valor any) (string, bool) {
+	switch v := valor.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case time.Time:
+		return v.Format(time.RFC3339), true
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
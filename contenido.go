@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"pruebasgo/usuariospb"
+)
+
+// Formatos que la API acepta y produce además de JSON.
+const (
+	tipoJSON     = "application/json"
+	tipoMsgpack  = "application/x-msgpack"
+	tipoProtobuf = "application/x-protobuf"
+)
+
+// aliasTipos son otros nombres con que los clientes piden esos formatos
+// en Content-Type y Accept.
+var aliasTipos = map[string]string{
+	"application/msgpack":     tipoMsgpack,
+	"application/vnd.msgpack": tipoMsgpack,
+	"application/protobuf":    tipoProtobuf,
+}
+
+// mensajesProto son los mensajes de proto/usuarios.proto que equivalen al
+// cuerpo y a la respuesta de cada endpoint; sólo éstos admiten Protobuf.
+// MessagePack no necesita esquema y lo admiten todos.
+var mensajesProto = map[string]struct {
+	cuerpo, respuesta func() proto.Message
+}{
+	"POST /registro": {
+		func() proto.Message { return &usuariospb.RegistrarRequest{} },
+		func() proto.Message { return &usuariospb.RegistrarResponse{} },
+	},
+	"POST /login": {
+		func() proto.Message { return &usuariospb.LoginRequest{} },
+		func() proto.Message { return &usuariospb.LoginResponse{} },
+	},
+	"GET /perfil": {
+		nil,
+		func() proto.Message { return &usuariospb.PerfilResponse{} },
+	},
+}
+
+// negociarContenido permite al endpoint patron recibir el cuerpo en
+// MessagePack o Protobuf, según Content-Type, y responder en esos
+// formatos, según Accept. El handler sigue trabajando con JSON: el
+// cuerpo se traduce a JSON antes de llamarlo y su respuesta se traduce
+// después. Un Accept sin ningún formato soportado recibe JSON.
+func negociarContenido(patron string, next http.HandlerFunc) http.HandlerFunc {
+	mensajes := mensajesProto[patron]
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		formato := formatoRespuesta(r.Header.Get("Accept"), mensajes.respuesta != nil)
+
+		if r.Body != nil && r.ContentLength != 0 {
+			tipo, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if tipo = normalizarTipo(tipo); tipo == tipoMsgpack || tipo == tipoProtobuf {
+				if status, e := traducirCuerpo(w, r, tipo, mensajes.cuerpo); status != 0 {
+					escribirErrorSobre(w, r, status, e)
+					return
+				}
+			}
+		}
+
+		if formato == tipoJSON {
+			// Los handlers responden con escribirJSON, que lo fija; esto
+			// cubre al que escriba el cuerpo directamente, que sin
+			// Content-Type net/http adivinaría como text/plain.
+			w.Header().Set("Content-Type", tipoJSON)
+			next(w, r)
+			return
+		}
+		rn := &respuestaNegociada{ResponseWriter: w}
+		next(rn, r)
+		rn.enviar(r, formato, mensajes.respuesta)
+	}
+}
+
+// normalizarTipo devuelve el nombre canónico de un formato alternativo.
+func normalizarTipo(tipo string) string {
+	return cmp.Or(aliasTipos[strings.ToLower(tipo)], tipo)
+}
+
+// formatoRespuesta elige, según el Accept, el formato de la respuesta:
+// el soportado con mayor q y, a igual q, el primero listado. Protobuf
+// sólo se ofrece si el endpoint tiene mensaje de respuesta.
+func formatoRespuesta(accept string, protobuf bool) string {
+	mejor, mejorQ := tipoJSON, 0.0
+	for _, parte := range strings.Split(accept, ",") {
+		tipo, params, err := mime.ParseMediaType(strings.TrimSpace(parte))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch tipo = normalizarTipo(tipo); {
+		case tipo == tipoProtobuf && !protobuf:
+			continue
+		case tipo == tipoMsgpack, tipo == tipoProtobuf, tipo == tipoJSON:
+		default:
+			continue
+		}
+		if q > mejorQ {
+			mejor, mejorQ = tipo, q
+		}
+	}
+	return mejor
+}
+
+// traducirCuerpo reemplaza el cuerpo MessagePack o Protobuf de r por su
+// equivalente JSON. Si no puede, devuelve el status y el error.
+func traducirCuerpo(w http.ResponseWriter, r *http.Request, tipo string, mensaje func() proto.Message) (int, ErrorResponse) {
+	if tipo == tipoProtobuf && mensaje == nil {
+		return http.StatusUnsupportedMediaType, ErrorResponse{Error: "El endpoint no acepta " + tipoProtobuf, Codigo: "FORMATO_NO_SOPORTADO"}
+	}
+	datos, err := io.ReadAll(http.MaxBytesReader(w, r.Body, tamanoMaximoCuerpo))
+	if err != nil {
+		errCuerpo := describirErrorJSON(err)
+		return errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo}
+	}
+
+	var cuerpo []byte
+	if tipo == tipoProtobuf {
+		m := mensaje()
+		if err := proto.Unmarshal(datos, m); err != nil {
+			return http.StatusBadRequest, ErrorResponse{Error: "Protobuf mal formado", Codigo: "CUERPO_MAL_FORMADO"}
+		}
+		cuerpo, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	} else {
+		var v any
+		if err := msgpack.Unmarshal(datos, &v); err != nil {
+			return http.StatusBadRequest, ErrorResponse{Error: "MessagePack mal formado", Codigo: "CUERPO_MAL_FORMADO"}
+		}
+		cuerpo, err = json.Marshal(v)
+	}
+	if err != nil {
+		return http.StatusBadRequest, ErrorResponse{Error: "Cuerpo inválido", Codigo: "CUERPO_INVALIDO"}
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(cuerpo))
+	r.ContentLength = int64(len(cuerpo))
+	r.Header.Set("Content-Type", tipoJSON)
+	return 0, ErrorResponse{}
+}
+
+// respuestaNegociada guarda la respuesta JSON del handler para
+// traducirla al formato pedido al terminar.
+type respuestaNegociada struct {
+	http.ResponseWriter
+	status int
+	cuerpo bytes.Buffer
+}
+
+func (rn *respuestaNegociada) WriteHeader(status int) {
+	if rn.status == 0 {
+		rn.status = status
+	}
+}
+
+func (rn *respuestaNegociada) Write(b []byte) (int, error) {
+	rn.WriteHeader(http.StatusOK)
+	return rn.cuerpo.Write(b)
+}
+
+// enviar traduce y escribe la respuesta guardada. Las respuestas que no
+// son JSON, y las que no se pueden traducir, se envían tal cual.
+// MessagePack lleva el mismo sobre que JSON; Protobuf, sólo su contenido,
+// y los errores usan el mensaje Error.
+func (rn *respuestaNegociada) enviar(r *http.Request, formato string, mensaje func() proto.Message) {
+	status := cmp.Or(rn.status, http.StatusOK)
+	datos := rn.cuerpo.Bytes()
+	h := rn.ResponseWriter.Header()
+
+	tipo, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if len(datos) > 0 && (tipo == tipoJSON || tipo == "") {
+		var traducido []byte
+		var err error
+		if formato == tipoProtobuf {
+			if status >= http.StatusBadRequest {
+				mensaje = func() proto.Message { return &usuariospb.Error{} }
+			}
+			m := mensaje()
+			var contenido []byte
+			if contenido, err = desenvolverSobre(datos); err == nil {
+				if err = (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(contenido, m); err == nil {
+					traducido, err = proto.Marshal(m)
+				}
+			}
+		} else {
+			traducido, err = jsonAMsgpack(datos)
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error traduciendo la respuesta", "formato", formato, "error", err)
+		} else {
+			datos = traducido
+			h.Set("Content-Type", formato)
+			h.Del("Content-Length")
+		}
+	}
+
+	rn.ResponseWriter.WriteHeader(status)
+	rn.ResponseWriter.Write(datos)
+}
+
+// jsonAMsgpack traduce un documento JSON a MessagePack, conservando los
+// números enteros como enteros.
+func jsonAMsgpack(datos []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(datos))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(enterosMsgpack(v))
+}
+
+// enterosMsgpack reemplaza los json.Number por int64 o float64.
+func enterosMsgpack(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, e := range v {
+			v[k] = enterosMsgpack(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = enterosMsgpack(e)
+		}
+	}
+	return v
+}
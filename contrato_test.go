@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// Las pruebas de contrato recorren la API por HTTP, con el router real, y
+// validan cada petición y cada respuesta contra la especificación que
+// sirve /openapi.json, con kin-openapi. Fallan si un handler responde un
+// status que no está documentado, un campo que falta o sobra, o un tipo
+// distinto del del esquema, y si queda un endpoint documentado sin
+// ejercitar.
+
+// sinContrato son los endpoints documentados que la prueba no ejercita,
+// con el motivo.
+var sinContrato = map[string]string{
+	"GET /eventos": "responde un stream de Server-Sent Events que no termina",
+}
+
+// contrato es un servidor de prueba cuyas peticiones y respuestas se
+// validan contra la especificación.
+type contrato struct {
+	t      *testing.T
+	srv    *httptest.Server
+	router routers.Router
+	// cubiertos son los endpoints ejercitados, con el patrón de
+	// documentacionAPI, y los status que respondieron.
+	cubiertos map[string][]int
+}
+
+// nuevoContrato levanta el router en un servidor de prueba y carga la
+// especificación. Los esquemas de los objetos se cierran con
+// additionalProperties: false, para que un campo sin documentar en una
+// respuesta también haga fallar la prueba.
+func nuevoContrato(t *testing.T) *contrato {
+	t.Helper()
+	prepararHandlers(t)
+	mensajesEnviados(t)
+	// La prueba registra varias cuentas desde la misma IP.
+	t.Setenv("LIMITE_REGISTRO_IP", "100/1h")
+
+	srv := httptest.NewServer(requestIDMiddleware(recuperacionMiddleware(nuevoRouter())))
+	t.Cleanup(srv.Close)
+
+	d, err := documentoOpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := openapi3.NewLoader().LoadFromData(d.json)
+	if err != nil {
+		t.Fatalf("especificación ilegible: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("especificación inválida: %v", err)
+	}
+	doc.Servers = openapi3.Servers{{URL: srv.URL}}
+	for _, esquema := range doc.Components.Schemas {
+		if esquema.Value.Type.Is(openapi3.TypeObject) && esquema.Value.AdditionalProperties.Schema == nil {
+			esquema.Value.AdditionalProperties.Has = openapi3.Ptr(false)
+		}
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &contrato{t: t, srv: srv, router: router, cubiertos: map[string][]int{}}
+}
+
+// peticion envía una petición JSON, valida la petición y la respuesta
+// contra la especificación, verifica el status y devuelve el cuerpo.
+func (c *contrato) peticion(metodo, ruta, token, cuerpo string, status int) []byte {
+	c.t.Helper()
+	req, err := http.NewRequest(metodo, c.srv.URL+ruta, strings.NewReader(cuerpo))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if cuerpo != "" {
+		req.Header.Set("Content-Type", tipoJSON)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	ruteo, parametros, err := c.router.FindRoute(req)
+	if err != nil {
+		c.t.Fatalf("%s %s no está en la especificación: %v", metodo, ruta, err)
+	}
+	entrada := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: parametros,
+		Route:      ruteo,
+		Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+	}
+	ctx := context.Background()
+	// Las peticiones que esperan un 400 pueden ser inválidas a propósito.
+	if err := openapi3filter.ValidateRequest(ctx, entrada); err != nil && status != http.StatusBadRequest {
+		c.t.Errorf("%s %s: la petición no cumple la especificación: %v", metodo, ruta, err)
+	}
+	req.Body = io.NopCloser(strings.NewReader(cuerpo))
+
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", metodo, ruta, err)
+	}
+	defer resp.Body.Close()
+	respuesta, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", metodo, ruta, err)
+	}
+	if resp.StatusCode != status {
+		c.t.Errorf("%s %s: status %d, se esperaba %d: %s", metodo, ruta, resp.StatusCode, status, respuesta)
+	}
+	if err := openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: entrada,
+		Status:                 resp.StatusCode,
+		Header:                 resp.Header,
+		Body:                   io.NopCloser(bytes.NewReader(respuesta)),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	}); err != nil {
+		c.t.Errorf("%s %s: la respuesta %d no cumple la especificación: %v", metodo, ruta, resp.StatusCode, err)
+	}
+
+	patron := metodo + " " + strings.TrimPrefix(ruteo.Path, prefijoAPI)
+	c.cubiertos[patron] = append(c.cubiertos[patron], resp.StatusCode)
+	return respuesta
+}
+
+// decodificar decodifica el data de una respuesta JSON ya validada.
+func (c *contrato) decodificar(respuesta []byte, destino any) {
+	c.t.Helper()
+	var sobre struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(respuesta, &sobre); err != nil {
+		c.t.Fatalf("respuesta %s: %v", respuesta, err)
+	}
+	if err := json.Unmarshal(sobre.Data, destino); err != nil {
+		c.t.Fatalf("respuesta %s: %v", respuesta, err)
+	}
+}
+
+// login inicia sesión y devuelve el token.
+func (c *contrato) login(correo, password string) string {
+	c.t.Helper()
+	var sesion LoginResponse
+	c.decodificar(c.peticion(http.MethodPost, prefijoAPI+"/login", "", fmt.Sprintf(`{"correo":%q,"password":%q}`, correo, password), http.StatusOK), &sesion)
+	return sesion.Token
+}
+
+func TestContratoOpenAPI(t *testing.T) {
+	c := nuevoContrato(t)
+	api := func(ruta string) string { return prefijoAPI + ruta }
+
+	t.Run("cuenta", func(t *testing.T) {
+		c.t = t
+		correo, telefono := cuentaNueva()
+		registro := fmt.Sprintf(`{"correo":%q,"telefono":%q,"password":"Secreta@123"}`, correo, telefono)
+		c.peticion(http.MethodPost, api("/registro"), "", registro, http.StatusCreated)
+		c.peticion(http.MethodPost, api("/registro"), "", registro, http.StatusConflict)
+		c.peticion(http.MethodPost, api("/registro"), "", `{"correo":"no-es-correo","telefono":"123","password":"simple"}`, http.StatusBadRequest)
+		c.peticion(http.MethodPost, api("/registro"), "", `{"correo":`, http.StatusBadRequest)
+		c.peticion(http.MethodPost, api("/login"), "", fmt.Sprintf(`{"correo":%q,"password":"Otra@1234"}`, correo), http.StatusUnauthorized)
+		token := c.login(correo, "Secreta@123")
+		c.peticion(http.MethodPost, api("/login/codigo-sms"), "", fmt.Sprintf(`{"correo":%q,"password":"Otra@1234"}`, correo), http.StatusUnauthorized)
+		c.peticion(http.MethodPost, api("/login/codigo-sms"), "", fmt.Sprintf(`{"correo":%q,"password":"Secreta@123"}`, correo), http.StatusConflict)
+		c.peticion(http.MethodPost, api("/login/federado/codigo"), "", `{"token_pendiente":"invalido"}`, http.StatusBadRequest)
+		c.peticion(http.MethodPost, api("/login/federado/codigo"), "", `{"token_pendiente":"invalido","codigo":"000000"}`, http.StatusUnauthorized)
+
+		c.peticion(http.MethodGet, api("/verificar-correo?token=invalido"), "", "", http.StatusBadRequest)
+		c.peticion(http.MethodPost, api("/verificar-correo/reenviar"), "", fmt.Sprintf(`{"correo":%q}`, correo), http.StatusAccepted)
+		c.peticion(http.MethodPost, api("/verificar-telefono/enviar"), token, "", http.StatusAccepted)
+		c.peticion(http.MethodPost, api("/verificar-telefono"), token, `{"codigo":"000000"}`, http.StatusBadRequest)
+
+		c.peticion(http.MethodGet, api("/perfil"), token, "", http.StatusOK)
+		c.peticion(http.MethodGet, api("/perfil"), "", "", http.StatusUnauthorized)
+		_, otroTelefono := cuentaNueva()
+		c.peticion(http.MethodPut, api("/perfil"), token, fmt.Sprintf(`{"telefono":%q}`, otroTelefono), http.StatusOK)
+		c.peticion(http.MethodPut, api("/perfil"), token, `{"idioma":"en"}`, http.StatusOK)
+		c.peticion(http.MethodPut, api("/perfil"), token, `{"idioma":"fr"}`, http.StatusBadRequest)
+		c.peticion(http.MethodGet, api("/perfil/exportar"), token, "", http.StatusOK)
+		c.peticion(http.MethodGet, api("/perfil/notificaciones"), token, "", http.StatusOK)
+		c.peticion(http.MethodPut, api("/perfil/notificaciones"), token, `{"boletines":["correo"]}`, http.StatusOK)
+		c.peticion(http.MethodPut, api("/perfil/notificaciones"), token, `{"boletines":["paloma"]}`, http.StatusBadRequest)
+		c.peticion(http.MethodPut, api("/perfil/notificaciones"), token, `{"alertas_login":["sms"]}`, http.StatusConflict)
+		c.peticion(http.MethodGet, api("/perfil/sesiones?limit=1"), token, "", http.StatusOK)
+		c.peticion(http.MethodGet, api("/perfil/sesiones?cursor=invalido"), token, "", http.StatusBadRequest)
+
+		c.peticion(http.MethodPost, api("/2fa/codigos-respaldo"), token, `{"codigo":"000000"}`, http.StatusConflict)
+		c.peticion(http.MethodPost, api("/2fa/activar"), token, "", http.StatusOK)
+		c.peticion(http.MethodPost, api("/2fa/confirmar"), token, `{"codigo":"000000"}`, http.StatusUnauthorized)
+
+		c.peticion(http.MethodPost, api("/password/cambiar"), token, `{"password_actual":"Otra@1234","password_nueva":"Nueva@1234"}`, http.StatusUnauthorized)
+		correoNuevo, _ := cuentaNueva()
+		c.peticion(http.MethodPost, api("/correo/cambiar"), token, fmt.Sprintf(`{"correo_nuevo":%q}`, correoNuevo), http.StatusAccepted)
+		c.peticion(http.MethodGet, api("/correo/confirmar?token=invalido"), "", "", http.StatusBadRequest)
+		c.peticion(http.MethodGet, api("/sesiones/revocar?token=invalido"), "", "", http.StatusBadRequest)
+
+		c.peticion(http.MethodGet, api("/admin/usuarios"), token, "", http.StatusForbidden)
+		c.peticion(http.MethodDelete, api("/cuenta"), token, `{"password":"Secreta@123"}`, http.StatusNoContent)
+		c.peticion(http.MethodGet, api("/perfil"), token, "", http.StatusUnauthorized)
+	})
+
+	t.Run("administración", func(t *testing.T) {
+		c.t = t
+		token := c.login("admin@example.com", "Admin1@")
+		c.peticion(http.MethodGet, api("/admin/usuarios?estado=activa&orden=-fecha_registro&limit=5"), token, "", http.StatusOK)
+		c.peticion(http.MethodGet, api("/admin/usuarios?orden=telefono"), token, "", http.StatusBadRequest)
+		c.peticion(http.MethodGet, api("/admin/usuarios/buscar?q=example"), token, "", http.StatusOK)
+
+		correo, telefono := cuentaNueva()
+		var usuario UsuarioAdminResponse
+		c.decodificar(c.peticion(http.MethodPost, api("/admin/usuarios"), token,
+			fmt.Sprintf(`{"correo":%q,"telefono":%q,"password":"Secreta@123"}`, correo, telefono), http.StatusCreated), &usuario)
+		c.peticion(http.MethodGet, api("/admin/usuarios/"+usuario.ID), token, "", http.StatusOK)
+		c.peticion(http.MethodGet, api("/admin/usuarios/inexistente"), token, "", http.StatusNotFound)
+		c.peticion(http.MethodPost, api("/admin/usuarios/"+usuario.ID+"/revocar-tokens"), token, "", http.StatusOK)
+		c.peticion(http.MethodPost, api("/admin/usuarios/"+usuario.ID+"/forzar-cambio-password"), token, "", http.StatusOK)
+		c.peticion(http.MethodPut, api("/admin/usuarios/"+usuario.ID+"/estado"), token, `{"estado":"suspendida"}`, http.StatusOK)
+		c.peticion(http.MethodPut, api("/admin/usuarios/"+usuario.ID+"/estado"), token, `{"estado":"bloqueada"}`, http.StatusBadRequest)
+
+		c.peticion(http.MethodGet, api("/admin/auditoria?tipo=usuario_creado&limit=5"), token, "", http.StatusOK)
+		c.peticion(http.MethodPost, api("/admin/config/recargar"), token, "", http.StatusOK)
+		c.peticion(http.MethodGet, api("/admin/flags"), token, "", http.StatusOK)
+		c.peticion(http.MethodPut, api("/admin/flags/inexistente"), token, `{"activa":true}`, http.StatusNotFound)
+		c.peticion(http.MethodGet, api("/admin/tareas/fallidas"), token, "", http.StatusOK)
+		c.peticion(http.MethodPost, api("/admin/tareas/fallidas/inexistente/reintentar"), token, "", http.StatusNotFound)
+		c.peticion(http.MethodGet, api("/admin/correos-invalidos"), token, "", http.StatusOK)
+		c.peticion(http.MethodDelete, api("/admin/correos-invalidos/nadie@ejemplo.com"), token, "", http.StatusNotFound)
+	})
+
+	c.t = t
+	for patron := range documentacionAPI {
+		if _, ok := sinContrato[patron]; !ok && c.cubiertos[patron] == nil {
+			t.Errorf("%s está documentado pero la prueba de contrato no lo ejercita", patron)
+		}
+	}
+	for patron, status := range c.cubiertos {
+		slices.Sort(status)
+		t.Logf("%s: %v", patron, slices.Compact(status))
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// mensajeCorreo es un correo listo para entregarse: Cuerpo es el texto
+// plano y HTML, si no está vacío, la versión alternativa en HTML.
+type mensajeCorreo struct {
+	Destinatario string
+	Asunto       string
+	Cuerpo       string
+	HTML         string
+	// Headers son headers adicionales, como los de correlación.
+	Headers map[string]string
+}
+
+// remitenteCorreo entrega correos a un proveedor. Reemplazar remitente
+// cambia el proveedor sin tocar a quienes envían correos. Los errores
+// que el proveedor considera definitivos se devuelven como permanentes,
+// para que la tarea no se reintente.
+type remitenteCorreo interface {
+	enviar(ctx context.Context, m mensajeCorreo) error
+}
+
+// remitente es el proveedor con el que se entregan los correos; main lo
+// reemplaza al arrancar por el de CORREO_PROVEEDOR.
+var remitente remitenteCorreo = remitenteConsola{}
+
+// Proveedores de correo de CORREO_PROVEEDOR.
+const (
+	proveedorCorreoConsola  = "consola"
+	proveedorCorreoSMTP     = "smtp"
+	proveedorCorreoSendGrid = "sendgrid"
+	proveedorCorreoSES      = "ses"
+)
+
+// ConfigCorreo define el proveedor con el que se entregan los correos, lo
+// que comparten todos los proveedores y las plantillas de los correos.
+type ConfigCorreo struct {
+	Proveedor  string
+	Remitente  *mail.Address
+	Timeout    time.Duration
+	Plantillas map[string]map[string]plantillaCorreo
+}
+
+// cargarConfigCorreo lee CORREO_PROVEEDOR (consola, smtp, sendgrid o ses;
+// por defecto smtp si está SMTP_HOST y, si no, consola), CORREO_REMITENTE
+// (dirección From, p. ej. "StratPlus <no-responder@ejemplo.com>";
+// obligatoria salvo con consola), CORREO_TIMEOUT (plazo para entregar
+// cada correo, por defecto 30s) y CORREO_PLANTILLAS (directorio con
+// plantillas que reemplazan a las embebidas de la misma ruta, como
+// bienvenida.txt o en/bienvenida.txt).
+func cargarConfigCorreo() (ConfigCorreo, error) {
+	cfg := ConfigCorreo{Proveedor: strings.ToLower(opcion("CORREO_PROVEEDOR")), Timeout: 30 * time.Second}
+	switch cfg.Proveedor {
+	case "":
+		cfg.Proveedor = proveedorCorreoConsola
+		if opcion("SMTP_HOST") != "" {
+			cfg.Proveedor = proveedorCorreoSMTP
+		}
+	case proveedorCorreoConsola, proveedorCorreoSMTP, proveedorCorreoSendGrid, proveedorCorreoSES:
+	default:
+		return cfg, fmt.Errorf("CORREO_PROVEEDOR=%q: debe ser consola, smtp, sendgrid o ses", cfg.Proveedor)
+	}
+	if v := opcion("CORREO_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("CORREO_TIMEOUT=%q: debe ser una duración positiva, p. ej. 30s", v)
+		}
+		cfg.Timeout = d
+	}
+	var err error
+	if cfg.Plantillas, err = cargarPlantillasCorreo(opcion("CORREO_PLANTILLAS")); err != nil {
+		return cfg, fmt.Errorf("CORREO_PLANTILLAS=%q: %v", opcion("CORREO_PLANTILLAS"), err)
+	}
+	if cfg.Proveedor == proveedorCorreoConsola {
+		return cfg, nil
+	}
+	v := opcion("CORREO_REMITENTE")
+	if v == "" {
+		return cfg, fmt.Errorf("CORREO_PROVEEDOR=%s requiere CORREO_REMITENTE, la dirección From de los correos", cfg.Proveedor)
+	}
+	direccion, err := mail.ParseAddress(v)
+	if err != nil {
+		return cfg, fmt.Errorf("CORREO_REMITENTE=%q: %v", v, err)
+	}
+	cfg.Remitente = direccion
+	return cfg, nil
+}
+
+// nuevoRemitenteCorreo crea el remitente del proveedor, que lee además
+// su propia configuración (ver cargarConfigSMTP, cargarConfigSendGrid y
+// cargarConfigSES).
+func nuevoRemitenteCorreo(ctx context.Context, cfg ConfigCorreo) (remitenteCorreo, error) {
+	switch cfg.Proveedor {
+	case proveedorCorreoSMTP:
+		smtp, err := cargarConfigSMTP()
+		if err != nil {
+			return nil, err
+		}
+		return remitenteSMTP{correo: cfg, cfg: smtp}, nil
+	case proveedorCorreoSendGrid:
+		sendgrid, err := cargarConfigSendGrid()
+		if err != nil {
+			return nil, err
+		}
+		return nuevoRemitenteSendGrid(cfg, sendgrid), nil
+	case proveedorCorreoSES:
+		ses, err := nuevoRemitenteSES(ctx, cfg, cargarConfigSES())
+		if err != nil {
+			return nil, err
+		}
+		return ses, nil
+	}
+	return remitenteConsola{}, nil
+}
+
+// politicaCorreo devuelve los reintentos del proveedor de correo.
+func politicaCorreo() PoliticaReintentos {
+	return politicaProveedor(remitente)
+}
+
+// remitenteConsola escribe los correos en la salida estándar, para
+// desarrollo.
+type remitenteConsola struct{}
+
+func (remitenteConsola) enviar(_ context.Context, m mensajeCorreo) error {
+	var headers strings.Builder
+	for _, clave := range slices.Sorted(maps.Keys(m.Headers)) {
+		fmt.Fprintf(&headers, "%s: %s\n", clave, m.Headers[clave])
+	}
+	fmt.Printf("Correo para %s\nAsunto: %s\n%s\n%s\n", m.Destinatario, m.Asunto, headers.String(), m.Cuerpo)
+	return nil
+}
+
+// enviarCorreo entrega un correo con el remitente configurado. El mensaje
+// lleva como headers los metadatos de correlación de ctx.
+var enviarCorreo = func(ctx context.Context, m mensajeCorreo) error {
+	ctx, span := iniciarSpan(ctx, "correo.enviar", attribute.String("correo.asunto", m.Asunto))
+	defer span.End()
+
+	m.Headers = metadatosCorrelacion(ctx)
+	return remitente.enviar(ctx, m)
+}
+
+// datosCorreo son los datos de una tarea de envío de correo, ya armado.
+type datosCorreo struct {
+	Destinatario string `json:"destinatario"`
+	Asunto       string `json:"asunto"`
+	Cuerpo       string `json:"cuerpo"`
+	HTML         string `json:"html,omitempty"`
+}
+
+// encolarCorreo arma el correo con la plantilla del idioma y los datos
+// (ver componerCorreo) y lo envía en segundo plano, con reintentos, para no
+// demorar la petición. Devuelve error si la plantilla falla, si no se
+// pudo encolar o, sin enviarlo, si el destinatario está marcado como
+// inválido (ver correosInvalidos).
+func encolarCorreo(ctx context.Context, destinatario, idioma, plantilla string, datos any) error {
+	if correosInvalidos.invalido(destinatario) {
+		return errCorreoInvalido
+	}
+	m, err := componerCorreo(destinatario, idioma, plantilla, datos)
+	if err != nil {
+		return err
+	}
+	return tareas.encolar(ctx, tareaCorreo, datosCorreo{Destinatario: m.Destinatario, Asunto: m.Asunto, Cuerpo: m.Cuerpo, HTML: m.HTML})
+}
+
+// ejecutarTareaCorreo envía el correo de una tarea.
+func ejecutarTareaCorreo(ctx context.Context, datos json.RawMessage) error {
+	var d datosCorreo
+	if err := json.Unmarshal(datos, &d); err != nil {
+		return permanente(err)
+	}
+	return enviarCorreo(ctx, mensajeCorreo{Destinatario: d.Destinatario, Asunto: d.Asunto, Cuerpo: d.Cuerpo, HTML: d.HTML})
+}
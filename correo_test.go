@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCargarConfigCorreo(t *testing.T) {
+	casos := []struct {
+		nombre string
+		env    map[string]string
+		error  string
+	}{
+		{"proveedor desconocido", map[string]string{"CORREO_PROVEEDOR": "mailgun"}, "CORREO_PROVEEDOR"},
+		{"sin remitente", map[string]string{"CORREO_PROVEEDOR": "sendgrid"}, "CORREO_REMITENTE"},
+		{"remitente inválido", map[string]string{"CORREO_PROVEEDOR": "ses", "CORREO_REMITENTE": "no-es-correo"}, "CORREO_REMITENTE"},
+		{"timeout inválido", map[string]string{"CORREO_TIMEOUT": "0s"}, "CORREO_TIMEOUT"},
+		{"plantillas en un archivo", map[string]string{"CORREO_PLANTILLAS": "correo_test.go"}, "CORREO_PLANTILLAS"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			for nombre, valor := range c.env {
+				t.Setenv(nombre, valor)
+			}
+			if _, err := cargarConfigCorreo(); err == nil || !strings.Contains(err.Error(), c.error) {
+				t.Errorf("error %v, se esperaba uno sobre %s", err, c.error)
+			}
+		})
+	}
+
+	t.Run("smtp por defecto con SMTP_HOST", func(t *testing.T) {
+		t.Setenv("SMTP_HOST", "smtp.ejemplo.com")
+		t.Setenv("CORREO_REMITENTE", "StratPlus <no-responder@ejemplo.com>")
+		cfg, err := cargarConfigCorreo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Proveedor != proveedorCorreoSMTP || cfg.Remitente.Address != "no-responder@ejemplo.com" || cfg.Timeout != 30*time.Second {
+			t.Errorf("configuración %+v, se esperaba SMTP con el remitente y 30s", cfg)
+		}
+	})
+
+	t.Run("consola sin configuración", func(t *testing.T) {
+		t.Setenv("SMTP_HOST", "")
+		cfg, err := cargarConfigCorreo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, _ := nuevoRemitenteCorreo(t.Context(), cfg); r != (remitenteConsola{}) {
+			t.Errorf("remitente %T, se esperaba la consola", r)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+)
+
+// listaDesechables es la lista de dominios de correo temporal incluida en
+// el binario.
+//
+//go:embed dominios_desechables.txt
+var listaDesechables string
+
+// leerDominiosDesechables interpreta una lista con un dominio por línea.
+// Se ignoran las líneas vacías y las que empiezan con #.
+func leerDominiosDesechables(lista string) map[string]bool {
+	dominios := map[string]bool{}
+	for _, linea := range strings.Split(lista, "\n") {
+		linea = strings.ToLower(strings.TrimSpace(linea))
+		if linea != "" && !strings.HasPrefix(linea, "#") {
+			dominios[linea] = true
+		}
+	}
+	return dominios
+}
+
+// cargarDominiosDesechables arma la lista de dominios bloqueados: la de
+// CORREO_DESECHABLES_ARCHIVO si está definido, o si no la incluida en el
+// binario, más los dominios de CORREO_DESECHABLES_EXTRA, separados por
+// coma.
+func cargarDominiosDesechables() (map[string]bool, error) {
+	dominios := maps.Clone(reglasCorreoPorDefecto.DominiosDesechables)
+	if ruta := opcion("CORREO_DESECHABLES_ARCHIVO"); ruta != "" {
+		contenido, err := os.ReadFile(ruta)
+		if err != nil {
+			return nil, fmt.Errorf("CORREO_DESECHABLES_ARCHIVO=%q: %w", ruta, err)
+		}
+		dominios = leerDominiosDesechables(string(contenido))
+	}
+	for _, d := range strings.Split(opcion("CORREO_DESECHABLES_EXTRA"), ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			dominios[d] = true
+		}
+	}
+	return dominios, nil
+}
+
+// correoDesechable indica si el dominio del correo, o alguno de sus
+// dominios padre, está en la lista de dominios desechables vigente.
+func correoDesechable(correo string) bool {
+	reglas := reglasCorreoVigentes()
+	arroba := strings.LastIndex(correo, "@")
+	if arroba < 0 {
+		return false
+	}
+	dominio := strings.ToLower(correo[arroba+1:])
+	for {
+		if reglas.DominiosDesechables[dominio] {
+			return true
+		}
+		_, padre, ok := strings.Cut(dominio, ".")
+		if !ok {
+			return false
+		}
+		dominio = padre
+	}
+}
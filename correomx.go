@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resultadoMX es una consulta de registros MX guardada en cache.
+type resultadoMX struct {
+	tieneMX bool
+	vence   time.Time
+}
+
+// cacheMX recuerda por dominio si tiene registros MX, para no repetir la
+// consulta DNS en cada registro.
+type cacheMX struct {
+	mu         sync.Mutex
+	resultados map[string]resultadoMX
+	resolver   *net.Resolver
+}
+
+// consultasMX es la cache de consultas MX del servicio.
+var consultasMX = &cacheMX{resultados: map[string]resultadoMX{}, resolver: net.DefaultResolver}
+
+// correoSinMX indica si, con CORREO_VERIFICAR_MX activo, el dominio del
+// correo no tiene registros MX que acepten correo. Si la consulta falla
+// por timeout u otro error del servidor DNS el correo se acepta, para que
+// una caída del DNS no impida registrarse; esos errores no se guardan en
+// la cache.
+func correoSinMX(ctx context.Context, correo string) bool {
+	reglas := reglasCorreoVigentes()
+	if !reglas.VerificarMX {
+		return false
+	}
+	dominio := correo[strings.LastIndex(correo, "@")+1:]
+	tieneMX, err := consultasMX.consultar(ctx, dominio, reglas.TimeoutMX, reglas.VigenciaMX)
+	if err != nil {
+		slog.WarnContext(ctx, "No se pudieron consultar los registros MX", "dominio", dominio, "error", err)
+		return false
+	}
+	return !tieneMX
+}
+
+// consultar devuelve si el dominio tiene registros MX, desde la cache si
+// la consulta anterior sigue vigente. Un dominio inexistente, sin
+// registros MX o con un MX nulo (RFC 7505) no acepta correo.
+func (c *cacheMX) consultar(ctx context.Context, dominio string, timeout, vigencia time.Duration) (bool, error) {
+	ahora := time.Now()
+	c.mu.Lock()
+	r, ok := c.resultados[dominio]
+	c.mu.Unlock()
+	if ok && ahora.Before(r.vence) {
+		return r.tieneMX, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	registros, err := c.resolver.LookupMX(ctx, dominio)
+	var errDNS *net.DNSError
+	if err != nil && !(errors.As(err, &errDNS) && errDNS.IsNotFound) {
+		return false, err
+	}
+	tieneMX := false
+	for _, mx := range registros {
+		if mx.Host != "." {
+			tieneMX = true
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for d, r := range c.resultados {
+		if !ahora.Before(r.vence) {
+			delete(c.resultados, d)
+		}
+	}
+	c.resultados[dominio] = resultadoMX{tieneMX: tieneMX, vence: ahora.Add(vigencia)}
+	return tieneMX, nil
+}
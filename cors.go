@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ConfigCORS define qué orígenes, métodos y headers pueden usar la API
+// desde un navegador en otro origen.
+type ConfigCORS struct {
+	Origenes       []string
+	Metodos        []string
+	Headers        []string
+	Expuestos      []string
+	Credenciales   bool
+	MaxAgeSegundos int
+}
+
+// cargarConfigCORS lee la configuración CORS de las variables de entorno
+// CORS_ORIGENES, CORS_METODOS, CORS_HEADERS, CORS_HEADERS_EXPUESTOS
+// (separadas por coma), CORS_CREDENCIALES y CORS_MAX_AGE. Sin
+// CORS_ORIGENES no se permite ningún origen externo.
+func cargarConfigCORS() ConfigCORS {
+	cfg := ConfigCORS{
+		Origenes:       listaEntorno("CORS_ORIGENES", nil),
+		Metodos:        listaEntorno("CORS_METODOS", []string{"GET", "POST", "PUT", "DELETE"}),
+		Headers:        listaEntorno("CORS_HEADERS", []string{"Authorization", "Content-Type", headerIdempotencia}),
+		Expuestos:      listaEntorno("CORS_HEADERS_EXPUESTOS", []string{"WWW-Authenticate", "Idempotent-Replayed", headerRequestID, "Retry-After"}),
+		Credenciales:   opcion("CORS_CREDENCIALES") == "true",
+		MaxAgeSegundos: 600,
+	}
+	if v, err := strconv.Atoi(opcion("CORS_MAX_AGE")); err == nil && v >= 0 {
+		cfg.MaxAgeSegundos = v
+	}
+	return cfg
+}
+
+// listaEntorno lee una variable de entorno con valores separados por coma.
+func listaEntorno(nombre string, porDefecto []string) []string {
+	v := opcion(nombre)
+	if v == "" {
+		return porDefecto
+	}
+	var lista []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			lista = append(lista, p)
+		}
+	}
+	return lista
+}
+
+// origenPermitido indica si el origen está en la lista (o si se permite "*").
+func (c ConfigCORS) origenPermitido(origen string) bool {
+	return slices.Contains(c.Origenes, "*") || slices.Contains(c.Origenes, origen)
+}
+
+// corsMiddleware agrega los headers CORS a las respuestas de orígenes
+// permitidos y responde directamente las peticiones preflight OPTIONS,
+// antes de que lleguen al router.
+func corsMiddleware(cfg ConfigCORS) func(http.Handler) http.Handler {
+	metodos := strings.Join(cfg.Metodos, ", ")
+	headers := strings.Join(cfg.Headers, ", ")
+	expuestos := strings.Join(cfg.Expuestos, ", ")
+	maxAge := strconv.Itoa(cfg.MaxAgeSegundos)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origen := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if origen == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
+			if !cfg.origenPermitido(origen) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Con credenciales el navegador no acepta "*", así que se
+			// refleja el origen concreto.
+			if slices.Contains(cfg.Origenes, "*") && !cfg.Credenciales {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origen)
+			}
+			if cfg.Credenciales {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", metodos)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if expuestos != "" {
+				w.Header().Set("Access-Control-Expose-Headers", expuestos)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
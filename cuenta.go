@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// EliminarCuentaRequest define la estructura esperada para la petición
+// DELETE /cuenta.
+type EliminarCuentaRequest struct {
+	Password string `json:"password"`
+}
+
+// eliminarCuentaHandler borra la cuenta del usuario autenticado tras
+// confirmar su contraseña. Los usuarios federados, que no tienen
+// contraseña local, quedan cubiertos por la re-autenticación reciente
+// que exige sensible.
+func eliminarCuentaHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	var req EliminarCuentaRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+	if usuario.Password != "" {
+		if req.Password == "" {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo password", Codigo: "CAMPO_REQUERIDO"})
+			return
+		}
+		if req.Password != usuario.Password {
+			escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Contraseña incorrecta", Codigo: "PASSWORD_INCORRECTA"})
+			return
+		}
+	}
+
+	auditar(r, "cuenta_eliminada", usuario.Correo, "", "")
+	revocarTokens(r, usuario, "cuenta_eliminada")
+	slog.InfoContext(r.Context(), "Cuenta eliminada correctamente", "correo", usuario.Correo)
+	eliminarUsuario(usuario.Correo)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// tamanoMaximoCuerpo es el tamaño máximo aceptado para el cuerpo JSON de
+// las peticiones públicas; los datos de registro y login caben de sobra.
+const tamanoMaximoCuerpo = 64 << 10
+
+// errorCuerpo describe por qué se rechazó el cuerpo de una petición y con
+// qué status debe responderse.
+type errorCuerpo struct {
+	status  int
+	codigo  string
+	mensaje string
+}
+
+// decodificarJSON decodifica el cuerpo en destino de forma estricta:
+// limita su tamaño, rechaza campos desconocidos y exige un único objeto
+// JSON. Devuelve nil si el cuerpo es válido.
+func decodificarJSON(w http.ResponseWriter, r *http.Request, destino any) *errorCuerpo {
+	r.Body = http.MaxBytesReader(w, r.Body, tamanoMaximoCuerpo)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(destino); err != nil {
+		return describirErrorJSON(err)
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var errTamano *http.MaxBytesError
+		if errors.As(err, &errTamano) {
+			return describirErrorJSON(err)
+		}
+		return &errorCuerpo{http.StatusBadRequest, "CUERPO_INVALIDO", "El cuerpo debe contener un único objeto JSON"}
+	}
+	return nil
+}
+
+// describirErrorJSON traduce un error de decodificación a un mensaje
+// claro para el cliente.
+func describirErrorJSON(err error) *errorCuerpo {
+	var errTamano *http.MaxBytesError
+	var errSintaxis *json.SyntaxError
+	var errTipo *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &errTamano):
+		return &errorCuerpo{http.StatusRequestEntityTooLarge, "CUERPO_DEMASIADO_GRANDE",
+			fmt.Sprintf("El cuerpo excede el tamaño máximo de %d KB", tamanoMaximoCuerpo>>10)}
+	case errors.Is(err, io.EOF):
+		return &errorCuerpo{http.StatusBadRequest, "CUERPO_VACIO", "El cuerpo está vacío"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &errorCuerpo{http.StatusBadRequest, "CUERPO_MAL_FORMADO", "JSON mal formado: el cuerpo está incompleto"}
+	case errors.As(err, &errSintaxis):
+		return &errorCuerpo{http.StatusBadRequest, "CUERPO_MAL_FORMADO",
+			fmt.Sprintf("JSON mal formado en la posición %d", errSintaxis.Offset)}
+	case errors.As(err, &errTipo):
+		return &errorCuerpo{http.StatusBadRequest, "TIPO_INVALIDO",
+			fmt.Sprintf("Tipo inválido en el campo %q", errTipo.Field)}
+	}
+	if campo, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return &errorCuerpo{http.StatusBadRequest, "CAMPO_DESCONOCIDO", "Campo desconocido " + campo}
+	}
+	return &errorCuerpo{http.StatusBadRequest, "CUERPO_INVALIDO", "Cuerpo inválido"}
+}
+
+// capacidadMaximaBufferJSON es el tamaño desde el que un buffer de
+// bufferesJSON no se devuelve al pool, para que una respuesta grande
+// ocasional (un listado o una exportación) no quede retenida en memoria.
+const capacidadMaximaBufferJSON = 64 << 10
+
+// bufferJSON es un buffer con un encoder que escribe en él. Van juntos
+// porque json.Encoder no se puede redirigir a otro writer.
+type bufferJSON struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+// bufferesJSON reutiliza los buffers de las respuestas JSON entre
+// peticiones, para no asignar un encoder y un buffer nuevos en cada una
+// de las rutas más concurridas (login, registro y errores de
+// autenticación y de límite de peticiones).
+var bufferesJSON = sync.Pool{New: func() any {
+	b := &bufferJSON{}
+	b.enc = json.NewEncoder(&b.buf)
+	return b
+}}
+
+// escribirJSON responde status con v codificado en JSON. Codifica
+// primero en un buffer del pool, por lo que la respuesta lleva
+// Content-Length y, si v no se puede codificar, no se envía nada y se
+// devuelve el error.
+func escribirJSON(w http.ResponseWriter, status int, v any) error {
+	return escribirJSONComo(w, status, tipoJSON, false, v)
+}
+
+// escribirJSONComo es escribirJSON con otro Content-Type, como
+// application/problem+json o el de SCIM, y, si indentar es true, con el
+// JSON indentado para leerlo a mano.
+func escribirJSONComo(w http.ResponseWriter, status int, tipo string, indentar bool, v any) error {
+	b := bufferesJSON.Get().(*bufferJSON)
+	defer func() {
+		if b.buf.Cap() <= capacidadMaximaBufferJSON {
+			b.buf.Reset()
+			bufferesJSON.Put(b)
+		}
+	}()
+	if indentar {
+		b.enc.SetIndent("", "  ")
+		defer b.enc.SetIndent("", "")
+	}
+	if err := b.enc.Encode(v); err != nil {
+		return err
+	}
+	h := w.Header()
+	h.Set("Content-Type", tipo)
+	w.WriteHeader(status)
+	_, err := w.Write(b.buf.Bytes())
+	return err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pruebasgo/testutil"
+)
+
+// FuzzDecodificarJSON busca cuerpos que provoquen un panic o que se
+// acepten sin ser un único objeto JSON con campos conocidos:
+//
+//	go test -run '^$' -fuzz FuzzDecodificarJSON .
+func FuzzDecodificarJSON(f *testing.F) {
+	for _, semilla := range []string{
+		`{"correo":"ana@ejemplo.com","telefono":"5512345678","password":"Secreta@123"}`,
+		`{"correo":"ana@ejemplo.com","admin":true}`, `{"correo":5}`, `{"correo":"a"`, `{}{}`, `[]`, `null`, ``,
+		`{"CORREO":"ana@ejemplo.com"}`, `{"correo":"a","correo":"b"}`, " {\n} ", `"texto"`,
+	} {
+		f.Add(semilla)
+	}
+	f.Fuzz(func(t *testing.T, cuerpo string) {
+		var req RegistroRequest
+		r := httptest.NewRequest(http.MethodPost, "/registro", strings.NewReader(cuerpo))
+		errCuerpo := decodificarJSON(httptest.NewRecorder(), r, &req)
+		if errCuerpo != nil {
+			if errCuerpo.status != http.StatusBadRequest && errCuerpo.status != http.StatusRequestEntityTooLarge {
+				t.Fatalf("cuerpo %q rechazado con status %d", cuerpo, errCuerpo.status)
+			}
+			if errCuerpo.mensaje == "" {
+				t.Fatalf("cuerpo %q rechazado sin mensaje", cuerpo)
+			}
+			return
+		}
+
+		// encoding/json acepta null como un objeto vacío y compara los
+		// nombres de los campos sin distinguir mayúsculas.
+		var campos map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(cuerpo), &campos); err != nil {
+			t.Fatalf("cuerpo %q aceptado sin ser un objeto JSON: %v", cuerpo, err)
+		}
+		for nombre := range campos {
+			if !strings.EqualFold(nombre, "correo") && !strings.EqualFold(nombre, "telefono") && !strings.EqualFold(nombre, "password") {
+				t.Fatalf("cuerpo %q aceptado con el campo desconocido %q", cuerpo, nombre)
+			}
+		}
+	})
+}
+
+func TestCuerpoDemasiadoGrande(t *testing.T) {
+	handler := routerConcurrente(t)
+	_, token := testutil.Handler(handler).UsuarioConToken(t)
+	cuerpo := `{"relleno":"` + strings.Repeat("a", tamanoMaximoCuerpo) + `"}`
+
+	for _, ruta := range []struct{ metodo, ruta string }{
+		{http.MethodPut, "/perfil"},
+		{http.MethodPost, "/password/cambiar"},
+		{http.MethodPost, "/correo/cambiar"},
+		{http.MethodPost, "/2fa/confirmar"},
+		{http.MethodPost, "/verificar-telefono"},
+		{http.MethodPost, "/verificar-correo/reenviar"},
+		{http.MethodDelete, "/cuenta"},
+	} {
+		w := enviar(handler, ruta.metodo, ruta.ruta, token, cuerpo)
+		if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "CUERPO_DEMASIADO_GRANDE") {
+			t.Errorf("%s %s: status %d, se esperaba %d: %.200s", ruta.metodo, ruta.ruta, w.Code, http.StatusRequestEntityTooLarge, w.Body)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parámetros del segundo factor TOTP (RFC 6238) y de los códigos de respaldo.
+const (
+	emisorTOTP             = "StratPlus"
+	periodoTOTP            = 30
+	digitosTOTP            = 6
+	totalCodigosRespaldo   = 10
+	longitudCodigoRespaldo = 10
+)
+
+// codificacionSecreto es la codificación base32 sin padding que esperan
+// las apps autenticadoras.
+var codificacionSecreto = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// CodigoRequest define la estructura esperada para los endpoints de 2FA
+// que reciben un código de verificación.
+type CodigoRequest struct {
+	Codigo string `json:"codigo"`
+}
+
+// ActivarDosFAResponse contiene el secreto TOTP para configurar la app
+// autenticadora.
+type ActivarDosFAResponse struct {
+	Secreto string `json:"secreto"`
+	URL     string `json:"url"`
+}
+
+// CodigosRespaldoResponse contiene los códigos de respaldo en claro; sólo
+// se muestran una vez, el servidor guarda únicamente su hash.
+type CodigosRespaldoResponse struct {
+	CodigosRespaldo []string `json:"codigos_respaldo"`
+}
+
+// activarDosFAHandler genera un nuevo secreto TOTP pendiente de confirmar.
+func activarDosFAHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	if usuario.DosFAActivo {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "El segundo factor ya está activo", Codigo: "DOSFA_YA_ACTIVO"})
+		return
+	}
+
+	secreto := make([]byte, 20)
+	if _, err := rand.Read(secreto); err != nil {
+		escribirJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error generando secreto", Codigo: "ERROR_INTERNO"})
+		return
+	}
+	usuario.SecretoTOTP, usuario.UltimoPasoTOTP = codificacionSecreto.EncodeToString(secreto), 0
+
+	etiqueta := url.PathEscape(emisorTOTP + ":" + usuario.Correo)
+	params := url.Values{"secret": {usuario.SecretoTOTP}, "issuer": {emisorTOTP}}
+	escribirJSON(w, http.StatusOK, ActivarDosFAResponse{
+		Secreto: usuario.SecretoTOTP,
+		URL:     "otpauth://totp/" + etiqueta + "?" + params.Encode(),
+	})
+}
+
+// confirmarDosFAHandler activa el segundo factor tras validar el primer
+// código TOTP y entrega los códigos de respaldo iniciales.
+func confirmarDosFAHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	var req CodigoRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+	if req.Codigo == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo codigo", Codigo: "CAMPO_REQUERIDO"})
+		return
+	}
+	if usuario.SecretoTOTP == "" || usuario.DosFAActivo {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "No hay una activación de segundo factor pendiente", Codigo: "DOSFA_SIN_ACTIVACION"})
+		return
+	}
+	if !verificarTOTP(usuario, req.Codigo, time.Now()) {
+		escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Código de verificación inválido", Codigo: "CODIGO_INVALIDO"})
+		return
+	}
+
+	codigos, err := generarCodigosRespaldo(usuario)
+	if err != nil {
+		escribirJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error generando códigos de respaldo", Codigo: "ERROR_INTERNO"})
+		return
+	}
+	usuario.DosFAActivo = true
+	registrarEvento(usuario, "dos_fa_activado")
+	auditar(r, "dos_fa_activado", usuario.Correo, "", "")
+	slog.InfoContext(r.Context(), "Segundo factor activado", "correo", usuario.Correo)
+	escribirJSON(w, http.StatusOK, CodigosRespaldoResponse{CodigosRespaldo: codigos})
+}
+
+// regenerarCodigosHandler invalida los códigos de respaldo existentes y
+// entrega un juego nuevo. Exige un código TOTP vigente.
+func regenerarCodigosHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	var req CodigoRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+	if req.Codigo == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo codigo", Codigo: "CAMPO_REQUERIDO"})
+		return
+	}
+	if !usuario.DosFAActivo {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "El segundo factor no está activo", Codigo: "DOSFA_INACTIVO"})
+		return
+	}
+	if !verificarTOTP(usuario, req.Codigo, time.Now()) {
+		escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Código de verificación inválido", Codigo: "CODIGO_INVALIDO"})
+		return
+	}
+
+	codigos, err := generarCodigosRespaldo(usuario)
+	if err != nil {
+		escribirJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error generando códigos de respaldo", Codigo: "ERROR_INTERNO"})
+		return
+	}
+	registrarEvento(usuario, "codigos_respaldo_regenerados")
+	auditar(r, "codigos_respaldo_regenerados", usuario.Correo, "", "")
+	slog.InfoContext(r.Context(), "Códigos de respaldo regenerados", "correo", usuario.Correo)
+	escribirJSON(w, http.StatusOK, CodigosRespaldoResponse{CodigosRespaldo: codigos})
+}
+
+// verificarSegundoFactor acepta un código TOTP vigente, un código de
+// respaldo sin usar o el código enviado por SMS (ver
+// enviarCodigoLoginHandler); los dos últimos se consumen al validarse.
+func verificarSegundoFactor(usuario *Usuario, codigo string) bool {
+	if verificarTOTP(usuario, codigo, time.Now()) {
+		return true
+	}
+	hash := hashCodigoRespaldo(codigo)
+	for i, h := range usuario.CodigosRespaldo {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			usuario.CodigosRespaldo = append(usuario.CodigosRespaldo[:i], usuario.CodigosRespaldo[i+1:]...)
+			registrarEvento(usuario, "codigo_respaldo_usado")
+			return true
+		}
+	}
+	return verificarCodigoLogin(usuario, codigo)
+}
+
+// verificarTOTP valida el código contra el paso actual y los adyacentes
+// para tolerar pequeñas diferencias de reloj. Cada código sirve una sola
+// vez: se rechazan los pasos hasta el último aceptado, que se registra en
+// el usuario. Se llama con el usuario bloqueado.
+func verificarTOTP(usuario *Usuario, codigo string, ahora time.Time) bool {
+	clave, err := codificacionSecreto.DecodeString(usuario.SecretoTOTP)
+	if err != nil || len(codigo) != digitosTOTP {
+		return false
+	}
+	paso := ahora.Unix() / periodoTOTP
+	for _, desfase := range []int64{-1, 0, 1} {
+		if paso+desfase <= usuario.UltimoPasoTOTP {
+			continue
+		}
+		esperado := calcularTOTP(clave, uint64(paso+desfase))
+		if subtle.ConstantTimeCompare([]byte(esperado), []byte(codigo)) == 1 {
+			usuario.UltimoPasoTOTP = paso + desfase
+			return true
+		}
+	}
+	return false
+}
+
+// calcularTOTP obtiene el código HOTP (RFC 4226) para el contador dado.
+func calcularTOTP(clave []byte, contador uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], contador)
+	mac := hmac.New(sha1.New, clave)
+	mac.Write(msg[:])
+	suma := mac.Sum(nil)
+
+	desplazamiento := suma[len(suma)-1] & 0x0f
+	valor := binary.BigEndian.Uint32(suma[desplazamiento:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digitosTOTP, valor%1000000)
+}
+
+// generarCodigosRespaldo reemplaza los códigos de respaldo del usuario y
+// devuelve los nuevos en claro con formato xxxxx-xxxxx.
+func generarCodigosRespaldo(usuario *Usuario) ([]string, error) {
+	codigos := make([]string, 0, totalCodigosRespaldo)
+	hashes := make([]string, 0, totalCodigosRespaldo)
+	for i := 0; i < totalCodigosRespaldo; i++ {
+		b := make([]byte, longitudCodigoRespaldo*5/8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		c := strings.ToLower(codificacionSecreto.EncodeToString(b))
+		c = c[:longitudCodigoRespaldo/2] + "-" + c[longitudCodigoRespaldo/2:]
+		codigos = append(codigos, c)
+		hashes = append(hashes, hashCodigoRespaldo(c))
+	}
+	usuario.CodigosRespaldo = hashes
+	return codigos, nil
+}
+
+// hashCodigoRespaldo normaliza el código (sin guiones ni mayúsculas) y
+// devuelve su hash SHA-256 en hexadecimal.
+func hashCodigoRespaldo(codigo string) string {
+	normalizado := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(codigo), "-", ""))
+	suma := sha256.Sum256([]byte(normalizado))
+	return hex.EncodeToString(suma[:])
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// rutaDotenvPorDefecto es el .env que se busca en el directorio de
+// trabajo.
+const rutaDotenvPorDefecto = ".env"
+
+// cargarDotenv lee un archivo .env (líneas VARIABLE=valor) y recuerda su
+// ruta para recargarlo.
+func (f *fuentesConfig) cargarDotenv(ruta string) error {
+	valores, err := godotenv.Read(ruta)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dotenv, f.rutaDotenv = valores, ruta
+	return nil
+}
+
+// cargarDotenvDev carga, sólo con el perfil dev, el archivo indicado en
+// ENV_ARCHIVO o, si no está definido, el .env del directorio de trabajo.
+// Sus valores quedan por debajo de las variables de entorno reales, de
+// modo que exportar una variable sigue reemplazando al .env. Que falte el
+// .env por defecto no es un error. Devuelve la ruta leída, o "" si no se
+// leyó ninguna.
+func cargarDotenvDev() (string, error) {
+	if strings.ToLower(opcion("PERFIL")) != perfilDev {
+		return "", nil
+	}
+	ruta, explicita := buscarOpcion("ENV_ARCHIVO")
+	if !explicita || ruta == "" {
+		ruta = rutaDotenvPorDefecto
+	}
+	err := fuentes.cargarDotenv(ruta)
+	if errors.Is(err, fs.ErrNotExist) && !explicita {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return ruta, nil
+}
@@ -0,0 +1,12 @@
+// Package e2e contiene las pruebas end-to-end del servicio: compilan el
+// binario, lo arrancan en un puerto aleatorio con el perfil dev y
+// recorren escenarios completos con un cliente HTTP real, como lo haría
+// un cliente de la API. Llevan la build tag e2e:
+//
+//	go test -tags e2e ./e2e/
+//
+// Con E2E_URL se prueba un servidor ya levantado en lugar de arrancar
+// uno, por ejemplo el de un entorno de staging. Los escenarios de
+// administración necesitan las cuentas de ejemplo de DATOS_SEED y se
+// omiten si no existen.
+package e2e
@@ -0,0 +1,305 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pruebasgo/testutil"
+)
+
+// servidor es la URL base del servidor bajo prueba.
+var servidor string
+
+// prefijoAPI es el prefijo de versión de los endpoints.
+const prefijoAPI = "/api/v1"
+
+func TestMain(m *testing.M) {
+	servidor = strings.TrimSuffix(os.Getenv("E2E_URL"), "/")
+	var detener func(fallo bool) error
+	if servidor == "" {
+		var err error
+		if servidor, detener, err = arrancarServidor(); err != nil {
+			fmt.Fprintln(os.Stderr, "e2e:", err)
+			os.Exit(1)
+		}
+	}
+	codigo := m.Run()
+	if detener != nil {
+		if err := detener(codigo != 0); err != nil {
+			fmt.Fprintln(os.Stderr, "e2e:", err)
+			codigo = 1
+		}
+	}
+	os.Exit(codigo)
+}
+
+// arrancarServidor compila el servicio y lo arranca con el perfil dev en
+// un puerto libre de 127.0.0.1, en un directorio temporal para que no
+// lea el .env ni el archivo de configuración del repositorio. Devuelve
+// su URL cuando /readyz responde 200, y la función que lo detiene con
+// SIGINT y espera a que termine de apagarse. Los logs del servidor
+// quedan en ese directorio, que se borra salvo que alguna prueba falle.
+func arrancarServidor() (string, func(fallo bool) error, error) {
+	dir, err := os.MkdirTemp("", "pruebasgo-e2e-")
+	if err != nil {
+		return "", nil, err
+	}
+	binario := filepath.Join(dir, "pruebasgo")
+	if salida, err := exec.Command("go", "build", "-o", binario, "..").CombinedOutput(); err != nil {
+		return "", nil, fmt.Errorf("no se pudo compilar el servicio: %v\n%s", err, salida)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	direccion := l.Addr().String()
+	l.Close()
+
+	rutaLogs := filepath.Join(dir, "servidor.log")
+	logs, err := os.Create(rutaLogs)
+	if err != nil {
+		return "", nil, err
+	}
+	cmd := exec.Command(binario)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "PERFIL=dev", "DIRECCIONES="+direccion, "LOG_NIVEL=info",
+		// Todas las peticiones llegan desde 127.0.0.1.
+		"LIMITE_REGISTRO_IP=1000/1h", "LIMITE_LOGIN_IP=1000/1m", "LIMITE_LOGIN_CUENTA=1000/1m")
+	cmd.Stdout, cmd.Stderr = logs, logs
+	if err := cmd.Start(); err != nil {
+		return "", nil, err
+	}
+	terminado := make(chan error, 1)
+	go func() { terminado <- cmd.Wait() }()
+
+	base := "http://" + direccion
+	if err := esperarListo(base, terminado); err != nil {
+		cmd.Process.Kill()
+		return "", nil, fmt.Errorf("%w; logs en %s", err, rutaLogs)
+	}
+
+	detener := func(fallo bool) error {
+		cmd.Process.Signal(os.Interrupt)
+		var err error
+		select {
+		case err = <-terminado:
+		case <-time.After(15 * time.Second):
+			cmd.Process.Kill()
+			err = errors.New("el servidor no terminó 15s después de SIGINT")
+		}
+		logs.Close()
+		if err != nil || fallo {
+			fmt.Fprintln(os.Stderr, "e2e: logs del servidor en", rutaLogs)
+		} else {
+			os.RemoveAll(dir)
+		}
+		if err != nil {
+			return fmt.Errorf("apagado del servidor: %w", err)
+		}
+		return nil
+	}
+	return base, detener, nil
+}
+
+// esperarListo espera a que /readyz responda 200 o a que el proceso
+// termine antes de tiempo.
+func esperarListo(base string, terminado <-chan error) error {
+	limite := time.After(30 * time.Second)
+	for {
+		if resp, err := http.Get(base + "/readyz"); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		select {
+		case err := <-terminado:
+			return fmt.Errorf("el servidor terminó al arrancar: %v", err)
+		case <-limite:
+			return errors.New("el servidor no estuvo listo en 30s")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// cliente llama a la API como un cliente real, con su propio pool de
+// conexiones y, una vez iniciada la sesión, con el token.
+type cliente struct {
+	t     *testing.T
+	http  *http.Client
+	token string
+}
+
+func nuevoCliente(t *testing.T) *cliente {
+	return &cliente{t: t, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// enviar envía cuerpo, si no es nil, como JSON y decodifica en destino,
+// si no es nil, el data del sobre de la respuesta o, si falló, el error.
+// Devuelve el status.
+func (c *cliente) enviar(metodo, ruta string, cuerpo, destino any) int {
+	c.t.Helper()
+	var datos io.Reader
+	if cuerpo != nil {
+		b, err := json.Marshal(cuerpo)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		datos = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(metodo, servidor+prefijoAPI+ruta, datos)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if cuerpo != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", metodo, ruta, err)
+	}
+	defer resp.Body.Close()
+	respuesta, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", metodo, ruta, err)
+	}
+	if destino != nil && len(respuesta) > 0 {
+		var sobre struct {
+			Data  json.RawMessage `json:"data"`
+			Error json.RawMessage `json:"error"`
+		}
+		err := json.Unmarshal(respuesta, &sobre)
+		if err == nil {
+			contenido := sobre.Data
+			if resp.StatusCode >= http.StatusBadRequest {
+				contenido = sobre.Error
+			}
+			err = json.Unmarshal(contenido, destino)
+		}
+		if err != nil {
+			c.t.Fatalf("%s %s: respuesta %d inválida: %v: %s", metodo, ruta, resp.StatusCode, err, respuesta)
+		}
+	}
+	return resp.StatusCode
+}
+
+// esperar envía la petición y falla si el status no es el esperado.
+func (c *cliente) esperar(status int, metodo, ruta string, cuerpo, destino any) {
+	c.t.Helper()
+	var fallo struct {
+		Mensaje string `json:"mensaje"`
+	}
+	if destino == nil {
+		destino = &fallo
+	}
+	if recibido := c.enviar(metodo, ruta, cuerpo, destino); recibido != status {
+		c.t.Fatalf("%s %s: status %d, se esperaba %d %s", metodo, ruta, recibido, status, fallo.Mensaje)
+	}
+}
+
+// iniciarSesion hace login y guarda el token en el cliente.
+func (c *cliente) iniciarSesion(correo, password string) {
+	c.t.Helper()
+	var sesion struct {
+		Token string `json:"token"`
+	}
+	c.esperar(http.StatusOK, http.MethodPost, "/login", map[string]string{"correo": correo, "password": password}, &sesion)
+	if sesion.Token == "" {
+		c.t.Fatal("login sin token")
+	}
+	c.token = sesion.Token
+}
+
+// registrarCuenta registra una cuenta nueva con datos aleatorios de
+// testutil.
+func registrarCuenta(t *testing.T) testutil.Usuario {
+	t.Helper()
+	u := testutil.NuevoUsuario()
+	testutil.Servidor(servidor).Registrar(t, u)
+	return u
+}
+
+func TestRegistroLoginPerfil(t *testing.T) {
+	u := registrarCuenta(t)
+	c := nuevoCliente(t)
+
+	c.esperar(http.StatusConflict, http.MethodPost, "/registro", map[string]string{
+		"correo": u.Correo, "telefono": "5599999999", "password": u.Password,
+	}, nil)
+	c.esperar(http.StatusUnauthorized, http.MethodPost, "/login", map[string]string{"correo": u.Correo, "password": "Otra@1234"}, nil)
+	c.esperar(http.StatusUnauthorized, http.MethodGet, "/perfil", nil, nil)
+
+	c.iniciarSesion(u.Correo, u.Password)
+	var perfil struct {
+		ID     string `json:"id"`
+		Correo string `json:"correo"`
+	}
+	c.esperar(http.StatusOK, http.MethodGet, "/perfil", nil, &perfil)
+	if perfil.ID == "" || perfil.Correo != u.Correo {
+		t.Errorf("perfil %+v, se esperaba el de %s", perfil, u.Correo)
+	}
+}
+
+func TestCambioDePasswordCierraLasSesiones(t *testing.T) {
+	u := registrarCuenta(t)
+	web, movil := nuevoCliente(t), nuevoCliente(t)
+	web.iniciarSesion(u.Correo, u.Password)
+	movil.iniciarSesion(u.Correo, u.Password)
+
+	web.esperar(http.StatusOK, http.MethodPost, "/password/cambiar", map[string]string{
+		"password_actual": u.Password, "password_nueva": "Nueva@1234",
+	}, nil)
+	web.esperar(http.StatusUnauthorized, http.MethodGet, "/perfil", nil, nil)
+	movil.esperar(http.StatusUnauthorized, http.MethodGet, "/perfil", nil, nil)
+
+	movil.esperar(http.StatusUnauthorized, http.MethodPost, "/login", map[string]string{"correo": u.Correo, "password": u.Password}, nil)
+	movil.iniciarSesion(u.Correo, "Nueva@1234")
+	movil.esperar(http.StatusOK, http.MethodGet, "/perfil", nil, nil)
+}
+
+func TestRevocacionPorAdministrador(t *testing.T) {
+	admin := nuevoCliente(t)
+	var sesion struct {
+		Token string `json:"token"`
+	}
+	if admin.enviar(http.MethodPost, "/login", map[string]string{"correo": "admin@example.com", "password": "Admin1@"}, &sesion) != http.StatusOK {
+		t.Skip("el servidor no tiene la cuenta de ejemplo admin@example.com (DATOS_SEED)")
+	}
+	admin.token = sesion.Token
+
+	u := registrarCuenta(t)
+	usuario := nuevoCliente(t)
+	usuario.iniciarSesion(u.Correo, u.Password)
+
+	var encontrados []struct {
+		ID string `json:"id"`
+	}
+	admin.esperar(http.StatusOK, http.MethodGet, "/admin/usuarios/buscar?q="+url.QueryEscape(u.Correo), nil, &encontrados)
+	if len(encontrados) != 1 {
+		t.Fatalf("la búsqueda de %s devolvió %d usuarios", u.Correo, len(encontrados))
+	}
+	usuario.esperar(http.StatusForbidden, http.MethodPost, "/admin/usuarios/"+encontrados[0].ID+"/revocar-tokens", nil, nil)
+	admin.esperar(http.StatusOK, http.MethodPost, "/admin/usuarios/"+encontrados[0].ID+"/revocar-tokens", nil, nil)
+
+	usuario.esperar(http.StatusUnauthorized, http.MethodGet, "/perfil", nil, nil)
+	usuario.iniciarSesion(u.Correo, u.Password)
+	usuario.esperar(http.StatusOK, http.MethodGet, "/perfil", nil, nil)
+}
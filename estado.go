@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// EstadoCuenta representa el ciclo de vida de una cuenta.
+type EstadoCuenta string
+
+// Estados posibles de una cuenta. Una cuenta suspendida puede
+// reactivarse; una eliminada conserva el registro pero no puede usarse.
+const (
+	estadoActiva     EstadoCuenta = "activa"
+	estadoSuspendida EstadoCuenta = "suspendida"
+	estadoEliminada  EstadoCuenta = "eliminada"
+)
+
+// CambiarEstadoRequest define la estructura esperada para la petición
+// del endpoint /admin/usuarios/{id}/estado.
+type CambiarEstadoRequest struct {
+	Estado EstadoCuenta `json:"estado"`
+}
+
+// cambiarEstadoHandler permite a un administrador suspender, reactivar o
+// dar de baja (soft delete) la cuenta {id}. Al salir del estado activa se
+// revocan los tokens del usuario.
+func cambiarEstadoHandler(w http.ResponseWriter, r *http.Request) {
+	var req CambiarEstadoRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+	if req.Estado != estadoActiva && req.Estado != estadoSuspendida && req.Estado != estadoEliminada {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Estado inválido", Codigo: "ESTADO_INVALIDO"})
+		return
+	}
+
+	usuario := buscarUsuarioPorID(r.PathValue("id"))
+	if usuario == nil {
+		escribirJSON(w, http.StatusNotFound, ErrorResponse{Error: "Usuario no encontrado", Codigo: "USUARIO_NO_ENCONTRADO"})
+		return
+	}
+	defer usuario.bloquear()()
+	if usuario.Correo == correoAutenticado(r) {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "No puedes cambiar el estado de tu propia cuenta", Codigo: "CUENTA_PROPIA"})
+		return
+	}
+	if usuario.Estado == estadoEliminada {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "La cuenta fue eliminada", Codigo: "CUENTA_ELIMINADA"})
+		return
+	}
+
+	usuario.Estado = req.Estado
+	registrarEvento(usuario, "estado_"+string(req.Estado))
+	auditar(r, "estado_cambiado", correoAutenticado(r), usuario.Correo, string(req.Estado))
+	if req.Estado != estadoActiva {
+		revocarTokens(r, usuario, "estado_"+string(req.Estado))
+	}
+	if req.Estado == estadoSuspendida {
+		webhooks.publicar(r, eventoUsuarioBloqueado, usuario)
+	}
+	slog.InfoContext(r.Context(), "Estado de cuenta actualizado", "correo", usuario.Correo, "estado", req.Estado)
+	escribirJSON(w, http.StatusOK, nuevoUsuarioAdminResponse(usuario))
+}
+
+// rechazarCuentaInactiva responde 403 con un código específico si la
+// cuenta no está activa. Devuelve true si respondió.
+func rechazarCuentaInactiva(w http.ResponseWriter, r *http.Request, usuario *Usuario) bool {
+	errServicio := errorCuentaInactiva(r, usuario)
+	if errServicio == nil {
+		return false
+	}
+	responderErrorServicio(w, errServicio)
+	return true
+}
+
+// errorCuentaInactiva devuelve un error 403 con un código específico si
+// la cuenta no está activa, o nil.
+func errorCuentaInactiva(r *http.Request, usuario *Usuario) *errorServicio {
+	switch usuario.Estado {
+	case estadoActiva:
+		return nil
+	case estadoSuspendida:
+		slog.WarnContext(r.Context(), "Intento de acceso a cuenta suspendida", "correo", usuario.Correo)
+		return &errorServicio{status: http.StatusForbidden, respuesta: ErrorResponse{Error: "La cuenta está suspendida", Codigo: "CUENTA_SUSPENDIDA"}}
+	default:
+		slog.WarnContext(r.Context(), "Intento de acceso a cuenta eliminada", "correo", usuario.Correo)
+		return &errorServicio{status: http.StatusForbidden, respuesta: ErrorResponse{Error: "La cuenta fue eliminada", Codigo: "CUENTA_ELIMINADA"}}
+	}
+}
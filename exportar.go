@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// ExportacionResponse reúne todos los datos personales almacenados de un
+// usuario. No incluye secretos (contraseña, secreto TOTP ni hashes de
+// códigos), que no son datos del usuario sino credenciales.
+type ExportacionResponse struct {
+	PerfilResponse
+	Estado                   EstadoCuenta             `json:"estado"`
+	Admin                    bool                     `json:"admin"`
+	FechaRegistro            time.Time                `json:"fecha_registro"`
+	CodigosRespaldoRestantes int                      `json:"codigos_respaldo_restantes"`
+	CorreoPendiente          string                   `json:"correo_pendiente,omitempty"`
+	Notificaciones           PreferenciasNotificacion `json:"notificaciones"`
+	Sesiones                 []Sesion                 `json:"sesiones"`
+	Eventos                  []EventoCuenta           `json:"eventos"`
+	FechaExportacion         time.Time                `json:"fecha_exportacion"`
+}
+
+// exportarDatosHandler devuelve en JSON todos los datos del usuario
+// autenticado. Con ?descargar=true se entrega como archivo adjunto.
+func exportarDatosHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	resp := ExportacionResponse{
+		PerfilResponse:           nuevoPerfilResponse(usuario),
+		Estado:                   usuario.Estado,
+		Admin:                    usuario.Admin,
+		FechaRegistro:            usuario.FechaRegistro,
+		CodigosRespaldoRestantes: len(usuario.CodigosRespaldo),
+		CorreoPendiente:          usuario.CorreoPendiente,
+		Notificaciones:           nuevasPreferenciasNotificacion(usuario),
+		Sesiones:                 append([]Sesion{}, usuario.Sesiones...),
+		Eventos:                  append([]EventoCuenta{}, usuario.Eventos...),
+		FechaExportacion:         time.Now(),
+	}
+	registrarEvento(usuario, "datos_exportados")
+
+	if r.URL.Query().Get("descargar") == "true" {
+		w.Header().Set("Content-Disposition", `attachment; filename="mis-datos.json"`)
+	}
+	escribirJSONComo(w, http.StatusOK, tipoJSON, true, resp)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Feature flags que se evalúan en cada petición.
+const (
+	flagRegistroAbierto     = "registro_abierto"
+	flagVerificacionCorreo  = "verificacion_correo"
+	flagDosFAObligatorio    = "dosfa_obligatorio"
+	flagBloquearDesechables = "bloquear_desechables"
+)
+
+// flagsConocidas lista las feature flags en el orden en que se muestran.
+var flagsConocidas = []string{flagRegistroAbierto, flagVerificacionCorreo, flagDosFAObligatorio, flagBloquearDesechables}
+
+// claveFlagsRedis es el hash de Redis con los valores de las flags,
+// indexado por su nombre.
+const claveFlagsRedis = "feature_flags"
+
+// Origen del valor de una flag.
+const (
+	origenFlagRedis   = "redis"
+	origenFlagConfig  = "config"
+	origenFlagDefecto = "defecto"
+)
+
+// featureFlags evalúa las flags contra la configuración (FLAG_<NOMBRE>,
+// que se puede recargar en caliente) y, si se eligió el backend Redis,
+// primero contra el hash claveFlagsRedis, que se comparte entre
+// instancias y se cambia sin recargar nada.
+type featureFlags struct {
+	redis *redis.Client
+}
+
+// funcionalidades son las feature flags del servicio.
+var funcionalidades = &featureFlags{}
+
+// nuevasFeatureFlags lee FLAGS_BACKEND (config, por defecto, o redis; el
+// backend Redis usa REDIS_URL) y valida los valores FLAG_* de la
+// configuración.
+func nuevasFeatureFlags() (*featureFlags, error) {
+	if err := validarFlagsConfig(); err != nil {
+		return nil, err
+	}
+	switch backend := strings.ToLower(opcion("FLAGS_BACKEND")); backend {
+	case "", "config":
+		return &featureFlags{}, nil
+	case "redis":
+		url := opcion("REDIS_URL")
+		if url == "" {
+			return nil, errors.New("FLAGS_BACKEND=redis requiere REDIS_URL")
+		}
+		opciones, err := redis.ParseURL(url)
+		if err != nil {
+			return nil, err
+		}
+		return &featureFlags{redis: redis.NewClient(opciones)}, nil
+	default:
+		return nil, fmt.Errorf("FLAGS_BACKEND=%q: debe ser config o redis", backend)
+	}
+}
+
+// variableFlag es la opción de configuración que define la flag.
+func variableFlag(nombre string) string {
+	return "FLAG_" + strings.ToUpper(nombre)
+}
+
+// validarFlagsConfig comprueba que los valores FLAG_* definidos sean
+// booleanos.
+func validarFlagsConfig() error {
+	var errs []error
+	for _, nombre := range flagsConocidas {
+		if v := opcion(variableFlag(nombre)); v != "" {
+			if _, err := strconv.ParseBool(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s=%q: debe ser true o false", variableFlag(nombre), v))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// porDefectoFlag es el valor de la flag cuando nadie la define. La
+// verificación de correo conserva el valor de REQUIERE_CORREO_VERIFICADO.
+func porDefectoFlag(nombre string) bool {
+	switch nombre {
+	case flagRegistroAbierto, flagBloquearDesechables:
+		return true
+	case flagVerificacionCorreo:
+		return config.RequiereCorreoVerificado
+	}
+	return false
+}
+
+// activa indica si la flag está activa.
+func (f *featureFlags) activa(ctx context.Context, nombre string) bool {
+	valor, _ := f.evaluar(ctx, nombre)
+	return valor
+}
+
+// evaluar devuelve el valor de la flag y de dónde se tomó. Si Redis falla
+// o tiene un valor inválido se usa la configuración, para que una caída
+// de Redis no cambie el comportamiento del servicio.
+func (f *featureFlags) evaluar(ctx context.Context, nombre string) (bool, string) {
+	if f.redis != nil {
+		v, err := f.redis.HGet(ctx, claveFlagsRedis, nombre).Result()
+		switch {
+		case err == nil:
+			if valor, err := strconv.ParseBool(v); err == nil {
+				return valor, origenFlagRedis
+			}
+			slog.WarnContext(ctx, "Valor inválido de feature flag en Redis", "flag", nombre, "valor", v)
+		case !errors.Is(err, redis.Nil):
+			slog.ErrorContext(ctx, "Error consultando la feature flag en Redis", "flag", nombre, "error", err)
+		}
+	}
+	if v := opcion(variableFlag(nombre)); v != "" {
+		if valor, err := strconv.ParseBool(v); err == nil {
+			return valor, origenFlagConfig
+		}
+	}
+	return porDefectoFlag(nombre), origenFlagDefecto
+}
+
+// chequeos devuelve la verificación de readiness del backend Redis, si se
+// usa.
+func (f *featureFlags) chequeos() []chequeoListo {
+	if f.redis == nil {
+		return nil
+	}
+	return []chequeoListo{{nombre: "redis_flags", verificar: func(ctx context.Context) error {
+		return f.redis.Ping(ctx).Err()
+	}}}
+}
+
+// FlagResponse es el estado de una feature flag.
+type FlagResponse struct {
+	Nombre string `json:"nombre"`
+	Activa bool   `json:"activa"`
+	Origen string `json:"origen"`
+}
+
+// CambiarFlagRequest es el cuerpo de PUT /admin/flags/{nombre}.
+type CambiarFlagRequest struct {
+	Activa *bool `json:"activa"`
+}
+
+// listarFlagsHandler devuelve el valor vigente de cada feature flag.
+func listarFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := make([]FlagResponse, 0, len(flagsConocidas))
+	for _, nombre := range flagsConocidas {
+		activa, origen := funcionalidades.evaluar(r.Context(), nombre)
+		resp = append(resp, FlagResponse{Nombre: nombre, Activa: activa, Origen: origen})
+	}
+	escribirJSON(w, http.StatusOK, resp)
+}
+
+// cambiarFlagHandler activa o desactiva una feature flag en Redis. Con el
+// backend config responde 409: las flags se cambian en la configuración y
+// se aplican con una recarga.
+func cambiarFlagHandler(w http.ResponseWriter, r *http.Request) {
+	nombre := r.PathValue("nombre")
+	if !slices.Contains(flagsConocidas, nombre) {
+		escribirJSON(w, http.StatusNotFound, ErrorResponse{Error: "Feature flag no encontrada", Codigo: "FLAG_NO_ENCONTRADA"})
+		return
+	}
+	if funcionalidades.redis == nil {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "Las feature flags se definen en la configuración", Codigo: "FLAG_DE_CONFIGURACION"})
+		return
+	}
+
+	var req CambiarFlagRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+	if req.Activa == nil {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo activa", Codigo: "CAMPO_REQUERIDO"})
+		return
+	}
+
+	if err := funcionalidades.redis.HSet(r.Context(), claveFlagsRedis, nombre, strconv.FormatBool(*req.Activa)).Err(); err != nil {
+		slog.ErrorContext(r.Context(), "Error guardando la feature flag", "flag", nombre, "error", err)
+		escribirJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "No se pudo guardar la feature flag", Codigo: "FLAG_NO_GUARDADA"})
+		return
+	}
+	slog.InfoContext(r.Context(), "Feature flag cambiada", "flag", nombre, "activa", *req.Activa)
+	auditar(r, "flag_cambiada", correoAutenticado(r), "", fmt.Sprintf("%s=%t", nombre, *req.Activa))
+	escribirJSON(w, http.StatusOK, FlagResponse{Nombre: nombre, Activa: *req.Activa, Origen: origenFlagRedis})
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"pruebasgo/validacion"
+)
+
+// vigenciaTokenPendiente es cuánto dura el token con el que un usuario
+// con segundo factor completa un login federado.
+const vigenciaTokenPendiente = 5 * time.Minute
+
+// SegundoFactorPendienteResponse es la respuesta de un login federado de
+// una cuenta con el segundo factor activo: el token pendiente no sirve
+// como token de acceso, sólo para canjearlo junto con el código en POST
+// /login/federado/codigo.
+type SegundoFactorPendienteResponse struct {
+	TokenPendiente string `json:"token_pendiente"`
+	Mensaje        string `json:"mensaje"`
+}
+
+// CodigoFederadoRequest define la estructura esperada para la petición
+// POST /login/federado/codigo.
+type CodigoFederadoRequest struct {
+	TokenPendiente string `json:"token_pendiente"`
+	Codigo         string `json:"codigo"`
+}
+
+// usuarioFederado busca la cuenta con el correo dado y, si no existe, la
+// da de alta sin contraseña (sólo podrá entrar vía federación). Una
+// cuenta que ya existe sólo se devuelve si la dio de alta la federación
+// o SCIM: que el proveedor acredite el correo no prueba que quien entra
+// sea el dueño de una cuenta registrada con contraseña, así que con esas
+// devuelve nil.
+func usuarioFederado(correo string) (usuario *Usuario, nuevo bool) {
+	correo = validacion.NormalizarCorreo(correo)
+	if u := buscarUsuario(correo); u != nil {
+		return cuentaFederable(u), false
+	}
+	// El proveedor ya verificó el correo.
+	u := &Usuario{
+		ID:               nuevoID(),
+		Correo:           correo,
+		Origen:           origenFederado,
+		CorreoVerificado: true,
+		Admin:            esCorreoAdmin(correo),
+		Estado:           estadoActiva,
+		FechaRegistro:    time.Now(),
+	}
+	if insertarUsuario(u) != nil {
+		// Otra petición lo dio de alta entre la búsqueda y el alta.
+		if u := buscarUsuario(correo); u != nil {
+			return cuentaFederable(u), false
+		}
+		return nil, false
+	}
+	registrarEvento(u, "registro_federado")
+	return u, true
+}
+
+// cuentaFederable devuelve u si se puede entrar a ella con el login
+// federado, o nil si se registró con contraseña.
+func cuentaFederable(u *Usuario) *Usuario {
+	if u.Origen != origenFederado && u.Origen != origenSCIM {
+		return nil
+	}
+	return u
+}
+
+// loginFederado inicia la sesión de la cuenta del correo que acreditó el
+// proveedor (oidc o saml). Responde 409 si el correo es de una cuenta
+// registrada con contraseña (ver usuarioFederado) y, si la cuenta tiene
+// el segundo factor activo, 202 con un token pendiente en lugar del
+// token de acceso: el proveedor no acredita el segundo factor de la
+// cuenta.
+func loginFederado(w http.ResponseWriter, r *http.Request, correo, proveedor string) {
+	usuario, nuevo := usuarioFederado(correo)
+	if usuario == nil {
+		slog.WarnContext(r.Context(), "Login federado rechazado: el correo es de una cuenta local", "correo", correo, "proveedor", proveedor)
+		auditar(r, "login_fallido", correo, "", proveedor+": cuenta_local")
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "El correo es de una cuenta con contraseña", Codigo: "CUENTA_LOCAL"})
+		return
+	}
+	defer usuario.bloquear()()
+	if nuevo {
+		slog.InfoContext(r.Context(), "Usuario federado registrado correctamente", "correo", correo)
+		webhooks.publicar(r, eventoUsuarioRegistrado, usuario)
+		eventosDominio.publicar(r, eventoUsuarioRegistrado, usuario)
+	}
+	if rechazarCuentaInactiva(w, r, usuario) {
+		return
+	}
+
+	if usuario.DosFAActivo {
+		tokenPendiente, err := generarTokenPendiente(usuario)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error al generar el token", "error", err)
+			escribirJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error generando token", Codigo: "ERROR_INTERNO"})
+			return
+		}
+		slog.InfoContext(r.Context(), "Login federado pendiente del segundo factor", "correo", usuario.Correo, "proveedor", proveedor)
+		escribirJSON(w, http.StatusAccepted, SegundoFactorPendienteResponse{
+			TokenPendiente: tokenPendiente,
+			Mensaje:        "Completa el inicio de sesión con el código de verificación",
+		})
+		return
+	}
+	emitirTokenFederado(w, r, usuario, []string{"fed"}, proveedor)
+}
+
+// emitirTokenFederado responde igual que /login con un token de acceso
+// para usuario, ya bloqueado, y registra la sesión.
+func emitirTokenFederado(w http.ResponseWriter, r *http.Request, usuario *Usuario, amr []string, detalle string) {
+	sesion := nuevoID()
+	tokenString, err := generarToken(usuario, amr, sesion)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error al generar el token", "error", err)
+		escribirJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error generando token", Codigo: "ERROR_INTERNO"})
+		return
+	}
+	registrarSesion(usuario, r, amr, sesion)
+	auditar(r, "login_exitoso", usuario.Correo, "", detalle)
+
+	escribirJSON(w, http.StatusOK, LoginResponse{
+		Token:       tokenString,
+		FechaInicio: time.Now(),
+	})
+}
+
+// generarTokenPendiente firma el token con el que usuario completa el
+// login federado con su segundo factor. Lleva el claim pendiente, con el
+// que validarToken lo rechaza como token de acceso, y la versión de los
+// tokens del usuario, para que revocarlos también lo invalide.
+func generarTokenPendiente(usuario *Usuario) (string, error) {
+	ahora := relojTokens.ahora()
+	claims := jwt.MapClaims{
+		"sub":       usuario.ID,
+		"ver":       usuario.VersionToken,
+		"exp":       ahora.Add(vigenciaTokenPendiente).Unix(),
+		"amr":       []string{"fed"},
+		"pendiente": "dosfa",
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(claves.firma())
+}
+
+// validarTokenPendiente verifica la firma y expiración de un token de
+// generarTokenPendiente y devuelve sus claims.
+func validarTokenPendiente(tokenString string) (jwt.MapClaims, error) {
+	claims, err := parsearToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims["pendiente"] != "dosfa" {
+		return nil, errors.New("no es un token pendiente del segundo factor")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("el token no contiene el claim sub")
+	}
+	return claims, nil
+}
+
+// completarLoginFederadoHandler canjea el token pendiente de un login
+// federado y el código del segundo factor por el token de acceso, con
+// amr fed, otp y mfa.
+func completarLoginFederadoHandler(w http.ResponseWriter, r *http.Request) {
+	var req CodigoFederadoRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+	if req.TokenPendiente == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo token_pendiente", Codigo: "CAMPO_REQUERIDO"})
+		return
+	}
+	if req.Codigo == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo codigo", Codigo: "CAMPO_REQUERIDO"})
+		return
+	}
+
+	claims, err := validarTokenPendiente(req.TokenPendiente)
+	var usuario *Usuario
+	if err == nil {
+		usuario = buscarUsuarioPorID(claims["sub"].(string))
+	}
+	if usuario == nil {
+		escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Token inválido o expirado", Codigo: "TOKEN_INVALIDO"})
+		return
+	}
+	defer usuario.bloquear()()
+	if !versionVigente(claims, usuario) || !usuario.DosFAActivo {
+		escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Token inválido o expirado", Codigo: "TOKEN_INVALIDO"})
+		return
+	}
+	if rechazarCuentaInactiva(w, r, usuario) {
+		return
+	}
+	if !verificarSegundoFactor(usuario, req.Codigo) {
+		slog.WarnContext(r.Context(), "Código de segundo factor inválido", "correo", usuario.Correo)
+		auditar(r, "login_fallido", usuario.Correo, "", "segundo_factor_invalido")
+		seguridad.loginFallido(r, usuario.Correo)
+		escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Código de verificación inválido", Codigo: "CODIGO_INVALIDO"})
+		return
+	}
+	emitirTokenFederado(w, r, usuario, []string{"fed", "otp", "mfa"}, "fed,otp,mfa")
+}
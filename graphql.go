@@ -0,0 +1,229 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"golang.org/x/text/language"
+)
+
+// clavePeticionGraphQL guarda en el contexto de los resolvers la petición
+// HTTP de la consulta.
+const clavePeticionGraphQL claveContexto = "peticion_graphql"
+
+// PeticionGraphQL define el cuerpo esperado para POST /graphql.
+type PeticionGraphQL struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+	Extensions    map[string]any `json:"extensions"`
+}
+
+// errorGraphQL lleva un error de la capa de servicios a la lista errors
+// de la respuesta GraphQL: el mensaje, traducido al idioma de la
+// petición, y en extensions el status HTTP equivalente, el código y los
+// errores por campo.
+type errorGraphQL struct {
+	err    *errorServicio
+	idioma language.Tag
+}
+
+func (e errorGraphQL) Error() string {
+	return traducirError(cmp.Or(e.err.respuesta.Codigo, codigoStatus(e.err.status)), e.err.respuesta.Error, e.idioma)
+}
+
+// Extensions implementa gqlerrors.ExtendedError.
+func (e errorGraphQL) Extensions() map[string]any {
+	extensiones := map[string]any{
+		"status": e.err.status,
+		"codigo": cmp.Or(e.err.respuesta.Codigo, codigoStatus(e.err.status)),
+	}
+	if len(e.err.respuesta.Errores) > 0 {
+		extensiones["errores"] = traducirErroresCampo(e.err.respuesta.Errores, e.idioma)
+	}
+	return extensiones
+}
+
+// resolverGraphQL resuelve un campo a partir de la petición HTTP que lo
+// originó.
+type resolverGraphQL func(r *http.Request, args map[string]any) (any, *errorServicio)
+
+// resolver adapta un resolverGraphQL a graphql.FieldResolveFn.
+func resolver(f resolverGraphQL) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		r := p.Context.Value(clavePeticionGraphQL).(*http.Request).WithContext(p.Context)
+		resultado, errServicio := f(r, p.Args)
+		if errServicio != nil {
+			return nil, errorGraphQL{err: errServicio, idioma: idiomaDePeticion(r)}
+		}
+		return resultado, nil
+	}
+}
+
+// argumento devuelve el argumento de texto con ese nombre, o "" si no se
+// envió.
+func argumento(args map[string]any, nombre string) string {
+	valor, _ := args[nombre].(string)
+	return valor
+}
+
+// nuevoEsquemaGraphQL define el esquema: la query perfil y las mutaciones
+// registrar y login, resueltas con la misma capa de servicios que los
+// handlers REST. Las mutaciones aplican los límites de peticiones de sus
+// endpoints equivalentes en cada resolver, de modo que agrupar varias en
+// una sola consulta no los evita.
+func nuevoEsquemaGraphQL(lim *limitador) (graphql.Schema, error) {
+	perfil := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Perfil",
+		Description: "Datos del usuario visibles para él mismo.",
+		Fields: graphql.Fields{
+			"id":                 &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"correo":             &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"telefono":           &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"correoVerificado":   &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"telefonoVerificado": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"dosFAActivo":        &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		},
+	})
+	sesion := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Sesion",
+		Description: "Token de acceso emitido por login.",
+		Fields: graphql.Fields{
+			"token":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"fechaInicio": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		},
+	})
+	texto := graphql.NewNonNull(graphql.String)
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"perfil": &graphql.Field{
+				Type:        graphql.NewNonNull(perfil),
+				Description: "Perfil del usuario del header Authorization.",
+				Resolve: resolver(func(r *http.Request, _ map[string]any) (any, *errorServicio) {
+					tokenString, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+					ctx, errServicio := autenticarToken(r.Context(), tokenString, requisitosCompletos)
+					if errServicio != nil {
+						return nil, errServicio
+					}
+					usuario := usuarioAutenticado(r.WithContext(ctx))
+					defer usuario.bloquear()()
+					return perfilGraphQL(usuario), nil
+				}),
+			},
+		},
+	})
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"registrar": &graphql.Field{
+				Type:        graphql.NewNonNull(perfil),
+				Description: "Da de alta una cuenta, como POST /api/v1/registro.",
+				Args: graphql.FieldConfigArgument{
+					"correo":   &graphql.ArgumentConfig{Type: texto},
+					"telefono": &graphql.ArgumentConfig{Type: texto},
+					"password": &graphql.ArgumentConfig{Type: texto},
+				},
+				Resolve: resolver(func(r *http.Request, args map[string]any) (any, *errorServicio) {
+					if errServicio := limitarGraphQL(lim, r, porIP("registro")); errServicio != nil {
+						return nil, errServicio
+					}
+					usuario, errServicio := registrarCuenta(r, RegistroRequest{
+						Correo:   argumento(args, "correo"),
+						Telefono: argumento(args, "telefono"),
+						Password: argumento(args, "password"),
+					})
+					if errServicio != nil {
+						return nil, errServicio
+					}
+					defer usuario.bloquear()()
+					return perfilGraphQL(usuario), nil
+				}),
+			},
+			"login": &graphql.Field{
+				Type:        graphql.NewNonNull(sesion),
+				Description: "Inicia sesión, como POST /api/v1/login. codigo es el del segundo factor, si está activo.",
+				Args: graphql.FieldConfigArgument{
+					"correo":   &graphql.ArgumentConfig{Type: texto},
+					"password": &graphql.ArgumentConfig{Type: texto},
+					"codigo":   &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolver(func(r *http.Request, args map[string]any) (any, *errorServicio) {
+					correo := argumento(args, "correo")
+					porCorreo := reglaLimite{nombre: "login_cuenta", clave: func(*http.Request) string {
+						return strings.ToLower(strings.TrimSpace(correo))
+					}}
+					if errServicio := limitarGraphQL(lim, r, porIP("login"), porCorreo); errServicio != nil {
+						return nil, errServicio
+					}
+					resp, errServicio := iniciarSesion(r, LoginRequest{
+						Correo:   correo,
+						Password: argumento(args, "password"),
+						Codigo:   argumento(args, "codigo"),
+					})
+					if errServicio != nil {
+						return nil, errServicio
+					}
+					return map[string]any{"token": resp.Token, "fechaInicio": resp.FechaInicio}, nil
+				}),
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// limitarGraphQL aplica las reglas de límite a un resolver.
+func limitarGraphQL(lim *limitador, r *http.Request, reglas ...reglaLimite) *errorServicio {
+	if lim.espera(r, reglas...) > 0 {
+		return nuevoErrorServicio(http.StatusTooManyRequests, "DEMASIADAS_PETICIONES", "Demasiadas peticiones, intenta más tarde")
+	}
+	return nil
+}
+
+// perfilGraphQL devuelve los campos del tipo Perfil de un usuario.
+func perfilGraphQL(u *Usuario) map[string]any {
+	perfil := nuevoPerfilResponse(u)
+	return map[string]any{
+		"id":                 perfil.ID,
+		"correo":             perfil.Correo,
+		"telefono":           perfil.Telefono,
+		"correoVerificado":   perfil.CorreoVerificado,
+		"telefonoVerificado": perfil.TelefonoVerificado,
+		"dosFAActivo":        perfil.DosFAActivo,
+	}
+}
+
+// graphqlHandler atiende POST /graphql. Los errores del cuerpo HTTP se
+// responden como en el resto de la API; los de la consulta y de los
+// resolvers van, con status 200, en la lista errors de la respuesta.
+func graphqlHandler(esquema graphql.Schema) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req PeticionGraphQL
+		if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+			slog.InfoContext(r.Context(), "Cuerpo de GraphQL rechazado", "motivo", errCuerpo.mensaje)
+			escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+			return
+		}
+		if strings.TrimSpace(req.Query) == "" {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo query", Codigo: "CAMPO_REQUERIDO"})
+			return
+		}
+
+		resultado := graphql.Do(graphql.Params{
+			Schema:         esquema,
+			RequestString:  req.Query,
+			VariableValues: req.Variables,
+			OperationName:  req.OperationName,
+			Context:        context.WithValue(r.Context(), clavePeticionGraphQL, r),
+		})
+		if resultado.HasErrors() {
+			slog.InfoContext(r.Context(), "Consulta GraphQL con errores", "errores", len(resultado.Errors))
+		}
+		escribirJSON(w, http.StatusOK, resultado)
+	}
+}
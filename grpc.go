@@ -0,0 +1,248 @@
+package main
+
+//go:generate protoc -I proto --go_out=. --go_opt=module=pruebasgo --go-grpc_out=. --go-grpc_opt=module=pruebasgo usuarios.proto
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"pruebasgo/usuariospb"
+)
+
+// clavePeticionGRPC guarda en el contexto la petición HTTP/2 que
+// transporta la llamada gRPC.
+const clavePeticionGRPC claveContexto = "peticion_grpc"
+
+// metodosGRPCPublicos son los métodos que no exigen token de acceso.
+var metodosGRPCPublicos = map[string]bool{
+	usuariospb.Usuarios_Registrar_FullMethodName: true,
+	usuariospb.Usuarios_Login_FullMethodName:     true,
+}
+
+// direccionGRPC lee GRPC_DIRECCION, la dirección host:puerto del
+// servidor gRPC. Vacía lo desactiva.
+func direccionGRPC() (string, error) {
+	direccion := strings.TrimSpace(opcion("GRPC_DIRECCION"))
+	if direccion == "" {
+		return "", nil
+	}
+	if err := validarDireccion(direccion); err != nil {
+		return "", fmt.Errorf("GRPC_DIRECCION=%q: %w", direccion, err)
+	}
+	return direccion, nil
+}
+
+// servidorGRPC devuelve el servidor del servicio gRPC Usuarios si se
+// configuró una dirección, o nil. Se sirve como HTTP/2 sin TLS (h2c)
+// desde un http.Server, de modo que arranca y se apaga junto con los
+// servidores HTTP y comparte los middlewares de request ID, logs y
+// saturación. Registrar y Login tienen los mismos límites de peticiones
+// que en la API HTTP (ver limitesGRPC); las cubetas se comparten con ella
+// si están en Redis.
+func servidorGRPC(direccion string, saturacion ConfigSaturacion) *http.Server {
+	if direccion == "" {
+		return nil
+	}
+	lim, err := nuevoLimitador(cargarConfigLimites())
+	if err != nil {
+		fatal("Error configurando el límite de peticiones", err)
+	}
+	grpcSrv := grpc.NewServer(grpc.ChainUnaryInterceptor(recuperacionGRPC, logsGRPC, limitesGRPC(lim), autenticacionGRPC))
+	usuariospb.RegisterUsuariosServer(grpcSrv, servidorUsuarios{})
+
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grpcSrv.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clavePeticionGRPC, r)))
+	})
+	handler = saturacionMiddleware(saturacion)(handler)
+	handler = logsMiddleware(handler)
+	handler = requestIDMiddleware(handler)
+
+	var protocolos http.Protocols
+	protocolos.SetUnencryptedHTTP2(true)
+	return &http.Server{Addr: direccion, Handler: handler, Protocols: &protocolos}
+}
+
+// peticionGRPC devuelve la petición HTTP/2 de la llamada con el contexto
+// de gRPC, para pasarla a la capa de servicios.
+func peticionGRPC(ctx context.Context) *http.Request {
+	r := ctx.Value(clavePeticionGRPC).(*http.Request)
+	return r.WithContext(ctx)
+}
+
+// recuperacionGRPC convierte un panic del método en un error INTERNAL,
+// como recuperacionMiddleware en la API HTTP.
+func recuperacionGRPC(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			slog.ErrorContext(ctx, "Panic atendiendo la llamada gRPC", "metodo_grpc", info.FullMethod, "panic", rec, "stack", string(debug.Stack()))
+			err = status.Error(codes.Internal, "Error interno del servidor")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// logsGRPC registra el método, el código de respuesta y la latencia de
+// cada llamada.
+func logsGRPC(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	inicio := time.Now()
+	resp, err := handler(ctx, req)
+	slog.InfoContext(ctx, "Llamada gRPC completada",
+		"metodo_grpc", info.FullMethod,
+		"status_grpc", status.Code(err).String(),
+		"latencia_ms", float64(time.Since(inicio).Microseconds())/1000)
+	return resp, err
+}
+
+// limitesGRPC aplica a Registrar y Login las reglas de límite de POST
+// /registro y POST /login: por IP y, en el login, también por el correo
+// de la cuenta. Si alguna se excede responde RESOURCE_EXHAUSTED con un
+// detalle google.rpc.RetryInfo con la espera, como el header Retry-After
+// de la API HTTP.
+func limitesGRPC(lim *limitador) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var reglas []reglaLimite
+		switch req := req.(type) {
+		case *usuariospb.RegistrarRequest:
+			reglas = []reglaLimite{porIP("registro")}
+		case *usuariospb.LoginRequest:
+			porCorreo := reglaLimite{nombre: "login_cuenta", clave: func(*http.Request) string {
+				return strings.ToLower(strings.TrimSpace(req.GetCorreo()))
+			}}
+			reglas = []reglaLimite{porIP("login"), porCorreo}
+		}
+		espera := lim.espera(peticionGRPC(ctx), reglas...)
+		if espera == 0 {
+			return handler(ctx, req)
+		}
+		st := status.Convert(estadoGRPC(nuevoErrorServicio(http.StatusTooManyRequests, "DEMASIADAS_PETICIONES", "Demasiadas peticiones, intenta más tarde")))
+		segundos := time.Duration(math.Ceil(espera.Seconds())) * time.Second
+		if conDetalles, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(segundos)}); err == nil {
+			st = conDetalles
+		}
+		return nil, st.Err()
+	}
+}
+
+// autenticacionGRPC exige en los métodos que no son públicos el metadata
+// "authorization: Bearer <token>", con las mismas reglas que autenticado.
+func autenticacionGRPC(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if metodosGRPCPublicos[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	var tokenString string
+	if valores := metadata.ValueFromIncomingContext(ctx, "authorization"); len(valores) > 0 {
+		tokenString, _ = strings.CutPrefix(valores[0], "Bearer ")
+	}
+	ctx, errServicio := autenticarToken(ctx, tokenString, requisitosCompletos)
+	if errServicio != nil {
+		return nil, estadoGRPC(errServicio)
+	}
+	return handler(ctx, req)
+}
+
+// estadoGRPC traduce un error de la capa de servicios a un status gRPC.
+// Los errores por campo viajan en un detalle google.rpc.BadRequest y el
+// código de error, si hay, en un google.rpc.ErrorInfo.
+func estadoGRPC(e *errorServicio) error {
+	var codigo codes.Code
+	switch e.status {
+	case http.StatusBadRequest:
+		codigo = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		codigo = codes.Unauthenticated
+	case http.StatusForbidden:
+		codigo = codes.PermissionDenied
+	case http.StatusNotFound:
+		codigo = codes.NotFound
+	case http.StatusConflict:
+		codigo = codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		codigo = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		codigo = codes.Unavailable
+	default:
+		codigo = codes.Internal
+	}
+	st := status.New(codigo, e.respuesta.Error)
+	if len(e.respuesta.Errores) > 0 {
+		solicitud := &errdetails.BadRequest{}
+		for _, campo := range e.respuesta.Errores {
+			descripcion := campo.Mensaje
+			if len(campo.Reglas) > 0 {
+				descripcion += ": " + strings.Join(campo.Reglas, "; ")
+			}
+			solicitud.FieldViolations = append(solicitud.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       campo.Campo,
+				Description: descripcion,
+				Reason:      campo.Codigo,
+			})
+		}
+		if conDetalles, err := st.WithDetails(solicitud); err == nil {
+			st = conDetalles
+		}
+	}
+	razon := cmp.Or(e.respuesta.Codigo, codigoStatus(e.status))
+	if conDetalles, err := st.WithDetails(&errdetails.ErrorInfo{Reason: razon, Domain: "stratplus"}); err == nil {
+		st = conDetalles
+	}
+	return st.Err()
+}
+
+// servidorUsuarios implementa el servicio gRPC Usuarios sobre la misma
+// capa de servicios que los handlers HTTP.
+type servidorUsuarios struct {
+	usuariospb.UnimplementedUsuariosServer
+}
+
+func (servidorUsuarios) Registrar(ctx context.Context, req *usuariospb.RegistrarRequest) (*usuariospb.RegistrarResponse, error) {
+	usuario, errServicio := registrarCuenta(peticionGRPC(ctx), RegistroRequest{
+		Correo:   req.GetCorreo(),
+		Telefono: req.GetTelefono(),
+		Password: req.GetPassword(),
+	})
+	if errServicio != nil {
+		return nil, estadoGRPC(errServicio)
+	}
+	return &usuariospb.RegistrarResponse{Id: usuario.ID, Mensaje: "Usuario registrado exitosamente"}, nil
+}
+
+func (servidorUsuarios) Login(ctx context.Context, req *usuariospb.LoginRequest) (*usuariospb.LoginResponse, error) {
+	resp, errServicio := iniciarSesion(peticionGRPC(ctx), LoginRequest{
+		Correo:   req.GetCorreo(),
+		Password: req.GetPassword(),
+		Codigo:   req.GetCodigo(),
+	})
+	if errServicio != nil {
+		return nil, estadoGRPC(errServicio)
+	}
+	return &usuariospb.LoginResponse{Token: resp.Token, FechaInicio: timestamppb.New(resp.FechaInicio), DebeCambiarPassword: resp.DebeCambiarPassword}, nil
+}
+
+func (servidorUsuarios) Perfil(ctx context.Context, _ *usuariospb.PerfilRequest) (*usuariospb.PerfilResponse, error) {
+	usuario := usuarioAutenticado(peticionGRPC(ctx))
+	desbloquear := usuario.bloquear()
+	perfil := nuevoPerfilResponse(usuario)
+	desbloquear()
+	return &usuariospb.PerfilResponse{
+		Id:                 perfil.ID,
+		Correo:             perfil.Correo,
+		Telefono:           perfil.Telefono,
+		CorreoVerificado:   perfil.CorreoVerificado,
+		TelefonoVerificado: perfil.TelefonoVerificado,
+		DosFaActivo:        perfil.DosFAActivo,
+	}, nil
+}
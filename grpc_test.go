@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"pruebasgo/usuariospb"
+)
+
+func TestLimitesGRPCLogin(t *testing.T) {
+	prepararHandlers(t)
+	t.Setenv("LIMITE_LOGIN_IP", "3/1m")
+	t.Setenv("LIMITE_LOGIN_CUENTA", "100/1m")
+	limites := limitesVigentes.Load()
+	t.Cleanup(func() { limitesVigentes.Store(limites) })
+	lim, err := nuevoLimitador(cargarConfigLimites())
+	if err != nil {
+		t.Fatal(err)
+	}
+	interceptor := limitesGRPC(lim)
+	info := &grpc.UnaryServerInfo{FullMethod: usuariospb.Usuarios_Login_FullMethodName}
+	atendidas := 0
+	handler := func(context.Context, any) (any, error) {
+		atendidas++
+		return &usuariospb.LoginResponse{}, nil
+	}
+	llamar := func() error {
+		r := httptest.NewRequest(http.MethodPost, usuariospb.Usuarios_Login_FullMethodName, nil)
+		ctx := context.WithValue(r.Context(), clavePeticionGRPC, r)
+		_, err := interceptor(ctx, &usuariospb.LoginRequest{Correo: "ana@ejemplo.com"}, info, handler)
+		return err
+	}
+
+	for i := range 3 {
+		if err := llamar(); err != nil {
+			t.Fatalf("llamada %d: %v", i+1, err)
+		}
+	}
+	st := status.Convert(llamar())
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("cuarta llamada: código %v, se esperaba %v", st.Code(), codes.ResourceExhausted)
+	}
+	if atendidas != 3 {
+		t.Errorf("se atendieron %d llamadas, se esperaban 3", atendidas)
+	}
+	var espera *errdetails.RetryInfo
+	var razon string
+	for _, detalle := range st.Details() {
+		switch d := detalle.(type) {
+		case *errdetails.RetryInfo:
+			espera = d
+		case *errdetails.ErrorInfo:
+			razon = d.GetReason()
+		}
+	}
+	if espera == nil || espera.GetRetryDelay().AsDuration() <= 0 {
+		t.Errorf("RetryInfo %v, se esperaba una espera positiva", espera)
+	}
+	if razon != "DEMASIADAS_PETICIONES" {
+		t.Errorf("ErrorInfo.Reason %q, se esperaba DEMASIADAS_PETICIONES", razon)
+	}
+}
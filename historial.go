@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxHistorial es el número máximo de sesiones y eventos que se
+// conservan por usuario; los más antiguos se descartan.
+const maxHistorial = 50
+
+// Sesion registra un inicio de sesión exitoso. ID es el claim sid de su
+// token.
+type Sesion struct {
+	ID        string    `json:"id"`
+	Fecha     time.Time `json:"fecha"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Metodos   []string  `json:"metodos"`
+	Pais      string    `json:"pais,omitempty"`
+	// Revocada indica que el usuario cerró la sesión con el enlace del
+	// aviso de login nuevo, cuyo hash guarda TokenRevocacion.
+	Revocada        bool   `json:"revocada,omitempty"`
+	TokenRevocacion string `json:"-"`
+}
+
+// EventoCuenta registra un cambio relevante en la cuenta del usuario.
+type EventoCuenta struct {
+	Fecha time.Time `json:"fecha"`
+	Tipo  string    `json:"tipo"`
+}
+
+// registrarSesion agrega al historial del usuario el inicio de sesión
+// cuyo token lleva el ID sesion, alerta si proviene de un país desde el
+// que nunca había iniciado sesión, avisa al usuario si viene de un país,
+// una IP o un dispositivo nuevos (ver avisarLoginNuevo) y lo envía a los
+// webhooks y al broker de eventos.
+func registrarSesion(usuario *Usuario, r *http.Request, amr []string, sesion string) {
+	pais := seguridad.pais(r)
+	seguridad.loginExitoso(r, usuario, pais)
+	nueva := Sesion{
+		ID:        sesion,
+		Fecha:     time.Now(),
+		IP:        ipCliente(r),
+		UserAgent: r.UserAgent(),
+		Metodos:   amr,
+		Pais:      pais,
+	}
+	avisarLoginNuevo(r, usuario, &nueva)
+	usuario.Sesiones = append(usuario.Sesiones, nueva)
+	if len(usuario.Sesiones) > maxHistorial {
+		usuario.Sesiones = usuario.Sesiones[len(usuario.Sesiones)-maxHistorial:]
+	}
+	webhooks.publicar(r, eventoUsuarioLogin, usuario)
+	eventosDominio.publicar(r, eventoUsuarioLogin, usuario)
+}
+
+// registrarEvento agrega un evento al historial de la cuenta y lo envía
+// a las conexiones abiertas del usuario en /ws.
+func registrarEvento(usuario *Usuario, tipo string) {
+	evento := EventoCuenta{Fecha: time.Now(), Tipo: tipo}
+	usuario.Eventos = append(usuario.Eventos, evento)
+	eventosSesion.publicar(usuario.ID, EventoSesion{Tipo: tipo, Fecha: evento.Fecha})
+	if len(usuario.Eventos) > maxHistorial {
+		usuario.Eventos = usuario.Eventos[len(usuario.Eventos)-maxHistorial:]
+	}
+}
+
+// ipCliente devuelve la IP remota de la petición sin el puerto.
+func ipCliente(r *http.Request) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
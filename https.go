@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ConfigHTTPS define cómo se sirve la API por TLS: con un certificado y
+// llave propios o con certificados de Let's Encrypt obtenidos por
+// autocert, y si se redirige el tráfico HTTP a HTTPS.
+type ConfigHTTPS struct {
+	Certificado   string
+	Llave         string
+	Dominios      []string
+	CacheAutocert string
+	Direcciones   []string
+	DireccionHTTP string
+}
+
+// cargarConfigHTTPS lee la configuración de TLS_CERT y TLS_KEY (certificado
+// propio), AUTOCERT_DOMINIOS y AUTOCERT_CACHE (Let's Encrypt), TLS_DIRECCION
+// (direcciones HTTPS separadas por coma, por defecto :8443) y
+// HTTP_REDIRECCION (dirección en la que se atiende HTTP sólo para
+// redirigir a HTTPS).
+func cargarConfigHTTPS() ConfigHTTPS {
+	cfg := ConfigHTTPS{
+		Certificado:   opcion("TLS_CERT"),
+		Llave:         opcion("TLS_KEY"),
+		Dominios:      listaEntorno("AUTOCERT_DOMINIOS", nil),
+		CacheAutocert: opcion("AUTOCERT_CACHE"),
+		Direcciones:   listaEntorno("TLS_DIRECCION", []string{":8443"}),
+		DireccionHTTP: opcion("HTTP_REDIRECCION"),
+	}
+	if cfg.CacheAutocert == "" {
+		cfg.CacheAutocert = "certs"
+	}
+	return cfg
+}
+
+// habilitado indica si se configuró algún origen de certificados.
+func (c ConfigHTTPS) habilitado() bool {
+	return c.Certificado != "" || len(c.Dominios) > 0
+}
+
+// servidoresAPI crea los servidores que atienden handler: uno por cada
+// dirección de config.Direcciones o, con certificados configurados, uno
+// HTTPS por cada dirección de TLS_DIRECCION (ver configurarHTTPS).
+func servidoresAPI(handler http.Handler, cfg ConfigHTTPS) ([]*http.Server, error) {
+	if cfg.habilitado() {
+		return configurarHTTPS(handler, cfg)
+	}
+	servidores := make([]*http.Server, 0, len(config.Direcciones))
+	for _, d := range config.Direcciones {
+		servidores = append(servidores, &http.Server{Addr: d, Handler: handler})
+	}
+	return servidores, nil
+}
+
+// configurarHTTPS devuelve los servidores que atienden handler por TLS
+// según cfg, uno por dirección y todos con la misma configuración TLS, y,
+// si se pidió, el que redirige HTTP a HTTPS (que con autocert atiende
+// también los retos HTTP-01 de Let's Encrypt). La redirección apunta al
+// puerto de la primera dirección.
+func configurarHTTPS(handler http.Handler, cfg ConfigHTTPS) ([]*http.Server, error) {
+	if cfg.Certificado != "" && len(cfg.Dominios) > 0 {
+		return nil, errors.New("TLS_CERT y AUTOCERT_DOMINIOS son excluyentes")
+	}
+	for _, d := range cfg.Direcciones {
+		if err := validarDireccion(d); err != nil {
+			return nil, fmt.Errorf("TLS_DIRECCION=%q: %w", d, err)
+		}
+	}
+
+	var tlsConfig *tls.Config
+	var redireccion http.Handler = http.HandlerFunc(redirigirHTTPS(cfg.Direcciones[0]))
+	if cfg.Certificado != "" {
+		par, err := tls.LoadX509KeyPair(cfg.Certificado, cfg.Llave)
+		if err != nil {
+			return nil, fmt.Errorf("cargando el certificado TLS: %w", err)
+		}
+		tlsConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{par},
+		}
+	} else {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.Dominios...),
+			Cache:      autocert.DirCache(cfg.CacheAutocert),
+		}
+		tlsConfig = m.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		redireccion = m.HTTPHandler(redireccion)
+	}
+
+	var servidores []*http.Server
+	for _, d := range cfg.Direcciones {
+		servidores = append(servidores, &http.Server{Addr: d, Handler: handler, TLSConfig: tlsConfig})
+	}
+	if cfg.DireccionHTTP != "" {
+		servidores = append(servidores, &http.Server{Addr: cfg.DireccionHTTP, Handler: redireccion})
+	}
+	return servidores, nil
+}
+
+// redirigirHTTPS responde con una redirección permanente a la misma URL
+// por HTTPS. Se usa 308 para que los clientes conserven el método y el
+// cuerpo de la petición.
+func redirigirHTTPS(direccionHTTPS string) http.HandlerFunc {
+	_, puerto, _ := net.SplitHostPort(direccionHTTPS)
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if puerto != "" && puerto != "443" {
+			host = net.JoinHostPort(host, puerto)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// headerIdempotencia es el header con el que el cliente identifica una
+// operación para poder reintentarla sin repetir sus efectos.
+const headerIdempotencia = "Idempotency-Key"
+
+// largoMaximoClaveIdempotencia es el largo máximo de una Idempotency-Key;
+// un UUID, lo habitual, tiene 36 caracteres.
+const largoMaximoClaveIdempotencia = 255
+
+// ConfigIdempotencia define dónde y por cuánto tiempo se guardan las
+// respuestas de las peticiones con Idempotency-Key.
+type ConfigIdempotencia struct {
+	// TTL es cuánto tiempo se puede reintentar una petición con la misma
+	// clave y recibir la respuesta guardada.
+	TTL time.Duration
+	// RedisURL, si no está vacía, guarda las respuestas en Redis para
+	// que las compartan todas las instancias.
+	RedisURL string
+}
+
+// cargarConfigIdempotencia lee IDEMPOTENCIA_TTL (por defecto 24h) y
+// REDIS_URL.
+func cargarConfigIdempotencia() (ConfigIdempotencia, error) {
+	cfg := ConfigIdempotencia{TTL: 24 * time.Hour, RedisURL: opcion("REDIS_URL")}
+	if v := strings.TrimSpace(opcion("IDEMPOTENCIA_TTL")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("IDEMPOTENCIA_TTL=%q: debe ser una duración positiva", v)
+		}
+		cfg.TTL = d
+	}
+	return cfg, nil
+}
+
+// respuestaIdempotente es lo que se guarda de una petición con
+// Idempotency-Key: la huella del cuerpo, para rechazar que la clave se
+// reutilice con otro, y la respuesta, o EnCurso mientras se atiende.
+type respuestaIdempotente struct {
+	Huella      string `json:"huella"`
+	EnCurso     bool   `json:"en_curso,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Cuerpo      []byte `json:"cuerpo,omitempty"`
+}
+
+// almacenIdempotencia guarda las respuestas por clave durante ttl.
+// reservar marca la clave como en curso y devuelve nil si no existía, o
+// lo guardado si ya existía; guardar reemplaza la reserva por la
+// respuesta y liberar la descarta, para que la petición pueda repetirse.
+type almacenIdempotencia interface {
+	reservar(ctx context.Context, clave, huella string, ttl time.Duration) (*respuestaIdempotente, error)
+	guardar(ctx context.Context, clave string, resp respuestaIdempotente, ttl time.Duration) error
+	liberar(ctx context.Context, clave string) error
+}
+
+// idempotencia aplica Idempotency-Key a los handlers que lo admiten.
+type idempotencia struct {
+	almacen almacenIdempotencia
+	ttl     time.Duration
+}
+
+// nuevaIdempotencia usa Redis si cfg.RedisURL está configurada y, si no,
+// un almacenamiento en memoria local al proceso.
+func nuevaIdempotencia(cfg ConfigIdempotencia) (*idempotencia, error) {
+	if cfg.RedisURL == "" {
+		return &idempotencia{almacen: &idempotenciaMemoria{respuestas: map[string]entradaIdempotencia{}}, ttl: cfg.TTL}, nil
+	}
+	opciones, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+	return &idempotencia{almacen: &idempotenciaRedis{cliente: redis.NewClient(opciones)}, ttl: cfg.TTL}, nil
+}
+
+// idempotente permite reintentar el handler con el mismo Idempotency-Key
+// sin repetir la operación: la primera petición se atiende y su respuesta
+// se guarda, y las siguientes con la misma clave y el mismo cuerpo
+// reciben esa respuesta con el header Idempotent-Replayed. La misma clave
+// con otro cuerpo responde 422, y mientras la primera se atiende, 409.
+// Las respuestas 5xx no se guardan, para que el reintento vuelva a
+// intentarlo. ambito separa las claves de cada endpoint. Sin el header,
+// el handler se atiende como siempre; ante un error del almacenamiento
+// también, como en el límite de peticiones.
+func (i *idempotencia) idempotente(ambito string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clave := r.Header.Get(headerIdempotencia)
+		if clave == "" {
+			next(w, r)
+			return
+		}
+		if len(clave) > largoMaximoClaveIdempotencia {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Idempotency-Key inválida", Codigo: "IDEMPOTENCY_KEY_INVALIDA"})
+			return
+		}
+		// Como en porCuenta, se lee a lo sumo un byte más que
+		// tamanoMaximoCuerpo para que el handler siga rechazando los
+		// cuerpos demasiado grandes.
+		cuerpo, err := io.ReadAll(io.LimitReader(r.Body, tamanoMaximoCuerpo+1))
+		r.Body = io.NopCloser(bytes.NewReader(cuerpo))
+		if err != nil {
+			next(w, r)
+			return
+		}
+		suma := sha256.Sum256(cuerpo)
+		huella := hex.EncodeToString(suma[:])
+		clave = ambito + ":" + clave
+
+		guardada, err := i.almacen.reservar(r.Context(), clave, huella, i.ttl)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error consultando la Idempotency-Key", "error", err)
+			next(w, r)
+			return
+		}
+		switch {
+		case guardada == nil:
+		case guardada.Huella != huella:
+			escribirJSON(w, http.StatusUnprocessableEntity, ErrorResponse{Error: "La Idempotency-Key ya se usó con otra petición", Codigo: "IDEMPOTENCY_KEY_REUTILIZADA"})
+			return
+		case guardada.EnCurso:
+			w.Header().Set("Retry-After", "1")
+			escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "La Idempotency-Key está en uso por otra petición", Codigo: "IDEMPOTENCY_KEY_EN_CURSO"})
+			return
+		default:
+			slog.InfoContext(r.Context(), "Respuesta repetida por Idempotency-Key", "ambito", ambito, "status", guardada.Status)
+			w.Header().Set("Content-Type", guardada.ContentType)
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(guardada.Status)
+			w.Write(guardada.Cuerpo)
+			return
+		}
+
+		// Si el handler no termina (un panic), la reserva se libera para
+		// que el reintento no reciba 409 hasta que venza.
+		rg := &respuestaGuardada{ResponseWriter: w}
+		terminado := false
+		defer func() {
+			var err error
+			if terminado && rg.status < http.StatusInternalServerError {
+				err = i.almacen.guardar(context.WithoutCancel(r.Context()), clave, respuestaIdempotente{
+					Huella: huella, Status: rg.status, ContentType: w.Header().Get("Content-Type"), Cuerpo: rg.cuerpo.Bytes(),
+				}, i.ttl)
+			} else {
+				err = i.almacen.liberar(context.WithoutCancel(r.Context()), clave)
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Error guardando la respuesta de la Idempotency-Key", "error", err)
+			}
+		}()
+		next(rg, r)
+		rg.WriteHeader(http.StatusOK)
+		terminado = true
+	}
+}
+
+// respuestaGuardada copia la respuesta del handler a medida que se
+// escribe, para guardarla.
+type respuestaGuardada struct {
+	http.ResponseWriter
+	status int
+	cuerpo bytes.Buffer
+}
+
+func (rg *respuestaGuardada) WriteHeader(status int) {
+	if rg.status == 0 {
+		rg.status = status
+		rg.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (rg *respuestaGuardada) Write(b []byte) (int, error) {
+	rg.WriteHeader(http.StatusOK)
+	rg.cuerpo.Write(b)
+	return rg.ResponseWriter.Write(b)
+}
+
+func (rg *respuestaGuardada) Unwrap() http.ResponseWriter {
+	return rg.ResponseWriter
+}
+
+// entradaIdempotencia es una respuesta guardada en memoria con su
+// vencimiento.
+type entradaIdempotencia struct {
+	respuesta respuestaIdempotente
+	vence     time.Time
+}
+
+// idempotenciaMemoria guarda las respuestas en el proceso. Las vencidas
+// se descartan periódicamente.
+type idempotenciaMemoria struct {
+	mu             sync.Mutex
+	respuestas     map[string]entradaIdempotencia
+	ultimaLimpieza time.Time
+}
+
+func (a *idempotenciaMemoria) reservar(_ context.Context, clave, huella string, ttl time.Duration) (*respuestaIdempotente, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ahora := time.Now()
+	if ahora.Sub(a.ultimaLimpieza) > time.Minute {
+		for c, e := range a.respuestas {
+			if ahora.After(e.vence) {
+				delete(a.respuestas, c)
+			}
+		}
+		a.ultimaLimpieza = ahora
+	}
+	if e, ok := a.respuestas[clave]; ok && !ahora.After(e.vence) {
+		return &e.respuesta, nil
+	}
+	a.respuestas[clave] = entradaIdempotencia{respuestaIdempotente{Huella: huella, EnCurso: true}, ahora.Add(ttl)}
+	return nil, nil
+}
+
+func (a *idempotenciaMemoria) guardar(_ context.Context, clave string, resp respuestaIdempotente, ttl time.Duration) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.respuestas[clave] = entradaIdempotencia{resp, time.Now().Add(ttl)}
+	return nil
+}
+
+func (a *idempotenciaMemoria) liberar(_ context.Context, clave string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.respuestas, clave)
+	return nil
+}
+
+// idempotenciaRedis guarda las respuestas en Redis, como JSON, bajo el
+// prefijo "idempotencia:". La reserva es un SET NX, de modo que sólo una
+// instancia atiende cada clave.
+type idempotenciaRedis struct {
+	cliente *redis.Client
+}
+
+func (a *idempotenciaRedis) reservar(ctx context.Context, clave, huella string, ttl time.Duration) (*respuestaIdempotente, error) {
+	reserva, _ := json.Marshal(respuestaIdempotente{Huella: huella, EnCurso: true})
+	reservada, err := a.cliente.SetNX(ctx, "idempotencia:"+clave, reserva, ttl).Result()
+	if err != nil || reservada {
+		return nil, err
+	}
+	datos, err := a.cliente.Get(ctx, "idempotencia:"+clave).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// Venció entre el SET NX y el GET.
+		return a.reservar(ctx, clave, huella, ttl)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var guardada respuestaIdempotente
+	if err := json.Unmarshal(datos, &guardada); err != nil {
+		return nil, err
+	}
+	return &guardada, nil
+}
+
+func (a *idempotenciaRedis) guardar(ctx context.Context, clave string, resp respuestaIdempotente, ttl time.Duration) error {
+	datos, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return a.cliente.Set(ctx, "idempotencia:"+clave, datos, ttl).Err()
+}
+
+func (a *idempotenciaRedis) liberar(ctx context.Context, clave string) error {
+	return a.cliente.Del(ctx, "idempotencia:"+clave).Err()
+}
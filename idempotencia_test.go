@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// registrarConClave envía POST /registro con el Idempotency-Key dado.
+func registrarConClave(handler http.Handler, clave, cuerpo string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, prefijoAPI+"/registro", strings.NewReader(cuerpo))
+	r.Header.Set(headerIdempotencia, clave)
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRegistroIdempotente(t *testing.T) {
+	handler := routerConcurrente(t)
+	enviados := mensajesEnviados(t)
+	usarRepositorio(t, nuevoRepositorioMemoria())
+	correo, telefono := cuentaNueva()
+	cuerpo := fmt.Sprintf(`{"correo":%q,"telefono":%q,"password":"Secreta@123"}`, correo, telefono)
+
+	primera := registrarConClave(handler, "clave-1", cuerpo)
+	if primera.Code != http.StatusCreated || primera.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("registro: status %d: %s", primera.Code, primera.Body)
+	}
+	enviadosAntes := len(*enviados)
+
+	// El reintento recibe la misma respuesta, con su propio request ID, sin
+	// volver a registrar ni a enviar mensajes.
+	reintento := registrarConClave(handler, "clave-1", cuerpo)
+	var sobre Sobre
+	if err := json.Unmarshal(reintento.Body.Bytes(), &sobre); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := sobre.Data.(map[string]any)
+	if reintento.Code != http.StatusCreated || reintento.Header().Get("Idempotent-Replayed") != "true" ||
+		data["mensaje"] != "Usuario registrado exitosamente" || sobre.Meta.RequestID != reintento.Header().Get(headerRequestID) {
+		t.Errorf("reintento: status %d, headers %v: %s", reintento.Code, reintento.Header(), reintento.Body)
+	}
+	if len(*enviados) != enviadosAntes {
+		t.Errorf("el reintento envió %v", (*enviados)[enviadosAntes:])
+	}
+
+	otroCorreo, otroTelefono := cuentaNueva()
+	casos := []struct {
+		nombre, clave, cuerpo string
+		status                int
+		codigo                string
+	}{
+		{"otro cuerpo", "clave-1", fmt.Sprintf(`{"correo":%q,"telefono":%q,"password":"Secreta@123"}`, otroCorreo, otroTelefono), http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUTILIZADA"},
+		{"clave demasiado larga", strings.Repeat("x", largoMaximoClaveIdempotencia+1), cuerpo, http.StatusBadRequest, "IDEMPOTENCY_KEY_INVALIDA"},
+		{"otra clave", "clave-2", cuerpo, http.StatusConflict, "CORREO_DUPLICADO"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			w := registrarConClave(handler, c.clave, c.cuerpo)
+			var sobre Sobre
+			if err := json.Unmarshal(w.Body.Bytes(), &sobre); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != c.status || sobre.Error == nil || sobre.Error.Codigo != c.codigo {
+				t.Errorf("status %d, respuesta %s; se esperaba %d con código %s", w.Code, w.Body, c.status, c.codigo)
+			}
+		})
+	}
+	if buscarUsuario(otroCorreo) != nil {
+		t.Errorf("se registró %s con una clave ya usada", otroCorreo)
+	}
+}
+
+func TestIdempotenteEnCursoYErrores(t *testing.T) {
+	probarIdempotencia(t, ConfigIdempotencia{TTL: time.Minute})
+}
+
+// probarIdempotencia comprueba el 409 de una clave en curso y que las
+// respuestas 5xx no se guardan con el almacenamiento de cfg; la usan
+// también las pruebas de integración con Redis.
+func probarIdempotencia(t *testing.T, cfg ConfigIdempotencia) {
+	idem, err := nuevaIdempotencia(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atendidas := 0
+	var enCurso *httptest.ResponseRecorder
+	var handler http.HandlerFunc
+	conClave := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/prueba", strings.NewReader("{}"))
+		r.Header.Set(headerIdempotencia, "clave")
+		handler(w, r)
+		return w
+	}
+	handler = idem.idempotente("prueba", func(w http.ResponseWriter, r *http.Request) {
+		atendidas++
+		if atendidas == 1 {
+			// Un reintento mientras la primera se atiende.
+			enCurso = conClave()
+			escribirJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Proveedor de identidad no disponible", Codigo: "PROVEEDOR_NO_DISPONIBLE"})
+			return
+		}
+		escribirJSON(w, http.StatusCreated, MensajeResponse{Mensaje: "Creado"})
+	})
+
+	if w := conClave(); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("primera petición: status %d: %s", w.Code, w.Body)
+	}
+	if enCurso.Code != http.StatusConflict || enCurso.Header().Get("Retry-After") != "1" {
+		t.Errorf("reintento en curso: status %d, Retry-After %q", enCurso.Code, enCurso.Header().Get("Retry-After"))
+	}
+	// El 503 no se guardó: el reintento vuelve a atenderse, y su respuesta
+	// sí se guarda.
+	for range 2 {
+		if w := conClave(); w.Code != http.StatusCreated {
+			t.Errorf("reintento: status %d: %s", w.Code, w.Body)
+		}
+	}
+	if atendidas != 2 {
+		t.Errorf("el handler se atendió %d veces, se esperaban 2", atendidas)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// idiomasSoportados son los idiomas en los que se responden los errores.
+// El primero es el de los mensajes en el código y el que se usa si el
+// cliente no pide ninguno soportado.
+var idiomasSoportados = language.NewMatcher([]language.Tag{language.Spanish, language.English})
+
+// Idiomas que un usuario puede elegir para sus correos (ver
+// Usuario.Idioma), con los códigos de idiomaDePeticion.
+const (
+	idiomaEspanol = "es"
+	idiomaIngles  = "en"
+	// idiomaPorDefecto es el de los usuarios que no eligieron ninguno y
+	// el de las plantillas de plantillas/correo.
+	idiomaPorDefecto = idiomaEspanol
+)
+
+// idiomasUsuario son los idiomas con plantillas de correo.
+var idiomasUsuario = []string{idiomaEspanol, idiomaIngles}
+
+// idiomaDePeticion elige el idioma de la respuesta según el header
+// Accept-Language.
+func idiomaDePeticion(r *http.Request) language.Tag {
+	tag, _ := language.MatchStrings(idiomasSoportados, r.Header.Get("Accept-Language"))
+	if base, _ := tag.Base(); base == language.MustParseBase("en") {
+		return language.English
+	}
+	return language.Spanish
+}
+
+// traduccion es el mensaje en inglés de los errores con un código.
+type traduccion struct {
+	en string
+	// plantilla es, si el mensaje en español conserva al traducirse una
+	// parte (el nombre de un campo o de un parámetro, una cantidad), ese
+	// mensaje con la parte marcada con %s, que en lleva en el mismo lugar.
+	// El mensaje que no sigue la plantilla se traduce con general.
+	plantilla, general string
+}
+
+// mensajesIngles traduce al inglés los errores de la API según su código
+// (ver codigoserror.go), de modo que reescribir un mensaje en español no
+// lo deja sin traducción. Un código sin traducción se responde en
+// español.
+var mensajesIngles = map[string]traduccion{
+	"ACCESO_DENEGADO":                  {en: "Access denied"},
+	"ADMIN_REQUERIDO":                  {en: "Administrator role required"},
+	"ASSERTION_SAML_INVALIDA":          {en: "Invalid SAML assertion"},
+	"ASSERTION_SAML_SIN_CORREO":        {en: "SAML assertion without a valid email"},
+	"AUTENTICACION_FEDERADA_RECHAZADA": {en: "Federated authentication rejected"},
+	"CAMBIO_PASSWORD_REQUERIDO":        {en: "You must change your password to continue"},
+	"CAMPO_DESCONOCIDO":                {plantilla: "Campo desconocido %s", en: "Unknown field %s", general: "Unknown field"},
+	"CAMPO_REQUERIDO":                  {plantilla: "Falta el campo %s", en: "Missing field %s", general: "Missing required field"},
+	"CANAL_INVALIDO":                   {en: "Invalid notification channel"},
+	"CODIGO_EXPIRADO":                  {en: "Code expired, request a new one"},
+	"CODIGO_INVALIDO":                  {en: "Invalid verification code"},
+	"CODIGO_REQUERIDO":                 {en: "The verification code is required"},
+	"COLA_NO_DISPONIBLE":               {en: "The task queue could not be queried"},
+	"CONFIGURACION_INVALIDA":           {plantilla: "Configuración inválida: %s", en: "Invalid configuration: %s", general: "Invalid configuration"},
+	"CONFLICTO":                        {en: "Conflict"},
+	"CORREO_DESECHABLE":                {en: "Disposable email addresses are not allowed"},
+	"CORREO_DUPLICADO":                 {en: "The email is already registered"},
+	"CORREO_INVALIDO":                  {en: "Invalid email"},
+	"CORREO_NO_MARCADO":                {en: "The email is not marked as invalid"},
+	"CORREO_NO_VERIFICADO":             {en: "The email has not been verified"},
+	"CORREO_SIN_CAMBIO":                {en: "The new email must be different from the current one"},
+	"CREDENCIALES_INVALIDAS":           {en: "Incorrect email or password"},
+	"CUENTA_ELIMINADA":                 {en: "The account was deleted"},
+	"CUENTA_LOCAL":                     {en: "The email belongs to an account with a password"},
+	"CUENTA_PROPIA":                    {en: "You cannot change the status of your own account"},
+	"CUENTA_SIN_PASSWORD":              {en: "The account has no password"},
+	"CUENTA_SUSPENDIDA":                {en: "The account is suspended"},
+	"CUERPO_DEMASIADO_GRANDE":          {plantilla: "El cuerpo excede el tamaño máximo de %s KB", en: "The body exceeds the maximum size of %s KB", general: "The body is too large"},
+	"CUERPO_INVALIDO":                  {en: "Invalid body"},
+	"CUERPO_MAL_FORMADO":               {plantilla: "JSON mal formado en la posición %s", en: "Malformed JSON at position %s", general: "Malformed body"},
+	"CUERPO_VACIO":                     {en: "The body is empty"},
+	"DEMASIADAS_PETICIONES":            {en: "Too many requests, try again later"},
+	"DEMASIADOS_SMS":                   {en: "Too many codes sent to this phone, try again later"},
+	"DOMINIO_SIN_MX":                   {en: "The email domain does not accept mail"},
+	"DOSFA_INACTIVO":                   {en: "Two-factor authentication is not enabled"},
+	"DOSFA_REQUERIDO":                  {en: "You must enable two-factor authentication to continue"},
+	"DOSFA_SIN_ACTIVACION":             {en: "There is no pending two-factor activation"},
+	"DOSFA_YA_ACTIVO":                  {en: "Two-factor authentication is already enabled"},
+	"ENVIO_FALLIDO":                    {en: "The message could not be sent"},
+	"ERROR_INTERNO":                    {en: "Internal server error"},
+	"ESTADO_INVALIDO":                  {en: "Invalid status"},
+	"ESTADO_OIDC_INVALIDO":             {en: "Invalid OIDC state"},
+	"FIRMA_INVALIDA":                   {en: "Invalid signature"},
+	"FLAG_DE_CONFIGURACION":            {en: "Feature flags are defined in the configuration"},
+	"FLAG_NO_ENCONTRADA":               {en: "Feature flag not found"},
+	"FLAG_NO_GUARDADA":                 {en: "The feature flag could not be saved"},
+	"FORMATO_NO_SOPORTADO":             {plantilla: "El endpoint no acepta %s", en: "The endpoint does not accept %s", general: "Unsupported format"},
+	"IDEMPOTENCY_KEY_EN_CURSO":         {en: "A request with the same Idempotency-Key is in progress"},
+	"IDEMPOTENCY_KEY_INVALIDA":         {en: "Invalid Idempotency-Key"},
+	"IDEMPOTENCY_KEY_REUTILIZADA":      {en: "The Idempotency-Key was already used with a different request"},
+	"IDIOMA_NO_SOPORTADO":              {en: "Unsupported language"},
+	"METODO_NO_PERMITIDO":              {en: "Method not allowed"},
+	"NO_AUTENTICADO":                   {en: "Not authenticated"},
+	"NO_ENCONTRADO":                    {en: "Not found"},
+	"PAGINACION_INVALIDA":              {en: "The page and cursor parameters cannot be combined"},
+	"PARAMETRO_INVALIDO":               {plantilla: "Parámetro %s inválido", en: "Invalid parameter %s", general: "Invalid parameter"},
+	"PARAMETRO_REQUERIDO":              {plantilla: "Falta el parámetro %s", en: "Missing parameter %s", general: "Missing required parameter"},
+	"PASSWORD_ACTUAL_INCORRECTA":       {en: "Current password is incorrect"},
+	"PASSWORD_INCORRECTA":              {en: "Incorrect password"},
+	"PASSWORD_INVALIDA":                {en: "Invalid password"},
+	"PASSWORD_SIN_CAMBIO":              {en: "The new password must be different from the current one"},
+	"PETICION_INVALIDA":                {en: "Invalid request"},
+	"PROVEEDOR_NO_DISPONIBLE":          {en: "Identity provider unavailable"},
+	"REAUTENTICACION_REQUERIDA":        {en: "Re-authentication required"},
+	"REGISTRO_CERRADO":                 {en: "Sign-up is closed"},
+	"RUTA_NO_ENCONTRADA":               {en: "Route not found"},
+	"SERVICIO_NO_DISPONIBLE":           {en: "Service unavailable"},
+	"SERVIDOR_SATURADO":                {en: "The server is overloaded, try again later"},
+	"SIN_TELEFONO":                     {en: "The user has no registered phone"},
+	"SMS_NO_DISPONIBLE":                {en: "The account has no two-factor authentication with a verified phone"},
+	"SUSCRIPCION_NO_CONFIRMADA":        {en: "The subscription could not be confirmed"},
+	"TAREA_NO_ENCONTRADA":              {en: "Task not found"},
+	"TELEFONO_DUPLICADO":               {en: "The phone is already registered"},
+	"TELEFONO_INVALIDO":                {en: "Invalid phone"},
+	"TELEFONO_NO_VERIFICADO":           {en: "Verify your phone to receive SMS"},
+	"TELEFONO_YA_VERIFICADO":           {en: "The phone is already verified"},
+	"TIPO_INVALIDO":                    {plantilla: "Tipo inválido en el campo %s", en: "Invalid type in field %s", general: "Invalid type"},
+	"TOKEN_INVALIDO":                   {en: "Invalid or expired token"},
+	"TOKEN_PROVEEDOR_INVALIDO":         {en: "Invalid provider token"},
+	"TOKEN_REQUERIDO":                  {en: "Missing token"},
+	"TOPICO_NO_PERMITIDO":              {en: "Topic not allowed"},
+	"USUARIO_NO_ENCONTRADO":            {en: "User not found"},
+}
+
+// mensajesCampoIngles traduce los errores por campo según su código; %s
+// es el nombre del campo.
+var mensajesCampoIngles = map[string]string{
+	codigoRequerido:       "Missing field %s",
+	codigoFormatoInvalido: "Invalid value in field %s",
+	codigoDuplicado:       "The value of field %s is already registered",
+	codigoNoPermitido:     "Value not allowed in field %s",
+	codigoSinMX:           "The email domain in field %s does not accept mail",
+}
+
+// reglasIngles traduce las reglas de contraseña incumplidas de
+// errores[].reglas, que no llevan código, con la parte variable marcada
+// con %s, que se conserva tal cual.
+var reglasIngles = []struct{ es, en string }{
+	{"Debe incluir un carácter especial de %s o un símbolo Unicode", "Must include a special character from %s or a Unicode symbol"},
+	{"Debe incluir un carácter especial de %s", "Must include a special character from %s"},
+	{"Debe incluir un número", "Must include a number"},
+	{"Debe incluir una mayúscula", "Must include an uppercase letter"},
+	{"Debe incluir una minúscula", "Must include a lowercase letter"},
+	{"Debe tener al menos %s caracteres", "Must be at least %s characters long"},
+	{"Debe tener como máximo %s caracteres", "Must be at most %s characters long"},
+}
+
+// traducirError devuelve el mensaje de un error con el código dado en el
+// idioma pedido. Los errores sin traducción se devuelven en español.
+func traducirError(codigo, mensaje string, idioma language.Tag) string {
+	t, ok := mensajesIngles[codigo]
+	if idioma != language.English || !ok {
+		return mensaje
+	}
+	if t.plantilla == "" {
+		return t.en
+	}
+	if valor, ok := valorDePlantilla(mensaje, t.plantilla); ok {
+		return strings.Replace(t.en, "%s", valor, 1)
+	}
+	return t.general
+}
+
+// traducirRegla devuelve una regla de contraseña incumplida en el idioma
+// pedido.
+func traducirRegla(regla string, idioma language.Tag) string {
+	if idioma != language.English {
+		return regla
+	}
+	for _, p := range reglasIngles {
+		if p.es == regla {
+			return p.en
+		}
+		if valor, ok := valorDePlantilla(regla, p.es); ok {
+			return strings.Replace(p.en, "%s", valor, 1)
+		}
+	}
+	return regla
+}
+
+// valorDePlantilla indica si el mensaje sigue la plantilla, con su parte
+// variable marcada con %s, y devuelve esa parte.
+func valorDePlantilla(mensaje, plantilla string) (string, bool) {
+	antes, despues, ok := strings.Cut(plantilla, "%s")
+	if ok && len(mensaje) > len(antes)+len(despues) && strings.HasPrefix(mensaje, antes) && strings.HasSuffix(mensaje, despues) {
+		return mensaje[len(antes) : len(mensaje)-len(despues)], true
+	}
+	return "", false
+}
+
+// idiomaMiddleware responde los errores en el idioma del header
+// Accept-Language (español o inglés). Los handlers escriben sus mensajes
+// en español; en las respuestas con status 4xx o 5xx se traducen los
+// campos error, errores[].mensaje y errores[].reglas del cuerpo JSON (en
+// la API, los de su objeto error, o el detail de un Problema) con los
+// catálogos de este archivo. El resto de la respuesta no se modifica.
+func idiomaMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idioma := idiomaDePeticion(r)
+		w.Header().Add("Vary", "Accept-Language")
+		w.Header().Set("Content-Language", idioma.String())
+		if idioma == language.Spanish {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rt := &respuestaTraducida{ResponseWriter: w, idioma: idioma}
+		next.ServeHTTP(rt, r)
+		rt.terminar()
+	})
+}
+
+// respuestaTraducida acumula el cuerpo de las respuestas de error para
+// traducirlo al terminar el handler; las demás pasan sin cambios.
+type respuestaTraducida struct {
+	http.ResponseWriter
+	idioma    language.Tag
+	iniciada  bool
+	acumulada bool
+	cuerpo    bytes.Buffer
+}
+
+func (w *respuestaTraducida) WriteHeader(status int) {
+	if !w.iniciada && status >= http.StatusBadRequest {
+		w.acumulada = true
+		w.Header().Del("Content-Length")
+	}
+	w.iniciada = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *respuestaTraducida) Write(b []byte) (int, error) {
+	w.iniciada = true
+	if w.acumulada {
+		return w.cuerpo.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap permite a http.ResponseController llegar al writer original.
+func (w *respuestaTraducida) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// terminar escribe el cuerpo acumulado, traducido si es un error JSON.
+func (w *respuestaTraducida) terminar() {
+	if !w.acumulada {
+		return
+	}
+	w.ResponseWriter.Write(traducirCuerpoError(w.cuerpo.Bytes(), w.idioma))
+}
+
+// traducirCuerpoError traduce los campos error y errores[].mensaje de un
+// cuerpo JSON, los de error si es el objeto de un Sobre y el detail de
+// un Problema. Si el cuerpo no es un objeto JSON se devuelve igual.
+func traducirCuerpoError(cuerpo []byte, idioma language.Tag) []byte {
+	var campos map[string]json.RawMessage
+	if err := json.Unmarshal(cuerpo, &campos); err != nil {
+		return cuerpo
+	}
+	var mensaje, codigo string
+	json.Unmarshal(campos["codigo"], &codigo)
+	if err := json.Unmarshal(campos["detail"], &mensaje); err == nil {
+		campos["detail"], _ = json.Marshal(traducirError(codigo, mensaje, idioma))
+	}
+	var enSobre *ErrorSobre
+	if err := json.Unmarshal(campos["error"], &mensaje); err == nil {
+		campos["error"], _ = json.Marshal(traducirError(codigo, mensaje, idioma))
+	} else if err := json.Unmarshal(campos["error"], &enSobre); err == nil && enSobre != nil {
+		enSobre.Mensaje = traducirError(enSobre.Codigo, enSobre.Mensaje, idioma)
+		enSobre.Errores = traducirErroresCampo(enSobre.Errores, idioma)
+		campos["error"], _ = json.Marshal(enSobre)
+	}
+	var errores []ErrorCampo
+	if err := json.Unmarshal(campos["errores"], &errores); err == nil && errores != nil {
+		campos["errores"], _ = json.Marshal(traducirErroresCampo(errores, idioma))
+	}
+	traducido, err := json.Marshal(campos)
+	if err != nil {
+		return cuerpo
+	}
+	return append(traducido, '\n')
+}
+
+// traducirErroresCampo devuelve una copia de los errores por campo con el
+// mensaje y las reglas traducidos.
+func traducirErroresCampo(errores []ErrorCampo, idioma language.Tag) []ErrorCampo {
+	traducidos := make([]ErrorCampo, len(errores))
+	for i, e := range errores {
+		if plantilla, ok := mensajesCampoIngles[e.Codigo]; ok && idioma == language.English {
+			e.Mensaje = fmt.Sprintf(plantilla, e.Campo)
+		}
+		e.Reglas = slices.Clone(e.Reglas)
+		for j := range e.Reglas {
+			e.Reglas[j] = traducirRegla(e.Reglas[j], idioma)
+		}
+		traducidos[i] = e
+	}
+	return traducidos
+}
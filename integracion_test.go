@@ -0,0 +1,227 @@
+//go:build integracion
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+)
+
+// Las pruebas de integración levantan Redis en un contenedor efímero con
+// testcontainers y recorren el flujo completo por HTTP, con el router y
+// las tareas, las feature flags y el límite de peticiones en Redis:
+//
+//	go test -tags integracion -run Integracion .
+//
+// Necesitan Docker. Con REDIS_URL_PRUEBAS se usa ese Redis en lugar de
+// levantar un contenedor (p. ej. un service container del CI); sus datos
+// se borran al empezar. Los usuarios se guardan en memoria, la única
+// opción de ALMACENAMIENTO, por lo que no hay base de datos que levantar.
+
+// imagenRedis es la imagen del contenedor de Redis.
+const imagenRedis = "redis:7-alpine"
+
+// redisIntegracion devuelve la URL de un Redis vacío para la prueba.
+func redisIntegracion(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+	url := os.Getenv("REDIS_URL_PRUEBAS")
+	if url == "" {
+		contenedor, err := tcredis.Run(ctx, imagenRedis)
+		if err != nil {
+			t.Fatalf("no se pudo levantar Redis en un contenedor: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := contenedor.Terminate(context.Background()); err != nil {
+				t.Errorf("no se pudo detener el contenedor de Redis: %v", err)
+			}
+		})
+		if url, err = contenedor.ConnectionString(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opciones, err := redis.ParseURL(url)
+	if err != nil {
+		t.Fatalf("REDIS_URL_PRUEBAS=%q: %v", url, err)
+	}
+	cliente := redis.NewClient(opciones)
+	defer cliente.Close()
+	if err := cliente.FlushDB(ctx).Err(); err != nil {
+		t.Fatalf("no se pudo vaciar Redis: %v", err)
+	}
+	return url
+}
+
+// servicioIntegracion configura las tareas, las feature flags y el límite
+// de peticiones contra redisURL, como comandoServe con REDIS_URL, y
+// levanta el router en un servidor de prueba.
+func servicioIntegracion(t *testing.T, redisURL string) *httptest.Server {
+	t.Helper()
+	prepararHandlers(t)
+	t.Setenv("REDIS_URL", redisURL)
+	t.Setenv("TAREAS_BACKEND", "redis")
+	t.Setenv("TAREAS_BACKOFF", "10ms")
+	t.Setenv("FLAGS_BACKEND", "redis")
+
+	cfg, err := cargarConfigTareas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tareasAntes, funcionalidadesAntes := tareas, funcionalidades
+	if tareas, err = nuevosTrabajadoresTareas(cfg); err != nil {
+		t.Fatalf("tareas en Redis: %v", err)
+	}
+	if funcionalidades, err = nuevasFeatureFlags(); err != nil {
+		t.Fatalf("feature flags en Redis: %v", err)
+	}
+
+	srv := httptest.NewServer(requestIDMiddleware(recuperacionMiddleware(nuevoRouter())))
+	t.Cleanup(func() {
+		srv.Close()
+		tareas.cerrar()
+		tareas, funcionalidades = tareasAntes, funcionalidadesAntes
+	})
+	return srv
+}
+
+// peticion envía una petición JSON al servidor y devuelve la respuesta
+// con el cuerpo ya leído en el destino, si se indica. De las respuestas
+// de la API se lee el data del sobre o, si fallaron, el error.
+func peticion(t *testing.T, srv *httptest.Server, metodo, ruta, token, cuerpo string, destino any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(metodo, srv.URL+ruta, strings.NewReader(cuerpo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", tipoJSON)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", metodo, ruta, err)
+	}
+	defer resp.Body.Close()
+	if destino == nil {
+		return resp
+	}
+	if !strings.HasPrefix(ruta, prefijoAPI) {
+		if err := json.NewDecoder(resp.Body).Decode(destino); err != nil {
+			t.Fatalf("%s %s: respuesta inválida: %v", metodo, ruta, err)
+		}
+		return resp
+	}
+	var sobre struct {
+		Data  json.RawMessage `json:"data"`
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sobre); err != nil {
+		t.Fatalf("%s %s: respuesta inválida: %v", metodo, ruta, err)
+	}
+	contenido := sobre.Data
+	if resp.StatusCode >= http.StatusBadRequest {
+		contenido = sobre.Error
+	}
+	if err := json.Unmarshal(contenido, destino); err != nil {
+		t.Fatalf("%s %s: respuesta inválida: %v", metodo, ruta, err)
+	}
+	return resp
+}
+
+// enlaceVerificacion extrae el token del enlace de verificación de correo.
+var enlaceVerificacion = regexp.MustCompile(`/verificar-correo\?token=([\w-]+)`)
+
+func TestIntegracionRegistroLoginPerfil(t *testing.T) {
+	url := redisIntegracion(t)
+
+	// Los correos los envía un trabajador de la cola en Redis, en otra
+	// goroutine.
+	correos := make(chan string, 10)
+	enviarCorreoAntes, enviarSMSAntes := enviarCorreo, enviarSMS
+	enviarCorreo = func(_ context.Context, m mensajeCorreo) error {
+		correos <- m.Destinatario + "\n" + m.Cuerpo
+		return nil
+	}
+	enviarSMS = func(context.Context, string, string) error { return nil }
+	t.Cleanup(func() { enviarCorreo, enviarSMS = enviarCorreoAntes, enviarSMSAntes })
+
+	srv := servicioIntegracion(t, url)
+
+	var salud SaludResponse
+	if resp := peticion(t, srv, http.MethodGet, "/readyz", "", "", &salud); resp.StatusCode != http.StatusOK {
+		t.Fatalf("readyz: status %d: %+v", resp.StatusCode, salud)
+	}
+
+	// La verificación de correo se exige desde la flag en Redis.
+	opciones, _ := redis.ParseURL(url)
+	cliente := redis.NewClient(opciones)
+	defer cliente.Close()
+	if err := cliente.HSet(context.Background(), claveFlagsRedis, flagVerificacionCorreo, "true").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	correo, telefono := cuentaNueva()
+	registro := fmt.Sprintf(`{"correo":%q,"telefono":%q,"password":"Secreta@123"}`, correo, telefono)
+	if resp := peticion(t, srv, http.MethodPost, prefijoAPI+"/registro", "", registro, nil); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("registro: status %d", resp.StatusCode)
+	}
+
+	login := fmt.Sprintf(`{"correo":%q,"password":"Secreta@123"}`, correo)
+	var errLogin ErrorSobre
+	if resp := peticion(t, srv, http.MethodPost, prefijoAPI+"/login", "", login, &errLogin); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("login sin verificar: status %d: %+v", resp.StatusCode, errLogin)
+	}
+
+	var mensaje string
+	select {
+	case mensaje = <-correos:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no llegó el correo de verificación")
+	}
+	if !strings.HasPrefix(mensaje, correo+"\n") {
+		t.Fatalf("correo de verificación para otro destinatario: %q", mensaje)
+	}
+	enlace := enlaceVerificacion.FindStringSubmatch(mensaje)
+	if enlace == nil {
+		t.Fatalf("el correo no trae el enlace de verificación: %q", mensaje)
+	}
+	if resp := peticion(t, srv, http.MethodGet, prefijoAPI+"/verificar-correo?token="+enlace[1], "", "", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("verificar correo: status %d", resp.StatusCode)
+	}
+
+	var sesion LoginResponse
+	if resp := peticion(t, srv, http.MethodPost, prefijoAPI+"/login", "", login, &sesion); resp.StatusCode != http.StatusOK {
+		t.Fatalf("login: status %d", resp.StatusCode)
+	}
+
+	var perfil PerfilResponse
+	if resp := peticion(t, srv, http.MethodGet, prefijoAPI+"/perfil", sesion.Token, "", &perfil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("perfil: status %d", resp.StatusCode)
+	}
+	esperado := PerfilResponse{ID: perfil.ID, Correo: correo, Telefono: "+52" + telefono, CorreoVerificado: true}
+	if perfil.ID == "" || perfil != esperado {
+		t.Errorf("perfil %+v, se esperaba %+v", perfil, esperado)
+	}
+	if resp := peticion(t, srv, http.MethodGet, prefijoAPI+"/perfil", "", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("perfil sin token: status %d, se esperaba %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestIntegracionTareasFallidas(t *testing.T) {
+	probarTareasFallidas(t, ConfigTareas{Backend: "redis", RedisURL: redisIntegracion(t)})
+}
+
+func TestIntegracionIdempotencia(t *testing.T) {
+	probarIdempotencia(t, ConfigIdempotencia{TTL: time.Minute, RedisURL: redisIntegracion(t)})
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LimiteTasa define una cubeta de tokens: admite ráfagas de hasta
+// Capacidad peticiones y se recarga por completo en Periodo. Una
+// capacidad de cero desactiva el límite.
+type LimiteTasa struct {
+	Capacidad int
+	Periodo   time.Duration
+}
+
+// ConfigLimites agrupa los límites de petición por endpoint y el
+// almacenamiento donde se guardan las cubetas.
+type ConfigLimites struct {
+	LoginIP     LimiteTasa
+	LoginCuenta LimiteTasa
+	RegistroIP  LimiteTasa
+	ReenvioIP   LimiteTasa
+	SMSDestino  LimiteTasa
+	RedisURL    string
+}
+
+// limite devuelve el límite de la regla con ese nombre.
+func (c ConfigLimites) limite(regla string) LimiteTasa {
+	switch regla {
+	case "login":
+		return c.LoginIP
+	case "login_cuenta":
+		return c.LoginCuenta
+	case "registro":
+		return c.RegistroIP
+	case "reenvio":
+		return c.ReenvioIP
+	case "sms_destino":
+		return c.SMSDestino
+	}
+	return LimiteTasa{}
+}
+
+// limitesVigentes son los límites que aplican las reglas. Se pueden
+// reemplazar en caliente con recargarConfig; el almacenamiento (REDIS_URL)
+// sólo se elige al arrancar.
+var limitesVigentes atomic.Pointer[ConfigLimites]
+
+// cargarConfigLimites lee los límites de las variables de entorno
+// LIMITE_LOGIN_IP, LIMITE_LOGIN_CUENTA, LIMITE_REGISTRO_IP,
+// LIMITE_REENVIO_IP y LIMITE_SMS_DESTINO, con formato "peticiones/periodo"
+// (p. ej. "10/1m"), y REDIS_URL para compartir las cubetas entre
+// instancias.
+func cargarConfigLimites() ConfigLimites {
+	return ConfigLimites{
+		LoginIP:     limiteEntorno("LIMITE_LOGIN_IP", LimiteTasa{20, time.Minute}),
+		LoginCuenta: limiteEntorno("LIMITE_LOGIN_CUENTA", LimiteTasa{5, 15 * time.Minute}),
+		RegistroIP:  limiteEntorno("LIMITE_REGISTRO_IP", LimiteTasa{5, time.Hour}),
+		ReenvioIP:   limiteEntorno("LIMITE_REENVIO_IP", LimiteTasa{5, time.Hour}),
+		SMSDestino:  limiteEntorno("LIMITE_SMS_DESTINO", LimiteTasa{5, time.Hour}),
+		RedisURL:    opcion("REDIS_URL"),
+	}
+}
+
+// limiteEntorno interpreta una variable con formato "peticiones/periodo".
+// Un valor inválido se ignora y se usa el límite por defecto.
+func limiteEntorno(nombre string, porDefecto LimiteTasa) LimiteTasa {
+	v := opcion(nombre)
+	if v == "" {
+		return porDefecto
+	}
+	cantidad, periodo, ok := strings.Cut(v, "/")
+	n, errN := strconv.Atoi(strings.TrimSpace(cantidad))
+	d, errD := time.ParseDuration(strings.TrimSpace(periodo))
+	if !ok || errN != nil || errD != nil || n < 0 || d <= 0 {
+		slog.Warn("Valor inválido; se usa el límite por defecto", "variable", nombre, "valor", v)
+		return porDefecto
+	}
+	return LimiteTasa{Capacidad: n, Periodo: d}
+}
+
+// almacenLimites consume un token de la cubeta identificada por clave.
+// Si no quedan tokens devuelve cuánto falta para el siguiente.
+type almacenLimites interface {
+	consumir(ctx context.Context, clave string, limite LimiteTasa) (espera time.Duration, err error)
+}
+
+// reglaLimite aplica el límite vigente con su nombre a las peticiones
+// agrupadas por la clave que devuelve clave; una clave vacía deja pasar
+// la petición.
+type reglaLimite struct {
+	nombre string
+	clave  func(r *http.Request) string
+}
+
+// porIP agrupa las peticiones por la IP del cliente.
+func porIP(nombre string) reglaLimite {
+	return reglaLimite{nombre: nombre, clave: ipCliente}
+}
+
+// porCuenta agrupa las peticiones por el campo correo del cuerpo JSON, de
+// modo que un ataque repartido entre muchas IPs contra una misma cuenta
+// también se limita. El cuerpo se restaura para el handler; se lee a lo
+// sumo un byte más que tamanoMaximoCuerpo para que el handler siga
+// detectando los cuerpos demasiado grandes.
+func porCuenta(nombre string) reglaLimite {
+	return reglaLimite{nombre: nombre, clave: func(r *http.Request) string {
+		cuerpo, err := io.ReadAll(io.LimitReader(r.Body, tamanoMaximoCuerpo+1))
+		r.Body = io.NopCloser(bytes.NewReader(cuerpo))
+		if err != nil {
+			return ""
+		}
+		var req struct {
+			Correo string `json:"correo"`
+		}
+		json.Unmarshal(cuerpo, &req)
+		return strings.ToLower(strings.TrimSpace(req.Correo))
+	}}
+}
+
+// limitador aplica reglas de límite de peticiones sobre un almacenamiento
+// de cubetas en memoria o en Redis.
+type limitador struct {
+	almacen almacenLimites
+}
+
+// nuevoLimitador usa Redis si REDIS_URL está configurada y, si no, un
+// almacenamiento en memoria local al proceso. Los límites de cfg pasan a
+// ser los vigentes.
+func nuevoLimitador(cfg ConfigLimites) (*limitador, error) {
+	limitesVigentes.Store(&cfg)
+	if cfg.RedisURL == "" {
+		return &limitador{almacen: nuevoAlmacenMemoria()}, nil
+	}
+	opciones, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+	return &limitador{almacen: &almacenRedis{cliente: redis.NewClient(opciones)}}, nil
+}
+
+// limitar protege un handler con las reglas dadas. Si alguna se excede
+// responde 429 con el header Retry-After en segundos.
+func (l *limitador) limitar(reglas ...reglaLimite) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if espera := l.espera(r, reglas...); espera > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(espera.Seconds()))))
+				escribirJSON(w, http.StatusTooManyRequests, ErrorResponse{Error: "Demasiadas peticiones, intenta más tarde", Codigo: "DEMASIADAS_PETICIONES"})
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// espera consume un token de cada regla para la petición y devuelve
+// cuánto falta para poder repetirla si alguna se excedió, o cero. Ante un
+// error del almacenamiento la petición se deja pasar para no tumbar el
+// login.
+func (l *limitador) espera(r *http.Request, reglas ...reglaLimite) time.Duration {
+	for _, regla := range reglas {
+		if limitesVigentes.Load().limite(regla.nombre).Capacidad == 0 {
+			continue
+		}
+		clave := regla.clave(r)
+		if clave == "" {
+			continue
+		}
+		if espera := l.consumir(r.Context(), regla.nombre, clave); espera > 0 {
+			return espera
+		}
+	}
+	return 0
+}
+
+// consumir consume un token de la cubeta de la regla para la clave y
+// devuelve cuánto falta para el siguiente si no quedaban, o cero. Como en
+// espera, un error del almacenamiento deja pasar la operación.
+func (l *limitador) consumir(ctx context.Context, regla, clave string) time.Duration {
+	limite := limitesVigentes.Load().limite(regla)
+	if limite.Capacidad == 0 {
+		return 0
+	}
+	espera, err := l.almacen.consumir(ctx, regla+":"+clave, limite)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error consultando el límite de peticiones", "error", err)
+		return 0
+	}
+	if espera > 0 {
+		slog.WarnContext(ctx, "Límite de peticiones excedido", "regla", regla)
+	}
+	return espera
+}
+
+// chequeos devuelve las verificaciones de readiness del almacenamiento:
+// ninguna en memoria y un PING si las cubetas viven en Redis.
+func (l *limitador) chequeos() []chequeoListo {
+	if a, ok := l.almacen.(*almacenRedis); ok {
+		return []chequeoListo{{nombre: "redis", verificar: func(ctx context.Context) error {
+			return a.cliente.Ping(ctx).Err()
+		}}}
+	}
+	return nil
+}
+
+// cubeta es el estado de una cubeta de tokens en memoria.
+type cubeta struct {
+	tokens      float64
+	actualizada time.Time
+}
+
+// almacenMemoria guarda las cubetas en el proceso. Las que ya se
+// recargaron por completo se descartan periódicamente.
+type almacenMemoria struct {
+	mu             sync.Mutex
+	cubetas        map[string]*cubeta
+	periodos       map[string]time.Duration
+	ultimaLimpieza time.Time
+}
+
+func nuevoAlmacenMemoria() *almacenMemoria {
+	return &almacenMemoria{
+		cubetas:        map[string]*cubeta{},
+		periodos:       map[string]time.Duration{},
+		ultimaLimpieza: time.Now(),
+	}
+}
+
+func (a *almacenMemoria) consumir(_ context.Context, clave string, limite LimiteTasa) (time.Duration, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ahora := time.Now()
+	if ahora.Sub(a.ultimaLimpieza) > time.Minute {
+		a.limpiar(ahora)
+	}
+
+	capacidad := float64(limite.Capacidad)
+	recargaPorSegundo := capacidad / limite.Periodo.Seconds()
+	c, ok := a.cubetas[clave]
+	if !ok {
+		c = &cubeta{tokens: capacidad, actualizada: ahora}
+		a.cubetas[clave] = c
+		a.periodos[clave] = limite.Periodo
+	}
+	c.tokens = math.Min(capacidad, c.tokens+ahora.Sub(c.actualizada).Seconds()*recargaPorSegundo)
+	c.actualizada = ahora
+
+	if c.tokens < 1 {
+		faltante := (1 - c.tokens) / recargaPorSegundo
+		return time.Duration(faltante * float64(time.Second)), nil
+	}
+	c.tokens--
+	return 0, nil
+}
+
+// limpiar descarta las cubetas sin uso durante al menos un periodo, que
+// ya estarían llenas.
+func (a *almacenMemoria) limpiar(ahora time.Time) {
+	for clave, c := range a.cubetas {
+		if ahora.Sub(c.actualizada) >= a.periodos[clave] {
+			delete(a.cubetas, clave)
+			delete(a.periodos, clave)
+		}
+	}
+	a.ultimaLimpieza = ahora
+}
+
+// scriptCubeta implementa la cubeta de tokens de forma atómica en Redis
+// usando el reloj del servidor, para que varias instancias compartan el
+// mismo estado. Devuelve los milisegundos de espera, o 0 si se admitió.
+var scriptCubeta = redis.NewScript(`
+local capacidad = tonumber(ARGV[1])
+local periodo = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local ahora = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local datos = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(datos[1]) or capacidad
+local ts = tonumber(datos[2]) or ahora
+tokens = math.min(capacidad, tokens + (ahora - ts) * capacidad / periodo)
+local espera = 0
+if tokens < 1 then
+  espera = math.ceil((1 - tokens) * periodo / capacidad)
+else
+  tokens = tokens - 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ahora)
+redis.call('PEXPIRE', KEYS[1], periodo)
+return espera
+`)
+
+// almacenRedis guarda las cubetas en Redis bajo el prefijo "limite:".
+type almacenRedis struct {
+	cliente *redis.Client
+}
+
+func (a *almacenRedis) consumir(ctx context.Context, clave string, limite LimiteTasa) (time.Duration, error) {
+	ms, err := scriptCubeta.Run(ctx, a.cliente, []string{"limite:" + clave},
+		limite.Capacidad, limite.Periodo.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"pruebasgo/validacion"
+)
+
+// Parámetros de los códigos de inicio de sesión por SMS.
+const (
+	vigenciaCodigoLogin    = 5 * time.Minute
+	maxIntentosCodigoLogin = 5
+)
+
+// CodigoLoginRequest define la estructura esperada para la petición
+// POST /login/codigo-sms.
+type CodigoLoginRequest struct {
+	Correo   string `json:"correo"`
+	Password string `json:"password"`
+}
+
+// enviarCodigoLoginHandler envía por SMS un código de segundo factor al
+// teléfono verificado de un usuario con 2FA activo, como alternativa a la
+// app autenticadora. Exige las credenciales, igual que /login, para que
+// nadie pueda hacer que se envíen SMS a una cuenta ajena. El código se
+// usa después como campo codigo de /login.
+func enviarCodigoLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req CodigoLoginRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+	req.Correo = validacion.NormalizarCorreo(req.Correo)
+	if req.Correo == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo correo", Codigo: "CAMPO_REQUERIDO"})
+		return
+	}
+	if req.Password == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo password", Codigo: "CAMPO_REQUERIDO"})
+		return
+	}
+
+	usuario := buscarUsuario(req.Correo)
+	if usuario != nil {
+		defer usuario.bloquear()()
+		if usuario.Password != req.Password {
+			usuario = nil
+		}
+	}
+	if usuario == nil {
+		slog.WarnContext(r.Context(), "Código de login rechazado: credenciales incorrectas", "correo", req.Correo)
+		auditar(r, "login_fallido", req.Correo, "", "credenciales_incorrectas")
+		seguridad.loginFallido(r, req.Correo)
+		escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Correo o contraseña incorrectos", Codigo: "CREDENCIALES_INVALIDAS"})
+		return
+	}
+	if errServicio := errorCuentaInactiva(r, usuario); errServicio != nil {
+		responderErrorServicio(w, errServicio)
+		return
+	}
+	if !usuario.DosFAActivo || !usuario.TelefonoVerificado {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "La cuenta no tiene segundo factor con un teléfono verificado", Codigo: "SMS_NO_DISPONIBLE"})
+		return
+	}
+
+	if err := enviarCodigoLogin(r.Context(), usuario); err != nil {
+		responderErrorSMS(w, r, err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Código de login enviado por SMS", "correo", usuario.Correo)
+	escribirJSON(w, http.StatusAccepted, MensajeResponse{Mensaje: "Código enviado"})
+}
+
+// enviarCodigoLogin genera un código de 6 dígitos, guarda su hash y lo
+// envía por SMS al teléfono del usuario. Reemplaza al código anterior.
+func enviarCodigoLogin(ctx context.Context, usuario *Usuario) error {
+	codigo, err := codigoSMS()
+	if err != nil {
+		return err
+	}
+	if err := encolarSMS(ctx, usuario.Telefono, plantillaSMSLogin, datosPlantillaSMS{
+		Codigo: codigo, Minutos: int(vigenciaCodigoLogin.Minutes()),
+	}); err != nil {
+		return err
+	}
+	usuario.CodigoLogin = hashToken(codigo)
+	usuario.VenceCodigoLogin = time.Now().Add(vigenciaCodigoLogin)
+	usuario.IntentosCodigoLogin = 0
+	return nil
+}
+
+// verificarCodigoLogin acepta el código enviado por SMS si está vigente y
+// no se agotaron los intentos; se consume al validarse.
+func verificarCodigoLogin(usuario *Usuario, codigo string) bool {
+	if usuario.CodigoLogin == "" || time.Now().After(usuario.VenceCodigoLogin) ||
+		usuario.IntentosCodigoLogin >= maxIntentosCodigoLogin {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(codigo)), []byte(usuario.CodigoLogin)) != 1 {
+		usuario.IntentosCodigoLogin++
+		return false
+	}
+	usuario.CodigoLogin = ""
+	registrarEvento(usuario, "codigo_sms_usado")
+	return true
+}
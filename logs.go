@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// claveAtributosLog guarda en el contexto los atributos de la petición que
+// se agregan a cada línea de log.
+const claveAtributosLog claveContexto = "atributos_log"
+
+// nivelLogs es el nivel mínimo vigente; recargarConfig lo cambia en
+// caliente.
+var nivelLogs slog.LevelVar
+
+// configurarLogs instala el logger por defecto de slog. LOG_FORMATO=json
+// emite una línea JSON por registro (por defecto texto clave=valor) y
+// LOG_NIVEL fija el nivel mínimo: debug, info (por defecto), warn o error.
+// Todos los atributos pasan por redactarPII antes de escribirse.
+func configurarLogs() {
+	nivelLogs.Set(nivelLog(opcion("LOG_NIVEL")))
+	opciones := &slog.HandlerOptions{
+		Level:       &nivelLogs,
+		ReplaceAttr: redactarPII,
+	}
+	var h slog.Handler
+	if strings.EqualFold(opcion("LOG_FORMATO"), "json") {
+		h = slog.NewJSONHandler(os.Stderr, opciones)
+	} else {
+		h = slog.NewTextHandler(os.Stderr, opciones)
+	}
+	slog.SetDefault(slog.New(manejadorContexto{h}))
+}
+
+// nivelLog interpreta el nombre de un nivel; un valor desconocido
+// equivale a info.
+func nivelLog(nombre string) slog.Level {
+	var nivel slog.Level
+	if err := nivel.UnmarshalText([]byte(nombre)); err != nil {
+		return slog.LevelInfo
+	}
+	return nivel
+}
+
+// manejadorContexto agrega a cada registro los datos de la petición en
+// curso que viajan en el contexto: request ID, método, endpoint y el ID
+// de la traza activa.
+type manejadorContexto struct {
+	slog.Handler
+}
+
+func (h manejadorContexto) Handle(ctx context.Context, rec slog.Record) error {
+	if id, _ := ctx.Value(claveRequestID).(string); id != "" {
+		rec.AddAttrs(slog.String("request_id", id))
+	}
+	if atributos, ok := ctx.Value(claveAtributosLog).([]slog.Attr); ok {
+		rec.AddAttrs(atributos...)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		rec.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h manejadorContexto) WithAttrs(atributos []slog.Attr) slog.Handler {
+	return manejadorContexto{h.Handler.WithAttrs(atributos)}
+}
+
+func (h manejadorContexto) WithGroup(nombre string) slog.Handler {
+	return manejadorContexto{h.Handler.WithGroup(nombre)}
+}
+
+// logsMiddleware deja en el contexto el método y el endpoint de la
+// petición para los logs de los handlers y, en nivel debug, registra su
+// status y latencia al terminar. Debe ir por dentro de
+// requestIDMiddleware.
+func logsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inicio := time.Now()
+		ctx := context.WithValue(r.Context(), claveAtributosLog, []slog.Attr{
+			slog.String("metodo", r.Method),
+			slog.String("endpoint", r.URL.Path),
+		})
+		rw := &respuestaRegistrada{ResponseWriter: w}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		slog.DebugContext(ctx, "Petición completada",
+			"status", status,
+			"latencia_ms", float64(time.Since(inicio).Microseconds())/1000)
+	})
+}
+
+// fatal registra un error que impide arrancar el servicio y termina el
+// proceso.
+func fatal(mensaje string, err error) {
+	slog.Error(mensaje, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Métricas de negocio y de peticiones HTTP expuestas en /metrics.
+var (
+	metricaRegistros = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "usuarios_registrados_total",
+		Help: "Usuarios registrados con éxito en /registro.",
+	})
+	metricaLogins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "logins_total",
+		Help: "Intentos de login en /login por resultado (exitoso o fallido).",
+	}, []string{"resultado"})
+	metricaWebhooks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhooks_entregas_total",
+		Help: "Eventos enviados a los webhooks por tipo y resultado (exitosa, fallida o descartada).",
+	}, []string{"evento", "resultado"})
+	metricaBroker = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "broker_eventos_total",
+		Help: "Eventos de dominio enviados al broker por tipo y resultado (publicado o fallido).",
+	}, []string{"evento", "resultado"})
+	metricaTareas = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tareas_total",
+		Help: "Tareas en segundo plano por tipo y resultado (completada, reintentada, fallida, recuperada o descartada).",
+	}, []string{"tipo", "resultado"})
+	metricaCorreosInvalidos = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "correos_invalidos_total",
+		Help: "Direcciones marcadas como inválidas por los avisos de los proveedores de correo, por proveedor y motivo (rebote o queja).",
+	}, []string{"proveedor", "motivo"})
+	metricaDescartadas = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "peticiones_descartadas_total",
+		Help: "Peticiones rechazadas con 503 por superar MAX_PETICIONES_EN_CURSO.",
+	})
+	metricaDuracion = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_peticiones_duracion_segundos",
+		Help:    "Latencia de las peticiones HTTP por método, ruta y status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"metodo", "ruta", "status"})
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "usuarios_almacenados",
+		Help: "Usuarios guardados actualmente en el store en memoria.",
+	}, func() float64 { return float64(contarUsuarios()) })
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "websocket_conexiones",
+		Help: "Conexiones abiertas en /ws.",
+	}, func() float64 { return float64(conexionesWS.Load()) })
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "sse_conexiones",
+		Help: "Conexiones abiertas en /eventos.",
+	}, func() float64 { return float64(conexionesSSE.Load()) })
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "tareas_en_curso",
+		Help: "Tareas en segundo plano ejecutándose.",
+	}, func() float64 { return float64(tareasEnCurso.Load()) })
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "tareas_fallidas",
+		Help: "Tareas en segundo plano que agotaron sus reintentos y esperan en la cola de fallidas.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		n, _ := tareas.contarFallidas(ctx)
+		return float64(n)
+	})
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "peticiones_en_curso",
+		Help: "Peticiones atendiéndose que ocupan un lugar de MAX_PETICIONES_EN_CURSO.",
+	}, func() float64 { return float64(peticionesEnCurso.Load()) })
+)
+
+// metricasHandler expone las métricas en el formato de texto de Prometheus.
+var metricasHandler = promhttp.Handler()
+
+// registrarLogin cuenta un intento de login con credenciales.
+func registrarLogin(exitoso bool) {
+	if exitoso {
+		metricaLogins.WithLabelValues("exitoso").Inc()
+	} else {
+		metricaLogins.WithLabelValues("fallido").Inc()
+	}
+}
+
+// respuestaRegistrada recuerda el status y los bytes del cuerpo escritos
+// por el handler.
+type respuestaRegistrada struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *respuestaRegistrada) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *respuestaRegistrada) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap permite a http.ResponseController llegar al writer original.
+func (w *respuestaRegistrada) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush implementa http.Flusher para los handlers que lo exigen con una
+// aserción de tipo en lugar de http.ResponseController (p. ej. gRPC).
+func (w *respuestaRegistrada) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// metricasMiddleware mide la latencia de cada petición etiquetándola con
+// el patrón de la ruta que la atendió. Debe recibir el mismo *http.Request
+// que el router para leer r.Pattern, por lo que va por fuera sólo de
+// middlewares que no reemplazan la petición. Las peticiones sin ruta se
+// agrupan en "sin_ruta" (con cualquier método) para acotar la
+// cardinalidad.
+func metricasMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inicio := time.Now()
+		rw := &respuestaRegistrada{ResponseWriter: w}
+		defer func() {
+			ruta := "sin_ruta"
+			if r.Pattern != "" {
+				ruta = rutaDePatron(r.Pattern)
+			}
+			status := rw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			metodo := r.Method
+			if ruta == "sin_ruta" {
+				metodo = "otro"
+			}
+			metricaDuracion.WithLabelValues(metodo, ruta, strconv.Itoa(status)).
+				Observe(time.Since(inicio).Seconds())
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// Tipos de notificación que el usuario elige recibir.
+const (
+	notificacionAlertasLogin = "alertas_login"
+	notificacionBoletines    = "boletines"
+)
+
+// Canales por los que se entregan las notificaciones.
+const (
+	canalCorreo = "correo"
+	canalSMS    = "sms"
+)
+
+// canalesNotificacion son los canales que admite cada tipo de
+// notificación.
+var canalesNotificacion = map[string][]string{
+	notificacionAlertasLogin: {canalCorreo, canalSMS},
+	notificacionBoletines:    {canalCorreo},
+}
+
+// notificacionesPorDefecto son los canales de cada tipo mientras el
+// usuario no elija otros: las alertas de login llegan por correo y los
+// boletines, que requieren consentimiento, por ninguno.
+var notificacionesPorDefecto = map[string][]string{
+	notificacionAlertasLogin: {canalCorreo},
+	notificacionBoletines:    {},
+}
+
+// PreferenciasNotificacion define los canales por los que el usuario
+// recibe cada tipo de notificación. Una lista vacía la desactiva.
+type PreferenciasNotificacion struct {
+	AlertasLogin []string `json:"alertas_login"`
+	Boletines    []string `json:"boletines"`
+}
+
+// ActualizarNotificacionesRequest define la estructura esperada para PUT
+// /perfil/notificaciones. Como en ActualizarPerfilRequest, los campos son
+// punteros: los tipos no enviados conservan sus canales.
+type ActualizarNotificacionesRequest struct {
+	AlertasLogin *[]string `json:"alertas_login"`
+	Boletines    *[]string `json:"boletines"`
+}
+
+// canales devuelve los canales por los que el usuario recibe el tipo de
+// notificación.
+func (u *Usuario) canales(tipo string) []string {
+	if canales, ok := u.Notificaciones[tipo]; ok {
+		return canales
+	}
+	return notificacionesPorDefecto[tipo]
+}
+
+// nuevasPreferenciasNotificacion arma la respuesta con las preferencias
+// de un usuario.
+func nuevasPreferenciasNotificacion(u *Usuario) PreferenciasNotificacion {
+	return PreferenciasNotificacion{
+		AlertasLogin: slices.Clone(u.canales(notificacionAlertasLogin)),
+		Boletines:    slices.Clone(u.canales(notificacionBoletines)),
+	}
+}
+
+// obtenerNotificacionesHandler devuelve las preferencias de notificación
+// del usuario autenticado.
+func obtenerNotificacionesHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	escribirJSON(w, http.StatusOK, nuevasPreferenciasNotificacion(usuario))
+}
+
+// actualizarNotificacionesHandler valida y aplica los canales elegidos
+// por el usuario autenticado. El SMS exige un teléfono verificado.
+func actualizarNotificacionesHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	var req ActualizarNotificacionesRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+
+	cambios := map[string]*[]string{
+		notificacionAlertasLogin: req.AlertasLogin,
+		notificacionBoletines:    req.Boletines,
+	}
+	var errores []ErrorCampo
+	for _, tipo := range slices.Sorted(maps.Keys(cambios)) {
+		canales := cambios[tipo]
+		if canales == nil {
+			continue
+		}
+		for _, canal := range *canales {
+			if !slices.Contains(canalesNotificacion[tipo], canal) {
+				errores = append(errores, ErrorCampo{Campo: tipo, Codigo: codigoNoPermitido, Mensaje: "Canal de notificación inválido", codigoRespuesta: "CANAL_INVALIDO"})
+				break
+			}
+		}
+	}
+	if len(errores) > 0 {
+		responderErrorServicio(w, erroresCampo(http.StatusBadRequest, errores))
+		return
+	}
+	if req.AlertasLogin != nil && slices.Contains(*req.AlertasLogin, canalSMS) && !usuario.TelefonoVerificado {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "Verifica tu teléfono para recibir SMS", Codigo: "TELEFONO_NO_VERIFICADO"})
+		return
+	}
+
+	if usuario.Notificaciones == nil {
+		usuario.Notificaciones = map[string][]string{}
+	}
+	for tipo, canales := range cambios {
+		if canales != nil {
+			elegidos := slices.Compact(slices.Sorted(slices.Values(*canales)))
+			usuario.Notificaciones[tipo] = append([]string{}, elegidos...)
+		}
+	}
+	registrarEvento(usuario, "notificaciones_actualizadas")
+
+	slog.InfoContext(r.Context(), "Preferencias de notificación actualizadas", "correo", usuario.Correo)
+	escribirJSON(w, http.StatusOK, nuevasPreferenciasNotificacion(usuario))
+}
+
+// notificacion es el contenido de una notificación en cada canal.
+type notificacion struct {
+	plantillaCorreo string
+	datosCorreo     any
+	plantillaSMS    string
+	datosSMS        datosPlantillaSMS
+}
+
+// notificarUsuario envía la notificación por los canales que el usuario
+// eligió para el tipo; el SMS, sólo si el teléfono sigue verificado.
+// Quien notifica a un usuario lo hace siempre por aquí, para respetar sus
+// preferencias. Debe llamarse con el lock del usuario tomado.
+func notificarUsuario(ctx context.Context, usuario *Usuario, tipo string, n notificacion) error {
+	var errs []error
+	for _, canal := range usuario.canales(tipo) {
+		switch canal {
+		case canalCorreo:
+			errs = append(errs, encolarCorreo(ctx, usuario.Correo, usuario.idioma(), n.plantillaCorreo, n.datosCorreo))
+		case canalSMS:
+			if usuario.TelefonoVerificado {
+				errs = append(errs, encolarSMS(ctx, usuario.Telefono, n.plantillaSMS, n.datosSMS))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPreferenciasNotificacion(t *testing.T) {
+	prepararHandlers(t)
+	u := usuarioFalso("ana@ejemplo.com", "Secreta@123")
+	usarRepositorio(t, &repositorioFalso{usuarios: []*Usuario{u}})
+	token, err := generarToken(u, []string{"pwd"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peticion := func(handler http.HandlerFunc, metodo, cuerpo string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(metodo, "/perfil/notificaciones", strings.NewReader(cuerpo))
+		req.Header.Set("Authorization", "Bearer "+token)
+		autenticado(handler)(w, req)
+		return w
+	}
+	comprobar := func(w *httptest.ResponseRecorder, esperadas PreferenciasNotificacion) {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var prefs PreferenciasNotificacion
+		decodificarRespuesta(t, w, &prefs)
+		if !reflect.DeepEqual(prefs, esperadas) {
+			t.Errorf("preferencias %+v, se esperaba %+v", prefs, esperadas)
+		}
+	}
+
+	comprobar(peticion(obtenerNotificacionesHandler, http.MethodGet, ""),
+		PreferenciasNotificacion{AlertasLogin: []string{canalCorreo}, Boletines: []string{}})
+	comprobar(peticion(actualizarNotificacionesHandler, http.MethodPut, `{"boletines":["correo","correo"]}`),
+		PreferenciasNotificacion{AlertasLogin: []string{canalCorreo}, Boletines: []string{canalCorreo}})
+
+	comprobarError(t, peticion(actualizarNotificacionesHandler, http.MethodPut, `{"boletines":["sms"],"alertas_login":["paloma"]}`),
+		http.StatusBadRequest, ErrorResponse{Error: "Canal de notificación inválido", Codigo: "CANAL_INVALIDO", Errores: []ErrorCampo{
+			{Campo: notificacionAlertasLogin, Codigo: codigoNoPermitido, Mensaje: "Canal de notificación inválido"},
+			{Campo: notificacionBoletines, Codigo: codigoNoPermitido, Mensaje: "Canal de notificación inválido"},
+		}})
+	comprobarError(t, peticion(actualizarNotificacionesHandler, http.MethodPut, `{"alertas_login":["sms"]}`),
+		http.StatusConflict, ErrorResponse{Error: "Verifica tu teléfono para recibir SMS", Codigo: "TELEFONO_NO_VERIFICADO"})
+
+	u.TelefonoVerificado = true
+	comprobar(peticion(actualizarNotificacionesHandler, http.MethodPut, `{"alertas_login":["sms","correo"]}`),
+		PreferenciasNotificacion{AlertasLogin: []string{canalCorreo, canalSMS}, Boletines: []string{canalCorreo}})
+	comprobar(peticion(actualizarNotificacionesHandler, http.MethodPut, `{"alertas_login":[]}`),
+		PreferenciasNotificacion{AlertasLogin: []string{}, Boletines: []string{canalCorreo}})
+}
+
+func TestNotificarUsuarioRespetaLasPreferencias(t *testing.T) {
+	enviados := mensajesEnviados(t)
+	u := usuarioFalso("ana@ejemplo.com", "Secreta@123")
+	alerta := notificacion{
+		plantillaCorreo: plantillaCorreoAlertaLogin,
+		datosCorreo:     datosAlertaLogin{Pais: "AR"},
+		plantillaSMS:    plantillaSMSAlertaLogin,
+		datosSMS:        datosPlantillaSMS{Pais: "AR"},
+	}
+	casos := []struct {
+		nombre             string
+		canales            []string
+		telefonoVerificado bool
+		destinatarios      []string
+	}{
+		{"por defecto", nil, false, []string{u.Correo}},
+		{"desactivada", []string{}, true, nil},
+		{"correo y SMS", []string{canalCorreo, canalSMS}, true, []string{u.Correo, u.Telefono}},
+		{"SMS sin teléfono verificado", []string{canalSMS}, false, nil},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			*enviados = nil
+			u.Notificaciones = nil
+			if c.canales != nil {
+				u.Notificaciones = map[string][]string{notificacionAlertasLogin: c.canales}
+			}
+			u.TelefonoVerificado = c.telefonoVerificado
+			if err := notificarUsuario(context.Background(), u, notificacionAlertasLogin, alerta); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(*enviados, c.destinatarios) {
+				t.Errorf("enviados %v, se esperaba %v", *enviados, c.destinatarios)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"pruebasgo/validacion"
+)
+
+// ConfigOIDC agrupa los parámetros necesarios para federar contra un
+// proveedor OpenID Connect (Keycloak, Azure AD, Google, etc.).
+type ConfigOIDC struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// cargarConfigOIDC lee la configuración OIDC de las variables de entorno
+// OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL y
+// OIDC_SCOPES (separados por espacio). Devuelve false si no está configurado.
+func cargarConfigOIDC() (ConfigOIDC, bool) {
+	cfg := ConfigOIDC{
+		Issuer:       strings.TrimSuffix(opcion("OIDC_ISSUER"), "/"),
+		ClientID:     opcion("OIDC_CLIENT_ID"),
+		ClientSecret: opcion("OIDC_CLIENT_SECRET"),
+		RedirectURL:  opcion("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(opcion("OIDC_SCOPES")),
+	}
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return cfg, false
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return cfg, true
+}
+
+// documentoDescubrimiento contiene los campos usados del documento
+// /.well-known/openid-configuration del proveedor.
+type documentoDescubrimiento struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// clienteOIDC implementa el flujo authorization code de OpenID Connect
+// y mantiene en caché el documento de descubrimiento y las llaves públicas.
+type clienteOIDC struct {
+	config ConfigOIDC
+	http   *http.Client
+
+	mu             sync.Mutex
+	descubrimiento *documentoDescubrimiento
+	claves         map[string]*rsa.PublicKey
+}
+
+// nuevoClienteOIDC crea un cliente OIDC para la configuración indicada.
+func nuevoClienteOIDC(cfg ConfigOIDC) *clienteOIDC {
+	return &clienteOIDC{
+		config: cfg,
+		http:   nuevoClienteHTTP(10 * time.Second),
+	}
+}
+
+// Nombres de las cookies que guardan el state y nonce del flujo en curso.
+const (
+	cookieEstadoOIDC = "oidc_state"
+	cookieNonceOIDC  = "oidc_nonce"
+)
+
+// loginHandler redirige al usuario al endpoint de autorización del proveedor.
+func (c *clienteOIDC) loginHandler(w http.ResponseWriter, r *http.Request) {
+	desc, err := c.obtenerDescubrimiento(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error consultando el proveedor OIDC", "error", err)
+		escribirJSON(w, http.StatusBadGateway, ErrorResponse{Error: "Proveedor de identidad no disponible", Codigo: "PROVEEDOR_NO_DISPONIBLE"})
+		return
+	}
+
+	estado, err := valorAleatorio()
+	if err != nil {
+		escribirJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error iniciando sesión federada", Codigo: "ERROR_INTERNO"})
+		return
+	}
+	nonce, err := valorAleatorio()
+	if err != nil {
+		escribirJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error iniciando sesión federada", Codigo: "ERROR_INTERNO"})
+		return
+	}
+	c.establecerCookie(w, cookieEstadoOIDC, estado)
+	c.establecerCookie(w, cookieNonceOIDC, nonce)
+
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {c.config.ClientID},
+		"redirect_uri":  {c.config.RedirectURL},
+		"scope":         {strings.Join(c.config.Scopes, " ")},
+		"state":         {estado},
+		"nonce":         {nonce},
+	}
+	http.Redirect(w, r, desc.AuthorizationEndpoint+"?"+params.Encode(), http.StatusFound)
+}
+
+// callbackHandler recibe el código de autorización, lo intercambia por
+// un ID token, lo verifica e inicia la sesión de la cuenta de su correo
+// (ver loginFederado).
+func (c *clienteOIDC) callbackHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		slog.WarnContext(r.Context(), "El proveedor OIDC rechazó la autenticación", "error", e)
+		escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Autenticación federada rechazada", Codigo: "AUTENTICACION_FEDERADA_RECHAZADA"})
+		return
+	}
+
+	estado, err := r.Cookie(cookieEstadoOIDC)
+	if err != nil || q.Get("state") == "" || q.Get("state") != estado.Value {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Estado OIDC inválido", Codigo: "ESTADO_OIDC_INVALIDO"})
+		return
+	}
+	nonce, err := r.Cookie(cookieNonceOIDC)
+	if err != nil {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Estado OIDC inválido", Codigo: "ESTADO_OIDC_INVALIDO"})
+		return
+	}
+	borrarCookieOIDC(w, cookieEstadoOIDC)
+	borrarCookieOIDC(w, cookieNonceOIDC)
+
+	if q.Get("code") == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el parámetro code", Codigo: "PARAMETRO_REQUERIDO"})
+		return
+	}
+
+	idToken, err := c.intercambiarCodigo(r.Context(), q.Get("code"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error intercambiando el código OIDC", "error", err)
+		escribirJSON(w, http.StatusBadGateway, ErrorResponse{Error: "Proveedor de identidad no disponible", Codigo: "PROVEEDOR_NO_DISPONIBLE"})
+		return
+	}
+
+	correo, err := c.verificarIDToken(r.Context(), idToken, nonce.Value)
+	if err != nil {
+		slog.WarnContext(r.Context(), "ID token inválido", "error", err)
+		escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Token del proveedor inválido", Codigo: "TOKEN_PROVEEDOR_INVALIDO"})
+		return
+	}
+
+	loginFederado(w, r, correo, "oidc")
+}
+
+// obtenerDescubrimiento descarga (una sola vez) el documento de
+// descubrimiento del issuer configurado.
+func (c *clienteOIDC) obtenerDescubrimiento(ctx context.Context) (*documentoDescubrimiento, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.descubrimiento != nil {
+		return c.descubrimiento, nil
+	}
+
+	var desc documentoDescubrimiento
+	if err := c.obtenerJSON(ctx, c.config.Issuer+"/.well-known/openid-configuration", &desc); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(desc.Issuer, "/") != c.config.Issuer {
+		return nil, fmt.Errorf("issuer inesperado %q", desc.Issuer)
+	}
+	if desc.AuthorizationEndpoint == "" || desc.TokenEndpoint == "" || desc.JWKSURI == "" {
+		return nil, errors.New("documento de descubrimiento incompleto")
+	}
+	c.descubrimiento = &desc
+	return c.descubrimiento, nil
+}
+
+// intercambiarCodigo canjea el código de autorización en el token
+// endpoint y devuelve el ID token recibido.
+func (c *clienteOIDC) intercambiarCodigo(ctx context.Context, codigo string) (string, error) {
+	desc, err := c.obtenerDescubrimiento(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {codigo},
+		"redirect_uri":  {c.config.RedirectURL},
+		"client_id":     {c.config.ClientID},
+		"client_secret": {c.config.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, desc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint respondió %d", resp.StatusCode)
+	}
+
+	var cuerpo struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cuerpo); err != nil {
+		return "", err
+	}
+	if cuerpo.IDToken == "" {
+		return "", errors.New("respuesta sin id_token")
+	}
+	return cuerpo.IDToken, nil
+}
+
+// verificarIDToken valida firma, issuer, audiencia, expiración y nonce
+// del ID token, y devuelve el correo del usuario autenticado, que el
+// proveedor debe marcar como verificado (email_verified).
+func (c *clienteOIDC) verificarIDToken(ctx context.Context, idToken, nonce string) (string, error) {
+	desc, err := c.obtenerDescubrimiento(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(idToken, claims, c.claveParaToken(ctx),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithIssuer(desc.Issuer),
+		jwt.WithAudience(c.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return "", errors.New("nonce no coincide")
+	}
+	// Sin email_verified no se sabe si el proveedor comprobó el correo.
+	if verificado, _ := claims["email_verified"].(bool); !verificado {
+		return "", errors.New("correo no verificado por el proveedor")
+	}
+	correo, _ := claims["email"].(string)
+	if validacion.Correo(correo, reglasCorreoVigentes().OpcionesCorreo) != nil {
+		return "", errors.New("el token no contiene un correo válido")
+	}
+	return correo, nil
+}
+
+// claveParaToken devuelve la función que localiza la llave pública que
+// firmó el token según su kid, recargando el JWKS si el kid aún no se
+// conoce (rotación de llaves).
+func (c *clienteOIDC) claveParaToken(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		c.mu.Lock()
+		clave, ok := c.claves[kid]
+		c.mu.Unlock()
+		if ok {
+			return clave, nil
+		}
+
+		if err := c.cargarClaves(ctx); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if clave, ok := c.claves[kid]; ok {
+			return clave, nil
+		}
+		return nil, fmt.Errorf("llave %q desconocida", kid)
+	}
+}
+
+// cargarClaves descarga el JWKS del proveedor y conserva las llaves RSA.
+func (c *clienteOIDC) cargarClaves(ctx context.Context) error {
+	desc, err := c.obtenerDescubrimiento(ctx)
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := c.obtenerJSON(ctx, desc.JWKSURI, &jwks); err != nil {
+		return err
+	}
+
+	claves := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		claves[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	c.mu.Lock()
+	c.claves = claves
+	c.mu.Unlock()
+	return nil
+}
+
+// obtenerJSON realiza un GET y decodifica la respuesta JSON en destino.
+func (c *clienteOIDC) obtenerJSON(ctx context.Context, url string, destino interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s respondió %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(destino)
+}
+
+// valorAleatorio genera un valor aleatorio apto para state y nonce.
+func valorAleatorio() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// establecerCookie guarda un valor temporal del flujo OIDC.
+func (c *clienteOIDC) establecerCookie(w http.ResponseWriter, nombre, valor string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     nombre,
+		Value:    valor,
+		Path:     "/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(c.config.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// borrarCookieOIDC elimina una cookie del flujo OIDC ya consumida.
+func borrarCookieOIDC(w http.ResponseWriter, nombre string) {
+	http.SetCookie(w, &http.Cookie{Name: nombre, Path: "/oidc", MaxAge: -1})
+}
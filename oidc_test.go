@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// proveedorOIDC levanta un proveedor OIDC de prueba y devuelve una
+// función que completa el callback con un ID token que lleva los claims
+// dados, además de los de issuer, audiencia, expiración y nonce.
+func proveedorOIDC(t *testing.T) func(claims jwt.MapClaims) *httptest.ResponseRecorder {
+	t.Helper()
+	clave, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idToken string
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(documentoDescubrimiento{
+			Issuer:                srv.URL,
+			AuthorizationEndpoint: srv.URL + "/autorizar",
+			TokenEndpoint:         srv.URL + "/token",
+			JWKSURI:               srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"k1","n":%q,"e":%q}]}`,
+			base64.RawURLEncoding.EncodeToString(clave.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(clave.E)).Bytes()))
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id_token":%q}`, idToken)
+	})
+
+	cliente := nuevoClienteOIDC(ConfigOIDC{Issuer: srv.URL, ClientID: "cliente", RedirectURL: "http://localhost/oidc/callback"})
+	return func(claims jwt.MapClaims) *httptest.ResponseRecorder {
+		t.Helper()
+		claims["iss"] = srv.URL
+		claims["aud"] = "cliente"
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		claims["nonce"] = "nonce"
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		if idToken, err = token.SignedString(clave); err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/oidc/callback?state=estado&code=codigo", nil)
+		r.AddCookie(&http.Cookie{Name: cookieEstadoOIDC, Value: "estado"})
+		r.AddCookie(&http.Cookie{Name: cookieNonceOIDC, Value: "nonce"})
+		w := httptest.NewRecorder()
+		cliente.callbackHandler(w, r)
+		return w
+	}
+}
+
+func TestOIDCExigeCorreoVerificado(t *testing.T) {
+	prepararHandlers(t)
+	usarRepositorio(t, &repositorioFalso{})
+	callback := proveedorOIDC(t)
+
+	for _, verificado := range []any{nil, false, "true"} {
+		claims := jwt.MapClaims{"email": "federado@ejemplo.com"}
+		if verificado != nil {
+			claims["email_verified"] = verificado
+		}
+		comprobarError(t, callback(claims), http.StatusUnauthorized,
+			ErrorResponse{Error: "Token del proveedor inválido", Codigo: "TOKEN_PROVEEDOR_INVALIDO"})
+	}
+	if buscarUsuario("federado@ejemplo.com") != nil {
+		t.Error("se dio de alta la cuenta de un correo sin verificar")
+	}
+
+	if w := callback(jwt.MapClaims{"email": "federado@ejemplo.com", "email_verified": true}); w.Code != http.StatusOK {
+		t.Fatalf("correo verificado: status %d: %s", w.Code, w.Body)
+	}
+	if u := buscarUsuario("federado@ejemplo.com"); u == nil || u.Origen != origenFederado {
+		t.Errorf("cuenta %+v, se esperaba una cuenta federada", u)
+	}
+}
+
+func TestOIDCNoEntraAUnaCuentaConContrasena(t *testing.T) {
+	prepararHandlers(t)
+	local := usuarioFalso("local@ejemplo.com", "Secreta@123")
+	usarRepositorio(t, &repositorioFalso{usuarios: []*Usuario{local}})
+	callback := proveedorOIDC(t)
+
+	comprobarError(t, callback(jwt.MapClaims{"email": "local@ejemplo.com", "email_verified": true}), http.StatusConflict,
+		ErrorResponse{Error: "El correo es de una cuenta con contraseña", Codigo: "CUENTA_LOCAL"})
+}
+
+func TestOIDCPideElSegundoFactor(t *testing.T) {
+	prepararHandlers(t)
+	usarRepositorio(t, &repositorioFalso{})
+	callback := proveedorOIDC(t)
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{"email": "dosfa@ejemplo.com", "email_verified": true}
+	}
+
+	if w := callback(claims()); w.Code != http.StatusOK {
+		t.Fatalf("alta federada: status %d: %s", w.Code, w.Body)
+	}
+	usuario := buscarUsuario("dosfa@ejemplo.com")
+	func() {
+		defer usuario.bloquear()()
+		usuario.DosFAActivo = true
+		usuario.SecretoTOTP = codificacionSecreto.EncodeToString([]byte("secreto-de-prueba-20"))
+	}()
+
+	w := callback(claims())
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, se esperaba %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	var pendiente SegundoFactorPendienteResponse
+	decodificarRespuesta(t, w, &pendiente)
+	if _, err := validarToken(pendiente.TokenPendiente); err == nil {
+		t.Fatal("el token pendiente sirve como token de acceso")
+	}
+
+	completar := func(codigo string) *httptest.ResponseRecorder {
+		return atender(completarLoginFederadoHandler, "/login/federado/codigo",
+			fmt.Sprintf(`{"token_pendiente":%q,"codigo":%q}`, pendiente.TokenPendiente, codigo))
+	}
+	comprobarError(t, completar("000000"), http.StatusUnauthorized, ErrorResponse{Error: "Código de verificación inválido", Codigo: "CODIGO_INVALIDO"})
+
+	clave, _ := codificacionSecreto.DecodeString(usuario.SecretoTOTP)
+	w = completar(calcularTOTP(clave, uint64(time.Now().Unix()/periodoTOTP)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("con el código vigente: status %d: %s", w.Code, w.Body)
+	}
+	var sesion LoginResponse
+	decodificarRespuesta(t, w, &sesion)
+	claimsSesion, err := validarToken(sesion.Token)
+	if err != nil {
+		t.Fatalf("token de acceso inválido: %v", err)
+	}
+	if fmt.Sprint(claimsSesion["amr"]) != "[fed otp mfa]" {
+		t.Errorf("amr %v, se esperaba [fed otp mfa]", claimsSesion["amr"])
+	}
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	swaggerFiles "github.com/swaggo/files/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// MensajeResponse es el cuerpo de las respuestas de éxito que sólo
+// confirman la operación.
+type MensajeResponse struct {
+	Mensaje string `json:"mensaje"`
+}
+
+// accesoAPI es la protección con la que se registra un endpoint.
+type accesoAPI int
+
+const (
+	accesoPublico       accesoAPI = iota
+	accesoAutenticado             // autenticado
+	accesoSinDosFA                // autenticadoSinDosFA
+	accesoSensible                // sensible
+	accesoAdministrador           // administrador
+)
+
+// parametroAPI documenta un parámetro de query.
+type parametroAPI struct {
+	nombre, tipo, descripcion string
+	requerido                 bool
+}
+
+// operacionAPI documenta un endpoint de la API. cuerpo y respuesta son
+// valores de los tipos Go que recibe y devuelve el handler; sus esquemas
+// se derivan de los tipos por reflexión (ver esquemasAPI), así que la
+// especificación sigue a los structs sin mantenerlos dos veces.
+type operacionAPI struct {
+	etiqueta   string
+	resumen    string
+	acceso     accesoAPI
+	parametros []parametroAPI
+	// headers son los headers de la petición que el endpoint interpreta.
+	headers   []parametroAPI
+	cuerpo    any
+	status    int
+	respuesta any
+	// tipoContenido es el de la respuesta exitosa; por defecto
+	// application/json.
+	tipoContenido string
+	errores       []int
+}
+
+// paginacionAPI son los parámetros de leerPaginacion.
+var paginacionAPI = []parametroAPI{
+	{"cursor", "string", "meta.next_cursor de la página anterior; no se combina con page", false},
+	{"page", "integer", "Página, desde 1; mejor usar cursor", false},
+	{"limit", "integer", "Tamaño de página (máximo 100)", false},
+}
+
+// documentacionAPI documenta cada endpoint registrado en
+// registrarRutasAPI, con el mismo patrón "MÉTODO /ruta" sin prefijo de
+// versión. Registrar un endpoint sin documentarlo deja un aviso en el log
+// al arrancar.
+var documentacionAPI = map[string]operacionAPI{
+	"POST /registro": {
+		etiqueta: "Cuenta", resumen: "Registrar una cuenta",
+		headers: []parametroAPI{{headerIdempotencia, "string", "Clave única de la operación, para reintentarla sin registrar dos veces: los reintentos con la misma clave y el mismo cuerpo reciben la respuesta original", false}},
+		cuerpo:  RegistroRequest{}, status: http.StatusCreated, respuesta: MensajeResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusTooManyRequests},
+	},
+	"POST /login": {
+		etiqueta: "Cuenta", resumen: "Iniciar sesión y obtener un token",
+		cuerpo: LoginRequest{}, status: http.StatusOK, respuesta: LoginResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+	},
+	"POST /login/codigo-sms": {
+		etiqueta: "Cuenta", resumen: "Enviar por SMS un código de segundo factor para /login",
+		cuerpo: CodigoLoginRequest{}, status: http.StatusAccepted, respuesta: MensajeResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusTooManyRequests, http.StatusBadGateway},
+	},
+	"POST /login/federado/codigo": {
+		etiqueta: "Cuenta", resumen: "Completar con el segundo factor un login federado (OIDC o SAML)",
+		cuerpo: CodigoFederadoRequest{}, status: http.StatusOK, respuesta: LoginResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests},
+	},
+	"GET /verificar-correo": {
+		etiqueta: "Verificación", resumen: "Verificar el correo con el token del enlace",
+		parametros: []parametroAPI{{"token", "string", "Token recibido por correo", true}},
+		status:     http.StatusOK, respuesta: MensajeResponse{},
+		errores: []int{http.StatusBadRequest},
+	},
+	"POST /verificar-correo/reenviar": {
+		etiqueta: "Verificación", resumen: "Reenviar el enlace de verificación de correo",
+		cuerpo: ReenviarVerificacionRequest{}, status: http.StatusAccepted, respuesta: MensajeResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusTooManyRequests},
+	},
+	"POST /verificar-telefono": {
+		etiqueta: "Verificación", resumen: "Verificar el teléfono con el código recibido por SMS",
+		acceso: accesoAutenticado, cuerpo: CodigoRequest{}, status: http.StatusOK, respuesta: MensajeResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	"POST /verificar-telefono/enviar": {
+		etiqueta: "Verificación", resumen: "Enviar un código de verificación por SMS",
+		acceso: accesoAutenticado, status: http.StatusAccepted, respuesta: MensajeResponse{},
+		errores: []int{http.StatusConflict, http.StatusTooManyRequests, http.StatusBadGateway},
+	},
+	"POST /password/cambiar": {
+		etiqueta: "Cuenta", resumen: "Cambiar la contraseña",
+		acceso: accesoAutenticado, cuerpo: CambiarPasswordRequest{}, status: http.StatusOK, respuesta: MensajeResponse{},
+		errores: []int{http.StatusBadRequest},
+	},
+	"POST /correo/cambiar": {
+		etiqueta: "Cuenta", resumen: "Solicitar el cambio de correo",
+		acceso: accesoSensible, cuerpo: CambiarCorreoRequest{}, status: http.StatusAccepted, respuesta: MensajeResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusConflict, http.StatusBadGateway},
+	},
+	"GET /correo/confirmar": {
+		etiqueta: "Cuenta", resumen: "Confirmar el cambio de correo con el token del enlace",
+		parametros: []parametroAPI{{"token", "string", "Token recibido en el correo nuevo", true}},
+		status:     http.StatusOK, respuesta: MensajeResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	"GET /sesiones/revocar": {
+		etiqueta: "Cuenta", resumen: "Cerrar la sesión de un aviso de login nuevo con el token del enlace",
+		parametros: []parametroAPI{{"token", "string", "Token recibido en el aviso", true}},
+		status:     http.StatusOK, respuesta: MensajeResponse{},
+		errores: []int{http.StatusBadRequest},
+	},
+	"DELETE /cuenta": {
+		etiqueta: "Cuenta", resumen: "Eliminar la cuenta propia",
+		acceso: accesoSensible, cuerpo: EliminarCuentaRequest{}, status: http.StatusNoContent,
+		errores: []int{http.StatusBadRequest},
+	},
+	"GET /eventos": {
+		etiqueta: "Perfil", resumen: "Recibir notificaciones de la cuenta por Server-Sent Events",
+		acceso:     accesoAutenticado,
+		parametros: []parametroAPI{{"token", "string", "Token de acceso, para clientes que no pueden enviar el header Authorization (EventSource)", false}},
+		status:     http.StatusOK, respuesta: EventoSesion{}, tipoContenido: "text/event-stream",
+	},
+	"GET /perfil": {
+		etiqueta: "Perfil", resumen: "Consultar el perfil",
+		acceso: accesoAutenticado, status: http.StatusOK, respuesta: PerfilResponse{},
+	},
+	"PUT /perfil": {
+		etiqueta: "Perfil", resumen: "Actualizar el perfil",
+		acceso: accesoAutenticado, cuerpo: ActualizarPerfilRequest{}, status: http.StatusOK, respuesta: PerfilResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	"GET /perfil/exportar": {
+		etiqueta: "Perfil", resumen: "Exportar todos los datos personales",
+		acceso:     accesoAutenticado,
+		parametros: []parametroAPI{{"descargar", "boolean", "Descargar como archivo adjunto, sin el sobre de la respuesta", false}},
+		status:     http.StatusOK, respuesta: ExportacionResponse{},
+	},
+	"GET /perfil/notificaciones": {
+		etiqueta: "Perfil", resumen: "Consultar las preferencias de notificación",
+		acceso: accesoAutenticado, status: http.StatusOK, respuesta: PreferenciasNotificacion{},
+	},
+	"GET /perfil/sesiones": {
+		etiqueta: "Perfil", resumen: "Listar los inicios de sesión recientes",
+		acceso: accesoAutenticado, parametros: paginacionAPI, status: http.StatusOK, respuesta: ListadoSesionesResponse{},
+		errores: []int{http.StatusBadRequest},
+	},
+	"PUT /perfil/notificaciones": {
+		etiqueta: "Perfil", resumen: "Elegir qué notificaciones recibir y por qué canal",
+		acceso: accesoAutenticado, cuerpo: ActualizarNotificacionesRequest{}, status: http.StatusOK, respuesta: PreferenciasNotificacion{},
+		errores: []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	"POST /2fa/activar": {
+		etiqueta: "Segundo factor", resumen: "Generar un secreto TOTP pendiente de confirmar",
+		acceso: accesoSinDosFA, status: http.StatusOK, respuesta: ActivarDosFAResponse{},
+		errores: []int{http.StatusConflict},
+	},
+	"POST /2fa/confirmar": {
+		etiqueta: "Segundo factor", resumen: "Confirmar el segundo factor y obtener los códigos de respaldo",
+		acceso: accesoSinDosFA, cuerpo: CodigoRequest{}, status: http.StatusOK, respuesta: CodigosRespaldoResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	"POST /2fa/codigos-respaldo": {
+		etiqueta: "Segundo factor", resumen: "Regenerar los códigos de respaldo",
+		acceso: accesoSensible, cuerpo: CodigoRequest{}, status: http.StatusOK, respuesta: CodigosRespaldoResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	"GET /admin/usuarios": {
+		etiqueta: "Administración", resumen: "Listar usuarios con filtros y paginación",
+		acceso: accesoAdministrador,
+		parametros: append([]parametroAPI{
+			{"correo", "string", "Subcadena del correo, sin distinguir mayúsculas", false},
+			{"verificado", "boolean", "Correo verificado o no", false},
+			{"estado", "string", "activa, suspendida o eliminada", false},
+			{"orden", "string", "correo o fecha_registro; con prefijo - para orden descendente", false},
+		}, paginacionAPI...),
+		status: http.StatusOK, respuesta: ListadoUsuariosResponse{},
+		errores: []int{http.StatusBadRequest},
+	},
+	"POST /admin/usuarios": {
+		etiqueta: "Administración", resumen: "Crear una cuenta, opcionalmente de administrador",
+		acceso: accesoAdministrador, cuerpo: CrearUsuarioRequest{}, status: http.StatusCreated, respuesta: UsuarioAdminResponse{},
+		errores: []int{http.StatusConflict},
+	},
+	"GET /admin/usuarios/buscar": {
+		etiqueta: "Administración", resumen: "Buscar usuarios por correo o teléfono parcial",
+		acceso: accesoAdministrador,
+		parametros: []parametroAPI{
+			{"q", "string", "Texto a buscar", true},
+			{"modo", "string", "prefijo (por defecto) o contiene", false},
+			{"limit", "integer", "Máximo de resultados (por defecto 20, máximo 100)", false},
+		},
+		status: http.StatusOK, respuesta: []UsuarioAdminResponse{},
+		errores: []int{http.StatusBadRequest},
+	},
+	"GET /admin/usuarios/{id}": {
+		etiqueta: "Administración", resumen: "Consultar un usuario",
+		acceso: accesoAdministrador, status: http.StatusOK, respuesta: UsuarioAdminResponse{},
+		errores: []int{http.StatusNotFound},
+	},
+	"PUT /admin/usuarios/{id}/estado": {
+		etiqueta: "Administración", resumen: "Suspender, reactivar o eliminar una cuenta",
+		acceso: accesoAdministrador, cuerpo: CambiarEstadoRequest{}, status: http.StatusOK, respuesta: UsuarioAdminResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	"POST /admin/usuarios/{id}/revocar-tokens": {
+		etiqueta: "Administración", resumen: "Revocar todos los tokens de un usuario",
+		acceso: accesoAdministrador, status: http.StatusOK, respuesta: MensajeResponse{},
+		errores: []int{http.StatusNotFound},
+	},
+	"POST /admin/usuarios/{id}/forzar-cambio-password": {
+		etiqueta: "Administración", resumen: "Obligar a un usuario a cambiar su contraseña",
+		acceso: accesoAdministrador, status: http.StatusOK, respuesta: UsuarioAdminResponse{},
+		errores: []int{http.StatusNotFound, http.StatusConflict},
+	},
+	"GET /admin/auditoria": {
+		etiqueta: "Administración", resumen: "Consultar el registro de auditoría",
+		acceso: accesoAdministrador,
+		parametros: append([]parametroAPI{
+			{"tipo", "string", "Tipo exacto de evento", false},
+			{"correo", "string", "Actor u objetivo del evento", false},
+			{"desde", "string", "Fecha mínima en formato RFC 3339", false},
+			{"hasta", "string", "Fecha máxima en formato RFC 3339", false},
+		}, paginacionAPI...),
+		status: http.StatusOK, respuesta: ListadoAuditoriaResponse{},
+		errores: []int{http.StatusBadRequest},
+	},
+	"POST /admin/config/recargar": {
+		etiqueta: "Administración", resumen: "Recargar la configuración",
+		acceso: accesoAdministrador, status: http.StatusOK, respuesta: MensajeResponse{},
+		errores: []int{http.StatusBadRequest},
+	},
+	"GET /admin/flags": {
+		etiqueta: "Administración", resumen: "Listar las feature flags",
+		acceso: accesoAdministrador, status: http.StatusOK, respuesta: []FlagResponse{},
+	},
+	"PUT /admin/flags/{nombre}": {
+		etiqueta: "Administración", resumen: "Cambiar una feature flag",
+		acceso: accesoAdministrador, cuerpo: CambiarFlagRequest{}, status: http.StatusOK, respuesta: FlagResponse{},
+		errores: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusServiceUnavailable},
+	},
+	"GET /admin/tareas/fallidas": {
+		etiqueta: "Administración", resumen: "Listar las tareas que agotaron sus reintentos",
+		acceso: accesoAdministrador, status: http.StatusOK, respuesta: []TareaFallidaResponse{},
+		errores: []int{http.StatusServiceUnavailable},
+	},
+	"POST /admin/tareas/fallidas/{id}/reintentar": {
+		etiqueta: "Administración", resumen: "Volver a encolar una tarea fallida",
+		acceso: accesoAdministrador, status: http.StatusAccepted, respuesta: MensajeResponse{},
+		errores: []int{http.StatusNotFound, http.StatusServiceUnavailable},
+	},
+	"GET /admin/correos-invalidos": {
+		etiqueta: "Administración", resumen: "Listar los correos que rebotaron o se quejaron",
+		acceso: accesoAdministrador, status: http.StatusOK, respuesta: []CorreoInvalido{},
+	},
+	"DELETE /admin/correos-invalidos/{correo}": {
+		etiqueta: "Administración", resumen: "Volver a permitir los envíos a un correo",
+		acceso: accesoAdministrador, status: http.StatusNoContent,
+		errores: []int{http.StatusNotFound},
+	},
+}
+
+// erroresAcceso son los errores que agrega cada protección.
+var erroresAcceso = map[accesoAPI][]int{
+	accesoAutenticado:   {http.StatusUnauthorized, http.StatusForbidden},
+	accesoSinDosFA:      {http.StatusUnauthorized},
+	accesoSensible:      {http.StatusUnauthorized, http.StatusForbidden},
+	accesoAdministrador: {http.StatusUnauthorized, http.StatusForbidden},
+}
+
+// enumsAPI son los valores posibles de los tipos enumerados.
+var enumsAPI = map[reflect.Type][]string{
+	reflect.TypeOf(EstadoCuenta("")): {string(estadoActiva), string(estadoSuspendida), string(estadoEliminada)},
+}
+
+// parametroRuta encuentra los parámetros {nombre} de una ruta.
+var parametroRuta = regexp.MustCompile(`\{(\w+)\}`)
+
+// esquemasAPI genera los esquemas JSON Schema de los tipos Go. Los
+// structs con nombre se agregan a components/schemas y se referencian
+// con $ref.
+type esquemasAPI map[string]any
+
+// de devuelve el esquema de un tipo según su codificación con
+// encoding/json: los campos toman el nombre del tag json y son
+// requeridos salvo que tengan omitempty o sean punteros; los structs
+// embebidos aportan sus campos.
+func (e esquemasAPI) de(t reflect.Type) map[string]any {
+	if valores, ok := enumsAPI[t]; ok {
+		return map[string]any{"type": "string", "enum": valores}
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return e.de(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": e.de(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": e.de(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return e.objeto(t)
+		}
+		if _, ok := e[t.Name()]; !ok {
+			e[t.Name()] = nil // reserva el nombre para los tipos recursivos
+			e[t.Name()] = e.objeto(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+// objeto devuelve el esquema de los campos de un struct.
+func (e esquemasAPI) objeto(t reflect.Type) map[string]any {
+	propiedades := map[string]any{}
+	var requeridos []string
+	var agregar func(t reflect.Type)
+	agregar = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			campo := t.Field(i)
+			tag := campo.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			if campo.Anonymous && tag == "" && campo.Type.Kind() == reflect.Struct {
+				agregar(campo.Type)
+				continue
+			}
+			if !campo.IsExported() {
+				continue
+			}
+			nombre, opciones, _ := strings.Cut(tag, ",")
+			if nombre == "" {
+				nombre = campo.Name
+			}
+			propiedades[nombre] = e.de(campo.Type)
+			if !strings.Contains(opciones, "omitempty") && campo.Type.Kind() != reflect.Pointer {
+				requeridos = append(requeridos, nombre)
+			}
+		}
+	}
+	agregar(t)
+	esquema := map[string]any{"type": "object", "properties": propiedades}
+	if len(requeridos) > 0 {
+		esquema["required"] = requeridos
+	}
+	return esquema
+}
+
+// sobre devuelve el esquema del Sobre con el data y el error de una
+// respuesta. Sus campos siempre están presentes, aunque sean null.
+func (e esquemasAPI) sobre(data, err map[string]any) map[string]any {
+	return map[string]any{
+		"type":     "object",
+		"required": []string{"data", "error", "meta"},
+		"properties": map[string]any{
+			"data":  data,
+			"error": err,
+			"meta":  e.de(reflect.TypeOf(MetaSobre{})),
+		},
+	}
+}
+
+// contenidoAPI documenta un cuerpo JSON en los formatos que admite
+// negociarContenido: el mismo esquema en MessagePack y, si el endpoint
+// tiene mensaje en proto/usuarios.proto, Protobuf.
+func contenidoAPI(esquema map[string]any, protobuf bool) map[string]any {
+	contenido := map[string]any{
+		tipoJSON:    map[string]any{"schema": esquema},
+		tipoMsgpack: map[string]any{"schema": esquema},
+	}
+	if protobuf {
+		contenido[tipoProtobuf] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+	}
+	return contenido
+}
+
+// especificacionOpenAPI arma el documento OpenAPI 3 de la API a partir de
+// documentacionAPI.
+func especificacionOpenAPI() map[string]any {
+	esquemas := esquemasAPI{}
+	errorRef := esquemas.de(reflect.TypeOf(ErrorResponse{}))
+	errorSobreRef := esquemas.de(reflect.TypeOf(ErrorSobre{}))
+	sobreError := esquemas.sobre(map[string]any{"type": "object", "nullable": true}, errorSobreRef)
+	sinError := map[string]any{"nullable": true, "allOf": []any{errorSobreRef}}
+	problemaRef := esquemas.de(reflect.TypeOf(Problema{}))
+	rutas := map[string]any{}
+
+	patrones := make([]string, 0, len(documentacionAPI))
+	for patron := range documentacionAPI {
+		patrones = append(patrones, patron)
+	}
+	sort.Strings(patrones)
+
+	for _, patron := range patrones {
+		op := documentacionAPI[patron]
+		metodo, ruta, _ := strings.Cut(patron, " ")
+
+		var parametros []any
+		for _, m := range parametroRuta.FindAllStringSubmatch(ruta, -1) {
+			parametros = append(parametros, map[string]any{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, p := range op.parametros {
+			parametros = append(parametros, map[string]any{
+				"name": p.nombre, "in": "query", "required": p.requerido, "description": p.descripcion,
+				"schema": map[string]any{"type": p.tipo},
+			})
+		}
+		for _, h := range op.headers {
+			parametros = append(parametros, map[string]any{
+				"name": h.nombre, "in": "header", "required": h.requerido, "description": h.descripcion,
+				"schema": map[string]any{"type": h.tipo},
+			})
+		}
+
+		mensajes := mensajesProto[patron]
+		exito := map[string]any{"description": http.StatusText(op.status)}
+		if op.respuesta != nil {
+			esquema := esquemas.de(reflect.TypeOf(op.respuesta))
+			if op.tipoContenido != "" {
+				exito["content"] = map[string]any{op.tipoContenido: map[string]any{"schema": esquema}}
+			} else {
+				exito["content"] = contenidoAPI(esquemas.sobre(esquema, sinError), mensajes.respuesta != nil)
+			}
+		}
+		respuestas := map[string]any{fmt.Sprint(op.status): exito}
+		contenidoError := contenidoAPI(sobreError, mensajes.respuesta != nil)
+		contenidoError[tipoProblema] = map[string]any{"schema": problemaRef}
+		if op.tipoContenido != "" {
+			contenidoError = map[string]any{tipoJSON: map[string]any{"schema": errorRef}}
+		}
+		errores := slices.Concat(erroresAcceso[op.acceso], op.errores)
+		if op.cuerpo != nil {
+			errores = append(errores, http.StatusBadRequest, http.StatusRequestEntityTooLarge)
+		}
+		for _, status := range errores {
+			respuestas[fmt.Sprint(status)] = map[string]any{
+				"description": http.StatusText(status),
+				"content":     contenidoError,
+			}
+		}
+
+		operacion := map[string]any{
+			"tags":        []string{op.etiqueta},
+			"summary":     op.resumen,
+			"operationId": strings.ToLower(metodo) + strings.NewReplacer("/", "_", "{", "", "}", "", "-", "_").Replace(ruta),
+			"responses":   respuestas,
+		}
+		if len(parametros) > 0 {
+			operacion["parameters"] = parametros
+		}
+		if op.cuerpo != nil {
+			operacion["requestBody"] = map[string]any{
+				"required": true,
+				"content":  contenidoAPI(esquemas.de(reflect.TypeOf(op.cuerpo)), mensajes.cuerpo != nil),
+			}
+		}
+		if op.acceso != accesoPublico {
+			operacion["security"] = []any{map[string]any{"bearerAuth": []string{}}}
+		}
+
+		operaciones, _ := rutas[prefijoAPI+ruta].(map[string]any)
+		if operaciones == nil {
+			operaciones = map[string]any{}
+			rutas[prefijoAPI+ruta] = operaciones
+		}
+		operaciones[strings.ToLower(metodo)] = operacion
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "StratPlus - API de usuarios",
+			"version":     strings.TrimPrefix(prefijoAPI, "/api/"),
+			"description": "Registro, login y gestión de cuentas. Las respuestas JSON y MessagePack van en un sobre {data, error, meta}: data es el resultado y error el problema, y sólo uno de los dos es distinto de null. Con Accept: application/problem+json los errores se responden en el formato de RFC 7807. Los mensajes de error se responden en español o inglés según Accept-Language. Además de JSON, los cuerpos se aceptan y producen en MessagePack y, en registro, login y perfil, en Protobuf (mensajes de proto/usuarios.proto), según Content-Type y Accept.",
+		},
+		"servers": []any{map[string]any{"url": config.URLPublica}},
+		"paths":   rutas,
+		"components": map[string]any{
+			"schemas": esquemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+}
+
+// documento es la especificación OpenAPI serializada.
+type documento struct {
+	json, yaml []byte
+}
+
+// documentoOpenAPI devuelve la especificación en JSON y en YAML. Se genera
+// una sola vez, con la configuración vigente al primer uso.
+var documentoOpenAPI = sync.OnceValues(func() (documento, error) {
+	especificacion := especificacionOpenAPI()
+	enJSON, err := json.MarshalIndent(especificacion, "", "  ")
+	if err != nil {
+		return documento{}, err
+	}
+	var enYAML bytes.Buffer
+	enc := yaml.NewEncoder(&enYAML)
+	enc.SetIndent(2)
+	if err := enc.Encode(especificacion); err != nil {
+		return documento{}, err
+	}
+	return documento{json: enJSON, yaml: enYAML.Bytes()}, nil
+})
+
+// inicializadorSwagger reemplaza al swagger-initializer.js de la
+// distribución de Swagger UI para cargar la especificación del servicio.
+const inicializadorSwagger = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+// registrarDocs sirve la especificación en /openapi.json y /openapi.yaml
+// y Swagger UI en /docs/, con sus archivos incluidos en el binario.
+func registrarDocs(mux *http.ServeMux) {
+	mux.HandleFunc("GET /openapi.json", especificacionHandler("application/json", func(d documento) []byte { return d.json }))
+	mux.HandleFunc("GET /openapi.yaml", especificacionHandler("application/yaml", func(d documento) []byte { return d.yaml }))
+	mux.HandleFunc("GET /docs/swagger-initializer.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		fmt.Fprint(w, inicializadorSwagger)
+	})
+	mux.Handle("GET /docs/", http.StripPrefix("/docs/", http.FileServerFS(swaggerFiles.FS)))
+}
+
+// especificacionHandler responde la especificación en un formato.
+func especificacionHandler(tipo string, formato func(documento) []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, err := documentoOpenAPI()
+		if err != nil {
+			escribirJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error interno del servidor", Codigo: "ERROR_INTERNO"})
+			return
+		}
+		w.Header().Set("Content-Type", tipo)
+		w.Write(formato(d))
+	}
+}
+
+// comandoOpenAPI escribe la especificación en la salida estándar, para
+// guardarla junto al código o pasarla a generadores de clientes:
+//
+//	pruebasgo openapi > openapi.yaml
+func comandoOpenAPI(args []string) {
+	fs := flag.NewFlagSet("openapi", flag.ExitOnError)
+	formato := fs.String("formato", "yaml", "formato de salida: yaml o json")
+	fs.StringVar(&config.URLPublica, "url", config.URLPublica, "URL base del servidor en la especificación")
+	fs.Parse(args)
+
+	d, err := documentoOpenAPI()
+	if err != nil {
+		fatal("Error generando la especificación OpenAPI", err)
+	}
+	switch *formato {
+	case "yaml":
+		os.Stdout.Write(d.yaml)
+	case "json":
+		os.Stdout.Write(append(d.json, '\n'))
+	default:
+		fmt.Fprintf(os.Stderr, "Formato desconocido: %s\n", *formato)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Límites de paginación de los listados.
+const (
+	limitePorDefecto = 20
+	limiteMaximo     = 100
+)
+
+// paginacion son los parámetros de un listado: limit y, para elegir la
+// página, page (desde 1) o cursor, el next_cursor de la respuesta
+// anterior. El cursor es la opción recomendada: a diferencia de page, no
+// repite ni salta elementos si el listado cambia entre peticiones.
+type paginacion struct {
+	page   int
+	limit  int
+	cursor *cursorListado
+}
+
+// cursorListado es la posición de un listado paginado por cursor: la
+// clave de orden y el ID del último elemento devuelto, y el orden con el
+// que se generó, para rechazarlo si la siguiente petición pide otro. Se
+// envía a los clientes como un valor opaco (ver codificar).
+type cursorListado struct {
+	Orden string `json:"o,omitempty"`
+	Clave string `json:"c,omitempty"`
+	ID    string `json:"i,omitempty"`
+}
+
+// codificar devuelve el cursor en base64url, como va en next_cursor.
+func (c cursorListado) codificar() string {
+	datos, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(datos)
+}
+
+// leerPaginacion interpreta los parámetros page, cursor y limit de un
+// listado. Si alguno es inválido, la página está fuera de rango o se
+// combinan page y cursor, responde 400 y devuelve false.
+func leerPaginacion(w http.ResponseWriter, q url.Values) (paginacion, bool) {
+	p := paginacion{page: 1, limit: limitePorDefecto}
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parámetro page inválido", Codigo: "PARAMETRO_INVALIDO"})
+			return paginacion{}, false
+		}
+		p.page = n
+	}
+	if v := q.Get("cursor"); v != "" {
+		if q.Has("page") {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "No se pueden combinar page y cursor", Codigo: "PAGINACION_INVALIDA"})
+			return paginacion{}, false
+		}
+		var c cursorListado
+		datos, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil || json.Unmarshal(datos, &c) != nil {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parámetro cursor inválido", Codigo: "PARAMETRO_INVALIDO"})
+			return paginacion{}, false
+		}
+		p.page, p.cursor = 0, &c
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > limiteMaximo {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parámetro limit inválido", Codigo: "PARAMETRO_INVALIDO"})
+			return paginacion{}, false
+		}
+		p.limit = n
+	}
+	// El desplazamiento de la página, (page-1)*limit, debe caber en un
+	// int: una página enorme lo desbordaría a un índice negativo.
+	if p.page-1 > math.MaxInt/p.limit {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parámetro page inválido", Codigo: "PARAMETRO_INVALIDO"})
+		return paginacion{}, false
+	}
+	return p, true
+}
+
+// paginar devuelve la página de elementos, ya ordenados, que indica p y
+// el cursor de la siguiente, vacío si es la última. Con cursor, la página
+// empieza en el primer elemento para el que despues es true; sin él, en
+// la página p.page. cursorDe da la posición de un elemento.
+func paginar[T any](elementos []T, p paginacion, despues func(T) bool, cursorDe func(T) cursorListado) ([]T, string) {
+	inicio := min((p.page-1)*p.limit, len(elementos))
+	if p.cursor != nil {
+		inicio = len(elementos)
+		for i, e := range elementos {
+			if despues(e) {
+				inicio = i
+				break
+			}
+		}
+	}
+	fin := min(inicio+p.limit, len(elementos))
+	pagina := append(make([]T, 0, fin-inicio), elementos[inicio:fin]...)
+	if fin == len(elementos) {
+		return pagina, ""
+	}
+	return pagina, cursorDe(elementos[fin-1]).codificar()
+}
+
+// siguienteCursor agrega el cursor de la siguiente página de un listado a
+// la meta del sobre de la respuesta (next_cursor). Si la respuesta no va
+// en un sobre, como al llamar al handler directamente, no hace nada.
+func siguienteCursor(w http.ResponseWriter, cursor string) {
+	for {
+		switch v := w.(type) {
+		case *respuestaEnSobre:
+			v.meta.NextCursor = cursor
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"pruebasgo/testutil"
+)
+
+// recorrerListado pide las páginas de ruta siguiendo meta.next_cursor
+// hasta la última y devuelve el data de cada una. antesDeSeguir, si no es
+// nil, se llama después de la primera página.
+func recorrerListado(t *testing.T, handler http.Handler, ruta, token string, antesDeSeguir func()) []json.RawMessage {
+	t.Helper()
+	var paginas []json.RawMessage
+	cursor := ""
+	for {
+		pedida := ruta
+		if cursor != "" {
+			pedida += "&cursor=" + url.QueryEscape(cursor)
+		}
+		w := enviar(handler, http.MethodGet, pedida, token, "")
+		var sobre struct {
+			Data json.RawMessage `json:"data"`
+			Meta MetaSobre       `json:"meta"`
+		}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &sobre) != nil {
+			t.Fatalf("%s: status %d: %s", pedida, w.Code, w.Body)
+		}
+		paginas = append(paginas, sobre.Data)
+		if sobre.Meta.NextCursor == "" {
+			return paginas
+		}
+		if len(paginas) > 10 {
+			t.Fatalf("%s: el listado no termina", ruta)
+		}
+		if len(paginas) == 1 && antesDeSeguir != nil {
+			antesDeSeguir()
+		}
+		cursor = sobre.Meta.NextCursor
+	}
+}
+
+func TestPaginacionPorCursor(t *testing.T) {
+	handler := routerConcurrente(t)
+	usarRepositorio(t, nuevoRepositorioMemoria())
+	antes := auditoria
+	auditoria = &registroAuditoria{max: maxAuditoriaPorDefecto}
+	t.Cleanup(func() { auditoria = antes })
+
+	api := testutil.Handler(handler)
+	var registrados []string
+	for range 5 {
+		u := testutil.NuevoUsuario()
+		api.Registrar(t, u)
+		registrados = append(registrados, u.Correo)
+	}
+	admin, token := api.UsuarioConToken(t)
+	registrados = append(registrados, admin.Correo)
+	u := buscarUsuario(admin.Correo)
+	desbloquear := u.bloquear()
+	u.Admin = true
+	desbloquear()
+
+	// Una cuenta que se registra entre páginas y queda antes del cursor no
+	// hace que se repita ningún usuario.
+	paginas := recorrerListado(t, handler, "/admin/usuarios?orden=correo&limit=2", token, func() {
+		api.Registrar(t, testutil.Usuario{Correo: "antes@ejemplo.com", Telefono: "5529999999", Password: "Secreta@123"})
+	})
+	var correos []string
+	for i, data := range paginas {
+		var listado ListadoUsuariosResponse
+		if err := json.Unmarshal(data, &listado); err != nil {
+			t.Fatal(err)
+		}
+		if (i > 0 && listado.Page != 0) || listado.Limit != 2 {
+			t.Errorf("page %d, limit %d con cursor", listado.Page, listado.Limit)
+		}
+		for _, u := range listado.Usuarios {
+			correos = append(correos, u.Correo)
+		}
+	}
+	slices.Sort(registrados)
+	if len(paginas) != 3 || !slices.Equal(correos, registrados) {
+		t.Errorf("%d páginas con %v, se esperaban 3 con %v", len(paginas), correos, registrados)
+	}
+
+	// La auditoría va del evento más reciente al más antiguo.
+	var actores []string
+	for _, data := range recorrerListado(t, handler, "/admin/auditoria?tipo=registro&limit=4", token, nil) {
+		var listado ListadoAuditoriaResponse
+		if err := json.Unmarshal(data, &listado); err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range listado.Eventos {
+			actores = append(actores, e.Actor)
+		}
+	}
+	if len(actores) != 7 || actores[0] != "antes@ejemplo.com" || actores[1] != admin.Correo {
+		t.Errorf("eventos de registro de %v", actores)
+	}
+
+	w := enviar(handler, http.MethodGet, "/admin/usuarios?orden=correo&limit=2", token, "")
+	var primera struct {
+		Meta MetaSobre `json:"meta"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &primera)
+	casos := []struct {
+		nombre, ruta, codigo string
+	}{
+		{"cursor inválido", "/admin/auditoria?cursor=no-es-un-cursor", "PARAMETRO_INVALIDO"},
+		{"cursor de otro orden", "/admin/usuarios?orden=-correo&cursor=" + primera.Meta.NextCursor, "PARAMETRO_INVALIDO"},
+		{"page y cursor", "/admin/usuarios?orden=correo&page=2&cursor=" + primera.Meta.NextCursor, "PAGINACION_INVALIDA"},
+		{"limit fuera de rango", "/perfil/sesiones?limit=101", "PARAMETRO_INVALIDO"},
+		{"page cero", "/admin/usuarios?page=0", "PARAMETRO_INVALIDO"},
+		// (page-1)*limit desbordaría a un desplazamiento negativo.
+		{"page desbordada en usuarios", "/admin/usuarios?limit=2&page=9223372036854775807", "PARAMETRO_INVALIDO"},
+		{"page desbordada en auditoría", "/admin/auditoria?page=9223372036854775807", "PARAMETRO_INVALIDO"},
+		{"page desbordada en sesiones", "/perfil/sesiones?limit=100&page=92233720368547760", "PARAMETRO_INVALIDO"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			w := enviar(handler, http.MethodGet, c.ruta, token, "")
+			var sobre Sobre
+			if err := json.Unmarshal(w.Body.Bytes(), &sobre); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != http.StatusBadRequest || sobre.Error == nil || sobre.Error.Codigo != c.codigo {
+				t.Errorf("status %d, respuesta %s; se esperaba 400 con código %s", w.Code, w.Body, c.codigo)
+			}
+		})
+	}
+}
+
+func TestListarSesiones(t *testing.T) {
+	handler := routerConcurrente(t)
+	usarRepositorio(t, nuevoRepositorioMemoria())
+	api := testutil.Handler(handler)
+	u, _ := api.UsuarioConToken(t)
+	api.Token(t, u)
+	token := api.Token(t, u)
+
+	var sesiones []Sesion
+	paginas := recorrerListado(t, handler, "/perfil/sesiones?limit=2", token, nil)
+	for _, data := range paginas {
+		var listado ListadoSesionesResponse
+		if err := json.Unmarshal(data, &listado); err != nil {
+			t.Fatal(err)
+		}
+		if listado.Total != 3 {
+			t.Errorf("total %d, se esperaban 3", listado.Total)
+		}
+		sesiones = append(sesiones, listado.Sesiones...)
+	}
+	if len(paginas) != 2 || len(sesiones) != 3 {
+		t.Fatalf("%d páginas con %d sesiones, se esperaban 2 con 3", len(paginas), len(sesiones))
+	}
+	for i := 1; i < len(sesiones); i++ {
+		if sesiones[i].Fecha.After(sesiones[i-1].Fecha) || sesiones[i].ID == sesiones[i-1].ID {
+			t.Errorf("sesiones fuera de orden o repetidas: %+v", sesiones)
+		}
+	}
+}
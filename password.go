@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"pruebasgo/validacion"
+)
+
+// politicaPasswordPorDefecto se usa mientras no se cargue otra.
+var politicaPasswordPorDefecto = validacion.PoliticaPassword{LongitudMinima: 6, LongitudMaxima: 12, Especiales: "@$&"}
+
+// politicaPassword es la política vigente; recargarConfig la reemplaza en
+// caliente.
+var politicaPassword atomic.Pointer[validacion.PoliticaPassword]
+
+// politicaPasswordVigente devuelve la política cargada o, si todavía no
+// se cargó, la por defecto.
+func politicaPasswordVigente() validacion.PoliticaPassword {
+	if politica := politicaPassword.Load(); politica != nil {
+		return *politica
+	}
+	return politicaPasswordPorDefecto
+}
+
+// cargarPoliticaPassword lee PASSWORD_LONGITUD_MIN,
+// PASSWORD_LONGITUD_MAX, PASSWORD_ESPECIALES (los caracteres especiales,
+// sin separador, p. ej. "@$&!#") y PASSWORD_ESPECIALES_UNICODE sobre los
+// valores por defecto.
+func cargarPoliticaPassword() (validacion.PoliticaPassword, error) {
+	p := politicaPasswordPorDefecto
+	for _, o := range []struct {
+		nombre  string
+		destino *int
+	}{{"PASSWORD_LONGITUD_MIN", &p.LongitudMinima}, {"PASSWORD_LONGITUD_MAX", &p.LongitudMaxima}} {
+		if v := opcion(o.nombre); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return p, fmt.Errorf("%s=%q: debe ser un entero positivo", o.nombre, v)
+			}
+			*o.destino = n
+		}
+	}
+	if v := opcion("PASSWORD_ESPECIALES"); v != "" {
+		if strings.IndexFunc(v, func(c rune) bool {
+			return unicode.IsLetter(c) || unicode.IsDigit(c) || unicode.IsSpace(c)
+		}) >= 0 {
+			return p, fmt.Errorf("PASSWORD_ESPECIALES=%q: no puede incluir letras, números ni espacios", v)
+		}
+		p.Especiales = v
+	}
+	if v := opcion("PASSWORD_ESPECIALES_UNICODE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, fmt.Errorf("PASSWORD_ESPECIALES_UNICODE=%q: debe ser true o false", v)
+		}
+		p.EspecialesUnicode = b
+	}
+	if p.LongitudMinima > p.LongitudMaxima {
+		return p, fmt.Errorf("PASSWORD_LONGITUD_MIN (%d) no puede ser mayor que PASSWORD_LONGITUD_MAX (%d)", p.LongitudMinima, p.LongitudMaxima)
+	}
+	return p, nil
+}
+
+// CambiarPasswordRequest define la estructura esperada para la petición
+// del endpoint /password/cambiar.
+type CambiarPasswordRequest struct {
+	PasswordActual string `json:"password_actual"`
+	PasswordNueva  string `json:"password_nueva"`
+}
+
+// cambiarPasswordHandler cambia la contraseña del usuario autenticado.
+// - Exige la contraseña actual
+// - Valida la nueva contra la política de contraseñas
+// - Invalida todos los tokens emitidos previamente
+func cambiarPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	var req CambiarPasswordRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+
+	if req.PasswordActual == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo password_actual", Codigo: "CAMPO_REQUERIDO"})
+		return
+	}
+	if req.PasswordNueva == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo password_nueva", Codigo: "CAMPO_REQUERIDO"})
+		return
+	}
+
+	if usuario.Password == "" || req.PasswordActual != usuario.Password {
+		slog.WarnContext(r.Context(), "Contraseña actual incorrecta en cambio de contraseña", "correo", usuario.Correo)
+		escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Contraseña actual incorrecta", Codigo: "PASSWORD_ACTUAL_INCORRECTA"})
+		return
+	}
+	var errPassword *validacion.ErrorPassword
+	if errors.As(validacion.Password(req.PasswordNueva, politicaPasswordVigente()), &errPassword) {
+		responderErrorServicio(w, erroresCampo(http.StatusBadRequest, []ErrorCampo{{
+			Campo:   "password_nueva",
+			Codigo:  codigoFormatoInvalido,
+			Mensaje: "Contraseña inválida",
+			Reglas:  errPassword.Mensajes(),
+
+			codigoRespuesta: "PASSWORD_INVALIDA",
+		}}))
+		return
+	}
+	if req.PasswordNueva == usuario.Password {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "La contraseña nueva debe ser distinta a la actual", Codigo: "PASSWORD_SIN_CAMBIO"})
+		return
+	}
+
+	usuario.Password = req.PasswordNueva
+	usuario.DebeCambiarPassword = false
+	registrarEvento(usuario, "password_cambiada")
+	eventosDominio.publicar(r, eventoPasswordCambiada, usuario)
+	auditar(r, "password_cambiada", usuario.Correo, "", "")
+	revocarTokens(r, usuario, "password_cambiada")
+	slog.InfoContext(r.Context(), "Contraseña cambiada", "correo", usuario.Correo)
+	escribirJSON(w, http.StatusOK, MensajeResponse{Mensaje: "Contraseña actualizada, vuelve a iniciar sesión"})
+}
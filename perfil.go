@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"pruebasgo/validacion"
+)
+
+// PerfilResponse define los datos públicos del perfil del usuario.
+type PerfilResponse struct {
+	ID                 string `json:"id"`
+	Correo             string `json:"correo"`
+	Telefono           string `json:"telefono"`
+	CorreoVerificado   bool   `json:"correo_verificado"`
+	TelefonoVerificado bool   `json:"telefono_verificado"`
+	DosFAActivo        bool   `json:"dos_fa_activo"`
+	Idioma             string `json:"idioma"`
+}
+
+// ActualizarPerfilRequest define la estructura esperada para PUT /perfil.
+// Los campos son punteros para distinguir "no enviado" de "vacío" y
+// permitir actualizaciones parciales.
+type ActualizarPerfilRequest struct {
+	Telefono *string `json:"telefono"`
+	Idioma   *string `json:"idioma"`
+}
+
+// nuevoPerfilResponse arma la respuesta de perfil de un usuario.
+func nuevoPerfilResponse(u *Usuario) PerfilResponse {
+	return PerfilResponse{
+		ID:                 u.ID,
+		Correo:             u.Correo,
+		Telefono:           u.Telefono,
+		CorreoVerificado:   u.CorreoVerificado,
+		TelefonoVerificado: u.TelefonoVerificado,
+		DosFAActivo:        u.DosFAActivo,
+		Idioma:             u.idioma(),
+	}
+}
+
+// obtenerPerfilHandler devuelve el perfil del usuario autenticado.
+func obtenerPerfilHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	escribirJSON(w, http.StatusOK, nuevoPerfilResponse(usuario))
+}
+
+// actualizarPerfilHandler valida y aplica los cambios de perfil del
+// usuario autenticado. Si el teléfono cambia, vuelve a quedar sin
+// verificar y se envía un código nuevo. El idioma elige las plantillas de
+// los correos que recibe.
+func actualizarPerfilHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	var req ActualizarPerfilRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+
+	if req.Telefono != nil {
+		telefono, err := validacion.Telefono(*req.Telefono, config.PaisTelefono)
+		if err != nil {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Teléfono inválido", Codigo: "TELEFONO_INVALIDO"})
+			return
+		}
+		req.Telefono = &telefono
+	}
+	if req.Idioma != nil && !slices.Contains(idiomasUsuario, *req.Idioma) {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Idioma no soportado", Codigo: "IDIOMA_NO_SOPORTADO"})
+		return
+	}
+	if req.Telefono != nil && *req.Telefono != usuario.Telefono {
+		if cambiarContactoUsuario(usuario, usuario.Correo, *req.Telefono) != nil {
+			escribirJSON(w, http.StatusConflict, ErrorResponse{Error: mensajesDuplicado[campoTelefono], Codigo: codigosDuplicado[campoTelefono]})
+			return
+		}
+		registrarEvento(usuario, "telefono_cambiado")
+		usuario.TelefonoVerificado = false
+		if err := enviarCodigoTelefono(r.Context(), usuario); err != nil {
+			slog.ErrorContext(r.Context(), "Error enviando verificación de teléfono", "error", err)
+		}
+	}
+
+	if req.Idioma != nil && *req.Idioma != usuario.idioma() {
+		usuario.Idioma = *req.Idioma
+		registrarEvento(usuario, "idioma_cambiado")
+	}
+
+	slog.InfoContext(r.Context(), "Perfil actualizado correctamente", "correo", usuario.Correo)
+	escribirJSON(w, http.StatusOK, nuevoPerfilResponse(usuario))
+}
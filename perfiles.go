@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Perfiles de ejecución, elegidos con PERFIL o --profile.
+const (
+	perfilDev  = "dev"
+	perfilProd = "prod"
+)
+
+// valoresPerfil son los valores por defecto de cada perfil. Tienen la
+// menor precedencia: cualquier flag, variable de entorno u opción del
+// archivo los reemplaza.
+var valoresPerfil = map[string]map[string]string{
+	perfilDev: {
+		"LOG_FORMATO":   "texto",
+		"LOG_NIVEL":     "debug",
+		"CORS_ORIGENES": "*",
+		"DATOS_SEED":    "true",
+	},
+	perfilProd: {
+		"LOG_FORMATO": "json",
+		"LOG_NIVEL":   "info",
+		"DOCS":        "false",
+	},
+}
+
+// cargarPerfil valida PERFIL y agrega los valores por defecto del perfil
+// elegido a las fuentes de configuración. Sin PERFIL no se aplica
+// ninguno.
+func cargarPerfil() error {
+	perfil := strings.ToLower(opcion("PERFIL"))
+	if perfil == "" {
+		return nil
+	}
+	valores, ok := valoresPerfil[perfil]
+	if !ok {
+		return fmt.Errorf("PERFIL=%q: debe ser %s o %s", perfil, perfilDev, perfilProd)
+	}
+	fuentes.mu.Lock()
+	defer fuentes.mu.Unlock()
+	fuentes.perfil = valores
+	return nil
+}
+
+// verificarPerfilProd comprueba los requisitos del perfil prod que no
+// son simples valores por defecto: no se cargan datos de ejemplo ni de
+// prueba y el servidor debe servir por TLS, o declarar con
+// TLS_EN_PROXY=true que lo termina un proxy delante. La clave JWT se
+// exige en configurarClavesJWT.
+func verificarPerfilProd(https ConfigHTTPS) error {
+	if config.Perfil != perfilProd {
+		return nil
+	}
+	if config.DatosSeed {
+		return errors.New("el perfil prod no admite DATOS_SEED: las cuentas de ejemplo tienen contraseñas públicas")
+	}
+	if config.ArchivoSeed != "" {
+		return errors.New("el perfil prod no admite DATOS_SEED_ARCHIVO: los usuarios de prueba son sólo para dev y pruebas")
+	}
+	if !https.habilitado() && !config.TLSEnProxy {
+		return errors.New("el perfil prod requiere TLS: configura TLS_CERT/TLS_KEY o AUTOCERT_DOMINIOS, o TLS_EN_PROXY=true si un proxy termina TLS")
+	}
+	return nil
+}
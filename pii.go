@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// valorFiltrado reemplaza por completo los secretos en logs y eventos.
+const valorFiltrado = "[Filtrado]"
+
+// clavesSecretas son los atributos de log cuyo valor nunca se registra.
+var clavesSecretas = []string{"password", "token", "codigo", "secreto", "authorization", "cookie"}
+
+var (
+	patronCorreo = regexp.MustCompile(`[^\s@"'<>(),;:]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	patronJWT    = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+)
+
+// redactarPII es el ReplaceAttr del logger: se aplica a todos los
+// atributos, incluido el mensaje, para que ningún log contenga datos
+// personales o secretos completos aunque quien lo escriba olvide
+// enmascararlos. Según la clave:
+// - password, token, codigo, secreto, ...: se reemplaza el valor entero
+// - correo: se enmascara con enmascararCorreo
+// - telefono: sólo quedan visibles los últimos cuatro dígitos
+// En cualquier otro texto, incluidos los errores, se enmascaran los
+// correos y se filtran los JWT que aparezcan.
+func redactarPII(grupos []string, a slog.Attr) slog.Attr {
+	if len(grupos) == 0 && a.Key == slog.LevelKey {
+		return a
+	}
+	clave := strings.ToLower(a.Key)
+	for _, secreta := range clavesSecretas {
+		if strings.Contains(clave, secreta) {
+			return slog.String(a.Key, valorFiltrado)
+		}
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redactarTexto(err.Error()))
+		}
+		if s, ok := a.Value.Any().(fmt.Stringer); ok {
+			return slog.String(a.Key, redactarTexto(s.String()))
+		}
+		return a
+	default:
+		return a
+	}
+
+	valor := a.Value.String()
+	switch {
+	case valor == "":
+		return a
+	case strings.Contains(clave, "correo"):
+		return slog.String(a.Key, enmascararCorreo(valor))
+	case strings.Contains(clave, "telefono"):
+		return slog.String(a.Key, enmascararTelefono(valor))
+	}
+	return slog.String(a.Key, redactarTexto(valor))
+}
+
+// redactarTexto enmascara los correos y filtra los JWT contenidos en un
+// texto libre.
+func redactarTexto(s string) string {
+	s = patronJWT.ReplaceAllString(s, valorFiltrado)
+	return patronCorreo.ReplaceAllStringFunc(s, enmascararCorreo)
+}
+
+// redactarQuery filtra el valor de los parámetros sensibles de una URI,
+// p. ej. /verificar-correo?token=[Filtrado].
+func redactarQuery(uri string) string {
+	ruta, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return ruta + "?" + valorFiltrado
+	}
+	filtrada := false
+	for _, p := range parametrosSensibles {
+		if q.Has(p) {
+			q.Set(p, valorFiltrado)
+			filtrada = true
+		}
+	}
+	if !filtrada {
+		return uri
+	}
+	return ruta + "?" + q.Encode()
+}
+
+// enmascararCorreo oculta la parte local de un correo salvo sus dos
+// primeras letras, p. ej. ma***@dominio.com, para identificar la cuenta
+// en los logs sin registrar el correo completo.
+func enmascararCorreo(correo string) string {
+	local, dominio, ok := strings.Cut(correo, "@")
+	if !ok {
+		return "***"
+	}
+	runas := []rune(local)
+	visible := max(0, min(2, len(runas)-1))
+	return string(runas[:visible]) + "***@" + dominio
+}
+
+// enmascararTelefono deja visibles sólo los últimos cuatro caracteres de
+// un teléfono, p. ej. ******7890.
+func enmascararTelefono(telefono string) string {
+	runas := []rune(telefono)
+	if len(runas) <= 4 {
+		return strings.Repeat("*", len(runas))
+	}
+	return strings.Repeat("*", len(runas)-4) + string(runas[len(runas)-4:])
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Plantillas de los correos, en plantillas/correo. Cada una tiene una
+// versión de texto plano, <nombre>.txt, que define además el bloque
+// "asunto", y una HTML, <nombre>.html, que define el bloque "contenido"
+// del diseño común de base.html. Las de plantillas/correo están en
+// español; las de los demás idiomas de idiomasUsuario, en un
+// subdirectorio con su código (plantillas/correo/en).
+const (
+	plantillaCorreoVerificacion    = "verificacion"
+	plantillaCorreoBienvenida      = "bienvenida"
+	plantillaCorreoConfirmarCambio = "confirmar_cambio"
+	plantillaCorreoCambiado        = "correo_cambiado"
+	plantillaCorreoAlertaLogin     = "alerta_login"
+	plantillaCorreoAlertaSeguridad = "alerta_seguridad"
+	directorioPlantillasCorreo     = "plantillas/correo"
+	plantillaCorreoBase            = "base.html"
+)
+
+//go:embed plantillas/correo
+var archivosPlantillasCorreo embed.FS
+
+// Datos de las plantillas; alerta_seguridad recibe la Alerta.
+type (
+	// datosEnlaceCorreo son los de verificacion y confirmar_cambio.
+	datosEnlaceCorreo struct {
+		Enlace string
+		Horas  int
+	}
+	datosBienvenida struct {
+		Correo string
+	}
+	datosCorreoCambiado struct {
+		CorreoNuevo string
+	}
+	datosAlertaLogin struct {
+		Pais        string
+		IP          string
+		Dispositivo string
+		Fecha       time.Time
+		Enlace      string
+	}
+)
+
+// datosEjemploCorreo son, por plantilla, datos con los que se prueba al
+// cargarla. Una plantilla nueva necesita los suyos.
+var datosEjemploCorreo = map[string]any{
+	plantillaCorreoVerificacion:    datosEnlaceCorreo{Enlace: "https://ejemplo.com/verificar-correo?token=abc", Horas: 48},
+	plantillaCorreoBienvenida:      datosBienvenida{Correo: "ana@ejemplo.com"},
+	plantillaCorreoConfirmarCambio: datosEnlaceCorreo{Enlace: "https://ejemplo.com/correo/confirmar?token=abc", Horas: 24},
+	plantillaCorreoCambiado:        datosCorreoCambiado{CorreoNuevo: "nuevo@ejemplo.com"},
+	plantillaCorreoAlertaLogin:     datosAlertaLogin{Pais: "AR", IP: "203.0.113.7", Fecha: time.Now(), Enlace: "https://ejemplo.com/sesiones/revocar?token=abc"},
+	plantillaCorreoAlertaSeguridad: Alerta{Tipo: alertaFallosIP, Detalle: "10 logins fallidos", Fecha: time.Now(), IP: "203.0.113.7"},
+}
+
+// plantillaCorreo es un par de versiones, de texto y HTML, de un correo.
+type plantillaCorreo struct {
+	texto *texttemplate.Template
+	html  *htmltemplate.Template
+}
+
+// plantillasCorreo son, por idioma, las plantillas con que se arman los
+// correos; main las reemplaza al arrancar por las de la configuración.
+// Las embebidas son válidas, así que cargarlas no falla.
+var plantillasCorreo, _ = cargarPlantillasCorreo("")
+
+// cargarPlantillasCorreo interpreta las plantillas embebidas de cada
+// idioma, reemplazando cada archivo por el de la misma ruta en
+// directorio, si no está vacío y lo tiene. Cada plantilla se prueba con
+// sus datos de ejemplo, para que un campo inexistente falle al arrancar y
+// no al enviar.
+func cargarPlantillasCorreo(directorio string) (map[string]map[string]plantillaCorreo, error) {
+	porIdioma := map[string]map[string]plantillaCorreo{}
+	for _, idioma := range idiomasUsuario {
+		subdirectorio := idioma
+		if idioma == idiomaPorDefecto {
+			subdirectorio = ""
+		}
+		plantillas, err := cargarPlantillasIdioma(directorio, subdirectorio)
+		if err != nil {
+			return nil, err
+		}
+		porIdioma[idioma] = plantillas
+	}
+	return porIdioma, nil
+}
+
+// cargarPlantillasIdioma interpreta las plantillas de un idioma, las del
+// subdirectorio de plantillas/correo y de directorio.
+func cargarPlantillasIdioma(directorio, subdirectorio string) (map[string]plantillaCorreo, error) {
+	leer := func(archivo string) (string, error) {
+		archivo = path.Join(subdirectorio, archivo)
+		if directorio != "" {
+			datos, err := os.ReadFile(filepath.Join(directorio, filepath.FromSlash(archivo)))
+			if !errors.Is(err, fs.ErrNotExist) {
+				return string(datos), err
+			}
+		}
+		datos, err := fs.ReadFile(archivosPlantillasCorreo, path.Join(directorioPlantillasCorreo, archivo))
+		return string(datos), err
+	}
+	base, err := leer(plantillaCorreoBase)
+	if err != nil {
+		return nil, err
+	}
+	plantillas := map[string]plantillaCorreo{}
+	for nombre, ejemplo := range datosEjemploCorreo {
+		texto, err := leer(nombre + ".txt")
+		if err != nil {
+			return nil, err
+		}
+		html, err := leer(nombre + ".html")
+		if err != nil {
+			return nil, err
+		}
+		var p plantillaCorreo
+		p.texto, err = texttemplate.New(nombre + ".txt").Parse(texto)
+		if err == nil {
+			p.html, err = htmltemplate.New(plantillaCorreoBase).Parse(base)
+		}
+		if err == nil {
+			_, err = p.html.New(nombre + ".html").Parse(html)
+		}
+		if err == nil {
+			_, err = p.componer("ana@ejemplo.com", ejemplo)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path.Join(subdirectorio, nombre), err)
+		}
+		plantillas[nombre] = p
+	}
+	return plantillas, nil
+}
+
+// componerCorreo arma el correo de la plantilla, en el idioma indicado o,
+// si no hay plantillas de ese idioma, en el por defecto, para el
+// destinatario: el asunto y el texto plano con text/template y la versión
+// HTML con html/template, que escapa los datos según el contexto en que
+// aparecen (texto, atributos, URLs), así que un valor elegido por el
+// usuario no puede inyectar marcado ni enlaces.
+func componerCorreo(destinatario, idioma, nombre string, datos any) (mensajeCorreo, error) {
+	plantillas, ok := plantillasCorreo[idioma]
+	if !ok {
+		plantillas = plantillasCorreo[idiomaPorDefecto]
+	}
+	plantilla, ok := plantillas[nombre]
+	if !ok {
+		return mensajeCorreo{}, fmt.Errorf("plantilla de correo desconocida %q", nombre)
+	}
+	m, err := plantilla.componer(destinatario, datos)
+	if err != nil {
+		return mensajeCorreo{}, fmt.Errorf("plantilla %s: %w", nombre, err)
+	}
+	return m, nil
+}
+
+func (p plantillaCorreo) componer(destinatario string, datos any) (mensajeCorreo, error) {
+	var asunto, texto, html strings.Builder
+	if err := p.texto.ExecuteTemplate(&asunto, "asunto", datos); err != nil {
+		return mensajeCorreo{}, err
+	}
+	if err := p.texto.Execute(&texto, datos); err != nil {
+		return mensajeCorreo{}, err
+	}
+	if err := p.html.Execute(&html, datos); err != nil {
+		return mensajeCorreo{}, err
+	}
+	return mensajeCorreo{
+		Destinatario: destinatario,
+		Asunto:       strings.Join(strings.Fields(asunto.String()), " "),
+		Cuerpo:       texto.String(),
+		HTML:         html.String(),
+	}, nil
+}
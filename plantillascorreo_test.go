@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlantillasCorreo(t *testing.T) {
+	fecha := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+	type casoPlantilla struct {
+		plantilla string
+		datos     any
+		asunto    string
+		contiene  []string
+	}
+	casos := []casoPlantilla{
+		{plantillaCorreoVerificacion, datosEnlaceCorreo{Enlace: "https://ejemplo.com/verificar-correo?token=abc", Horas: 48},
+			"Verifica tu correo", []string{"https://ejemplo.com/verificar-correo?token=abc", "48 horas"}},
+		{plantillaCorreoBienvenida, datosBienvenida{Correo: "ana@ejemplo.com"},
+			"Te damos la bienvenida a StratPlus", []string{"ana@ejemplo.com"}},
+		{plantillaCorreoConfirmarCambio, datosEnlaceCorreo{Enlace: "https://ejemplo.com/cambiar-correo?token=abc", Horas: 24},
+			"Confirma tu nuevo correo", []string{"https://ejemplo.com/cambiar-correo?token=abc", "24 horas"}},
+		{plantillaCorreoCambiado, datosCorreoCambiado{CorreoNuevo: "nuevo@ejemplo.com"},
+			"Tu correo fue cambiado", []string{"nuevo@ejemplo.com"}},
+		{plantillaCorreoAlertaLogin, datosAlertaLogin{Pais: "AR", IP: "203.0.113.7", Dispositivo: "Firefox", Fecha: fecha, Enlace: "https://ejemplo.com/sesiones/revocar?token=abc"},
+			"Nuevo inicio de sesión en tu cuenta", []string{"AR", "203.0.113.7", "Firefox", "2026-03-14 09:30 UTC", "https://ejemplo.com/sesiones/revocar?token=abc"}},
+		{plantillaCorreoAlertaSeguridad, Alerta{Tipo: alertaFallosIP, Detalle: "10 logins fallidos", Fecha: fecha, IP: "203.0.113.7", Correo: "ana@ejemplo.com"},
+			"Alerta de seguridad: " + alertaFallosIP, []string{"10 logins fallidos", "2026-03-14T09:30:00Z", "ana@ejemplo.com"}},
+	}
+	for _, c := range casos {
+		t.Run(c.plantilla, func(t *testing.T) {
+			m, err := componerCorreo("ana@ejemplo.com", idiomaEspanol, c.plantilla, c.datos)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Destinatario != "ana@ejemplo.com" || m.Asunto != c.asunto {
+				t.Errorf("destinatario %q, asunto %q, se esperaba %q", m.Destinatario, m.Asunto, c.asunto)
+			}
+			if !strings.HasPrefix(m.HTML, "<!DOCTYPE html>") {
+				t.Errorf("el HTML no usa el diseño de base.html:\n%s", m.HTML)
+			}
+			for _, texto := range c.contiene {
+				if !strings.Contains(m.Cuerpo, texto) || !strings.Contains(m.HTML, texto) {
+					t.Errorf("%q no aparece en las dos versiones:\n%s\n%s", texto, m.Cuerpo, m.HTML)
+				}
+			}
+		})
+	}
+
+	// Todas las plantillas embebidas se cargan y tienen caso, para que una
+	// nueva no quede sin probar.
+	textos, _ := fs.Glob(archivosPlantillasCorreo, path.Join(directorioPlantillasCorreo, "*.txt"))
+	for _, archivo := range textos {
+		nombre := strings.TrimSuffix(path.Base(archivo), ".txt")
+		if _, ok := datosEjemploCorreo[nombre]; !ok {
+			t.Errorf("la plantilla %s no tiene datos de ejemplo y no se carga", nombre)
+		}
+		if !slices.ContainsFunc(casos, func(c casoPlantilla) bool { return c.plantilla == nombre }) {
+			t.Errorf("la plantilla %s no tiene caso de prueba", nombre)
+		}
+	}
+}
+
+func TestCargarPlantillasCorreoDeDirectorio(t *testing.T) {
+	directorio := t.TempDir()
+	escribir := func(archivo, contenido string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(directorio, archivo), []byte(contenido), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	escribir("bienvenida.txt", `{{define "asunto"}}Hola {{.Correo}}{{end}}Bienvenido a Acme.`)
+	escribir("base.html", `<html><body>Acme: {{template "contenido" .}}</body></html>`)
+	if err := os.Mkdir(filepath.Join(directorio, idiomaIngles), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	escribir(filepath.Join(idiomaIngles, "bienvenida.txt"), `{{define "asunto"}}Hi {{.Correo}}{{end}}Welcome to Acme.`)
+	plantillas, err := cargarPlantillasCorreo(directorio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	antes := plantillasCorreo
+	plantillasCorreo = plantillas
+	t.Cleanup(func() { plantillasCorreo = antes })
+
+	m, err := componerCorreo("ana@ejemplo.com", idiomaEspanol, plantillaCorreoBienvenida, datosBienvenida{Correo: "ana@ejemplo.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Asunto != "Hola ana@ejemplo.com" || m.Cuerpo != "Bienvenido a Acme." {
+		t.Errorf("asunto %q, texto %q, se esperaban los del directorio", m.Asunto, m.Cuerpo)
+	}
+	// El HTML de bienvenida es el embebido, dentro de la base del
+	// directorio.
+	if !strings.HasPrefix(m.HTML, "<html><body>Acme: ") || !strings.Contains(m.HTML, "<strong>ana@ejemplo.com</strong>") {
+		t.Errorf("HTML %q, se esperaba el contenido embebido en la base del directorio", m.HTML)
+	}
+	m, err = componerCorreo("ana@ejemplo.com", idiomaIngles, plantillaCorreoBienvenida, datosBienvenida{Correo: "ana@ejemplo.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// El inglés toma su texto del subdirectorio y conserva la base
+	// embebida, que el directorio sólo reemplaza en español.
+	if m.Asunto != "Hi ana@ejemplo.com" || m.Cuerpo != "Welcome to Acme." || !strings.Contains(m.HTML, `<html lang="en">`) {
+		t.Errorf("asunto %q, texto %q, se esperaban los de %s/ con la base embebida", m.Asunto, m.Cuerpo, idiomaIngles)
+	}
+
+	for _, c := range []struct{ nombre, contenido string }{
+		{"sintaxis", `{{define "asunto"}}Hola{{end}}{{.Correo`},
+		{"campo inexistente", `{{define "asunto"}}Hola{{end}}{{.Nombre}}`},
+		{"sin asunto", `Hola {{.Correo}}`},
+	} {
+		escribir("bienvenida.txt", c.contenido)
+		if _, err := cargarPlantillasCorreo(directorio); err == nil {
+			t.Errorf("%s: se esperaba un error", c.nombre)
+		}
+	}
+}
+
+func TestPlantillasCorreoEscapanLosDatos(t *testing.T) {
+	m, err := componerCorreo("ana@ejemplo.com", idiomaEspanol, plantillaCorreoCambiado, datosCorreoCambiado{
+		CorreoNuevo: `"><script>alert(1)</script>@ejemplo.com`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(m.HTML, "<script>") || !strings.Contains(m.HTML, "&lt;script&gt;") {
+		t.Errorf("el dato no se escapó en el HTML:\n%s", m.HTML)
+	}
+
+	m, err = componerCorreo("ana@ejemplo.com", idiomaEspanol, plantillaCorreoVerificacion, datosEnlaceCorreo{Enlace: "javascript:alert(1)", Horas: 48})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(m.HTML, `href="javascript:`) {
+		t.Errorf("se aceptó un enlace javascript: en el HTML:\n%s", m.HTML)
+	}
+
+	// Un salto de línea en los datos no llega al asunto, donde podría
+	// inyectar headers.
+	m, err = componerCorreo("ana@ejemplo.com", idiomaEspanol, plantillaCorreoAlertaSeguridad, Alerta{Tipo: "x\r\nBcc: otro@ejemplo.com", Fecha: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsAny(m.Asunto, "\r\n") {
+		t.Errorf("asunto %q con salto de línea", m.Asunto)
+	}
+
+	if _, err := componerCorreo("ana@ejemplo.com", idiomaEspanol, "no_existe", nil); err == nil {
+		t.Error("se esperaba un error con una plantilla desconocida")
+	}
+}
+
+func TestPlantillasCorreoEnIngles(t *testing.T) {
+	asuntos := map[string]string{
+		plantillaCorreoVerificacion:    "Verify your email",
+		plantillaCorreoBienvenida:      "Welcome to StratPlus",
+		plantillaCorreoConfirmarCambio: "Confirm your new email",
+		plantillaCorreoCambiado:        "Your email was changed",
+		plantillaCorreoAlertaLogin:     "New sign-in to your account",
+		plantillaCorreoAlertaSeguridad: "Security alert: " + alertaFallosIP,
+	}
+	for nombre, datos := range datosEjemploCorreo {
+		m, err := componerCorreo("ana@ejemplo.com", idiomaIngles, nombre, datos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Asunto != asuntos[nombre] || !strings.Contains(m.HTML, `<html lang="en">`) {
+			t.Errorf("%s: asunto %q, se esperaba %q en la base en inglés", nombre, m.Asunto, asuntos[nombre])
+		}
+	}
+
+	// Un idioma sin plantillas usa las del idioma por defecto.
+	m, err := componerCorreo("ana@ejemplo.com", "fr", plantillaCorreoBienvenida, datosBienvenida{Correo: "ana@ejemplo.com"})
+	if err != nil || m.Asunto != "Te damos la bienvenida a StratPlus" {
+		t.Errorf("asunto %q, error %v, se esperaba el español", m.Asunto, err)
+	}
+}
+
+func TestIdiomaDeLosCorreos(t *testing.T) {
+	prepararHandlers(t)
+	var asuntos []string
+	antes := enviarCorreo
+	enviarCorreo = func(_ context.Context, m mensajeCorreo) error {
+		asuntos = append(asuntos, m.Asunto)
+		return nil
+	}
+	t.Cleanup(func() { enviarCorreo = antes })
+
+	correo, telefono := cuentaNueva()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/registro", strings.NewReader(fmt.Sprintf(`{"correo":%q,"telefono":%q,"password":"Secreta@123"}`, correo, telefono)))
+	r.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	registroHandler(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("registro: status %d: %s", w.Code, w.Body)
+	}
+	if !slices.Equal(asuntos, []string{"Verify your email", "Welcome to StratPlus"}) {
+		t.Errorf("asuntos %q, se esperaban en el idioma del registro", asuntos)
+	}
+
+	usuario := buscarUsuario(correo)
+	token, err := generarToken(usuario, []string{"pwd"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actualizar := func(cuerpo string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPut, "/perfil", strings.NewReader(cuerpo))
+		r.Header.Set("Authorization", "Bearer "+token)
+		autenticado(actualizarPerfilHandler)(w, r)
+		return w
+	}
+	comprobarError(t, actualizar(`{"idioma":"fr"}`), http.StatusBadRequest, ErrorResponse{Error: "Idioma no soportado", Codigo: "IDIOMA_NO_SOPORTADO"})
+	w = actualizar(`{"idioma":"es"}`)
+	var perfil PerfilResponse
+	decodificarRespuesta(t, w, &perfil)
+	if perfil.Idioma != idiomaEspanol {
+		t.Errorf("idioma %q en el perfil, se esperaba %q", perfil.Idioma, idiomaEspanol)
+	}
+
+	asuntos = nil
+	func() {
+		defer usuario.bloquear()()
+		if err := enviarVerificacionCorreo(t.Context(), usuario); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if !slices.Equal(asuntos, []string{"Verifica tu correo"}) {
+		t.Errorf("asuntos %q, se esperaban en el idioma elegido", asuntos)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// ConfigPprof define si se exponen los endpoints de perfilado y dónde.
+// Ruta los agrega al router principal; Direccion los sirve en un listener
+// aparte (p. ej. "127.0.0.1:6060") que no se publica junto con la API.
+type ConfigPprof struct {
+	Ruta      bool
+	Direccion string
+}
+
+// cargarConfigPprof lee PPROF: vacío lo desactiva, "ruta" monta
+// /debug/pprof/ en el servidor principal y cualquier otro valor se toma
+// como la dirección de un listener dedicado.
+func cargarConfigPprof() ConfigPprof {
+	valor := strings.TrimSpace(opcion("PPROF"))
+	if strings.EqualFold(valor, "ruta") {
+		return ConfigPprof{Ruta: true}
+	}
+	return ConfigPprof{Direccion: valor}
+}
+
+// registrarPprof agrega los endpoints de net/http/pprof bajo
+// /debug/pprof/. Sólo los puede consultar un administrador: los perfiles
+// exponen detalles internos y /debug/pprof/profile consume CPU mientras
+// se genera.
+func registrarPprof(mux *http.ServeMux) {
+	mux.HandleFunc("GET /debug/pprof/", administrador(pprof.Index))
+	mux.HandleFunc("GET /debug/pprof/cmdline", administrador(pprof.Cmdline))
+	mux.HandleFunc("GET /debug/pprof/profile", administrador(pprof.Profile))
+	mux.HandleFunc("GET /debug/pprof/symbol", administrador(pprof.Symbol))
+	mux.HandleFunc("POST /debug/pprof/symbol", administrador(pprof.Symbol))
+	mux.HandleFunc("GET /debug/pprof/trace", administrador(pprof.Trace))
+}
+
+// servidorPprof devuelve el servidor dedicado a pprof si se configuró una
+// dirección, o nil.
+func servidorPprof(cfg ConfigPprof) *http.Server {
+	if cfg.Direccion == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	registrarPprof(mux)
+	return &http.Server{Addr: cfg.Direccion, Handler: requestIDMiddleware(mux)}
+}
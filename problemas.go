@@ -0,0 +1,67 @@
+package main
+
+import (
+	"cmp"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// tipoProblema es el Content-Type de los errores en el formato de RFC
+// 7807.
+const tipoProblema = "application/problem+json"
+
+// prefijoTipoProblema forma el type de cada problema con el código del
+// error, de modo que identifica la clase de error y no la ocurrencia.
+const prefijoTipoProblema = "urn:stratplus:error:"
+
+// Problema es un error en el formato de RFC 7807. Además de los miembros
+// del RFC lleva como extensiones el código, los errores por campo y el
+// request ID, los mismos datos que el error del Sobre.
+type Problema struct {
+	Tipo      string       `json:"type"`
+	Titulo    string       `json:"title"`
+	Status    int          `json:"status"`
+	Detalle   string       `json:"detail"`
+	Instancia string       `json:"instance"`
+	Codigo    string       `json:"codigo"`
+	Errores   []ErrorCampo `json:"errores,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// aceptaProblema indica si el Accept de la petición incluye
+// application/problem+json con q mayor que 0. Sólo cambia el formato de
+// los errores: las respuestas exitosas siguen la negociación habitual.
+func aceptaProblema(r *http.Request) bool {
+	for _, parte := range strings.Split(r.Header.Get("Accept"), ",") {
+		tipo, params, err := mime.ParseMediaType(strings.TrimSpace(parte))
+		if err != nil || !strings.EqualFold(tipo, tipoProblema) {
+			continue
+		}
+		if v, ok := params["q"]; ok {
+			if q, err := strconv.ParseFloat(v, 64); err != nil || q <= 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// escribirProblema responde el error como application/problem+json. El
+// instance es la ruta de la petición, sin la query, que puede llevar
+// tokens.
+func escribirProblema(w http.ResponseWriter, r *http.Request, status int, e ErrorResponse) {
+	e.Codigo = cmp.Or(e.Codigo, codigoStatus(status))
+	escribirJSONComo(w, status, tipoProblema, false, Problema{
+		Tipo:      prefijoTipoProblema + e.Codigo,
+		Titulo:    http.StatusText(status),
+		Status:    status,
+		Detalle:   e.Error,
+		Instancia: r.URL.Path,
+		Codigo:    e.Codigo,
+		Errores:   e.Errores,
+		RequestID: requestID(r),
+	})
+}
@@ -3,30 +3,150 @@
 package main
 
 import (
-	"encoding/json"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"strings"
+	"os"
+	"sync"
 	"time"
-	"unicode"
 
+	"github.com/getsentry/sentry-go"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 // Usuario representa la estructura de un usuario dentro del sistema.
 // Esta implementación simula una base de datos en memoria.
+//
+// Varias peticiones pueden usar al mismo usuario a la vez, así que, una
+// vez almacenado, sus campos se leen y se modifican con su lock tomado
+// (ver bloquear). Sólo ID, FechaRegistro, Admin y Origen, que no
+// cambian, se leen sin él.
 type Usuario struct {
+	mu sync.Mutex
+
+	ID       string
 	Correo   string
 	Telefono string
 	Password string
+	// DebeCambiarPassword indica que un administrador forzó el cambio de
+	// contraseña; hasta hacerlo el usuario sólo puede cambiarla.
+	DebeCambiarPassword bool
+
+	// IDExterno es el externalId con que el IdP de la empresa identifica
+	// a la cuenta que aprovisionó por SCIM.
+	IDExterno string
+	// Origen indica cómo se dio de alta la cuenta; SCIM sólo gestiona
+	// las que aprovisionó y el login federado no entra a las registradas
+	// con contraseña.
+	Origen OrigenCuenta
+
+	// Admin indica si el usuario tiene rol de administrador.
+	Admin         bool
+	Estado        EstadoCuenta
+	FechaRegistro time.Time
+
+	// SecretoTOTP es el secreto base32 del segundo factor; DosFAActivo
+	// indica si ya fue confirmado y se exige en el login.
+	SecretoTOTP string
+	DosFAActivo bool
+	// UltimoPasoTOTP es el paso del último código TOTP aceptado; los
+	// códigos de ese paso o anteriores se rechazan para que no se
+	// reutilicen.
+	UltimoPasoTOTP int64
+	// CodigosRespaldo guarda el hash de los códigos de respaldo sin usar.
+	CodigosRespaldo []string
+	// CodigoLogin es el hash del código de segundo factor enviado por SMS
+	// al teléfono verificado, con su vencimiento y los intentos fallidos.
+	CodigoLogin         string
+	VenceCodigoLogin    time.Time
+	IntentosCodigoLogin int
+
+	// CorreoVerificado indica si el usuario confirmó su correo; el token
+	// de verificación pendiente se guarda como hash junto con su vencimiento.
+	CorreoVerificado  bool
+	TokenVerificacion string
+	VenceVerificacion time.Time
+
+	// TelefonoVerificado indica si el usuario confirmó su teléfono con el
+	// código enviado por SMS, del que se guarda el hash, su vencimiento y
+	// los intentos fallidos.
+	TelefonoVerificado     bool
+	CodigoTelefono         string
+	VenceCodigoTelefono    time.Time
+	IntentosCodigoTelefono int
+
+	// CorreoPendiente es la nueva dirección solicitada, a la espera de que
+	// se confirme el enlace cuyo hash y vencimiento se guardan aquí.
+	CorreoPendiente   string
+	TokenCambioCorreo string
+	VenceCambioCorreo time.Time
+
+	// Sesiones y Eventos guardan el historial reciente de inicios de
+	// sesión y cambios en la cuenta.
+	Sesiones []Sesion
+	Eventos  []EventoCuenta
+
+	// Notificaciones guarda, por tipo de notificación, los canales que el
+	// usuario eligió; los tipos ausentes usan notificacionesPorDefecto.
+	Notificaciones map[string][]string
+	// Idioma es el código del idioma en que el usuario recibe los
+	// correos, uno de idiomasUsuario; vacío usa idiomaPorDefecto.
+	Idioma string
+
+	// VersionToken se incluye en cada JWT emitido; al incrementarla se
+	// invalidan todos los tokens anteriores del usuario.
+	VersionToken int
+	// SesionesRevocadas guarda el sid de las sesiones revocadas una por
+	// una, con el vencimiento de su token.
+	SesionesRevocadas map[string]time.Time
+}
+
+// OrigenCuenta indica cómo se dio de alta una cuenta.
+type OrigenCuenta string
+
+// Orígenes de una cuenta: el registro, que incluye las cuentas creadas
+// por un administrador o el seed, el aprovisionamiento SCIM y el login
+// federado.
+const (
+	origenRegistro OrigenCuenta = ""
+	origenSCIM     OrigenCuenta = "scim"
+	origenFederado OrigenCuenta = "federado"
+)
+
+// bloquear toma el lock del usuario y devuelve la función que lo libera:
+//
+//	defer usuario.bloquear()()
+//
+// Las operaciones lo toman antes que los locks del repositorio, y nunca
+// el de dos usuarios a la vez.
+func (u *Usuario) bloquear() (desbloquear func()) {
+	u.mu.Lock()
+	return u.mu.Unlock
+}
+
+// idioma devuelve el idioma en que el usuario recibe los correos.
+func (u *Usuario) idioma() string {
+	return cmp.Or(u.Idioma, idiomaPorDefecto)
 }
 
-// usuarios es una base de datos simulada en memoria.
-var usuarios = []Usuario{}
+// correoActual lee el correo del usuario tomando su lock.
+func (u *Usuario) correoActual() string {
+	defer u.bloquear()()
+	return u.Correo
+}
 
-// jwtKey es la clave secreta utilizada para firmar y verificar los tokens JWT.
-var jwtKey = []byte("mi_clave_secreta")
+// nuevoID genera un identificador aleatorio con formato UUID v4.
+func nuevoID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
 
 // RegistroRequest define la estructura esperada para la petición
 // del endpoint /registro.
@@ -41,279 +161,314 @@ type RegistroRequest struct {
 type LoginRequest struct {
 	Correo   string `json:"correo"`
 	Password string `json:"password"`
+	// Codigo es el código TOTP o de respaldo, requerido si el usuario
+	// tiene activo el segundo factor.
+	Codigo string `json:"codigo,omitempty"`
 }
 
 // ErrorResponse define la estructura estándar de respuesta de error.
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// Codigo identifica el error de forma estable cuando el cliente debe
+	// distinguirlo (p. ej. CUENTA_SUSPENDIDA).
+	Codigo string `json:"codigo,omitempty"`
+	// Errores lista todos los problemas de validación por campo; Error
+	// repite el mensaje del primero.
+	Errores []ErrorCampo `json:"errores,omitempty"`
 }
 
+// ErrorCampo describe un problema de validación de un campo del cuerpo.
+type ErrorCampo struct {
+	Campo   string `json:"campo"`
+	Codigo  string `json:"codigo"`
+	Mensaje string `json:"mensaje"`
+	// Reglas lista las reglas del formato que el valor no cumple, si el
+	// campo las tiene (p. ej. la contraseña).
+	Reglas []string `json:"reglas,omitempty"`
+	// codigoRespuesta es el código del ErrorResponse cuando este es el
+	// primer error (ver erroresCampo); no se envía.
+	codigoRespuesta string
+}
+
+// Códigos de ErrorCampo.
+const (
+	codigoRequerido       = "requerido"
+	codigoFormatoInvalido = "formato_invalido"
+	codigoDuplicado       = "duplicado"
+	codigoNoPermitido     = "no_permitido"
+	codigoSinMX           = "dominio_sin_mx"
+)
+
 // LoginResponse define la respuesta del login, incluyendo el token
 // generado y la fecha de inicio de sesión.
 type LoginResponse struct {
 	Token       string    `json:"token"`
 	FechaInicio time.Time `json:"fecha_inicio"`
+	// DebeCambiarPassword avisa que el token sólo sirve para cambiar la
+	// contraseña hasta que se cambie.
+	DebeCambiarPassword bool `json:"debe_cambiar_password,omitempty"`
 }
 
-// validarCorreo revisa que el correo tenga un formato válido.
-// Verifica la estructura básica de un email: texto@texto.texto
-func validarCorreo(correo string) bool {
-	correo = strings.TrimSpace(correo)
-	if correo == "" {
-		return false
+// generarToken firma un token JWT HS256 para el usuario indicado,
+// válido por config.TokenTTL. sub es el ID del usuario, que a diferencia
+// del correo no se reutiliza con otra cuenta. amr lista los métodos con
+// los que se autenticó el usuario (RFC 8176) y auth_time el momento de la
+// autenticación, ambos usados para exigir re-autenticación en operaciones
+// sensibles.
+// sesion, si no está vacío, es el ID de la Sesion del historial, que va
+// en el claim sid para poder revocar sólo esa sesión.
+func generarToken(usuario *Usuario, amr []string, sesion string) (string, error) {
+	ahora := relojTokens.ahora()
+	claims := jwt.MapClaims{
+		"sub":       usuario.ID,
+		"correo":    usuario.Correo,
+		"ver":       usuario.VersionToken,
+		"exp":       ahora.Add(config.TokenTTL).Unix(),
+		"auth_time": ahora.Unix(),
+		"amr":       amr,
 	}
-
-	// Dividir en partes por el @
-	partes := strings.Split(correo, "@")
-	if len(partes) != 2 {
-		return false // Debe tener exactamente un @
+	if sesion != "" {
+		claims["sid"] = sesion
 	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(claves.firma())
+}
 
-	parteLocal := partes[0]
-	dominio := partes[1]
-
-	// Validar parte local (antes del @)
-	if len(parteLocal) == 0 || len(parteLocal) > 64 {
-		return false
+// registroHandler maneja la creación de nuevos usuarios (ver
+// registrarCuenta) y responde 201 si la cuenta se creó.
+func registroHandler(w http.ResponseWriter, r *http.Request) {
+	var req RegistroRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		slog.InfoContext(r.Context(), "Cuerpo de registro rechazado", "motivo", errCuerpo.mensaje)
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
 	}
 
-	// No puede empezar o terminar con punto
-	if strings.HasPrefix(parteLocal, ".") || strings.HasSuffix(parteLocal, ".") {
-		return false
+	if _, errServicio := registrarCuenta(r, req); errServicio != nil {
+		responderErrorServicio(w, errServicio)
+		return
 	}
+	escribirJSON(w, http.StatusCreated, MensajeResponse{Mensaje: "Usuario registrado exitosamente"})
+}
 
-	// No puede tener puntos consecutivos
-	if strings.Contains(parteLocal, "..") {
-		return false
+// loginHandler maneja la autenticación de usuarios (ver iniciarSesion) y
+// responde con el token y la fecha de inicio.
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		slog.InfoContext(r.Context(), "El cuerpo de la petición es inválido", "motivo", errCuerpo.mensaje)
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
 	}
 
-	// Validar dominio
-	if len(dominio) == 0 || len(dominio) > 255 {
-		return false
+	resp, errServicio := iniciarSesion(r, req)
+	if errServicio != nil {
+		responderErrorServicio(w, errServicio)
+		return
 	}
+	escribirJSON(w, http.StatusOK, resp)
+}
 
-	// Debe contener al menos un punto
-	if !strings.Contains(dominio, ".") {
-		return false
-	}
+// main inicializa el servidor HTTP en el puerto 8080 (o HTTPS si hay
+// certificados configurados) con las rutas definidas en nuevoRouter,
+// envueltas por los middlewares globales, y lo apaga ordenadamente al
+// recibir SIGINT o SIGTERM.
+func main() {
+	ejecutarComando(os.Args[1:])
+}
 
-	// No puede empezar o terminar con punto o guión
-	if strings.HasPrefix(dominio, ".") || strings.HasSuffix(dominio, ".") ||
-		strings.HasPrefix(dominio, "-") || strings.HasSuffix(dominio, "-") {
-		return false
+// comandoServe configura el servicio y atiende peticiones hasta recibir
+// SIGINT o SIGTERM.
+func comandoServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	cargarFuentes := flagsConfig(fs)
+	fs.Parse(args)
+	if err := cargarFuentes(); err != nil {
+		fatal("Error leyendo el archivo de configuración", err)
 	}
-
-	// Validar que tenga extensión después del último punto
-	ultimoPunto := strings.LastIndex(dominio, ".")
-	extension := dominio[ultimoPunto+1:]
-	if len(extension) < 2 {
-		return false // La extensión debe tener al menos 2 caracteres
+	if err := cargarPerfil(); err != nil {
+		fatal("Configuración inválida", err)
 	}
-
-	// Validar caracteres permitidos en el correo
-	caracteresValidos := func(s string) bool {
-		for _, c := range s {
-			if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
-				(c >= '0' && c <= '9') || c == '.' || c == '-' || c == '_' || c == '@') {
-				return false
-			}
-		}
-		return true
+	dotenv, err := cargarDotenvDev()
+	if err != nil {
+		fatal("Error leyendo el archivo .env", err)
 	}
 
-	return caracteresValidos(correo)
-}
+	configurarLogs()
+	if dotenv != "" {
+		slog.Info("Archivo .env cargado", "ruta", dotenv)
+	}
 
-// validarTelefono valida que el teléfono tenga exactamente 10 dígitos numéricos.
-func validarTelefono(telefono string) bool {
-	if len(telefono) != 10 {
-		return false
+	cfg, err := cargarConfig()
+	if err != nil {
+		fatal("Configuración inválida", err)
 	}
-	for _, c := range telefono {
-		if c < '0' || c > '9' {
-			return false
-		}
+	config = cfg
+	if config.Perfil != "" {
+		slog.Info("Perfil de ejecución", "perfil", config.Perfil)
 	}
-	return true
-}
-
-// validarPassword revisa que la contraseña cumpla con:
-// - Longitud entre 6 y 12 caracteres
-// - Al menos una mayúscula
-// - Al menos una minúscula
-// - Al menos un número
-// - Al menos un carácter especial de la lista "@$&"
-func validarPassword(password string) bool {
-	if len(password) < 6 || len(password) > 12 {
-		return false
+	https := cargarConfigHTTPS()
+	if err := verificarPerfilProd(https); err != nil {
+		fatal("Configuración inválida", err)
 	}
-
-	var tieneMayus, tieneMinus, tieneNumero, tieneEspecial bool
-	especiales := "@$&"
-
-	for _, c := range password {
-		switch {
-		case unicode.IsUpper(c):
-			tieneMayus = true
-		case unicode.IsLower(c):
-			tieneMinus = true
-		case unicode.IsDigit(c):
-			tieneNumero = true
-		case strings.ContainsRune(especiales, c):
-			tieneEspecial = true
-		}
+	politica, err := cargarPoliticaPassword()
+	if err != nil {
+		fatal("Configuración inválida", err)
 	}
-
-	return tieneMayus && tieneMinus && tieneNumero && tieneEspecial
-}
-
-// registroHandler maneja la creación de nuevos usuarios.
-// - Valida los campos recibidos
-// - Revisa que no existan usuarios con el mismo correo o teléfono
-// - Guarda al usuario en memoria si es válido
-func registroHandler(w http.ResponseWriter, r *http.Request) {
-	var req RegistroRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	politicaPassword.Store(&politica)
+	reglas, err := cargarReglasCorreo()
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Cuerpo inválido"})
-		return
+		fatal("Configuración inválida", err)
 	}
-
-	// Validación de campos obligatorios
-	if req.Correo == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("Falta campo correo en el request.")
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Falta el campo correo"})
-		return
+	reglasCorreo.Store(&reglas)
+	auditoria = nuevoRegistroAuditoria()
+	seguridad = nuevoDetectorAnomalias(cargarConfigSeguridad())
+	configWebhooks, err := cargarConfigWebhooks()
+	if err != nil {
+		fatal("Configuración inválida", err)
 	}
-	if req.Telefono == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("Falta campo telefono en el request.")
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Falta el campo telefono"})
-		return
+	webhooks = nuevoDespachadorWebhooks(configWebhooks)
+	configTareas, err := cargarConfigTareas()
+	if err != nil {
+		fatal("Configuración inválida", err)
 	}
-	if req.Password == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("Falta campo contraseña en el request.")
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Falta el campo contraseña"})
-		return
+	if tareas, err = nuevosTrabajadoresTareas(configTareas); err != nil {
+		fatal("Error configurando las tareas en segundo plano", err)
 	}
-
-	// Validación de formatos
-	if !validarCorreo(req.Correo) {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Correo inválido"})
-		return
+	configCorreo, err := cargarConfigCorreo()
+	if err != nil {
+		fatal("Configuración inválida", err)
 	}
-	if !validarTelefono(req.Telefono) {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Teléfono inválido"})
-		return
+	if remitente, err = nuevoRemitenteCorreo(context.Background(), configCorreo); err != nil {
+		fatal("Error configurando el proveedor de correo", err)
 	}
-	if !validarPassword(req.Password) {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Contraseña inválida"})
-		return
+	plantillasCorreo = configCorreo.Plantillas
+	if configCorreo.Proveedor == proveedorCorreoConsola && config.Perfil == perfilProd {
+		slog.Warn("Sin proveedor de correo (CORREO_PROVEEDOR): los correos se escriben en la salida estándar")
+	} else {
+		slog.Info("Proveedor de correo", "proveedor", configCorreo.Proveedor)
 	}
-
-	// Revisión de duplicados
-	for _, u := range usuarios {
-		if u.Correo == req.Correo {
-			w.WriteHeader(http.StatusConflict)
-			json.NewEncoder(w).Encode(ErrorResponse{Error: "El correo ya se encuentra registrado"})
-			return
-		}
-		if u.Telefono == req.Telefono {
-			w.WriteHeader(http.StatusConflict)
-			json.NewEncoder(w).Encode(ErrorResponse{Error: "El teléfono ya se encuentra registrado"})
-			return
-		}
+	configSMS, err := cargarConfigSMS()
+	if err != nil {
+		fatal("Configuración inválida", err)
 	}
-
-	// Registro exitoso
-	usuarios = append(usuarios, Usuario{
-		Correo:   req.Correo,
-		Telefono: req.Telefono,
-		Password: req.Password,
-	})
-	fmt.Println("Usuario registrado correctamente")
-	w.WriteHeader(http.StatusCreated)
-	fmt.Fprintf(w, `{"mensaje":"Usuario registrado exitosamente"}`)
-}
-
-// loginHandler maneja la autenticación de usuarios.
-// - Verifica las credenciales
-// - Genera un token JWT válido por 24 horas
-// - Responde con el token y la fecha de inicio
-func loginHandler(w http.ResponseWriter, r *http.Request) {
-	var req LoginRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	if proveedorSMS, err = nuevoRemitenteSMS(configSMS); err != nil {
+		fatal("Error configurando el proveedor de SMS", err)
+	}
+	plantillasSMS = configSMS.Plantillas
+	if configSMS.Proveedor == proveedorSMSConsola && config.Perfil == perfilProd {
+		slog.Warn("Sin proveedor de SMS (SMS_PROVEEDOR): los SMS se escriben en la salida estándar")
+	} else {
+		slog.Info("Proveedor de SMS", "proveedor", configSMS.Proveedor)
+	}
+	configBroker, err := cargarConfigBroker()
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("El cuerpo de la peticion es invalido!!")
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Cuerpo inválido"})
-		return
+		fatal("Configuración inválida", err)
 	}
-
-	if req.Correo == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("Falta campo correo en el request.")
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Falta el campo correo"})
-		return
+	if eventosDominio, err = nuevoBrokerEventos(configBroker); err != nil {
+		fatal("Error configurando el broker de eventos", err)
 	}
-	if req.Password == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("Falta campo contraseña en el request.")
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Falta el campo contraseña"})
-		return
+	if funcionalidades, err = nuevasFeatureFlags(); err != nil {
+		fatal("Error configurando las feature flags", err)
 	}
-
-	// Búsqueda de usuario
-	var usuario *Usuario
-	for _, u := range usuarios {
-		if u.Correo == req.Correo && u.Password == req.Password {
-			usuario = &u
-			break
+	if err := configurarClavesJWT(context.Background()); err != nil {
+		fatal("Error cargando los secretos", err)
+	}
+	if config.DatosSeed {
+		cargarDatosSeed()
+	}
+	if config.ArchivoSeed != "" {
+		creados, err := cargarArchivoSeed(config.ArchivoSeed)
+		if err != nil {
+			fatal("Error cargando los usuarios de prueba", err)
 		}
+		slog.Info("Usuarios de prueba cargados", "archivo", config.ArchivoSeed, "creados", creados)
 	}
-
-	if usuario == nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Println("Usuario no encontrado.")
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Correo o contraseña incorrectos"})
-		return
+	if config.DBURL != "" && config.Almacenamiento == "memoria" {
+		slog.Warn("DB_URL está definido, pero los usuarios se guardan en memoria")
 	}
 
-	// Generación de token JWT
-	claims := jwt.MapClaims{
-		"correo": usuario.Correo,
-		"exp":    time.Now().Add(time.Hour * 24).Unix(),
+	accesos, err := accesosMiddleware(cargarConfigAccesos())
+	if err != nil {
+		fatal("Error configurando el log de acceso", err)
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	configSaturacion, err := cargarConfigSaturacion()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Println("Error al generar el token")
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error generando token"})
-		return
+		fatal("Configuración inválida", err)
+	}
+	configCompresion, err := cargarConfigCompresion()
+	if err != nil {
+		fatal("Configuración inválida", err)
+	}
+	configTimeouts, err := cargarConfigTimeouts()
+	if err != nil {
+		fatal("Configuración inválida", err)
 	}
 
-	// Respuesta exitosa
-	resp := LoginResponse{
-		Token:       tokenString,
-		FechaInicio: time.Now(),
+	var handler http.Handler = nuevoRouter()
+	handler = corsMiddleware(cargarConfigCORS())(handler)
+	handler = recuperacionMiddleware(handler)
+	handler = saturacionMiddleware(configSaturacion)(handler)
+	handler = idiomaMiddleware(handler)
+	handler = compresionMiddleware(configCompresion)(handler)
+	handler = metricasMiddleware(handler)
+	handler = trazasMiddleware(handler)
+	handler = logsMiddleware(handler)
+	handler = accesos(handler)
+	handler = requestIDMiddleware(handler)
+
+	if activo, err := configurarSentry(); err != nil {
+		fatal("Error configurando Sentry", err)
+	} else if activo {
+		defer sentry.Flush(2 * time.Second)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
-}
 
-// main inicializa el servidor HTTP en el puerto 8080
-// y registra los handlers de /registro y /login.
-func main() {
-	http.HandleFunc("/registro", registroHandler)
-	http.HandleFunc("/login", loginHandler)
+	apagarTrazas, err := configurarTrazas(context.Background())
+	if err != nil {
+		fatal("Error configurando las trazas", err)
+	}
 
-	fmt.Println("Servidor iniciado en http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	servidores, err := servidoresAPI(handler, https)
+	if err != nil {
+		fatal("Error configurando HTTPS", err)
+	}
+	for _, srv := range servidores {
+		srv.RegisterOnShutdown(eventosSesion.avisarCierre)
+		switch {
+		case srv.TLSConfig != nil:
+			slog.Info("Servidor iniciado con HTTPS", "direccion", srv.Addr)
+		case https.habilitado():
+			slog.Info("Redirección de HTTP a HTTPS", "direccion", srv.Addr)
+		default:
+			slog.Info("Servidor iniciado", "direccion", srv.Addr)
+		}
+	}
+	if diagnostico := servidorPprof(cargarConfigPprof()); diagnostico != nil {
+		servidores = append(servidores, diagnostico)
+		slog.Info("Perfilado pprof habilitado", "direccion", diagnostico.Addr)
+	}
+	direccion, err := direccionGRPC()
+	if err != nil {
+		fatal("Configuración inválida", err)
+	}
+	if srv := servidorGRPC(direccion, configSaturacion); srv != nil {
+		servidores = append(servidores, srv)
+		slog.Info("Servidor gRPC iniciado", "direccion", srv.Addr)
+	}
+	for _, srv := range servidores {
+		configTimeouts.aplicar(srv)
+	}
+	recarga, detenerRecarga := context.WithCancel(context.Background())
+	go recargarConSIGHUP(recarga)
+	errServidor := ejecutarServidor(servidores...)
+	detenerRecarga()
+	eventosSesion.cerrar()
+	tareas.cerrar()
+	eventosDominio.cerrar()
+	if err := apagarTrazas(context.Background()); err != nil {
+		slog.Error("Error enviando las trazas pendientes", "error", err)
+	}
+	if errServidor != nil {
+		fatal("Error en el servidor", errServidor)
+	}
 }
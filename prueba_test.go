@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Las pruebas de los handlers, como los benchmarks, llaman a los handlers
+// directamente con httptest, sin red ni middlewares, sobre el store en
+// memoria con las cuentas de ejemplo.
+
+// cuentasPrueba numera las cuentas que crean las pruebas, para que no
+// choquen entre sí ni con las de una ejecución anterior con -count.
+var cuentasPrueba atomic.Int64
+
+// cuentaNueva devuelve un correo y un teléfono que no están registrados.
+func cuentaNueva() (correo, telefono string) {
+	n := cuentasPrueba.Add(1)
+	return fmt.Sprintf("prueba%d@ejemplo.com", n), fmt.Sprintf("5520%06d", n)
+}
+
+// mensajesEnviados reemplaza el envío de correos y SMS durante la prueba
+// y devuelve los destinatarios a los que se envió algo. Los envíos pueden
+// llegar desde varias goroutines; la lista se lee cuando terminaron.
+func mensajesEnviados(t *testing.T) *[]string {
+	t.Helper()
+	var mu sync.Mutex
+	var destinatarios []string
+	correo, sms := enviarCorreo, enviarSMS
+	enviarCorreo = func(_ context.Context, m mensajeCorreo) error {
+		mu.Lock()
+		defer mu.Unlock()
+		destinatarios = append(destinatarios, m.Destinatario)
+		return nil
+	}
+	enviarSMS = func(_ context.Context, telefono, _ string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		destinatarios = append(destinatarios, telefono)
+		return nil
+	}
+	t.Cleanup(func() { enviarCorreo, enviarSMS = correo, sms })
+	return &destinatarios
+}
+
+// atender envía cuerpo al handler y devuelve la respuesta.
+func atender(handler http.HandlerFunc, ruta, cuerpo string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, ruta, strings.NewReader(cuerpo)))
+	return w
+}
+
+// decodificarRespuesta decodifica el cuerpo JSON en destino rechazando
+// los campos que destino no tiene, de modo que un campo de más en la
+// respuesta haga fallar la prueba.
+func decodificarRespuesta(t *testing.T, w *httptest.ResponseRecorder, destino any) {
+	t.Helper()
+	if tipo := w.Header().Get("Content-Type"); tipo != tipoJSON {
+		t.Errorf("Content-Type %q, se esperaba %q", tipo, tipoJSON)
+	}
+	dec := json.NewDecoder(bytes.NewReader(w.Body.Bytes()))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(destino); err != nil {
+		t.Fatalf("respuesta %s: %v", w.Body, err)
+	}
+}
+
+// comprobarError verifica el status y el cuerpo de una respuesta de
+// error.
+func comprobarError(t *testing.T, w *httptest.ResponseRecorder, status int, esperado ErrorResponse) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status %d, se esperaba %d: %s", w.Code, status, w.Body)
+	}
+	var resp ErrorResponse
+	decodificarRespuesta(t, w, &resp)
+	if !reflect.DeepEqual(resp, esperado) {
+		t.Errorf("respuesta %+v, se esperaba %+v", resp, esperado)
+	}
+}
+
+func TestRegistroHandler(t *testing.T) {
+	prepararHandlers(t)
+	correo, telefono := cuentaNueva()
+	casos := []struct {
+		nombre string
+		cuerpo string
+		status int
+		error  ErrorResponse
+	}{
+		{
+			"campos faltantes", `{}`, http.StatusBadRequest,
+			ErrorResponse{Error: "Falta el campo correo", Codigo: "CAMPO_REQUERIDO", Errores: []ErrorCampo{
+				{Campo: "correo", Codigo: codigoRequerido, Mensaje: "Falta el campo correo"},
+				{Campo: "telefono", Codigo: codigoRequerido, Mensaje: "Falta el campo telefono"},
+				{Campo: "password", Codigo: codigoRequerido, Mensaje: "Falta el campo password"},
+			}},
+		},
+		{
+			"correo inválido", fmt.Sprintf(`{"correo":"no-es-correo","telefono":%q,"password":"Secreta@123"}`, telefono), http.StatusBadRequest,
+			ErrorResponse{Error: "Correo inválido", Codigo: "CORREO_INVALIDO", Errores: []ErrorCampo{
+				{Campo: "correo", Codigo: codigoFormatoInvalido, Mensaje: "Correo inválido"},
+			}},
+		},
+		{
+			"correo desechable", fmt.Sprintf(`{"correo":"ana@mailinator.com","telefono":%q,"password":"Secreta@123"}`, telefono), http.StatusBadRequest,
+			ErrorResponse{Error: "No se admiten correos desechables", Codigo: "CORREO_DESECHABLE", Errores: []ErrorCampo{
+				{Campo: "correo", Codigo: codigoNoPermitido, Mensaje: "No se admiten correos desechables"},
+			}},
+		},
+		{
+			"teléfono inválido", fmt.Sprintf(`{"correo":%q,"telefono":"123","password":"Secreta@123"}`, correo), http.StatusBadRequest,
+			ErrorResponse{Error: "Teléfono inválido", Codigo: "TELEFONO_INVALIDO", Errores: []ErrorCampo{
+				{Campo: "telefono", Codigo: codigoFormatoInvalido, Mensaje: "Teléfono inválido"},
+			}},
+		},
+		{
+			"contraseña sin mayúscula ni especial", fmt.Sprintf(`{"correo":%q,"telefono":%q,"password":"secreta123"}`, correo, telefono), http.StatusBadRequest,
+			ErrorResponse{Error: "Contraseña inválida", Codigo: "PASSWORD_INVALIDA", Errores: []ErrorCampo{
+				{Campo: "password", Codigo: codigoFormatoInvalido, Mensaje: "Contraseña inválida", Reglas: []string{"Debe incluir una mayúscula", "Debe incluir un carácter especial de @$&"}},
+			}},
+		},
+		{
+			"todos los campos inválidos", `{"correo":"no-es-correo","telefono":"123","password":"Secreta123"}`, http.StatusBadRequest,
+			ErrorResponse{Error: "Correo inválido", Codigo: "CORREO_INVALIDO", Errores: []ErrorCampo{
+				{Campo: "correo", Codigo: codigoFormatoInvalido, Mensaje: "Correo inválido"},
+				{Campo: "telefono", Codigo: codigoFormatoInvalido, Mensaje: "Teléfono inválido"},
+				{Campo: "password", Codigo: codigoFormatoInvalido, Mensaje: "Contraseña inválida", Reglas: []string{"Debe incluir un carácter especial de @$&"}},
+			}},
+		},
+		{
+			"correo duplicado", fmt.Sprintf(`{"correo":"usuario@example.com","telefono":%q,"password":"Secreta@123"}`, telefono), http.StatusConflict,
+			ErrorResponse{Error: "El correo ya se encuentra registrado", Codigo: "CORREO_DUPLICADO", Errores: []ErrorCampo{
+				{Campo: "correo", Codigo: codigoDuplicado, Mensaje: "El correo ya se encuentra registrado"},
+			}},
+		},
+		{
+			"correo duplicado con otras mayúsculas", fmt.Sprintf(`{"correo":" Usuario@Example.com ","telefono":%q,"password":"Secreta@123"}`, telefono), http.StatusConflict,
+			ErrorResponse{Error: "El correo ya se encuentra registrado", Codigo: "CORREO_DUPLICADO", Errores: []ErrorCampo{
+				{Campo: "correo", Codigo: codigoDuplicado, Mensaje: "El correo ya se encuentra registrado"},
+			}},
+		},
+		{
+			"teléfono duplicado en otro formato", fmt.Sprintf(`{"correo":%q,"telefono":"55 0000 0002","password":"Secreta@123"}`, correo), http.StatusConflict,
+			ErrorResponse{Error: "El teléfono ya se encuentra registrado", Codigo: "TELEFONO_DUPLICADO", Errores: []ErrorCampo{
+				{Campo: "telefono", Codigo: codigoDuplicado, Mensaje: "El teléfono ya se encuentra registrado"},
+			}},
+		},
+		{
+			"correo y teléfono duplicados", `{"correo":"usuario@example.com","telefono":"+525500000002","password":"Secreta@123"}`, http.StatusConflict,
+			ErrorResponse{Error: "El correo ya se encuentra registrado", Codigo: "CORREO_DUPLICADO", Errores: []ErrorCampo{
+				{Campo: "correo", Codigo: codigoDuplicado, Mensaje: "El correo ya se encuentra registrado"},
+				{Campo: "telefono", Codigo: codigoDuplicado, Mensaje: "El teléfono ya se encuentra registrado"},
+			}},
+		},
+		{
+			"campo desconocido", `{"correo":"ana@ejemplo.com","admin":true}`, http.StatusBadRequest,
+			ErrorResponse{Error: `Campo desconocido "admin"`, Codigo: "CAMPO_DESCONOCIDO"},
+		},
+		{
+			"JSON incompleto", `{"correo":"ana@ejemplo.com"`, http.StatusBadRequest,
+			ErrorResponse{Error: "JSON mal formado: el cuerpo está incompleto", Codigo: "CUERPO_MAL_FORMADO"},
+		},
+		{
+			"tipo inválido", `{"correo":5}`, http.StatusBadRequest,
+			ErrorResponse{Error: `Tipo inválido en el campo "correo"`, Codigo: "TIPO_INVALIDO"},
+		},
+		{
+			"cuerpo vacío", ``, http.StatusBadRequest,
+			ErrorResponse{Error: "El cuerpo está vacío", Codigo: "CUERPO_VACIO"},
+		},
+		{
+			"dos objetos", `{"correo":"ana@ejemplo.com"}{}`, http.StatusBadRequest,
+			ErrorResponse{Error: "El cuerpo debe contener un único objeto JSON", Codigo: "CUERPO_INVALIDO"},
+		},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			enviados := mensajesEnviados(t)
+			comprobarError(t, atender(registroHandler, "/registro", c.cuerpo), c.status, c.error)
+			if len(*enviados) > 0 {
+				t.Errorf("se enviaron mensajes a %v por un registro rechazado", *enviados)
+			}
+		})
+	}
+}
+
+func TestRegistroHandlerExitoso(t *testing.T) {
+	prepararHandlers(t)
+	enviados := mensajesEnviados(t)
+	correo, telefono := cuentaNueva()
+	cuerpo := fmt.Sprintf(`{"correo":%q,"telefono":%q,"password":"Secreta@123"}`, strings.ToUpper(correo), telefono)
+
+	w := atender(registroHandler, "/registro", cuerpo)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d, se esperaba %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	var resp MensajeResponse
+	decodificarRespuesta(t, w, &resp)
+	if resp.Mensaje != "Usuario registrado exitosamente" {
+		t.Errorf("mensaje %q", resp.Mensaje)
+	}
+
+	u := buscarUsuario(correo)
+	if u == nil {
+		t.Fatalf("el usuario %s no quedó registrado", correo)
+	}
+	if u.Telefono != "+52"+telefono || u.Admin || u.CorreoVerificado || u.TelefonoVerificado {
+		t.Errorf("usuario registrado %+v", u)
+	}
+	if !slices.Equal(*enviados, []string{correo, u.Telefono, correo}) {
+		t.Errorf("mensajes enviados a %v, se esperaba la verificación a %s y a %s y la bienvenida", *enviados, correo, u.Telefono)
+	}
+
+	comprobarError(t, atender(registroHandler, "/registro", cuerpo), http.StatusConflict, ErrorResponse{
+		Error:  "El correo ya se encuentra registrado",
+		Codigo: "CORREO_DUPLICADO",
+		Errores: []ErrorCampo{
+			{Campo: "correo", Codigo: codigoDuplicado, Mensaje: "El correo ya se encuentra registrado"},
+			{Campo: "telefono", Codigo: codigoDuplicado, Mensaje: "El teléfono ya se encuentra registrado"},
+		},
+	})
+}
+
+func TestLoginHandler(t *testing.T) {
+	prepararHandlers(t)
+	casos := []struct {
+		nombre string
+		cuerpo string
+		status int
+		error  ErrorResponse
+	}{
+		{"falta el correo", `{"password":"Usuario1@"}`, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo correo", Codigo: "CAMPO_REQUERIDO"}},
+		{"falta la contraseña", `{"correo":"usuario@example.com"}`, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo password", Codigo: "CAMPO_REQUERIDO"}},
+		{"contraseña incorrecta", `{"correo":"usuario@example.com","password":"Usuario2@"}`, http.StatusUnauthorized, ErrorResponse{Error: "Correo o contraseña incorrectos", Codigo: "CREDENCIALES_INVALIDAS"}},
+		{"contraseña con otras mayúsculas", `{"correo":"usuario@example.com","password":"usuario1@"}`, http.StatusUnauthorized, ErrorResponse{Error: "Correo o contraseña incorrectos", Codigo: "CREDENCIALES_INVALIDAS"}},
+		{"correo inexistente", `{"correo":"nadie@ejemplo.com","password":"Usuario1@"}`, http.StatusUnauthorized, ErrorResponse{Error: "Correo o contraseña incorrectos", Codigo: "CREDENCIALES_INVALIDAS"}},
+		{"campo desconocido", `{"correo":"usuario@example.com","password":"Usuario1@","recordar":true}`, http.StatusBadRequest, ErrorResponse{Error: `Campo desconocido "recordar"`, Codigo: "CAMPO_DESCONOCIDO"}},
+		{"JSON mal formado", `{"correo":}`, http.StatusBadRequest, ErrorResponse{Error: "JSON mal formado en la posición 11", Codigo: "CUERPO_MAL_FORMADO"}},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			comprobarError(t, atender(loginHandler, "/login", c.cuerpo), c.status, c.error)
+		})
+	}
+}
+
+func TestLoginHandlerExitoso(t *testing.T) {
+	prepararHandlers(t)
+	casos := []struct {
+		nombre, correo, password string
+	}{
+		{"cuenta de ejemplo", "usuario@example.com", "Usuario1@"},
+		{"correo con otras mayúsculas y espacios", "  USUARIO@example.com ", "Usuario1@"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			antes := time.Now()
+			cuerpo, _ := json.Marshal(LoginRequest{Correo: c.correo, Password: c.password})
+			w := atender(loginHandler, "/login", string(cuerpo))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d, se esperaba %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+
+			var campos map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &campos); err != nil {
+				t.Fatal(err)
+			}
+			if nombres := slices.Sorted(maps.Keys(campos)); !slices.Equal(nombres, []string{"fecha_inicio", "token"}) {
+				t.Errorf("campos de la respuesta %v, se esperaban fecha_inicio y token", nombres)
+			}
+
+			var resp LoginResponse
+			decodificarRespuesta(t, w, &resp)
+			if resp.FechaInicio.Before(antes.Truncate(time.Second)) || resp.FechaInicio.After(time.Now()) {
+				t.Errorf("fecha_inicio %v fuera del momento del login", resp.FechaInicio)
+			}
+			claims, err := validarToken(resp.Token)
+			if err != nil {
+				t.Fatalf("token inválido: %v", err)
+			}
+			if claims["correo"] != "usuario@example.com" {
+				t.Errorf("el token es de %v, se esperaba usuario@example.com", claims["correo"])
+			}
+		})
+	}
+}
+
+func TestLoginHandlerCorreoSinVerificar(t *testing.T) {
+	prepararHandlers(t)
+	mensajesEnviados(t)
+	correo, telefono := cuentaNueva()
+	registro := fmt.Sprintf(`{"correo":%q,"telefono":%q,"password":"Secreta@123"}`, correo, telefono)
+	if w := atender(registroHandler, "/registro", registro); w.Code != http.StatusCreated {
+		t.Fatalf("registro: status %d: %s", w.Code, w.Body)
+	}
+	login := fmt.Sprintf(`{"correo":%q,"password":"Secreta@123"}`, correo)
+
+	t.Setenv(variableFlag(flagVerificacionCorreo), "true")
+	comprobarError(t, atender(loginHandler, "/login", login), http.StatusForbidden, ErrorResponse{Error: "El correo no ha sido verificado", Codigo: "CORREO_NO_VERIFICADO"})
+
+	t.Setenv(variableFlag(flagVerificacionCorreo), "false")
+	if w := atender(loginHandler, "/login", login); w.Code != http.StatusOK {
+		t.Errorf("sin la verificación obligatoria: status %d: %s", w.Code, w.Body)
+	}
+}
+
+// cuentaConDosFA registra una cuenta con el teléfono verificado y el
+// segundo factor activo, y devuelve sus credenciales para /login.
+func cuentaConDosFA(t *testing.T) (*Usuario, string) {
+	t.Helper()
+	correo, telefono := cuentaNueva()
+	registro := fmt.Sprintf(`{"correo":%q,"telefono":%q,"password":"Secreta@123"}`, correo, telefono)
+	if w := atender(registroHandler, "/registro", registro); w.Code != http.StatusCreated {
+		t.Fatalf("registro: status %d: %s", w.Code, w.Body)
+	}
+	usuario := buscarUsuario(correo)
+	defer usuario.bloquear()()
+	usuario.TelefonoVerificado = true
+	usuario.DosFAActivo = true
+	usuario.SecretoTOTP = codificacionSecreto.EncodeToString([]byte("secreto-de-prueba-20"))
+	return usuario, fmt.Sprintf(`{"correo":%q,"password":"Secreta@123"}`, correo)
+}
+
+func TestLoginConCodigoSMS(t *testing.T) {
+	prepararHandlers(t)
+	mensajesEnviados(t)
+	var mensajes []string
+	sms := enviarSMS
+	enviarSMS = func(_ context.Context, _, mensaje string) error {
+		mensajes = append(mensajes, mensaje)
+		return nil
+	}
+	t.Cleanup(func() { enviarSMS = sms })
+	usuario, credenciales := cuentaConDosFA(t)
+
+	comprobarError(t, atender(enviarCodigoLoginHandler, "/login/codigo-sms", strings.Replace(credenciales, "Secreta@123", "Otra@1234", 1)),
+		http.StatusUnauthorized, ErrorResponse{Error: "Correo o contraseña incorrectos", Codigo: "CREDENCIALES_INVALIDAS"})
+	if w := atender(enviarCodigoLoginHandler, "/login/codigo-sms", credenciales); w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, se esperaba %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	mensaje := mensajes[len(mensajes)-1]
+	if !strings.HasPrefix(mensaje, "Tu código de inicio de sesión StratPlus es ") || !strings.Contains(mensaje, "Vence en 5 minutos") {
+		t.Fatalf("SMS %q, se esperaba la plantilla de login", mensaje)
+	}
+	codigo := strings.TrimSuffix(strings.Fields(mensaje)[8], ".")
+
+	login := func(codigo string) *httptest.ResponseRecorder {
+		return atender(loginHandler, "/login", strings.Replace(credenciales, "}", fmt.Sprintf(`,"codigo":%q}`, codigo), 1))
+	}
+	comprobarError(t, login("12345x"), http.StatusUnauthorized, ErrorResponse{Error: "Código de verificación inválido", Codigo: "CODIGO_INVALIDO"})
+	if w := login(codigo); w.Code != http.StatusOK {
+		t.Fatalf("login con el código del SMS: status %d: %s", w.Code, w.Body)
+	}
+	comprobarError(t, login(codigo), http.StatusUnauthorized, ErrorResponse{Error: "Código de verificación inválido", Codigo: "CODIGO_INVALIDO"})
+
+	t.Run("sin teléfono verificado", func(t *testing.T) {
+		func() {
+			defer usuario.bloquear()()
+			usuario.TelefonoVerificado = false
+		}()
+		comprobarError(t, atender(enviarCodigoLoginHandler, "/login/codigo-sms", credenciales),
+			http.StatusConflict, ErrorResponse{Error: "La cuenta no tiene segundo factor con un teléfono verificado", Codigo: "SMS_NO_DISPONIBLE"})
+	})
+}
+
+func TestLoginCodigoTOTPUnSoloUso(t *testing.T) {
+	prepararHandlers(t)
+	mensajesEnviados(t)
+	usuario, credenciales := cuentaConDosFA(t)
+	clave, _ := codificacionSecreto.DecodeString(usuario.SecretoTOTP)
+	paso := time.Now().Unix() / periodoTOTP
+
+	login := func(contador int64) *httptest.ResponseRecorder {
+		codigo := calcularTOTP(clave, uint64(contador))
+		return atender(loginHandler, "/login", strings.Replace(credenciales, "}", fmt.Sprintf(`,"codigo":%q}`, codigo), 1))
+	}
+	if w := login(paso); w.Code != http.StatusOK {
+		t.Fatalf("login con el código vigente: status %d: %s", w.Code, w.Body)
+	}
+	// Ni el mismo código ni el del paso anterior, aún dentro de la
+	// tolerancia de reloj, sirven otra vez; el del paso siguiente sí.
+	comprobarError(t, login(paso), http.StatusUnauthorized, ErrorResponse{Error: "Código de verificación inválido", Codigo: "CODIGO_INVALIDO"})
+	comprobarError(t, login(paso-1), http.StatusUnauthorized, ErrorResponse{Error: "Código de verificación inválido", Codigo: "CODIGO_INVALIDO"})
+	if w := login(paso + 1); w.Code != http.StatusOK {
+		t.Errorf("login con el código del paso siguiente: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestCodigoSMSLimitePorDestino(t *testing.T) {
+	prepararHandlers(t)
+	mensajesEnviados(t)
+	t.Setenv("LIMITE_SMS_DESTINO", "2/1h")
+	antes, limites := limitadorSMS, limitesVigentes.Load()
+	t.Cleanup(func() { limitadorSMS = antes; limitesVigentes.Store(limites) })
+	var err error
+	if limitadorSMS, err = nuevoLimitador(cargarConfigLimites()); err != nil {
+		t.Fatal(err)
+	}
+
+	// El registro envía el primer SMS, el de verificación del teléfono.
+	_, credenciales := cuentaConDosFA(t)
+	if w := atender(enviarCodigoLoginHandler, "/login/codigo-sms", credenciales); w.Code != http.StatusAccepted {
+		t.Fatalf("segundo SMS: status %d: %s", w.Code, w.Body)
+	}
+	w := atender(enviarCodigoLoginHandler, "/login/codigo-sms", credenciales)
+	comprobarError(t, w, http.StatusTooManyRequests, ErrorResponse{Error: "Demasiados códigos enviados a este teléfono, intenta más tarde", Codigo: "DEMASIADOS_SMS"})
+	if espera, _ := strconv.Atoi(w.Header().Get("Retry-After")); espera < 1 || espera > 1800 {
+		t.Errorf("Retry-After %q, se esperaba la media hora que tarda en recargarse un SMS", w.Header().Get("Retry-After"))
+	}
+}
+
+// fuzzHandler envía cuerpos arbitrarios al handler, con un repositorio
+// vacío y sin enviar mensajes, y comprueba que responda uno de los status
+// esperados con un cuerpo JSON, que en los errores trae el mensaje.
+func fuzzHandler(f *testing.F, handler http.HandlerFunc, semillas []string, status ...int) {
+	for _, semilla := range semillas {
+		f.Add(semilla)
+	}
+	f.Fuzz(func(t *testing.T, cuerpo string) {
+		prepararHandlers(t)
+		usarRepositorio(t, nuevoRepositorioMemoria())
+		mensajesEnviados(t)
+
+		w := atender(handler, "/", cuerpo)
+		if !slices.Contains(status, w.Code) {
+			t.Fatalf("cuerpo %q: status %d inesperado: %s", cuerpo, w.Code, w.Body)
+		}
+		if !json.Valid(w.Body.Bytes()) {
+			t.Fatalf("cuerpo %q: la respuesta no es JSON: %q", cuerpo, w.Body)
+		}
+		if w.Code >= http.StatusBadRequest {
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error == "" {
+				t.Fatalf("cuerpo %q: error sin mensaje: %s", cuerpo, w.Body)
+			}
+		}
+	})
+}
+
+// FuzzRegistroHandler busca cuerpos con los que /registro haga panic o
+// responda algo distinto de 201, 400, 409 o 413:
+//
+//	go test -run '^$' -fuzz FuzzRegistroHandler .
+func FuzzRegistroHandler(f *testing.F) {
+	fuzzHandler(f, registroHandler, []string{
+		`{"correo":"ana@ejemplo.com","telefono":"5512345678","password":"Secreta@123"}`,
+		`{"correo":"ANA@ejemplo.com ","telefono":"+52 55 1234 5678","password":"Ñandú1@ñandú"}`,
+		`{"correo":"ana@mailinator.com","telefono":"123","password":"x"}`,
+		`{}`, `{"correo":5}`, `null`, ``,
+	}, http.StatusCreated, http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge)
+}
+
+// FuzzLoginHandler es como FuzzRegistroHandler para /login, que responde
+// 400, 401 o 413 porque el repositorio está vacío.
+func FuzzLoginHandler(f *testing.F) {
+	fuzzHandler(f, loginHandler, []string{
+		`{"correo":"usuario@example.com","password":"Usuario1@"}`,
+		`{"correo":"usuario@example.com","password":"Usuario1@","codigo":"123456"}`,
+		`{"correo":"","password":""}`, `{}`, `[1]`, ``,
+	}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pruebasgo/validacion"
+)
+
+// Motivos por los que una dirección deja de recibir correos.
+const (
+	motivoRebote = "rebote"
+	motivoQueja  = "queja"
+)
+
+// errCorreoInvalido indica que no se envió un correo porque la dirección
+// está marcada como inválida.
+var errCorreoInvalido = errors.New("la dirección está marcada como inválida por un rebote o una queja")
+
+// CorreoInvalido es una dirección a la que no se envían más correos
+// porque rebotó de forma definitiva o su dueño marcó uno como spam.
+type CorreoInvalido struct {
+	Correo    string    `json:"correo"`
+	Motivo    string    `json:"motivo"`
+	Proveedor string    `json:"proveedor"`
+	Detalle   string    `json:"detalle,omitempty"`
+	Fecha     time.Time `json:"fecha"`
+}
+
+// listaCorreosInvalidos guarda en memoria, como los usuarios, las
+// direcciones marcadas como inválidas.
+type listaCorreosInvalidos struct {
+	mu      sync.Mutex
+	correos map[string]CorreoInvalido
+}
+
+// correosInvalidos son las direcciones a las que encolarCorreo no envía.
+var correosInvalidos = &listaCorreosInvalidos{correos: map[string]CorreoInvalido{}}
+
+// marcar agrega la dirección o, si ya estaba, actualiza el motivo.
+func (l *listaCorreosInvalidos) marcar(c CorreoInvalido) {
+	c.Correo = validacion.NormalizarCorreo(c.Correo)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.correos[c.Correo] = c
+}
+
+// invalido indica si la dirección está marcada.
+func (l *listaCorreosInvalidos) invalido(correo string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.correos[validacion.NormalizarCorreo(correo)]
+	return ok
+}
+
+// quitar desmarca la dirección. Devuelve false si no estaba marcada.
+func (l *listaCorreosInvalidos) quitar(correo string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.correos[validacion.NormalizarCorreo(correo)]
+	delete(l.correos, validacion.NormalizarCorreo(correo))
+	return ok
+}
+
+// todos devuelve las direcciones marcadas, de la más reciente a la más
+// antigua.
+func (l *listaCorreosInvalidos) todos() []CorreoInvalido {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	todos := slices.AppendSeq(make([]CorreoInvalido, 0, len(l.correos)), maps.Values(l.correos))
+	slices.SortFunc(todos, func(a, b CorreoInvalido) int { return b.Fecha.Compare(a.Fecha) })
+	return todos
+}
+
+// marcarCorreoInvalido registra el aviso de un proveedor en la lista, la
+// auditoría y las métricas.
+func marcarCorreoInvalido(r *http.Request, c CorreoInvalido) {
+	correosInvalidos.marcar(c)
+	metricaCorreosInvalidos.WithLabelValues(c.Proveedor, c.Motivo).Inc()
+	auditar(r, "correo_invalido", c.Proveedor, validacion.NormalizarCorreo(c.Correo), c.Motivo+": "+c.Detalle)
+	slog.WarnContext(r.Context(), "Correo marcado como inválido", "correo", c.Correo, "motivo", c.Motivo, "proveedor", c.Proveedor)
+}
+
+// ConfigEventosCorreo define cómo se autentican los avisos de rebotes y
+// quejas que envían los proveedores de correo.
+type ConfigEventosCorreo struct {
+	// ClaveSendGrid es la clave pública con que SendGrid firma su Event
+	// Webhook.
+	ClaveSendGrid *ecdsa.PublicKey
+	// TopicosSES son los ARN de los tópicos de SNS de los que se aceptan
+	// notificaciones de SES.
+	TopicosSES []string
+}
+
+// cargarConfigEventosCorreo lee SENDGRID_WEBHOOK_CLAVE (la clave de
+// verificación del Event Webhook firmado, en base64, como la muestra
+// SendGrid) y SES_SNS_TOPICOS (ARN de los tópicos de SNS que reciben los
+// rebotes y quejas de SES, separados por coma). Sin ellas no se registra
+// el receptor del proveedor.
+func cargarConfigEventosCorreo() (ConfigEventosCorreo, error) {
+	var cfg ConfigEventosCorreo
+	if v := opcion("SENDGRID_WEBHOOK_CLAVE"); v != "" {
+		der, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return cfg, fmt.Errorf("SENDGRID_WEBHOOK_CLAVE: %v", err)
+		}
+		clave, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return cfg, fmt.Errorf("SENDGRID_WEBHOOK_CLAVE: %v", err)
+		}
+		var ok bool
+		if cfg.ClaveSendGrid, ok = clave.(*ecdsa.PublicKey); !ok {
+			return cfg, errors.New("SENDGRID_WEBHOOK_CLAVE: debe ser una clave ECDSA")
+		}
+	}
+	for _, topico := range strings.Split(opcion("SES_SNS_TOPICOS"), ",") {
+		if topico = strings.TrimSpace(topico); topico != "" {
+			cfg.TopicosSES = append(cfg.TopicosSES, topico)
+		}
+	}
+	return cfg, nil
+}
+
+// registrarEventosCorreo registra los receptores de los proveedores
+// configurados en cfg.
+func registrarEventosCorreo(mux *http.ServeMux, cfg ConfigEventosCorreo) {
+	if cfg.ClaveSendGrid != nil {
+		mux.HandleFunc("POST /correo/eventos/sendgrid", eventosSendGridHandler(cfg.ClaveSendGrid))
+		slog.Info("Receptor de rebotes de SendGrid habilitado", "ruta", "/correo/eventos/sendgrid")
+	}
+	if len(cfg.TopicosSES) > 0 {
+		mux.HandleFunc("POST /correo/eventos/ses", eventosSESHandler(nuevoVerificadorSNS(), cfg.TopicosSES))
+		slog.Info("Receptor de rebotes de SES habilitado", "ruta", "/correo/eventos/ses")
+	}
+}
+
+// maxCuerpoEventosCorreo es el tamaño máximo de un lote de avisos.
+const maxCuerpoEventosCorreo = 5 << 20
+
+// Headers con que SendGrid firma cada lote del Event Webhook.
+const (
+	headerFirmaSendGrid  = "X-Twilio-Email-Event-Webhook-Signature"
+	headerFechaSendGrid  = "X-Twilio-Email-Event-Webhook-Timestamp"
+	eventoSendGridRebote = "bounce"
+	eventoSendGridQueja  = "spamreport"
+	// tipoSendGridBloqueado es el rebote temporal de SendGrid.
+	tipoSendGridBloqueado = "blocked"
+)
+
+// eventoSendGrid es un evento del lote que envía el Event Webhook.
+type eventoSendGrid struct {
+	Email  string `json:"email"`
+	Event  string `json:"event"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// eventosSendGridHandler recibe el Event Webhook de SendGrid, comprueba
+// su firma y marca como inválidas las direcciones de los rebotes
+// definitivos y de las quejas. Los demás eventos se ignoran.
+func eventosSendGridHandler(clave *ecdsa.PublicKey) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cuerpo, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCuerpoEventosCorreo))
+		if err != nil {
+			escribirJSON(w, http.StatusRequestEntityTooLarge, ErrorResponse{
+				Error:  fmt.Sprintf("El cuerpo excede el tamaño máximo de %d KB", maxCuerpoEventosCorreo>>10),
+				Codigo: "CUERPO_DEMASIADO_GRANDE",
+			})
+			return
+		}
+		firma, err := base64.StdEncoding.DecodeString(r.Header.Get(headerFirmaSendGrid))
+		suma := sha256.Sum256(append([]byte(r.Header.Get(headerFechaSendGrid)), cuerpo...))
+		if err != nil || !ecdsa.VerifyASN1(clave, suma[:], firma) {
+			slog.WarnContext(r.Context(), "Aviso de SendGrid con firma inválida")
+			escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Firma inválida", Codigo: "FIRMA_INVALIDA"})
+			return
+		}
+		var eventos []eventoSendGrid
+		if err := json.Unmarshal(cuerpo, &eventos); err != nil {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Cuerpo inválido", Codigo: "CUERPO_INVALIDO"})
+			return
+		}
+
+		for _, e := range eventos {
+			motivo := ""
+			switch {
+			case e.Event == eventoSendGridRebote && e.Type != tipoSendGridBloqueado:
+				motivo = motivoRebote
+			case e.Event == eventoSendGridQueja:
+				motivo = motivoQueja
+			}
+			if motivo != "" && e.Email != "" {
+				marcarCorreoInvalido(r, CorreoInvalido{
+					Correo: e.Email, Motivo: motivo, Proveedor: proveedorCorreoSendGrid, Detalle: e.Reason, Fecha: time.Now(),
+				})
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Tipos de mensaje de SNS.
+const (
+	tipoSNSNotificacion = "Notification"
+	tipoSNSSuscripcion  = "SubscriptionConfirmation"
+)
+
+// mensajeSNS es el sobre con que SNS entrega las notificaciones por HTTP.
+type mensajeSNS struct {
+	Type             string
+	MessageId        string
+	Token            string
+	TopicArn         string
+	Subject          string
+	Message          string
+	Timestamp        string
+	SignatureVersion string
+	Signature        string
+	SigningCertURL   string
+	SubscribeURL     string
+}
+
+// textoFirmado devuelve el texto que SNS firma: los campos del tipo de
+// mensaje, en orden alfabético, como "Nombre\nvalor\n".
+func (m mensajeSNS) textoFirmado() string {
+	campos := [][2]string{{"Message", m.Message}, {"MessageId", m.MessageId}}
+	if m.Type == tipoSNSNotificacion {
+		if m.Subject != "" {
+			campos = append(campos, [2]string{"Subject", m.Subject})
+		}
+		campos = append(campos, [2]string{"Timestamp", m.Timestamp})
+	} else {
+		campos = append(campos, [2]string{"SubscribeURL", m.SubscribeURL}, [2]string{"Timestamp", m.Timestamp}, [2]string{"Token", m.Token})
+	}
+	campos = append(campos, [2]string{"TopicArn", m.TopicArn}, [2]string{"Type", m.Type})
+	var texto strings.Builder
+	for _, c := range campos {
+		texto.WriteString(c[0] + "\n" + c[1] + "\n")
+	}
+	return texto.String()
+}
+
+// hostSNS reconoce los hosts desde los que SNS publica sus certificados
+// y sus enlaces de suscripción.
+var hostSNS = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// urlDeSNS indica si la URL es HTTPS y de SNS.
+func urlDeSNS(v string) bool {
+	u, err := url.Parse(v)
+	return err == nil && u.Scheme == "https" && hostSNS.MatchString(u.Host)
+}
+
+// verificadorSNS comprueba la firma de los mensajes de SNS con el
+// certificado de SigningCertURL, que descarga una vez.
+type verificadorSNS struct {
+	cliente      *http.Client
+	mu           sync.Mutex
+	certificados map[string]*x509.Certificate
+}
+
+func nuevoVerificadorSNS() *verificadorSNS {
+	return &verificadorSNS{cliente: nuevoClienteHTTP(10 * time.Second), certificados: map[string]*x509.Certificate{}}
+}
+
+// certificado devuelve el certificado de la URL, que debe ser de SNS.
+func (v *verificadorSNS) certificado(r *http.Request, direccion string) (*x509.Certificate, error) {
+	if !urlDeSNS(direccion) {
+		return nil, fmt.Errorf("SigningCertURL %q no es de SNS", direccion)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok := v.certificados[direccion]; ok {
+		return c, nil
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, direccion, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.cliente.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("certificado de SNS: status %d", resp.StatusCode)
+	}
+	datos, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	bloque, _ := pem.Decode(datos)
+	if bloque == nil {
+		return nil, errors.New("certificado de SNS sin PEM")
+	}
+	c, err := x509.ParseCertificate(bloque.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	v.certificados[direccion] = c
+	return c, nil
+}
+
+// verificar comprueba la firma del mensaje: SHA1 con RSA en la versión 1
+// y SHA256 con RSA en la 2.
+func (v *verificadorSNS) verificar(r *http.Request, m mensajeSNS) error {
+	var hash crypto.Hash
+	var suma []byte
+	switch m.SignatureVersion {
+	case "1":
+		s := sha1.Sum([]byte(m.textoFirmado()))
+		hash, suma = crypto.SHA1, s[:]
+	case "2":
+		s := sha256.Sum256([]byte(m.textoFirmado()))
+		hash, suma = crypto.SHA256, s[:]
+	default:
+		return fmt.Errorf("SignatureVersion %q no soportada", m.SignatureVersion)
+	}
+	firma, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return err
+	}
+	c, err := v.certificado(r, m.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	clave, ok := c.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("el certificado de SNS no tiene una clave RSA")
+	}
+	return rsa.VerifyPKCS1v15(clave, hash, suma, firma)
+}
+
+// notificacionSES es el mensaje de SES dentro del sobre de SNS, tanto de
+// las notificaciones de la identidad (notificationType) como de los
+// eventos de un configuration set (eventType).
+type notificacionSES struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Bounce           struct {
+		BounceType        string `json:"bounceType"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint struct {
+		ComplainedRecipients []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+		ComplaintFeedbackType string `json:"complaintFeedbackType"`
+	} `json:"complaint"`
+}
+
+// eventosSESHandler recibe por SNS las notificaciones de SES de los
+// tópicos permitidos, comprueba su firma, confirma la suscripción del
+// tópico y marca como inválidas las direcciones de los rebotes
+// permanentes y de las quejas.
+func eventosSESHandler(verificador *verificadorSNS, topicos []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var m mensajeSNS
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCuerpoEventosCorreo)).Decode(&m); err != nil {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Cuerpo inválido", Codigo: "CUERPO_INVALIDO"})
+			return
+		}
+		// Cualquiera puede crear un tópico de SNS con firma válida: sólo
+		// se aceptan los configurados.
+		if !slices.Contains(topicos, m.TopicArn) {
+			slog.WarnContext(r.Context(), "Aviso de SNS de un tópico no permitido", "topico", m.TopicArn)
+			escribirJSON(w, http.StatusForbidden, ErrorResponse{Error: "Tópico no permitido", Codigo: "TOPICO_NO_PERMITIDO"})
+			return
+		}
+		if err := verificador.verificar(r, m); err != nil {
+			slog.WarnContext(r.Context(), "Aviso de SNS con firma inválida", "error", err)
+			escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Firma inválida", Codigo: "FIRMA_INVALIDA"})
+			return
+		}
+
+		switch m.Type {
+		case tipoSNSSuscripcion:
+			if err := confirmarSuscripcionSNS(r, verificador.cliente, m.SubscribeURL); err != nil {
+				slog.ErrorContext(r.Context(), "Error confirmando la suscripción de SNS", "topico", m.TopicArn, "error", err)
+				escribirJSON(w, http.StatusBadGateway, ErrorResponse{Error: "No se pudo confirmar la suscripción", Codigo: "SUSCRIPCION_NO_CONFIRMADA"})
+				return
+			}
+			slog.InfoContext(r.Context(), "Suscripción de SNS confirmada", "topico", m.TopicArn)
+		case tipoSNSNotificacion:
+			var n notificacionSES
+			if err := json.Unmarshal([]byte(m.Message), &n); err != nil {
+				escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Cuerpo inválido", Codigo: "CUERPO_INVALIDO"})
+				return
+			}
+			procesarNotificacionSES(r, n)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// confirmarSuscripcionSNS visita el enlace de confirmación, que debe ser
+// de SNS.
+func confirmarSuscripcionSNS(r *http.Request, cliente *http.Client, direccion string) error {
+	if !urlDeSNS(direccion) {
+		return fmt.Errorf("SubscribeURL %q no es de SNS", direccion)
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, direccion, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := cliente.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// procesarNotificacionSES marca las direcciones de un rebote permanente o
+// de una queja. Los rebotes transitorios se ignoran: SES ya los reintentó.
+func procesarNotificacionSES(r *http.Request, n notificacionSES) {
+	tipo := n.NotificationType
+	if tipo == "" {
+		tipo = n.EventType
+	}
+	switch {
+	case tipo == "Bounce" && n.Bounce.BounceType == "Permanent":
+		for _, d := range n.Bounce.BouncedRecipients {
+			marcarCorreoInvalido(r, CorreoInvalido{
+				Correo: d.EmailAddress, Motivo: motivoRebote, Proveedor: proveedorCorreoSES, Detalle: d.DiagnosticCode, Fecha: time.Now(),
+			})
+		}
+	case tipo == "Complaint":
+		for _, d := range n.Complaint.ComplainedRecipients {
+			marcarCorreoInvalido(r, CorreoInvalido{
+				Correo: d.EmailAddress, Motivo: motivoQueja, Proveedor: proveedorCorreoSES, Detalle: n.Complaint.ComplaintFeedbackType, Fecha: time.Now(),
+			})
+		}
+	}
+}
+
+// listarCorreosInvalidosHandler devuelve las direcciones marcadas como
+// inválidas, de la más reciente a la más antigua.
+func listarCorreosInvalidosHandler(w http.ResponseWriter, r *http.Request) {
+	escribirJSON(w, http.StatusOK, correosInvalidos.todos())
+}
+
+// quitarCorreoInvalidoHandler vuelve a permitir los envíos a {correo},
+// p. ej. cuando el usuario confirma que su buzón ya funciona.
+func quitarCorreoInvalidoHandler(w http.ResponseWriter, r *http.Request) {
+	correo := validacion.NormalizarCorreo(r.PathValue("correo"))
+	if !correosInvalidos.quitar(correo) {
+		escribirJSON(w, http.StatusNotFound, ErrorResponse{Error: "El correo no está marcado como inválido", Codigo: "CORREO_NO_MARCADO"})
+		return
+	}
+	slog.InfoContext(r.Context(), "Correo desmarcado como inválido", "correo", correo)
+	auditar(r, "correo_valido", correoAutenticado(r), correo, "")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// usarCorreosInvalidos deja la lista de direcciones inválidas vacía
+// durante la prueba.
+func usarCorreosInvalidos(t *testing.T) {
+	t.Helper()
+	antes := correosInvalidos
+	correosInvalidos = &listaCorreosInvalidos{correos: map[string]CorreoInvalido{}}
+	t.Cleanup(func() { correosInvalidos = antes })
+}
+
+// transporteFunc responde las peticiones salientes sin tocar la red.
+type transporteFunc func(*http.Request) (*http.Response, error)
+
+func (f transporteFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestEventosSendGrid(t *testing.T) {
+	prepararHandlers(t)
+	usarCorreosInvalidos(t)
+	enviados := mensajesEnviados(t)
+	clave, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := eventosSendGridHandler(&clave.PublicKey)
+	enviar := func(cuerpo string, firmar bool) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/correo/eventos/sendgrid", strings.NewReader(cuerpo))
+		fecha := "1700000000"
+		r.Header.Set(headerFechaSendGrid, fecha)
+		if firmar {
+			suma := sha256.Sum256([]byte(fecha + cuerpo))
+			firma, err := ecdsa.SignASN1(rand.Reader, clave, suma[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set(headerFirmaSendGrid, base64.StdEncoding.EncodeToString(firma))
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	eventos := `[
+		{"email":"Rebota@Ejemplo.com","event":"bounce","type":"bounce","reason":"550 5.1.1 mailbox does not exist"},
+		{"email":"lleno@ejemplo.com","event":"bounce","type":"blocked","reason":"452 mailbox full"},
+		{"email":"spam@ejemplo.com","event":"spamreport"},
+		{"email":"ana@ejemplo.com","event":"delivered"}
+	]`
+	comprobarError(t, enviar(eventos, false), http.StatusUnauthorized, ErrorResponse{Error: "Firma inválida", Codigo: "FIRMA_INVALIDA"})
+	if len(correosInvalidos.todos()) != 0 {
+		t.Fatal("se marcaron correos con un aviso sin firma")
+	}
+	if w := enviar(eventos, true); w.Code != http.StatusNoContent {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	casos := map[string]bool{
+		"rebota@ejemplo.com": true,
+		"spam@ejemplo.com":   true,
+		"lleno@ejemplo.com":  false,
+		"ana@ejemplo.com":    false,
+	}
+	for correo, invalido := range casos {
+		if correosInvalidos.invalido(correo) != invalido {
+			t.Errorf("%s marcado como inválido: %v, se esperaba %v", correo, !invalido, invalido)
+		}
+		err := encolarCorreo(t.Context(), correo, idiomaPorDefecto, plantillaCorreoBienvenida, datosEjemploCorreo[plantillaCorreoBienvenida])
+		if errors.Is(err, errCorreoInvalido) != invalido {
+			t.Errorf("encolar a %s: error %v", correo, err)
+		}
+	}
+	if len(*enviados) != 2 {
+		t.Errorf("correos enviados a %v, se esperaban sólo los válidos", *enviados)
+	}
+	comprobarError(t, enviar("{", true), http.StatusBadRequest, ErrorResponse{Error: "Cuerpo inválido", Codigo: "CUERPO_INVALIDO"})
+}
+
+func TestEventosSES(t *testing.T) {
+	prepararHandlers(t)
+	usarCorreosInvalidos(t)
+	clave, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plantilla := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, plantilla, plantilla, &clave.PublicKey, clave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificado, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		urlCertificado = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-prueba.pem"
+		urlSuscripcion = "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&Token=abc"
+		topico         = "arn:aws:sns:us-east-1:123456789012:rebotes"
+	)
+	var confirmadas []string
+	verificador := nuevoVerificadorSNS()
+	verificador.certificados[urlCertificado] = certificado
+	verificador.cliente = &http.Client{Transport: transporteFunc(func(r *http.Request) (*http.Response, error) {
+		confirmadas = append(confirmadas, r.URL.String())
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})}
+	handler := eventosSESHandler(verificador, []string{topico})
+
+	mensaje := func(tipo, contenido string) mensajeSNS {
+		m := mensajeSNS{
+			Type: tipo, MessageId: nuevoID(), TopicArn: topico, Message: contenido,
+			Timestamp: time.Now().UTC().Format(time.RFC3339), SignatureVersion: "2", SigningCertURL: urlCertificado,
+		}
+		if tipo == tipoSNSSuscripcion {
+			m.Token, m.SubscribeURL = "abc", urlSuscripcion
+		}
+		suma := sha256.Sum256([]byte(m.textoFirmado()))
+		firma, err := rsa.SignPKCS1v15(rand.Reader, clave, crypto.SHA256, suma[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Signature = base64.StdEncoding.EncodeToString(firma)
+		return m
+	}
+	enviar := func(m mensajeSNS) *httptest.ResponseRecorder {
+		t.Helper()
+		cuerpo, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/correo/eventos/ses", strings.NewReader(string(cuerpo))))
+		return w
+	}
+
+	if w := enviar(mensaje(tipoSNSSuscripcion, "Confirma la suscripción")); w.Code != http.StatusNoContent {
+		t.Fatalf("suscripción: status %d: %s", w.Code, w.Body)
+	}
+	if len(confirmadas) != 1 || confirmadas[0] != urlSuscripcion {
+		t.Errorf("enlaces visitados %v, se esperaba la confirmación", confirmadas)
+	}
+
+	rebote := mensaje(tipoSNSNotificacion, `{"notificationType":"Bounce","bounce":{"bounceType":"Permanent",
+		"bouncedRecipients":[{"emailAddress":"rebota@ejemplo.com","diagnosticCode":"smtp; 550 5.1.1 user unknown"}]}}`)
+	transitorio := mensaje(tipoSNSNotificacion, `{"notificationType":"Bounce","bounce":{"bounceType":"Transient",
+		"bouncedRecipients":[{"emailAddress":"lleno@ejemplo.com"}]}}`)
+	queja := mensaje(tipoSNSNotificacion, `{"eventType":"Complaint","complaint":{"complaintFeedbackType":"abuse",
+		"complainedRecipients":[{"emailAddress":"spam@ejemplo.com"}]}}`)
+
+	otroTopico := rebote
+	otroTopico.TopicArn = "arn:aws:sns:us-east-1:999999999999:ajeno"
+	comprobarError(t, enviar(otroTopico), http.StatusForbidden, ErrorResponse{Error: "Tópico no permitido", Codigo: "TOPICO_NO_PERMITIDO"})
+	alterado := rebote
+	alterado.Message = strings.ReplaceAll(alterado.Message, "rebota@", "ana@")
+	comprobarError(t, enviar(alterado), http.StatusUnauthorized, ErrorResponse{Error: "Firma inválida", Codigo: "FIRMA_INVALIDA"})
+	otroCertificado := mensaje(tipoSNSNotificacion, rebote.Message)
+	otroCertificado.SigningCertURL = "https://atacante.ejemplo.com/cert.pem"
+	comprobarError(t, enviar(otroCertificado), http.StatusUnauthorized, ErrorResponse{Error: "Firma inválida", Codigo: "FIRMA_INVALIDA"})
+	if len(correosInvalidos.todos()) != 0 {
+		t.Fatalf("se marcaron correos con avisos rechazados: %+v", correosInvalidos.todos())
+	}
+
+	for _, m := range []mensajeSNS{rebote, transitorio, queja} {
+		if w := enviar(m); w.Code != http.StatusNoContent {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	}
+	marcados := correosInvalidos.todos()
+	if len(marcados) != 2 {
+		t.Fatalf("correos marcados %+v, se esperaban el rebote permanente y la queja", marcados)
+	}
+	for _, c := range marcados {
+		if c.Proveedor != proveedorCorreoSES || (c.Correo == "rebota@ejemplo.com") != (c.Motivo == motivoRebote) {
+			t.Errorf("correo marcado %+v", c)
+		}
+	}
+}
+
+func TestQuitarCorreoInvalido(t *testing.T) {
+	prepararHandlers(t)
+	usarCorreosInvalidos(t)
+	correosInvalidos.marcar(CorreoInvalido{Correo: "ana@ejemplo.com", Motivo: motivoRebote, Proveedor: proveedorCorreoSES, Fecha: time.Now()})
+	correosInvalidos.marcar(CorreoInvalido{Correo: "beto@ejemplo.com", Motivo: motivoQueja, Proveedor: proveedorCorreoSendGrid, Fecha: time.Now().Add(-time.Hour)})
+
+	w := httptest.NewRecorder()
+	listarCorreosInvalidosHandler(w, httptest.NewRequest(http.MethodGet, "/admin/correos-invalidos", nil))
+	var lista []CorreoInvalido
+	decodificarRespuesta(t, w, &lista)
+	if len(lista) != 2 || lista[0].Correo != "ana@ejemplo.com" {
+		t.Fatalf("lista %+v, se esperaba la más reciente primero", lista)
+	}
+
+	quitar := func(correo string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/admin/correos-invalidos/"+correo, nil)
+		r.SetPathValue("correo", correo)
+		quitarCorreoInvalidoHandler(w, r)
+		return w
+	}
+	if w := quitar("Ana@Ejemplo.com"); w.Code != http.StatusNoContent {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if correosInvalidos.invalido("ana@ejemplo.com") {
+		t.Error("el correo sigue marcado como inválido")
+	}
+	comprobarError(t, quitar("ana@ejemplo.com"), http.StatusNotFound, ErrorResponse{Error: "El correo no está marcado como inválido", Codigo: "CORREO_NO_MARCADO"})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// recargarConfig vuelve a leer el archivo de configuración y aplica sin
+// reiniciar las opciones que admiten cambios en caliente: el nivel de log
+// (LOG_NIVEL), los límites de peticiones (LIMITE_*), la política de
+// contraseñas (PASSWORD_LONGITUD_*), las reglas de validación de correo
+// (CORREO_PERMITIR_*) y las feature flags (FLAG_*), que se evalúan en
+// cada petición. El resto de opciones sólo cambia al reiniciar. Si el
+// archivo o algún valor es inválido no se aplica ningún cambio.
+func recargarConfig() error {
+	if err := fuentes.recargarArchivo(); err != nil {
+		return err
+	}
+	politica, err := cargarPoliticaPassword()
+	if err != nil {
+		return err
+	}
+	reglas, err := cargarReglasCorreo()
+	if err != nil {
+		return err
+	}
+	limites := cargarConfigLimites()
+	if err := validarFlagsConfig(); err != nil {
+		return err
+	}
+
+	nivelLogs.Set(nivelLog(opcion("LOG_NIVEL")))
+	limitesVigentes.Store(&limites)
+	politicaPassword.Store(&politica)
+	reglasCorreo.Store(&reglas)
+	slog.Info("Configuración recargada",
+		"nivel_log", nivelLogs.Level().String(),
+		"password_longitud_min", politica.LongitudMinima,
+		"password_longitud_max", politica.LongitudMaxima)
+	return nil
+}
+
+// recargarConSIGHUP llama a recargarConfig cada vez que el proceso recibe
+// SIGHUP, hasta que ctx se cancele.
+func recargarConSIGHUP(ctx context.Context) {
+	senales := make(chan os.Signal, 1)
+	signal.Notify(senales, syscall.SIGHUP)
+	defer signal.Stop(senales)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-senales:
+			if err := recargarConfig(); err != nil {
+				slog.Error("Error recargando la configuración", "error", err)
+			}
+		}
+	}
+}
+
+// recargarConfigHandler recarga la configuración a pedido de un
+// administrador. Responde 400 con el motivo si la nueva configuración es
+// inválida.
+func recargarConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if err := recargarConfig(); err != nil {
+		slog.WarnContext(r.Context(), "Error recargando la configuración", "error", err)
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Configuración inválida: " + err.Error(), Codigo: "CONFIGURACION_INVALIDA"})
+		return
+	}
+	auditar(r, "config_recargada", correoAutenticado(r), "", "")
+	escribirJSON(w, http.StatusOK, MensajeResponse{Mensaje: "Configuración recargada"})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// recuperacionMiddleware atrapa los panics de los handlers, registra el
+// stack trace junto con el request ID y responde un 500 en el sobre de la
+// API en lugar de cortar la conexión. http.ErrAbortHandler se relanza
+// porque es la forma intencional de abortar una respuesta. Los panics y
+// las respuestas 5xx se reportan a Sentry si está configurado.
+func recuperacionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			slog.ErrorContext(r.Context(), "Panic atendiendo la petición", "panic", rec, "stack", string(debug.Stack()))
+			reportarPanic(r, rec)
+
+			escribirErrorSobre(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Error interno del servidor", Codigo: "ERROR_INTERNO"})
+		}()
+		rw := &respuestaRegistrada{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		if rw.status >= http.StatusInternalServerError {
+			reportarErrorServidor(r, rw.status)
+		}
+	})
+}
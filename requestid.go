@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// headerRequestID es el header con el que se recibe y devuelve el
+// identificador de cada petición.
+const headerRequestID = "X-Request-ID"
+
+// claveRequestID guarda en el contexto el identificador de la petición.
+const claveRequestID claveContexto = "request_id"
+
+// requestIDMiddleware asigna a cada petición un identificador: respeta el
+// X-Request-ID recibido si es válido o genera uno nuevo. Lo devuelve en
+// la respuesta y lo deja en el contexto para incluirlo en los logs.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(headerRequestID)
+		if !requestIDValido(id) {
+			id = nuevoID()
+		}
+		w.Header().Set(headerRequestID, id)
+		ctx := context.WithValue(r.Context(), claveRequestID, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDValido acepta identificadores de hasta 128 caracteres
+// alfanuméricos o de puntuación segura, para no propagar valores
+// arbitrarios a los logs.
+func requestIDValido(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID devuelve el identificador de la petición, o "" si no pasó
+// por requestIDMiddleware.
+func requestID(r *http.Request) string {
+	return requestIDDeContexto(r.Context())
+}
+
+// requestIDDeContexto devuelve el identificador de la petición guardado
+// en el contexto, o "".
+func requestIDDeContexto(ctx context.Context) string {
+	id, _ := ctx.Value(claveRequestID).(string)
+	return id
+}
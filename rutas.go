@@ -0,0 +1,244 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// prefijoAPI es el prefijo de la versión vigente de la API.
+const prefijoAPI = "/api/v1"
+
+// fechaObsolescenciaRutas es la fecha desde la que las rutas sin prefijo
+// de versión se consideran obsoletas; se anuncia en el header Deprecation.
+var fechaObsolescenciaRutas = time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)
+
+// nuevoRouter registra todas las rutas del servicio. Los patrones
+// incluyen el método HTTP, por lo que una petición con un método no
+// soportado recibe 405 con el header Allow correspondiente. Los endpoints
+// de la API viven bajo prefijoAPI y, temporalmente, también en la raíz
+// como alias obsoletos; health checks, métricas, pprof, GraphQL,
+// WebSocket, documentación, login federado, SCIM y los avisos de los
+// proveedores de correo quedan fuera del versionado. Las rutas de login
+// federado, de SCIM y de los avisos sólo se registran cuando hay un
+// proveedor OIDC o SAML, un SCIM_TOKEN o la configuración del receptor.
+// Los 404 y 405 se responden en JSON (ver routerJSON).
+func nuevoRouter() http.Handler {
+	mux := http.NewServeMux()
+
+	lim, err := nuevoLimitador(cargarConfigLimites())
+	if err != nil {
+		fatal("Error configurando el límite de peticiones", err)
+	}
+	limitadorSMS = lim
+	configIdempotencia, err := cargarConfigIdempotencia()
+	if err != nil {
+		fatal("Configuración de idempotencia inválida", err)
+	}
+	idem, err := nuevaIdempotencia(configIdempotencia)
+	if err != nil {
+		fatal("Error configurando la idempotencia", err)
+	}
+
+	mux.HandleFunc("GET /healthz", healthzHandler)
+	mux.HandleFunc("GET /readyz", readyzHandler(slices.Concat(lim.chequeos(), funcionalidades.chequeos(), tareas.chequeos())))
+
+	mux.Handle("GET /metrics", metricasHandler)
+
+	if cargarConfigPprof().Ruta {
+		registrarPprof(mux)
+		slog.Info("Perfilado pprof habilitado", "ruta", "/debug/pprof/")
+	}
+
+	registrarRutasAPI(rutasAPI{mux}, lim, idem)
+
+	esquema, err := nuevoEsquemaGraphQL(lim)
+	if err != nil {
+		fatal("Error definiendo el esquema GraphQL", err)
+	}
+	mux.HandleFunc("POST /graphql", graphqlHandler(esquema))
+
+	mux.HandleFunc("GET /ws", eventosSesionHandler(cargarConfigCORS().Origenes))
+
+	if config.Docs {
+		registrarDocs(mux)
+	}
+
+	if cfg, ok := cargarConfigOIDC(); ok {
+		oidc := nuevoClienteOIDC(cfg)
+		mux.HandleFunc("GET /oidc/login", oidc.loginHandler)
+		mux.HandleFunc("GET /oidc/callback", oidc.callbackHandler)
+		slog.Info("Login federado OIDC habilitado", "issuer", cfg.Issuer)
+	}
+
+	if cfg, ok := cargarConfigSAML(); ok {
+		sp, err := nuevoProveedorSAML(cfg)
+		if err != nil {
+			fatal("Error configurando SAML", err)
+		}
+		mux.HandleFunc("GET /saml/metadata", sp.metadataHandler)
+		mux.HandleFunc("GET /saml/login", sp.loginHandler)
+		mux.HandleFunc("POST /saml/acs", sp.acsHandler)
+		slog.Info("SSO SAML habilitado", "metadata_idp", cfg.MetadataIdP)
+	}
+
+	if token, ok := cargarConfigSCIM(); ok {
+		registrarSCIM(mux, token)
+		slog.Info("Aprovisionamiento SCIM habilitado", "ruta", prefijoRutasSCIM)
+	}
+
+	cfgEventosCorreo, err := cargarConfigEventosCorreo()
+	if err != nil {
+		fatal("Error configurando los avisos de los proveedores de correo", err)
+	}
+	registrarEventosCorreo(mux, cfgEventosCorreo)
+
+	return routerJSON{mux}
+}
+
+// routerJSON responde las rutas que no existen (404) y los métodos no
+// soportados (405) con un error en el sobre de la API, en lugar del texto
+// plano de ServeMux. El 405 conserva el header Allow.
+type routerJSON struct {
+	*http.ServeMux
+}
+
+func (rj routerJSON) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, patron := rj.Handler(r)
+	if patron != "" {
+		rj.ServeMux.ServeHTTP(w, r)
+		return
+	}
+	// El handler de ServeMux fija el status y, en el 405, Allow; su
+	// cuerpo se descarta. Las redirecciones a una ruta sin registrar
+	// también llegan sin patrón y se envían sin cuerpo.
+	sr := &sinRespuesta{ResponseWriter: w}
+	h.ServeHTTP(sr, r)
+	switch sr.status {
+	case http.StatusMethodNotAllowed:
+		escribirErrorSobre(w, r, sr.status, ErrorResponse{Error: "Método no permitido", Codigo: "METODO_NO_PERMITIDO"})
+	case http.StatusNotFound:
+		escribirErrorSobre(w, r, sr.status, ErrorResponse{Error: "Ruta no encontrada", Codigo: "RUTA_NO_ENCONTRADA"})
+	default:
+		w.WriteHeader(cmp.Or(sr.status, http.StatusOK))
+	}
+}
+
+// sinRespuesta guarda el status de la respuesta sin enviarla; los
+// headers sí llegan a la respuesta original.
+type sinRespuesta struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *sinRespuesta) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+}
+
+func (sr *sinRespuesta) Write(b []byte) (int, error) {
+	sr.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
+
+// rutasAPI registra cada endpoint de la API en el router bajo prefijoAPI
+// y, como alias obsoleto, en la raíz. Registrarlos directamente (y no en
+// un sub-router) deja en r.Pattern la ruta concreta para las métricas.
+type rutasAPI struct {
+	mux *http.ServeMux
+}
+
+// HandleFunc recibe un patrón "MÉTODO /ruta" sin prefijo de versión. Los
+// endpoints que responden JSON lo hacen dentro de un Sobre (ver conSobre)
+// y admiten además MessagePack y Protobuf (ver negociarContenido).
+func (a rutasAPI) HandleFunc(patron string, handler http.HandlerFunc) {
+	op, ok := documentacionAPI[patron]
+	if !ok {
+		slog.Warn("Endpoint sin documentar en la especificación OpenAPI", "ruta", patron)
+	}
+	if op.tipoContenido == "" {
+		handler = negociarContenido(patron, conSobre(handler))
+	}
+	metodo, ruta, _ := strings.Cut(patron, " ")
+	a.mux.HandleFunc(metodo+" "+prefijoAPI+ruta, handler)
+	a.mux.Handle(patron, rutaObsoleta(handler))
+}
+
+// registrarRutasAPI registra los endpoints de la API. Los endpoints
+// públicos que se prestan a abuso (login, código de login por SMS,
+// segundo factor del login federado, registro y reenvío de verificación)
+// tienen límite de peticiones; el registro admite además
+// Idempotency-Key, para reintentarlo sin 409.
+func registrarRutasAPI(api rutasAPI, lim *limitador, idem *idempotencia) {
+
+	api.HandleFunc("POST /registro", lim.limitar(porIP("registro"))(idem.idempotente("registro", registroHandler)))
+	api.HandleFunc("POST /login", lim.limitar(
+		porIP("login"),
+		porCuenta("login_cuenta"),
+	)(loginHandler))
+	api.HandleFunc("POST /login/codigo-sms", lim.limitar(
+		porIP("login"),
+		porCuenta("login_cuenta"),
+	)(enviarCodigoLoginHandler))
+	api.HandleFunc("POST /login/federado/codigo", lim.limitar(porIP("login"))(completarLoginFederadoHandler))
+	api.HandleFunc("GET /verificar-correo", verificarCorreoHandler)
+	api.HandleFunc("POST /verificar-correo/reenviar", lim.limitar(porIP("reenvio"))(reenviarVerificacionHandler))
+	api.HandleFunc("POST /verificar-telefono", autenticado(verificarTelefonoHandler))
+	api.HandleFunc("POST /verificar-telefono/enviar", autenticado(enviarCodigoTelefonoHandler))
+	api.HandleFunc("POST /password/cambiar", autenticadoCambioPassword(cambiarPasswordHandler))
+	api.HandleFunc("POST /correo/cambiar", sensible(solicitarCambioCorreoHandler))
+	api.HandleFunc("GET /correo/confirmar", confirmarCambioCorreoHandler)
+	api.HandleFunc("GET /sesiones/revocar", revocarSesionHandler)
+	api.HandleFunc("DELETE /cuenta", sensible(eliminarCuentaHandler))
+	api.HandleFunc("GET /eventos", eventosSSEHandler)
+	api.HandleFunc("GET /perfil", autenticado(obtenerPerfilHandler))
+	api.HandleFunc("PUT /perfil", autenticado(actualizarPerfilHandler))
+	api.HandleFunc("GET /perfil/exportar", autenticado(exportarDatosHandler))
+	api.HandleFunc("GET /perfil/notificaciones", autenticado(obtenerNotificacionesHandler))
+	api.HandleFunc("PUT /perfil/notificaciones", autenticado(actualizarNotificacionesHandler))
+	api.HandleFunc("GET /perfil/sesiones", autenticado(listarSesionesHandler))
+	api.HandleFunc("POST /2fa/activar", autenticadoSinDosFA(activarDosFAHandler))
+	api.HandleFunc("POST /2fa/confirmar", autenticadoSinDosFA(confirmarDosFAHandler))
+	api.HandleFunc("POST /2fa/codigos-respaldo", sensible(regenerarCodigosHandler))
+
+	api.HandleFunc("GET /admin/usuarios", administrador(listarUsuariosHandler))
+	api.HandleFunc("POST /admin/usuarios", administrador(crearUsuarioHandler))
+	api.HandleFunc("GET /admin/usuarios/buscar", administrador(buscarUsuariosHandler))
+	api.HandleFunc("GET /admin/usuarios/{id}", administrador(obtenerUsuarioHandler))
+	api.HandleFunc("PUT /admin/usuarios/{id}/estado", administrador(cambiarEstadoHandler))
+	api.HandleFunc("POST /admin/usuarios/{id}/revocar-tokens", administrador(revocarTokensHandler))
+	api.HandleFunc("POST /admin/usuarios/{id}/forzar-cambio-password", administrador(forzarCambioPasswordHandler))
+	api.HandleFunc("GET /admin/auditoria", administrador(listarAuditoriaHandler))
+	api.HandleFunc("POST /admin/config/recargar", administrador(recargarConfigHandler))
+	api.HandleFunc("GET /admin/flags", administrador(listarFlagsHandler))
+	api.HandleFunc("PUT /admin/flags/{nombre}", administrador(cambiarFlagHandler))
+	api.HandleFunc("GET /admin/tareas/fallidas", administrador(listarTareasFallidasHandler))
+	api.HandleFunc("POST /admin/tareas/fallidas/{id}/reintentar", administrador(reintentarTareaFallidaHandler))
+	api.HandleFunc("GET /admin/correos-invalidos", administrador(listarCorreosInvalidosHandler))
+	api.HandleFunc("DELETE /admin/correos-invalidos/{correo}", administrador(quitarCorreoInvalidoHandler))
+}
+
+// rutaDePatron devuelve la ruta de un patrón del router, sin el método.
+func rutaDePatron(patron string) string {
+	if _, ruta, ok := strings.Cut(patron, " "); ok {
+		return ruta
+	}
+	return patron
+}
+
+// rutaObsoleta atiende las rutas sin prefijo de versión, anunciando con
+// los headers Deprecation (RFC 9745) y Link la ruta que las reemplaza.
+func rutaObsoleta(next http.HandlerFunc) http.Handler {
+	deprecacion := fmt.Sprintf("@%d", fechaObsolescenciaRutas.Unix())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", deprecacion)
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, prefijoAPI, r.URL.Path))
+		slog.InfoContext(r.Context(), "Ruta obsoleta sin versión")
+		next(w, r)
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// tiempoChequeo es el plazo máximo de cada verificación de dependencias
+// en /readyz, para que la sonda no quede colgada.
+const tiempoChequeo = 2 * time.Second
+
+// apagando se activa al recibir la señal de apagado para que /readyz deje
+// de anunciar la instancia mientras se drenan las peticiones en curso.
+var apagando atomic.Bool
+
+// chequeoListo verifica que una dependencia externa esté disponible.
+type chequeoListo struct {
+	nombre    string
+	verificar func(ctx context.Context) error
+}
+
+// SaludResponse es la respuesta de /healthz y /readyz.
+type SaludResponse struct {
+	Estado       string            `json:"estado"`
+	Dependencias map[string]string `json:"dependencias,omitempty"`
+}
+
+// healthzHandler es la sonda de liveness: responde 200 mientras el
+// proceso pueda atender peticiones.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	escribirJSON(w, http.StatusOK, SaludResponse{Estado: "ok"})
+}
+
+// readyzHandler es la sonda de readiness: responde 200 si todas las
+// dependencias responden y 503 si alguna falla o si el servidor se está
+// apagando.
+func readyzHandler(chequeos []chequeoListo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := SaludResponse{Estado: "ok"}
+		status := http.StatusOK
+		if apagando.Load() {
+			resp.Estado = "apagando"
+			status = http.StatusServiceUnavailable
+		}
+
+		for _, c := range chequeos {
+			if resp.Dependencias == nil {
+				resp.Dependencias = map[string]string{}
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), tiempoChequeo)
+			err := c.verificar(ctx)
+			cancel()
+			if err != nil {
+				slog.WarnContext(r.Context(), "Dependencia no disponible", "dependencia", c.nombre, "error", err)
+				resp.Dependencias[c.nombre] = "no_disponible"
+				if status == http.StatusOK {
+					resp.Estado = "no_disponible"
+					status = http.StatusServiceUnavailable
+				}
+				continue
+			}
+			resp.Dependencias[c.nombre] = "ok"
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		escribirJSON(w, status, resp)
+	}
+}
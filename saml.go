@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"pruebasgo/validacion"
+)
+
+// ConfigSAML agrupa los parámetros para actuar como Service Provider
+// SAML 2.0 frente al IdP de un cliente empresarial.
+type ConfigSAML struct {
+	URLBase             string
+	EntityID            string
+	MetadataIdP         string
+	Certificado         string
+	Llave               string
+	PermitirIdPIniciado bool
+}
+
+// cargarConfigSAML lee la configuración SAML de las variables de entorno
+// SAML_URL_BASE, SAML_ENTITY_ID, SAML_IDP_METADATA_URL, SAML_CERT,
+// SAML_KEY y SAML_PERMITIR_IDP_INICIADO. Devuelve false si no está configurado.
+func cargarConfigSAML() (ConfigSAML, bool) {
+	cfg := ConfigSAML{
+		URLBase:             strings.TrimSuffix(opcion("SAML_URL_BASE"), "/"),
+		EntityID:            opcion("SAML_ENTITY_ID"),
+		MetadataIdP:         opcion("SAML_IDP_METADATA_URL"),
+		Certificado:         opcion("SAML_CERT"),
+		Llave:               opcion("SAML_KEY"),
+		PermitirIdPIniciado: opcion("SAML_PERMITIR_IDP_INICIADO") == "true",
+	}
+	if cfg.URLBase == "" || cfg.MetadataIdP == "" || cfg.Certificado == "" || cfg.Llave == "" {
+		return cfg, false
+	}
+	return cfg, true
+}
+
+// proveedorSAML expone los endpoints del Service Provider SAML.
+type proveedorSAML struct {
+	sp *saml.ServiceProvider
+}
+
+// cookieSolicitudSAML guarda el ID del AuthnRequest en curso para validar
+// el InResponseTo de la respuesta del IdP.
+const cookieSolicitudSAML = "saml_request_id"
+
+// nuevoProveedorSAML carga el par de llaves del SP y la metadata del IdP.
+func nuevoProveedorSAML(cfg ConfigSAML) (*proveedorSAML, error) {
+	par, err := tls.LoadX509KeyPair(cfg.Certificado, cfg.Llave)
+	if err != nil {
+		return nil, fmt.Errorf("cargando llaves del SP: %w", err)
+	}
+	certificado, err := x509.ParseCertificate(par.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("leyendo certificado del SP: %w", err)
+	}
+	llave, ok := par.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("la llave del SP no permite firmar")
+	}
+
+	urlMetadataIdP, err := url.Parse(cfg.MetadataIdP)
+	if err != nil {
+		return nil, fmt.Errorf("URL de metadata del IdP inválida: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	metadataIdP, err := samlsp.FetchMetadata(ctx, nuevoClienteHTTP(0), *urlMetadataIdP)
+	if err != nil {
+		return nil, fmt.Errorf("descargando metadata del IdP: %w", err)
+	}
+
+	base, err := url.Parse(cfg.URLBase)
+	if err != nil {
+		return nil, fmt.Errorf("URL base inválida: %w", err)
+	}
+	return &proveedorSAML{sp: &saml.ServiceProvider{
+		EntityID:          cfg.EntityID,
+		Key:               llave,
+		Certificate:       certificado,
+		MetadataURL:       *base.ResolveReference(&url.URL{Path: "/saml/metadata"}),
+		AcsURL:            *base.ResolveReference(&url.URL{Path: "/saml/acs"}),
+		IDPMetadata:       metadataIdP,
+		AllowIDPInitiated: cfg.PermitirIdPIniciado,
+		AuthnNameIDFormat: saml.EmailAddressNameIDFormat,
+	}}, nil
+}
+
+// metadataHandler publica la metadata del SP para registrarla en el IdP.
+func (p *proveedorSAML) metadataHandler(w http.ResponseWriter, r *http.Request) {
+	buf, err := xml.MarshalIndent(p.sp.Metadata(), "", "  ")
+	if err != nil {
+		escribirJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error generando metadata", Codigo: "ERROR_INTERNO"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(buf)
+}
+
+// loginHandler inicia el SSO redirigiendo al usuario al IdP con un AuthnRequest.
+func (p *proveedorSAML) loginHandler(w http.ResponseWriter, r *http.Request) {
+	solicitud, err := p.sp.MakeAuthenticationRequest(
+		p.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding),
+		saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creando AuthnRequest", "error", err)
+		escribirJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error iniciando sesión federada", Codigo: "ERROR_INTERNO"})
+		return
+	}
+	destino, err := solicitud.Redirect("", p.sp)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error creando AuthnRequest", "error", err)
+		escribirJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error iniciando sesión federada", Codigo: "ERROR_INTERNO"})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieSolicitudSAML,
+		Value:    solicitud.ID,
+		Path:     "/saml",
+		MaxAge:   600,
+		HttpOnly: true,
+		// El IdP responde con un POST entre sitios, por lo que Lax no basta
+		// y los navegadores exigen Secure junto con SameSite=None.
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+	http.Redirect(w, r, destino.String(), http.StatusFound)
+}
+
+// acsHandler consume la assertion enviada por el IdP e inicia la sesión
+// de la cuenta de su correo (ver loginFederado).
+func (p *proveedorSAML) acsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Cuerpo inválido", Codigo: "CUERPO_INVALIDO"})
+		return
+	}
+
+	var solicitudes []string
+	if c, err := r.Cookie(cookieSolicitudSAML); err == nil {
+		solicitudes = append(solicitudes, c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: cookieSolicitudSAML, Path: "/saml", MaxAge: -1})
+
+	assertion, err := p.sp.ParseResponse(r, solicitudes)
+	if err != nil {
+		var detalle *saml.InvalidResponseError
+		if errors.As(err, &detalle) {
+			slog.WarnContext(r.Context(), "Assertion SAML inválida", "error", detalle.PrivateErr)
+		}
+		escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Assertion SAML inválida", Codigo: "ASSERTION_SAML_INVALIDA"})
+		return
+	}
+
+	correo := correoDeAssertion(assertion)
+	if validacion.Correo(correo, reglasCorreoVigentes().OpcionesCorreo) != nil {
+		slog.WarnContext(r.Context(), "La assertion SAML no contiene un correo válido")
+		escribirJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Assertion SAML sin correo válido", Codigo: "ASSERTION_SAML_SIN_CORREO"})
+		return
+	}
+
+	loginFederado(w, r, correo, "saml")
+}
+
+// correoDeAssertion obtiene el correo del NameID o, si éste no es un
+// correo, de los atributos habituales (mail, email, emailaddress).
+func correoDeAssertion(a *saml.Assertion) string {
+	if a.Subject != nil && a.Subject.NameID != nil && validacion.Correo(a.Subject.NameID.Value, reglasCorreoVigentes().OpcionesCorreo) == nil {
+		return a.Subject.NameID.Value
+	}
+	for _, st := range a.AttributeStatements {
+		for _, attr := range st.Attributes {
+			nombre := strings.ToLower(attr.Name)
+			if nombre == "mail" || nombre == "email" || strings.HasSuffix(nombre, "/emailaddress") {
+				if len(attr.Values) > 0 {
+					return attr.Values[0].Value
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+)
+
+// parDePrueba genera una llave RSA y un certificado autofirmado.
+func parDePrueba(t *testing.T, nombre string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	clave, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plantilla := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: nombre},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, plantilla, plantilla, &clave.PublicKey, clave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificado, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clave, certificado
+}
+
+// idpSAML devuelve una función que envía al ACS del SP una respuesta del
+// IdP de prueba, iniciada por éste, con una assertion para el correo dado.
+func idpSAML(t *testing.T) func(correo string) *httptest.ResponseRecorder {
+	t.Helper()
+	claveIdP, certificadoIdP := parDePrueba(t, "idp.ejemplo.com")
+	idp := &saml.IdentityProvider{
+		Key:         claveIdP,
+		Certificate: certificadoIdP,
+		MetadataURL: url.URL{Scheme: "https", Host: "idp.ejemplo.com", Path: "/metadata"},
+		SSOURL:      url.URL{Scheme: "https", Host: "idp.ejemplo.com", Path: "/sso"},
+	}
+	claveSP, certificadoSP := parDePrueba(t, "api.ejemplo.com")
+	p := &proveedorSAML{sp: &saml.ServiceProvider{
+		Key:               claveSP,
+		Certificate:       certificadoSP,
+		MetadataURL:       url.URL{Scheme: "https", Host: "api.ejemplo.com", Path: "/saml/metadata"},
+		AcsURL:            url.URL{Scheme: "https", Host: "api.ejemplo.com", Path: "/saml/acs"},
+		IDPMetadata:       idp.Metadata(),
+		AllowIDPInitiated: true,
+	}}
+	metadataSP := p.sp.Metadata()
+
+	return func(correo string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := &saml.IdpAuthnRequest{
+			IDP:                     idp,
+			HTTPRequest:             httptest.NewRequest(http.MethodGet, "https://idp.ejemplo.com/sso", nil),
+			Now:                     saml.TimeNow(),
+			ServiceProviderMetadata: metadataSP,
+			SPSSODescriptor:         &metadataSP.SPSSODescriptors[0],
+			ACSEndpoint:             &metadataSP.SPSSODescriptors[0].AssertionConsumerServices[0],
+		}
+		sesion := &saml.Session{ID: nuevoID(), NameID: correo, UserEmail: correo}
+		if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, sesion); err != nil {
+			t.Fatal(err)
+		}
+		form, err := req.PostBinding()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodPost, form.URL, strings.NewReader(url.Values{"SAMLResponse": {form.SAMLResponse}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		p.acsHandler(w, r)
+		return w
+	}
+}
+
+func TestSAMLNoEntraAUnaCuentaConContrasena(t *testing.T) {
+	prepararHandlers(t)
+	local := usuarioFalso("local@ejemplo.com", "Secreta@123")
+	usarRepositorio(t, &repositorioFalso{usuarios: []*Usuario{local}})
+	acs := idpSAML(t)
+
+	comprobarError(t, acs("local@ejemplo.com"), http.StatusConflict,
+		ErrorResponse{Error: "El correo es de una cuenta con contraseña", Codigo: "CUENTA_LOCAL"})
+	if w := acs("federado@ejemplo.com"); w.Code != http.StatusOK {
+		t.Errorf("cuenta federada nueva: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestSAMLPideElSegundoFactor(t *testing.T) {
+	prepararHandlers(t)
+	usarRepositorio(t, &repositorioFalso{})
+	acs := idpSAML(t)
+
+	if w := acs("dosfa@ejemplo.com"); w.Code != http.StatusOK {
+		t.Fatalf("alta federada: status %d: %s", w.Code, w.Body)
+	}
+	usuario := buscarUsuario("dosfa@ejemplo.com")
+	func() {
+		defer usuario.bloquear()()
+		usuario.DosFAActivo = true
+		usuario.SecretoTOTP = codificacionSecreto.EncodeToString([]byte("secreto-de-prueba-20"))
+	}()
+
+	w := acs("dosfa@ejemplo.com")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status %d, se esperaba %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	var pendiente SegundoFactorPendienteResponse
+	decodificarRespuesta(t, w, &pendiente)
+	if _, err := validarToken(pendiente.TokenPendiente); err == nil {
+		t.Error("el token pendiente sirve como token de acceso")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ConfigSaturacion define el límite de peticiones en curso.
+type ConfigSaturacion struct {
+	// MaxEnCurso es cuántas peticiones se atienden a la vez; 0 no limita.
+	MaxEnCurso int
+	// Espera es cuánto espera una petición a que se libere un lugar
+	// antes de rechazarse.
+	Espera time.Duration
+	// RetryAfter es lo que se sugiere esperar al cliente rechazado.
+	RetryAfter time.Duration
+}
+
+// cargarConfigSaturacion lee MAX_PETICIONES_EN_CURSO (0 o vacío para no
+// limitar), SATURACION_ESPERA (por defecto 0: se rechaza en cuanto no hay
+// lugar) y SATURACION_RETRY_AFTER (por defecto 1s).
+func cargarConfigSaturacion() (ConfigSaturacion, error) {
+	cfg := ConfigSaturacion{RetryAfter: time.Second}
+	if v := strings.TrimSpace(opcion("MAX_PETICIONES_EN_CURSO")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("MAX_PETICIONES_EN_CURSO=%q: debe ser un entero no negativo", v)
+		}
+		cfg.MaxEnCurso = n
+	}
+	for _, d := range []struct {
+		nombre  string
+		destino *time.Duration
+	}{
+		{"SATURACION_ESPERA", &cfg.Espera},
+		{"SATURACION_RETRY_AFTER", &cfg.RetryAfter},
+	} {
+		if v := strings.TrimSpace(opcion(d.nombre)); v != "" {
+			duracion, err := time.ParseDuration(v)
+			if err != nil || duracion < 0 {
+				return cfg, fmt.Errorf("%s=%q: debe ser una duración no negativa", d.nombre, v)
+			}
+			*d.destino = duracion
+		}
+	}
+	return cfg, nil
+}
+
+// peticionesEnCurso cuenta las peticiones que ocupan un lugar, para la
+// métrica peticiones_en_curso.
+var peticionesEnCurso atomic.Int64
+
+// saturacionMiddleware limita las peticiones que se atienden a la vez.
+// Cuando están todos los lugares ocupados la petición espera hasta
+// cfg.Espera y, si no se libera ninguno, se rechaza con 503 y
+// Retry-After: es preferible rechazar algunas peticiones rápido que
+// degradar la latencia de todas. No ocupan lugar los health checks, las
+// métricas ni las conexiones de larga duración de /ws y /eventos.
+func saturacionMiddleware(cfg ConfigSaturacion) func(http.Handler) http.Handler {
+	if cfg.MaxEnCurso == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	lugares := make(chan struct{}, cfg.MaxEnCurso)
+	retryAfter := strconv.Itoa(int(math.Ceil(cfg.RetryAfter.Seconds())))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exentaDeSaturacion(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !ocuparLugar(r, lugares, cfg.Espera) {
+				metricaDescartadas.Inc()
+				slog.WarnContext(r.Context(), "Petición rechazada por saturación", "en_curso", peticionesEnCurso.Load())
+				w.Header().Set("Retry-After", retryAfter)
+				escribirErrorSobre(w, r, http.StatusServiceUnavailable, ErrorResponse{Error: "El servidor está saturado, intenta más tarde", Codigo: "SERVIDOR_SATURADO"})
+				return
+			}
+			peticionesEnCurso.Add(1)
+			defer func() {
+				peticionesEnCurso.Add(-1)
+				<-lugares
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ocuparLugar toma un lugar, esperando como mucho espera o hasta que el
+// cliente se desconecte.
+func ocuparLugar(r *http.Request, lugares chan struct{}, espera time.Duration) bool {
+	select {
+	case lugares <- struct{}{}:
+		return true
+	default:
+	}
+	if espera == 0 {
+		return false
+	}
+	t := time.NewTimer(espera)
+	defer t.Stop()
+	select {
+	case lugares <- struct{}{}:
+		return true
+	case <-t.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// exentaDeSaturacion indica si la petición no ocupa lugar: los health
+// checks, las métricas y /debug/pprof/ deben responder aunque el
+// servidor esté saturado, y /ws y /eventos ocuparían un lugar mientras
+// dure la conexión.
+func exentaDeSaturacion(r *http.Request) bool {
+	switch strings.TrimPrefix(r.URL.Path, prefijoAPI) {
+	case "/healthz", "/readyz", "/metrics", "/ws", "/eventos":
+		return true
+	}
+	return strings.HasPrefix(r.URL.Path, "/debug/pprof/")
+}
@@ -0,0 +1,589 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pruebasgo/validacion"
+)
+
+// Esquemas SCIM 2.0 (RFC 7643 y 7644) usados en las respuestas.
+const (
+	esquemaSCIMUsuario   = "urn:ietf:params:scim:schemas:core:2.0:User"
+	esquemaSCIMLista     = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	esquemaSCIMError     = "urn:ietf:params:scim:api:messages:2.0:Error"
+	esquemaSCIMProveedor = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+const (
+	// prefijoRutasSCIM es la ruta base de los endpoints SCIM.
+	prefijoRutasSCIM = "/scim/v2"
+	// tipoContenidoSCIM es el content-type de las respuestas SCIM.
+	tipoContenidoSCIM = "application/scim+json"
+	// limiteSCIM es el máximo de usuarios por página del listado.
+	limiteSCIM = 100
+	// actorSCIM es el actor de los eventos de auditoría hechos por SCIM.
+	actorSCIM = "scim"
+)
+
+// cargarConfigSCIM lee SCIM_TOKEN, el token bearer con que el IdP del
+// cliente se autentica en /scim/v2. Devuelve false si no está definido.
+func cargarConfigSCIM() (string, bool) {
+	token := opcion("SCIM_TOKEN")
+	return token, token != ""
+}
+
+// UsuarioSCIM es el recurso User de SCIM. userName es el correo y active
+// refleja el estado de la cuenta: activa o suspendida.
+type UsuarioSCIM struct {
+	Schemas      []string    `json:"schemas"`
+	ID           string      `json:"id,omitempty"`
+	ExternalID   string      `json:"externalId,omitempty"`
+	UserName     string      `json:"userName"`
+	Active       *bool       `json:"active,omitempty"`
+	Emails       []ValorSCIM `json:"emails,omitempty"`
+	PhoneNumbers []ValorSCIM `json:"phoneNumbers,omitempty"`
+	Meta         *MetaSCIM   `json:"meta,omitempty"`
+}
+
+// ValorSCIM es un atributo multivalor, como emails o phoneNumbers.
+type ValorSCIM struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// MetaSCIM son los metadatos de un recurso.
+type MetaSCIM struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	Location     string    `json:"location"`
+}
+
+// ListaSCIM es la respuesta de GET /scim/v2/Users.
+type ListaSCIM struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []UsuarioSCIM `json:"Resources"`
+}
+
+// ErrorSCIM es el cuerpo de los errores de SCIM; status va como texto.
+type ErrorSCIM struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// PatchSCIM es el cuerpo de PATCH /scim/v2/Users/{id}.
+type PatchSCIM struct {
+	Schemas    []string        `json:"schemas"`
+	Operations []OperacionSCIM `json:"Operations"`
+}
+
+// OperacionSCIM es una operación de PatchSCIM. Sin path, value es un
+// objeto con los atributos a reemplazar.
+type OperacionSCIM struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// cambiosSCIM son los atributos que cambia una petición PUT o PATCH; nil
+// significa sin cambio.
+type cambiosSCIM struct {
+	correo    *string
+	telefono  *string
+	idExterno *string
+	activa    *bool
+}
+
+// filtroSCIM reconoce los filtros soportados: igualdad por userName o
+// externalId, que es lo que usan los IdPs para buscar una cuenta antes de
+// crearla.
+var filtroSCIM = regexp.MustCompile(`(?i)^\s*(userName|externalId)\s+eq\s+"([^"]*)"\s*$`)
+
+// registrarSCIM registra los endpoints SCIM 2.0 de Users, protegidos con
+// el token de SCIM_TOKEN.
+func registrarSCIM(mux *http.ServeMux, token string) {
+	scim := func(h http.HandlerFunc) http.HandlerFunc { return autenticadoSCIM(token, h) }
+	mux.HandleFunc("GET "+prefijoRutasSCIM+"/ServiceProviderConfig", scim(proveedorSCIMHandler))
+	mux.HandleFunc("GET "+prefijoRutasSCIM+"/Users", scim(listarUsuariosSCIMHandler))
+	mux.HandleFunc("POST "+prefijoRutasSCIM+"/Users", scim(crearUsuarioSCIMHandler))
+	mux.HandleFunc("GET "+prefijoRutasSCIM+"/Users/{id}", scim(obtenerUsuarioSCIMHandler))
+	mux.HandleFunc("PUT "+prefijoRutasSCIM+"/Users/{id}", scim(reemplazarUsuarioSCIMHandler))
+	mux.HandleFunc("PATCH "+prefijoRutasSCIM+"/Users/{id}", scim(modificarUsuarioSCIMHandler))
+	mux.HandleFunc("DELETE "+prefijoRutasSCIM+"/Users/{id}", scim(eliminarUsuarioSCIMHandler))
+}
+
+// autenticadoSCIM exige el header "Authorization: Bearer <SCIM_TOKEN>".
+func autenticadoSCIM(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recibido, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(recibido), []byte(token)) != 1 {
+			slog.WarnContext(r.Context(), "Petición SCIM con token inválido")
+			responderErrorSCIM(w, http.StatusUnauthorized, "", "Token de SCIM inválido")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// responderSCIM escribe el recurso con el content-type de SCIM.
+func responderSCIM(w http.ResponseWriter, status int, recurso any) {
+	escribirJSONComo(w, status, tipoContenidoSCIM, false, recurso)
+}
+
+// responderErrorSCIM escribe un error con el formato de SCIM.
+func responderErrorSCIM(w http.ResponseWriter, status int, tipo, detalle string) {
+	responderSCIM(w, status, ErrorSCIM{
+		Schemas:  []string{esquemaSCIMError},
+		Status:   strconv.Itoa(status),
+		ScimType: tipo,
+		Detail:   detalle,
+	})
+}
+
+// decodificarSCIM decodifica el cuerpo. A diferencia de decodificarJSON
+// acepta campos desconocidos: los IdPs envían atributos (name,
+// displayName, ...) que el servicio no guarda.
+func decodificarSCIM(w http.ResponseWriter, r *http.Request, destino any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, tamanoMaximoCuerpo)).Decode(destino); err != nil {
+		responderErrorSCIM(w, http.StatusBadRequest, "invalidSyntax", describirErrorJSON(err).mensaje)
+		return false
+	}
+	return true
+}
+
+// usuarioSCIM busca al usuario {id}, respondiendo 404 si no existe, fue
+// eliminado o no lo aprovisionó SCIM: el IdP sólo gestiona sus cuentas,
+// no las que se registraron por su cuenta. Lo devuelve con su lock
+// tomado, junto con la función que lo libera.
+func usuarioSCIM(w http.ResponseWriter, r *http.Request) (*Usuario, func()) {
+	usuario := buscarUsuarioPorID(r.PathValue("id"))
+	if usuario == nil {
+		responderErrorSCIM(w, http.StatusNotFound, "", "Usuario no encontrado")
+		return nil, func() {}
+	}
+	desbloquear := usuario.bloquear()
+	if usuario.Estado == estadoEliminada || usuario.Origen != origenSCIM {
+		desbloquear()
+		responderErrorSCIM(w, http.StatusNotFound, "", "Usuario no encontrado")
+		return nil, func() {}
+	}
+	return usuario, desbloquear
+}
+
+// nuevoUsuarioSCIM arma el recurso User de un usuario.
+func nuevoUsuarioSCIM(u *Usuario) UsuarioSCIM {
+	activa := u.Estado == estadoActiva
+	recurso := UsuarioSCIM{
+		Schemas:    []string{esquemaSCIMUsuario},
+		ID:         u.ID,
+		ExternalID: u.IDExterno,
+		UserName:   u.Correo,
+		Active:     &activa,
+		Emails:     []ValorSCIM{{Value: u.Correo, Type: "work", Primary: true}},
+		Meta: &MetaSCIM{
+			ResourceType: "User",
+			Created:      u.FechaRegistro,
+			Location:     config.URLPublica + prefijoRutasSCIM + "/Users/" + u.ID,
+		},
+	}
+	if u.Telefono != "" {
+		recurso.PhoneNumbers = []ValorSCIM{{Value: u.Telefono, Type: "work", Primary: true}}
+	}
+	return recurso
+}
+
+// cambiosDeRecurso lee los atributos de un recurso User recibido. El
+// correo es userName o, si falta, el email primario.
+func cambiosDeRecurso(recurso UsuarioSCIM) cambiosSCIM {
+	cambios := cambiosSCIM{idExterno: &recurso.ExternalID, activa: recurso.Active}
+	correo := recurso.UserName
+	if correo == "" {
+		correo = valorPrimario(recurso.Emails)
+	}
+	cambios.correo = &correo
+	telefono := valorPrimario(recurso.PhoneNumbers)
+	cambios.telefono = &telefono
+	return cambios
+}
+
+// valorPrimario devuelve el valor marcado como primario o, si no hay, el
+// primero.
+func valorPrimario(valores []ValorSCIM) string {
+	for _, v := range valores {
+		if v.Primary {
+			return v.Value
+		}
+	}
+	if len(valores) > 0 {
+		return valores[0].Value
+	}
+	return ""
+}
+
+// validarCambiosSCIM normaliza y valida el correo y el teléfono; que no
+// los tenga otro usuario se revisa al aplicarlos. Devuelve el status, el
+// scimType y el detalle del error, o status 0 si son válidos.
+func validarCambiosSCIM(cambios *cambiosSCIM) (int, string, string) {
+	if cambios.correo != nil {
+		correo := validacion.NormalizarCorreo(*cambios.correo)
+		if correo == "" {
+			return http.StatusBadRequest, "invalidValue", "Falta el campo userName"
+		}
+		if validacion.Correo(correo, reglasCorreoVigentes().OpcionesCorreo) != nil {
+			return http.StatusBadRequest, "invalidValue", "Correo inválido"
+		}
+		cambios.correo = &correo
+	}
+	if cambios.telefono != nil && *cambios.telefono != "" {
+		telefono, err := validacion.Telefono(*cambios.telefono, config.PaisTelefono)
+		if err != nil {
+			return http.StatusBadRequest, "invalidValue", "Teléfono inválido"
+		}
+		cambios.telefono = &telefono
+	}
+	return 0, "", ""
+}
+
+// cambiaContactoAdmin indica si los cambios reemplazan el correo o el
+// teléfono de un administrador. SCIM no puede cambiarlos: con ellos se
+// recupera el acceso a la cuenta.
+func cambiaContactoAdmin(usuario *Usuario, cambios cambiosSCIM) bool {
+	return usuario.Admin &&
+		(cambios.correo != nil && *cambios.correo != usuario.Correo ||
+			cambios.telefono != nil && *cambios.telefono != usuario.Telefono)
+}
+
+// aplicarCambiosSCIM actualiza al usuario con los cambios ya validados.
+// Desactivarlo lo suspende y revoca sus tokens; cambiar el correo también
+// los revoca. Si el correo o el teléfono nuevos los tiene otro usuario no
+// cambia nada y devuelve el detalle del error.
+func aplicarCambiosSCIM(r *http.Request, usuario *Usuario, cambios cambiosSCIM) string {
+	anterior, anteriorTelefono := usuario.Correo, usuario.Telefono
+	correo, telefono := anterior, anteriorTelefono
+	if cambios.correo != nil {
+		correo = *cambios.correo
+	}
+	if cambios.telefono != nil {
+		telefono = *cambios.telefono
+	}
+	if correo != anterior || telefono != anteriorTelefono {
+		if campos := cambiarContactoUsuario(usuario, correo, telefono); len(campos) > 0 {
+			return mensajesDuplicado[campos[0]]
+		}
+		if correo != anterior {
+			registrarEvento(usuario, "correo_cambiado")
+			auditar(r, "correo_cambiado", actorSCIM, usuario.Correo, "anterior: "+anterior)
+			revocarTokens(r, usuario, "correo_cambiado")
+		}
+		if telefono != anteriorTelefono {
+			usuario.TelefonoVerificado = false
+			registrarEvento(usuario, "telefono_cambiado")
+		}
+	}
+	if cambios.idExterno != nil {
+		usuario.IDExterno = *cambios.idExterno
+	}
+	if cambios.activa != nil {
+		switch {
+		case !*cambios.activa && usuario.Estado == estadoActiva:
+			usuario.Estado = estadoSuspendida
+			registrarEvento(usuario, "estado_"+string(estadoSuspendida))
+			auditar(r, "estado_cambiado", actorSCIM, usuario.Correo, string(estadoSuspendida))
+			revocarTokens(r, usuario, "estado_"+string(estadoSuspendida))
+			webhooks.publicar(r, eventoUsuarioBloqueado, usuario)
+		case *cambios.activa && usuario.Estado == estadoSuspendida:
+			usuario.Estado = estadoActiva
+			registrarEvento(usuario, "estado_"+string(estadoActiva))
+			auditar(r, "estado_cambiado", actorSCIM, usuario.Correo, string(estadoActiva))
+		}
+	}
+	return ""
+}
+
+// proveedorSCIMHandler describe las capacidades soportadas.
+func proveedorSCIMHandler(w http.ResponseWriter, r *http.Request) {
+	noSoportado := map[string]bool{"supported": false}
+	responderSCIM(w, http.StatusOK, map[string]any{
+		"schemas":        []string{esquemaSCIMProveedor},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": limiteSCIM},
+		"changePassword": noSoportado,
+		"sort":           noSoportado,
+		"etag":           noSoportado,
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "Token de SCIM_TOKEN en el header Authorization",
+		}},
+	})
+}
+
+// listarUsuariosSCIMHandler atiende GET /scim/v2/Users con los
+// parámetros filter (userName eq "..." o externalId eq "..."),
+// startIndex (desde 1) y count. Sólo lista las cuentas aprovisionadas
+// por SCIM.
+func listarUsuariosSCIMHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	inicio, cantidad := 1, limiteSCIM
+	if v := q.Get("startIndex"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			responderErrorSCIM(w, http.StatusBadRequest, "invalidValue", "Parámetro startIndex inválido")
+			return
+		}
+		inicio = max(n, 1)
+	}
+	if v := q.Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			responderErrorSCIM(w, http.StatusBadRequest, "invalidValue", "Parámetro count inválido")
+			return
+		}
+		cantidad = min(max(n, 0), limiteSCIM)
+	}
+	var atributo, valor string
+	if filtro := q.Get("filter"); filtro != "" {
+		partes := filtroSCIM.FindStringSubmatch(filtro)
+		if partes == nil {
+			responderErrorSCIM(w, http.StatusBadRequest, "invalidFilter", "Sólo se admiten los filtros userName eq y externalId eq")
+			return
+		}
+		atributo, valor = strings.ToLower(partes[1]), partes[2]
+	}
+
+	resp := ListaSCIM{Schemas: []string{esquemaSCIMLista}, StartIndex: inicio, Resources: []UsuarioSCIM{}}
+	for _, u := range usuariosAlmacenados() {
+		desbloquear := u.bloquear()
+		if u.Estado != estadoEliminada && u.Origen == origenSCIM &&
+			(atributo != "username" || u.Correo == validacion.NormalizarCorreo(valor)) &&
+			(atributo != "externalid" || u.IDExterno == valor) {
+			resp.TotalResults++
+			if resp.TotalResults >= inicio && len(resp.Resources) < cantidad {
+				resp.Resources = append(resp.Resources, nuevoUsuarioSCIM(u))
+			}
+		}
+		desbloquear()
+	}
+	resp.ItemsPerPage = len(resp.Resources)
+	responderSCIM(w, http.StatusOK, resp)
+}
+
+// obtenerUsuarioSCIMHandler devuelve el usuario {id}.
+func obtenerUsuarioSCIMHandler(w http.ResponseWriter, r *http.Request) {
+	usuario, desbloquear := usuarioSCIM(w, r)
+	defer desbloquear()
+	if usuario != nil {
+		responderSCIM(w, http.StatusOK, nuevoUsuarioSCIM(usuario))
+	}
+}
+
+// crearUsuarioSCIMHandler aprovisiona una cuenta. Como la del login
+// federado, no tiene contraseña: el usuario entra con el IdP que la
+// aprovisionó. El correo se da por verificado.
+func crearUsuarioSCIMHandler(w http.ResponseWriter, r *http.Request) {
+	var recurso UsuarioSCIM
+	if !decodificarSCIM(w, r, &recurso) {
+		return
+	}
+	cambios := cambiosDeRecurso(recurso)
+	if status, tipo, detalle := validarCambiosSCIM(&cambios); status != 0 {
+		slog.InfoContext(r.Context(), "Aprovisionamiento SCIM rechazado", "motivo", detalle)
+		responderErrorSCIM(w, status, tipo, detalle)
+		return
+	}
+
+	nuevo := &Usuario{
+		ID:               nuevoID(),
+		Correo:           *cambios.correo,
+		Telefono:         *cambios.telefono,
+		IDExterno:        recurso.ExternalID,
+		Origen:           origenSCIM,
+		CorreoVerificado: true,
+		Admin:            esCorreoAdmin(*cambios.correo),
+		Estado:           estadoActiva,
+		FechaRegistro:    time.Now(),
+	}
+	if recurso.Active != nil && !*recurso.Active {
+		nuevo.Estado = estadoSuspendida
+	}
+	defer nuevo.bloquear()()
+	if campos := insertarUsuario(nuevo); len(campos) > 0 {
+		slog.InfoContext(r.Context(), "Aprovisionamiento SCIM rechazado", "motivo", mensajesDuplicado[campos[0]])
+		responderErrorSCIM(w, http.StatusConflict, "uniqueness", mensajesDuplicado[campos[0]])
+		return
+	}
+	registrarEvento(nuevo, "registro_scim")
+	auditar(r, "registro", actorSCIM, nuevo.Correo, "scim")
+	metricaRegistros.Inc()
+	webhooks.publicar(r, eventoUsuarioRegistrado, nuevo)
+	eventosDominio.publicar(r, eventoUsuarioRegistrado, nuevo)
+	slog.InfoContext(r.Context(), "Usuario aprovisionado por SCIM", "correo", nuevo.Correo)
+
+	recursoNuevo := nuevoUsuarioSCIM(nuevo)
+	w.Header().Set("Location", recursoNuevo.Meta.Location)
+	responderSCIM(w, http.StatusCreated, recursoNuevo)
+}
+
+// reemplazarUsuarioSCIMHandler atiende PUT: el recurso recibido reemplaza
+// al actual; sin active, el estado no cambia.
+func reemplazarUsuarioSCIMHandler(w http.ResponseWriter, r *http.Request) {
+	usuario, desbloquear := usuarioSCIM(w, r)
+	defer desbloquear()
+	if usuario == nil {
+		return
+	}
+	var recurso UsuarioSCIM
+	if !decodificarSCIM(w, r, &recurso) {
+		return
+	}
+	cambios := cambiosDeRecurso(recurso)
+	if status, tipo, detalle := validarCambiosSCIM(&cambios); status != 0 {
+		responderErrorSCIM(w, status, tipo, detalle)
+		return
+	}
+	if cambiaContactoAdmin(usuario, cambios) {
+		responderErrorSCIM(w, http.StatusForbidden, "", "No se puede cambiar el correo ni el teléfono de un administrador")
+		return
+	}
+	if detalle := aplicarCambiosSCIM(r, usuario, cambios); detalle != "" {
+		responderErrorSCIM(w, http.StatusConflict, "uniqueness", detalle)
+		return
+	}
+	slog.InfoContext(r.Context(), "Usuario actualizado por SCIM", "correo", usuario.Correo)
+	responderSCIM(w, http.StatusOK, nuevoUsuarioSCIM(usuario))
+}
+
+// modificarUsuarioSCIMHandler atiende PATCH con operaciones add o
+// replace sobre active, userName, externalId, emails y phoneNumbers.
+func modificarUsuarioSCIMHandler(w http.ResponseWriter, r *http.Request) {
+	usuario, desbloquear := usuarioSCIM(w, r)
+	defer desbloquear()
+	if usuario == nil {
+		return
+	}
+	var patch PatchSCIM
+	if !decodificarSCIM(w, r, &patch) {
+		return
+	}
+	var cambios cambiosSCIM
+	for _, op := range patch.Operations {
+		if o := strings.ToLower(op.Op); o != "add" && o != "replace" {
+			responderErrorSCIM(w, http.StatusBadRequest, "invalidValue", fmt.Sprintf("Operación %s no soportada", op.Op))
+			return
+		}
+		if detalle := cambiosDeOperacion(&cambios, op); detalle != "" {
+			responderErrorSCIM(w, http.StatusBadRequest, "invalidValue", detalle)
+			return
+		}
+	}
+	if status, tipo, detalle := validarCambiosSCIM(&cambios); status != 0 {
+		responderErrorSCIM(w, status, tipo, detalle)
+		return
+	}
+	if cambiaContactoAdmin(usuario, cambios) {
+		responderErrorSCIM(w, http.StatusForbidden, "", "No se puede cambiar el correo ni el teléfono de un administrador")
+		return
+	}
+	if detalle := aplicarCambiosSCIM(r, usuario, cambios); detalle != "" {
+		responderErrorSCIM(w, http.StatusConflict, "uniqueness", detalle)
+		return
+	}
+	slog.InfoContext(r.Context(), "Usuario modificado por SCIM", "correo", usuario.Correo)
+	responderSCIM(w, http.StatusOK, nuevoUsuarioSCIM(usuario))
+}
+
+// cambiosDeOperacion agrega a cambios el efecto de una operación de
+// PATCH y devuelve el detalle del error, o "" si es válida. Sin path,
+// value es un objeto con los atributos; active se acepta como booleano o
+// como texto "true"/"false", como lo envía Azure AD.
+func cambiosDeOperacion(cambios *cambiosSCIM, op OperacionSCIM) string {
+	if op.Path == "" {
+		var atributos map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &atributos); err != nil {
+			return "El valor de una operación sin path debe ser un objeto"
+		}
+		for path, valor := range atributos {
+			if detalle := cambiosDeOperacion(cambios, OperacionSCIM{Op: op.Op, Path: path, Value: valor}); detalle != "" {
+				return detalle
+			}
+		}
+		return ""
+	}
+
+	switch path := strings.ToLower(op.Path); {
+	case path == "active":
+		var activa bool
+		if err := json.Unmarshal(op.Value, &activa); err != nil {
+			var texto string
+			if json.Unmarshal(op.Value, &texto) != nil {
+				return "El atributo active debe ser booleano"
+			}
+			if activa, err = strconv.ParseBool(texto); err != nil {
+				return "El atributo active debe ser booleano"
+			}
+		}
+		cambios.activa = &activa
+	case path == "username" || path == "externalid" || strings.HasPrefix(path, "emails") || strings.HasPrefix(path, "phonenumbers"):
+		valor, err := valorTextoSCIM(op.Value)
+		if err != nil {
+			return fmt.Sprintf("Valor inválido para %s", op.Path)
+		}
+		switch {
+		case path == "externalid":
+			cambios.idExterno = &valor
+		case strings.HasPrefix(path, "phonenumbers"):
+			cambios.telefono = &valor
+		default:
+			cambios.correo = &valor
+		}
+	default:
+		// Los atributos que el servicio no guarda (name, displayName, ...)
+		// se ignoran.
+	}
+	return ""
+}
+
+// valorTextoSCIM lee el valor de una operación sobre un atributo de
+// texto: un texto o una lista de ValorSCIM, de la que toma el primario.
+func valorTextoSCIM(valor json.RawMessage) (string, error) {
+	var texto string
+	if json.Unmarshal(valor, &texto) == nil {
+		return texto, nil
+	}
+	var valores []ValorSCIM
+	if err := json.Unmarshal(valor, &valores); err != nil {
+		return "", err
+	}
+	return valorPrimario(valores), nil
+}
+
+// eliminarUsuarioSCIMHandler atiende DELETE dando de baja la cuenta como
+// el estado eliminada: el registro se conserva pero no puede usarse y
+// deja de aparecer en SCIM.
+func eliminarUsuarioSCIMHandler(w http.ResponseWriter, r *http.Request) {
+	usuario, desbloquear := usuarioSCIM(w, r)
+	defer desbloquear()
+	if usuario == nil {
+		return
+	}
+	usuario.Estado = estadoEliminada
+	registrarEvento(usuario, "estado_"+string(estadoEliminada))
+	auditar(r, "estado_cambiado", actorSCIM, usuario.Correo, string(estadoEliminada))
+	revocarTokens(r, usuario, "estado_"+string(estadoEliminada))
+	slog.InfoContext(r.Context(), "Usuario dado de baja por SCIM", "correo", usuario.Correo)
+	w.WriteHeader(http.StatusNoContent)
+}
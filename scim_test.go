@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// servidorSCIM devuelve los endpoints SCIM con el token "token-scim".
+func servidorSCIM(t *testing.T) func(metodo, ruta, cuerpo string) *httptest.ResponseRecorder {
+	t.Helper()
+	prepararHandlers(t)
+	mux := http.NewServeMux()
+	registrarSCIM(mux, "token-scim")
+	return func(metodo, ruta, cuerpo string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(metodo, prefijoRutasSCIM+ruta, strings.NewReader(cuerpo))
+		r.Header.Set("Authorization", "Bearer token-scim")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+}
+
+func TestSCIMSoloGestionaSusCuentas(t *testing.T) {
+	pedir := servidorSCIM(t)
+	local := usuarioFalso("local@ejemplo.com", "Secreta@123")
+	usarRepositorio(t, &repositorioFalso{usuarios: []*Usuario{local}})
+
+	w := pedir(http.MethodPost, "/Users", `{"userName":"scim@ejemplo.com","externalId":"00u1"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("alta por SCIM: status %d: %s", w.Code, w.Body)
+	}
+	var aprovisionado UsuarioSCIM
+	json.Unmarshal(w.Body.Bytes(), &aprovisionado)
+
+	patch := `{"Operations":[{"op":"replace","path":"userName","value":"otro@ejemplo.com"}]}`
+	casos := []struct {
+		metodo, ruta, cuerpo string
+	}{
+		{http.MethodGet, "/Users/" + local.ID, ""},
+		{http.MethodPut, "/Users/" + local.ID, `{"userName":"otro@ejemplo.com"}`},
+		{http.MethodPatch, "/Users/" + local.ID, patch},
+		{http.MethodDelete, "/Users/" + local.ID, ""},
+	}
+	for _, c := range casos {
+		if w := pedir(c.metodo, c.ruta, c.cuerpo); w.Code != http.StatusNotFound {
+			t.Errorf("%s de una cuenta registrada: status %d, se esperaba %d", c.metodo, w.Code, http.StatusNotFound)
+		}
+	}
+	if local.Correo != "local@ejemplo.com" || local.Estado != estadoActiva {
+		t.Errorf("la cuenta registrada cambió: correo %s, estado %s", local.Correo, local.Estado)
+	}
+
+	var lista ListaSCIM
+	json.Unmarshal(pedir(http.MethodGet, "/Users", "").Body.Bytes(), &lista)
+	if lista.TotalResults != 1 || lista.Resources[0].ID != aprovisionado.ID {
+		t.Errorf("listado %+v, se esperaba sólo la cuenta aprovisionada", lista)
+	}
+	if w := pedir(http.MethodGet, `/Users?filter=userName+eq+"local@ejemplo.com"`, ""); !strings.Contains(w.Body.String(), `"totalResults":0`) {
+		t.Errorf("filtro por el correo de la cuenta registrada: %s", w.Body)
+	}
+	if w := pedir(http.MethodPatch, "/Users/"+aprovisionado.ID, patch); w.Code != http.StatusOK {
+		t.Errorf("PATCH de la cuenta aprovisionada: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestSCIMNoCambiaElContactoDeUnAdministrador(t *testing.T) {
+	pedir := servidorSCIM(t)
+	usarRepositorio(t, &repositorioFalso{})
+
+	w := pedir(http.MethodPost, "/Users", `{"userName":"admin@ejemplo.com"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("alta por SCIM: status %d: %s", w.Code, w.Body)
+	}
+	var aprovisionado UsuarioSCIM
+	json.Unmarshal(w.Body.Bytes(), &aprovisionado)
+	admin := buscarUsuarioPorID(aprovisionado.ID)
+	desbloquear := admin.bloquear()
+	admin.Admin = true
+	desbloquear()
+
+	casos := []struct {
+		nombre, metodo, cuerpo string
+	}{
+		{"PATCH del correo", http.MethodPatch, `{"Operations":[{"op":"replace","path":"userName","value":"atacante@ejemplo.com"}]}`},
+		{"PATCH del teléfono", http.MethodPatch, `{"Operations":[{"op":"add","path":"phoneNumbers","value":"5511223344"}]}`},
+		{"PUT del correo", http.MethodPut, `{"userName":"atacante@ejemplo.com"}`},
+	}
+	for _, c := range casos {
+		if w := pedir(c.metodo, "/Users/"+admin.ID, c.cuerpo); w.Code != http.StatusForbidden {
+			t.Errorf("%s: status %d, se esperaba %d", c.nombre, w.Code, http.StatusForbidden)
+		}
+	}
+	if admin.Correo != "admin@ejemplo.com" || admin.Telefono != "" {
+		t.Errorf("el contacto del administrador cambió: %s, %s", admin.Correo, admin.Telefono)
+	}
+	// Los demás atributos sí se pueden cambiar.
+	if w := pedir(http.MethodPatch, "/Users/"+admin.ID, `{"Operations":[{"op":"replace","path":"active","value":false}]}`); w.Code != http.StatusOK {
+		t.Errorf("PATCH de active: status %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claves esperadas dentro del secreto.
+const (
+	secretoJWT   = "jwt_secret"
+	secretoDBURL = "db_url"
+)
+
+// longitudMinimaSecretoJWT es el largo mínimo de la clave JWT: HS256
+// necesita al menos 256 bits para no debilitar la firma.
+const longitudMinimaSecretoJWT = 32
+
+// secretosConocidos son valores de ejemplo o por defecto que nunca deben
+// usarse como clave JWT, empezando por la que el servicio traía fija.
+var secretosConocidos = []string{
+	"mi_clave_secreta",
+	"secret",
+	"secreto",
+	"changeme",
+	"cambiame",
+	"jwt_secret",
+	"your-256-bit-secret",
+}
+
+// validarSecretoJWT indica por qué clave no sirve para firmar tokens, o
+// nil si es aceptable.
+func validarSecretoJWT(clave []byte) error {
+	for _, conocido := range secretosConocidos {
+		if strings.EqualFold(string(clave), conocido) {
+			return errors.New("es un valor por defecto o de ejemplo")
+		}
+	}
+	if len(clave) < longitudMinimaSecretoJWT {
+		return fmt.Errorf("debe tener al menos %d bytes", longitudMinimaSecretoJWT)
+	}
+	return nil
+}
+
+// ConfigSecretos define de qué gestor de secretos se cargan la clave JWT
+// y las credenciales de la base de datos.
+type ConfigSecretos struct {
+	Proveedor  string
+	Ruta       string
+	VaultAddr  string
+	VaultToken string
+	Renovacion time.Duration
+}
+
+// cargarConfigSecretos lee SECRETOS_PROVEEDOR (vault o aws; vacío lo
+// desactiva), SECRETOS_RUTA (ruta KV v2 en Vault, p. ej.
+// "secret/data/stratplus", o nombre/ARN del secreto en AWS),
+// SECRETOS_RENOVACION (cada cuánto se vuelve a leer, por defecto 5m) y,
+// para Vault, VAULT_ADDR y VAULT_TOKEN. AWS toma región y credenciales
+// de su cadena estándar (AWS_REGION, perfil, rol de la instancia, ...).
+func cargarConfigSecretos() (ConfigSecretos, error) {
+	cfg := ConfigSecretos{
+		Proveedor:  strings.ToLower(opcion("SECRETOS_PROVEEDOR")),
+		Ruta:       strings.Trim(opcion("SECRETOS_RUTA"), "/"),
+		VaultAddr:  strings.TrimSuffix(opcion("VAULT_ADDR"), "/"),
+		VaultToken: opcion("VAULT_TOKEN"),
+		Renovacion: 5 * time.Minute,
+	}
+	if v := opcion("SECRETOS_RENOVACION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("SECRETOS_RENOVACION=%q: debe ser una duración positiva", v)
+		}
+		cfg.Renovacion = d
+	}
+	switch cfg.Proveedor {
+	case "":
+	case "vault":
+		if cfg.VaultAddr == "" || cfg.VaultToken == "" || cfg.Ruta == "" {
+			return cfg, errors.New("el proveedor vault requiere VAULT_ADDR, VAULT_TOKEN y SECRETOS_RUTA")
+		}
+	case "aws":
+		if cfg.Ruta == "" {
+			return cfg, errors.New("el proveedor aws requiere SECRETOS_RUTA")
+		}
+	default:
+		return cfg, fmt.Errorf("SECRETOS_PROVEEDOR=%q: debe ser vault o aws", cfg.Proveedor)
+	}
+	return cfg, nil
+}
+
+// proveedorSecretos devuelve los valores de un secreto como pares clave
+// valor.
+type proveedorSecretos interface {
+	obtener(ctx context.Context) (map[string]string, error)
+}
+
+// nuevoProveedorSecretos crea el proveedor configurado, o nil si no hay
+// ninguno.
+func nuevoProveedorSecretos(ctx context.Context, cfg ConfigSecretos) (proveedorSecretos, error) {
+	switch cfg.Proveedor {
+	case "vault":
+		return secretosVault{cfg: cfg, cliente: nuevoClienteHTTP(10 * time.Second)}, nil
+	case "aws":
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return secretosAWS{id: cfg.Ruta, cliente: secretsmanager.NewFromConfig(awsCfg)}, nil
+	}
+	return nil, nil
+}
+
+// secretosVault lee un secreto del motor KV versión 2 de HashiCorp Vault.
+type secretosVault struct {
+	cfg     ConfigSecretos
+	cliente *http.Client
+}
+
+func (v secretosVault) obtener(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.VaultAddr+"/v1/"+v.cfg.Ruta, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.cfg.VaultToken)
+	resp, err := v.cliente.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault respondió %d", resp.StatusCode)
+	}
+
+	var cuerpo struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cuerpo); err != nil {
+		return nil, err
+	}
+	return cuerpo.Data.Data, nil
+}
+
+// secretosAWS lee un secreto de AWS Secrets Manager cuyo valor es un
+// objeto JSON.
+type secretosAWS struct {
+	id      string
+	cliente *secretsmanager.Client
+}
+
+func (a secretosAWS) obtener(ctx context.Context) (map[string]string, error) {
+	salida, err := a.cliente.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &a.id})
+	if err != nil {
+		return nil, err
+	}
+	if salida.SecretString == nil {
+		return nil, errors.New("el secreto no tiene un valor de texto")
+	}
+	valores := map[string]string{}
+	if err := json.Unmarshal([]byte(*salida.SecretString), &valores); err != nil {
+		return nil, fmt.Errorf("el secreto debe ser un objeto JSON: %w", err)
+	}
+	return valores, nil
+}
+
+// configurarClavesJWT establece la clave con la que se firman los
+// tokens: la del gestor de secretos si hay uno configurado, que además
+// se renueva periódicamente; si no, JWT_SECRET; y si tampoco está
+// definido, una clave efímera. Un JWT_SECRET corto o conocido impide
+// arrancar con el perfil prod; con cualquier otro perfil se reemplaza por
+// una clave efímera.
+func configurarClavesJWT(ctx context.Context) error {
+	cfg, err := cargarConfigSecretos()
+	if err != nil {
+		return err
+	}
+	proveedor, err := nuevoProveedorSecretos(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if proveedor != nil {
+		valores, err := proveedor.obtener(ctx)
+		if err != nil {
+			return err
+		}
+		if err := aplicarSecretos(valores, true); err != nil {
+			return err
+		}
+		go renovarSecretos(context.WithoutCancel(ctx), proveedor, cfg.Renovacion)
+		slog.Info("Secretos cargados", "proveedor", cfg.Proveedor, "renovacion", cfg.Renovacion.String())
+		return nil
+	}
+	if config.JWTSecret != nil {
+		err := validarSecretoJWT(config.JWTSecret)
+		if err == nil {
+			claves.rotar(config.JWTSecret)
+			return nil
+		}
+		if config.Perfil == perfilProd {
+			return fmt.Errorf("JWT_SECRET inseguro: %w", err)
+		}
+		claves.rotar(claveEfimera())
+		slog.Warn("JWT_SECRET inseguro; se generó una clave efímera y los tokens dejarán de ser válidos al reiniciar", "motivo", err.Error())
+		return nil
+	}
+	if config.Perfil == perfilProd {
+		return errors.New("el perfil prod requiere JWT_SECRET o un gestor de secretos")
+	}
+	claves.rotar(claveEfimera())
+	slog.Warn("JWT_SECRET no está definido; se generó una clave efímera y los tokens dejarán de ser válidos al reiniciar")
+	return nil
+}
+
+// aplicarSecretos toma del secreto la clave JWT y la URL de la base de
+// datos. La clave se rota en claves; un cambio en la URL de la base de
+// datos sólo se aplica al arrancar. Una clave insegura se rechaza con
+// cualquier perfil: quien configura un gestor de secretos espera que se
+// use la clave guardada en él, no una efímera.
+func aplicarSecretos(valores map[string]string, inicial bool) error {
+	clave := valores[secretoJWT]
+	if clave == "" {
+		return fmt.Errorf("el secreto no contiene %s", secretoJWT)
+	}
+	if err := validarSecretoJWT([]byte(clave)); err != nil {
+		return fmt.Errorf("%s inseguro: %w", secretoJWT, err)
+	}
+	if claves.rotar([]byte(clave)) && !inicial {
+		slog.Info("Clave JWT rotada desde el gestor de secretos")
+	}
+	if url := valores[secretoDBURL]; url != "" {
+		if inicial {
+			config.DBURL = url
+		} else if url != config.DBURL {
+			slog.Warn("Las credenciales de la base de datos cambiaron; se aplicarán al reiniciar")
+		}
+	}
+	return nil
+}
+
+// renovarSecretos vuelve a leer el secreto cada intervalo hasta que ctx
+// se cancele. Un error de lectura conserva los valores anteriores.
+func renovarSecretos(ctx context.Context, proveedor proveedorSecretos, intervalo time.Duration) {
+	ticker := time.NewTicker(intervalo)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			valores, err := proveedor.obtener(ctx)
+			if err == nil {
+				err = aplicarSecretos(valores, false)
+			}
+			if err != nil {
+				slog.Error("Error renovando los secretos", "error", err)
+			}
+		}
+	}
+}
+
+// clavesJWT guarda la clave con la que se firman los tokens y la
+// anterior, que se sigue aceptando tras una rotación para no invalidar
+// las sesiones abiertas.
+type clavesJWT struct {
+	mu       sync.RWMutex
+	actual   []byte
+	anterior []byte
+}
+
+// claves son las claves JWT del servicio.
+var claves clavesJWT
+
+// firma devuelve la clave vigente para firmar tokens.
+func (c *clavesJWT) firma() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.actual
+}
+
+// verificacion devuelve las claves aceptadas al validar un token.
+func (c *clavesJWT) verificacion() jwt.VerificationKeySet {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	set := jwt.VerificationKeySet{Keys: []jwt.VerificationKey{c.actual}}
+	if c.anterior != nil {
+		set.Keys = append(set.Keys, c.anterior)
+	}
+	return set
+}
+
+// rotar reemplaza la clave vigente si es distinta e indica si cambió.
+func (c *clavesJWT) rotar(nueva []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if string(nueva) == string(c.actual) {
+		return false
+	}
+	c.anterior, c.actual = c.actual, nueva
+	return true
+}
+
+// claveEfimera genera una clave JWT aleatoria, válida sólo mientras viva
+// el proceso.
+func claveEfimera() []byte {
+	clave := make([]byte, 32)
+	rand.Read(clave)
+	return clave
+}
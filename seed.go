@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"pruebasgo/validacion"
+)
+
+// UsuarioSeed es una cuenta de prueba que se crea al arrancar, de las de
+// ejemplo (DATOS_SEED) o de las del archivo DATOS_SEED_ARCHIVO.
+type UsuarioSeed struct {
+	Correo   string `json:"correo"`
+	Telefono string `json:"telefono"`
+	Password string `json:"password"`
+	Admin    bool   `json:"admin,omitempty"`
+	// Estado es activa si se omite.
+	Estado EstadoCuenta `json:"estado,omitempty"`
+	// SinVerificar crea la cuenta con el correo y el teléfono sin
+	// verificar; por defecto se crean verificados.
+	SinVerificar bool `json:"sin_verificar,omitempty"`
+}
+
+// usuariosSeed son las cuentas de ejemplo que se crean con DATOS_SEED.
+// Las contraseñas son públicas: nunca deben cargarse en producción.
+var usuariosSeed = []UsuarioSeed{
+	{Correo: "admin@example.com", Telefono: "+525500000001", Password: "Admin1@", Admin: true},
+	{Correo: "usuario@example.com", Telefono: "+525500000002", Password: "Usuario1@"},
+}
+
+// cargarDatosSeed agrega las cuentas de ejemplo, ya verificadas, a los
+// usuarios almacenados.
+func cargarDatosSeed() {
+	for _, s := range usuariosSeed {
+		if u, _ := altaUsuarioSeed(s); u != nil {
+			slog.Info("Usuario de ejemplo creado", "correo", s.Correo, "admin", s.Admin)
+		}
+	}
+}
+
+// cargarArchivoSeed agrega las cuentas del archivo JSON indicado, una
+// lista de UsuarioSeed, y devuelve cuántas creó. Las cuentas cuyo correo
+// ya existe se omiten, para poder cargar el mismo archivo junto con
+// DATOS_SEED. Si algún usuario es inválido no se crea ninguno.
+func cargarArchivoSeed(ruta string) (int, error) {
+	datos, err := os.ReadFile(ruta)
+	if err != nil {
+		return 0, err
+	}
+	usuarios, err := leerUsuariosSeed(datos)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", ruta, err)
+	}
+	creados := 0
+	var errs []error
+	for i, s := range usuarios {
+		u, repetidos := altaUsuarioSeed(s)
+		if len(repetidos) > 0 {
+			errs = append(errs, fmt.Errorf("usuario %d (%s): %s", i+1, s.Correo, strings.ToLower(mensajesDuplicado[repetidos[0]])))
+		}
+		if u != nil {
+			creados++
+		}
+	}
+	return creados, errors.Join(errs...)
+}
+
+// leerUsuariosSeed decodifica y normaliza la lista de usuarios de prueba,
+// y devuelve juntos los problemas de todos. El correo y el teléfono se
+// validan como en el registro; la contraseña no se valida contra la
+// política vigente, para poder preparar cuentas con contraseñas
+// anteriores a ella.
+func leerUsuariosSeed(datos []byte) ([]UsuarioSeed, error) {
+	dec := json.NewDecoder(bytes.NewReader(datos))
+	dec.DisallowUnknownFields()
+	var usuarios []UsuarioSeed
+	if err := dec.Decode(&usuarios); err != nil {
+		return nil, fmt.Errorf("debe ser una lista JSON de usuarios: %w", err)
+	}
+
+	var errs []error
+	for i := range usuarios {
+		s := &usuarios[i]
+		invalido := func(motivo string) {
+			errs = append(errs, fmt.Errorf("usuario %d (%s): %s", i+1, s.Correo, motivo))
+		}
+		s.Correo = validacion.NormalizarCorreo(s.Correo)
+		if validacion.Correo(s.Correo, reglasCorreoVigentes().OpcionesCorreo) != nil {
+			invalido("correo inválido")
+		}
+		telefono, err := validacion.Telefono(s.Telefono, config.PaisTelefono)
+		if err != nil {
+			invalido("teléfono inválido")
+		}
+		s.Telefono = telefono
+		if s.Password == "" {
+			invalido("falta la contraseña")
+		}
+		switch s.Estado {
+		case "":
+			s.Estado = estadoActiva
+		case estadoActiva, estadoSuspendida, estadoEliminada:
+		default:
+			invalido(fmt.Sprintf("estado %q: debe ser %s, %s o %s", s.Estado, estadoActiva, estadoSuspendida, estadoEliminada))
+		}
+	}
+	return usuarios, errors.Join(errs...)
+}
+
+// altaUsuarioSeed crea la cuenta de s, salvo que su correo ya exista.
+// Devuelve el usuario creado, o nil si no lo creó, y los campos que
+// repite de otra cuenta.
+func altaUsuarioSeed(s UsuarioSeed) (*Usuario, []string) {
+	if buscarUsuario(s.Correo) != nil {
+		return nil, nil
+	}
+	nuevo := &Usuario{
+		ID:                 nuevoID(),
+		Correo:             s.Correo,
+		Telefono:           s.Telefono,
+		Password:           s.Password,
+		Admin:              s.Admin,
+		Estado:             s.Estado,
+		FechaRegistro:      time.Now(),
+		CorreoVerificado:   !s.SinVerificar,
+		TelefonoVerificado: !s.SinVerificar,
+	}
+	if nuevo.Estado == "" {
+		nuevo.Estado = estadoActiva
+	}
+	if repetidos := insertarUsuario(nuevo); repetidos != nil {
+		return nil, repetidos
+	}
+	registrarEvento(nuevo, "registro")
+	return nuevo, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// cargarFixture instala durante la prueba un repositorio en memoria
+// vacío, le carga los usuarios del archivo testdata/nombre, con el formato
+// de DATOS_SEED_ARCHIVO, y los devuelve por correo. El mismo archivo
+// sirve para levantar el servidor con esas cuentas:
+//
+//	go run . --profile dev --seed testdata/usuarios.json
+func cargarFixture(t *testing.T, nombre string) map[string]*Usuario {
+	t.Helper()
+	usarRepositorio(t, nuevoRepositorioMemoria())
+	if _, err := cargarArchivoSeed(filepath.Join("testdata", nombre)); err != nil {
+		t.Fatalf("fixture %s: %v", nombre, err)
+	}
+	usuarios := map[string]*Usuario{}
+	for _, u := range usuariosAlmacenados() {
+		usuarios[u.Correo] = u
+	}
+	return usuarios
+}
+
+func TestCargarArchivoSeed(t *testing.T) {
+	prepararHandlers(t)
+	usuarios := cargarFixture(t, "usuarios.json")
+	if len(usuarios) != 5 {
+		t.Fatalf("se cargaron %d usuarios, se esperaban 5", len(usuarios))
+	}
+	admin := usuarios["admin@pruebas.example.com"]
+	if admin == nil || !admin.Admin || admin.Telefono != "+525530000001" || !admin.CorreoVerificado || !admin.TelefonoVerificado {
+		t.Errorf("administrador %+v", admin)
+	}
+	if u := usuarios["sin-verificar@pruebas.example.com"]; u == nil || u.CorreoVerificado || u.TelefonoVerificado {
+		t.Errorf("usuario sin verificar %+v", u)
+	}
+	if u := usuarios["suspendida@pruebas.example.com"]; u == nil || u.Estado != estadoSuspendida {
+		t.Errorf("usuario suspendido %+v", u)
+	}
+
+	// Cargar de nuevo el archivo omite las cuentas que ya existen.
+	creados, err := cargarArchivoSeed(filepath.Join("testdata", "usuarios.json"))
+	if err != nil || creados != 0 {
+		t.Errorf("segunda carga: %d creados, error %v; se esperaban 0 y ningún error", creados, err)
+	}
+}
+
+func TestLoginConFixtures(t *testing.T) {
+	prepararHandlers(t)
+	cargarFixture(t, "usuarios.json")
+	casos := []struct {
+		nombre, correo, password string
+		status                   int
+	}{
+		{"administrador", "admin@pruebas.example.com", "Admin1@", http.StatusOK},
+		{"activa", "activa@pruebas.example.com", "Activa1@", http.StatusOK},
+		{"contraseña anterior a la política", "password-anterior@pruebas.example.com", "simple", http.StatusOK},
+		{"suspendida", "suspendida@pruebas.example.com", "Suspendida1@", http.StatusForbidden},
+		{"cuenta de ejemplo fuera del fixture", "usuario@example.com", "Usuario1@", http.StatusUnauthorized},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			cuerpo := `{"correo":"` + c.correo + `","password":"` + c.password + `"}`
+			if w := atender(loginHandler, "/login", cuerpo); w.Code != c.status {
+				t.Errorf("status %d, se esperaba %d: %s", w.Code, c.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestCargarArchivoSeedInvalido(t *testing.T) {
+	prepararHandlers(t)
+	casos := []struct {
+		nombre    string
+		contenido string
+		error     string
+	}{
+		{"no es una lista", `{"correo":"ana@ejemplo.com"}`, "debe ser una lista JSON de usuarios"},
+		{"campo desconocido", `[{"correo":"ana@ejemplo.com","telefono":"5530000010","password":"Ana1@","rol":"admin"}]`, `unknown field "rol"`},
+		{"correo inválido", `[{"correo":"ana","telefono":"5530000010","password":"Ana1@"}]`, "usuario 1 (ana): correo inválido"},
+		{"teléfono inválido", `[{"correo":"ana@ejemplo.com","telefono":"123","password":"Ana1@"}]`, "usuario 1 (ana@ejemplo.com): teléfono inválido"},
+		{"sin contraseña", `[{"correo":"ana@ejemplo.com","telefono":"5530000010"}]`, "usuario 1 (ana@ejemplo.com): falta la contraseña"},
+		{"estado desconocido", `[{"correo":"ana@ejemplo.com","telefono":"5530000010","password":"Ana1@","estado":"bloqueada"}]`, `usuario 1 (ana@ejemplo.com): estado "bloqueada"`},
+		{"teléfono repetido", `[
+			{"correo":"ana@ejemplo.com","telefono":"5530000010","password":"Ana1@"},
+			{"correo":"eva@ejemplo.com","telefono":"55 3000 0010","password":"Eva1@"}
+		]`, "usuario 2 (eva@ejemplo.com): el teléfono ya se encuentra registrado"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			usarRepositorio(t, nuevoRepositorioMemoria())
+			ruta := filepath.Join(t.TempDir(), "usuarios.json")
+			if err := os.WriteFile(ruta, []byte(c.contenido), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := cargarArchivoSeed(ruta)
+			if err == nil || !strings.Contains(err.Error(), c.error) {
+				t.Errorf("error %v, se esperaba uno que contenga %q", err, c.error)
+			}
+		})
+	}
+}
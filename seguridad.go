@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/geoip2-golang/v2"
+	"pruebasgo/validacion"
+)
+
+// Tipos de alerta de seguridad.
+const (
+	alertaFallosIP       = "fallos_login_ip"
+	alertaPaisNuevo      = "login_pais_nuevo"
+	alertaRafagaRegistro = "rafaga_registros"
+)
+
+// ConfigSeguridad define los umbrales de detección de anomalías y a dónde
+// se envían las alertas.
+type ConfigSeguridad struct {
+	UmbralFallosIP  int
+	UmbralRegistros int
+	Ventana         time.Duration
+	Webhook         string
+	Correos         []string
+	HeaderPais      string
+	BaseGeoIP       string
+}
+
+// cargarConfigSeguridad lee ALERTA_FALLOS_IP (logins fallidos desde una
+// IP, por defecto 10), ALERTA_REGISTROS (registros en total, por defecto
+// 20), ALERTA_VENTANA (ventana de ambos conteos, por defecto 10m),
+// ALERTAS_WEBHOOK (URL que recibe cada alerta por POST), ALERTAS_CORREOS
+// (direcciones separadas por coma que reciben cada alerta por correo) y
+// GEOIP_HEADER
+// o GEOIP_DB para conocer el país de la IP: un header con el código ISO
+// puesto por el CDN (p. ej. CF-IPCountry) o una base GeoLite2-Country.
+func cargarConfigSeguridad() ConfigSeguridad {
+	cfg := configSeguridadPorDefecto()
+	cfg.Webhook = opcion("ALERTAS_WEBHOOK")
+	for _, correo := range strings.Split(opcion("ALERTAS_CORREOS"), ",") {
+		if correo = validacion.NormalizarCorreo(correo); correo != "" {
+			cfg.Correos = append(cfg.Correos, correo)
+		}
+	}
+	cfg.HeaderPais = opcion("GEOIP_HEADER")
+	cfg.BaseGeoIP = opcion("GEOIP_DB")
+	if n, err := strconv.Atoi(opcion("ALERTA_FALLOS_IP")); err == nil && n > 0 {
+		cfg.UmbralFallosIP = n
+	}
+	if n, err := strconv.Atoi(opcion("ALERTA_REGISTROS")); err == nil && n > 0 {
+		cfg.UmbralRegistros = n
+	}
+	if d, err := time.ParseDuration(opcion("ALERTA_VENTANA")); err == nil && d > 0 {
+		cfg.Ventana = d
+	}
+	return cfg
+}
+
+// configSeguridadPorDefecto devuelve los umbrales por defecto, sin
+// webhook ni fuente de países.
+func configSeguridadPorDefecto() ConfigSeguridad {
+	return ConfigSeguridad{
+		UmbralFallosIP:  10,
+		UmbralRegistros: 20,
+		Ventana:         10 * time.Minute,
+	}
+}
+
+// Alerta describe un patrón sospechoso detectado.
+type Alerta struct {
+	Tipo      string    `json:"tipo"`
+	Fecha     time.Time `json:"fecha"`
+	IP        string    `json:"ip"`
+	Correo    string    `json:"correo,omitempty"`
+	Detalle   string    `json:"detalle"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// detectorAnomalias cuenta eventos en ventanas deslizantes y emite una
+// alerta cuando se supera un umbral. Cada alerta se emite como mucho una
+// vez por ventana y clave, para no inundar el destino.
+type detectorAnomalias struct {
+	cfg     ConfigSeguridad
+	geoip   *geoip2.Reader
+	cliente *http.Client
+
+	mu             sync.Mutex
+	fallosPorIP    map[string][]time.Time
+	registros      []time.Time
+	alertadas      map[string]time.Time
+	ultimaLimpieza time.Time
+}
+
+// seguridad es el detector de anomalías del servicio; main lo reemplaza
+// al arrancar por uno con la configuración de cargarConfigSeguridad.
+var seguridad = nuevoDetectorAnomalias(configSeguridadPorDefecto())
+
+func nuevoDetectorAnomalias(cfg ConfigSeguridad) *detectorAnomalias {
+	d := &detectorAnomalias{
+		cfg:         cfg,
+		cliente:     nuevoClienteHTTP(5 * time.Second),
+		fallosPorIP: map[string][]time.Time{},
+		alertadas:   map[string]time.Time{},
+	}
+	if cfg.BaseGeoIP != "" {
+		geoip, err := geoip2.Open(cfg.BaseGeoIP)
+		if err != nil {
+			fatal("Error abriendo la base GeoIP", err)
+		}
+		d.geoip = geoip
+	}
+	return d
+}
+
+// loginFallido cuenta un login fallido desde la IP de la petición.
+func (d *detectorAnomalias) loginFallido(r *http.Request, correo string) {
+	ip := ipCliente(r)
+	ahora := time.Now()
+
+	d.mu.Lock()
+	if ahora.Sub(d.ultimaLimpieza) > time.Minute {
+		d.limpiar(ahora)
+	}
+	fallos := recientes(append(d.fallosPorIP[ip], ahora), ahora.Add(-d.cfg.Ventana))
+	d.fallosPorIP[ip] = fallos
+	disparar := len(fallos) >= d.cfg.UmbralFallosIP && d.marcarAlerta(alertaFallosIP+":"+ip, ahora)
+	d.mu.Unlock()
+
+	if disparar {
+		d.alertar(r, Alerta{
+			Tipo:    alertaFallosIP,
+			Correo:  correo,
+			Detalle: strconv.Itoa(len(fallos)) + " logins fallidos en " + d.cfg.Ventana.String(),
+		})
+	}
+}
+
+// registro cuenta un registro nuevo para detectar ráfagas de altas.
+func (d *detectorAnomalias) registro(r *http.Request) {
+	ahora := time.Now()
+
+	d.mu.Lock()
+	d.registros = recientes(append(d.registros, ahora), ahora.Add(-d.cfg.Ventana))
+	total := len(d.registros)
+	disparar := total >= d.cfg.UmbralRegistros && d.marcarAlerta(alertaRafagaRegistro, ahora)
+	d.mu.Unlock()
+
+	if disparar {
+		d.alertar(r, Alerta{
+			Tipo:    alertaRafagaRegistro,
+			Detalle: strconv.Itoa(total) + " registros en " + d.cfg.Ventana.String(),
+		})
+	}
+}
+
+// loginExitoso alerta si el país de la petición no aparece en ninguna
+// sesión anterior del usuario que tenga país conocido. Debe llamarse
+// antes de registrar la sesión actual.
+func (d *detectorAnomalias) loginExitoso(r *http.Request, usuario *Usuario, pais string) {
+	if pais == "" {
+		return
+	}
+	conocido, hayHistorial := false, false
+	for _, s := range usuario.Sesiones {
+		if s.Pais != "" {
+			hayHistorial = true
+			conocido = conocido || s.Pais == pais
+		}
+	}
+	if hayHistorial && !conocido {
+		d.alertar(r, Alerta{
+			Tipo:    alertaPaisNuevo,
+			Correo:  usuario.Correo,
+			Detalle: "login desde " + pais,
+		})
+		eventosSesion.publicar(usuario.ID, EventoSesion{Tipo: alertaPaisNuevo, Fecha: time.Now(), Motivo: "login desde " + pais})
+	}
+}
+
+// pais devuelve el código ISO del país de la petición, tomado del header
+// configurado o de la base GeoIP, o "" si no se puede determinar.
+func (d *detectorAnomalias) pais(r *http.Request) string {
+	if d.cfg.HeaderPais != "" {
+		if p := strings.ToUpper(strings.TrimSpace(r.Header.Get(d.cfg.HeaderPais))); len(p) == 2 {
+			return p
+		}
+	}
+	if d.geoip == nil {
+		return ""
+	}
+	ip, err := netip.ParseAddr(ipCliente(r))
+	if err != nil {
+		return ""
+	}
+	registro, err := d.geoip.Country(ip)
+	if err != nil {
+		return ""
+	}
+	return registro.Country.ISOCode
+}
+
+// marcarAlerta indica si la alerta con esa clave puede emitirse y, en tal
+// caso, la marca como emitida. Se llama con d.mu tomado.
+func (d *detectorAnomalias) marcarAlerta(clave string, ahora time.Time) bool {
+	if ultima, ok := d.alertadas[clave]; ok && ahora.Sub(ultima) < d.cfg.Ventana {
+		return false
+	}
+	for k, t := range d.alertadas {
+		if ahora.Sub(t) >= d.cfg.Ventana {
+			delete(d.alertadas, k)
+		}
+	}
+	d.alertadas[clave] = ahora
+	return true
+}
+
+// alertar registra la alerta en el log, la encola por correo a
+// ALERTAS_CORREOS y, si hay webhook configurado, la envía en segundo
+// plano como JSON.
+func (d *detectorAnomalias) alertar(r *http.Request, a Alerta) {
+	a.Fecha = time.Now().UTC()
+	a.IP = ipCliente(r)
+	a.RequestID = requestID(r)
+	attrs := []any{"tipo", a.Tipo, "ip", a.IP, "detalle", a.Detalle}
+	if a.Correo != "" {
+		attrs = append(attrs, "correo", a.Correo)
+	}
+	slog.WarnContext(r.Context(), "Alerta de seguridad", attrs...)
+	for _, destinatario := range d.cfg.Correos {
+		if err := encolarCorreo(r.Context(), destinatario, idiomaPorDefecto, plantillaCorreoAlertaSeguridad, a); err != nil {
+			slog.ErrorContext(r.Context(), "Error encolando el correo de la alerta", "error", err)
+		}
+	}
+	if d.cfg.Webhook == "" {
+		return
+	}
+
+	cuerpo, _ := json.Marshal(a)
+	// El envío sobrevive a la petición pero conserva su request ID y traza.
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, d.cliente.Timeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.cfg.Webhook, bytes.NewReader(cuerpo))
+		if err != nil {
+			slog.Error("Error creando la petición del webhook de alertas", "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := d.cliente.Do(req)
+		if err != nil {
+			slog.Error("Error enviando alerta al webhook", "error", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.Error("El webhook de alertas respondió con error", "status", resp.StatusCode)
+		}
+	}()
+}
+
+// limpiar descarta las IPs sin fallos dentro de la ventana. Se llama con
+// d.mu tomado.
+func (d *detectorAnomalias) limpiar(ahora time.Time) {
+	for ip, fallos := range d.fallosPorIP {
+		if len(recientes(fallos, ahora.Add(-d.cfg.Ventana))) == 0 {
+			delete(d.fallosPorIP, ip)
+		}
+	}
+	d.ultimaLimpieza = ahora
+}
+
+// recientes descarta del inicio de la lista los instantes anteriores a
+// desde; la lista está ordenada cronológicamente.
+func recientes(instantes []time.Time, desde time.Time) []time.Time {
+	i := 0
+	for i < len(instantes) && instantes[i].Before(desde) {
+		i++
+	}
+	return instantes[i:]
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigSendGrid define la cuenta de SendGrid con la que se envían los
+// correos.
+type ConfigSendGrid struct {
+	APIKey string
+	URL    string
+}
+
+// cargarConfigSendGrid lee SENDGRID_API_KEY (obligatoria, con permiso de
+// Mail Send) y SENDGRID_URL (URL base de la API, por defecto
+// https://api.sendgrid.com; las cuentas con residencia de datos en la UE
+// usan https://api.eu.sendgrid.com).
+func cargarConfigSendGrid() (ConfigSendGrid, error) {
+	cfg := ConfigSendGrid{APIKey: opcion("SENDGRID_API_KEY"), URL: "https://api.sendgrid.com"}
+	if cfg.APIKey == "" {
+		return cfg, errors.New("CORREO_PROVEEDOR=sendgrid requiere SENDGRID_API_KEY")
+	}
+	if v := opcion("SENDGRID_URL"); v != "" {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return cfg, fmt.Errorf("SENDGRID_URL=%q: debe ser una URL http o https absoluta", v)
+		}
+		cfg.URL = strings.TrimSuffix(v, "/")
+	}
+	return cfg, nil
+}
+
+// remitenteSendGrid entrega los correos con la API v3 de SendGrid
+// (POST /v3/mail/send). Los errores de red, 429 y 5xx se reintentan; los
+// demás status de error no, porque SendGrid rechazó el correo o la
+// cuenta (API key inválida, remitente sin verificar, ...).
+type remitenteSendGrid struct {
+	correo  ConfigCorreo
+	cfg     ConfigSendGrid
+	cliente *http.Client
+}
+
+func nuevoRemitenteSendGrid(correo ConfigCorreo, cfg ConfigSendGrid) remitenteSendGrid {
+	return remitenteSendGrid{correo: correo, cfg: cfg, cliente: nuevoClienteHTTP(correo.Timeout)}
+}
+
+// politicaReintentos: SendGrid encola los correos que acepta, así que los
+// fallos transitorios son sobre todo límites de tasa, que indican hasta
+// cuándo esperar (ver esperaSendGrid), y caídas breves de la API.
+func (remitenteSendGrid) politicaReintentos() PoliticaReintentos {
+	return PoliticaReintentos{Reintentos: 5, Backoff: 5 * time.Second, BackoffMax: 5 * time.Minute}
+}
+
+// Tipos del cuerpo de POST /v3/mail/send.
+type (
+	correoSendGrid struct {
+		Personalizations []personalizacionSendGrid `json:"personalizations"`
+		From             direccionSendGrid         `json:"from"`
+		Subject          string                    `json:"subject"`
+		Content          []contenidoSendGrid       `json:"content"`
+		Headers          map[string]string         `json:"headers,omitempty"`
+	}
+	personalizacionSendGrid struct {
+		To []direccionSendGrid `json:"to"`
+	}
+	direccionSendGrid struct {
+		Email string `json:"email"`
+		Name  string `json:"name,omitempty"`
+	}
+	contenidoSendGrid struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+)
+
+func (s remitenteSendGrid) enviar(ctx context.Context, m mensajeCorreo) error {
+	// SendGrid exige que text/plain vaya antes que text/html.
+	contenido := []contenidoSendGrid{{Type: "text/plain", Value: m.Cuerpo}}
+	if m.HTML != "" {
+		contenido = append(contenido, contenidoSendGrid{Type: "text/html", Value: m.HTML})
+	}
+	cuerpo, err := json.Marshal(correoSendGrid{
+		Personalizations: []personalizacionSendGrid{{To: []direccionSendGrid{{Email: m.Destinatario}}}},
+		From:             direccionSendGrid{Email: s.correo.Remitente.Address, Name: s.correo.Remitente.Name},
+		Subject:          m.Asunto,
+		Content:          contenido,
+		Headers:          m.Headers,
+	})
+	if err != nil {
+		return permanente(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL+"/v3/mail/send", bytes.NewReader(cuerpo))
+	if err != nil {
+		return permanente(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.cliente.Do(req)
+	if err != nil {
+		return fmt.Errorf("SendGrid: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("SendGrid respondió %d: %s", resp.StatusCode, mensajeErrorSendGrid(resp.Body))
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return reintentarDespues(err, esperaSendGrid(resp.Header, time.Now()))
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return err
+	}
+	return permanente(err)
+}
+
+// mensajeErrorSendGrid extrae los mensajes de una respuesta de error de
+// SendGrid, {"errors":[{"message":"...","field":"..."}]}, o devuelve el
+// cuerpo tal cual si no tiene esa forma.
+func mensajeErrorSendGrid(cuerpo io.Reader) string {
+	datos, _ := io.ReadAll(io.LimitReader(cuerpo, 4096))
+	var respuesta struct {
+		Errors []struct {
+			Message string `json:"message"`
+			Field   string `json:"field"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(datos, &respuesta) != nil || len(respuesta.Errors) == 0 {
+		return strings.TrimSpace(string(datos))
+	}
+	mensajes := make([]string, 0, len(respuesta.Errors))
+	for _, e := range respuesta.Errors {
+		if e.Field != "" {
+			mensajes = append(mensajes, e.Field+": "+e.Message)
+		} else {
+			mensajes = append(mensajes, e.Message)
+		}
+	}
+	return strings.Join(mensajes, "; ")
+}
+
+// esperaSendGrid devuelve cuánto esperar tras un 429: lo que indica
+// Retry-After, en segundos, o el tiempo hasta X-RateLimit-Reset, la hora
+// Unix en que se renueva el límite. 0 si no trae ninguno.
+func esperaSendGrid(h http.Header, ahora time.Time) time.Duration {
+	if s, err := strconv.Atoi(h.Get("Retry-After")); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		return max(time.Unix(reset, 0).Sub(ahora), 0)
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// remitenteSendGridDe devuelve un remitente de SendGrid contra un
+// servidor de prueba que atiende con h.
+func remitenteSendGridDe(t *testing.T, h http.HandlerFunc) remitenteSendGrid {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	t.Setenv("CORREO_PROVEEDOR", "sendgrid")
+	t.Setenv("CORREO_REMITENTE", "StratPlus <no-responder@ejemplo.com>")
+	t.Setenv("SENDGRID_API_KEY", "SG.prueba")
+	t.Setenv("SENDGRID_URL", srv.URL+"/")
+	correo, err := cargarConfigCorreo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := nuevoRemitenteCorreo(context.Background(), correo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.(remitenteSendGrid)
+}
+
+func TestRemitenteSendGrid(t *testing.T) {
+	var recibido correoSendGrid
+	s := remitenteSendGridDe(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/mail/send" || r.Header.Get("Authorization") != "Bearer SG.prueba" {
+			t.Errorf("%s %s con Authorization %q", r.Method, r.URL.Path, r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&recibido); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	err := s.enviar(context.Background(), mensajeCorreo{
+		Destinatario: "ana@ejemplo.com",
+		Asunto:       "Verifica tu correo electrónico",
+		Cuerpo:       "Hola",
+		HTML:         "<p>Hola</p>",
+		Headers:      map[string]string{"x-request-id": "abc123"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recibido.Personalizations) != 1 || recibido.Personalizations[0].To[0].Email != "ana@ejemplo.com" {
+		t.Errorf("destinatarios %+v", recibido.Personalizations)
+	}
+	if recibido.From != (direccionSendGrid{Email: "no-responder@ejemplo.com", Name: "StratPlus"}) || recibido.Subject != "Verifica tu correo electrónico" {
+		t.Errorf("from %+v, asunto %q", recibido.From, recibido.Subject)
+	}
+	contenido := []contenidoSendGrid{{Type: "text/plain", Value: "Hola"}, {Type: "text/html", Value: "<p>Hola</p>"}}
+	if !slices.Equal(recibido.Content, contenido) || recibido.Headers["x-request-id"] != "abc123" {
+		t.Errorf("contenido %+v, headers %v", recibido.Content, recibido.Headers)
+	}
+}
+
+func TestRemitenteSendGridErrores(t *testing.T) {
+	reset := time.Now().Add(90 * time.Second).Unix()
+	casos := []struct {
+		nombre     string
+		status     int
+		headers    map[string]string
+		cuerpo     string
+		permanente bool
+		espera     time.Duration
+		mensaje    string
+	}{
+		{"remitente sin verificar", http.StatusForbidden, nil, `{"errors":[{"message":"The from address does not match a verified Sender Identity","field":"from"}]}`, true, 0, "from: The from address"},
+		{"API key inválida", http.StatusUnauthorized, nil, `{"errors":[{"message":"Permission denied, wrong credentials"}]}`, true, 0, "wrong credentials"},
+		{"caída", http.StatusServiceUnavailable, nil, "", false, 0, "503"},
+		{"límite con Retry-After", http.StatusTooManyRequests, map[string]string{"Retry-After": "20"}, "", false, 20 * time.Second, "429"},
+		{"límite con X-RateLimit-Reset", http.StatusTooManyRequests, map[string]string{"X-RateLimit-Reset": strconv.FormatInt(reset, 10)}, "", false, 80 * time.Second, "429"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			s := remitenteSendGridDe(t, func(w http.ResponseWriter, r *http.Request) {
+				for nombre, valor := range c.headers {
+					w.Header().Set(nombre, valor)
+				}
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.cuerpo))
+			})
+			err := s.enviar(context.Background(), mensajeCorreo{Destinatario: "ana@ejemplo.com", Asunto: "Hola", Cuerpo: "Hola"})
+			if err == nil || !strings.Contains(err.Error(), c.mensaje) {
+				t.Fatalf("error %v, se esperaba uno con %q", err, c.mensaje)
+			}
+			if esPermanente := errors.As(err, new(errorPermanente)); esPermanente != c.permanente {
+				t.Errorf("error %v: permanente %t, se esperaba %t", err, esPermanente, c.permanente)
+			}
+			var pedida errorReintentarDespues
+			if errors.As(err, &pedida) != (c.espera > 0) || pedida.espera < c.espera || pedida.espera > c.espera+15*time.Second {
+				t.Errorf("espera %v, se esperaba %v", pedida.espera, c.espera)
+			}
+		})
+	}
+}
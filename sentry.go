@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// headersSensibles no se envían nunca a Sentry.
+var headersSensibles = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// parametrosSensibles son los parámetros de query cuyo valor se reemplaza
+// antes de enviar un evento: tokens de verificación, códigos OIDC, etc.
+var parametrosSensibles = []string{"token", "code", "state", "password", "codigo"}
+
+// configurarSentry inicializa el cliente de Sentry si se definió
+// SENTRY_DSN (cualquier DSN compatible, p. ej. GlitchTip). SENTRY_ENTORNO
+// y SENTRY_RELEASE etiquetan los eventos. Devuelve false si el reporte
+// quedó desactivado.
+func configurarSentry() (bool, error) {
+	dsn := opcion("SENTRY_DSN")
+	if dsn == "" {
+		return false, nil
+	}
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:            dsn,
+		Environment:    opcion("SENTRY_ENTORNO"),
+		Release:        opcion("SENTRY_RELEASE"),
+		SendDefaultPII: false,
+		BeforeSend:     limpiarEventoSentry,
+	})
+	return err == nil, err
+}
+
+// reportarPanic envía a Sentry un panic recuperado con el contexto de la
+// petición.
+func reportarPanic(r *http.Request, rec any) {
+	hubDePeticion(r).RecoverWithContext(r.Context(), rec)
+}
+
+// reportarErrorServidor envía a Sentry una respuesta 5xx que no provino de
+// un panic.
+func reportarErrorServidor(r *http.Request, status int) {
+	ruta := r.Pattern
+	if ruta == "" {
+		ruta = r.Method + " " + r.URL.Path
+	}
+	hubDePeticion(r).CaptureMessage(fmt.Sprintf("Respuesta %d en %s", status, ruta))
+}
+
+// hubDePeticion prepara un hub con los datos de la petición: método, URL,
+// headers (sin credenciales), request ID y ruta. Nunca incluye el
+// cuerpo, donde viajan las contraseñas.
+func hubDePeticion(r *http.Request) *sentry.Hub {
+	hub := sentry.CurrentHub().Clone()
+	hub.Scope().SetRequest(r)
+	hub.Scope().SetTag("request_id", requestID(r))
+	if r.Pattern != "" {
+		hub.Scope().SetTag("ruta", r.Pattern)
+	}
+	return hub
+}
+
+// limpiarEventoSentry elimina del evento los datos sensibles que pudieran
+// haberse colado: headers de credenciales, cookies, cuerpo y parámetros
+// de query con tokens o códigos.
+func limpiarEventoSentry(e *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+	if e.Request == nil {
+		return e
+	}
+	for _, h := range headersSensibles {
+		for k := range e.Request.Headers {
+			if strings.EqualFold(k, h) {
+				delete(e.Request.Headers, k)
+			}
+		}
+	}
+	e.Request.Cookies = ""
+	e.Request.Data = ""
+	if q, err := url.ParseQuery(e.Request.QueryString); err == nil {
+		for _, p := range parametrosSensibles {
+			if q.Has(p) {
+				q.Set(p, valorFiltrado)
+			}
+		}
+		e.Request.QueryString = q.Encode()
+	} else {
+		e.Request.QueryString = ""
+	}
+	return e
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"pruebasgo/validacion"
+)
+
+// errorServicio es el error de una operación de la capa de servicios: el
+// status HTTP y el cuerpo con que lo responde la API REST. Los demás
+// transportes (gRPC) lo traducen a sus propios códigos.
+type errorServicio struct {
+	status    int
+	respuesta ErrorResponse
+}
+
+// nuevoErrorServicio crea un error con status, código y mensaje.
+func nuevoErrorServicio(status int, codigo, mensaje string) *errorServicio {
+	return &errorServicio{status: status, respuesta: ErrorResponse{Error: mensaje, Codigo: codigo}}
+}
+
+// erroresCampo crea un error con la lista de errores por campo; el
+// mensaje y el código generales son los del primero.
+func erroresCampo(status int, errores []ErrorCampo) *errorServicio {
+	return &errorServicio{status: status, respuesta: ErrorResponse{
+		Error:   errores[0].Mensaje,
+		Codigo:  errores[0].codigoRespuesta,
+		Errores: errores,
+	}}
+}
+
+// responderErrorServicio escribe el error como respuesta HTTP.
+func responderErrorServicio(w http.ResponseWriter, err *errorServicio) {
+	escribirJSON(w, err.status, err.respuesta)
+}
+
+// registrarCuenta da de alta la cuenta de un usuario que se registra
+// (ver altaCuenta) y le envía el correo de bienvenida. Rechaza el
+// registro si la flag registro_abierto está desactivada.
+func registrarCuenta(r *http.Request, req RegistroRequest) (*Usuario, *errorServicio) {
+	if !funcionalidades.activa(r.Context(), flagRegistroAbierto) {
+		slog.InfoContext(r.Context(), "Registro rechazado: el registro está cerrado")
+		return nil, nuevoErrorServicio(http.StatusForbidden, "REGISTRO_CERRADO", "El registro de nuevas cuentas está cerrado")
+	}
+	nuevo, errServicio := altaCuenta(r, req, false)
+	if errServicio != nil {
+		return nil, errServicio
+	}
+	// Se encola como los demás correos: no demora la respuesta y, si no
+	// se puede enviar, el registro ya está hecho.
+	desbloquear := nuevo.bloquear()
+	correo, idioma := nuevo.Correo, nuevo.idioma()
+	desbloquear()
+	if err := encolarCorreo(r.Context(), correo, idioma, plantillaCorreoBienvenida, datosBienvenida{Correo: correo}); err != nil {
+		slog.ErrorContext(r.Context(), "Error enviando el correo de bienvenida", "correo", correo, "error", err)
+	}
+	return nuevo, nil
+}
+
+// altaCuenta da de alta una cuenta, con rol de administrador si admin o
+// si el correo está en ADMIN_CORREOS. r es la petición que origina la
+// operación, de la que se toman la IP, el user-agent y el request ID
+// para la auditoría y las alertas.
+// - Valida los campos recibidos
+// - Revisa que no existan usuarios con el mismo correo o teléfono
+// - Guarda al usuario en memoria si es válido, con el idioma de Accept-Language
+// - Envía el enlace de verificación de correo y el código por SMS
+func altaCuenta(r *http.Request, req RegistroRequest, admin bool) (*Usuario, *errorServicio) {
+	req.Correo = validacion.NormalizarCorreo(req.Correo)
+
+	// Validación de campos: se reportan todos los problemas a la vez
+	var errores []ErrorCampo
+	telefono, errTelefono := validacion.Telefono(req.Telefono, config.PaisTelefono)
+	switch {
+	case req.Correo == "":
+		errores = append(errores, ErrorCampo{Campo: "correo", Codigo: codigoRequerido, Mensaje: "Falta el campo correo", codigoRespuesta: "CAMPO_REQUERIDO"})
+	case validacion.Correo(req.Correo, reglasCorreoVigentes().OpcionesCorreo) != nil:
+		errores = append(errores, ErrorCampo{Campo: "correo", Codigo: codigoFormatoInvalido, Mensaje: "Correo inválido", codigoRespuesta: "CORREO_INVALIDO"})
+	case funcionalidades.activa(r.Context(), flagBloquearDesechables) && correoDesechable(req.Correo):
+		errores = append(errores, ErrorCampo{Campo: "correo", Codigo: codigoNoPermitido, Mensaje: "No se admiten correos desechables", codigoRespuesta: "CORREO_DESECHABLE"})
+	case correoSinMX(r.Context(), req.Correo):
+		errores = append(errores, ErrorCampo{Campo: "correo", Codigo: codigoSinMX, Mensaje: "El dominio del correo no recibe correos", codigoRespuesta: "DOMINIO_SIN_MX"})
+	}
+	switch {
+	case req.Telefono == "":
+		errores = append(errores, ErrorCampo{Campo: "telefono", Codigo: codigoRequerido, Mensaje: "Falta el campo telefono", codigoRespuesta: "CAMPO_REQUERIDO"})
+	case errTelefono != nil:
+		errores = append(errores, ErrorCampo{Campo: "telefono", Codigo: codigoFormatoInvalido, Mensaje: "Teléfono inválido", codigoRespuesta: "TELEFONO_INVALIDO"})
+	}
+	var errPassword *validacion.ErrorPassword
+	switch {
+	case req.Password == "":
+		errores = append(errores, ErrorCampo{Campo: "password", Codigo: codigoRequerido, Mensaje: "Falta el campo password", codigoRespuesta: "CAMPO_REQUERIDO"})
+	case errors.As(validacion.Password(req.Password, politicaPasswordVigente()), &errPassword):
+		errores = append(errores, ErrorCampo{
+			Campo:   "password",
+			Codigo:  codigoFormatoInvalido,
+			Mensaje: "Contraseña inválida",
+			Reglas:  errPassword.Mensajes(),
+
+			codigoRespuesta: "PASSWORD_INVALIDA",
+		})
+	}
+	if len(errores) > 0 {
+		campos := make([]string, len(errores))
+		for i, e := range errores {
+			campos[i] = e.Campo + ":" + e.Codigo
+		}
+		slog.InfoContext(r.Context(), "Registro rechazado por validación", "errores", campos)
+		return nil, erroresCampo(http.StatusBadRequest, errores)
+	}
+
+	// Registro, si el correo y el teléfono no están registrados
+	nuevo := &Usuario{
+		ID:            nuevoID(),
+		Correo:        req.Correo,
+		Telefono:      telefono,
+		Password:      req.Password,
+		Admin:         admin || esCorreoAdmin(req.Correo),
+		Estado:        estadoActiva,
+		FechaRegistro: time.Now(),
+		Idioma:        idiomaDePeticion(r).String(),
+	}
+	// Desde que se inserta, otras peticiones pueden encontrar al usuario.
+	defer nuevo.bloquear()()
+	if campos := insertarUsuario(nuevo); len(campos) > 0 {
+		for _, campo := range campos {
+			errores = append(errores, ErrorCampo{Campo: campo, Codigo: codigoDuplicado, Mensaje: mensajesDuplicado[campo], codigoRespuesta: codigosDuplicado[campo]})
+		}
+		return nil, erroresCampo(http.StatusConflict, errores)
+	}
+	slog.InfoContext(r.Context(), "Usuario registrado correctamente", "correo", req.Correo)
+	metricaRegistros.Inc()
+	auditar(r, "registro", req.Correo, "", "")
+	seguridad.registro(r)
+	registrarEvento(nuevo, "registro")
+	webhooks.publicar(r, eventoUsuarioRegistrado, nuevo)
+	eventosDominio.publicar(r, eventoUsuarioRegistrado, nuevo)
+	if err := enviarVerificacionCorreo(r.Context(), nuevo); err != nil {
+		slog.ErrorContext(r.Context(), "Error enviando verificación de correo", "error", err)
+	}
+	if err := enviarCodigoTelefono(r.Context(), nuevo); err != nil {
+		slog.ErrorContext(r.Context(), "Error enviando verificación de teléfono", "error", err)
+	}
+	return nuevo, nil
+}
+
+// iniciarSesion autentica a un usuario. r es la petición que origina la
+// operación, como en registrarCuenta.
+// - Verifica las credenciales y, si está activo, el segundo factor
+// - Genera un token JWT válido por config.TokenTTL
+// - Devuelve el token y la fecha de inicio
+func iniciarSesion(r *http.Request, req LoginRequest) (LoginResponse, *errorServicio) {
+	req.Correo = validacion.NormalizarCorreo(req.Correo)
+
+	if req.Correo == "" {
+		slog.InfoContext(r.Context(), "Falta campo correo en el request")
+		return LoginResponse{}, nuevoErrorServicio(http.StatusBadRequest, "CAMPO_REQUERIDO", "Falta el campo correo")
+	}
+	if req.Password == "" {
+		slog.InfoContext(r.Context(), "Falta campo contraseña en el request")
+		return LoginResponse{}, nuevoErrorServicio(http.StatusBadRequest, "CAMPO_REQUERIDO", "Falta el campo password")
+	}
+
+	// Búsqueda de usuario
+	usuario := buscarUsuario(req.Correo)
+	if usuario != nil {
+		defer usuario.bloquear()()
+		if usuario.Password != req.Password {
+			usuario = nil
+		}
+	}
+
+	if usuario == nil {
+		slog.WarnContext(r.Context(), "Login fallido: credenciales incorrectas", "correo", req.Correo)
+		registrarLogin(false)
+		auditar(r, "login_fallido", req.Correo, "", "credenciales_incorrectas")
+		seguridad.loginFallido(r, req.Correo)
+		return LoginResponse{}, nuevoErrorServicio(http.StatusUnauthorized, "CREDENCIALES_INVALIDAS", "Correo o contraseña incorrectos")
+	}
+
+	if errServicio := errorCuentaInactiva(r, usuario); errServicio != nil {
+		registrarLogin(false)
+		auditar(r, "login_fallido", usuario.Correo, "", "cuenta_"+string(usuario.Estado))
+		return LoginResponse{}, errServicio
+	}
+	if funcionalidades.activa(r.Context(), flagVerificacionCorreo) && !usuario.CorreoVerificado {
+		slog.WarnContext(r.Context(), "Login rechazado: correo sin verificar", "correo", usuario.Correo)
+		registrarLogin(false)
+		auditar(r, "login_fallido", usuario.Correo, "", "correo_sin_verificar")
+		return LoginResponse{}, nuevoErrorServicio(http.StatusForbidden, "CORREO_NO_VERIFICADO", "El correo no ha sido verificado")
+	}
+
+	// Segundo factor
+	amr := []string{"pwd"}
+	if usuario.DosFAActivo {
+		if req.Codigo == "" {
+			slog.InfoContext(r.Context(), "Falta el código de segundo factor", "correo", usuario.Correo)
+			registrarLogin(false)
+			return LoginResponse{}, nuevoErrorServicio(http.StatusUnauthorized, "CODIGO_REQUERIDO", "Se requiere el código de verificación")
+		}
+		if !verificarSegundoFactor(usuario, req.Codigo) {
+			slog.WarnContext(r.Context(), "Código de segundo factor inválido", "correo", usuario.Correo)
+			registrarLogin(false)
+			auditar(r, "login_fallido", usuario.Correo, "", "segundo_factor_invalido")
+			seguridad.loginFallido(r, usuario.Correo)
+			return LoginResponse{}, nuevoErrorServicio(http.StatusUnauthorized, "CODIGO_INVALIDO", "Código de verificación inválido")
+		}
+		amr = append(amr, "otp", "mfa")
+	}
+
+	// Generación de token JWT
+	sesion := nuevoID()
+	tokenString, err := generarToken(usuario, amr, sesion)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error al generar el token", "error", err)
+		return LoginResponse{}, nuevoErrorServicio(http.StatusInternalServerError, "ERROR_INTERNO", "Error generando token")
+	}
+	registrarSesion(usuario, r, amr, sesion)
+	registrarLogin(true)
+	auditar(r, "login_exitoso", usuario.Correo, "", strings.Join(amr, ","))
+
+	return LoginResponse{
+		Token:               tokenString,
+		FechaInicio:         time.Now(),
+		DebeCambiarPassword: usuario.DebeCambiarPassword,
+	}, nil
+}
+
+// autenticarToken valida un token de acceso de un usuario existente y
+// activo y los requisitos de la cuenta. Devuelve el contexto con el ID,
+// el correo y los claims del usuario autenticado.
+func autenticarToken(ctx context.Context, tokenString string, requisitos requisitosCuenta) (context.Context, *errorServicio) {
+	if tokenString == "" {
+		return ctx, nuevoErrorServicio(http.StatusUnauthorized, "TOKEN_REQUERIDO", "Falta el token de autenticación")
+	}
+
+	claims, err := validarToken(tokenString)
+	if err != nil {
+		return ctx, nuevoErrorServicio(http.StatusUnauthorized, "TOKEN_INVALIDO", "Token inválido o expirado")
+	}
+
+	// El usuario se busca por el ID del claim sub y no por el correo: un
+	// correo liberado al borrar la cuenta o al cambiarlo puede volver a
+	// registrarse, y la nueva cuenta empieza otra vez en la versión 0.
+	usuario := buscarUsuarioPorID(claims["sub"].(string))
+	if usuario == nil {
+		return ctx, nuevoErrorServicio(http.StatusUnauthorized, "TOKEN_INVALIDO", "Token inválido o expirado")
+	}
+	defer usuario.bloquear()()
+	if usuario.Estado != estadoActiva || !versionVigente(claims, usuario) || sesionRevocada(claims, usuario) {
+		return ctx, nuevoErrorServicio(http.StatusUnauthorized, "TOKEN_INVALIDO", "Token inválido o expirado")
+	}
+
+	if requisitos&requiereDosFA != 0 && !usuario.DosFAActivo && funcionalidades.activa(ctx, flagDosFAObligatorio) {
+		return ctx, nuevoErrorServicio(http.StatusForbidden, "DOSFA_REQUERIDO", "Debes activar el segundo factor para continuar")
+	}
+	if requisitos&requierePasswordVigente != 0 && usuario.DebeCambiarPassword {
+		return ctx, &errorServicio{status: http.StatusForbidden, respuesta: ErrorResponse{
+			Error:  "Debes cambiar tu contraseña para continuar",
+			Codigo: "CAMBIO_PASSWORD_REQUERIDO",
+		}}
+	}
+
+	ctx = context.WithValue(ctx, claveUsuario, usuario.ID)
+	ctx = context.WithValue(ctx, claveCorreo, usuario.Correo)
+	ctx = context.WithValue(ctx, claveClaims, claims)
+	return ctx, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// tiempoApagado es el plazo máximo para drenar las peticiones en curso al
+// recibir SIGINT o SIGTERM. Se toma de APAGADO_TIMEOUT (formato de
+// duración de Go) y por defecto es 30s, por debajo del
+// terminationGracePeriodSeconds por defecto de Kubernetes.
+func tiempoApagado() time.Duration {
+	if d, err := time.ParseDuration(opcion("APAGADO_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 30 * time.Second
+}
+
+// ConfigTimeouts define los plazos de las conexiones de los servidores,
+// para que los clientes lentos o inactivos no retengan conexiones y
+// goroutines indefinidamente.
+type ConfigTimeouts struct {
+	Lectura        time.Duration
+	LecturaHeaders time.Duration
+	Escritura      time.Duration
+	Inactividad    time.Duration
+	KeepAlive      bool
+}
+
+// cargarConfigTimeouts lee, en formato de duración de Go y con 0 para no
+// limitar:
+// - TIMEOUT_HEADERS: para leer los headers de la petición, por defecto 5s
+// - TIMEOUT_LECTURA: para leer la petición completa, con el cuerpo, por
+// defecto 15s
+// - TIMEOUT_ESCRITURA: desde que se leen los headers hasta terminar la
+// respuesta, por defecto 60s; debe superar la duración de los perfiles
+// de /debug/pprof/profile, que por defecto es 30s
+// - TIMEOUT_INACTIVIDAD: espera de la siguiente petición en una conexión
+// keep-alive, por defecto 120s
+//
+// y KEEPALIVE (true, por defecto, o false para cerrar cada conexión tras
+// una petición).
+func cargarConfigTimeouts() (ConfigTimeouts, error) {
+	cfg := ConfigTimeouts{
+		Lectura:        15 * time.Second,
+		LecturaHeaders: 5 * time.Second,
+		Escritura:      60 * time.Second,
+		Inactividad:    120 * time.Second,
+		KeepAlive:      true,
+	}
+	for _, d := range []struct {
+		nombre  string
+		destino *time.Duration
+	}{
+		{"TIMEOUT_HEADERS", &cfg.LecturaHeaders},
+		{"TIMEOUT_LECTURA", &cfg.Lectura},
+		{"TIMEOUT_ESCRITURA", &cfg.Escritura},
+		{"TIMEOUT_INACTIVIDAD", &cfg.Inactividad},
+	} {
+		if v := strings.TrimSpace(opcion(d.nombre)); v != "" {
+			duracion, err := time.ParseDuration(v)
+			if err != nil || duracion < 0 {
+				return cfg, fmt.Errorf("%s=%q: debe ser una duración no negativa", d.nombre, v)
+			}
+			*d.destino = duracion
+		}
+	}
+	if v := strings.TrimSpace(opcion("KEEPALIVE")); v != "" {
+		keepAlive, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("KEEPALIVE=%q: debe ser true o false", v)
+		}
+		cfg.KeepAlive = keepAlive
+	}
+	return cfg, nil
+}
+
+// aplicar configura los plazos en srv. Los handlers de conexiones de
+// larga duración (/ws y /eventos) quitan los suyos con
+// http.ResponseController.
+func (c ConfigTimeouts) aplicar(srv *http.Server) {
+	srv.ReadTimeout = c.Lectura
+	srv.ReadHeaderTimeout = c.LecturaHeaders
+	srv.WriteTimeout = c.Escritura
+	srv.IdleTimeout = c.Inactividad
+	srv.SetKeepAlivesEnabled(c.KeepAlive)
+}
+
+// ejecutarServidor atiende peticiones en todos los servidores hasta
+// recibir SIGINT o SIGTERM y entonces deja de aceptar conexiones nuevas y
+// espera a que terminen las peticiones en curso, como mucho
+// tiempoApagado. Los servidores con TLSConfig se sirven por HTTPS.
+// Devuelve el error del primer servidor que no pudo arrancar o el del
+// drenado si no terminó a tiempo.
+func ejecutarServidor(servidores ...*http.Server) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errServidor := make(chan error, len(servidores))
+	for _, srv := range servidores {
+		go func() {
+			if srv.TLSConfig != nil {
+				errServidor <- srv.ListenAndServeTLS("", "")
+			} else {
+				errServidor <- srv.ListenAndServe()
+			}
+		}()
+	}
+
+	var errArranque error
+	select {
+	case errArranque = <-errServidor:
+	case <-ctx.Done():
+		// Se anuncia la instancia como no lista y se sigue atendiendo
+		// durante APAGADO_RETARDO para que el balanceador deje de enviar
+		// tráfico antes de cerrar los listeners.
+		apagando.Store(true)
+		if d, err := time.ParseDuration(opcion("APAGADO_RETARDO")); err == nil && d > 0 {
+			time.Sleep(d)
+		}
+		slog.Info("Señal recibida, esperando a que terminen las peticiones en curso")
+	}
+	// Una segunda señal vuelve a su comportamiento por defecto y termina
+	// el proceso de inmediato.
+	stop()
+
+	ctxApagado, cancel := context.WithTimeout(context.Background(), tiempoApagado())
+	defer cancel()
+	var errs []error
+	for _, srv := range servidores {
+		if err := srv.Shutdown(ctxApagado); err != nil {
+			errs = append(errs, fmt.Errorf("apagado incompleto de %s: %w", srv.Addr, err))
+		}
+	}
+	if errArranque != nil {
+		return errArranque
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	slog.Info("Servidor detenido")
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/smithy-go"
+)
+
+// ConfigSES define la región y el configuration set de Amazon SES.
+type ConfigSES struct {
+	Region           string
+	ConfigurationSet string
+}
+
+// cargarConfigSES lee SES_REGION (por defecto la de la cadena estándar de
+// AWS, como AWS_REGION) y SES_CONFIGURATION_SET (opcional, para publicar
+// los eventos de entrega, rebotes y quejas). Las credenciales se toman de
+// la cadena estándar de AWS (variables AWS_*, perfil, rol de la
+// instancia, ...).
+func cargarConfigSES() ConfigSES {
+	return ConfigSES{
+		Region:           opcion("SES_REGION"),
+		ConfigurationSet: opcion("SES_CONFIGURATION_SET"),
+	}
+}
+
+// erroresPermanentesSES son los códigos de error de SES que no se
+// resuelven reintentando: el correo o el remitente fueron rechazados, o
+// la cuenta no puede enviar. Los demás, como TooManyRequestsException o
+// LimitExceededException, se reintentan.
+var erroresPermanentesSES = []string{
+	"MessageRejected",
+	"MailFromDomainNotVerifiedException",
+	"AccountSuspendedException",
+	"SendingPausedException",
+	"BadRequestException",
+	"NotFoundException",
+}
+
+// remitenteSES entrega los correos con la API v2 de Amazon SES.
+type remitenteSES struct {
+	correo  ConfigCorreo
+	cfg     ConfigSES
+	cliente *sesv2.Client
+}
+
+func nuevoRemitenteSES(ctx context.Context, correo ConfigCorreo, cfg ConfigSES) (remitenteSES, error) {
+	var opciones []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opciones = append(opciones, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opciones...)
+	if err != nil {
+		return remitenteSES{}, fmt.Errorf("configuración de AWS: %w", err)
+	}
+	if awsCfg.Region == "" {
+		return remitenteSES{}, errors.New("CORREO_PROVEEDOR=ses requiere SES_REGION o AWS_REGION")
+	}
+	return remitenteSES{correo: correo, cfg: cfg, cliente: sesv2.NewFromConfig(awsCfg)}, nil
+}
+
+// politicaReintentos: el SDK ya reintenta al instante los errores de red,
+// los 5xx y las limitaciones de tasa; la cola sólo se ocupa de lo que
+// dura más, como una caída de la región o la cuota de envío agotada, con
+// esperas más largas.
+func (remitenteSES) politicaReintentos() PoliticaReintentos {
+	return PoliticaReintentos{Reintentos: 4, Backoff: 30 * time.Second, BackoffMax: 30 * time.Minute}
+}
+
+func (s remitenteSES) enviar(ctx context.Context, m mensajeCorreo) error {
+	ctx, cancel := context.WithTimeout(ctx, s.correo.Timeout)
+	defer cancel()
+
+	var headers []types.MessageHeader
+	for _, clave := range slices.Sorted(maps.Keys(m.Headers)) {
+		headers = append(headers, types.MessageHeader{Name: aws.String(clave), Value: aws.String(m.Headers[clave])})
+	}
+	cuerpo := &types.Body{Text: &types.Content{Data: aws.String(m.Cuerpo), Charset: aws.String("UTF-8")}}
+	if m.HTML != "" {
+		cuerpo.Html = &types.Content{Data: aws.String(m.HTML), Charset: aws.String("UTF-8")}
+	}
+	entrada := &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(s.correo.Remitente.String()),
+		Destination:      &types.Destination{ToAddresses: []string{m.Destinatario}},
+		Content: &types.EmailContent{Simple: &types.Message{
+			Subject: &types.Content{Data: aws.String(m.Asunto), Charset: aws.String("UTF-8")},
+			Body:    cuerpo,
+			Headers: headers,
+		}},
+	}
+	if s.cfg.ConfigurationSet != "" {
+		entrada.ConfigurationSetName = aws.String(s.cfg.ConfigurationSet)
+	}
+	if _, err := s.cliente.SendEmail(ctx, entrada); err != nil {
+		err = fmt.Errorf("SES: %w", err)
+		var errAPI smithy.APIError
+		if errors.As(err, &errAPI) && slices.Contains(erroresPermanentesSES, errAPI.ErrorCode()) {
+			return permanente(err)
+		}
+		return err
+	}
+	return nil
+}
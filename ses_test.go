@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+)
+
+// remitenteSESDe devuelve un remitente de SES contra un servidor de
+// prueba que atiende con h, sin los reintentos del SDK.
+func remitenteSESDe(t *testing.T, h http.HandlerFunc) remitenteSES {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return remitenteSES{
+		correo: ConfigCorreo{Remitente: &mail.Address{Name: "StratPlus", Address: "no-responder@ejemplo.com"}, Timeout: 5 * time.Second},
+		cfg:    ConfigSES{ConfigurationSet: "transaccionales"},
+		cliente: sesv2.New(sesv2.Options{
+			Region:           "us-east-1",
+			BaseEndpoint:     aws.String(srv.URL),
+			Credentials:      credentials.NewStaticCredentialsProvider("AKID", "secreta", ""),
+			RetryMaxAttempts: 1,
+		}),
+	}
+}
+
+func TestRemitenteSES(t *testing.T) {
+	var recibido struct {
+		FromEmailAddress     string
+		ConfigurationSetName string
+		Destination          struct{ ToAddresses []string }
+		Content              struct {
+			Simple struct {
+				Subject struct{ Data string }
+				Body    struct{ Text, Html struct{ Data string } }
+				Headers []struct{ Name, Value string }
+			}
+		}
+	}
+	s := remitenteSESDe(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/email/outbound-emails" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&recibido); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"MessageId":"abc"}`))
+	})
+	err := s.enviar(context.Background(), mensajeCorreo{
+		Destinatario: "ana@ejemplo.com",
+		Asunto:       "Verifica tu correo electrónico",
+		Cuerpo:       "Hola",
+		HTML:         "<p>Hola</p>",
+		Headers:      map[string]string{"x-request-id": "abc123"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	simple := recibido.Content.Simple
+	if recibido.FromEmailAddress != `"StratPlus" <no-responder@ejemplo.com>` || recibido.ConfigurationSetName != "transaccionales" {
+		t.Errorf("from %q, configuration set %q", recibido.FromEmailAddress, recibido.ConfigurationSetName)
+	}
+	if len(recibido.Destination.ToAddresses) != 1 || recibido.Destination.ToAddresses[0] != "ana@ejemplo.com" {
+		t.Errorf("destinatarios %v", recibido.Destination.ToAddresses)
+	}
+	if simple.Subject.Data != "Verifica tu correo electrónico" || simple.Body.Text.Data != "Hola" || simple.Body.Html.Data != "<p>Hola</p>" {
+		t.Errorf("asunto %q, cuerpo %q, HTML %q", simple.Subject.Data, simple.Body.Text.Data, simple.Body.Html.Data)
+	}
+	if len(simple.Headers) != 1 || simple.Headers[0].Name != "x-request-id" || simple.Headers[0].Value != "abc123" {
+		t.Errorf("headers %+v", simple.Headers)
+	}
+}
+
+func TestRemitenteSESErrores(t *testing.T) {
+	casos := []struct {
+		tipo       string
+		status     int
+		permanente bool
+	}{
+		{"MessageRejected", http.StatusBadRequest, true},
+		{"MailFromDomainNotVerifiedException", http.StatusBadRequest, true},
+		{"AccountSuspendedException", http.StatusBadRequest, true},
+		{"TooManyRequestsException", http.StatusTooManyRequests, false},
+		{"InternalServiceErrorException", http.StatusInternalServerError, false},
+	}
+	for _, c := range casos {
+		t.Run(c.tipo, func(t *testing.T) {
+			s := remitenteSESDe(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("X-Amzn-ErrorType", c.tipo)
+				w.WriteHeader(c.status)
+				w.Write([]byte(`{"message":"rechazado"}`))
+			})
+			err := s.enviar(context.Background(), mensajeCorreo{Destinatario: "ana@ejemplo.com", Asunto: "Hola", Cuerpo: "Hola"})
+			if err == nil {
+				t.Fatal("se esperaba un error")
+			}
+			if esPermanente := errors.As(err, new(errorPermanente)); esPermanente != c.permanente {
+				t.Errorf("error %v: permanente %t, se esperaba %t", err, esPermanente, c.permanente)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"cmp"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// versionesUserAgent reconoce los números de versión de un User-Agent,
+// que cambian con cada actualización del navegador o del sistema.
+var versionesUserAgent = regexp.MustCompile(`[0-9]+([._][0-9]+)*`)
+
+// dispositivoDe identifica el dispositivo de un User-Agent sin sus
+// números de versión, para que actualizar el navegador no cuente como un
+// dispositivo nuevo.
+func dispositivoDe(userAgent string) string {
+	return strings.Join(strings.Fields(versionesUserAgent.ReplaceAllString(userAgent, "")), " ")
+}
+
+// avisarLoginNuevo avisa al usuario, por los canales que eligió para
+// alertas_login, si la sesión viene de un país, una IP o un dispositivo
+// que no aparecen en su historial, con un enlace para revocarla cuyo hash
+// se guarda en la sesión. El primer login de la cuenta no se avisa. Debe
+// llamarse con el lock del usuario tomado y antes de agregar la sesión al
+// historial.
+func avisarLoginNuevo(r *http.Request, usuario *Usuario, sesion *Sesion) {
+	if len(usuario.Sesiones) == 0 {
+		return
+	}
+	dispositivo := dispositivoDe(sesion.UserAgent)
+	ipNueva, dispositivoNuevo, paisNuevo, hayPaises := true, true, sesion.Pais != "", false
+	for _, s := range usuario.Sesiones {
+		ipNueva = ipNueva && s.IP != sesion.IP
+		dispositivoNuevo = dispositivoNuevo && dispositivoDe(s.UserAgent) != dispositivo
+		paisNuevo = paisNuevo && s.Pais != sesion.Pais
+		hayPaises = hayPaises || s.Pais != ""
+	}
+	if !ipNueva && !dispositivoNuevo && !(paisNuevo && hayPaises) {
+		return
+	}
+
+	token, err := valorAleatorio()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error generando el enlace para revocar la sesión", "error", err)
+		return
+	}
+	sesion.TokenRevocacion = hashToken(token)
+	enlace := config.URLPublica + prefijoAPI + "/sesiones/revocar?" + url.Values{"token": {token}}.Encode()
+	err = notificarUsuario(r.Context(), usuario, notificacionAlertasLogin, notificacion{
+		plantillaCorreo: plantillaCorreoAlertaLogin,
+		datosCorreo: datosAlertaLogin{
+			Pais: sesion.Pais, IP: sesion.IP, Dispositivo: sesion.UserAgent, Fecha: sesion.Fecha, Enlace: enlace,
+		},
+		plantillaSMS: plantillaSMSAlertaLogin,
+		datosSMS:     datosPlantillaSMS{Pais: sesion.Pais, Enlace: enlace},
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "No se pudo avisar al usuario del login nuevo", "correo", usuario.Correo, "error", err)
+	}
+}
+
+// sesionRevocada indica si el token pertenece a una sesión que el usuario
+// revocó. Se llama con el lock del usuario tomado.
+func sesionRevocada(claims jwt.MapClaims, usuario *Usuario) bool {
+	sid, _ := claims["sid"].(string)
+	_, revocada := usuario.SesionesRevocadas[sid]
+	return sid != "" && revocada
+}
+
+// revocarSesionHandler atiende el enlace del aviso de login nuevo: revoca
+// el token de esa sesión, sin tocar los demás del usuario, y cierra sus
+// conexiones en /ws y /eventos. El enlace sirve mientras el token de la
+// sesión no haya expirado.
+func revocarSesionHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el token de revocación", Codigo: "TOKEN_REQUERIDO"})
+		return
+	}
+
+	hash := hashToken(token)
+	conToken := func(s Sesion) bool { return s.TokenRevocacion == hash }
+	usuario, desbloquear := bloquearUsuarioDonde(func(u *Usuario) bool {
+		return slices.ContainsFunc(u.Sesiones, conToken)
+	})
+	defer desbloquear()
+	if usuario == nil {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Token de revocación inválido o expirado", Codigo: "TOKEN_INVALIDO"})
+		return
+	}
+	sesion := &usuario.Sesiones[slices.IndexFunc(usuario.Sesiones, conToken)]
+	vence := sesion.Fecha.Add(config.TokenTTL)
+	if time.Now().After(vence) {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Token de revocación inválido o expirado", Codigo: "TOKEN_INVALIDO"})
+		return
+	}
+
+	sesion.Revocada = true
+	sesion.TokenRevocacion = ""
+	if usuario.SesionesRevocadas == nil {
+		usuario.SesionesRevocadas = map[string]time.Time{}
+	}
+	maps.DeleteFunc(usuario.SesionesRevocadas, func(_ string, v time.Time) bool { return time.Now().After(v) })
+	usuario.SesionesRevocadas[sesion.ID] = vence
+	eventosSesion.publicar(usuario.ID, EventoSesion{
+		Tipo: eventoSesionRevocada, Fecha: time.Now(), Motivo: "revocada_por_alerta", Sesion: sesion.ID,
+	})
+	registrarEvento(usuario, "sesion_cerrada_por_alerta")
+	auditar(r, "sesion_revocada", usuario.Correo, "", "sesión "+sesion.ID)
+	slog.InfoContext(r.Context(), "Sesión revocada desde el aviso de login", "correo", usuario.Correo)
+
+	escribirJSON(w, http.StatusOK, MensajeResponse{Mensaje: "Sesión cerrada. Te recomendamos cambiar tu contraseña"})
+}
+
+// ListadoSesionesResponse define la respuesta paginada de
+// GET /perfil/sesiones.
+type ListadoSesionesResponse struct {
+	Sesiones []Sesion `json:"sesiones"`
+	Total    int      `json:"total"`
+	// Page falta al paginar con cursor.
+	Page  int `json:"page,omitempty"`
+	Limit int `json:"limit"`
+}
+
+// listarSesionesHandler devuelve los inicios de sesión recientes del
+// usuario autenticado, del más reciente al más antiguo, paginados con
+// cursor o page y limit (ver leerPaginacion).
+func listarSesionesHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := leerPaginacion(w, r.URL.Query())
+	if !ok {
+		return
+	}
+	// Las sesiones se ordenan por fecha y, si coincide, por ID, para que
+	// el orden, y con él los cursores, sea total.
+	comparar := func(a, b Sesion) int {
+		return cmp.Or(b.Fecha.Compare(a.Fecha), strings.Compare(b.ID, a.ID))
+	}
+	var despues func(Sesion) bool
+	if p.cursor != nil {
+		fecha, err := time.Parse(time.RFC3339Nano, p.cursor.Clave)
+		if err != nil {
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parámetro cursor inválido", Codigo: "PARAMETRO_INVALIDO"})
+			return
+		}
+		ultima := Sesion{ID: p.cursor.ID, Fecha: fecha}
+		despues = func(s Sesion) bool { return comparar(s, ultima) > 0 }
+	}
+
+	usuario := usuarioAutenticado(r)
+	desbloquear := usuario.bloquear()
+	sesiones := slices.SortedFunc(slices.Values(usuario.Sesiones), comparar)
+	desbloquear()
+
+	pagina, cursor := paginar(sesiones, p, despues, func(s Sesion) cursorListado {
+		return cursorListado{Clave: s.Fecha.Format(time.RFC3339Nano), ID: s.ID}
+	})
+	siguienteCursor(w, cursor)
+	escribirJSON(w, http.StatusOK, ListadoSesionesResponse{
+		Sesiones: pagina,
+		Total:    len(sesiones),
+		Page:     p.page,
+		Limit:    p.limit,
+	})
+}
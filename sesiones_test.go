@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// avisosLogin captura los correos enviados durante la prueba y devuelve
+// el token del último enlace para revocar una sesión, o "" si no hubo.
+func avisosLogin(t *testing.T) func() string {
+	t.Helper()
+	var ultimo string
+	antes := enviarCorreo
+	enviarCorreo = func(_ context.Context, m mensajeCorreo) error {
+		ultimo = m.Cuerpo
+		return nil
+	}
+	t.Cleanup(func() { enviarCorreo = antes })
+	enlace := regexp.MustCompile(`/sesiones/revocar\?(\S+)`)
+	return func() string {
+		coincidencia := enlace.FindStringSubmatch(ultimo)
+		ultimo = ""
+		if coincidencia == nil {
+			return ""
+		}
+		valores, err := url.ParseQuery(coincidencia[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return valores.Get("token")
+	}
+}
+
+// peticionLogin simula un login desde la IP, el navegador y el país
+// indicados.
+func peticionLogin(ip, userAgent, pais string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	r.RemoteAddr = ip + ":40000"
+	r.Header.Set("User-Agent", userAgent)
+	r.Header.Set("X-Pais", pais)
+	return r
+}
+
+// usarHeaderPais hace que el país del login se tome del header X-Pais.
+func usarHeaderPais(t *testing.T) {
+	t.Helper()
+	cfg := configSeguridadPorDefecto()
+	cfg.HeaderPais = "X-Pais"
+	antes := seguridad
+	seguridad = nuevoDetectorAnomalias(cfg)
+	t.Cleanup(func() { seguridad = antes })
+}
+
+func TestAvisoLoginNuevo(t *testing.T) {
+	usarHeaderPais(t)
+	aviso := avisosLogin(t)
+	const firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	casos := []struct {
+		nombre    string
+		historial bool
+		login     *http.Request
+		avisa     bool
+	}{
+		{"primer login", false, peticionLogin("203.0.113.7", firefox, "AR"), false},
+		{"lugar y dispositivo conocidos", true, peticionLogin("192.0.2.1", firefox, "MX"), false},
+		{"navegador actualizado", true, peticionLogin("192.0.2.1", strings.ReplaceAll(firefox, "128.0", "129.0.1"), "MX"), false},
+		{"IP nueva", true, peticionLogin("192.0.2.99", firefox, "MX"), true},
+		{"dispositivo nuevo", true, peticionLogin("192.0.2.1", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) Safari/604.1", "MX"), true},
+		{"país nuevo", true, peticionLogin("192.0.2.1", firefox, "AR"), true},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			u := usuarioFalso("ana@ejemplo.com", "Secreta@123")
+			if c.historial {
+				registrarSesion(u, peticionLogin("192.0.2.1", firefox, "MX"), []string{"pwd"}, nuevoID())
+			}
+			aviso()
+			registrarSesion(u, c.login, []string{"pwd"}, nuevoID())
+			token := aviso()
+			if (token != "") != c.avisa {
+				t.Errorf("aviso con enlace %v, se esperaba %v", token != "", c.avisa)
+			}
+			if ultima := u.Sesiones[len(u.Sesiones)-1]; (ultima.TokenRevocacion == hashToken(token)) != c.avisa {
+				t.Errorf("token de revocación guardado %q", ultima.TokenRevocacion)
+			}
+		})
+	}
+}
+
+func TestRevocarSesionDesdeElAviso(t *testing.T) {
+	prepararHandlers(t)
+	aviso := avisosLogin(t)
+	u := usuarioFalso("ana@ejemplo.com", "Secreta@123")
+	usarRepositorio(t, &repositorioFalso{usuarios: []*Usuario{u}})
+	login := func(ip, sesion string) string {
+		t.Helper()
+		token, err := generarToken(u, []string{"pwd"}, sesion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		registrarSesion(u, peticionLogin(ip, "Mozilla/5.0", ""), []string{"pwd"}, sesion)
+		return token
+	}
+	tokenConocida := login("192.0.2.1", "conocida")
+	tokenIntrusa := login("203.0.113.7", "intrusa")
+	enlace := aviso()
+	if enlace == "" {
+		t.Fatal("no se envió el aviso del login desde una IP nueva")
+	}
+	perfil := func(token string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/perfil", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		autenticado(obtenerPerfilHandler)(w, r)
+		return w.Code
+	}
+	revocar := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		revocarSesionHandler(w, httptest.NewRequest(http.MethodGet, "/sesiones/revocar?"+url.Values{"token": {token}}.Encode(), nil))
+		return w
+	}
+
+	eventos := eventosSesion.suscribir(u.ID)
+	defer eventosSesion.cancelar(u.ID, eventos)
+	if w := revocar(enlace); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if status := perfil(tokenIntrusa); status != http.StatusUnauthorized {
+		t.Errorf("token de la sesión revocada: status %d, se esperaba %d", status, http.StatusUnauthorized)
+	}
+	if status := perfil(tokenConocida); status != http.StatusOK {
+		t.Errorf("token de otra sesión: status %d, se esperaba %d", status, http.StatusOK)
+	}
+	if e := <-eventos; e.Tipo != eventoSesionRevocada || !e.paraSesion("intrusa") || e.paraSesion("conocida") {
+		t.Errorf("evento %+v, se esperaba el cierre de la sesión revocada", e)
+	}
+	if s := u.Sesiones[1]; !s.Revocada || s.TokenRevocacion != "" {
+		t.Errorf("sesión %+v, se esperaba revocada y sin token", s)
+	}
+
+	comprobarError(t, revocar(enlace), http.StatusBadRequest, ErrorResponse{Error: "Token de revocación inválido o expirado", Codigo: "TOKEN_INVALIDO"})
+	comprobarError(t, revocar(""), http.StatusBadRequest, ErrorResponse{Error: "Falta el token de revocación", Codigo: "TOKEN_REQUERIDO"})
+}
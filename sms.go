@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// remitenteSMS entrega mensajes de texto a un proveedor. Como con
+// remitenteCorreo, los errores definitivos se devuelven como permanentes.
+type remitenteSMS interface {
+	enviar(ctx context.Context, telefono, texto string) error
+}
+
+// proveedorSMS es el proveedor con el que se entregan los SMS; main lo
+// reemplaza al arrancar por el de SMS_PROVEEDOR.
+var proveedorSMS remitenteSMS = remitenteSMSConsola{}
+
+// Proveedores de SMS_PROVEEDOR.
+const (
+	proveedorSMSConsola = "consola"
+	proveedorSMSTwilio  = "twilio"
+)
+
+// Plantillas de los SMS. Cada una es un text/template que recibe
+// datosPlantillaSMS.
+const (
+	plantillaSMSVerificacion = "verificacion"
+	plantillaSMSLogin        = "login"
+	plantillaSMSAlertaLogin  = "alerta_login"
+)
+
+// datosPlantillaSMS son los datos con los que se completan las
+// plantillas.
+type datosPlantillaSMS struct {
+	Codigo  string
+	Minutos int
+	Pais    string
+	Enlace  string
+}
+
+// textosSMS son los textos por defecto de las plantillas.
+var textosSMS = map[string]string{
+	plantillaSMSVerificacion: "Tu código de verificación StratPlus es {{.Codigo}}. Vence en {{.Minutos}} minutos.",
+	plantillaSMSLogin:        "Tu código de inicio de sesión StratPlus es {{.Codigo}}. Vence en {{.Minutos}} minutos. Si no lo pediste, cambia tu contraseña.",
+	plantillaSMSAlertaLogin:  "StratPlus: nuevo inicio de sesión en tu cuenta{{if .Pais}} desde {{.Pais}}{{end}}. Si no fuiste tú, ciérrala: {{.Enlace}}",
+}
+
+// plantillasSMS son las plantillas con que se arman los SMS; main las
+// reemplaza al arrancar por las de la configuración. Los textos por
+// defecto son válidos, así que parsearlos no falla.
+var plantillasSMS, _ = parsearPlantillasSMS(nil)
+
+// ConfigSMS define el proveedor con el que se entregan los SMS y las
+// plantillas de los mensajes.
+type ConfigSMS struct {
+	Proveedor  string
+	Plantillas map[string]*template.Template
+}
+
+// cargarConfigSMS lee SMS_PROVEEDOR (consola o twilio; por defecto twilio
+// si está TWILIO_ACCOUNT_SID y, si no, consola) y SMS_PLANTILLA_LOGIN,
+// SMS_PLANTILLA_VERIFICACION y SMS_PLANTILLA_ALERTA_LOGIN, que reemplazan
+// los textos por defecto.
+func cargarConfigSMS() (ConfigSMS, error) {
+	cfg := ConfigSMS{Proveedor: strings.ToLower(opcion("SMS_PROVEEDOR"))}
+	switch cfg.Proveedor {
+	case "":
+		cfg.Proveedor = proveedorSMSConsola
+		if opcion("TWILIO_ACCOUNT_SID") != "" {
+			cfg.Proveedor = proveedorSMSTwilio
+		}
+	case proveedorSMSConsola, proveedorSMSTwilio:
+	default:
+		return cfg, fmt.Errorf("SMS_PROVEEDOR=%q: debe ser consola o twilio", cfg.Proveedor)
+	}
+	textos := map[string]string{}
+	for nombre := range textosSMS {
+		if v := opcion("SMS_PLANTILLA_" + strings.ToUpper(nombre)); v != "" {
+			textos[nombre] = v
+		}
+	}
+	var err error
+	cfg.Plantillas, err = parsearPlantillasSMS(textos)
+	return cfg, err
+}
+
+// parsearPlantillasSMS interpreta los textos por defecto, reemplazados
+// por los de textos. Cada plantilla se prueba con datos de ejemplo, para
+// que un campo inexistente falle al arrancar y no al enviar.
+func parsearPlantillasSMS(textos map[string]string) (map[string]*template.Template, error) {
+	plantillas := map[string]*template.Template{}
+	for nombre, texto := range textosSMS {
+		variable := "SMS_PLANTILLA_" + strings.ToUpper(nombre)
+		if v, ok := textos[nombre]; ok {
+			texto = v
+		}
+		t, err := template.New(nombre).Parse(texto)
+		if err == nil {
+			err = t.Execute(new(strings.Builder), datosPlantillaSMS{Codigo: "123456", Minutos: 10, Pais: "MX", Enlace: "https://ejemplo.com/sesiones/revocar?token=abc"})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", variable, err)
+		}
+		plantillas[nombre] = t
+	}
+	return plantillas, nil
+}
+
+// nuevoRemitenteSMS crea el remitente del proveedor, que lee además su
+// propia configuración (ver cargarConfigTwilio).
+func nuevoRemitenteSMS(cfg ConfigSMS) (remitenteSMS, error) {
+	if cfg.Proveedor == proveedorSMSTwilio {
+		twilio, err := cargarConfigTwilio()
+		if err != nil {
+			return nil, err
+		}
+		return nuevoRemitenteTwilio(twilio), nil
+	}
+	return remitenteSMSConsola{}, nil
+}
+
+// politicaSMS devuelve los reintentos del proveedor de SMS.
+func politicaSMS() PoliticaReintentos {
+	return politicaProveedor(proveedorSMS)
+}
+
+// remitenteSMSConsola escribe los SMS en la salida estándar, junto con el
+// request ID de ctx, para desarrollo.
+type remitenteSMSConsola struct{}
+
+func (remitenteSMSConsola) enviar(ctx context.Context, telefono, texto string) error {
+	fmt.Printf("SMS para %s [%s]: %s\n", telefono, requestIDDeContexto(ctx), texto)
+	return nil
+}
+
+// enviarSMS entrega un mensaje de texto al teléfono indicado con el
+// proveedor configurado.
+var enviarSMS = func(ctx context.Context, telefono, mensaje string) error {
+	ctx, span := iniciarSpan(ctx, "sms.enviar")
+	defer span.End()
+
+	return proveedorSMS.enviar(ctx, telefono, mensaje)
+}
+
+// limitadorSMS limita los SMS por teléfono de destino con la regla
+// sms_destino (LIMITE_SMS_DESTINO), para que no se pueda usar el servicio
+// para inundar un teléfono ni generar costos con el proveedor. nuevoRouter
+// lo asigna con el almacenamiento de los demás límites; sin él, como en
+// los comandos de administración, no se limita.
+var limitadorSMS *limitador
+
+// errorLimiteSMS indica que el teléfono recibió el máximo de SMS del
+// periodo; espera es cuánto falta para poder enviarle otro.
+type errorLimiteSMS struct {
+	espera time.Duration
+}
+
+func (e errorLimiteSMS) Error() string {
+	return fmt.Sprintf("límite de SMS del destino excedido; reintentar en %s", e.espera.Round(time.Second))
+}
+
+// datosSMS son los datos de una tarea de envío de SMS.
+type datosSMS struct {
+	Telefono string `json:"telefono"`
+	Mensaje  string `json:"mensaje"`
+}
+
+// encolarSMS arma el mensaje con la plantilla y lo envía en segundo plano,
+// con reintentos, para no demorar la petición. Devuelve error si el
+// destino excedió su límite (errorLimiteSMS) o no se pudo encolar.
+func encolarSMS(ctx context.Context, telefono, plantilla string, datos datosPlantillaSMS) error {
+	var mensaje strings.Builder
+	if err := plantillasSMS[plantilla].Execute(&mensaje, datos); err != nil {
+		return err
+	}
+	if limitadorSMS != nil {
+		if espera := limitadorSMS.consumir(ctx, "sms_destino", telefono); espera > 0 {
+			return errorLimiteSMS{espera}
+		}
+	}
+	return tareas.encolar(ctx, tareaSMS, datosSMS{Telefono: telefono, Mensaje: mensaje.String()})
+}
+
+// ejecutarTareaSMS envía el SMS de una tarea.
+func ejecutarTareaSMS(ctx context.Context, datos json.RawMessage) error {
+	var d datosSMS
+	if err := json.Unmarshal(datos, &d); err != nil {
+		return permanente(err)
+	}
+	return enviarSMS(ctx, d.Telefono, d.Mensaje)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Modos de cifrado de la conexión SMTP.
+const (
+	// tlsSMTPStartTLS conecta en claro y exige pasar a TLS con STARTTLS.
+	tlsSMTPStartTLS = "starttls"
+	// tlsSMTPImplicito conecta directamente con TLS (SMTPS).
+	tlsSMTPImplicito = "tls"
+	// tlsSMTPNinguno no cifra la conexión; sólo para servidores locales de
+	// desarrollo, como MailHog.
+	tlsSMTPNinguno = "ninguno"
+)
+
+// puertosSMTP es el puerto por defecto de cada modo de cifrado.
+var puertosSMTP = map[string]int{
+	tlsSMTPStartTLS:  587,
+	tlsSMTPImplicito: 465,
+	tlsSMTPNinguno:   25,
+}
+
+// ConfigSMTP define el servidor SMTP con el que se envían los correos.
+type ConfigSMTP struct {
+	Host     string
+	Puerto   int
+	TLS      string
+	Usuario  string
+	Password string
+}
+
+// cargarConfigSMTP lee SMTP_HOST (obligatorio), SMTP_TLS (starttls, tls o
+// ninguno; por defecto starttls), SMTP_PUERTO (por defecto 587, 465 o 25
+// según SMTP_TLS) y SMTP_USUARIO y SMTP_PASSWORD (credenciales
+// opcionales, con AUTH PLAIN).
+func cargarConfigSMTP() (ConfigSMTP, error) {
+	cfg := ConfigSMTP{
+		Host:     opcion("SMTP_HOST"),
+		TLS:      tlsSMTPStartTLS,
+		Usuario:  opcion("SMTP_USUARIO"),
+		Password: opcion("SMTP_PASSWORD"),
+	}
+	if cfg.Host == "" {
+		return cfg, errors.New("CORREO_PROVEEDOR=smtp requiere SMTP_HOST")
+	}
+	if v := opcion("SMTP_TLS"); v != "" {
+		if _, ok := puertosSMTP[strings.ToLower(v)]; !ok {
+			return cfg, fmt.Errorf("SMTP_TLS=%q: debe ser starttls, tls o ninguno", v)
+		}
+		cfg.TLS = strings.ToLower(v)
+	}
+	cfg.Puerto = puertosSMTP[cfg.TLS]
+	if v := opcion("SMTP_PUERTO"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 65535 {
+			return cfg, fmt.Errorf("SMTP_PUERTO=%q: debe ser un puerto entre 1 y 65535", v)
+		}
+		cfg.Puerto = n
+	}
+	if cfg.Usuario == "" && cfg.Password != "" {
+		return cfg, errors.New("SMTP_PASSWORD requiere SMTP_USUARIO")
+	}
+	// net/smtp sólo envía credenciales sin TLS a localhost.
+	if cfg.Usuario != "" && cfg.TLS == tlsSMTPNinguno && !slices.Contains([]string{"localhost", "127.0.0.1", "::1"}, cfg.Host) {
+		return cfg, errors.New("SMTP_USUARIO requiere SMTP_TLS=starttls o tls: sin cifrado las credenciales viajarían en claro")
+	}
+	return cfg, nil
+}
+
+// remitenteSMTP entrega los correos a un servidor SMTP, con una conexión
+// por correo. Los rechazos definitivos del servidor (códigos 5xx) se
+// marcan como permanentes para que la tarea no se reintente.
+type remitenteSMTP struct {
+	correo ConfigCorreo
+	cfg    ConfigSMTP
+}
+
+func (s remitenteSMTP) enviar(ctx context.Context, m mensajeCorreo) error {
+	mensaje, err := s.componer(m, time.Now())
+	if err != nil {
+		return permanente(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.correo.Timeout)
+	defer cancel()
+
+	direccion := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Puerto))
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	if s.cfg.TLS == tlsSMTPImplicito {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.cfg.Host}}).DialContext(ctx, "tcp", direccion)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", direccion)
+	}
+	if err != nil {
+		return fmt.Errorf("conectando con el servidor SMTP: %w", err)
+	}
+	// El plazo cubre toda la conversación, no sólo la conexión.
+	plazo, _ := ctx.Deadline()
+	conn.SetDeadline(plazo)
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return errorSMTP("saludo", err)
+	}
+	defer c.Close()
+
+	if s.cfg.TLS == tlsSMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return permanente(errors.New("el servidor SMTP no admite STARTTLS; usa SMTP_TLS=tls o ninguno"))
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return errorSMTP("STARTTLS", err)
+		}
+	}
+	if s.cfg.Usuario != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Usuario, s.cfg.Password, s.cfg.Host)); err != nil {
+			return errorSMTP("AUTH", err)
+		}
+	}
+	if err := c.Mail(s.correo.Remitente.Address); err != nil {
+		return errorSMTP("MAIL FROM", err)
+	}
+	if err := c.Rcpt(m.Destinatario); err != nil {
+		return errorSMTP("RCPT TO", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return errorSMTP("DATA", err)
+	}
+	if _, err := w.Write(mensaje); err != nil {
+		return errorSMTP("DATA", err)
+	}
+	if err := w.Close(); err != nil {
+		return errorSMTP("DATA", err)
+	}
+	return c.Quit()
+}
+
+// errorSMTP describe el error de un paso de la conversación y lo marca
+// como permanente si el servidor respondió con un código 5xx.
+func errorSMTP(paso string, err error) error {
+	err = fmt.Errorf("SMTP %s: %w", paso, err)
+	var respuesta *textproto.Error
+	if errors.As(err, &respuesta) && respuesta.Code >= 500 {
+		return permanente(err)
+	}
+	return err
+}
+
+// componer arma el mensaje en formato RFC 5322, con el cuerpo en texto
+// plano UTF-8 codificado como quoted-printable o, si hay versión HTML,
+// como multipart/alternative con las dos versiones. Rechaza los valores
+// con saltos de línea, que podrían inyectar headers.
+func (s remitenteSMTP) componer(m mensajeCorreo, fecha time.Time) ([]byte, error) {
+	if _, err := mail.ParseAddress(m.Destinatario); err != nil {
+		return nil, fmt.Errorf("destinatario inválido %q: %v", m.Destinatario, err)
+	}
+	id, err := valorAleatorio()
+	if err != nil {
+		return nil, err
+	}
+	dominio := s.correo.Remitente.Address[strings.LastIndex(s.correo.Remitente.Address, "@")+1:]
+
+	var cuerpo bytes.Buffer
+	tipo := "text/plain; charset=UTF-8"
+	if m.HTML == "" {
+		escribirQuotedPrintable(&cuerpo, m.Cuerpo)
+	} else {
+		partes := multipart.NewWriter(&cuerpo)
+		tipo = mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": partes.Boundary()})
+		// El orden importa: los clientes muestran la última versión que
+		// entienden.
+		for _, parte := range [][2]string{{"text/plain", m.Cuerpo}, {"text/html", m.HTML}} {
+			w, err := partes.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {parte[0] + "; charset=UTF-8"},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			if err != nil {
+				return nil, err
+			}
+			escribirQuotedPrintable(w, parte[1])
+		}
+		partes.Close()
+	}
+
+	headers := [][2]string{
+		{"From", s.correo.Remitente.String()},
+		{"To", m.Destinatario},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.Asunto)},
+		{"Date", fecha.Format(time.RFC1123Z)},
+		{"Message-ID", "<" + id + "@" + dominio + ">"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", tipo},
+	}
+	if m.HTML == "" {
+		headers = append(headers, [2]string{"Content-Transfer-Encoding", "quoted-printable"})
+	}
+	for _, clave := range slices.Sorted(maps.Keys(m.Headers)) {
+		headers = append(headers, [2]string{textproto.CanonicalMIMEHeaderKey(clave), m.Headers[clave]})
+	}
+
+	var b bytes.Buffer
+	for _, h := range headers {
+		if strings.ContainsAny(h[0]+h[1], "\r\n") {
+			return nil, fmt.Errorf("el header %s contiene un salto de línea", h[0])
+		}
+		fmt.Fprintf(&b, "%s: %s\r\n", h[0], h[1])
+	}
+	b.WriteString("\r\n")
+	b.Write(cuerpo.Bytes())
+	return b.Bytes(), nil
+}
+
+// escribirQuotedPrintable escribe texto en w codificado como
+// quoted-printable.
+func escribirQuotedPrintable(w io.Writer, texto string) {
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(texto))
+	qp.Close()
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// servidorSMTPFalso es un servidor SMTP mínimo, sin TLS, que guarda lo
+// que recibe. Responde a RCPT TO con rechazoRcpt, si no está vacío.
+type servidorSMTPFalso struct {
+	direccion   string
+	rechazoRcpt string
+	recibido    chan correoRecibido
+}
+
+// correoRecibido es lo que el servidor falso recibió en una conexión.
+type correoRecibido struct {
+	auth, mailFrom, rcptTo string
+	datos                  []byte
+}
+
+func nuevoServidorSMTPFalso(t *testing.T, rechazoRcpt string) *servidorSMTPFalso {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &servidorSMTPFalso{direccion: l.Addr().String(), rechazoRcpt: rechazoRcpt, recibido: make(chan correoRecibido, 1)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.atender(conn)
+		}
+	}()
+	return s
+}
+
+func (s *servidorSMTPFalso) atender(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	var r correoRecibido
+	tp.PrintfLine("220 prueba ESMTP")
+	for {
+		linea, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		comando, argumento, _ := strings.Cut(linea, " ")
+		switch strings.ToUpper(comando) {
+		case "EHLO":
+			tp.PrintfLine("250-prueba")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			r.auth = argumento
+			tp.PrintfLine("235 Autenticado")
+		case "MAIL":
+			r.mailFrom = argumento
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			if s.rechazoRcpt != "" {
+				tp.PrintfLine("%s", s.rechazoRcpt)
+				continue
+			}
+			r.rcptTo = argumento
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Adelante")
+			r.datos, _ = tp.ReadDotBytes()
+			tp.PrintfLine("250 OK")
+			s.recibido <- r
+		case "QUIT":
+			tp.PrintfLine("221 Adiós")
+			return
+		default:
+			tp.PrintfLine("502 No implementado")
+		}
+	}
+}
+
+// remitenteDe devuelve un remitente SMTP sin cifrado para el servidor
+// falso.
+func remitenteDe(t *testing.T, s *servidorSMTPFalso) remitenteSMTP {
+	t.Helper()
+	host, puerto, _ := net.SplitHostPort(s.direccion)
+	t.Setenv("SMTP_HOST", host)
+	t.Setenv("SMTP_PUERTO", puerto)
+	t.Setenv("SMTP_TLS", "ninguno")
+	t.Setenv("SMTP_USUARIO", "app")
+	t.Setenv("SMTP_PASSWORD", "secreta")
+	t.Setenv("CORREO_PROVEEDOR", "smtp")
+	t.Setenv("CORREO_REMITENTE", "StratPlus <no-responder@ejemplo.com>")
+	t.Setenv("CORREO_TIMEOUT", "5s")
+	correo, err := cargarConfigCorreo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := nuevoRemitenteCorreo(context.Background(), correo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.(remitenteSMTP)
+}
+
+func TestRemitenteSMTP(t *testing.T) {
+	s := nuevoServidorSMTPFalso(t, "")
+	cuerpo := "Hola, ¿cómo estás?\nAbre el enlace para verificar tu correo: " + strings.Repeat("x", 100)
+	err := remitenteDe(t, s).enviar(context.Background(), mensajeCorreo{
+		Destinatario: "ana@ejemplo.com",
+		Asunto:       "Verifica tu correo electrónico",
+		Cuerpo:       cuerpo,
+		Headers:      map[string]string{"x-request-id": "abc123"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r correoRecibido
+	select {
+	case r = <-s.recibido:
+	case <-time.After(5 * time.Second):
+		t.Fatal("el servidor no recibió el correo")
+	}
+	if auth, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(r.auth, "PLAIN ")); string(auth) != "\x00app\x00secreta" {
+		t.Errorf("AUTH %q, se esperaban las credenciales de SMTP_USUARIO y SMTP_PASSWORD", auth)
+	}
+	if r.mailFrom != "FROM:<no-responder@ejemplo.com>" || r.rcptTo != "TO:<ana@ejemplo.com>" {
+		t.Errorf("MAIL %q, RCPT %q", r.mailFrom, r.rcptTo)
+	}
+
+	m, err := mail.ReadMessage(strings.NewReader(string(r.datos)))
+	if err != nil {
+		t.Fatalf("mensaje ilegible: %v\n%s", err, r.datos)
+	}
+	asunto, _ := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	for _, h := range []struct{ nombre, recibido, esperado string }{
+		{"From", m.Header.Get("From"), `"StratPlus" <no-responder@ejemplo.com>`},
+		{"To", m.Header.Get("To"), "ana@ejemplo.com"},
+		{"Subject", asunto, "Verifica tu correo electrónico"},
+		{"X-Request-Id", m.Header.Get("X-Request-Id"), "abc123"},
+		{"Content-Type", m.Header.Get("Content-Type"), "text/plain; charset=UTF-8"},
+	} {
+		if h.recibido != h.esperado {
+			t.Errorf("%s %q, se esperaba %q", h.nombre, h.recibido, h.esperado)
+		}
+	}
+	if !strings.HasSuffix(m.Header.Get("Message-Id"), "@ejemplo.com>") {
+		t.Errorf("Message-ID %q, se esperaba del dominio del remitente", m.Header.Get("Message-Id"))
+	}
+	texto, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ReadDotBytes agrega un salto de línea al final.
+	if got := strings.TrimSuffix(strings.ReplaceAll(string(texto), "\r\n", "\n"), "\n"); got != cuerpo {
+		t.Errorf("cuerpo %q, se esperaba %q", got, cuerpo)
+	}
+}
+
+func TestRemitenteSMTPConHTML(t *testing.T) {
+	s := nuevoServidorSMTPFalso(t, "")
+	enviado := mensajeCorreo{
+		Destinatario: "ana@ejemplo.com",
+		Asunto:       "Verifica tu correo",
+		Cuerpo:       "Abre el enlace: https://ejemplo.com/v?token=abc",
+		HTML:         `<p>Abre <a href="https://ejemplo.com/v?token=abc">el enlace</a>. ¡Gracias!</p>`,
+	}
+	if err := remitenteDe(t, s).enviar(context.Background(), enviado); err != nil {
+		t.Fatal(err)
+	}
+
+	var r correoRecibido
+	select {
+	case r = <-s.recibido:
+	case <-time.After(5 * time.Second):
+		t.Fatal("el servidor no recibió el correo")
+	}
+	m, err := mail.ReadMessage(strings.NewReader(string(r.datos)))
+	if err != nil {
+		t.Fatalf("mensaje ilegible: %v\n%s", err, r.datos)
+	}
+	tipo, parametros, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || tipo != "multipart/alternative" {
+		t.Fatalf("Content-Type %q, se esperaba multipart/alternative", m.Header.Get("Content-Type"))
+	}
+
+	// El lector de multipart decodifica las partes quoted-printable.
+	partes := multipart.NewReader(m.Body, parametros["boundary"])
+	for _, esperada := range [][2]string{{"text/plain", enviado.Cuerpo}, {"text/html", enviado.HTML}} {
+		parte, err := partes.NextPart()
+		if err != nil {
+			t.Fatalf("falta la parte %s: %v", esperada[0], err)
+		}
+		if tipo := parte.Header.Get("Content-Type"); tipo != esperada[0]+"; charset=UTF-8" {
+			t.Errorf("Content-Type de la parte %q, se esperaba %s", tipo, esperada[0])
+		}
+		contenido, err := io.ReadAll(parte)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.ReplaceAll(string(contenido), "\r\n", "\n"); got != esperada[1] {
+			t.Errorf("parte %s %q, se esperaba %q", esperada[0], got, esperada[1])
+		}
+	}
+	if _, err := partes.NextPart(); err != io.EOF {
+		t.Errorf("se esperaban sólo dos partes, NextPart: %v", err)
+	}
+}
+
+func TestRemitenteSMTPRechazos(t *testing.T) {
+	casos := []struct {
+		respuesta  string
+		permanente bool
+	}{
+		{"550 El buzón no existe", true},
+		{"451 Intenta más tarde", false},
+	}
+	for _, c := range casos {
+		t.Run(c.respuesta, func(t *testing.T) {
+			s := nuevoServidorSMTPFalso(t, c.respuesta)
+			err := remitenteDe(t, s).enviar(context.Background(), mensajeCorreo{Destinatario: "ana@ejemplo.com", Asunto: "Hola", Cuerpo: "Hola"})
+			if err == nil {
+				t.Fatal("se esperaba un error")
+			}
+			if esPermanente := errors.As(err, new(errorPermanente)); esPermanente != c.permanente {
+				t.Errorf("error %v: permanente %t, se esperaba %t", err, esPermanente, c.permanente)
+			}
+		})
+	}
+
+	t.Run("salto de línea en un header", func(t *testing.T) {
+		s := nuevoServidorSMTPFalso(t, "")
+		err := remitenteDe(t, s).enviar(context.Background(), mensajeCorreo{
+			Destinatario: "ana@ejemplo.com",
+			Asunto:       "Hola",
+			Cuerpo:       "Hola",
+			Headers:      map[string]string{"x-request-id": "abc\r\nBcc: otro@ejemplo.com"},
+		})
+		if !errors.As(err, new(errorPermanente)) {
+			t.Errorf("error %v, se esperaba un error permanente", err)
+		}
+	})
+}
+
+func TestCargarConfigSMTP(t *testing.T) {
+	casos := []struct {
+		nombre string
+		env    map[string]string
+		error  string
+	}{
+		{"sin host", map[string]string{"SMTP_HOST": ""}, "SMTP_HOST"},
+		{"modo TLS desconocido", map[string]string{"SMTP_HOST": "smtp.ejemplo.com", "SMTP_TLS": "ssl"}, "SMTP_TLS"},
+		{"puerto inválido", map[string]string{"SMTP_HOST": "smtp.ejemplo.com", "SMTP_PUERTO": "0"}, "SMTP_PUERTO"},
+		{"password sin usuario", map[string]string{"SMTP_HOST": "smtp.ejemplo.com", "SMTP_PASSWORD": "x"}, "SMTP_USUARIO"},
+		{"credenciales sin cifrado", map[string]string{"SMTP_HOST": "smtp.ejemplo.com", "SMTP_TLS": "ninguno", "SMTP_USUARIO": "app"}, "SMTP_TLS"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			for nombre, valor := range c.env {
+				t.Setenv(nombre, valor)
+			}
+			if _, err := cargarConfigSMTP(); err == nil || !strings.Contains(err.Error(), c.error) {
+				t.Errorf("error %v, se esperaba uno sobre %s", err, c.error)
+			}
+		})
+	}
+
+	t.Setenv("SMTP_HOST", "smtp.ejemplo.com")
+	t.Setenv("SMTP_TLS", "TLS")
+	cfg, err := cargarConfigSMTP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TLS != tlsSMTPImplicito || cfg.Puerto != 465 {
+		t.Errorf("configuración %+v, se esperaba TLS implícito en el puerto 465", cfg)
+	}
+}
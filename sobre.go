@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Sobre es el formato común de las respuestas JSON de la API: data lleva
+// el resultado del endpoint y error el problema, y sólo uno de los dos
+// es distinto de null; meta lleva los datos de la petición.
+type Sobre struct {
+	Data  any         `json:"data"`
+	Error *ErrorSobre `json:"error"`
+	Meta  MetaSobre   `json:"meta"`
+}
+
+// ErrorSobre es el error de una respuesta de la API; tiene los mismos
+// campos que ErrorResponse, pero el código siempre está presente (ver
+// codigoStatus).
+type ErrorSobre struct {
+	Mensaje string       `json:"mensaje"`
+	Codigo  string       `json:"codigo"`
+	Errores []ErrorCampo `json:"errores,omitempty"`
+}
+
+// MetaSobre son los datos de la petición que acompañan a la respuesta.
+type MetaSobre struct {
+	// RequestID es el identificador de la petición, el mismo del header
+	// X-Request-ID y de los logs.
+	RequestID string `json:"request_id,omitempty"`
+	// NextCursor es, en los listados, el cursor de la siguiente página;
+	// falta en la última (ver paginar).
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// nuevoSobreError arma el sobre de una respuesta de error. Si el handler
+// no indicó el código, lleva el genérico de su status.
+func nuevoSobreError(r *http.Request, status int, e ErrorResponse) Sobre {
+	return Sobre{
+		Error: &ErrorSobre{Mensaje: e.Error, Codigo: cmp.Or(e.Codigo, codigoStatus(status)), Errores: e.Errores},
+		Meta:  MetaSobre{RequestID: requestID(r)},
+	}
+}
+
+// escribirErrorSobre responde un error en el sobre de la API o, si el
+// cliente lo pide, como application/problem+json (ver aceptaProblema). Lo
+// usan también los middlewares que contestan sin llegar al handler.
+func escribirErrorSobre(w http.ResponseWriter, r *http.Request, status int, e ErrorResponse) {
+	if aceptaProblema(r) {
+		escribirProblema(w, r, status, e)
+		return
+	}
+	escribirJSON(w, status, nuevoSobreError(r, status, e))
+}
+
+// conSobre envuelve en un Sobre la respuesta JSON del handler: el cuerpo
+// de las respuestas exitosas pasa a data y el ErrorResponse de las de
+// error, a error (o a un Problema, ver escribirErrorSobre). Las
+// respuestas sin cuerpo, las que no son JSON y los archivos adjuntos se
+// envían tal cual.
+func conSobre(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rs := &respuestaEnSobre{ResponseWriter: w}
+		next(rs, r)
+		rs.enviar(r)
+	}
+}
+
+// respuestaEnSobre guarda la respuesta del handler para envolverla al
+// terminar.
+type respuestaEnSobre struct {
+	http.ResponseWriter
+	status int
+	cuerpo bytes.Buffer
+	meta   MetaSobre
+}
+
+func (rs *respuestaEnSobre) WriteHeader(status int) {
+	if rs.status == 0 {
+		rs.status = status
+	}
+}
+
+func (rs *respuestaEnSobre) Write(b []byte) (int, error) {
+	rs.WriteHeader(http.StatusOK)
+	return rs.cuerpo.Write(b)
+}
+
+// enviar escribe la respuesta guardada, envuelta si corresponde.
+func (rs *respuestaEnSobre) enviar(r *http.Request) {
+	status := cmp.Or(rs.status, http.StatusOK)
+	datos := rs.cuerpo.Bytes()
+	h := rs.ResponseWriter.Header()
+
+	tipo, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	adjunto := strings.HasPrefix(h.Get("Content-Disposition"), "attachment")
+	if len(datos) == 0 || (tipo != tipoJSON && tipo != "") || adjunto || !json.Valid(datos) {
+		rs.ResponseWriter.WriteHeader(status)
+		rs.ResponseWriter.Write(datos)
+		return
+	}
+
+	h.Del("Content-Length")
+	if status >= http.StatusBadRequest {
+		var e ErrorResponse
+		json.Unmarshal(datos, &e)
+		escribirErrorSobre(rs.ResponseWriter, r, status, e)
+		return
+	}
+	rs.meta.RequestID = requestID(r)
+	escribirJSON(rs.ResponseWriter, status, Sobre{Data: json.RawMessage(datos), Meta: rs.meta})
+}
+
+// desenvolverSobre devuelve el contenido de un sobre en JSON: data, o el
+// error como ErrorResponse. Lo usan los formatos que no llevan sobre,
+// como Protobuf, cuyos mensajes son los del contenido.
+func desenvolverSobre(datos []byte) ([]byte, error) {
+	var sobre struct {
+		Data  json.RawMessage `json:"data"`
+		Error *ErrorSobre     `json:"error"`
+	}
+	if err := json.Unmarshal(datos, &sobre); err != nil {
+		return nil, err
+	}
+	if sobre.Error != nil {
+		return json.Marshal(ErrorResponse{Error: sobre.Error.Mensaje, Codigo: sobre.Error.Codigo, Errores: sobre.Error.Errores})
+	}
+	return sobre.Data, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+
+	"pruebasgo/usuariospb"
+)
+
+func TestSobre(t *testing.T) {
+	handler := requestIDMiddleware(idiomaMiddleware(negociarContenido("GET /perfil", conSobre(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("caso") {
+		case "error":
+			escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Cuerpo inválido", Codigo: "CUERPO_INVALIDO"})
+		case "adjunto":
+			w.Header().Set("Content-Disposition", `attachment; filename="mis-datos.json"`)
+			escribirJSON(w, http.StatusOK, PerfilResponse{Correo: "ana@ejemplo.com"})
+		case "vacio":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			escribirJSON(w, http.StatusOK, PerfilResponse{Correo: "ana@ejemplo.com"})
+		}
+	}))))
+	pedir := func(caso string, headers ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/perfil?caso="+caso, nil)
+		for i := 0; i < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	type sobrePerfil struct {
+		Data  *PerfilResponse `json:"data"`
+		Error *ErrorSobre     `json:"error"`
+		Meta  MetaSobre       `json:"meta"`
+	}
+
+	w := pedir("")
+	var exito sobrePerfil
+	decodificarRespuesta(t, w, &exito)
+	esperado := sobrePerfil{Data: &PerfilResponse{Correo: "ana@ejemplo.com"}, Meta: MetaSobre{RequestID: w.Header().Get(headerRequestID)}}
+	if exito.Meta.RequestID == "" || !reflect.DeepEqual(exito, esperado) {
+		t.Errorf("sobre %+v, se esperaba %+v", exito, esperado)
+	}
+
+	w = pedir("error", "Accept-Language", "en")
+	var fallo sobrePerfil
+	decodificarRespuesta(t, w, &fallo)
+	esperado = sobrePerfil{Error: &ErrorSobre{Mensaje: "Invalid body", Codigo: "CUERPO_INVALIDO"}, Meta: MetaSobre{RequestID: w.Header().Get(headerRequestID)}}
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(fallo, esperado) {
+		t.Errorf("status %d, sobre %+v, se esperaba %+v", w.Code, fallo, esperado)
+	}
+
+	w = pedir("adjunto")
+	var adjunto PerfilResponse
+	decodificarRespuesta(t, w, &adjunto)
+	if adjunto.Correo != "ana@ejemplo.com" {
+		t.Errorf("adjunto %+v, se esperaba sin sobre", adjunto)
+	}
+	if w = pedir("vacio"); w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("status %d con cuerpo %q, se esperaba 204 vacío", w.Code, w.Body)
+	}
+
+	// MessagePack lleva el sobre; Protobuf, sólo el contenido.
+	w = pedir("", "Accept", tipoMsgpack)
+	var enMsgpack map[string]any
+	if err := msgpack.Unmarshal(w.Body.Bytes(), &enMsgpack); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := enMsgpack["data"].(map[string]any); data["correo"] != "ana@ejemplo.com" || enMsgpack["error"] != nil {
+		t.Errorf("MessagePack %v, se esperaba el sobre", enMsgpack)
+	}
+	w = pedir("", "Accept", tipoProtobuf)
+	var perfil usuariospb.PerfilResponse
+	if err := proto.Unmarshal(w.Body.Bytes(), &perfil); err != nil || perfil.GetCorreo() != "ana@ejemplo.com" {
+		t.Errorf("Protobuf %v: %v", &perfil, err)
+	}
+	w = pedir("error", "Accept", tipoProtobuf)
+	var errorPB usuariospb.Error
+	if err := proto.Unmarshal(w.Body.Bytes(), &errorPB); err != nil || errorPB.GetError() != "Cuerpo inválido" || errorPB.GetCodigo() != "CUERPO_INVALIDO" {
+		t.Errorf("error en Protobuf %v: %v", &errorPB, err)
+	}
+}
+
+func TestSobreEnPanic(t *testing.T) {
+	handler := requestIDMiddleware(recuperacionMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("falla")
+	})))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/perfil", nil))
+	var sobre Sobre
+	if err := json.Unmarshal(w.Body.Bytes(), &sobre); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusInternalServerError || sobre.Data != nil || sobre.Error == nil ||
+		sobre.Error.Mensaje != "Error interno del servidor" || sobre.Meta.RequestID != w.Header().Get(headerRequestID) {
+		t.Errorf("status %d, sobre %s", w.Code, w.Body)
+	}
+}
+
+func TestProblemaJSON(t *testing.T) {
+	handler := requestIDMiddleware(idiomaMiddleware(negociarContenido("POST /registro", conSobre(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("caso") == "error" {
+			escribirJSON(w, http.StatusConflict, ErrorResponse{
+				Error:   "El correo ya se encuentra registrado",
+				Codigo:  "CORREO_DUPLICADO",
+				Errores: []ErrorCampo{{Campo: "correo", Codigo: codigoDuplicado, Mensaje: "El correo ya se encuentra registrado"}},
+			})
+			return
+		}
+		escribirJSON(w, http.StatusCreated, MensajeResponse{Mensaje: "Usuario registrado exitosamente"})
+	}))))
+	pedir := func(caso, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/registro?caso="+caso, nil)
+		r.Header.Set("Accept", accept)
+		r.Header.Set("Accept-Language", "en")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := pedir("error", "application/json, application/problem+json")
+	if tipo := w.Header().Get("Content-Type"); tipo != tipoProblema {
+		t.Fatalf("Content-Type %q, se esperaba %q: %s", tipo, tipoProblema, w.Body)
+	}
+	var problema Problema
+	if err := json.Unmarshal(w.Body.Bytes(), &problema); err != nil {
+		t.Fatal(err)
+	}
+	esperado := Problema{
+		Tipo: prefijoTipoProblema + "CORREO_DUPLICADO", Titulo: "Conflict", Status: http.StatusConflict,
+		Detalle: "The email is already registered", Instancia: "/api/v1/registro", Codigo: "CORREO_DUPLICADO",
+		Errores:   []ErrorCampo{{Campo: "correo", Codigo: codigoDuplicado, Mensaje: "The value of field correo is already registered"}},
+		RequestID: w.Header().Get(headerRequestID),
+	}
+	if w.Code != http.StatusConflict || !reflect.DeepEqual(problema, esperado) {
+		t.Errorf("status %d, problema %+v, se esperaba %+v", w.Code, problema, esperado)
+	}
+
+	// Sin pedirlo, o con q=0, el error va en el sobre; las respuestas
+	// exitosas siempre.
+	for _, accept := range []string{"application/json", "application/problem+json;q=0"} {
+		if w := pedir("error", accept); w.Header().Get("Content-Type") != tipoJSON {
+			t.Errorf("Accept %q: Content-Type %q", accept, w.Header().Get("Content-Type"))
+		}
+	}
+	if w := pedir("", tipoProblema); w.Code != http.StatusCreated || w.Header().Get("Content-Type") != tipoJSON {
+		t.Errorf("status %d, Content-Type %q en una respuesta exitosa", w.Code, w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// eventoSesionExpirada es el último evento que recibe una conexión a
+// /eventos cuando vence su token; como SSE no tiene códigos de cierre,
+// es la forma de avisar al cliente que debe volver a iniciar sesión.
+const eventoSesionExpirada = "sesion_expirada"
+
+// reintentoSSE es cuánto espera el navegador para reconectar si se corta
+// la conexión.
+const reintentoSSE = 5 * time.Second
+
+// conexionesSSE cuenta las conexiones abiertas en /eventos, para la
+// métrica sse_conexiones.
+var conexionesSSE atomic.Int64
+
+// eventosSSEHandler atiende GET /eventos: tras validar el token (ver
+// autenticarSuscripcion), mantiene abierta la respuesta como un flujo
+// text/event-stream por el que envía al usuario sus EventoSesion, con el
+// tipo como nombre del evento, sin necesidad de WebSockets. El flujo
+// termina después de un sesion_revocada o un sesion_expirada; la
+// reconexión automática del navegador recibe entonces 401.
+func eventosSSEHandler(w http.ResponseWriter, r *http.Request) {
+	usuario, expira, sesion, errServicio := autenticarSuscripcion(r)
+	if errServicio != nil {
+		responderErrorServicio(w, errServicio)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// El flujo dura lo que el token: no aplican los plazos de lectura y
+	// escritura del servidor. Con el de lectura vencido, net/http daría
+	// por cerrada la conexión y cancelaría la petición.
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", reintentoSSE.Milliseconds())
+	if err := rc.Flush(); err != nil {
+		slog.ErrorContext(r.Context(), "La respuesta no admite Server-Sent Events", "error", err)
+		return
+	}
+
+	eventosSesion.abiertas.Add(1)
+	defer eventosSesion.abiertas.Done()
+	conexionesSSE.Add(1)
+	defer conexionesSSE.Add(-1)
+	eventos := eventosSesion.suscribir(usuario.ID)
+	defer eventosSesion.cancelar(usuario.ID, eventos)
+	slog.InfoContext(r.Context(), "Conexión SSE abierta", "correo", usuario.correoActual())
+
+	aviso := time.NewTimer(time.Until(expira.Add(-avisoExpiracion())))
+	defer aviso.Stop()
+	expiracion := time.NewTimer(time.Until(expira))
+	defer expiracion.Stop()
+	ping := time.NewTicker(intervaloPingWS)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			slog.InfoContext(r.Context(), "Conexión SSE cerrada por el cliente")
+			return
+		case <-eventosSesion.cerrado:
+			return
+		case e, ok := <-eventos:
+			if !ok {
+				return
+			}
+			if !e.paraSesion(sesion) {
+				continue
+			}
+			if err := enviarEventoSSE(w, rc, e); err != nil || e.Tipo == eventoSesionRevocada {
+				return
+			}
+		case <-aviso.C:
+			if err := enviarEventoSSE(w, rc, EventoSesion{Tipo: eventoTokenPorExpirar, Fecha: time.Now(), Expira: &expira}); err != nil {
+				return
+			}
+		case <-expiracion.C:
+			enviarEventoSSE(w, rc, EventoSesion{Tipo: eventoSesionExpirada, Fecha: time.Now()})
+			return
+		case <-ping.C:
+			// Un comentario mantiene viva la conexión a través de proxies
+			// y detecta a los clientes que ya no están.
+			fmt.Fprint(w, ": ping\n\n")
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// enviarEventoSSE escribe el evento con su tipo como nombre y el JSON en
+// data.
+func enviarEventoSSE(w http.ResponseWriter, rc *http.ResponseController, e EventoSesion) error {
+	datos, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Tipo, datos); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
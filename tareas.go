@@ -0,0 +1,735 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Tipos de tarea que se ejecutan en segundo plano.
+const (
+	tareaCorreo  = "correo"
+	tareaSMS     = "sms"
+	tareaWebhook = "webhook"
+)
+
+// Claves de Redis de la cola: una lista con las tareas listas para
+// ejecutarse, un sorted set con las que esperan un reintento, con la
+// fecha en milisegundos como score, y una lista con las fallidas.
+const (
+	claveTareasPendientes  = "tareas:pendientes"
+	claveTareasProgramadas = "tareas:programadas"
+	claveTareasFallidas    = "tareas:fallidas"
+)
+
+// PoliticaReintentos define cuántas veces se reintenta una tarea fallida
+// y cuánto se espera entre intentos.
+type PoliticaReintentos struct {
+	Reintentos int
+	Backoff    time.Duration
+	BackoffMax time.Duration
+}
+
+// espera devuelve la espera antes del reintento siguiente al intento:
+// Backoff·2^intento, como mucho BackoffMax, con una variación aleatoria
+// de hasta ±25% para que los reintentos de varias tareas no coincidan.
+func (p PoliticaReintentos) espera(intento int) time.Duration {
+	espera := p.BackoffMax
+	if intento < 30 && p.Backoff<<intento < p.BackoffMax {
+		espera = p.Backoff << intento
+	}
+	variacion := int64(espera / 4)
+	if variacion > 0 {
+		espera += time.Duration(rand.Int64N(2*variacion) - variacion)
+	}
+	return espera
+}
+
+// ConfigTareas define la cola y los trabajadores de las tareas en
+// segundo plano.
+type ConfigTareas struct {
+	Backend      string
+	RedisURL     string
+	Trabajadores int
+	Capacidad    int
+	MaxFallidas  int
+	TiempoCierre time.Duration
+	PoliticaReintentos
+}
+
+// cargarConfigTareas lee TAREAS_BACKEND (memoria, por defecto, o redis;
+// el backend Redis usa REDIS_URL), TAREAS_TRABAJADORES (tareas que se
+// ejecutan a la vez, por defecto 4), TAREAS_CAPACIDAD (tareas que pueden
+// esperar en la cola en memoria, por defecto 1000), TAREAS_FALLIDAS_MAX
+// (tareas fallidas que se conservan, por defecto 1000), TAREAS_REINTENTOS,
+// TAREAS_BACKOFF y TAREAS_BACKOFF_MAX (por defecto 5, 1s y 5m, como los
+// webhooks) y TAREAS_TIEMPO_CIERRE (plazo para terminar las tareas al
+// apagar, por defecto 10s).
+func cargarConfigTareas() (ConfigTareas, error) {
+	cfg := ConfigTareas{
+		Backend:      strings.ToLower(strings.TrimSpace(opcion("TAREAS_BACKEND"))),
+		Trabajadores: 4,
+		Capacidad:    1000,
+		MaxFallidas:  1000,
+		TiempoCierre: 10 * time.Second,
+		PoliticaReintentos: PoliticaReintentos{
+			Reintentos: 5,
+			Backoff:    time.Second,
+			BackoffMax: 5 * time.Minute,
+		},
+	}
+	switch cfg.Backend {
+	case "":
+		cfg.Backend = "memoria"
+	case "memoria":
+	case "redis":
+		cfg.RedisURL = opcion("REDIS_URL")
+		if cfg.RedisURL == "" {
+			return cfg, errors.New("TAREAS_BACKEND=redis requiere REDIS_URL")
+		}
+	default:
+		return cfg, fmt.Errorf("TAREAS_BACKEND=%q: debe ser memoria o redis", cfg.Backend)
+	}
+	if n, err := strconv.Atoi(opcion("TAREAS_TRABAJADORES")); err == nil && n > 0 {
+		cfg.Trabajadores = n
+	}
+	if n, err := strconv.Atoi(opcion("TAREAS_CAPACIDAD")); err == nil && n > 0 {
+		cfg.Capacidad = n
+	}
+	if n, err := strconv.Atoi(opcion("TAREAS_FALLIDAS_MAX")); err == nil && n > 0 {
+		cfg.MaxFallidas = n
+	}
+	if n, err := strconv.Atoi(opcion("TAREAS_REINTENTOS")); err == nil && n >= 0 {
+		cfg.Reintentos = n
+	}
+	if d, err := time.ParseDuration(opcion("TAREAS_BACKOFF")); err == nil && d > 0 {
+		cfg.Backoff = d
+	}
+	if d, err := time.ParseDuration(opcion("TAREAS_BACKOFF_MAX")); err == nil && d > 0 {
+		cfg.BackoffMax = d
+	}
+	if d, err := time.ParseDuration(opcion("TAREAS_TIEMPO_CIERRE")); err == nil && d > 0 {
+		cfg.TiempoCierre = d
+	}
+	return cfg, nil
+}
+
+// Tarea es un trabajo en la cola. Se guarda como JSON para que pueda
+// viajar por Redis y ejecutarse en cualquier instancia.
+type Tarea struct {
+	ID      string          `json:"id"`
+	Tipo    string          `json:"tipo"`
+	Datos   json.RawMessage `json:"datos"`
+	Intento int             `json:"intento"`
+	// Metadatos son el request ID y la traza de la petición que originó
+	// la tarea, para correlacionar sus logs y spans.
+	Metadatos map[string]string `json:"metadatos,omitempty"`
+}
+
+// TareaFallida es una tarea que agotó sus reintentos o falló con un error
+// permanente. Espera en la cola de fallidas (dead-letter) a que un
+// administrador la vuelva a encolar.
+type TareaFallida struct {
+	Tarea Tarea     `json:"tarea"`
+	Error string    `json:"error"`
+	Fecha time.Time `json:"fecha"`
+}
+
+// tipoTarea sabe ejecutar las tareas de un tipo.
+type tipoTarea struct {
+	ejecutar func(ctx context.Context, datos json.RawMessage) error
+	// politica devuelve los reintentos propios del tipo; si es nil se
+	// usan los de TAREAS_*.
+	politica func() PoliticaReintentos
+	// terminada, si no es nil, se llama cuando la tarea se completa (err
+	// nil) o falla sin más reintentos.
+	terminada func(ctx context.Context, datos json.RawMessage, err error)
+}
+
+// tiposTarea son las tareas que ejecutan los trabajadores.
+var tiposTarea = map[string]tipoTarea{
+	tareaCorreo:  {ejecutar: ejecutarTareaCorreo, politica: politicaCorreo},
+	tareaSMS:     {ejecutar: ejecutarTareaSMS, politica: politicaSMS},
+	tareaWebhook: {ejecutar: ejecutarTareaWebhook, politica: politicaWebhooks, terminada: webhookTerminado},
+}
+
+// errorPermanente marca un error que no se resuelve reintentando, como un
+// rechazo definitivo del destino o datos que no se pueden decodificar.
+type errorPermanente struct{ error }
+
+func (e errorPermanente) Unwrap() error { return e.error }
+
+// permanente envuelve err para que la tarea no se reintente.
+func permanente(err error) error {
+	return errorPermanente{err}
+}
+
+// errorReintentarDespues marca un error transitorio tras el cual el
+// destino pidió esperar, como un 429 con Retry-After.
+type errorReintentarDespues struct {
+	error
+	espera time.Duration
+}
+
+func (e errorReintentarDespues) Unwrap() error { return e.error }
+
+// reintentarDespues envuelve err para que el próximo intento espere al
+// menos espera, aunque el backoff sea menor.
+func reintentarDespues(err error, espera time.Duration) error {
+	return errorReintentarDespues{err, espera}
+}
+
+// conReintentos lo implementan los proveedores de correo o SMS con
+// reintentos propios, que reemplazan a los de TAREAS_*.
+type conReintentos interface {
+	politicaReintentos() PoliticaReintentos
+}
+
+// politicaProveedor devuelve los reintentos del proveedor o, si no tiene
+// propios, los de TAREAS_*.
+func politicaProveedor(proveedor any) PoliticaReintentos {
+	if p, ok := proveedor.(conReintentos); ok {
+		return p.politicaReintentos()
+	}
+	return tareas.cfg.PoliticaReintentos
+}
+
+// errColaLlena indica que la cola en memoria no admite más tareas.
+var errColaLlena = errors.New("cola de tareas llena")
+
+// colaTareas guarda las tareas pendientes en memoria o en Redis.
+type colaTareas interface {
+	// encolar agrega una tarea lista para ejecutarse.
+	encolar(ctx context.Context, t Tarea) error
+	// programar agrega una tarea que se ejecutará tras la espera.
+	programar(ctx context.Context, t Tarea, espera time.Duration) error
+	// tomar espera la siguiente tarea hasta que se cancele ctx. Las
+	// tareas que ya están en la cola en memoria se devuelven aunque ctx
+	// esté cancelado, para terminarlas al apagar.
+	tomar(ctx context.Context) (Tarea, error)
+	// pendientes cuenta las tareas que se perderían al apagar.
+	pendientes() int
+	// archivar agrega una tarea a las fallidas; si ya hay MaxFallidas,
+	// descarta la más antigua.
+	archivar(ctx context.Context, f TareaFallida) error
+	// fallidas devuelve las tareas fallidas, de la más reciente a la más
+	// antigua.
+	fallidas(ctx context.Context) ([]TareaFallida, error)
+	// contarFallidas cuenta las tareas fallidas.
+	contarFallidas(ctx context.Context) (int, error)
+	// recuperar quita de las fallidas la tarea con el ID y la devuelve.
+	recuperar(ctx context.Context, id string) (TareaFallida, bool, error)
+}
+
+// trabajadoresTareas ejecuta las tareas de la cola en segundo plano,
+// con reintentos y backoff exponencial, para que los handlers no esperen
+// a que se envíen correos, SMS o webhooks.
+type trabajadoresTareas struct {
+	cfg   ConfigTareas
+	cola  colaTareas
+	redis *redis.Client
+
+	// tomando se cancela al apagar para que los trabajadores dejen de
+	// tomar tareas; ejecutando, si se agota el plazo, para abortar las
+	// que siguen en curso.
+	tomando, ejecutando               context.Context
+	dejarDeTomar, cancelarEjecuciones context.CancelFunc
+	trabajadores                      sync.WaitGroup
+	cerrarUnaVez                      sync.Once
+}
+
+// tareasEnCurso cuenta las tareas que se están ejecutando, para la
+// métrica tareas_en_curso.
+var tareasEnCurso atomic.Int64
+
+// tareas son los trabajadores del servicio; main los reemplaza al
+// arrancar por unos con la configuración de cargarConfigTareas. Sin
+// trabajadores, como en los comandos de administración, las tareas se
+// ejecutan al encolarse, una sola vez.
+var tareas = &trabajadoresTareas{}
+
+// nuevosTrabajadoresTareas crea la cola configurada y arranca los
+// trabajadores.
+func nuevosTrabajadoresTareas(cfg ConfigTareas) (*trabajadoresTareas, error) {
+	t := &trabajadoresTareas{cfg: cfg}
+	switch cfg.Backend {
+	case "redis":
+		opciones, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		t.redis = redis.NewClient(opciones)
+		t.cola = &colaRedis{cliente: t.redis, maxFallidas: cfg.MaxFallidas}
+	default:
+		t.cola = &colaMemoria{listas: make(chan Tarea, cfg.Capacidad), maxFallidas: cfg.MaxFallidas}
+	}
+	t.tomando, t.dejarDeTomar = context.WithCancel(context.Background())
+	t.ejecutando, t.cancelarEjecuciones = context.WithCancel(context.Background())
+	for range cfg.Trabajadores {
+		t.trabajadores.Add(1)
+		go t.trabajar()
+	}
+	return t, nil
+}
+
+// encolar agrega una tarea del tipo indicado con datos codificados en
+// JSON. El request ID y la traza de ctx se conservan para la ejecución.
+// Devuelve error si la tarea no se pudo encolar; los errores al
+// ejecutarla sólo quedan en el log y en las métricas.
+func (t *trabajadoresTareas) encolar(ctx context.Context, tipo string, datos any) error {
+	codificados, err := json.Marshal(datos)
+	if err != nil {
+		return err
+	}
+	tarea := Tarea{ID: nuevoID(), Tipo: tipo, Datos: codificados, Metadatos: metadatosCorrelacion(ctx)}
+	if t.cola == nil {
+		return tiposTarea[tipo].ejecutar(ctx, codificados)
+	}
+	if err := t.cola.encolar(ctx, tarea); err != nil {
+		metricaTareas.WithLabelValues(tipo, "descartada").Inc()
+		return err
+	}
+	return nil
+}
+
+// trabajar ejecuta las tareas de la cola hasta que se cierran los
+// trabajadores. Si la cola falla, como cuando Redis no responde, espera
+// un segundo antes de volver a intentarlo.
+func (t *trabajadoresTareas) trabajar() {
+	defer t.trabajadores.Done()
+	for {
+		tarea, err := t.cola.tomar(t.tomando)
+		if t.tomando.Err() != nil && err != nil {
+			return
+		}
+		if err != nil {
+			slog.Error("Error tomando una tarea de la cola", "error", err)
+			select {
+			case <-time.After(time.Second):
+			case <-t.tomando.Done():
+				return
+			}
+			continue
+		}
+		t.ejecutar(tarea)
+	}
+}
+
+// contextoTarea devuelve un contexto con el request ID y la traza de la
+// petición que originó la tarea.
+func contextoTarea(ctx context.Context, tarea Tarea) context.Context {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(tarea.Metadatos))
+	if id := tarea.Metadatos[headerRequestID]; id != "" {
+		ctx = context.WithValue(ctx, claveRequestID, id)
+	}
+	return ctx
+}
+
+// ejecutar hace un intento de la tarea y, si falla con un error que no
+// es permanente y le quedan reintentos, la vuelve a programar.
+func (t *trabajadoresTareas) ejecutar(tarea Tarea) {
+	ctx, span := iniciarSpan(contextoTarea(t.ejecutando, tarea), "tarea."+tarea.Tipo)
+	defer span.End()
+	tipo, ok := tiposTarea[tarea.Tipo]
+	if !ok {
+		slog.ErrorContext(ctx, "Tarea de tipo desconocido", "tipo", tarea.Tipo, "id", tarea.ID)
+		metricaTareas.WithLabelValues(tarea.Tipo, "fallida").Inc()
+		// Puede venir de una instancia más nueva: se archiva para
+		// reintentarla cuando todas la conozcan.
+		t.archivar(ctx, tarea, errors.New("tipo de tarea desconocido"))
+		return
+	}
+	politica := t.cfg.PoliticaReintentos
+	if tipo.politica != nil {
+		politica = tipo.politica()
+	}
+
+	tareasEnCurso.Add(1)
+	err := tipo.ejecutar(ctx, tarea.Datos)
+	tareasEnCurso.Add(-1)
+
+	if err != nil && !errors.As(err, new(errorPermanente)) && tarea.Intento < politica.Reintentos {
+		espera := politica.espera(tarea.Intento)
+		var pedida errorReintentarDespues
+		if errors.As(err, &pedida) {
+			espera = max(espera, pedida.espera)
+		}
+		tarea.Intento++
+		slog.WarnContext(ctx, "Error ejecutando la tarea; se reintentará", "tipo", tarea.Tipo, "id", tarea.ID, "intento", tarea.Intento, "espera", espera.String(), "error", err)
+		metricaTareas.WithLabelValues(tarea.Tipo, "reintentada").Inc()
+		errProgramar := t.cola.programar(ctx, tarea, espera)
+		if errProgramar == nil {
+			return
+		}
+		slog.ErrorContext(ctx, "Error reprogramando la tarea", "tipo", tarea.Tipo, "id", tarea.ID, "error", errProgramar)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Tarea fallida", "tipo", tarea.Tipo, "id", tarea.ID, "intentos", tarea.Intento+1, "error", err)
+		metricaTareas.WithLabelValues(tarea.Tipo, "fallida").Inc()
+		t.archivar(ctx, tarea, err)
+	} else {
+		slog.DebugContext(ctx, "Tarea completada", "tipo", tarea.Tipo, "id", tarea.ID, "intentos", tarea.Intento+1)
+		metricaTareas.WithLabelValues(tarea.Tipo, "completada").Inc()
+	}
+	if tipo.terminada != nil {
+		tipo.terminada(ctx, tarea.Datos, err)
+	}
+}
+
+// archivar guarda la tarea en las fallidas. Si no puede, sólo queda en el
+// log.
+func (t *trabajadoresTareas) archivar(ctx context.Context, tarea Tarea, err error) {
+	f := TareaFallida{Tarea: tarea, Error: err.Error(), Fecha: time.Now()}
+	if errArchivar := t.cola.archivar(context.WithoutCancel(ctx), f); errArchivar != nil {
+		slog.ErrorContext(ctx, "Error archivando la tarea fallida", "tipo", tarea.Tipo, "id", tarea.ID, "error", errArchivar)
+	}
+}
+
+// fallidas devuelve las tareas fallidas. Sin trabajadores no hay.
+func (t *trabajadoresTareas) fallidas(ctx context.Context) ([]TareaFallida, error) {
+	if t.cola == nil {
+		return nil, nil
+	}
+	return t.cola.fallidas(ctx)
+}
+
+// contarFallidas cuenta las tareas fallidas, para la métrica
+// tareas_fallidas.
+func (t *trabajadoresTareas) contarFallidas(ctx context.Context) (int, error) {
+	if t.cola == nil {
+		return 0, nil
+	}
+	return t.cola.contarFallidas(ctx)
+}
+
+// reintentarFallida quita la tarea id de las fallidas y la vuelve a
+// encolar con todos sus reintentos. Devuelve false si no está entre las
+// fallidas; si no se puede encolar, la tarea vuelve a ellas.
+func (t *trabajadoresTareas) reintentarFallida(ctx context.Context, id string) (Tarea, bool, error) {
+	if t.cola == nil {
+		return Tarea{}, false, nil
+	}
+	f, ok, err := t.cola.recuperar(ctx, id)
+	if err != nil || !ok {
+		return Tarea{}, false, err
+	}
+	f.Tarea.Intento = 0
+	if err := t.cola.encolar(ctx, f.Tarea); err != nil {
+		if errArchivar := t.cola.archivar(context.WithoutCancel(ctx), f); errArchivar != nil {
+			slog.ErrorContext(ctx, "Error devolviendo la tarea a las fallidas", "tipo", f.Tarea.Tipo, "id", id, "error", errArchivar)
+		}
+		return Tarea{}, false, err
+	}
+	metricaTareas.WithLabelValues(f.Tarea.Tipo, "recuperada").Inc()
+	return f.Tarea, true, nil
+}
+
+// cerrar deja de tomar tareas nuevas y espera, como mucho
+// cfg.TiempoCierre, a que terminen las que están en curso y, con la cola
+// en memoria, las que siguen en ella. Al agotarse el plazo cancela las
+// que falten. Las tareas en memoria que esperan un reintento se pierden;
+// en Redis quedan para la próxima instancia que arranque.
+func (t *trabajadoresTareas) cerrar() {
+	if t.cola == nil {
+		return
+	}
+	t.cerrarUnaVez.Do(t.dejarDeTomar)
+	terminados := make(chan struct{})
+	go func() {
+		t.trabajadores.Wait()
+		close(terminados)
+	}()
+	select {
+	case <-terminados:
+	case <-time.After(t.cfg.TiempoCierre):
+		slog.Warn("Tareas sin terminar al apagar")
+		t.cancelarEjecuciones()
+	}
+	if pendientes := t.cola.pendientes(); pendientes > 0 {
+		slog.Warn("Tareas sin ejecutar al apagar", "tareas", pendientes)
+	}
+}
+
+// chequeos devuelve la verificación de readiness del backend Redis, si se
+// usa.
+func (t *trabajadoresTareas) chequeos() []chequeoListo {
+	if t.redis == nil {
+		return nil
+	}
+	return []chequeoListo{{nombre: "redis_tareas", verificar: func(ctx context.Context) error {
+		return t.redis.Ping(ctx).Err()
+	}}}
+}
+
+// colaMemoria guarda las tareas en un canal del proceso.
+type colaMemoria struct {
+	listas chan Tarea
+	// programadas cuenta las tareas que esperan un reintento.
+	programadas atomic.Int64
+
+	mu          sync.Mutex
+	archivadas  []TareaFallida
+	maxFallidas int
+}
+
+func (c *colaMemoria) encolar(_ context.Context, t Tarea) error {
+	select {
+	case c.listas <- t:
+		return nil
+	default:
+		return errColaLlena
+	}
+}
+
+func (c *colaMemoria) programar(_ context.Context, t Tarea, espera time.Duration) error {
+	c.programadas.Add(1)
+	time.AfterFunc(espera, func() {
+		c.programadas.Add(-1)
+		if err := c.encolar(context.Background(), t); err != nil {
+			slog.Error("Cola de tareas llena; se descarta el reintento", "tipo", t.Tipo, "id", t.ID)
+			metricaTareas.WithLabelValues(t.Tipo, "descartada").Inc()
+		}
+	})
+	return nil
+}
+
+func (c *colaMemoria) tomar(ctx context.Context) (Tarea, error) {
+	select {
+	case t := <-c.listas:
+		return t, nil
+	default:
+	}
+	select {
+	case t := <-c.listas:
+		return t, nil
+	case <-ctx.Done():
+		return Tarea{}, ctx.Err()
+	}
+}
+
+func (c *colaMemoria) pendientes() int {
+	return len(c.listas) + int(c.programadas.Load())
+}
+
+func (c *colaMemoria) archivar(_ context.Context, f TareaFallida) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.archivadas = append(c.archivadas, f)
+	if len(c.archivadas) > c.maxFallidas {
+		c.archivadas = slices.Delete(c.archivadas, 0, len(c.archivadas)-c.maxFallidas)
+	}
+	return nil
+}
+
+func (c *colaMemoria) fallidas(context.Context) ([]TareaFallida, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fallidas := slices.Clone(c.archivadas)
+	slices.Reverse(fallidas)
+	return fallidas, nil
+}
+
+func (c *colaMemoria) contarFallidas(context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.archivadas), nil
+}
+
+func (c *colaMemoria) recuperar(_ context.Context, id string) (TareaFallida, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := slices.IndexFunc(c.archivadas, func(f TareaFallida) bool { return f.Tarea.ID == id })
+	if i < 0 {
+		return TareaFallida{}, false, nil
+	}
+	f := c.archivadas[i]
+	c.archivadas = slices.Delete(c.archivadas, i, i+1)
+	return f, true, nil
+}
+
+// colaRedis guarda las tareas en Redis, donde las comparten todas las
+// instancias y sobreviven a un reinicio. Una tarea que se está
+// ejecutando cuando el proceso muere sin apagado ordenado se pierde.
+type colaRedis struct {
+	cliente     *redis.Client
+	maxFallidas int
+}
+
+// scriptMoverProgramadas pasa a la lista de pendientes las tareas
+// programadas cuyo reintento ya venció.
+var scriptMoverProgramadas = redis.NewScript(`
+local vencidas = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, v in ipairs(vencidas) do
+  redis.call('ZREM', KEYS[1], v)
+  redis.call('LPUSH', KEYS[2], v)
+end
+return #vencidas
+`)
+
+func (c *colaRedis) encolar(ctx context.Context, t Tarea) error {
+	datos, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return c.cliente.LPush(ctx, claveTareasPendientes, datos).Err()
+}
+
+func (c *colaRedis) programar(ctx context.Context, t Tarea, espera time.Duration) error {
+	datos, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	cuando := float64(time.Now().Add(espera).UnixMilli())
+	return c.cliente.ZAdd(context.WithoutCancel(ctx), claveTareasProgramadas, redis.Z{Score: cuando, Member: datos}).Err()
+}
+
+func (c *colaRedis) tomar(ctx context.Context) (Tarea, error) {
+	for {
+		ahora := time.Now().UnixMilli()
+		if err := scriptMoverProgramadas.Run(ctx, c.cliente, []string{claveTareasProgramadas, claveTareasPendientes}, ahora).Err(); err != nil {
+			return Tarea{}, err
+		}
+		res, err := c.cliente.BRPop(ctx, time.Second, claveTareasPendientes).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return Tarea{}, err
+		}
+		var t Tarea
+		if err := json.Unmarshal([]byte(res[1]), &t); err != nil {
+			slog.Error("Tarea inválida en Redis; se descarta", "error", err)
+			continue
+		}
+		return t, nil
+	}
+}
+
+// pendientes es 0: las tareas de Redis no se pierden al apagar.
+func (c *colaRedis) pendientes() int {
+	return 0
+}
+
+func (c *colaRedis) archivar(ctx context.Context, f TareaFallida) error {
+	datos, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	_, err = c.cliente.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.LPush(ctx, claveTareasFallidas, datos)
+		p.LTrim(ctx, claveTareasFallidas, 0, int64(c.maxFallidas)-1)
+		return nil
+	})
+	return err
+}
+
+// fallidasRedis lee las tareas fallidas junto con su JSON, que identifica
+// el elemento de la lista al quitarlo.
+func (c *colaRedis) fallidasRedis(ctx context.Context) ([]TareaFallida, []string, error) {
+	valores, err := c.cliente.LRange(ctx, claveTareasFallidas, 0, -1).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	fallidas := make([]TareaFallida, 0, len(valores))
+	crudas := make([]string, 0, len(valores))
+	for _, v := range valores {
+		var f TareaFallida
+		if err := json.Unmarshal([]byte(v), &f); err != nil {
+			slog.Error("Tarea fallida inválida en Redis; se omite", "error", err)
+			continue
+		}
+		fallidas = append(fallidas, f)
+		crudas = append(crudas, v)
+	}
+	return fallidas, crudas, nil
+}
+
+func (c *colaRedis) fallidas(ctx context.Context) ([]TareaFallida, error) {
+	fallidas, _, err := c.fallidasRedis(ctx)
+	return fallidas, err
+}
+
+func (c *colaRedis) contarFallidas(ctx context.Context) (int, error) {
+	n, err := c.cliente.LLen(ctx, claveTareasFallidas).Result()
+	return int(n), err
+}
+
+// recuperar quita la tarea con LREM, de modo que si dos instancias la
+// reintentan a la vez sólo una la encola.
+func (c *colaRedis) recuperar(ctx context.Context, id string) (TareaFallida, bool, error) {
+	fallidas, crudas, err := c.fallidasRedis(ctx)
+	if err != nil {
+		return TareaFallida{}, false, err
+	}
+	i := slices.IndexFunc(fallidas, func(f TareaFallida) bool { return f.Tarea.ID == id })
+	if i < 0 {
+		return TareaFallida{}, false, nil
+	}
+	quitadas, err := c.cliente.LRem(ctx, claveTareasFallidas, 1, crudas[i]).Result()
+	if err != nil || quitadas == 0 {
+		return TareaFallida{}, false, err
+	}
+	return fallidas[i], true, nil
+}
+
+// TareaFallidaResponse describe una tarea fallida en GET
+// /admin/tareas/fallidas. No incluye los datos de la tarea, que pueden
+// llevar enlaces y códigos de verificación.
+type TareaFallidaResponse struct {
+	ID       string    `json:"id"`
+	Tipo     string    `json:"tipo"`
+	Intentos int       `json:"intentos"`
+	Error    string    `json:"error"`
+	Fecha    time.Time `json:"fecha"`
+}
+
+// listarTareasFallidasHandler devuelve las tareas fallidas, de la más
+// reciente a la más antigua.
+func listarTareasFallidasHandler(w http.ResponseWriter, r *http.Request) {
+	fallidas, err := tareas.fallidas(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error consultando las tareas fallidas", "error", err)
+		escribirJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "No se pudo consultar la cola de tareas", Codigo: "COLA_NO_DISPONIBLE"})
+		return
+	}
+	resp := make([]TareaFallidaResponse, 0, len(fallidas))
+	for _, f := range fallidas {
+		resp = append(resp, TareaFallidaResponse{
+			ID: f.Tarea.ID, Tipo: f.Tarea.Tipo, Intentos: f.Tarea.Intento + 1, Error: f.Error, Fecha: f.Fecha,
+		})
+	}
+	escribirJSON(w, http.StatusOK, resp)
+}
+
+// reintentarTareaFallidaHandler vuelve a encolar la tarea fallida {id},
+// p. ej. cuando el proveedor de correo que estaba caído se recupera.
+func reintentarTareaFallidaHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	tarea, ok, err := tareas.reintentarFallida(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error reintentando la tarea fallida", "id", id, "error", err)
+		escribirJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "No se pudo consultar la cola de tareas", Codigo: "COLA_NO_DISPONIBLE"})
+		return
+	}
+	if !ok {
+		escribirJSON(w, http.StatusNotFound, ErrorResponse{Error: "Tarea no encontrada", Codigo: "TAREA_NO_ENCONTRADA"})
+		return
+	}
+	slog.InfoContext(r.Context(), "Tarea fallida encolada de nuevo", "tipo", tarea.Tipo, "id", id)
+	auditar(r, "tarea_reintentada", correoAutenticado(r), "", tarea.Tipo+" "+id)
+	escribirJSON(w, http.StatusAccepted, MensajeResponse{Mensaje: "Tarea encolada"})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTareasFallidas(t *testing.T) {
+	probarTareasFallidas(t, ConfigTareas{Backend: "memoria"})
+}
+
+// probarTareasFallidas comprueba con la cola de cfg que las tareas que
+// agotan sus reintentos queden en las fallidas, hasta cfg.MaxFallidas, y
+// que un administrador pueda volver a encolarlas.
+func probarTareasFallidas(t *testing.T, cfg ConfigTareas) {
+	prepararHandlers(t)
+	var caido atomic.Bool
+	caido.Store(true)
+	terminadas := make(chan error, 10)
+	tiposTarea["prueba"] = tipoTarea{
+		ejecutar: func(context.Context, json.RawMessage) error {
+			if caido.Load() {
+				return errors.New("proveedor caído")
+			}
+			return nil
+		},
+		terminada: func(_ context.Context, _ json.RawMessage, err error) { terminadas <- err },
+	}
+	t.Cleanup(func() { delete(tiposTarea, "prueba") })
+
+	cfg.Trabajadores, cfg.Capacidad, cfg.MaxFallidas, cfg.TiempoCierre = 1, 10, 2, time.Second
+	cfg.PoliticaReintentos = PoliticaReintentos{Reintentos: 1, Backoff: time.Millisecond, BackoffMax: time.Millisecond}
+	trabajadores, err := nuevosTrabajadoresTareas(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	antes := tareas
+	tareas = trabajadores
+	t.Cleanup(func() {
+		trabajadores.cerrar()
+		tareas = antes
+	})
+	esperar := func() error {
+		t.Helper()
+		select {
+		case err := <-terminadas:
+			return err
+		case <-time.After(10 * time.Second):
+			t.Fatal("la tarea no terminó")
+			return nil
+		}
+	}
+
+	ctx := context.Background()
+	for range 3 {
+		if err := tareas.encolar(ctx, "prueba", "datos"); err != nil {
+			t.Fatal(err)
+		}
+		if err := esperar(); err == nil {
+			t.Fatal("la tarea no falló con el proveedor caído")
+		}
+	}
+
+	w := httptest.NewRecorder()
+	listarTareasFallidasHandler(w, httptest.NewRequest(http.MethodGet, "/admin/tareas/fallidas", nil))
+	var fallidas []TareaFallidaResponse
+	decodificarRespuesta(t, w, &fallidas)
+	// La primera se descartó al llegar la tercera.
+	if len(fallidas) != 2 {
+		t.Fatalf("tareas fallidas %+v, se esperaban 2", fallidas)
+	}
+	if f := fallidas[0]; f.Tipo != "prueba" || f.Intentos != 2 || f.Error != "proveedor caído" {
+		t.Errorf("tarea fallida %+v", f)
+	}
+	if n, _ := tareas.contarFallidas(ctx); n != 2 {
+		t.Errorf("%d tareas fallidas contadas, se esperaban 2", n)
+	}
+
+	reintentar := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/admin/tareas/fallidas/"+id+"/reintentar", nil)
+		r.SetPathValue("id", id)
+		reintentarTareaFallidaHandler(w, r)
+		return w
+	}
+	caido.Store(false)
+	if w := reintentar(fallidas[0].ID); w.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if err := esperar(); err != nil {
+		t.Errorf("la tarea reintentada falló: %v", err)
+	}
+	if n, _ := tareas.contarFallidas(ctx); n != 1 {
+		t.Errorf("%d tareas fallidas tras el reintento, se esperaba 1", n)
+	}
+	comprobarError(t, reintentar(fallidas[0].ID), http.StatusNotFound, ErrorResponse{Error: "Tarea no encontrada", Codigo: "TAREA_NO_ENCONTRADA"})
+}
@@ -0,0 +1,184 @@
+// Package testutil genera datos de prueba para las pruebas del servicio:
+// usuarios con correo, teléfono y contraseña aleatorios que pasan las
+// validaciones del registro, y helpers que los registran e inician
+// sesión para obtener un token. Los helpers llaman a la API, así que
+// sirven igual con el router en memoria de las pruebas del paquete main
+// que con un servidor en marcha, como el de las pruebas e2e:
+//
+//	api := testutil.Handler(router)
+//	usuario, token := api.UsuarioConToken(t)
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// PrefijoAPI es el prefijo de versión de los endpoints.
+const PrefijoAPI = "/api/v1"
+
+// Usuario son los datos con los que se registra una cuenta de prueba.
+type Usuario struct {
+	Correo   string
+	Telefono string
+	Password string
+}
+
+// telefonos numera los teléfonos generados a partir de un inicio al azar,
+// para que no se repitan en el proceso ni, muy probablemente, con los de
+// una ejecución anterior contra el mismo servidor.
+var telefonos atomic.Int64
+
+func init() {
+	telefonos.Store(rand.Int64N(1e8))
+}
+
+// Caracteres con los que se arman las contraseñas. Los especiales son los
+// de la política por defecto del servicio.
+const (
+	mayusculas = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	minusculas = "abcdefghijkmnpqrstuvwxyz"
+	numeros    = "23456789"
+	especiales = "@$&"
+)
+
+// NuevoUsuario devuelve un usuario que no está registrado, válido con la
+// configuración por defecto: el teléfono es un número de la Ciudad de
+// México (PAIS_TELEFONO=MX) y la contraseña, de 10 caracteres, tiene
+// mayúsculas, minúsculas, números y un carácter especial.
+func NuevoUsuario() Usuario {
+	return Usuario{
+		Correo:   fmt.Sprintf("prueba-%016x@ejemplo.com", rand.Uint64()),
+		Telefono: fmt.Sprintf("55%08d", telefonos.Add(1)%1e8),
+		Password: NuevaPassword(),
+	}
+}
+
+// NuevaPassword devuelve una contraseña aleatoria que cumple la política
+// por defecto.
+func NuevaPassword() string {
+	password := []byte{azar(mayusculas), azar(minusculas), azar(numeros), azar(especiales)}
+	for len(password) < 10 {
+		password = append(password, azar(mayusculas+minusculas+numeros))
+	}
+	rand.Shuffle(len(password), func(i, j int) { password[i], password[j] = password[j], password[i] })
+	return string(password)
+}
+
+func azar(caracteres string) byte {
+	return caracteres[rand.IntN(len(caracteres))]
+}
+
+// Registro es el cuerpo de POST /registro con los datos del usuario.
+func (u Usuario) Registro() map[string]string {
+	return map[string]string{"correo": u.Correo, "telefono": u.Telefono, "password": u.Password}
+}
+
+// Login es el cuerpo de POST /login con las credenciales del usuario.
+func (u Usuario) Login() map[string]string {
+	return map[string]string{"correo": u.Correo, "password": u.Password}
+}
+
+// API es la API contra la que los helpers registran usuarios e inician
+// sesión.
+type API struct {
+	atender func(*http.Request) (*http.Response, error)
+	base    string
+}
+
+// Handler atiende las peticiones de los helpers con h, en memoria, como
+// las pruebas del paquete main con el router.
+func Handler(h http.Handler) *API {
+	return &API{atender: func(r *http.Request) (*http.Response, error) {
+		// httptest.NewRequest completa lo que el servidor llena al recibir
+		// una petición, como RemoteAddr.
+		req := httptest.NewRequest(r.Method, r.URL.String(), r.Body)
+		req.Header = r.Header
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result(), nil
+	}}
+}
+
+// Servidor envía las peticiones de los helpers al servidor en marcha de
+// la URL base, como las pruebas e2e.
+func Servidor(base string) *API {
+	cliente := &http.Client{Timeout: 10 * time.Second}
+	return &API{atender: cliente.Do, base: strings.TrimSuffix(base, "/")}
+}
+
+// Registrar da de alta al usuario con POST /registro. Falla la prueba si
+// no responde 201.
+func (a *API) Registrar(tb testing.TB, u Usuario) {
+	tb.Helper()
+	a.enviar(tb, http.MethodPost, "/registro", u.Registro(), http.StatusCreated, nil)
+}
+
+// Token inicia sesión con POST /login y devuelve el token. Falla la
+// prueba si no responde 200 o la respuesta no trae token.
+func (a *API) Token(tb testing.TB, u Usuario) string {
+	tb.Helper()
+	var sesion struct {
+		Token string `json:"token"`
+	}
+	a.enviar(tb, http.MethodPost, "/login", u.Login(), http.StatusOK, &sesion)
+	if sesion.Token == "" {
+		tb.Fatalf("login de %s sin token", u.Correo)
+	}
+	return sesion.Token
+}
+
+// UsuarioConToken registra un usuario nuevo e inicia sesión con él.
+func (a *API) UsuarioConToken(tb testing.TB) (Usuario, string) {
+	tb.Helper()
+	u := NuevoUsuario()
+	a.Registrar(tb, u)
+	return u, a.Token(tb, u)
+}
+
+// enviar envía cuerpo como JSON, comprueba el status y decodifica el
+// data del sobre de la respuesta en destino, si no es nil.
+func (a *API) enviar(tb testing.TB, metodo, ruta string, cuerpo any, status int, destino any) {
+	tb.Helper()
+	datos, err := json.Marshal(cuerpo)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	req, err := http.NewRequest(metodo, a.base+PrefijoAPI+ruta, bytes.NewReader(datos))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.atender(req)
+	if err != nil {
+		tb.Fatalf("%s %s: %v", metodo, ruta, err)
+	}
+	defer resp.Body.Close()
+	respuesta, err := io.ReadAll(resp.Body)
+	if err != nil {
+		tb.Fatalf("%s %s: %v", metodo, ruta, err)
+	}
+	if resp.StatusCode != status {
+		tb.Fatalf("%s %s: status %d, se esperaba %d: %s", metodo, ruta, resp.StatusCode, status, respuesta)
+	}
+	if destino != nil {
+		var sobre struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(respuesta, &sobre); err != nil {
+			tb.Fatalf("%s %s: respuesta %s: %v", metodo, ruta, respuesta, err)
+		}
+		if err := json.Unmarshal(sobre.Data, destino); err != nil {
+			tb.Fatalf("%s %s: respuesta %s: %v", metodo, ruta, respuesta, err)
+		}
+	}
+}
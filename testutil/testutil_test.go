@@ -0,0 +1,49 @@
+package testutil
+
+import (
+	"net/http"
+	"testing"
+
+	"pruebasgo/validacion"
+)
+
+func TestNuevoUsuarioEsValido(t *testing.T) {
+	// La política por defecto del servicio.
+	politica := validacion.PoliticaPassword{LongitudMinima: 6, LongitudMaxima: 12, Especiales: "@$&"}
+	correos, telefonos := map[string]bool{}, map[string]bool{}
+	for range 1000 {
+		u := NuevoUsuario()
+		if err := validacion.Correo(u.Correo, validacion.OpcionesCorreo{}); err != nil {
+			t.Errorf("correo %q: %v", u.Correo, err)
+		}
+		telefono, err := validacion.Telefono(u.Telefono, "MX")
+		if err != nil {
+			t.Errorf("teléfono %q: %v", u.Telefono, err)
+		}
+		if err := validacion.Password(u.Password, politica); err != nil {
+			t.Errorf("contraseña %q: %v", u.Password, err)
+		}
+		if correos[u.Correo] || telefonos[telefono] {
+			t.Errorf("%+v repite el correo o el teléfono de otro usuario", u)
+		}
+		correos[u.Correo], telefonos[telefono] = true, true
+	}
+}
+
+func TestUsuarioConToken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+PrefijoAPI+"/registro", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("POST "+PrefijoAPI+"/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"token":"abc"},"error":null,"meta":{}}`))
+	})
+
+	u, token := Handler(mux).UsuarioConToken(t)
+	if token != "abc" {
+		t.Errorf("token %q, se esperaba abc", token)
+	}
+	if u.Correo == "" || u.Telefono == "" || u.Password == "" {
+		t.Errorf("usuario incompleto: %+v", u)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// nombreServicio identifica al servicio en las trazas si no se define
+// OTEL_SERVICE_NAME.
+const nombreServicio = "pruebasgo"
+
+// tracer crea los spans del servicio. Mientras no se configure un
+// exportador los spans no se registran, pero el contexto de traza
+// entrante se sigue propagando.
+var tracer = otel.Tracer(nombreServicio)
+
+// configurarTrazas instala el propagador W3C (traceparent y baggage) y,
+// si se definió OTEL_EXPORTER_OTLP_ENDPOINT (o su variante
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT), un exportador OTLP/HTTP compatible
+// con Jaeger, Tempo o un OpenTelemetry Collector. El resto de la
+// configuración (muestreo, headers, recurso) se toma de las variables
+// OTEL_* estándar. Devuelve la función que vacía los spans pendientes al
+// apagar.
+func configurarTrazas(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exportador, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recurso, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(nombreServicio)))
+	if err != nil {
+		return nil, err
+	}
+	// resource.Default ya incluye OTEL_SERVICE_NAME y OTEL_RESOURCE_ATTRIBUTES;
+	// se vuelve a aplicar el entorno para que tenga prioridad sobre el
+	// nombre por defecto.
+	if entorno, err := resource.New(ctx, resource.WithFromEnv()); err == nil {
+		if r, err := resource.Merge(recurso, entorno); err == nil {
+			recurso = r
+		}
+	}
+
+	proveedor := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exportador),
+		sdktrace.WithResource(recurso),
+	)
+	otel.SetTracerProvider(proveedor)
+	return proveedor.Shutdown, nil
+}
+
+// trazasMiddleware crea un span de servidor por petición, continuando la
+// traza indicada en el header traceparent si viene uno. Al terminar
+// renombra el span con el patrón de la ruta que atendió la petición y
+// lo marca como error si la respuesta fue 5xx.
+func trazasMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				attribute.String("http.request_id", requestID(r)),
+			))
+		defer span.End()
+
+		rw := &respuestaRegistrada{ResponseWriter: w}
+		r = r.WithContext(ctx)
+		next.ServeHTTP(rw, r)
+
+		if r.Pattern != "" {
+			span.SetName(r.Pattern)
+			span.SetAttributes(semconv.HTTPRoute(rutaDePatron(r.Pattern)))
+		}
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// iniciarSpan crea un span hijo para una operación interna (acceso a
+// datos, envío de correo, llamadas a otros servicios). El llamador debe
+// cerrar el span con End.
+func iniciarSpan(ctx context.Context, nombre string, atributos ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, nombre, trace.WithAttributes(atributos...))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigTwilio define la cuenta de Twilio con la que se envían los SMS.
+type ConfigTwilio struct {
+	AccountSID string
+	AuthToken  string
+	// Remitente es el número (E.164) o el Messaging Service (MG...) desde
+	// el que se envían los mensajes.
+	Remitente string
+	URL       string
+	Timeout   time.Duration
+}
+
+// cargarConfigTwilio lee TWILIO_ACCOUNT_SID y TWILIO_AUTH_TOKEN
+// (obligatorias), TWILIO_REMITENTE (obligatoria: número en formato
+// E.164, p. ej. +525512345678, o SID de un Messaging Service, MG...),
+// TWILIO_TIMEOUT (por defecto 10s) y TWILIO_URL (URL base de la API, por
+// defecto https://api.twilio.com).
+func cargarConfigTwilio() (ConfigTwilio, error) {
+	cfg := ConfigTwilio{
+		AccountSID: opcion("TWILIO_ACCOUNT_SID"),
+		AuthToken:  opcion("TWILIO_AUTH_TOKEN"),
+		Remitente:  opcion("TWILIO_REMITENTE"),
+		URL:        "https://api.twilio.com",
+		Timeout:    10 * time.Second,
+	}
+	if cfg.AccountSID == "" || cfg.AuthToken == "" {
+		return cfg, errors.New("SMS_PROVEEDOR=twilio requiere TWILIO_ACCOUNT_SID y TWILIO_AUTH_TOKEN")
+	}
+	if !strings.HasPrefix(cfg.Remitente, "+") && !strings.HasPrefix(cfg.Remitente, "MG") {
+		return cfg, fmt.Errorf("TWILIO_REMITENTE=%q: debe ser un número E.164 (+525512345678) o el SID de un Messaging Service (MG...)", cfg.Remitente)
+	}
+	if v := opcion("TWILIO_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("TWILIO_TIMEOUT=%q: debe ser una duración positiva, p. ej. 10s", v)
+		}
+		cfg.Timeout = d
+	}
+	if v := opcion("TWILIO_URL"); v != "" {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return cfg, fmt.Errorf("TWILIO_URL=%q: debe ser una URL http o https absoluta", v)
+		}
+		cfg.URL = strings.TrimSuffix(v, "/")
+	}
+	return cfg, nil
+}
+
+// remitenteTwilio envía los SMS con la API de mensajes de Twilio. Los
+// errores de red, 429 y 5xx se reintentan; los demás status de error no,
+// porque Twilio rechazó el mensaje o la cuenta (número inválido, destino
+// bloqueado, credenciales incorrectas, ...).
+type remitenteTwilio struct {
+	cfg     ConfigTwilio
+	cliente *http.Client
+}
+
+func nuevoRemitenteTwilio(cfg ConfigTwilio) remitenteTwilio {
+	return remitenteTwilio{cfg: cfg, cliente: nuevoClienteHTTP(cfg.Timeout)}
+}
+
+// politicaReintentos: los SMS llevan códigos que vencen en minutos, así
+// que no tiene sentido reintentar mucho más allá.
+func (remitenteTwilio) politicaReintentos() PoliticaReintentos {
+	return PoliticaReintentos{Reintentos: 3, Backoff: 10 * time.Second, BackoffMax: 2 * time.Minute}
+}
+
+func (s remitenteTwilio) enviar(ctx context.Context, telefono, texto string) error {
+	formulario := url.Values{"To": {telefono}, "Body": {texto}}
+	if strings.HasPrefix(s.cfg.Remitente, "MG") {
+		formulario.Set("MessagingServiceSid", s.cfg.Remitente)
+	} else {
+		formulario.Set("From", s.cfg.Remitente)
+	}
+	ruta := s.cfg.URL + "/2010-04-01/Accounts/" + url.PathEscape(s.cfg.AccountSID) + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ruta, strings.NewReader(formulario.Encode()))
+	if err != nil {
+		return permanente(err)
+	}
+	req.SetBasicAuth(s.cfg.AccountSID, s.cfg.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.cliente.Do(req)
+	if err != nil {
+		return fmt.Errorf("Twilio: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("Twilio respondió %d: %s", resp.StatusCode, mensajeErrorTwilio(resp.Body))
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		segundos, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return reintentarDespues(err, time.Duration(max(segundos, 0))*time.Second)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return err
+	}
+	return permanente(err)
+}
+
+// mensajeErrorTwilio extrae el código y el mensaje de una respuesta de
+// error de Twilio, {"code":21211,"message":"..."}, o devuelve el cuerpo
+// tal cual si no tiene esa forma.
+func mensajeErrorTwilio(cuerpo io.Reader) string {
+	datos, _ := io.ReadAll(io.LimitReader(cuerpo, 4096))
+	var respuesta struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(datos, &respuesta) != nil || respuesta.Message == "" {
+		return strings.TrimSpace(string(datos))
+	}
+	return fmt.Sprintf("%s (código %d)", respuesta.Message, respuesta.Code)
+}
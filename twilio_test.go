@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// remitenteTwilioDe devuelve un remitente de Twilio contra un servidor de
+// prueba que atiende con h.
+func remitenteTwilioDe(t *testing.T, h http.HandlerFunc) remitenteTwilio {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	t.Setenv("SMS_PROVEEDOR", "")
+	t.Setenv("TWILIO_ACCOUNT_SID", "ACprueba")
+	t.Setenv("TWILIO_AUTH_TOKEN", "secreto")
+	t.Setenv("TWILIO_REMITENTE", "+15005550006")
+	t.Setenv("TWILIO_URL", srv.URL)
+	cfg, err := cargarConfigSMS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := nuevoRemitenteSMS(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.(remitenteTwilio)
+}
+
+func TestRemitenteTwilio(t *testing.T) {
+	s := remitenteTwilioDe(t, func(w http.ResponseWriter, r *http.Request) {
+		usuario, password, _ := r.BasicAuth()
+		if r.Method != http.MethodPost || r.URL.Path != "/2010-04-01/Accounts/ACprueba/Messages.json" || usuario != "ACprueba" || password != "secreto" {
+			t.Errorf("%s %s con usuario %q", r.Method, r.URL.Path, usuario)
+		}
+		if r.FormValue("To") != "+525512345678" || r.FormValue("From") != "+15005550006" || r.FormValue("Body") != "Hola" {
+			t.Errorf("formulario %v", r.Form)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid":"SM123","status":"queued"}`))
+	})
+	if err := s.enviar(context.Background(), "+525512345678", "Hola"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemitenteTwilioErrores(t *testing.T) {
+	casos := []struct {
+		nombre     string
+		status     int
+		retryAfter string
+		cuerpo     string
+		permanente bool
+		espera     time.Duration
+		mensaje    string
+	}{
+		{"número inválido", http.StatusBadRequest, "", `{"code":21211,"message":"Invalid 'To' Phone Number","status":400}`, true, 0, "Invalid 'To' Phone Number (código 21211)"},
+		{"credenciales incorrectas", http.StatusUnauthorized, "", `{"code":20003,"message":"Authenticate","status":401}`, true, 0, "código 20003"},
+		{"caída", http.StatusServiceUnavailable, "", "", false, 0, "503"},
+		{"límite", http.StatusTooManyRequests, "30", `{"code":20429,"message":"Too Many Requests","status":429}`, false, 30 * time.Second, "código 20429"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			s := remitenteTwilioDe(t, func(w http.ResponseWriter, r *http.Request) {
+				if c.retryAfter != "" {
+					w.Header().Set("Retry-After", c.retryAfter)
+				}
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.cuerpo))
+			})
+			err := s.enviar(context.Background(), "+525512345678", "Hola")
+			if err == nil || !strings.Contains(err.Error(), c.mensaje) {
+				t.Fatalf("error %v, se esperaba uno con %q", err, c.mensaje)
+			}
+			if esPermanente := errors.As(err, new(errorPermanente)); esPermanente != c.permanente {
+				t.Errorf("error %v: permanente %t, se esperaba %t", err, esPermanente, c.permanente)
+			}
+			var pedida errorReintentarDespues
+			errors.As(err, &pedida)
+			if pedida.espera != c.espera {
+				t.Errorf("espera %v, se esperaba %v", pedida.espera, c.espera)
+			}
+		})
+	}
+}
+
+func TestCargarConfigSMS(t *testing.T) {
+	casos := []struct {
+		nombre string
+		env    map[string]string
+		error  string
+	}{
+		{"proveedor desconocido", map[string]string{"SMS_PROVEEDOR": "sns"}, "SMS_PROVEEDOR"},
+		{"plantilla inválida", map[string]string{"SMS_PLANTILLA_LOGIN": "Tu código es {{.Codigo"}, "SMS_PLANTILLA_LOGIN"},
+		{"campo inexistente", map[string]string{"SMS_PLANTILLA_VERIFICACION": "Código: {{.Clave}}"}, "SMS_PLANTILLA_VERIFICACION"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			for nombre, valor := range c.env {
+				t.Setenv(nombre, valor)
+			}
+			if _, err := cargarConfigSMS(); err == nil || !strings.Contains(err.Error(), c.error) {
+				t.Errorf("error %v, se esperaba uno sobre %s", err, c.error)
+			}
+		})
+	}
+
+	t.Run("twilio sin remitente", func(t *testing.T) {
+		t.Setenv("TWILIO_ACCOUNT_SID", "ACprueba")
+		t.Setenv("TWILIO_AUTH_TOKEN", "secreto")
+		cfg, err := cargarConfigSMS()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := nuevoRemitenteSMS(cfg); err == nil || !strings.Contains(err.Error(), "TWILIO_REMITENTE") {
+			t.Errorf("error %v, se esperaba uno sobre TWILIO_REMITENTE", err)
+		}
+	})
+
+	t.Run("plantilla propia", func(t *testing.T) {
+		t.Setenv("SMS_PLANTILLA_LOGIN", "{{.Codigo}} es tu código de acceso")
+		cfg, err := cargarConfigSMS()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var texto strings.Builder
+		cfg.Plantillas[plantillaSMSLogin].Execute(&texto, datosPlantillaSMS{Codigo: "123456"})
+		if texto.String() != "123456 es tu código de acceso" {
+			t.Errorf("texto %q", texto.String())
+		}
+	})
+}
@@ -0,0 +1,619 @@
+// Servicio gRPC equivalente a los endpoints /registro, /login y /perfil de
+// la API HTTP, para los microservicios internos.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.29.3
+// source: usuarios.proto
+
+package usuariospb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type RegistrarRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Correo        string                 `protobuf:"bytes,1,opt,name=correo,proto3" json:"correo,omitempty"`
+	Telefono      string                 `protobuf:"bytes,2,opt,name=telefono,proto3" json:"telefono,omitempty"`
+	Password      string                 `protobuf:"bytes,3,opt,name=password,proto3" json:"password,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegistrarRequest) Reset() {
+	*x = RegistrarRequest{}
+	mi := &file_usuarios_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegistrarRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegistrarRequest) ProtoMessage() {}
+
+func (x *RegistrarRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_usuarios_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegistrarRequest.ProtoReflect.Descriptor instead.
+func (*RegistrarRequest) Descriptor() ([]byte, []int) {
+	return file_usuarios_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *RegistrarRequest) GetCorreo() string {
+	if x != nil {
+		return x.Correo
+	}
+	return ""
+}
+
+func (x *RegistrarRequest) GetTelefono() string {
+	if x != nil {
+		return x.Telefono
+	}
+	return ""
+}
+
+func (x *RegistrarRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+type RegistrarResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Mensaje       string                 `protobuf:"bytes,2,opt,name=mensaje,proto3" json:"mensaje,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegistrarResponse) Reset() {
+	*x = RegistrarResponse{}
+	mi := &file_usuarios_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegistrarResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegistrarResponse) ProtoMessage() {}
+
+func (x *RegistrarResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_usuarios_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegistrarResponse.ProtoReflect.Descriptor instead.
+func (*RegistrarResponse) Descriptor() ([]byte, []int) {
+	return file_usuarios_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RegistrarResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *RegistrarResponse) GetMensaje() string {
+	if x != nil {
+		return x.Mensaje
+	}
+	return ""
+}
+
+type LoginRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Correo   string                 `protobuf:"bytes,1,opt,name=correo,proto3" json:"correo,omitempty"`
+	Password string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	// Código TOTP o de respaldo, requerido si el usuario tiene activo el
+	// segundo factor.
+	Codigo        string `protobuf:"bytes,3,opt,name=codigo,proto3" json:"codigo,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoginRequest) Reset() {
+	*x = LoginRequest{}
+	mi := &file_usuarios_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoginRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginRequest) ProtoMessage() {}
+
+func (x *LoginRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_usuarios_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginRequest.ProtoReflect.Descriptor instead.
+func (*LoginRequest) Descriptor() ([]byte, []int) {
+	return file_usuarios_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *LoginRequest) GetCorreo() string {
+	if x != nil {
+		return x.Correo
+	}
+	return ""
+}
+
+func (x *LoginRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *LoginRequest) GetCodigo() string {
+	if x != nil {
+		return x.Codigo
+	}
+	return ""
+}
+
+type LoginResponse struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Token       string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	FechaInicio *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=fecha_inicio,json=fechaInicio,proto3" json:"fecha_inicio,omitempty"`
+	// Avisa que el token sólo sirve para cambiar la contraseña hasta que se
+	// cambie.
+	DebeCambiarPassword bool `protobuf:"varint,3,opt,name=debe_cambiar_password,json=debeCambiarPassword,proto3" json:"debe_cambiar_password,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *LoginResponse) Reset() {
+	*x = LoginResponse{}
+	mi := &file_usuarios_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoginResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginResponse) ProtoMessage() {}
+
+func (x *LoginResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_usuarios_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginResponse.ProtoReflect.Descriptor instead.
+func (*LoginResponse) Descriptor() ([]byte, []int) {
+	return file_usuarios_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *LoginResponse) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *LoginResponse) GetFechaInicio() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FechaInicio
+	}
+	return nil
+}
+
+func (x *LoginResponse) GetDebeCambiarPassword() bool {
+	if x != nil {
+		return x.DebeCambiarPassword
+	}
+	return false
+}
+
+type PerfilRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PerfilRequest) Reset() {
+	*x = PerfilRequest{}
+	mi := &file_usuarios_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PerfilRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PerfilRequest) ProtoMessage() {}
+
+func (x *PerfilRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_usuarios_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PerfilRequest.ProtoReflect.Descriptor instead.
+func (*PerfilRequest) Descriptor() ([]byte, []int) {
+	return file_usuarios_proto_rawDescGZIP(), []int{4}
+}
+
+type PerfilResponse struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Id                 string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Correo             string                 `protobuf:"bytes,2,opt,name=correo,proto3" json:"correo,omitempty"`
+	Telefono           string                 `protobuf:"bytes,3,opt,name=telefono,proto3" json:"telefono,omitempty"`
+	CorreoVerificado   bool                   `protobuf:"varint,4,opt,name=correo_verificado,json=correoVerificado,proto3" json:"correo_verificado,omitempty"`
+	TelefonoVerificado bool                   `protobuf:"varint,5,opt,name=telefono_verificado,json=telefonoVerificado,proto3" json:"telefono_verificado,omitempty"`
+	DosFaActivo        bool                   `protobuf:"varint,6,opt,name=dos_fa_activo,json=dosFaActivo,proto3" json:"dos_fa_activo,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *PerfilResponse) Reset() {
+	*x = PerfilResponse{}
+	mi := &file_usuarios_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PerfilResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PerfilResponse) ProtoMessage() {}
+
+func (x *PerfilResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_usuarios_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PerfilResponse.ProtoReflect.Descriptor instead.
+func (*PerfilResponse) Descriptor() ([]byte, []int) {
+	return file_usuarios_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PerfilResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *PerfilResponse) GetCorreo() string {
+	if x != nil {
+		return x.Correo
+	}
+	return ""
+}
+
+func (x *PerfilResponse) GetTelefono() string {
+	if x != nil {
+		return x.Telefono
+	}
+	return ""
+}
+
+func (x *PerfilResponse) GetCorreoVerificado() bool {
+	if x != nil {
+		return x.CorreoVerificado
+	}
+	return false
+}
+
+func (x *PerfilResponse) GetTelefonoVerificado() bool {
+	if x != nil {
+		return x.TelefonoVerificado
+	}
+	return false
+}
+
+func (x *PerfilResponse) GetDosFaActivo() bool {
+	if x != nil {
+		return x.DosFaActivo
+	}
+	return false
+}
+
+// Error es el cuerpo de las respuestas de error de la API HTTP cuando el
+// cliente pide application/x-protobuf; el servicio gRPC usa status.
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Error         string                 `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`
+	Codigo        string                 `protobuf:"bytes,2,opt,name=codigo,proto3" json:"codigo,omitempty"`
+	Errores       []*ErrorCampo          `protobuf:"bytes,3,rep,name=errores,proto3" json:"errores,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_usuarios_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_usuarios_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_usuarios_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Error) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Error) GetCodigo() string {
+	if x != nil {
+		return x.Codigo
+	}
+	return ""
+}
+
+func (x *Error) GetErrores() []*ErrorCampo {
+	if x != nil {
+		return x.Errores
+	}
+	return nil
+}
+
+type ErrorCampo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Campo         string                 `protobuf:"bytes,1,opt,name=campo,proto3" json:"campo,omitempty"`
+	Codigo        string                 `protobuf:"bytes,2,opt,name=codigo,proto3" json:"codigo,omitempty"`
+	Mensaje       string                 `protobuf:"bytes,3,opt,name=mensaje,proto3" json:"mensaje,omitempty"`
+	Reglas        []string               `protobuf:"bytes,4,rep,name=reglas,proto3" json:"reglas,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ErrorCampo) Reset() {
+	*x = ErrorCampo{}
+	mi := &file_usuarios_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ErrorCampo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ErrorCampo) ProtoMessage() {}
+
+func (x *ErrorCampo) ProtoReflect() protoreflect.Message {
+	mi := &file_usuarios_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ErrorCampo.ProtoReflect.Descriptor instead.
+func (*ErrorCampo) Descriptor() ([]byte, []int) {
+	return file_usuarios_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ErrorCampo) GetCampo() string {
+	if x != nil {
+		return x.Campo
+	}
+	return ""
+}
+
+func (x *ErrorCampo) GetCodigo() string {
+	if x != nil {
+		return x.Codigo
+	}
+	return ""
+}
+
+func (x *ErrorCampo) GetMensaje() string {
+	if x != nil {
+		return x.Mensaje
+	}
+	return ""
+}
+
+func (x *ErrorCampo) GetReglas() []string {
+	if x != nil {
+		return x.Reglas
+	}
+	return nil
+}
+
+var File_usuarios_proto protoreflect.FileDescriptor
+
+const file_usuarios_proto_rawDesc = "" +
+	"\n" +
+	"\x0eusuarios.proto\x12\x15stratplus.usuarios.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"b\n" +
+	"\x10RegistrarRequest\x12\x16\n" +
+	"\x06correo\x18\x01 \x01(\tR\x06correo\x12\x1a\n" +
+	"\btelefono\x18\x02 \x01(\tR\btelefono\x12\x1a\n" +
+	"\bpassword\x18\x03 \x01(\tR\bpassword\"=\n" +
+	"\x11RegistrarResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\amensaje\x18\x02 \x01(\tR\amensaje\"Z\n" +
+	"\fLoginRequest\x12\x16\n" +
+	"\x06correo\x18\x01 \x01(\tR\x06correo\x12\x1a\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpassword\x12\x16\n" +
+	"\x06codigo\x18\x03 \x01(\tR\x06codigo\"\x98\x01\n" +
+	"\rLoginResponse\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12=\n" +
+	"\ffecha_inicio\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\vfechaInicio\x122\n" +
+	"\x15debe_cambiar_password\x18\x03 \x01(\bR\x13debeCambiarPassword\"\x0f\n" +
+	"\rPerfilRequest\"\xd6\x01\n" +
+	"\x0ePerfilResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06correo\x18\x02 \x01(\tR\x06correo\x12\x1a\n" +
+	"\btelefono\x18\x03 \x01(\tR\btelefono\x12+\n" +
+	"\x11correo_verificado\x18\x04 \x01(\bR\x10correoVerificado\x12/\n" +
+	"\x13telefono_verificado\x18\x05 \x01(\bR\x12telefonoVerificado\x12\"\n" +
+	"\rdos_fa_activo\x18\x06 \x01(\bR\vdosFaActivo\"r\n" +
+	"\x05Error\x12\x14\n" +
+	"\x05error\x18\x01 \x01(\tR\x05error\x12\x16\n" +
+	"\x06codigo\x18\x02 \x01(\tR\x06codigo\x12;\n" +
+	"\aerrores\x18\x03 \x03(\v2!.stratplus.usuarios.v1.ErrorCampoR\aerrores\"l\n" +
+	"\n" +
+	"ErrorCampo\x12\x14\n" +
+	"\x05campo\x18\x01 \x01(\tR\x05campo\x12\x16\n" +
+	"\x06codigo\x18\x02 \x01(\tR\x06codigo\x12\x18\n" +
+	"\amensaje\x18\x03 \x01(\tR\amensaje\x12\x16\n" +
+	"\x06reglas\x18\x04 \x03(\tR\x06reglas2\x95\x02\n" +
+	"\bUsuarios\x12^\n" +
+	"\tRegistrar\x12'.stratplus.usuarios.v1.RegistrarRequest\x1a(.stratplus.usuarios.v1.RegistrarResponse\x12R\n" +
+	"\x05Login\x12#.stratplus.usuarios.v1.LoginRequest\x1a$.stratplus.usuarios.v1.LoginResponse\x12U\n" +
+	"\x06Perfil\x12$.stratplus.usuarios.v1.PerfilRequest\x1a%.stratplus.usuarios.v1.PerfilResponseB\x16Z\x14pruebasgo/usuariospbb\x06proto3"
+
+var (
+	file_usuarios_proto_rawDescOnce sync.Once
+	file_usuarios_proto_rawDescData []byte
+)
+
+func file_usuarios_proto_rawDescGZIP() []byte {
+	file_usuarios_proto_rawDescOnce.Do(func() {
+		file_usuarios_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_usuarios_proto_rawDesc), len(file_usuarios_proto_rawDesc)))
+	})
+	return file_usuarios_proto_rawDescData
+}
+
+var file_usuarios_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_usuarios_proto_goTypes = []any{
+	(*RegistrarRequest)(nil),      // 0: stratplus.usuarios.v1.RegistrarRequest
+	(*RegistrarResponse)(nil),     // 1: stratplus.usuarios.v1.RegistrarResponse
+	(*LoginRequest)(nil),          // 2: stratplus.usuarios.v1.LoginRequest
+	(*LoginResponse)(nil),         // 3: stratplus.usuarios.v1.LoginResponse
+	(*PerfilRequest)(nil),         // 4: stratplus.usuarios.v1.PerfilRequest
+	(*PerfilResponse)(nil),        // 5: stratplus.usuarios.v1.PerfilResponse
+	(*Error)(nil),                 // 6: stratplus.usuarios.v1.Error
+	(*ErrorCampo)(nil),            // 7: stratplus.usuarios.v1.ErrorCampo
+	(*timestamppb.Timestamp)(nil), // 8: google.protobuf.Timestamp
+}
+var file_usuarios_proto_depIdxs = []int32{
+	8, // 0: stratplus.usuarios.v1.LoginResponse.fecha_inicio:type_name -> google.protobuf.Timestamp
+	7, // 1: stratplus.usuarios.v1.Error.errores:type_name -> stratplus.usuarios.v1.ErrorCampo
+	0, // 2: stratplus.usuarios.v1.Usuarios.Registrar:input_type -> stratplus.usuarios.v1.RegistrarRequest
+	2, // 3: stratplus.usuarios.v1.Usuarios.Login:input_type -> stratplus.usuarios.v1.LoginRequest
+	4, // 4: stratplus.usuarios.v1.Usuarios.Perfil:input_type -> stratplus.usuarios.v1.PerfilRequest
+	1, // 5: stratplus.usuarios.v1.Usuarios.Registrar:output_type -> stratplus.usuarios.v1.RegistrarResponse
+	3, // 6: stratplus.usuarios.v1.Usuarios.Login:output_type -> stratplus.usuarios.v1.LoginResponse
+	5, // 7: stratplus.usuarios.v1.Usuarios.Perfil:output_type -> stratplus.usuarios.v1.PerfilResponse
+	5, // [5:8] is the sub-list for method output_type
+	2, // [2:5] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_usuarios_proto_init() }
+func file_usuarios_proto_init() {
+	if File_usuarios_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_usuarios_proto_rawDesc), len(file_usuarios_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_usuarios_proto_goTypes,
+		DependencyIndexes: file_usuarios_proto_depIdxs,
+		MessageInfos:      file_usuarios_proto_msgTypes,
+	}.Build()
+	File_usuarios_proto = out.File
+	file_usuarios_proto_goTypes = nil
+	file_usuarios_proto_depIdxs = nil
+}
@@ -0,0 +1,214 @@
+// Servicio gRPC equivalente a los endpoints /registro, /login y /perfil de
+// la API HTTP, para los microservicios internos.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v5.29.3
+// source: usuarios.proto
+
+package usuariospb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Usuarios_Registrar_FullMethodName = "/stratplus.usuarios.v1.Usuarios/Registrar"
+	Usuarios_Login_FullMethodName     = "/stratplus.usuarios.v1.Usuarios/Login"
+	Usuarios_Perfil_FullMethodName    = "/stratplus.usuarios.v1.Usuarios/Perfil"
+)
+
+// UsuariosClient is the client API for Usuarios service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type UsuariosClient interface {
+	// Registrar da de alta una cuenta. Los errores de validación se
+	// devuelven con INVALID_ARGUMENT (o ALREADY_EXISTS si el correo o el
+	// teléfono ya existen) y un detalle google.rpc.BadRequest por campo.
+	Registrar(ctx context.Context, in *RegistrarRequest, opts ...grpc.CallOption) (*RegistrarResponse, error)
+	// Login verifica las credenciales y, si está activo, el segundo factor
+	// y devuelve un JWT.
+	Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error)
+	// Perfil devuelve el perfil del usuario autenticado con el metadata
+	// "authorization: Bearer <token>".
+	Perfil(ctx context.Context, in *PerfilRequest, opts ...grpc.CallOption) (*PerfilResponse, error)
+}
+
+type usuariosClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUsuariosClient(cc grpc.ClientConnInterface) UsuariosClient {
+	return &usuariosClient{cc}
+}
+
+func (c *usuariosClient) Registrar(ctx context.Context, in *RegistrarRequest, opts ...grpc.CallOption) (*RegistrarResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegistrarResponse)
+	err := c.cc.Invoke(ctx, Usuarios_Registrar_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usuariosClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoginResponse)
+	err := c.cc.Invoke(ctx, Usuarios_Login_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usuariosClient) Perfil(ctx context.Context, in *PerfilRequest, opts ...grpc.CallOption) (*PerfilResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PerfilResponse)
+	err := c.cc.Invoke(ctx, Usuarios_Perfil_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UsuariosServer is the server API for Usuarios service.
+// All implementations must embed UnimplementedUsuariosServer
+// for forward compatibility.
+type UsuariosServer interface {
+	// Registrar da de alta una cuenta. Los errores de validación se
+	// devuelven con INVALID_ARGUMENT (o ALREADY_EXISTS si el correo o el
+	// teléfono ya existen) y un detalle google.rpc.BadRequest por campo.
+	Registrar(context.Context, *RegistrarRequest) (*RegistrarResponse, error)
+	// Login verifica las credenciales y, si está activo, el segundo factor
+	// y devuelve un JWT.
+	Login(context.Context, *LoginRequest) (*LoginResponse, error)
+	// Perfil devuelve el perfil del usuario autenticado con el metadata
+	// "authorization: Bearer <token>".
+	Perfil(context.Context, *PerfilRequest) (*PerfilResponse, error)
+	mustEmbedUnimplementedUsuariosServer()
+}
+
+// UnimplementedUsuariosServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedUsuariosServer struct{}
+
+func (UnimplementedUsuariosServer) Registrar(context.Context, *RegistrarRequest) (*RegistrarResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Registrar not implemented")
+}
+func (UnimplementedUsuariosServer) Login(context.Context, *LoginRequest) (*LoginResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedUsuariosServer) Perfil(context.Context, *PerfilRequest) (*PerfilResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Perfil not implemented")
+}
+func (UnimplementedUsuariosServer) mustEmbedUnimplementedUsuariosServer() {}
+func (UnimplementedUsuariosServer) testEmbeddedByValue()                  {}
+
+// UnsafeUsuariosServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UsuariosServer will
+// result in compilation errors.
+type UnsafeUsuariosServer interface {
+	mustEmbedUnimplementedUsuariosServer()
+}
+
+func RegisterUsuariosServer(s grpc.ServiceRegistrar, srv UsuariosServer) {
+	// If the following call panics, it indicates UnimplementedUsuariosServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Usuarios_ServiceDesc, srv)
+}
+
+func _Usuarios_Registrar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegistrarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsuariosServer).Registrar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Usuarios_Registrar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsuariosServer).Registrar(ctx, req.(*RegistrarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Usuarios_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsuariosServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Usuarios_Login_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsuariosServer).Login(ctx, req.(*LoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Usuarios_Perfil_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PerfilRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsuariosServer).Perfil(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Usuarios_Perfil_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsuariosServer).Perfil(ctx, req.(*PerfilRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Usuarios_ServiceDesc is the grpc.ServiceDesc for Usuarios service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Usuarios_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "stratplus.usuarios.v1.Usuarios",
+	HandlerType: (*UsuariosServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Registrar",
+			Handler:    _Usuarios_Registrar_Handler,
+		},
+		{
+			MethodName: "Login",
+			Handler:    _Usuarios_Login_Handler,
+		},
+		{
+			MethodName: "Perfil",
+			Handler:    _Usuarios_Perfil_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "usuarios.proto",
+}
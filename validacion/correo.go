@@ -0,0 +1,105 @@
+package validacion
+
+import (
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// OpcionesCorreo ajusta qué direcciones acepta Correo además de la
+// sintaxis de RFC 5322.
+type OpcionesCorreo struct {
+	// PermitirEtiqueta admite subdirecciones con "+" (usuario+etiqueta@...).
+	PermitirEtiqueta bool
+	// PermitirUnicode admite caracteres no ASCII, como tildes o dominios
+	// internacionalizados (RFC 6531).
+	PermitirUnicode bool
+}
+
+// NormalizarCorreo devuelve la forma con la que se guardan y comparan los
+// correos: sin espacios alrededor y en minúsculas, de modo que
+// "User@X.com" y "user@x.com" son la misma cuenta.
+func NormalizarCorreo(correo string) string {
+	return strings.ToLower(strings.TrimSpace(correo))
+}
+
+// Correo revisa que el correo sea una dirección de RFC 5322 que se pueda
+// usar para enviar correo:
+// - Sólo la dirección, sin nombre ni ángulos ("Ana <ana@x.com>")
+// - Parte local de hasta 64 bytes, sin comillas
+// - Dominio con al menos un punto, etiquetas de letras, dígitos y guiones
+// que no empiezan ni terminan en guión, y un TLD de 2 o más letras; sin
+// literales de IP
+// - Hasta 254 bytes en total
+// - "+" y caracteres no ASCII según las opciones
+//
+// Los espacios alrededor se ignoran. Devuelve un *ErrorCorreo si el
+// correo no es válido.
+func Correo(correo string, opciones OpcionesCorreo) error {
+	correo = strings.TrimSpace(correo)
+	if correo == "" {
+		return &ErrorCorreo{Motivo: MotivoVacio}
+	}
+	if len(correo) > 254 {
+		return &ErrorCorreo{Motivo: MotivoLongitud}
+	}
+	direccion, err := mail.ParseAddress(correo)
+	if err != nil || direccion.Name != "" || direccion.Address != correo {
+		return &ErrorCorreo{Motivo: MotivoSintaxis}
+	}
+
+	arroba := strings.LastIndex(correo, "@")
+	local, dominio := correo[:arroba], correo[arroba+1:]
+	if len(local) > 64 {
+		return &ErrorCorreo{Motivo: MotivoLongitud}
+	}
+	if !opciones.PermitirEtiqueta && strings.Contains(local, "+") {
+		return &ErrorCorreo{Motivo: MotivoEtiqueta}
+	}
+	if !opciones.PermitirUnicode && !esASCII(correo) {
+		return &ErrorCorreo{Motivo: MotivoUnicode}
+	}
+	if !dominioValido(dominio) {
+		return &ErrorCorreo{Motivo: MotivoDominio}
+	}
+	return nil
+}
+
+// dominioValido revisa las etiquetas del dominio de un correo.
+func dominioValido(dominio string) bool {
+	etiquetas := strings.Split(dominio, ".")
+	if len(etiquetas) < 2 {
+		return false
+	}
+	for _, e := range etiquetas {
+		if e == "" || len(e) > 63 || strings.HasPrefix(e, "-") || strings.HasSuffix(e, "-") {
+			return false
+		}
+		for _, c := range e {
+			if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '-' {
+				return false
+			}
+		}
+	}
+	tld := etiquetas[len(etiquetas)-1]
+	if utf8.RuneCountInString(tld) < 2 {
+		return false
+	}
+	for _, c := range tld {
+		if !unicode.IsLetter(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// esASCII indica si s sólo contiene caracteres ASCII.
+func esASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package validacion
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCorreo(t *testing.T) {
+	todas := OpcionesCorreo{PermitirEtiqueta: true, PermitirUnicode: true}
+	casos := []struct {
+		nombre   string
+		correo   string
+		opciones OpcionesCorreo
+		motivo   Motivo // vacío si el correo es válido
+	}{
+		{"simple", "usuario@example.com", todas, ""},
+		{"subdominio", "ana@correo.example.com.mx", todas, ""},
+		{"espacios alrededor", "  ana@example.com ", todas, ""},
+		{"etiqueta permitida", "ana+pruebas@ejemplo.com", todas, ""},
+		{"etiqueta rechazada", "ana+pruebas@ejemplo.com", OpcionesCorreo{PermitirUnicode: true}, MotivoEtiqueta},
+		{"unicode permitido", "josé@ejemplo.com", todas, ""},
+		{"dominio internacional", "ana@ñandú.mx", todas, ""},
+		{"unicode rechazado", "josé@ejemplo.com", OpcionesCorreo{PermitirEtiqueta: true}, MotivoUnicode},
+		{"vacío", "", todas, MotivoVacio},
+		{"sólo espacios", "   ", todas, MotivoVacio},
+		{"sin arroba", "usuario.example.com", todas, MotivoSintaxis},
+		{"con nombre", "Ana <ana@ejemplo.com>", todas, MotivoSintaxis},
+		{"dos arrobas", "a@b@example.com", todas, MotivoSintaxis},
+		{"parte local entre comillas", `"ana maria"@ejemplo.com`, todas, MotivoSintaxis},
+		{"comillas innecesarias", `"ana"@ejemplo.com`, todas, MotivoSintaxis},
+		{"parte local larga", strings.Repeat("a", 65) + "@ejemplo.com", todas, MotivoLongitud},
+		{"correo largo", "ana@" + strings.Repeat(strings.Repeat("a", 60)+".", 4) + "ejemplo.com", todas, MotivoLongitud},
+		{"dominio sin punto", "ana@localhost", todas, MotivoDominio},
+		{"literal de IP", "ana@[192.168.0.1]", todas, MotivoDominio},
+		{"TLD de una letra", "ana@ejemplo.c", todas, MotivoDominio},
+		{"TLD numérico", "ana@ejemplo.123", todas, MotivoDominio},
+		{"etiqueta con guión inicial", "ana@-ejemplo.com", todas, MotivoDominio},
+		{"etiqueta vacía", "ana@ejemplo..com", todas, MotivoSintaxis},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			err := Correo(c.correo, c.opciones)
+			if c.motivo == "" {
+				if err != nil {
+					t.Fatalf("Correo(%q) = %v, se esperaba nil", c.correo, err)
+				}
+				return
+			}
+			var errCorreo *ErrorCorreo
+			if !errors.As(err, &errCorreo) {
+				t.Fatalf("Correo(%q) = %v, se esperaba un *ErrorCorreo", c.correo, err)
+			}
+			if errCorreo.Motivo != c.motivo {
+				t.Errorf("Correo(%q): motivo %q, se esperaba %q", c.correo, errCorreo.Motivo, c.motivo)
+			}
+			if !errors.Is(err, ErrCorreoInvalido) {
+				t.Errorf("Correo(%q): errors.Is(err, ErrCorreoInvalido) es falso", c.correo)
+			}
+		})
+	}
+}
+
+func TestNormalizarCorreo(t *testing.T) {
+	casos := []struct{ correo, esperado string }{
+		{"user@x.com", "user@x.com"},
+		{"User@X.com", "user@x.com"},
+		{"  ANA@Ejemplo.COM\t", "ana@ejemplo.com"},
+		{"", ""},
+	}
+	for _, c := range casos {
+		if got := NormalizarCorreo(c.correo); got != c.esperado {
+			t.Errorf("NormalizarCorreo(%q) = %q, se esperaba %q", c.correo, got, c.esperado)
+		}
+	}
+}
+
+func BenchmarkCorreo(b *testing.B) {
+	opciones := OpcionesCorreo{PermitirEtiqueta: true, PermitirUnicode: true}
+	for b.Loop() {
+		Correo("ana.maria+pruebas@correo.ejemplo.com.mx", opciones)
+	}
+}
+
+// FuzzCorreo busca correos que provoquen un panic o que se acepten sin
+// cumplir lo que Correo promete:
+//
+//	go test -fuzz FuzzCorreo ./validacion/
+func FuzzCorreo(f *testing.F) {
+	for _, semilla := range []string{
+		"usuario@example.com", "ana+pruebas@ejemplo.com", "josé@ñandú.mx", "Ana <ana@ejemplo.com>",
+		`"ana"@ejemplo.com`, "ana@[192.168.0.1]", "a@b@example.com", "ana@ejemplo..com", " ",
+	} {
+		f.Add(semilla)
+	}
+	todas := OpcionesCorreo{PermitirEtiqueta: true, PermitirUnicode: true}
+	f.Fuzz(func(t *testing.T, correo string) {
+		err := Correo(correo, todas)
+		if err != nil {
+			var errCorreo *ErrorCorreo
+			if !errors.As(err, &errCorreo) || !errors.Is(err, ErrCorreoInvalido) {
+				t.Fatalf("Correo(%q) = %v, se esperaba un *ErrorCorreo", correo, err)
+			}
+			if Correo(correo, OpcionesCorreo{}) == nil {
+				t.Fatalf("Correo(%q) se acepta con las opciones más estrictas y no con todas", correo)
+			}
+			return
+		}
+
+		correo = strings.TrimSpace(correo)
+		arroba := strings.LastIndex(correo, "@")
+		if arroba < 1 || len(correo) > 254 || arroba > 64 {
+			t.Fatalf("Correo(%q) aceptado con una parte local o una longitud inválidas", correo)
+		}
+		dominio := correo[arroba+1:]
+		if !strings.Contains(dominio, ".") || strings.ContainsAny(correo, " \t\r\n<>[]\"") {
+			t.Fatalf("Correo(%q) aceptado con un dominio o caracteres inválidos", correo)
+		}
+		if esASCII(correo) && Correo(NormalizarCorreo(correo), todas) != nil {
+			t.Fatalf("Correo(%q) se acepta pero su forma normalizada no", correo)
+		}
+	})
+}
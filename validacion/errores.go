@@ -0,0 +1,102 @@
+// Package validacion valida los datos con los que se da de alta una
+// cuenta: correos (RFC 5322), teléfonos (E.164) y contraseñas según una
+// política configurable.
+//
+// Cada función devuelve nil si el valor es válido o un error tipado
+// (*ErrorCorreo, *ErrorTelefono o *ErrorPassword) con el motivo. Los
+// errores se pueden comparar con errors.Is contra ErrCorreoInvalido,
+// ErrTelefonoInvalido y ErrPasswordInvalida, o inspeccionar con
+// errors.As.
+package validacion
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errores con los que se comparan, vía errors.Is, los errores del
+// paquete.
+var (
+	ErrCorreoInvalido   = errors.New("validacion: correo inválido")
+	ErrTelefonoInvalido = errors.New("validacion: teléfono inválido")
+	ErrPasswordInvalida = errors.New("validacion: contraseña inválida")
+)
+
+// Motivo identifica por qué un correo o un teléfono no es válido.
+type Motivo string
+
+// Motivos de ErrorCorreo y ErrorTelefono.
+const (
+	// MotivoVacio: el valor está vacío o sólo tiene espacios.
+	MotivoVacio Motivo = "vacio"
+	// MotivoLongitud: el correo excede 254 bytes o su parte local 64.
+	MotivoLongitud Motivo = "longitud"
+	// MotivoSintaxis: el valor no se puede interpretar o, en un correo,
+	// incluye nombre, ángulos o comillas.
+	MotivoSintaxis Motivo = "sintaxis"
+	// MotivoEtiqueta: el correo usa "+" y las opciones no lo permiten.
+	MotivoEtiqueta Motivo = "etiqueta"
+	// MotivoUnicode: el correo tiene caracteres no ASCII y las opciones
+	// no lo permiten.
+	MotivoUnicode Motivo = "unicode"
+	// MotivoDominio: el dominio del correo no es válido.
+	MotivoDominio Motivo = "dominio"
+	// MotivoNumero: el teléfono no es un número válido para su país.
+	MotivoNumero Motivo = "numero"
+)
+
+// ErrorCorreo indica que un correo no es válido.
+type ErrorCorreo struct {
+	Motivo Motivo
+}
+
+func (e *ErrorCorreo) Error() string {
+	return ErrCorreoInvalido.Error() + ": " + string(e.Motivo)
+}
+
+// Is hace que errors.Is(err, ErrCorreoInvalido) sea verdadero.
+func (e *ErrorCorreo) Is(objetivo error) bool {
+	return objetivo == ErrCorreoInvalido
+}
+
+// ErrorTelefono indica que un teléfono no es válido.
+type ErrorTelefono struct {
+	Motivo Motivo
+}
+
+func (e *ErrorTelefono) Error() string {
+	return ErrTelefonoInvalido.Error() + ": " + string(e.Motivo)
+}
+
+// Is hace que errors.Is(err, ErrTelefonoInvalido) sea verdadero.
+func (e *ErrorTelefono) Is(objetivo error) bool {
+	return objetivo == ErrTelefonoInvalido
+}
+
+// ErrorPassword indica que una contraseña no cumple la política; Reglas
+// lista cada regla incumplida.
+type ErrorPassword struct {
+	Reglas []Regla
+}
+
+func (e *ErrorPassword) Error() string {
+	codigos := make([]string, len(e.Reglas))
+	for i, r := range e.Reglas {
+		codigos[i] = string(r.Codigo)
+	}
+	return ErrPasswordInvalida.Error() + ": " + strings.Join(codigos, ", ")
+}
+
+// Is hace que errors.Is(err, ErrPasswordInvalida) sea verdadero.
+func (e *ErrorPassword) Is(objetivo error) bool {
+	return objetivo == ErrPasswordInvalida
+}
+
+// Mensajes devuelve la descripción de cada regla incumplida.
+func (e *ErrorPassword) Mensajes() []string {
+	mensajes := make([]string, len(e.Reglas))
+	for i, r := range e.Reglas {
+		mensajes[i] = r.Mensaje
+	}
+	return mensajes
+}
@@ -0,0 +1,98 @@
+package validacion
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PoliticaPassword define la longitud admitida de las contraseñas, en
+// caracteres, y qué cuenta como carácter especial. Los demás tipos de
+// carácter requeridos son fijos (ver Password).
+type PoliticaPassword struct {
+	LongitudMinima int
+	LongitudMaxima int
+	// Especiales es la lista de caracteres especiales aceptados.
+	Especiales string
+	// EspecialesUnicode hace que cualquier signo de puntuación o símbolo
+	// Unicode (!, #, €, ¿, ...) cuente como carácter especial, además de
+	// los de Especiales.
+	EspecialesUnicode bool
+}
+
+// CodigoRegla identifica una regla de PoliticaPassword.
+type CodigoRegla string
+
+// Reglas que revisa Password.
+const (
+	ReglaLongitudMinima CodigoRegla = "longitud_minima"
+	ReglaLongitudMaxima CodigoRegla = "longitud_maxima"
+	ReglaMayuscula      CodigoRegla = "mayuscula"
+	ReglaMinuscula      CodigoRegla = "minuscula"
+	ReglaNumero         CodigoRegla = "numero"
+	ReglaEspecial       CodigoRegla = "especial"
+)
+
+// Regla es una regla incumplida por una contraseña, con su descripción
+// en español.
+type Regla struct {
+	Codigo  CodigoRegla
+	Mensaje string
+}
+
+// Password revisa que la contraseña cumpla con:
+// - Longitud dentro de la política, contada en caracteres y no en bytes
+// - Al menos una mayúscula
+// - Al menos una minúscula
+// - Al menos un número
+// - Al menos un carácter especial de la lista de la política o, si la
+// política lo permite, cualquier signo de puntuación o símbolo Unicode
+//
+// Devuelve un *ErrorPassword con todas las reglas incumplidas.
+func Password(password string, politica PoliticaPassword) error {
+	var reglas []Regla
+	longitud := utf8.RuneCountInString(password)
+	if longitud < politica.LongitudMinima {
+		reglas = append(reglas, Regla{ReglaLongitudMinima, fmt.Sprintf("Debe tener al menos %d caracteres", politica.LongitudMinima)})
+	}
+	if longitud > politica.LongitudMaxima {
+		reglas = append(reglas, Regla{ReglaLongitudMaxima, fmt.Sprintf("Debe tener como máximo %d caracteres", politica.LongitudMaxima)})
+	}
+
+	var tieneMayus, tieneMinus, tieneNumero, tieneEspecial bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			tieneMayus = true
+		case unicode.IsLower(c):
+			tieneMinus = true
+		case unicode.IsDigit(c):
+			tieneNumero = true
+		case strings.ContainsRune(politica.Especiales, c),
+			politica.EspecialesUnicode && (unicode.IsPunct(c) || unicode.IsSymbol(c)):
+			tieneEspecial = true
+		}
+	}
+
+	if !tieneMayus {
+		reglas = append(reglas, Regla{ReglaMayuscula, "Debe incluir una mayúscula"})
+	}
+	if !tieneMinus {
+		reglas = append(reglas, Regla{ReglaMinuscula, "Debe incluir una minúscula"})
+	}
+	if !tieneNumero {
+		reglas = append(reglas, Regla{ReglaNumero, "Debe incluir un número"})
+	}
+	if !tieneEspecial {
+		if politica.EspecialesUnicode {
+			reglas = append(reglas, Regla{ReglaEspecial, fmt.Sprintf("Debe incluir un carácter especial de %s o un símbolo Unicode", politica.Especiales)})
+		} else {
+			reglas = append(reglas, Regla{ReglaEspecial, fmt.Sprintf("Debe incluir un carácter especial de %s", politica.Especiales)})
+		}
+	}
+	if len(reglas) > 0 {
+		return &ErrorPassword{Reglas: reglas}
+	}
+	return nil
+}
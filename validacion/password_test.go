@@ -0,0 +1,138 @@
+package validacion
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+func TestPassword(t *testing.T) {
+	base := PoliticaPassword{LongitudMinima: 6, LongitudMaxima: 12, Especiales: "@$&"}
+	unicode := base
+	unicode.EspecialesUnicode = true
+	casos := []struct {
+		nombre   string
+		password string
+		politica PoliticaPassword
+		reglas   []CodigoRegla // vacío si la contraseña es válida
+	}{
+		{"válida", "Pass123@", base, nil},
+		{"longitud mínima exacta", "Pa1@bc", base, nil},
+		{"longitud máxima exacta", "Pass123@abcd", base, nil},
+		{"longitud en caracteres y no en bytes", "Ñandú1@ñandú", base, nil},
+		{"corta", "Pa1@", base, []CodigoRegla{ReglaLongitudMinima}},
+		{"larga", "Pass123@abcde", base, []CodigoRegla{ReglaLongitudMaxima}},
+		{"sin mayúscula", "pass123@", base, []CodigoRegla{ReglaMayuscula}},
+		{"sin minúscula", "PASS123@", base, []CodigoRegla{ReglaMinuscula}},
+		{"sin número", "Password@", base, []CodigoRegla{ReglaNumero}},
+		{"sin especial", "Pass1234", base, []CodigoRegla{ReglaEspecial}},
+		{"especial fuera de la lista", "Pass123!", base, []CodigoRegla{ReglaEspecial}},
+		{"símbolo Unicode permitido", "Pass123€", unicode, nil},
+		{"puntuación permitida", "Pass123¿", unicode, nil},
+		{"lista personalizada", "Pass123#", PoliticaPassword{LongitudMinima: 6, LongitudMaxima: 12, Especiales: "#"}, nil},
+		{"vacía", "", base, []CodigoRegla{ReglaLongitudMinima, ReglaMayuscula, ReglaMinuscula, ReglaNumero, ReglaEspecial}},
+		{"varias reglas", "simple", base, []CodigoRegla{ReglaMayuscula, ReglaNumero, ReglaEspecial}},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			err := Password(c.password, c.politica)
+			if c.reglas == nil {
+				if err != nil {
+					t.Fatalf("Password(%q) = %v, se esperaba nil", c.password, err)
+				}
+				return
+			}
+			var errPassword *ErrorPassword
+			if !errors.As(err, &errPassword) {
+				t.Fatalf("Password(%q) = %v, se esperaba un *ErrorPassword", c.password, err)
+			}
+			var codigos []CodigoRegla
+			for _, r := range errPassword.Reglas {
+				codigos = append(codigos, r.Codigo)
+			}
+			if !slices.Equal(codigos, c.reglas) {
+				t.Errorf("Password(%q): reglas %v, se esperaban %v", c.password, codigos, c.reglas)
+			}
+			if len(errPassword.Mensajes()) != len(c.reglas) {
+				t.Errorf("Password(%q): %d mensajes para %d reglas", c.password, len(errPassword.Mensajes()), len(c.reglas))
+			}
+			if !errors.Is(err, ErrPasswordInvalida) {
+				t.Errorf("Password(%q): errors.Is(err, ErrPasswordInvalida) es falso", c.password)
+			}
+		})
+	}
+}
+
+func TestPasswordMensajes(t *testing.T) {
+	politica := PoliticaPassword{LongitudMinima: 8, LongitudMaxima: 12, Especiales: "@$&", EspecialesUnicode: true}
+	var errPassword *ErrorPassword
+	if !errors.As(Password("abc", politica), &errPassword) {
+		t.Fatal("se esperaba un *ErrorPassword")
+	}
+	esperados := []string{
+		"Debe tener al menos 8 caracteres",
+		"Debe incluir una mayúscula",
+		"Debe incluir un número",
+		"Debe incluir un carácter especial de @$& o un símbolo Unicode",
+	}
+	if got := errPassword.Mensajes(); !slices.Equal(got, esperados) {
+		t.Errorf("Mensajes() = %q, se esperaba %q", got, esperados)
+	}
+}
+
+func BenchmarkPassword(b *testing.B) {
+	politica := PoliticaPassword{LongitudMinima: 6, LongitudMaxima: 12, Especiales: "@$&"}
+	b.Run("válida", func(b *testing.B) {
+		for b.Loop() {
+			Password("Pass123@", politica)
+		}
+	})
+	b.Run("inválida", func(b *testing.B) {
+		for b.Loop() {
+			Password("simple", politica)
+		}
+	})
+}
+
+// FuzzPassword busca contraseñas que provoquen un panic, que se acepten
+// sin cumplir la política o que se rechacen sin decir por qué:
+//
+//	go test -fuzz FuzzPassword ./validacion/
+func FuzzPassword(f *testing.F) {
+	for _, semilla := range []string{"Pass123@", "Pa1@", "pass123@", "Ñandú1@ñandú", "Pass123€", "\xff\xfe", ""} {
+		f.Add(semilla, false)
+		f.Add(semilla, true)
+	}
+	f.Fuzz(func(t *testing.T, password string, unicodeEspeciales bool) {
+		politica := PoliticaPassword{LongitudMinima: 6, LongitudMaxima: 12, Especiales: "@$&", EspecialesUnicode: unicodeEspeciales}
+		err := Password(password, politica)
+		if err != nil {
+			var errPassword *ErrorPassword
+			if !errors.As(err, &errPassword) || !errors.Is(err, ErrPasswordInvalida) || len(errPassword.Reglas) == 0 {
+				t.Fatalf("Password(%q) = %v, se esperaba un *ErrorPassword con reglas", password, err)
+			}
+			var codigos []CodigoRegla
+			for _, r := range errPassword.Reglas {
+				if slices.Contains(codigos, r.Codigo) {
+					t.Fatalf("Password(%q) repite la regla %s", password, r.Codigo)
+				}
+				codigos = append(codigos, r.Codigo)
+			}
+			return
+		}
+
+		if n := utf8.RuneCountInString(password); n < politica.LongitudMinima || n > politica.LongitudMaxima {
+			t.Fatalf("Password(%q) aceptada con %d caracteres", password, n)
+		}
+		if !strings.ContainsFunc(password, unicode.IsUpper) || !strings.ContainsFunc(password, unicode.IsLower) ||
+			!strings.ContainsFunc(password, unicode.IsDigit) {
+			t.Fatalf("Password(%q) aceptada sin mayúscula, minúscula o número", password)
+		}
+		if !unicodeEspeciales && !strings.ContainsAny(password, politica.Especiales) {
+			t.Fatalf("Password(%q) aceptada sin un carácter especial de %s", password, politica.Especiales)
+		}
+	})
+}
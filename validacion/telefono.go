@@ -0,0 +1,27 @@
+package validacion
+
+import (
+	"strings"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// Telefono valida un teléfono y lo devuelve en formato E.164
+// (+525512345678). Acepta números internacionales con prefijo "+" y
+// nacionales de pais (código ISO 3166-1 alfa-2, p. ej. "MX"), con o sin
+// espacios, guiones, puntos o paréntesis. El número debe ser válido para
+// su país según el plan de numeración, no sólo tener la cantidad de
+// dígitos correcta. Devuelve un *ErrorTelefono si no es válido.
+func Telefono(telefono, pais string) (string, error) {
+	if strings.TrimSpace(telefono) == "" {
+		return "", &ErrorTelefono{Motivo: MotivoVacio}
+	}
+	numero, err := phonenumbers.Parse(telefono, strings.ToUpper(pais))
+	if err != nil {
+		return "", &ErrorTelefono{Motivo: MotivoSintaxis}
+	}
+	if !phonenumbers.IsValidNumber(numero) {
+		return "", &ErrorTelefono{Motivo: MotivoNumero}
+	}
+	return phonenumbers.Format(numero, phonenumbers.E164), nil
+}
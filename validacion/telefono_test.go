@@ -0,0 +1,85 @@
+package validacion
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTelefono(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		telefono string
+		pais     string
+		esperado string // E.164 si el teléfono es válido
+		motivo   Motivo // vacío si el teléfono es válido
+	}{
+		{"nacional", "5512345678", "MX", "+525512345678", ""},
+		{"nacional con separadores", "(55) 1234-5678", "MX", "+525512345678", ""},
+		{"internacional", "+52 55 1234 5678", "MX", "+525512345678", ""},
+		{"internacional de otro país", "+1 202-555-0182", "MX", "+12025550182", ""},
+		{"país en minúsculas", "202 555 0182", "us", "+12025550182", ""},
+		{"vacío", "", "MX", "", MotivoVacio},
+		{"sólo espacios", "  ", "MX", "", MotivoVacio},
+		{"letras", "abc", "MX", "", MotivoSintaxis},
+		{"nacional sin país", "5512345678", "", "", MotivoSintaxis},
+		{"pocos dígitos", "12345", "MX", "", MotivoNumero},
+		{"fuera del plan de numeración", "+52 0000000000", "MX", "", MotivoNumero},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			got, err := Telefono(c.telefono, c.pais)
+			if c.motivo == "" {
+				if err != nil || got != c.esperado {
+					t.Fatalf("Telefono(%q, %q) = %q, %v; se esperaba %q", c.telefono, c.pais, got, err, c.esperado)
+				}
+				return
+			}
+			var errTelefono *ErrorTelefono
+			if !errors.As(err, &errTelefono) {
+				t.Fatalf("Telefono(%q, %q) = %q, %v; se esperaba un *ErrorTelefono", c.telefono, c.pais, got, err)
+			}
+			if errTelefono.Motivo != c.motivo {
+				t.Errorf("Telefono(%q, %q): motivo %q, se esperaba %q", c.telefono, c.pais, errTelefono.Motivo, c.motivo)
+			}
+			if !errors.Is(err, ErrTelefonoInvalido) {
+				t.Errorf("Telefono(%q, %q): errors.Is(err, ErrTelefonoInvalido) es falso", c.telefono, c.pais)
+			}
+		})
+	}
+}
+
+func BenchmarkTelefono(b *testing.B) {
+	for b.Loop() {
+		Telefono("(55) 1234-5678", "MX")
+	}
+}
+
+// FuzzTelefono busca teléfonos que provoquen un panic o que se acepten
+// sin quedar en formato E.164:
+//
+//	go test -fuzz FuzzTelefono ./validacion/
+func FuzzTelefono(f *testing.F) {
+	for _, semilla := range []string{
+		"5512345678", "(55) 1234-5678", "+52 55 1234 5678", "+1 202-555-0182", "abc", "12345", "+52 0000000000", "",
+	} {
+		f.Add(semilla, "MX")
+	}
+	f.Add("202 555 0182", "us")
+	f.Fuzz(func(t *testing.T, telefono, pais string) {
+		e164, err := Telefono(telefono, pais)
+		if err != nil {
+			var errTelefono *ErrorTelefono
+			if !errors.As(err, &errTelefono) || !errors.Is(err, ErrTelefonoInvalido) || e164 != "" {
+				t.Fatalf("Telefono(%q, %q) = %q, %v; se esperaba un *ErrorTelefono", telefono, pais, e164, err)
+			}
+			return
+		}
+		if len(e164) < 3 || len(e164) > 16 || e164[0] != '+' || strings.Trim(e164[1:], "0123456789") != "" {
+			t.Fatalf("Telefono(%q, %q) = %q, que no está en formato E.164", telefono, pais, e164)
+		}
+		if otra, err := Telefono(e164, pais); err != nil || otra != e164 {
+			t.Fatalf("Telefono(%q, %q) = %q, pero volver a validarlo da %q, %v", telefono, pais, e164, otra, err)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"pruebasgo/validacion"
+)
+
+// ReglasCorreo ajusta qué direcciones se aceptan además de la sintaxis
+// de RFC 5322 que revisa validacion.Correo.
+type ReglasCorreo struct {
+	validacion.OpcionesCorreo
+	// DominiosDesechables son los dominios de correo temporal que no se
+	// aceptan al registrar una cuenta mientras la flag
+	// bloquear_desechables esté activa.
+	DominiosDesechables map[string]bool
+	// VerificarMX exige en el registro que el dominio del correo tenga
+	// registros MX.
+	VerificarMX bool
+	// TimeoutMX limita cada consulta DNS de registros MX.
+	TimeoutMX time.Duration
+	// VigenciaMX es cuánto se recuerda el resultado de una consulta.
+	VigenciaMX time.Duration
+}
+
+// reglasCorreoPorDefecto se usa mientras no se carguen otras.
+var reglasCorreoPorDefecto = ReglasCorreo{
+	OpcionesCorreo:      validacion.OpcionesCorreo{PermitirEtiqueta: true, PermitirUnicode: true},
+	DominiosDesechables: leerDominiosDesechables(listaDesechables),
+	TimeoutMX:           2 * time.Second,
+	VigenciaMX:          time.Hour,
+}
+
+// reglasCorreo son las reglas vigentes; recargarConfig las reemplaza en
+// caliente.
+var reglasCorreo atomic.Pointer[ReglasCorreo]
+
+// reglasCorreoVigentes devuelve las reglas cargadas o, si todavía no se
+// cargaron, las por defecto.
+func reglasCorreoVigentes() *ReglasCorreo {
+	if reglas := reglasCorreo.Load(); reglas != nil {
+		return reglas
+	}
+	return &reglasCorreoPorDefecto
+}
+
+// cargarReglasCorreo lee CORREO_PERMITIR_ETIQUETA,
+// CORREO_PERMITIR_UNICODE, la lista de dominios desechables y
+// CORREO_VERIFICAR_MX, CORREO_MX_TIMEOUT y CORREO_MX_CACHE sobre los
+// valores por defecto.
+func cargarReglasCorreo() (ReglasCorreo, error) {
+	reglas := reglasCorreoPorDefecto
+	for _, o := range []struct {
+		nombre  string
+		destino *bool
+	}{
+		{"CORREO_PERMITIR_ETIQUETA", &reglas.PermitirEtiqueta},
+		{"CORREO_PERMITIR_UNICODE", &reglas.PermitirUnicode},
+		{"CORREO_VERIFICAR_MX", &reglas.VerificarMX},
+	} {
+		if v := opcion(o.nombre); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return reglas, fmt.Errorf("%s=%q: debe ser true o false", o.nombre, v)
+			}
+			*o.destino = b
+		}
+	}
+	for _, o := range []struct {
+		nombre  string
+		destino *time.Duration
+	}{{"CORREO_MX_TIMEOUT", &reglas.TimeoutMX}, {"CORREO_MX_CACHE", &reglas.VigenciaMX}} {
+		if v := opcion(o.nombre); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return reglas, fmt.Errorf("%s=%q: debe ser una duración positiva", o.nombre, v)
+			}
+			*o.destino = d
+		}
+	}
+	dominios, err := cargarDominiosDesechables()
+	if err != nil {
+		return reglas, err
+	}
+	reglas.DominiosDesechables = dominios
+	return reglas, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// vigenciaVerificacionCorreo es el tiempo durante el cual es válido el
+// enlace de verificación enviado al registrarse.
+const vigenciaVerificacionCorreo = 48 * time.Hour
+
+// ReenviarVerificacionRequest define la estructura esperada para la
+// petición del endpoint /verificar-correo/reenviar.
+type ReenviarVerificacionRequest struct {
+	Correo string `json:"correo"`
+}
+
+// enviarVerificacionCorreo genera un token de verificación nuevo para el
+// usuario, guarda su hash y envía el enlace por correo.
+func enviarVerificacionCorreo(ctx context.Context, usuario *Usuario) error {
+	token, err := valorAleatorio()
+	if err != nil {
+		return err
+	}
+	usuario.TokenVerificacion = hashToken(token)
+	usuario.VenceVerificacion = time.Now().Add(vigenciaVerificacionCorreo)
+
+	enlace := config.URLPublica + prefijoAPI + "/verificar-correo?" + url.Values{"token": {token}}.Encode()
+	return encolarCorreo(ctx, usuario.Correo, usuario.idioma(), plantillaCorreoVerificacion, datosEnlaceCorreo{
+		Enlace: enlace, Horas: int(vigenciaVerificacionCorreo.Hours()),
+	})
+}
+
+// verificarCorreoHandler marca como verificada la cuenta asociada al
+// token recibido en la query string.
+func verificarCorreoHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el token de verificación", Codigo: "TOKEN_REQUERIDO"})
+		return
+	}
+
+	hash := hashToken(token)
+	usuario, desbloquear := bloquearUsuarioDonde(func(u *Usuario) bool {
+		return u.TokenVerificacion != "" && u.TokenVerificacion == hash
+	})
+	defer desbloquear()
+	if usuario == nil || time.Now().After(usuario.VenceVerificacion) {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Token de verificación inválido o expirado", Codigo: "TOKEN_INVALIDO"})
+		return
+	}
+
+	usuario.CorreoVerificado = true
+	usuario.TokenVerificacion = ""
+	registrarEvento(usuario, "correo_verificado")
+	slog.InfoContext(r.Context(), "Correo verificado correctamente", "correo", usuario.Correo)
+	escribirJSON(w, http.StatusOK, MensajeResponse{Mensaje: "Correo verificado exitosamente"})
+}
+
+// reenviarVerificacionHandler envía un nuevo enlace de verificación.
+// Siempre responde 202 para no revelar qué correos están registrados.
+func reenviarVerificacionHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReenviarVerificacionRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+	if req.Correo == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo correo", Codigo: "CAMPO_REQUERIDO"})
+		return
+	}
+
+	if usuario := buscarUsuario(req.Correo); usuario != nil {
+		desbloquear := usuario.bloquear()
+		if !usuario.CorreoVerificado {
+			if err := enviarVerificacionCorreo(r.Context(), usuario); err != nil {
+				slog.ErrorContext(r.Context(), "Error enviando verificación de correo", "error", err)
+			}
+		}
+		desbloquear()
+	}
+	escribirJSON(w, http.StatusAccepted, MensajeResponse{Mensaje: "Si el correo está registrado recibirás un enlace de verificación"})
+}
+
+// hashToken devuelve el hash SHA-256 en hexadecimal de un token de un
+// solo uso, para no guardarlo en claro.
+func hashToken(token string) string {
+	suma := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(suma[:])
+}
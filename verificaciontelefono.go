@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Parámetros de los códigos de verificación de teléfono.
+const (
+	vigenciaCodigoTelefono = 10 * time.Minute
+	maxIntentosTelefono    = 5
+)
+
+// codigoSMS genera un código aleatorio de 6 dígitos.
+func codigoSMS() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// enviarCodigoTelefono genera un código de 6 dígitos para el teléfono del
+// usuario, guarda su hash y lo envía por SMS.
+func enviarCodigoTelefono(ctx context.Context, usuario *Usuario) error {
+	codigo, err := codigoSMS()
+	if err != nil {
+		return err
+	}
+	if err := encolarSMS(ctx, usuario.Telefono, plantillaSMSVerificacion, datosPlantillaSMS{
+		Codigo: codigo, Minutos: int(vigenciaCodigoTelefono.Minutes()),
+	}); err != nil {
+		return err
+	}
+	usuario.CodigoTelefono = hashToken(codigo)
+	usuario.VenceCodigoTelefono = time.Now().Add(vigenciaCodigoTelefono)
+	usuario.IntentosCodigoTelefono = 0
+	return nil
+}
+
+// responderErrorSMS responde al error de enviar un código por SMS: 429
+// con Retry-After si el teléfono excedió su límite y, si no, 502.
+func responderErrorSMS(w http.ResponseWriter, r *http.Request, err error) {
+	var limite errorLimiteSMS
+	if errors.As(err, &limite) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limite.espera.Seconds()))))
+		escribirJSON(w, http.StatusTooManyRequests, ErrorResponse{Error: "Demasiados códigos enviados a este teléfono, intenta más tarde", Codigo: "DEMASIADOS_SMS"})
+		return
+	}
+	slog.ErrorContext(r.Context(), "Error enviando SMS", "error", err)
+	escribirJSON(w, http.StatusBadGateway, ErrorResponse{Error: "No se pudo enviar el código", Codigo: "ENVIO_FALLIDO"})
+}
+
+// enviarCodigoTelefonoHandler envía un código nuevo al teléfono del
+// usuario autenticado.
+func enviarCodigoTelefonoHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	if usuario.Telefono == "" {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "El usuario no tiene teléfono registrado", Codigo: "SIN_TELEFONO"})
+		return
+	}
+	if usuario.TelefonoVerificado {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "El teléfono ya está verificado", Codigo: "TELEFONO_YA_VERIFICADO"})
+		return
+	}
+	if err := enviarCodigoTelefono(r.Context(), usuario); err != nil {
+		responderErrorSMS(w, r, err)
+		return
+	}
+	escribirJSON(w, http.StatusAccepted, MensajeResponse{Mensaje: "Código enviado"})
+}
+
+// verificarTelefonoHandler confirma el teléfono del usuario autenticado
+// con el código recibido por SMS.
+func verificarTelefonoHandler(w http.ResponseWriter, r *http.Request) {
+	usuario := usuarioAutenticado(r)
+	defer usuario.bloquear()()
+	var req CodigoRequest
+	if errCuerpo := decodificarJSON(w, r, &req); errCuerpo != nil {
+		escribirJSON(w, errCuerpo.status, ErrorResponse{Error: errCuerpo.mensaje, Codigo: errCuerpo.codigo})
+		return
+	}
+	if req.Codigo == "" {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Falta el campo codigo", Codigo: "CAMPO_REQUERIDO"})
+		return
+	}
+	if usuario.TelefonoVerificado {
+		escribirJSON(w, http.StatusConflict, ErrorResponse{Error: "El teléfono ya está verificado", Codigo: "TELEFONO_YA_VERIFICADO"})
+		return
+	}
+	if usuario.CodigoTelefono == "" || time.Now().After(usuario.VenceCodigoTelefono) ||
+		usuario.IntentosCodigoTelefono >= maxIntentosTelefono {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Código expirado, solicita uno nuevo", Codigo: "CODIGO_EXPIRADO"})
+		return
+	}
+
+	usuario.IntentosCodigoTelefono++
+	if subtle.ConstantTimeCompare([]byte(hashToken(req.Codigo)), []byte(usuario.CodigoTelefono)) != 1 {
+		escribirJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Código de verificación inválido", Codigo: "CODIGO_INVALIDO"})
+		return
+	}
+
+	usuario.TelefonoVerificado = true
+	usuario.CodigoTelefono = ""
+	registrarEvento(usuario, "telefono_verificado")
+	slog.InfoContext(r.Context(), "Teléfono verificado correctamente", "correo", usuario.Correo)
+	escribirJSON(w, http.StatusOK, MensajeResponse{Mensaje: "Teléfono verificado exitosamente"})
+}
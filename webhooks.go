@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tipos de evento que se envían a los webhooks.
+const (
+	eventoUsuarioRegistrado = "usuario.registrado"
+	eventoUsuarioLogin      = "usuario.login"
+	eventoUsuarioBloqueado  = "usuario.bloqueado"
+)
+
+// eventosWebhookConocidos son los tipos válidos en WEBHOOKS_EVENTOS.
+var eventosWebhookConocidos = []string{eventoUsuarioRegistrado, eventoUsuarioLogin, eventoUsuarioBloqueado}
+
+// Headers de las peticiones a los webhooks.
+const (
+	headerFirmaWebhook  = "X-Webhook-Firma"
+	headerEventoWebhook = "X-Webhook-Evento"
+	headerIDWebhook     = "X-Webhook-ID"
+)
+
+// ConfigWebhooks define a dónde y cómo se envían los eventos de usuario.
+type ConfigWebhooks struct {
+	URLs    []string
+	Secreto string
+	Eventos []string
+	PoliticaReintentos
+	Timeout time.Duration
+}
+
+// cargarConfigWebhooks lee WEBHOOKS_URLS (URLs separadas por coma que
+// reciben cada evento por POST), WEBHOOKS_SECRETO (clave con que se
+// firman, obligatoria si hay URLs), WEBHOOKS_EVENTOS (tipos a enviar, por
+// defecto todos), WEBHOOKS_REINTENTOS (reintentos tras el primer intento,
+// por defecto 5), WEBHOOKS_BACKOFF y WEBHOOKS_BACKOFF_MAX (espera antes
+// del primer reintento, que se duplica en cada uno, y su máximo; por
+// defecto 1s y 5m) y WEBHOOKS_TIMEOUT (por intento, por defecto 10s).
+func cargarConfigWebhooks() (ConfigWebhooks, error) {
+	cfg := ConfigWebhooks{
+		Secreto: opcion("WEBHOOKS_SECRETO"),
+		Eventos: eventosWebhookConocidos,
+		PoliticaReintentos: PoliticaReintentos{
+			Reintentos: 5,
+			Backoff:    time.Second,
+			BackoffMax: 5 * time.Minute,
+		},
+		Timeout: 10 * time.Second,
+	}
+	for _, u := range strings.Split(opcion("WEBHOOKS_URLS"), ",") {
+		if u = strings.TrimSpace(u); u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return cfg, fmt.Errorf("WEBHOOKS_URLS: URL inválida %q", u)
+		}
+		cfg.URLs = append(cfg.URLs, u)
+	}
+	if len(cfg.URLs) > 0 && cfg.Secreto == "" {
+		return cfg, errors.New("WEBHOOKS_URLS requiere WEBHOOKS_SECRETO para firmar los eventos")
+	}
+	if v := opcion("WEBHOOKS_EVENTOS"); v != "" {
+		cfg.Eventos = nil
+		for _, e := range strings.Split(v, ",") {
+			e = strings.TrimSpace(e)
+			if !slices.Contains(eventosWebhookConocidos, e) {
+				return cfg, fmt.Errorf("WEBHOOKS_EVENTOS: evento desconocido %q", e)
+			}
+			cfg.Eventos = append(cfg.Eventos, e)
+		}
+	}
+	if n, err := strconv.Atoi(opcion("WEBHOOKS_REINTENTOS")); err == nil && n >= 0 {
+		cfg.Reintentos = n
+	}
+	if d, err := time.ParseDuration(opcion("WEBHOOKS_BACKOFF")); err == nil && d > 0 {
+		cfg.Backoff = d
+	}
+	if d, err := time.ParseDuration(opcion("WEBHOOKS_BACKOFF_MAX")); err == nil && d > 0 {
+		cfg.BackoffMax = d
+	}
+	if d, err := time.ParseDuration(opcion("WEBHOOKS_TIMEOUT")); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	return cfg, nil
+}
+
+// EventoWebhook es el cuerpo JSON que recibe cada webhook.
+type EventoWebhook struct {
+	ID        string         `json:"id"`
+	Tipo      string         `json:"tipo"`
+	Fecha     time.Time      `json:"fecha"`
+	Usuario   UsuarioWebhook `json:"usuario"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+// UsuarioWebhook identifica al usuario del evento.
+type UsuarioWebhook struct {
+	ID     string `json:"id"`
+	Correo string `json:"correo"`
+}
+
+// datosWebhook son los datos de la tarea que envía un evento a una URL.
+type datosWebhook struct {
+	URL    string        `json:"url"`
+	Evento EventoWebhook `json:"evento"`
+}
+
+// despachadorWebhooks envía los eventos como tareas en segundo plano, con
+// los reintentos de WEBHOOKS_*, para no demorar las peticiones que los
+// originan.
+type despachadorWebhooks struct {
+	cfg     ConfigWebhooks
+	cliente *http.Client
+}
+
+// webhooks es el despachador del servicio; main lo reemplaza al arrancar
+// por uno con la configuración de cargarConfigWebhooks.
+var webhooks = nuevoDespachadorWebhooks(ConfigWebhooks{})
+
+// nuevoDespachadorWebhooks crea el despachador.
+func nuevoDespachadorWebhooks(cfg ConfigWebhooks) *despachadorWebhooks {
+	return &despachadorWebhooks{cfg: cfg, cliente: nuevoClienteHTTP(cfg.Timeout)}
+}
+
+// publicar encola el evento para cada URL configurada si su tipo está en
+// WEBHOOKS_EVENTOS.
+func (d *despachadorWebhooks) publicar(r *http.Request, tipo string, usuario *Usuario) {
+	if len(d.cfg.URLs) == 0 || !slices.Contains(d.cfg.Eventos, tipo) {
+		return
+	}
+	evento := EventoWebhook{
+		ID:        nuevoID(),
+		Tipo:      tipo,
+		Fecha:     time.Now().UTC(),
+		Usuario:   UsuarioWebhook{ID: usuario.ID, Correo: usuario.Correo},
+		RequestID: requestID(r),
+	}
+	for _, u := range d.cfg.URLs {
+		if err := tareas.encolar(r.Context(), tareaWebhook, datosWebhook{URL: u, Evento: evento}); err != nil {
+			slog.WarnContext(r.Context(), "No se pudo encolar el evento del webhook; se descarta", "tipo", tipo, "webhook", u, "error", err)
+			metricaWebhooks.WithLabelValues(tipo, "descartada").Inc()
+		}
+	}
+}
+
+// politicaWebhooks devuelve los reintentos de WEBHOOKS_*, que
+// reemplazan a los de TAREAS_* para las entregas.
+func politicaWebhooks() PoliticaReintentos {
+	return webhooks.cfg.PoliticaReintentos
+}
+
+// ejecutarTareaWebhook hace un intento de entrega. Los errores de red,
+// 429 y 5xx se reintentan; los demás status de error no, porque el
+// destino rechazó el evento.
+func ejecutarTareaWebhook(ctx context.Context, datos json.RawMessage) error {
+	var d datosWebhook
+	if err := json.Unmarshal(datos, &d); err != nil {
+		return permanente(err)
+	}
+	reintentar, err := webhooks.enviar(ctx, d)
+	if err != nil && !reintentar {
+		return permanente(err)
+	}
+	return err
+}
+
+// webhookTerminado registra el resultado final de la entrega.
+func webhookTerminado(ctx context.Context, datos json.RawMessage, err error) {
+	var d datosWebhook
+	json.Unmarshal(datos, &d)
+	if err != nil {
+		slog.ErrorContext(ctx, "Webhook no entregado", "tipo", d.Evento.Tipo, "webhook", d.URL, "error", err)
+		metricaWebhooks.WithLabelValues(d.Evento.Tipo, "fallida").Inc()
+		return
+	}
+	slog.InfoContext(ctx, "Webhook entregado", "tipo", d.Evento.Tipo, "webhook", d.URL)
+	metricaWebhooks.WithLabelValues(d.Evento.Tipo, "exitosa").Inc()
+}
+
+// enviar hace un intento de entrega. Devuelve si el error amerita
+// reintentar y el error, o nil si el destino respondió 2xx.
+func (d *despachadorWebhooks) enviar(ctx context.Context, e datosWebhook) (reintentar bool, err error) {
+	cuerpo, err := json.Marshal(e.Evento)
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(cuerpo))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerEventoWebhook, e.Evento.Tipo)
+	req.Header.Set(headerIDWebhook, e.Evento.ID)
+	req.Header.Set(headerFirmaWebhook, firmarWebhook(d.cfg.Secreto, time.Now(), cuerpo))
+
+	resp, err := d.cliente.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
+
+// firmarWebhook devuelve el valor del header X-Webhook-Firma:
+// "t=<unix>,v1=<hex>", donde v1 es el HMAC-SHA256 con el secreto de
+// "<unix>.<cuerpo>". El receptor debe recalcularlo y rechazar firmas
+// distintas o con t demasiado antiguo, para evitar reenvíos.
+func firmarWebhook(secreto string, fecha time.Time, cuerpo []byte) string {
+	t := strconv.FormatInt(fecha.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secreto))
+	mac.Write([]byte(t + "."))
+	mac.Write(cuerpo)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EventoSesion es el mensaje JSON que recibe un cliente conectado a /ws o
+// a /eventos. Tipo es sesion_revocada, token_por_expirar, una alerta de
+// seguridad de la cuenta (login_pais_nuevo) o el de un evento del
+// historial de la cuenta (password_cambiada, correo_cambiado, ...). Un
+// sesion_revocada con Sesion sólo cierra las conexiones de esa sesión.
+type EventoSesion struct {
+	Tipo   string     `json:"tipo"`
+	Fecha  time.Time  `json:"fecha"`
+	Motivo string     `json:"motivo,omitempty"`
+	Expira *time.Time `json:"expira,omitempty"`
+	Sesion string     `json:"sesion,omitempty"`
+}
+
+// paraSesion indica si el evento se envía a una conexión abierta con el
+// token de la sesión sesion.
+func (e EventoSesion) paraSesion(sesion string) bool {
+	return e.Tipo != eventoSesionRevocada || e.Sesion == "" || e.Sesion == sesion
+}
+
+// Tipos de EventoSesion que no vienen del historial de la cuenta.
+const (
+	eventoSesionRevocada  = "sesion_revocada"
+	eventoTokenPorExpirar = "token_por_expirar"
+)
+
+// cierreSesionTerminada es el código de cierre con que el servidor
+// termina la conexión cuando el token deja de ser válido, porque se
+// revocó o expiró; el cliente debe volver a iniciar sesión.
+const cierreSesionTerminada websocket.StatusCode = 4001
+
+const (
+	// intervaloPingWS es cada cuánto se comprueba que el cliente siga
+	// conectado.
+	intervaloPingWS = 30 * time.Second
+	// capacidadEventosWS es cuántos eventos puede tener pendientes una
+	// conexión; si el cliente no los lee a tiempo se le desconecta.
+	capacidadEventosWS = 16
+	// tiempoCierreWS es el plazo para cerrar las conexiones al apagar.
+	tiempoCierreWS = 5 * time.Second
+)
+
+// canalesSesion reparte los eventos de sesión a las conexiones WebSocket
+// y SSE abiertas, agrupadas por el ID del usuario.
+type canalesSesion struct {
+	mu           sync.Mutex
+	suscriptores map[string]map[chan EventoSesion]bool
+	cerrado      chan struct{}
+	cerrarUnaVez sync.Once
+	abiertas     sync.WaitGroup
+}
+
+// eventosSesion son los canales de las conexiones abiertas en /ws y
+// /eventos.
+var eventosSesion = &canalesSesion{
+	suscriptores: map[string]map[chan EventoSesion]bool{},
+	cerrado:      make(chan struct{}),
+}
+
+// suscribir abre un canal para los eventos del usuario.
+func (c *canalesSesion) suscribir(id string) chan EventoSesion {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan EventoSesion, capacidadEventosWS)
+	if c.suscriptores[id] == nil {
+		c.suscriptores[id] = map[chan EventoSesion]bool{}
+	}
+	c.suscriptores[id][ch] = true
+	return ch
+}
+
+// cancelar quita el canal de los suscriptores del usuario.
+func (c *canalesSesion) cancelar(id string, ch chan EventoSesion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quitar(id, ch)
+}
+
+// quitar cierra el canal si seguía suscrito; requiere c.mu.
+func (c *canalesSesion) quitar(id string, ch chan EventoSesion) {
+	if !c.suscriptores[id][ch] {
+		return
+	}
+	delete(c.suscriptores[id], ch)
+	if len(c.suscriptores[id]) == 0 {
+		delete(c.suscriptores, id)
+	}
+	close(ch)
+}
+
+// publicar envía el evento a todas las conexiones del usuario sin
+// bloquear. Una conexión con el buffer lleno pierde su canal, lo que la
+// cierra: es preferible a que se pierda un sesion_revocada.
+func (c *canalesSesion) publicar(id string, e EventoSesion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ch := range c.suscriptores[id] {
+		select {
+		case ch <- e:
+		default:
+			slog.Warn("Conexión WebSocket sin leer sus eventos; se cierra", "tipo", e.Tipo)
+			c.quitar(id, ch)
+		}
+	}
+}
+
+// conexiones devuelve el número de conexiones abiertas.
+func (c *canalesSesion) conexiones() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := 0
+	for _, canales := range c.suscriptores {
+		total += len(canales)
+	}
+	return total
+}
+
+// avisarCierre avisa a todas las conexiones que el servidor se está
+// apagando. Se registra con http.Server.RegisterOnShutdown porque
+// Shutdown espera a que terminen las peticiones en curso, y las SSE no
+// terminan por sí solas.
+func (c *canalesSesion) avisarCierre() {
+	c.cerrarUnaVez.Do(func() { close(c.cerrado) })
+}
+
+// cerrar avisa del cierre y espera, como mucho tiempoCierreWS, a que
+// terminen de cerrarse las conexiones. http.Server.Shutdown no espera a
+// las WebSocket porque dejan de ser HTTP al aceptarse.
+func (c *canalesSesion) cerrar() {
+	c.avisarCierre()
+	cerradas := make(chan struct{})
+	go func() {
+		c.abiertas.Wait()
+		close(cerradas)
+	}()
+	select {
+	case <-cerradas:
+	case <-time.After(tiempoCierreWS):
+		slog.Warn("Conexiones de eventos sin cerrar al apagar", "conexiones", c.conexiones())
+	}
+}
+
+// conexionesWS cuenta las conexiones WebSocket abiertas, para la métrica
+// websocket_conexiones.
+var conexionesWS atomic.Int64
+
+// avisoExpiracion lee WS_AVISO_EXPIRACION, la anticipación con que se
+// envía token_por_expirar (por defecto 5m).
+func avisoExpiracion() time.Duration {
+	if d, err := time.ParseDuration(opcion("WS_AVISO_EXPIRACION")); err == nil && d > 0 {
+		return d
+	}
+	return 5 * time.Minute
+}
+
+// eventosSesionHandler atiende GET /ws: tras validar el token (ver
+// autenticarSuscripcion), mantiene abierta una conexión WebSocket por la
+// que envía al usuario sus EventoSesion. La conexión se cierra con
+// cierreSesionTerminada cuando el token se revoca o expira, y sólo se
+// aceptan orígenes externos que estén en CORS_ORIGENES.
+func eventosSesionHandler(origenes []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		usuario, expira, sesion, errServicio := autenticarSuscripcion(r)
+		if errServicio != nil {
+			responderErrorServicio(w, errServicio)
+			return
+		}
+
+		// La conexión dura lo que el token: se quitan los plazos de
+		// lectura y escritura del servidor, que seguirían vigentes en la
+		// conexión tomada por websocket.Accept.
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Time{})
+		rc.SetWriteDeadline(time.Time{})
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: origenes})
+		if err != nil {
+			slog.InfoContext(r.Context(), "Conexión WebSocket rechazada", "error", err)
+			return
+		}
+		defer conn.CloseNow()
+		eventosSesion.abiertas.Add(1)
+		defer eventosSesion.abiertas.Done()
+		conexionesWS.Add(1)
+		defer conexionesWS.Add(-1)
+
+		eventos := eventosSesion.suscribir(usuario.ID)
+		defer eventosSesion.cancelar(usuario.ID, eventos)
+		slog.InfoContext(r.Context(), "Conexión WebSocket abierta", "correo", usuario.correoActual())
+
+		// El cliente no envía mensajes; CloseRead atiende los frames de
+		// control y cancela ctx cuando cierra la conexión.
+		ctx := conn.CloseRead(r.Context())
+		aviso := time.NewTimer(time.Until(expira.Add(-avisoExpiracion())))
+		defer aviso.Stop()
+		expiracion := time.NewTimer(time.Until(expira))
+		defer expiracion.Stop()
+		ping := time.NewTicker(intervaloPingWS)
+		defer ping.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				slog.InfoContext(r.Context(), "Conexión WebSocket cerrada por el cliente")
+				return
+			case <-eventosSesion.cerrado:
+				conn.Close(websocket.StatusGoingAway, "Servidor apagándose")
+				return
+			case e, ok := <-eventos:
+				if !ok {
+					conn.Close(websocket.StatusPolicyViolation, "Eventos sin leer")
+					return
+				}
+				if !e.paraSesion(sesion) {
+					continue
+				}
+				if err := enviarEventoSesion(ctx, conn, e); err != nil {
+					return
+				}
+				if e.Tipo == eventoSesionRevocada {
+					conn.Close(cierreSesionTerminada, "Sesión revocada")
+					return
+				}
+			case <-aviso.C:
+				if err := enviarEventoSesion(ctx, conn, EventoSesion{Tipo: eventoTokenPorExpirar, Fecha: time.Now(), Expira: &expira}); err != nil {
+					return
+				}
+			case <-expiracion.C:
+				conn.Close(cierreSesionTerminada, "Token expirado")
+				return
+			case <-ping.C:
+				ctxPing, cancel := context.WithTimeout(ctx, intervaloPingWS/2)
+				err := conn.Ping(ctxPing)
+				cancel()
+				if err != nil {
+					slog.InfoContext(r.Context(), "Conexión WebSocket sin respuesta al ping", "error", err)
+					return
+				}
+			}
+		}
+	}
+}
+
+// autenticarSuscripcion valida el token de una conexión a /ws o /eventos:
+// el del header Authorization o, como los navegadores no pueden enviar
+// headers al abrir un WebSocket o un EventSource, el del parámetro token.
+// Devuelve el usuario, el vencimiento del token y su sesión.
+func autenticarSuscripcion(r *http.Request) (*Usuario, time.Time, string, *errorServicio) {
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		tokenString = r.URL.Query().Get("token")
+	}
+	ctx, errServicio := autenticarToken(r.Context(), tokenString, requisitosCompletos)
+	if errServicio != nil {
+		return nil, time.Time{}, "", errServicio
+	}
+	claims := ctx.Value(claveClaims).(jwt.MapClaims)
+	expira, err := claims.GetExpirationTime()
+	if err != nil || expira == nil {
+		return nil, time.Time{}, "", nuevoErrorServicio(http.StatusUnauthorized, "TOKEN_INVALIDO", "Token inválido o expirado")
+	}
+	sesion, _ := claims["sid"].(string)
+	return usuarioAutenticado(r.WithContext(ctx)), expira.Time, sesion, nil
+}
+
+// enviarEventoSesion escribe el evento como un mensaje de texto JSON.
+func enviarEventoSesion(ctx context.Context, conn *websocket.Conn, e EventoSesion) error {
+	mensaje, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return conn.Write(ctx, websocket.MessageText, mensaje)
+}